@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/devflow"
+	"devflow-agent/packages/handlers"
+	"devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+)
+
+// command is a subcommand of the devflow binary that runs without the webhook server or
+// GitHub App credentials
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"action", "handle the event of the current GitHub Actions job", runAction},
+	{"analyze", "write the repository structure and LLM analysis into .devflow", runAnalyze},
+	{"init-kb", "build the complete .devflow knowledge base", runInitKB},
+	{"resolve", "run the agent on an issue and leave its changes in the working tree", runResolve},
+	{"sync", "bring the .devflow knowledge base up to a commit", runSync},
+}
+
+// errUsage is returned for bad invocations, after the usage has been printed
+var errUsage = errors.New("invalid usage")
+
+// runCommand runs the named subcommand until it finishes or the process is interrupted
+func runCommand(name string, args []string) error {
+	for _, c := range commands {
+		if c.name == name {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			if err := c.run(ctx, args); !errors.Is(err, flag.ErrHelp) {
+				return err
+			}
+			return nil
+		}
+	}
+	printUsage()
+	if name == "help" || name == "-h" || name == "--help" {
+		return nil
+	}
+	return errUsage
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: devflow [command] [flags]")
+	fmt.Fprintln(os.Stderr, "\nWithout a command, or with serve, devflow runs the GitHub App.")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	fmt.Fprintf(os.Stderr, "  %-10s %s\n", "serve", "run the GitHub App; --fake runs offline against a local repository")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun devflow <command> -h for the flags of a command.")
+}
+
+// repoFlags are the flags every local command takes
+type repoFlags struct {
+	path string
+	name string
+}
+
+func newFlagSet(name string, rf *repoFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&rf.path, "repo", ".", "path of the local git checkout")
+	fs.StringVar(&rf.name, "name", "", "owner/name of the repository; taken from the origin remote by default")
+	return fs
+}
+
+// resolveRepo returns the absolute checkout path, the repository's name and its URL
+func (rf *repoFlags) resolveRepo() (string, string, string, error) {
+	path, err := filepath.Abs(rf.path)
+	if err != nil {
+		return "", "", "", err
+	}
+	if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+		return "", "", "", fmt.Errorf("%s is not a git checkout", path)
+	}
+	url := path
+	if out, err := exec.Command("git", "-C", path, "remote", "get-url", "origin").Output(); err == nil {
+		url = strings.TrimSpace(string(out))
+	}
+	name := rf.name
+	if name == "" {
+		if remote, ok := repository.RepoNameFromURL(url); ok && url != path {
+			name = remote
+		} else {
+			name = "local/" + filepath.Base(path)
+		}
+	}
+	return path, name, url, nil
+}
+
+// client returns the checkout with a pipeline client on the loaded configuration
+func (rf *repoFlags) client() (devflow.Repo, *devflow.Client, error) {
+	path, name, url, err := rf.resolveRepo()
+	if err != nil {
+		return devflow.Repo{}, nil, err
+	}
+	client, err := devflow.New(devflow.Options{Config: config.GetConfig()})
+	return devflow.Repo{Path: path, Name: name, URL: url}, client, err
+}
+
+// parseFlags parses a command's flags; -h returns flag.ErrHelp once the flags are printed
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func runAction(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("action", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	return handlers.RunAction()
+}
+
+func runAnalyze(ctx context.Context, args []string) error {
+	var rf repoFlags
+	fs := newFlagSet("analyze", &rf)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	path, _, url, err := rf.resolveRepo()
+	if err != nil {
+		return err
+	}
+
+	cfg := config.GetConfig()
+	if err := repository.CreateDirectory(cfg.GetDevflowDir(path)); err != nil {
+		return err
+	}
+	structureFile := cfg.GetDevflowPath(path, cfg.Files.StructureFile)
+	if err := repository.AnalyzeRepo(nil, structureFile, path, url); err != nil {
+		return err
+	}
+	analysisFile := cfg.GetDevflowPath(path, cfg.Files.AnalysisFile)
+	analysisCtx, cancel := config.StageContext(ctx, cfg.Timeouts.AnalysisSeconds)
+	defer cancel()
+	if err := repository.GenerateRepoAnalysisWithLLM(analysisCtx, path, url, structureFile, analysisFile); err != nil {
+		return err
+	}
+	fmt.Println(structureFile)
+	fmt.Println(analysisFile)
+	return nil
+}
+
+func runInitKB(ctx context.Context, args []string) error {
+	var rf repoFlags
+	fs := newFlagSet("init-kb", &rf)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	repo, client, err := rf.client()
+	if err != nil {
+		return err
+	}
+	files, err := client.InitKnowledgeBase(ctx, devflow.InitKnowledgeBaseOptions{Repo: repo})
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Println(f)
+	}
+	return nil
+}
+
+func runResolve(ctx context.Context, args []string) error {
+	var rf repoFlags
+	var issueFile string
+	fs := newFlagSet("resolve", &rf)
+	fs.StringVar(&issueFile, "issue", "", "JSON file with the issue as returned by the GitHub API (number, title, body, labels)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if issueFile == "" {
+		fmt.Fprintln(os.Stderr, "resolve needs --issue")
+		fs.Usage()
+		return errUsage
+	}
+	repo, client, err := rf.client()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(issueFile)
+	if err != nil {
+		return err
+	}
+	var issue github.Issue
+	if err := json.Unmarshal(data, &issue); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", issueFile, err)
+	}
+	if issue.GetTitle() == "" {
+		return fmt.Errorf("%s has no issue title", issueFile)
+	}
+
+	labels := make([]string, len(issue.Labels))
+	for i, l := range issue.Labels {
+		labels[i] = l.GetName()
+	}
+	result, err := client.ResolveIssue(ctx, devflow.ResolveIssueOptions{
+		Repo:  repo,
+		Issue: devflow.Issue{Number: issue.GetNumber(), Title: issue.GetTitle(), Body: issue.GetBody(), Labels: labels},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(result.Summary)
+	if len(result.ChangedFiles) == 0 {
+		fmt.Println("\nNo files were changed.")
+		return nil
+	}
+	fmt.Println("\nChanged files:")
+	for _, f := range result.ChangedFiles {
+		fmt.Println("  " + f)
+	}
+	return nil
+}
+
+func runSync(ctx context.Context, args []string) error {
+	var rf repoFlags
+	var ref string
+	fs := newFlagSet("sync", &rf)
+	fs.StringVar(&ref, "ref", "HEAD", "commit to sync the knowledge base to")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	repo, client, err := rf.client()
+	if err != nil {
+		return err
+	}
+	result, err := client.SyncKnowledgeBase(ctx, devflow.SyncKnowledgeBaseOptions{Repo: repo, Ref: ref})
+	if err != nil {
+		return err
+	}
+	if result.Upgraded {
+		fmt.Printf("Knowledge base upgraded to schema %d\n", repository.KnowledgeBaseSchemaVersion)
+	}
+	fmt.Printf("Knowledge base synced to %.7s (%d changed files)\n", result.SHA, len(result.Changes))
+	return nil
+}
@@ -0,0 +1,331 @@
+// Command kbbench checks the knowledge base generators against fixture repositories and times
+// them. Each directory of testdata/kb holds a repo/ to analyze and the golden/ outputs it must
+// produce; documents that need an LLM (summaries, analysis) are not covered.
+//
+//	go run ./cmd/kbbench                         # compare every fixture with its golden outputs
+//	go run ./cmd/kbbench -update                 # rewrite the golden outputs and timing baseline
+//	go run ./cmd/kbbench -bench                  # also time the generators against the baseline
+//	go run ./cmd/kbbench -bench -synthetic 5000  # time them on a generated 5000-file repository
+//	go run ./cmd/kbbench -bench -repo ../other   # time them on any checkout
+//
+// It exits non-zero when an output differs from its golden file or a generator got slower
+// than -tolerance times its baseline.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/repository"
+)
+
+// minRegression is the slowdown below which timings are treated as noise whatever the tolerance
+const minRegression = 50 * time.Millisecond
+
+// generator writes one knowledge base document
+type generator struct {
+	name string // output file name
+	run  func(repoPath, outputFile string) error
+}
+
+func generators(cfg *config.Config) []generator {
+	return []generator{
+		{cfg.Files.StructureFile, func(repoPath, out string) error {
+			return repository.AnalyzeRepo(nil, out, repoPath, "https://github.com/devflow-fixtures/"+filepath.Base(repoPath))
+		}},
+		{cfg.Files.DependencyFile, repository.GenerateDependencyGraph},
+		{cfg.Files.CallGraphFile, func(repoPath, out string) error {
+			return repository.GenerateCallGraph(context.Background(), repoPath, out)
+		}},
+		{cfg.Files.InfrastructureFile, repository.GenerateInfrastructureSummary},
+		{cfg.Files.APISurfaceFile, repository.GenerateAPISurface},
+	}
+}
+
+func main() {
+	fixtures := flag.String("fixtures", "testdata/kb", "directory of fixture repositories")
+	configFile := flag.String("config", "config/development.yaml", "configuration file")
+	update := flag.Bool("update", false, "rewrite the golden outputs and the timing baseline")
+	bench := flag.Bool("bench", false, "time the generators")
+	runs := flag.Int("runs", 5, "timed runs per generator; the median counts")
+	baselineFile := flag.String("baseline", "testdata/kb/benchmarks.json", "timing baseline, in milliseconds per fixture and document")
+	tolerance := flag.Float64("tolerance", 2.0, "slowdown factor over the baseline that fails the run")
+	synthetic := flag.Int("synthetic", 0, "time a generated repository with this many files instead of the fixtures")
+	repoPath := flag.String("repo", "", "time this checkout instead of the fixtures")
+	flag.Parse()
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	if _, err := config.LoadConfig(*configFile); err != nil {
+		fail(err)
+	}
+	// Golden outputs must not carry timestamps or depend on git history
+	cfg := *config.GetConfig()
+	cfg.KnowledgeBase.Deterministic = true
+	config.Use(&cfg)
+	gens := generators(&cfg)
+
+	work, err := os.MkdirTemp("", "kbbench-")
+	if err != nil {
+		fail(err)
+	}
+	defer os.RemoveAll(work)
+
+	switch {
+	case *synthetic > 0:
+		dir := filepath.Join(work, "synthetic")
+		if err := writeSyntheticRepo(dir, *synthetic); err != nil {
+			fail(err)
+		}
+		printTimings(fmt.Sprintf("synthetic (%d files)", *synthetic), timeGenerators(gens, dir, work, *runs))
+		return
+	case *repoPath != "":
+		printTimings(*repoPath, timeGenerators(gens, *repoPath, work, *runs))
+		return
+	}
+
+	names, err := fixtureNames(*fixtures)
+	if err != nil {
+		fail(err)
+	}
+	baseline := map[string]map[string]float64{}
+	if data, err := os.ReadFile(*baselineFile); err == nil {
+		if err := json.Unmarshal(data, &baseline); err != nil {
+			fail(fmt.Errorf("failed to parse %s: %w", *baselineFile, err))
+		}
+	}
+
+	failed := false
+	timings := map[string]map[string]float64{}
+	for _, name := range names {
+		// A copy keeps outputs out of the fixture and the repository name stable
+		repo := filepath.Join(work, name)
+		if err := os.CopyFS(repo, os.DirFS(filepath.Join(*fixtures, name, "repo"))); err != nil {
+			fail(err)
+		}
+		out := filepath.Join(work, name+"-out")
+		if err := os.MkdirAll(out, 0755); err != nil {
+			fail(err)
+		}
+		for _, g := range gens {
+			produced := filepath.Join(out, g.name)
+			if err := g.run(repo, produced); err != nil {
+				fmt.Printf("FAIL %s/%s: %v\n", name, g.name, err)
+				failed = true
+				continue
+			}
+			golden := filepath.Join(*fixtures, name, "golden", g.name)
+			if *update {
+				if err := copyFile(produced, golden); err != nil {
+					fail(err)
+				}
+				continue
+			}
+			if diff := compareFiles(produced, golden); diff != "" {
+				fmt.Printf("FAIL %s/%s differs from its golden output:\n%s\n", name, g.name, diff)
+				failed = true
+			}
+		}
+		if *bench || *update {
+			timings[name] = timeGenerators(gens, repo, work, *runs)
+			printTimings(name, timings[name])
+			if !*update && checkRegressions(name, timings[name], baseline[name], *tolerance) {
+				failed = true
+			}
+		}
+	}
+
+	if *update {
+		data, err := json.MarshalIndent(timings, "", "  ")
+		if err != nil {
+			fail(err)
+		}
+		if err := os.WriteFile(*baselineFile, append(data, '\n'), 0644); err != nil {
+			fail(err)
+		}
+		fmt.Printf("Updated the golden outputs of %d fixtures and %s\n", len(names), *baselineFile)
+		return
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Printf("ok: %d fixtures match their golden outputs\n", len(names))
+}
+
+// fixtureNames lists the fixtures, the directories of dir with a repo/ inside
+func fixtureNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if st, err := os.Stat(filepath.Join(dir, e.Name(), "repo")); err == nil && st.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no fixtures in %s", dir)
+	}
+	return names, nil
+}
+
+// timeGenerators returns the median milliseconds each generator takes on repoPath
+func timeGenerators(gens []generator, repoPath, work string, runs int) map[string]float64 {
+	out := filepath.Join(work, "timing")
+	if err := os.MkdirAll(out, 0755); err != nil {
+		fail(err)
+	}
+	timings := make(map[string]float64, len(gens))
+	for _, g := range gens {
+		samples := make([]time.Duration, 0, runs)
+		for range max(runs, 1) {
+			start := time.Now()
+			if err := g.run(repoPath, filepath.Join(out, g.name)); err != nil {
+				fail(fmt.Errorf("%s: %w", g.name, err))
+			}
+			samples = append(samples, time.Since(start))
+		}
+		slices.Sort(samples)
+		timings[g.name] = float64(samples[len(samples)/2].Microseconds()) / 1000
+	}
+	return timings
+}
+
+// checkRegressions reports the generators slower than tolerance times their baseline
+func checkRegressions(fixture string, timings, baseline map[string]float64, tolerance float64) bool {
+	regressed := false
+	for name, ms := range timings {
+		base, ok := baseline[name]
+		if !ok {
+			continue
+		}
+		slower := time.Duration((ms - base) * float64(time.Millisecond))
+		if ms > base*tolerance && slower > minRegression {
+			fmt.Printf("FAIL %s/%s took %.1fms, %.1fx its %.1fms baseline\n", fixture, name, ms, ms/base, base)
+			regressed = true
+		}
+	}
+	return regressed
+}
+
+func printTimings(label string, timings map[string]float64) {
+	names := make([]string, 0, len(timings))
+	for name := range timings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("%s:\n", label)
+	for _, name := range names {
+		fmt.Printf("  %-28s %10.1fms\n", name, timings[name])
+	}
+}
+
+// compareFiles returns the first lines where produced and golden differ, or "" when they match
+func compareFiles(produced, golden string) string {
+	got, err := os.ReadFile(produced)
+	if err != nil {
+		return err.Error()
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		return fmt.Sprintf("  %v (run with -update to create it)", err)
+	}
+	if bytes.Equal(got, want) {
+		return ""
+	}
+	gotLines, wantLines := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+	for i := 0; i < max(len(gotLines), len(wantLines)); i++ {
+		g, w := lineAt(gotLines, i), lineAt(wantLines, i)
+		if g != w {
+			return fmt.Sprintf("  line %d:\n  - %s\n  + %s", i+1, w, g)
+		}
+	}
+	return "  (whitespace differs)"
+}
+
+func lineAt(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return "<end of file>"
+}
+
+func copyFile(from, to string) error {
+	data, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(to, data, 0644)
+}
+
+// writeSyntheticRepo generates a repository of n Go, TypeScript and Python files that import
+// each other in chains, for timing the generators at scale
+func writeSyntheticRepo(dir string, n int) error {
+	write := func(rel, content string) error {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(content), fs.FileMode(0644))
+	}
+	if err := write("go.mod", "module example.com/synthetic\n\ngo 1.22\n"); err != nil {
+		return err
+	}
+	// File i lives in directory i/20 and, from the fourth file on, calls file i-3 of its language
+	for i := range n {
+		pkg, prev := i/20, i-3
+		var rel, content string
+		switch i % 3 {
+		case 0:
+			rel = fmt.Sprintf("pkg/p%d/f%d.go", pkg, i)
+			imp, call := "", ""
+			if prev >= 0 && prev/20 != pkg {
+				imp = fmt.Sprintf("import \"example.com/synthetic/pkg/p%d\"\n\n", prev/20)
+				call = fmt.Sprintf("\tp%d.F%d()\n", prev/20, prev)
+			} else if prev >= 0 {
+				call = fmt.Sprintf("\tF%d()\n", prev)
+			}
+			content = fmt.Sprintf("package p%d\n\n%s// F%d does step %d\nfunc F%d() int {\n%s\treturn %d\n}\n", pkg, imp, i, i, i, call, i)
+		case 1:
+			rel = fmt.Sprintf("web/m%d/f%d.ts", pkg, i)
+			imp, body := "", "x"
+			if prev >= 0 {
+				imp = fmt.Sprintf("import { f%d } from \"../m%d/f%d\";\n\n", prev, prev/20, prev)
+				body = fmt.Sprintf("f%d(x)", prev)
+			}
+			content = fmt.Sprintf("%sexport function f%d(x: number): number {\n  return %s + %d;\n}\n", imp, i, body, i)
+		default:
+			rel = fmt.Sprintf("py/m%d/f%d.py", pkg, i)
+			imp, body := "", "x"
+			if prev >= 0 {
+				imp = fmt.Sprintf("from py.m%d.f%d import f%d\n\n\n", prev/20, prev, prev)
+				body = fmt.Sprintf("f%d(x)", prev)
+			}
+			content = fmt.Sprintf("%sdef f%d(x):\n    return %s + %d\n", imp, i, body, i)
+		}
+		if err := write(rel, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,34 @@
+// Command promptlint checks prompt templates: the embedded defaults, merged with the overrides
+// in the directory given as the argument.
+//
+//	go run ./cmd/promptlint [override-dir]
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"devflow-agent/packages/prompts"
+)
+
+func main() {
+	dir := ""
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+	templates, err := prompts.Lint(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := templates[name]
+		fmt.Printf("%s v%d (%s)\n", name, t.Version, t.Source)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"devflow-agent/packages/devharness"
+)
+
+// serveFlags are the flags of `devflow serve`
+type serveFlags struct {
+	fake      bool
+	addr      string
+	issueFile string
+	harness   devharness.Options
+}
+
+func parseServeFlags(args []string) (*serveFlags, error) {
+	f := &serveFlags{}
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.BoolVar(&f.fake, "fake", false, "run offline against a local repository with fake GitHub and LLM backends")
+	fs.StringVar(&f.harness.RepoDir, "repo", ".", "local git repository to run against (--fake)")
+	fs.StringVar(&f.harness.RepoName, "repo-name", "", "owner/name to serve the repository as (--fake)")
+	fs.StringVar(&f.harness.Cassette, "cassette", "", "JSON file of LLM replies to play back (--fake)")
+	fs.StringVar(&f.harness.Record, "record", "", "call the real Gemini API and record its replies to this file (--fake)")
+	fs.StringVar(&f.addr, "addr", "127.0.0.1:3300", "address of the harness API (--fake)")
+	fs.StringVar(&f.issueFile, "issue", "", "resolve the issue in this JSON file, print the result and exit (--fake)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// serveFake runs the issue pipeline offline. With --issue it resolves that one issue and
+// prints the state of the fake repository; otherwise it serves the harness API until
+// interrupted.
+func serveFake(f *serveFlags) error {
+	h, err := devharness.Start(f.harness)
+	if err != nil {
+		return fmt.Errorf("failed to start fake harness: %w", err)
+	}
+	defer h.Close()
+
+	if f.issueFile != "" {
+		data, err := os.ReadFile(f.issueFile)
+		if err != nil {
+			return err
+		}
+		var issue devharness.NewIssue
+		if err := json.Unmarshal(data, &issue); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", f.issueFile, err)
+		}
+		_, runErr := h.OpenIssue(issue.Title, issue.Body, issue.Labels)
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(h.State()); err != nil {
+			return err
+		}
+		return runErr
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := &http.Server{Addr: f.addr, Handler: h.Handler()}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Shutdown(context.Background())
+	}()
+	slog.Info("Fake DevFlow listening; POST /issues to run the pipeline, GET /state to inspect it", "addr", f.addr, "repo", h.RepoName)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -2,24 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 
+	"devflow-agent/packages/cassette"
 	"devflow-agent/packages/config"
 	"devflow-agent/packages/handlers"
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/network"
+	"devflow-agent/packages/prompts"
 
 	"github.com/joho/godotenv"
 	"github.com/swinton/go-probot/probot"
 )
 
 func main() {
-	// Configure logging to reduce verbosity
-	baseHandler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	})
-	filteredHandler := &FilteredHandler{handler: baseHandler}
-	slog.SetDefault(slog.New(filteredHandler))
+	// Text at the info level until the configuration says otherwise
+	_ = logging.Configure(config.LoggingConfig{})
 
 	// Load .env file
 	if err := godotenv.Load(); err != nil {
@@ -32,7 +34,64 @@ func main() {
 		slog.Error("Failed to load configuration", "error", err)
 		os.Exit(1)
 	}
+	if err := logging.Configure(config.GetConfig().Logging); err != nil {
+		slog.Error("Failed to configure logging", "error", err)
+		os.Exit(1)
+	}
 	slog.Info("Configuration loaded successfully")
+	if err := prompts.Check(); err != nil {
+		slog.Error("Failed to load prompt templates", "error", err)
+		os.Exit(1)
+	}
+
+	// Proxy and CA settings must be in place before any client is created
+	if err := network.Configure(config.GetConfig().Network); err != nil {
+		slog.Error("Failed to configure outbound network", "error", err)
+		os.Exit(1)
+	}
+	// Recorded LLM exchanges wrap the configured transport
+	if err := cassette.Install(config.GetConfig()); err != nil {
+		slog.Error("Failed to install LLM cassette", "error", err)
+		os.Exit(1)
+	}
+
+	// `devflow serve --fake` runs the pipeline offline; plain `devflow serve` is the bot
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		flags, err := parseServeFlags(os.Args[2:])
+		if err != nil {
+			os.Exit(2)
+		}
+		if flags.fake {
+			if err := serveFake(flags); err != nil {
+				slog.Error("Fake harness failed", "error", err)
+				os.Exit(1)
+			}
+			return
+		}
+	} else if len(os.Args) > 1 {
+		// Local commands work on a checkout and need no GitHub App credentials
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			if errors.Is(err, errUsage) {
+				os.Exit(2)
+			}
+			slog.Error("Command failed", "command", os.Args[1], "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	watchConfigReload()
+
+	// Token mode has no App to receive webhooks for; it polls instead
+	if config.GetConfig().Auth.Mode == "token" {
+		runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		handlers.StartAdminServer()
+		if err := handlers.RunTokenMode(runCtx); err != nil {
+			slog.Error("Token mode stopped", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Load private key
 	loadPrivateKey()
@@ -41,16 +100,67 @@ func main() {
 	appID := os.Getenv("GITHUB_APP_ID")
 	slog.Info("App ID: ", "appID", appID)
 
-	// Register event handlers
-	probot.HandleEvent("issues", handlers.HandleIssues)
-	probot.HandleEvent("installation_repositories", handlers.HandleInstallations)
+	switch config.GetConfig().Queue.Mode {
+	case "receiver":
+		// Receivers only validate and enqueue; all processing happens on the workers
+		if err := handlers.ServeQueueReceiver(); err != nil {
+			slog.Error("Webhook receiver stopped", "error", err)
+			os.Exit(1)
+		}
+		return
+	case "worker":
+		startBackgroundJobs()
+		if err := handlers.RunQueueWorkers(context.Background()); err != nil {
+			slog.Error("Queue workers stopped", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	probot.HandleEvent("pull_request", handlers.HandlePullRequest)
+	// Register event handlers
+	for event, handler := range handlers.EventHandlers {
+		probot.HandleEvent(event, handler)
+	}
+	startBackgroundJobs()
 
 	// Start the bot
 	probot.Start()
 }
 
+// startBackgroundJobs starts the work that is not triggered by webhooks
+func startBackgroundJobs() {
+	handlers.StartDependencyUpgradeScheduler()
+	handlers.StartJanitor()
+	handlers.StartHeldTriggerReleaser()
+	handlers.StartSecurityAlertReceiver()
+	handlers.StartDiscussionReceiver()
+	handlers.StartProviderReceiver()
+	handlers.StartAdminServer()
+	handlers.StartRunsAPI()
+}
+
+// watchConfigReload reloads the configuration file whenever the process receives SIGHUP.
+// Runs already in flight pick up the new values wherever they read config.GetConfig().
+func watchConfigReload() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			if _, err := config.Reload(); err != nil {
+				slog.Error("Failed to reload configuration, keeping previous", "error", err)
+				continue
+			}
+			if err := logging.Configure(config.GetConfig().Logging); err != nil {
+				slog.Error("Invalid logging settings, keeping previous", "error", err)
+			}
+			slog.Info("Configuration reloaded")
+			if err := prompts.Check(); err != nil {
+				slog.Error("Prompt templates are invalid; LLM calls will fail until they are fixed", "error", err)
+			}
+		}
+	}()
+}
+
 func loadPrivateKey() {
 	keyPath := os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH")
 	if keyPath != "" {
@@ -60,31 +170,6 @@ func loadPrivateKey() {
 		} else {
 			os.Setenv("GITHUB_APP_PRIVATE_KEY", string(keyData))
 			slog.Info("Private key loaded from", "keyPath", keyPath)
-			slog.Info("Private key starts with", "keyData", string(keyData)[:50])
 		}
 	}
 }
-
-type FilteredHandler struct {
-	handler slog.Handler
-}
-
-func (h *FilteredHandler) Handle(ctx context.Context, r slog.Record) error {
-	// Only filter out headers
-	if strings.Contains(r.Message, "Headers:") {
-		return nil
-	}
-	return h.handler.Handle(ctx, r)
-}
-
-func (h *FilteredHandler) Enabled(ctx context.Context, level slog.Level) bool {
-	return h.handler.Enabled(ctx, level)
-}
-
-func (h *FilteredHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return &FilteredHandler{handler: h.handler.WithAttrs(attrs)}
-}
-
-func (h *FilteredHandler) WithGroup(name string) slog.Handler {
-	return &FilteredHandler{handler: h.handler.WithGroup(name)}
-}
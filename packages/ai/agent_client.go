@@ -2,6 +2,8 @@ package ai
 
 import (
 	"bytes"
+	"context"
+	appconfig "devflow-agent/packages/config"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,16 +17,63 @@ import (
 
 // IssueData represents the issue information to send to the agent
 type IssueData struct {
-	Title  string   `json:"title"`
-	Body   string   `json:"body"`
-	Labels []string `json:"labels"`
+	Title            string   `json:"title"`
+	Body             string   `json:"body"`
+	Labels           []string `json:"labels"`
+	LinkedContext    string   `json:"linked_context,omitempty"`
+	CandidateFiles   []string `json:"candidate_files,omitempty"`
+	CandidateRanking string   `json:"candidate_ranking,omitempty"`
+	OwnershipContext string   `json:"ownership_context,omitempty"`
+	CodeContext      string   `json:"code_context,omitempty"`
+	FileSummaries    string   `json:"file_summaries,omitempty"`
+	InfraContext     string   `json:"infra_context,omitempty"`
+	APIContext       string   `json:"api_context,omitempty"`
+	ImpactContext    string   `json:"impact_context,omitempty"`
+
+	FileSelectionInstructions  string `json:"file_selection_instructions,omitempty"`
+	CodeGenerationInstructions string `json:"code_generation_instructions,omitempty"`
+}
+
+// IssueContext holds context gathered on the Go side before calling the agent
+type IssueContext struct {
+	LinkedContext string
+	// CandidateFiles are repo-relative paths the agent should inspect first
+	CandidateFiles []string
+	// Candidates ranks CandidateFiles with the reasons each was picked, most relevant first
+	Candidates []FileCandidate
+	// OwnershipContext summarizes recent history and primary authors of CandidateFiles
+	OwnershipContext string
+	// CodeContext is the budgeted code-files document for CandidateFiles
+	CodeContext string
+	// FileSummaries lists the KB's per-file summaries, most relevant first
+	FileSummaries string
+	// InfraContext summarizes migrations, IaC and container definitions when the issue is about them
+	InfraContext string
+	// APIContext is the condensed API surface (OpenAPI, GraphQL, protobuf) when the issue touches endpoints
+	APIContext string
+	// ImpactContext lists the callers elsewhere of functions in CandidateFiles, from the call graph
+	ImpactContext string
+	// Mode is "docs" for documentation-only runs; empty means the agent picks from the labels
+	Mode string
+	// PromptVariants are the experiment arms whose instructions are added to the prompts
+	PromptVariants []PromptVariant
+	// Generation overrides the global ai settings for the run; nil keeps them
+	Generation *GenerationSettings
+}
+
+// FileCandidate is a file an issue is likely about, scored from 0 to 1
+type FileCandidate struct {
+	File    string
+	Score   float64
+	Reasons []string
 }
 
 // ProcessIssueRequest represents the request to the agent server
 type ProcessIssueRequest struct {
-	RepoPath string    `json:"repo_path"`
-	Issue    IssueData `json:"issue"`
-	Mode     string    `json:"mode"`
+	RepoPath   string              `json:"repo_path"`
+	Issue      IssueData           `json:"issue"`
+	Mode       string              `json:"mode"`
+	Generation *GenerationSettings `json:"generation,omitempty"`
 }
 
 // MarshalJSON ensures RepoPath is absolute before sending to the Python server.
@@ -35,14 +84,16 @@ func (p ProcessIssueRequest) MarshalJSON() ([]byte, error) {
 	}
 	// Reconstruct the JSON payload with the absolute path
 	type payload struct {
-		RepoPath string    `json:"repo_path"`
-		Issue    IssueData `json:"issue"`
-		Mode     string    `json:"mode"`
+		RepoPath   string              `json:"repo_path"`
+		Issue      IssueData           `json:"issue"`
+		Mode       string              `json:"mode"`
+		Generation *GenerationSettings `json:"generation,omitempty"`
 	}
 	return json.Marshal(payload{
-		RepoPath: abs,
-		Issue:    p.Issue,
-		Mode:     p.Mode,
+		RepoPath:   abs,
+		Issue:      p.Issue,
+		Mode:       p.Mode,
+		Generation: p.Generation,
 	})
 }
 
@@ -54,30 +105,65 @@ type PythonAgentResult struct {
 	Summary      string   `json:"summary"`
 	PRBodyFile   string   `json:"pr_body_file"`
 	ErrorMessage string   `json:"error_message"`
+	Model        string   `json:"model,omitempty"` // the model that produced the changes, when known
+	// PlanConfidence is the agent's confidence, from 0 to 1, that it understood the issue and
+	// chose the right files; Confidence that its changes resolve the issue. Nil when unreported.
+	PlanConfidence *float64 `json:"plan_confidence,omitempty"`
+	Confidence     *float64 `json:"confidence,omitempty"`
+	// Operations are the files the agent deleted or renamed; ChangesMade lists their paths too,
+	// both the old and new ones of a rename
+	Operations []FileOperation `json:"file_operations,omitempty"`
 }
 
+// FileOperation is a deletion or rename among an agent's changes; its other changed files are
+// written in place
+type FileOperation struct {
+	Op   string `json:"op"`             // FileOpDelete or FileOpRename
+	Path string `json:"path"`           // the deleted file, or a renamed file's new path
+	From string `json:"from,omitempty"` // a renamed file's old path
+}
+
+// Kinds of FileOperation
+const (
+	FileOpDelete = "delete"
+	FileOpRename = "rename"
+)
+
 // AgentServerConfig holds the configuration for the agent server
 type AgentServerConfig struct {
 	BaseURL string
 	Timeout time.Duration
 }
 
-// DefaultAgentServerConfig returns the default configuration
+// DefaultAgentServerConfig returns the default configuration. The timeout follows the
+// configured LLM stage limit.
 func DefaultAgentServerConfig() AgentServerConfig {
 	return AgentServerConfig{
 		BaseURL: "http://localhost:8094",
-		Timeout: 5 * time.Minute,
+		Timeout: time.Duration(appconfig.GetConfig().Timeouts.LLMSeconds) * time.Second,
+	}
+}
+
+// Agent resolves an issue in a checkout, leaving its changes in the working tree
+type Agent func(ctx context.Context, repoPath string, issue *github.Issue, issueCtx IssueContext) (*PythonAgentResult, error)
+
+// ResolveIssue resolves an issue with the configured agent engine: the in-process loop when
+// agent.engine is native, the Python Strands server otherwise
+func ResolveIssue(ctx context.Context, repoPath string, issue *github.Issue, issueCtx IssueContext) (*PythonAgentResult, error) {
+	if appconfig.GetConfig().Agent.Engine == "native" {
+		return ResolveIssueNative(ctx, repoPath, issue, issueCtx)
 	}
+	return CallPythonStrandsAgent(ctx, repoPath, issue, issueCtx)
 }
 
 // CallPythonStrandsAgent calls the agent server via HTTP API
-func CallPythonStrandsAgent(repoPath string, issue *github.Issue) (*PythonAgentResult, error) {
+func CallPythonStrandsAgent(ctx context.Context, repoPath string, issue *github.Issue, issueCtx IssueContext) (*PythonAgentResult, error) {
 	config := DefaultAgentServerConfig()
-	return CallPythonStrandsAgentWithConfig(repoPath, issue, config)
+	return CallPythonStrandsAgentWithConfig(ctx, repoPath, issue, issueCtx, config)
 }
 
 // CallPythonStrandsAgentWithConfig calls the agent server with custom configuration
-func CallPythonStrandsAgentWithConfig(repoPath string, issue *github.Issue, config AgentServerConfig) (*PythonAgentResult, error) {
+func CallPythonStrandsAgentWithConfig(ctx context.Context, repoPath string, issue *github.Issue, issueCtx IssueContext, config AgentServerConfig) (*PythonAgentResult, error) {
 	// Prepare issue data
 	labels := make([]string, 0)
 	for _, label := range issue.Labels {
@@ -86,17 +172,40 @@ func CallPythonStrandsAgentWithConfig(repoPath string, issue *github.Issue, conf
 		}
 	}
 
+	// The server loads the repository analysis itself, so it is not part of the budget here
+	built := buildIssueContext(issue, issueCtx, "")
 	issueData := IssueData{
-		Title:  issue.GetTitle(),
-		Body:   issue.GetBody(),
-		Labels: labels,
+		Title:            issue.GetTitle(),
+		Body:             built.Get(blockIssue),
+		Labels:           labels,
+		LinkedContext:    built.Get(blockLinked),
+		OwnershipContext: built.Get(blockOwnership),
+		CodeContext:      built.Get(blockCode),
+		FileSummaries:    built.Get(blockSummaries),
+		InfraContext:     built.Get(blockInfra),
+		APIContext:       built.Get(blockAPI),
+		ImpactContext:    built.Get(blockImpact),
+
+		FileSelectionInstructions:  slotInstructions(issueCtx.PromptVariants, appconfig.SlotFileSelection),
+		CodeGenerationInstructions: slotInstructions(issueCtx.PromptVariants, appconfig.SlotCodeGeneration),
+	}
+	if ranking := built.Get(blockCandidates); ranking != "" {
+		issueData.CandidateFiles = admittedCandidates(issueCtx, ranking)
+		if len(issueCtx.Candidates) > 0 {
+			issueData.CandidateRanking = ranking
+		}
 	}
 
 	// Prepare request
+	mode := issueCtx.Mode
+	if mode == "" {
+		mode = "automate" // Default mode, server will auto-detect from labels
+	}
 	request := ProcessIssueRequest{
-		RepoPath: repoPath,
-		Issue:    issueData,
-		Mode:     "automate", // Default mode, server will auto-detect from labels
+		RepoPath:   repoPath,
+		Issue:      issueData,
+		Mode:       mode,
+		Generation: issueCtx.Generation,
 	}
 
 	requestBody, err := json.Marshal(request)
@@ -104,52 +213,59 @@ func CallPythonStrandsAgentWithConfig(repoPath string, issue *github.Issue, conf
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	slog.Info("Calling Python agent server",
+	slog.InfoContext(ctx, "Calling Python agent server",
 		"url", config.BaseURL,
 		"repoPath", repoPath,
 		"issueTitle", issue.GetTitle(),
-		"labels", labels)
+		"labels", labels,
+		"linkedContextLength", len(issueCtx.LinkedContext),
+		"candidateFiles", issueCtx.CandidateFiles)
 
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: config.Timeout,
+	// Bound the call with a deadline (rather than http.Client.Timeout) so callers can
+	// recognize context.DeadlineExceeded and salvage partial results
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
 	}
+	client := &http.Client{}
 
 	// Make request to agent server
-	resp, err := client.Post(
-		config.BaseURL+"/api/process",
-		"application/json",
-		bytes.NewBuffer(requestBody),
-	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.BaseURL+"/api/process", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build agent request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call agent server: %w", err)
+		return nil, &LLMError{Op: "agent", Err: fmt.Errorf("failed to call agent server: %w", err)}
 	}
 	defer resp.Body.Close()
 
 	// Read response body
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, &LLMError{Op: "agent", Err: fmt.Errorf("failed to read response: %w", err)}
 	}
 
-	slog.Info("Agent server response received",
+	slog.InfoContext(ctx, "Agent server response received",
 		"statusCode", resp.StatusCode,
 		"contentLength", len(responseBody))
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("agent server returned error status %d: %s",
-			resp.StatusCode, string(responseBody))
+		return nil, &LLMError{Op: "agent", Err: fmt.Errorf("agent server returned error status %d: %s",
+			resp.StatusCode, string(responseBody))}
 	}
 
 	// Parse response
 	result := &PythonAgentResult{}
 	if err := json.Unmarshal(responseBody, result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w\nBody: %s",
-			err, string(responseBody))
+		return nil, &LLMError{Op: "agent", Err: fmt.Errorf("failed to parse response: %w\nBody: %s",
+			err, string(responseBody))}
 	}
 
-	slog.Info("Agent execution completed",
+	slog.InfoContext(ctx, "Agent execution completed",
 		"success", result.Success,
 		"filesChanged", len(result.ChangesMade),
 		"hasPRBody", result.PRBodyFile != "")
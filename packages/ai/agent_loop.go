@@ -0,0 +1,275 @@
+package ai
+
+import (
+	"context"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/prompts"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"google.golang.org/genai"
+)
+
+// AgentBudget bounds an agent loop by number of model turns and wall-clock time
+type AgentBudget struct {
+	MaxSteps int
+	Timeout  time.Duration
+	// Generation overrides the global temperature and output token limit; nil keeps them
+	Generation *GenerationSettings
+}
+
+// AgentLoopResult is the outcome of an agent loop run
+type AgentLoopResult struct {
+	FinalText string
+	Steps     int
+	ToolCalls []string
+	Model     string // the model that finished the loop, which may be a fallback
+}
+
+// ErrAgentBudgetExceeded is returned when the loop runs out of steps before the model finishes
+var ErrAgentBudgetExceeded = errors.New("agent step budget exceeded")
+
+// RunAgentLoop drives a multi-turn conversation in which the model may call tools until it
+// answers without requesting any more calls, or the budget is exhausted. knowledgeBase is
+// added to the system prompt when it can be served from a context cache, and left out
+// otherwise, since every step would resend it.
+func RunAgentLoop(ctx context.Context, systemPrompt, task, knowledgeBase string, tools []AgentTool, budget AgentBudget) (*AgentLoopResult, error) {
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("GEMINI_API_KEY not set in environment")
+	}
+
+	if budget.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget.Timeout)
+		defer cancel()
+	}
+
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  apiKey,
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create Gemini client", "error", err)
+		return nil, err
+	}
+
+	cfg := config.GetConfig()
+	temperature, maxTokens := cfg.AI.Temperature, cfg.AI.MaxOutputTokens
+	if budget.Generation != nil {
+		temperature, maxTokens = budget.Generation.Temperature, budget.Generation.MaxOutputTokens
+	}
+	declarations := make([]*genai.FunctionDeclaration, len(tools))
+	handlers := make(map[string]AgentTool, len(tools))
+	for i, t := range tools {
+		declarations[i] = t.Declaration
+		handlers[t.Declaration.Name] = t
+	}
+
+	chatConfig := &genai.GenerateContentConfig{
+		SystemInstruction: genai.NewContentFromText(systemPrompt, genai.RoleUser),
+		Temperature:       &temperature,
+		MaxOutputTokens:   maxTokens,
+		Tools:             []*genai.Tool{{FunctionDeclarations: declarations}},
+		SafetySettings:    safetySettings(cfg),
+	}
+
+	// Tool calling needs Gemini, so Claude and OpenAI-compatible fallbacks sit this loop out
+	var models []string
+	for _, m := range modelChain(cfg) {
+		if isGeminiModel(cfg, m) {
+			models = append(models, m)
+		}
+	}
+	if len(models) == 0 {
+		return nil, fmt.Errorf("no Gemini model configured for the agent loop")
+	}
+	configFor := func(model string) *genai.GenerateContentConfig {
+		if knowledgeBase == "" {
+			return chatConfig
+		}
+		name := cachedContent(ctx, client, model, systemPrompt+"\n\n"+knowledgeBase, chatConfig.Tools)
+		if name == "" {
+			return chatConfig
+		}
+		// A cached request carries neither system instruction nor tools: the cache holds them
+		cached := *chatConfig
+		cached.CachedContent, cached.SystemInstruction, cached.Tools = name, nil, nil
+		return &cached
+	}
+	chat, err := client.Chats.Create(ctx, models[0], configFor(models[0]), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start agent chat: %w", err)
+	}
+
+	result := &AgentLoopResult{Model: models[0]}
+	var cachedTokens int32
+	parts := []*genai.Part{genai.NewPartFromText(task)}
+	for result.Steps < budget.MaxSteps {
+		result.Steps++
+
+		resp, err := chat.Send(ctx, parts...)
+		for (err != nil || len(resp.Candidates) == 0 || safetyBlock(models[0], resp) != nil) && ctx.Err() == nil && len(models) > 1 {
+			// Carry the conversation so far over to the next model and resend the step
+			slog.WarnContext(ctx, "Agent step failed, falling back to next model", "step", result.Steps, "model", models[0], "next", models[1], "error", err)
+			models = models[1:]
+			if chat, err = client.Chats.Create(ctx, models[0], configFor(models[0]), chat.History(true)); err != nil {
+				return result, fmt.Errorf("failed to restart agent chat on %s: %w", models[0], err)
+			}
+			result.Model = models[0]
+			resp, err = chat.Send(ctx, parts...)
+		}
+		if err != nil {
+			return result, fmt.Errorf("agent step %d failed: %w", result.Steps, err)
+		}
+		if blocked := safetyBlock(result.Model, resp); blocked != nil {
+			return result, fmt.Errorf("agent step %d failed: %w", result.Steps, blocked)
+		}
+
+		if resp.UsageMetadata != nil {
+			cachedTokens += resp.UsageMetadata.CachedContentTokenCount
+		}
+
+		calls := resp.FunctionCalls()
+		if len(calls) == 0 {
+			result.FinalText = resp.Text()
+			slog.InfoContext(ctx, "Agent loop finished", "steps", result.Steps, "toolCalls", len(result.ToolCalls), "model", result.Model, "cachedTokens", cachedTokens)
+			return result, nil
+		}
+
+		// A fresh slice: the chat keeps the previous one in its history
+		parts = make([]*genai.Part, 0, len(calls))
+		for _, call := range calls {
+			result.ToolCalls = append(result.ToolCalls, call.Name)
+			slog.InfoContext(ctx, "Agent tool call", "step", result.Steps, "tool", call.Name)
+
+			response := map[string]any{}
+			tool, ok := handlers[call.Name]
+			if !ok {
+				response["error"] = fmt.Sprintf("unknown tool %q", call.Name)
+			} else if out, err := tool.Handler(ctx, call.Args); err != nil {
+				response["error"] = err.Error()
+			} else {
+				response["output"] = out
+			}
+
+			part := genai.NewPartFromFunctionResponse(call.Name, response)
+			part.FunctionResponse.ID = call.ID
+			parts = append(parts, part)
+		}
+	}
+
+	return result, ErrAgentBudgetExceeded
+}
+
+// ResolveIssueNative resolves an issue with the in-process agent loop instead of the
+// Python Strands server. Changed files are taken from git status.
+func ResolveIssueNative(ctx context.Context, repoPath string, issue *github.Issue, issueCtx IssueContext) (*PythonAgentResult, error) {
+	cfg := config.GetConfig()
+
+	labels := make([]string, 0)
+	for _, label := range issue.Labels {
+		if label.Name != nil {
+			labels = append(labels, *label.Name)
+		}
+	}
+
+	var analysis string
+	if len(issueCtx.CandidateFiles) > 0 {
+		analysisFile := cfg.GetDevflowPath(repoPath, cfg.Files.AnalysisFile)
+		indexFile := cfg.GetDevflowPath(repoPath, cfg.Files.AnalysisIndexFile)
+		if sections, err := LoadAnalysisSections(analysisFile, indexFile, issueCtx.CandidateFiles); err != nil {
+			slog.WarnContext(ctx, "Failed to load analysis sections", "error", err)
+		} else {
+			analysis = sections
+		}
+	}
+	built := buildIssueContext(issue, issueCtx, analysis)
+
+	var task strings.Builder
+	task.WriteString(fmt.Sprintf("Resolve this GitHub issue.\n\nTitle: %s\n\nBody:\n%s\n\nLabels: %s\n\n",
+		issue.GetTitle(), built.Get(blockIssue), strings.Join(labels, ", ")))
+	for _, block := range built.Blocks {
+		if block.Name != blockIssue {
+			task.WriteString(block.Content + "\n\n")
+		}
+	}
+	if instructions := slotInstructions(issueCtx.PromptVariants, config.SlotFileSelection); instructions != "" {
+		task.WriteString("When choosing which files to read and change: " + instructions + "\n")
+	}
+
+	budget := AgentBudget{
+		MaxSteps:   cfg.Agent.MaxSteps,
+		Timeout:    time.Duration(cfg.Agent.TimeoutSeconds) * time.Second,
+		Generation: issueCtx.Generation,
+	}
+	promptName := prompts.AgentSystem
+	if issueCtx.Mode == "docs" {
+		promptName = prompts.DocsAgentSystem
+	}
+	systemPrompt, err := prompts.Render(promptName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if instructions := slotInstructions(issueCtx.PromptVariants, config.SlotCodeGeneration); instructions != "" {
+		systemPrompt += "\n" + instructions
+	}
+	loop, err := RunAgentLoop(ctx, systemPrompt, task.String(), LoadKnowledgeBaseContext(repoPath), NewRepoTools(repoPath, cfg.Agent.TestCommand), budget)
+	if err != nil && !errors.Is(err, ErrAgentBudgetExceeded) && !errors.Is(err, context.DeadlineExceeded) {
+		return nil, &LLMError{Op: "agent", Err: err}
+	}
+
+	changed, gitErr := gitChangedFiles(repoPath)
+	if gitErr != nil {
+		return nil, gitErr
+	}
+
+	summary, planConfidence, confidence := extractConfidence(loop.FinalText)
+	result := &PythonAgentResult{
+		Completed:      err == nil,
+		Success:        len(changed) > 0,
+		ChangesMade:    changed,
+		Summary:        summary,
+		Model:          loop.Model,
+		PlanConfidence: planConfidence,
+		Confidence:     confidence,
+	}
+	if err != nil {
+		result.ErrorMessage = err.Error()
+	}
+	if result.Summary == "" && len(changed) > 0 {
+		result.Summary = "Applied code changes."
+	}
+	return result, nil
+}
+
+// gitChangedFiles lists repository-relative paths reported by git status; a rename lists
+// both its old and new path.
+func gitChangedFiles(repoPath string) ([]string, error) {
+	cmd := exec.Command("git", "status", "--porcelain", "--untracked-files=all")
+	cmd.Dir = repoPath
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status failed: %w", err)
+	}
+
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		path := strings.TrimSpace(line[3:])
+		if from, to, ok := strings.Cut(path, " -> "); ok {
+			files = append(files, from)
+			path = to
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
@@ -0,0 +1,404 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"devflow-agent/packages/callgraph"
+	"devflow-agent/packages/config"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/genai"
+)
+
+const (
+	maxToolOutputChars = 20000
+	maxGrepMatches     = 200
+	maxListEntries     = 500
+)
+
+// AgentTool is a function exposed to the model during the agent loop
+type AgentTool struct {
+	Declaration *genai.FunctionDeclaration
+	Handler     func(ctx context.Context, args map[string]any) (string, error)
+}
+
+// NewRepoTools returns the read_file, grep, list_dir, find_callers, run_tests, apply_patch,
+// delete_file and rename_file tools, all confined to repoPath.
+func NewRepoTools(repoPath, testCommand string) []AgentTool {
+	rt := &repoTools{root: repoPath, testCommand: testCommand}
+	return []AgentTool{
+		{
+			Declaration: &genai.FunctionDeclaration{
+				Name:        "read_file",
+				Description: "Read a file from the repository. Returns the content with line numbers.",
+				Parameters: objectSchema(map[string]*genai.Schema{
+					"path": {Type: genai.TypeString, Description: "Repository-relative file path"},
+				}, "path"),
+			},
+			Handler: rt.readFile,
+		},
+		{
+			Declaration: &genai.FunctionDeclaration{
+				Name:        "grep",
+				Description: "Search repository files for a regular expression. Returns path:line: text matches.",
+				Parameters: objectSchema(map[string]*genai.Schema{
+					"pattern": {Type: genai.TypeString, Description: "RE2 regular expression"},
+					"path":    {Type: genai.TypeString, Description: "Optional repository-relative directory to search"},
+				}, "pattern"),
+			},
+			Handler: rt.grep,
+		},
+		{
+			Declaration: &genai.FunctionDeclaration{
+				Name:        "list_dir",
+				Description: "List files and directories under a repository-relative directory.",
+				Parameters: objectSchema(map[string]*genai.Schema{
+					"path": {Type: genai.TypeString, Description: "Repository-relative directory, '.' for the root"},
+				}),
+			},
+			Handler: rt.listDir,
+		},
+		{
+			Declaration: &genai.FunctionDeclaration{
+				Name:        "find_callers",
+				Description: "List the functions that call a function, directly or through other calls, from the knowledge base's Go and TypeScript call graph. Use it before changing a function's signature or behavior.",
+				Parameters: objectSchema(map[string]*genai.Schema{
+					"function": {Type: genai.TypeString, Description: "Function name, e.g. ParseConfig, Client.Do, or a full ID"},
+					"depth":    {Type: genai.TypeInteger, Description: "Call levels to follow, 1 to 3 (default 1)"},
+				}, "function"),
+			},
+			Handler: rt.findCallers,
+		},
+		{
+			Declaration: &genai.FunctionDeclaration{
+				Name:        "run_tests",
+				Description: "Run the repository's configured test command and return its output.",
+				Parameters:  objectSchema(map[string]*genai.Schema{}),
+			},
+			Handler: rt.runTests,
+		},
+		{
+			Declaration: &genai.FunctionDeclaration{
+				Name:        "apply_patch",
+				Description: "Apply a unified diff (git format, POSIX paths) to the working tree. Only changed lines plus context; never whole-file rewrites.",
+				Parameters: objectSchema(map[string]*genai.Schema{
+					"patch": {Type: genai.TypeString, Description: "Unified diff text"},
+				}, "patch"),
+			},
+			Handler: rt.applyPatch,
+		},
+		{
+			Declaration: &genai.FunctionDeclaration{
+				Name:        "delete_file",
+				Description: "Delete an obsolete file from the working tree. Use it instead of emptying the file.",
+				Parameters: objectSchema(map[string]*genai.Schema{
+					"path": {Type: genai.TypeString, Description: "Repository-relative file path"},
+				}, "path"),
+			},
+			Handler: rt.deleteFile,
+		},
+		{
+			Declaration: &genai.FunctionDeclaration{
+				Name:        "rename_file",
+				Description: "Move a file to a new path, creating its directory. Patch its content afterwards at the new path.",
+				Parameters: objectSchema(map[string]*genai.Schema{
+					"from": {Type: genai.TypeString, Description: "Repository-relative path of the file"},
+					"to":   {Type: genai.TypeString, Description: "Repository-relative path to move it to"},
+				}, "from", "to"),
+			},
+			Handler: rt.renameFile,
+		},
+	}
+}
+
+func objectSchema(props map[string]*genai.Schema, required ...string) *genai.Schema {
+	return &genai.Schema{Type: genai.TypeObject, Properties: props, Required: required}
+}
+
+type repoTools struct {
+	root        string
+	testCommand string
+}
+
+// resolve maps a repository-relative path to an absolute path, refusing escapes, including
+// those through symlinks committed in the repository (e.g. docs -> /).
+func (rt *repoTools) resolve(rel string) (string, error) {
+	if rel == "" {
+		rel = "."
+	}
+	abs := filepath.Join(rt.root, filepath.FromSlash(rel))
+	if !isWithin(rt.root, abs) || !rt.linksWithin(abs) {
+		return "", fmt.Errorf("path %q is outside the repository", rel)
+	}
+	return abs, nil
+}
+
+// resolveEntry is resolve for tools acting on a directory entry itself, such as deleting or
+// moving a symlink: only the directories leading to it must stay in the repository
+func (rt *repoTools) resolveEntry(rel string) (string, error) {
+	dir, err := rt.resolve(path.Dir(filepath.ToSlash(rel)))
+	abs := filepath.Join(dir, filepath.Base(rel))
+	if err != nil || !isWithin(rt.root, abs) || abs == filepath.Clean(rt.root) {
+		return "", fmt.Errorf("path %q is outside the repository", rel)
+	}
+	return abs, nil
+}
+
+// linksWithin reports whether abs, with its symlinks followed, is still in the repository. A
+// path that does not exist yet is judged by its deepest existing directory.
+func (rt *repoTools) linksWithin(abs string) bool {
+	root, err := filepath.EvalSymlinks(rt.root)
+	if err != nil {
+		return false
+	}
+	existing, rest := abs, ""
+	for {
+		real, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return isWithin(root, filepath.Join(real, rest))
+		}
+		if !os.IsNotExist(err) {
+			return false
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return false
+		}
+		existing, rest = parent, filepath.Join(filepath.Base(existing), rest)
+	}
+}
+
+// isWithin reports whether abs is root or below it, lexically
+func isWithin(root, abs string) bool {
+	rel, err := filepath.Rel(root, abs)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (rt *repoTools) readFile(ctx context.Context, args map[string]any) (string, error) {
+	path, err := rt.resolve(stringArg(args, "path"))
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i, line := range strings.Split(string(data), "\n") {
+		b.WriteString(fmt.Sprintf("%5d: %s\n", i+1, line))
+	}
+	return capOutput(b.String()), nil
+}
+
+func (rt *repoTools) grep(ctx context.Context, args map[string]any) (string, error) {
+	re, err := regexp.Compile(stringArg(args, "pattern"))
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %w", err)
+	}
+	dir, err := rt.resolve(stringArg(args, "path"))
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	walkErr := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if skipToolDir(d.Name()) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 && !rt.linksWithin(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || bytes.IndexByte(data, 0) >= 0 {
+			return nil
+		}
+		rel, _ := filepath.Rel(rt.root, path)
+		for i, line := range strings.Split(string(data), "\n") {
+			if re.MatchString(line) {
+				matches = append(matches, fmt.Sprintf("%s:%d: %s", filepath.ToSlash(rel), i+1, strings.TrimSpace(line)))
+				if len(matches) >= maxGrepMatches {
+					return fs.SkipAll
+				}
+			}
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return "", walkErr
+	}
+	if len(matches) == 0 {
+		return "no matches", nil
+	}
+	return capOutput(strings.Join(matches, "\n")), nil
+}
+
+func (rt *repoTools) listDir(ctx context.Context, args map[string]any) (string, error) {
+	dir, err := rt.resolve(stringArg(args, "path"))
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			if skipToolDir(e.Name()) {
+				continue
+			}
+			names = append(names, e.Name()+"/")
+		} else {
+			names = append(names, e.Name())
+		}
+		if len(names) >= maxListEntries {
+			break
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, "\n"), nil
+}
+
+func (rt *repoTools) findCallers(ctx context.Context, args map[string]any) (string, error) {
+	cfg := config.GetConfig()
+	graph, err := callgraph.Load(cfg.GetDevflowPath(rt.root, cfg.Files.CallGraphFile))
+	if err != nil {
+		return "no call graph in the knowledge base; use grep to find callers", nil
+	}
+	depth := 1
+	if d, ok := args["depth"].(float64); ok {
+		depth = min(max(int(d), 1), 3)
+	}
+	name := stringArg(args, "function")
+	matches := graph.Find(name)
+	if len(matches) == 0 {
+		return fmt.Sprintf("no function %q in the call graph", name), nil
+	}
+	var b strings.Builder
+	for _, fn := range matches {
+		fmt.Fprintf(&b, "%s (%s:%d) %s\n", fn.ID, fn.File, fn.Line, fn.Signature)
+		callers := graph.Callers(fn.ID, depth)
+		if len(callers) == 0 {
+			b.WriteString("  no callers\n")
+		}
+		for _, c := range callers {
+			fmt.Fprintf(&b, "  %s%s (%s:%d)\n", strings.Repeat("  ", c.Depth-1), c.ID, c.File, c.Line)
+		}
+	}
+	return capOutput(b.String()), nil
+}
+
+func (rt *repoTools) runTests(ctx context.Context, args map[string]any) (string, error) {
+	if rt.testCommand == "" {
+		return "no test command configured for this repository", nil
+	}
+	ctx, cancel := config.StageContext(ctx, config.GetConfig().Timeouts.TestsSeconds)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", rt.testCommand)
+	cmd.Dir = rt.root
+	out, err := cmd.CombinedOutput()
+	status := "PASSED"
+	if err != nil {
+		status = fmt.Sprintf("FAILED (%v)", err)
+	}
+	return capOutput(fmt.Sprintf("%s\n%s", status, string(out))), nil
+}
+
+func (rt *repoTools) applyPatch(ctx context.Context, args map[string]any) (string, error) {
+	patch := strings.ReplaceAll(stringArg(args, "patch"), "\r\n", "\n")
+	if strings.TrimSpace(patch) == "" {
+		return "", fmt.Errorf("empty patch")
+	}
+	if !strings.HasSuffix(patch, "\n") {
+		patch += "\n"
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "apply", "--recount", "--ignore-whitespace", "--whitespace=nowarn", "-")
+	cmd.Dir = rt.root
+	cmd.Stdin = strings.NewReader(patch)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("patch did not apply: %s", strings.TrimSpace(string(out)))
+	}
+	return "OK: patch applied", nil
+}
+
+func (rt *repoTools) deleteFile(ctx context.Context, args map[string]any) (string, error) {
+	path, err := rt.resolveEntry(stringArg(args, "path"))
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Lstat(path); err != nil {
+		return "", err
+	} else if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", stringArg(args, "path"))
+	}
+	if err := os.Remove(path); err != nil {
+		return "", err
+	}
+	return "OK: deleted " + stringArg(args, "path"), nil
+}
+
+func (rt *repoTools) renameFile(ctx context.Context, args map[string]any) (string, error) {
+	from, err := rt.resolveEntry(stringArg(args, "from"))
+	if err != nil {
+		return "", err
+	}
+	to, err := rt.resolve(stringArg(args, "to"))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return "", fmt.Errorf("%s already exists", stringArg(args, "to"))
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(from, to); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("OK: renamed %s to %s", stringArg(args, "from"), stringArg(args, "to")), nil
+}
+
+func skipToolDir(name string) bool {
+	switch name {
+	case ".git", "node_modules", ".devflow", "vendor", "__pycache__", ".venv", "dist", "build":
+		return true
+	}
+	return false
+}
+
+func stringArg(args map[string]any, key string) string {
+	if v, ok := args[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// capOutput cuts tool output to maxToolOutputChars bytes at a rune boundary
+func capOutput(s string) string {
+	if len(s) <= maxToolOutputChars {
+		return s
+	}
+	cut := maxToolOutputChars
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "\n... [output truncated]"
+}
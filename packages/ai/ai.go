@@ -3,6 +3,7 @@ package ai
 import (
 	"context"
 	"devflow-agent/packages/config"
+	"devflow-agent/packages/prompts"
 	"fmt"
 	"log/slog"
 	"os"
@@ -19,6 +20,7 @@ type IssueAnalysis struct {
 
 type AnalysisResult struct {
 	MarkdownContent string
+	Model           string // the model that produced the content, which may be a fallback
 	Error           error
 }
 
@@ -67,39 +69,33 @@ type ClassInfo struct {
 	LineNumber int
 }
 
-func AnalyzeIssueWithAI(analysis *IssueAnalysis) (*AnalysisResult, error) {
-	// Get API key from environment
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("GEMINI_API_KEY not set in environment")
-	}
-
-	ctx := context.Background()
-
-	// Create client using new SDK
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  apiKey,
-		Backend: genai.BackendGeminiAPI,
-	})
-	if err != nil {
-		slog.Error("Failed to create Gemini client", "error", err)
-		return nil, err
-	}
-
+func AnalyzeIssueWithAI(ctx context.Context, analysis *IssueAnalysis) (*AnalysisResult, error) {
 	// Use configured model
 	cfg := config.GetConfig()
 
 	// Read repository structure file
 	repoContent, err := os.ReadFile(analysis.RepoStructFile)
 	if err != nil {
-		slog.Error("Failed to read repo structure file", "error", err)
+		slog.ErrorContext(ctx, "Failed to read repo structure file", "error", err)
 		return nil, err
 	}
 
-	// Build the prompt
-	prompt := buildAnalysisPrompt(analysis, string(repoContent))
+	// Build the prompt; the repository content gives way to the issue when over budget
+	built := NewContextBuilder(cfg.AI.Model, cfg.AI.ContextTokens).
+		Add(ContextBlock{Name: blockIssue, Priority: PriorityIssue, Content: analysis.IssueDescription, Trimmable: true}).
+		Add(ContextBlock{Name: blockCode, Priority: PriorityCode, Content: string(repoContent), Trimmable: true}).
+		Build()
+	prompt, err := prompts.Render(prompts.IssueAnalysis, prompts.Vars{
+		"IssueTitle":       analysis.IssueTitle,
+		"IssueDescription": built.Get(blockIssue),
+		"Labels":           analysis.Labels,
+		"RepoContent":      built.Get(blockCode),
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	slog.Info("Sending request to Gemini API", "issueTitle", analysis.IssueTitle)
+	slog.InfoContext(ctx, "Sending issue analysis request", "model", cfg.AI.Model, "issueTitle", analysis.IssueTitle)
 
 	// Create generation config - use float64 and int types
 	temperature := float32(cfg.AI.Temperature)
@@ -114,104 +110,34 @@ func AnalyzeIssueWithAI(analysis *IssueAnalysis) (*AnalysisResult, error) {
 		MaxOutputTokens: maxTokens,
 	}
 
-	// Generate content
-	result, err := client.Models.GenerateContent(
-		ctx,
-		cfg.AI.Model,
-		genai.Text(prompt),
-		genConfig,
-	)
+	// Generate content, falling back to the next model on failure
+	markdownContent, model, err := generateContent(ctx, "issue-analysis", prompt, genConfig)
 	if err != nil {
-		slog.Error("Failed to generate content", "error", err)
+		slog.ErrorContext(ctx, "Failed to generate content", "error", err)
 		return nil, err
 	}
 
-	// Extract response text
-	if result == nil || result.Text() == "" {
-		return nil, fmt.Errorf("no content generated")
-	}
-
-	markdownContent := result.Text()
-
-	slog.Info("Successfully generated analysis", "contentLength", len(markdownContent))
+	slog.InfoContext(ctx, "Successfully generated analysis", "contentLength", len(markdownContent), "model", model)
 
 	return &AnalysisResult{
 		MarkdownContent: markdownContent,
+		Model:           model,
 		Error:           nil,
 	}, nil
 }
 
-func buildAnalysisPrompt(analysis *IssueAnalysis, repoContent string) string {
-	labelsStr := ""
-	for _, label := range analysis.Labels {
-		labelsStr += fmt.Sprintf("- %s\n", label)
-	}
-
-	prompt := fmt.Sprintf(`You are an expert code analyst. Analyze the following GitHub issue and repository structure to provide detailed insights.
-
-# Issue Information
-**Title:** %s
-
-**Description:**
-%s
-
-**Labels:**
-%s
-
-# Repository Structure and Code
-%s
-
-# Your Task
-Provide a comprehensive analysis in markdown format that includes:
-
-1. **Issue Summary**: Brief overview of what the issue is requesting
-2. **Root Cause Analysis**: If it's a bug, identify potential root causes based on the codebase
-3. **Affected Components**: List all files/modules that are likely affected
-4. **Implementation Approach**: For new features or fixes, suggest implementation strategy
-5. **Code Locations**: Highlight specific files and approximate line ranges where changes are needed
-6. **Potential Risks**: Identify any side effects or related areas that might break
-7. **Testing Recommendations**: Suggest what should be tested
-8. **Additional Notes**: Any other relevant observations
-
-Be specific with file paths and code references. Use the repository structure provided to give accurate locations.
-
-Format your response in clean markdown with appropriate headers and code blocks.`,
-		analysis.IssueTitle,
-		analysis.IssueDescription,
-		labelsStr,
-		repoContent,
-	)
-
-	return prompt
-}
-
 // AnalyzeRepositoryWithAI generates comprehensive analysis of repository files
-func AnalyzeRepositoryWithAI(analysis *RepoAnalysis) (*AnalysisResult, error) {
-	// Get API key from environment
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("GEMINI_API_KEY not set in environment")
-	}
-
-	ctx := context.Background()
-
-	// Create client using new SDK
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  apiKey,
-		Backend: genai.BackendGeminiAPI,
-	})
-	if err != nil {
-		slog.Error("Failed to create Gemini client", "error", err)
-		return nil, err
-	}
-
+func AnalyzeRepositoryWithAI(ctx context.Context, analysis *RepoAnalysis) (*AnalysisResult, error) {
 	// Use configured model
 	cfg := config.GetConfig()
 
 	// Build the prompt
-	prompt := BuildRepoAnalysisPrompt(analysis)
+	prompt, err := BuildRepoAnalysisPrompt(analysis)
+	if err != nil {
+		return nil, err
+	}
 
-	slog.Info("Sending repository analysis request to Gemini API", "repoURL", analysis.RepoURL, "fileCount", len(analysis.Files))
+	slog.InfoContext(ctx, "Sending repository analysis request", "model", cfg.AI.Model, "repoURL", analysis.RepoURL, "fileCount", len(analysis.Files))
 
 	// Create generation config with lower temperature for more consistent analysis
 	temperature := float32(cfg.AI.RepoAnalysisTemperature)
@@ -226,34 +152,24 @@ func AnalyzeRepositoryWithAI(analysis *RepoAnalysis) (*AnalysisResult, error) {
 		MaxOutputTokens: maxTokens,
 	}
 
-	// Generate content
-	result, err := client.Models.GenerateContent(
-		ctx,
-		cfg.AI.Model,
-		genai.Text(prompt),
-		genConfig,
-	)
+	// Generate content, falling back to the next model on failure
+	markdownContent, model, err := generateContent(ctx, "repo-analysis", prompt, genConfig)
 	if err != nil {
-		slog.Error("Failed to generate repository analysis", "error", err)
+		slog.ErrorContext(ctx, "Failed to generate repository analysis", "error", err)
 		return nil, err
 	}
 
-	// Extract response text
-	if result == nil || result.Text() == "" {
-		return nil, fmt.Errorf("no content generated")
-	}
-
-	markdownContent := result.Text()
-
-	slog.Info("Successfully generated repository analysis", "contentLength", len(markdownContent))
+	slog.InfoContext(ctx, "Successfully generated repository analysis", "contentLength", len(markdownContent), "model", model)
 
 	return &AnalysisResult{
 		MarkdownContent: markdownContent,
+		Model:           model,
 		Error:           nil,
 	}, nil
 }
 
-func BuildRepoAnalysisPrompt(analysis *RepoAnalysis) string {
+// BuildRepoAnalysisPrompt renders the repository analysis prompt for the analyzed files
+func BuildRepoAnalysisPrompt(analysis *RepoAnalysis) (string, error) {
 	// Build file summaries
 	fileSummaries := ""
 	for _, file := range analysis.Files {
@@ -285,116 +201,42 @@ func BuildRepoAnalysisPrompt(analysis *RepoAnalysis) string {
 		fileSummaries += "\n"
 	}
 
-	prompt := fmt.Sprintf(`You are an expert code analyst. Analyze the following repository structure and provide comprehensive insights about each file's purpose and role.
-
-# Repository Information
-**Repository URL:** %s
-**Total Files Analyzed:** %d
-
-# File Analysis Data
-%s
-
-# Your Task
-Provide a comprehensive analysis in markdown format that includes:
-
-## Repository Overview
-1. **Project Type**: What kind of project is this? (web app, CLI tool, library, etc.)
-2. **Architecture**: Describe the overall architecture and structure
-3. **Technology Stack**: Identify the main technologies and frameworks used
-4. **Entry Points**: Identify the main entry points and how the application starts
-
-## File Analysis
-For each file, provide:
-1. **Purpose**: What is this file's primary purpose?
-2. **Role**: How does it fit into the larger system?
-3. **Key Functions/Classes**: Brief description of main functions/classes
-4. **Dependencies**: What other files/modules does it depend on?
-5. **Dependents**: What other files/modules depend on this file?
-
-## System Relationships
-1. **Data Flow**: How does data flow through the system?
-2. **Key Components**: What are the most important components?
-3. **Integration Points**: Where do different parts of the system connect?
-
-## Development Insights
-1. **Code Quality**: Overall assessment of code organization
-2. **Patterns**: What design patterns are used?
-3. **Potential Issues**: Any obvious problems or areas for improvement?
-
-Format your response in clean markdown with appropriate headers and code blocks. Be specific and detailed in your analysis.`,
-		analysis.RepoURL,
-		len(analysis.Files),
-		fileSummaries,
-	)
-
-	return prompt
+	cfg := config.GetConfig()
+	built := NewContextBuilder(cfg.AI.Model, cfg.AI.ContextTokens).
+		Add(ContextBlock{Name: blockSummaries, Priority: PrioritySummaries, Content: fileSummaries, Trimmable: true}).
+		Build()
+	return prompts.Render(prompts.RepoAnalysis, prompts.Vars{
+		"RepoURL":       analysis.RepoURL,
+		"FileCount":     len(analysis.Files),
+		"FileSummaries": built.Get(blockSummaries),
+	})
 }
 
-// AnalyzeRepositoryFromStructure generates comprehensive analysis using repo structure content
-func AnalyzeRepositoryFromStructure(analysis *RepoAnalysisFromStructure) (*AnalysisResult, error) {
-	// Get API key from environment
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("GEMINI_API_KEY not set in environment")
-	}
-
-	ctx := context.Background()
-
-	// Create client using new SDK
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  apiKey,
-		Backend: genai.BackendGeminiAPI,
+// BuildRepoStructurePrompt renders the repository analysis prompt for repo-structure.md,
+// trimmed to the context budget
+func BuildRepoStructurePrompt(repoURL, structureContent string) (string, error) {
+	cfg := config.GetConfig()
+	built := NewContextBuilder(cfg.AI.Model, cfg.AI.ContextTokens).
+		Add(ContextBlock{Name: blockCode, Priority: PriorityCode, Content: structureContent, Trimmable: true}).
+		Build()
+	return prompts.Render(prompts.RepoStructureAnalysis, prompts.Vars{
+		"RepoURL":          repoURL,
+		"StructureContent": built.Get(blockCode),
 	})
-	if err != nil {
-		slog.Error("Failed to create Gemini client", "error", err)
-		return nil, err
-	}
+}
 
+// AnalyzeRepositoryFromStructure generates comprehensive analysis using repo structure content
+func AnalyzeRepositoryFromStructure(ctx context.Context, analysis *RepoAnalysisFromStructure) (*AnalysisResult, error) {
 	// Use configured model
 	cfg := config.GetConfig()
 
 	// Build the prompt using repo structure content
-	prompt := fmt.Sprintf(`You are an expert code analyst. Analyze the following repository and provide comprehensive insights about the codebase.
-
-# Repository Information
-**Repository URL:** %s
-
-# Repository Structure and Code Analysis
-%s
-
-# Your Task
-Provide a comprehensive analysis in markdown format that includes:
-
-## Repository Overview
-1. **Project Type**: What kind of project is this? (web app, CLI tool, library, etc.)
-2. **Architecture**: Describe the overall architecture and structure
-3. **Technology Stack**: Identify the main technologies and frameworks used
-4. **Entry Points**: Identify the main entry points and how the application starts
-
-## File Analysis
-For each important file, provide:
-1. **Purpose**: What is this file's primary purpose?
-2. **Role**: How does it fit into the larger system?
-3. **Key Functions/Classes**: Brief description of main functions/classes and their logic
-4. **Dependencies**: What other files/modules does it depend on?
-5. **Business Logic**: What business rules or logic does it implement?
-
-## System Relationships
-1. **Data Flow**: How does data flow through the system?
-2. **Key Components**: What are the most important components?
-3. **Integration Points**: Where do different parts of the system connect?
-4. **API/Interface Design**: How do components communicate?
-
-## Development Insights
-1. **Code Quality**: Overall assessment of code organization and patterns
-2. **Design Patterns**: What design patterns are used?
-3. **Potential Issues**: Any obvious problems or areas for improvement?
-4. **Scalability**: How well would this scale?
-5. **Maintainability**: How easy would this be to maintain and extend?
-
-Format your response in clean markdown with appropriate headers and code blocks. Be specific and detailed in your analysis, referencing actual code when relevant.`, analysis.RepoURL, analysis.StructureContent)
+	prompt, err := BuildRepoStructurePrompt(analysis.RepoURL, analysis.StructureContent)
+	if err != nil {
+		return nil, err
+	}
 
-	slog.Info("Sending repository analysis request to Gemini API", "repoURL", analysis.RepoURL)
+	slog.InfoContext(ctx, "Sending repository analysis request", "model", cfg.AI.Model, "repoURL", analysis.RepoURL)
 
 	// Create generation config
 	temperature := float32(cfg.AI.RepoAnalysisTemperature)
@@ -408,29 +250,18 @@ Format your response in clean markdown with appropriate headers and code blocks.
 		MaxOutputTokens: maxTokens,
 	}
 
-	// Generate content
-	result, err := client.Models.GenerateContent(
-		ctx,
-		cfg.AI.Model,
-		genai.Text(prompt),
-		genConfig,
-	)
+	// Generate content, falling back to the next model on failure
+	markdownContent, model, err := generateContent(ctx, "repo-analysis", prompt, genConfig)
 	if err != nil {
-		slog.Error("Failed to generate repository analysis", "error", err)
+		slog.ErrorContext(ctx, "Failed to generate repository analysis", "error", err)
 		return nil, err
 	}
 
-	// Extract response text
-	if result == nil || result.Text() == "" {
-		return nil, fmt.Errorf("no content generated")
-	}
-
-	markdownContent := result.Text()
-
-	slog.Info("Successfully generated repository analysis", "contentLength", len(markdownContent))
+	slog.InfoContext(ctx, "Successfully generated repository analysis", "contentLength", len(markdownContent), "model", model)
 
 	return &AnalysisResult{
 		MarkdownContent: markdownContent,
+		Model:           model,
 		Error:           nil,
 	}, nil
 }
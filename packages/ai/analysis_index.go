@@ -0,0 +1,148 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// AnalysisSection is the byte range of one heading-delimited section of repo-analysis.md
+type AnalysisSection struct {
+	Heading string `json:"heading"`
+	Level   int    `json:"level"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+}
+
+// AnalysisIndex maps repository paths to the analysis sections that mention them, so
+// callers can load only the sections relevant to their candidate files
+type AnalysisIndex struct {
+	Sections []AnalysisSection `json:"sections"`
+	Files    map[string][]int  `json:"files"`
+}
+
+var (
+	analysisHeadingRegex = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+	analysisPathRegex    = regexp.MustCompile("[A-Za-z0-9_.\\-/]+\\.[A-Za-z0-9]+")
+)
+
+// BuildAnalysisIndex splits the analysis markdown into sections at every heading (outside
+// fenced code blocks) and records which sections mention which files. isFile decides
+// whether a path-like token is a real repository file.
+func BuildAnalysisIndex(content []byte, isFile func(string) bool) *AnalysisIndex {
+	index := &AnalysisIndex{Files: make(map[string][]int)}
+
+	current := AnalysisSection{Heading: "", Level: 0, Start: 0}
+	inFence := false
+	offset := 0
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		if m := analysisHeadingRegex.FindStringSubmatch(trimmed); m != nil && !inFence {
+			if offset > current.Start {
+				current.End = offset
+				index.Sections = append(index.Sections, current)
+			}
+			current = AnalysisSection{Heading: m[2], Level: len(m[1]), Start: offset}
+		}
+		offset += len(line)
+	}
+	if offset > current.Start {
+		current.End = offset
+		index.Sections = append(index.Sections, current)
+	}
+
+	for i, section := range index.Sections {
+		seen := make(map[string]bool)
+		for _, token := range analysisPathRegex.FindAllString(string(content[section.Start:section.End]), -1) {
+			path := strings.TrimPrefix(strings.TrimRight(token, "."), "./")
+			if path == "" || seen[path] || !isFile(path) {
+				continue
+			}
+			seen[path] = true
+			index.Files[path] = append(index.Files[path], i)
+		}
+	}
+	return index
+}
+
+// WriteAnalysisIndex builds the index for analysisFile against the files in repoPath and
+// writes it as JSON to indexFile
+func WriteAnalysisIndex(repoPath, analysisFile, indexFile string) error {
+	content, err := os.ReadFile(analysisFile)
+	if err != nil {
+		return fmt.Errorf("failed to read analysis file: %w", err)
+	}
+
+	index := BuildAnalysisIndex(content, IsRepoFile(repoPath))
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal analysis index: %w", err)
+	}
+	return os.WriteFile(indexFile, data, 0644)
+}
+
+// LoadAnalysisSections returns the overview section of the analysis plus every section that
+// mentions one of paths, in document order. It returns an empty string when the index is
+// missing or none of the paths are indexed.
+func LoadAnalysisSections(analysisFile, indexFile string, paths []string) (string, error) {
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read analysis index: %w", err)
+	}
+	var index AnalysisIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return "", fmt.Errorf("failed to parse analysis index: %w", err)
+	}
+
+	wanted := make(map[int]bool)
+	for _, p := range paths {
+		for _, i := range index.Files[filepath.ToSlash(p)] {
+			wanted[i] = true
+		}
+	}
+	if len(wanted) == 0 {
+		return "", nil
+	}
+	if len(index.Sections) > 0 {
+		wanted[0] = true
+	}
+
+	content, err := os.ReadFile(analysisFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read analysis file: %w", err)
+	}
+
+	order := make([]int, 0, len(wanted))
+	for i := range wanted {
+		order = append(order, i)
+	}
+	sort.Ints(order)
+
+	var b strings.Builder
+	for _, i := range order {
+		if i >= len(index.Sections) {
+			continue
+		}
+		s := index.Sections[i]
+		if s.Start < 0 || s.End > len(content) || s.Start > s.End {
+			// The analysis was regenerated without refreshing the index
+			return "", fmt.Errorf("analysis index is stale")
+		}
+		b.Write(content[s.Start:s.End])
+		if !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,51 @@
+package ai
+
+import (
+	"context"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/prompts"
+	"log/slog"
+	"strings"
+)
+
+// AnswerRepoQuestion answers a question about a repository from its knowledge base, citing
+// the files it relies on. kb carries the code, summaries, API and infrastructure context
+// gathered for the question; analysis is the repository analysis of the relevant files.
+// isFile checks the cited paths: an answer citing files that do not exist is asked again,
+// with them pointed out, up to cfg.AI.PathValidationRetries times.
+func AnswerRepoQuestion(ctx context.Context, repoName, question string, kb IssueContext, analysis string, isFile func(string) bool) (string, error) {
+	cfg := config.GetConfig()
+	b := NewContextBuilder(cfg.AI.Model, cfg.AI.ContextTokens)
+	b.Add(ContextBlock{Name: blockCode, Priority: PriorityCode, Content: kb.CodeContext, Trimmable: true})
+	b.Add(ContextBlock{Name: blockAPI, Priority: PriorityAPI, Content: kb.APIContext, Trimmable: true})
+	b.Add(ContextBlock{Name: blockInfra, Priority: PriorityInfra, Content: kb.InfraContext, Trimmable: true})
+	b.Add(ContextBlock{Name: blockSummaries, Priority: PrioritySummaries, Content: kb.FileSummaries, Trimmable: true})
+	if analysis != "" {
+		b.Add(ContextBlock{Name: blockAnalysis, Priority: PriorityAnalysis, Content: "Repository analysis for these files:\n" + analysis, Trimmable: true})
+	}
+
+	prompt, err := prompts.Render(prompts.AskRepo, prompts.Vars{
+		"Repo":     repoName,
+		"Question": question,
+		"Context":  b.Build().String(),
+	})
+	if err != nil {
+		return "", err
+	}
+	correction := ""
+	for attempt := 0; ; attempt++ {
+		answer, err := generateText(ctx, "ask-repo", prompt+correction, "", 0)
+		if err != nil {
+			return "", err
+		}
+		unknown := unknownPaths(citedPaths(answer), isFile)
+		if len(unknown) == 0 || attempt >= cfg.AI.PathValidationRetries {
+			if len(unknown) > 0 {
+				slog.WarnContext(ctx, "Answer cites files that do not exist", "repo", repoName, "files", unknown)
+			}
+			return strings.TrimSpace(answer), nil
+		}
+		slog.WarnContext(ctx, "Answer cited files that do not exist, asking again", "repo", repoName, "files", unknown, "attempt", attempt+1)
+		correction = pathCorrection(unknown, "paths of the repository's files, such as those in the excerpts,")
+	}
+}
@@ -0,0 +1,31 @@
+package ai
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// confidenceLinePattern matches the "Plan confidence: 0.8" and "Change confidence: 0.6" lines
+// the native agent ends its summary with
+var confidenceLinePattern = regexp.MustCompile(`(?im)^\s*[*_]*(plan|change) confidence\s*[*_]*\s*:\s*[*_]*\s*([0-9]*\.?[0-9]+)\s*(%?)\s*$`)
+
+// extractConfidence takes the confidence lines out of the agent's final text, returning the
+// rest as the summary
+func extractConfidence(text string) (summary string, plan, change *float64) {
+	for _, m := range confidenceLinePattern.FindAllStringSubmatch(text, -1) {
+		v, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			continue
+		}
+		if m[3] == "%" || v > 1 {
+			v /= 100
+		}
+		if strings.EqualFold(m[1], "plan") {
+			plan = &v
+		} else {
+			change = &v
+		}
+	}
+	return strings.TrimSpace(confidenceLinePattern.ReplaceAllString(text, "")), plan, change
+}
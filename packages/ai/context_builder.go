@@ -0,0 +1,218 @@
+package ai
+
+import (
+	"devflow-agent/packages/config"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// Priorities of the context blocks of an issue prompt; lower values are kept first when the
+// budget runs out
+const (
+	PriorityIssue          = 0
+	PriorityCandidateFiles = 20
+	PriorityCode           = 30
+	PriorityLinked         = 40
+	PriorityImpact         = 45
+	PriorityAPI            = 50
+	PriorityInfra          = 60
+	PrioritySummaries      = 70
+	PriorityAnalysis       = 80
+	PriorityOwnership      = 90
+)
+
+// minTrimTokens is the smallest remainder worth trimming a block into; below it the block is dropped
+const minTrimTokens = 64
+
+// trimmedMarker ends a block that was cut to fit the budget
+const trimmedMarker = "\n... (trimmed to fit the context budget)"
+
+// charsPerToken approximates the tokenizers of the model families DevFlow talks to
+var charsPerToken = map[string]float64{
+	"gemini": 4,
+	"gpt":    4,
+	"claude": 3.5,
+}
+
+// CountTokens estimates the number of tokens text takes for model
+func CountTokens(model, text string) int {
+	ratio := 4.0
+	for prefix, r := range charsPerToken {
+		if strings.HasPrefix(strings.ToLower(model), prefix) {
+			ratio = r
+			break
+		}
+	}
+	return int(float64(len(text))/ratio + 0.999)
+}
+
+// ContextBlock is one piece of prompt context
+type ContextBlock struct {
+	Name     string
+	Priority int
+	Content  string
+	// Trimmable blocks are cut at a line boundary to fit; others are kept whole or dropped
+	Trimmable bool
+}
+
+// ContextBuilder assembles prompt context within a token budget. Blocks are admitted in
+// priority order (ties keep the order they were added), so the result only depends on the
+// blocks and the budget.
+type ContextBuilder struct {
+	model  string
+	budget int // tokens; zero or less means unlimited
+	blocks []ContextBlock
+}
+
+// NewContextBuilder returns a builder counting tokens for model within budget tokens
+func NewContextBuilder(model string, budget int) *ContextBuilder {
+	return &ContextBuilder{model: model, budget: budget}
+}
+
+// Add queues a block; empty blocks are ignored
+func (b *ContextBuilder) Add(block ContextBlock) *ContextBuilder {
+	if strings.TrimSpace(block.Content) != "" {
+		b.blocks = append(b.blocks, block)
+	}
+	return b
+}
+
+// BuiltContext is the outcome of ContextBuilder.Build
+type BuiltContext struct {
+	Blocks  []ContextBlock // admitted blocks in priority order, possibly trimmed
+	Tokens  int
+	Trimmed []string // names of blocks that were cut
+	Dropped []string // names of blocks that did not fit at all
+}
+
+// Build admits blocks until the budget is spent
+func (b *ContextBuilder) Build() *BuiltContext {
+	blocks := make([]ContextBlock, len(b.blocks))
+	copy(blocks, b.blocks)
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].Priority < blocks[j].Priority })
+
+	out := &BuiltContext{}
+	for _, block := range blocks {
+		tokens := CountTokens(b.model, block.Content)
+		remaining := b.budget - out.Tokens
+		if b.budget <= 0 || tokens <= remaining {
+			out.Blocks = append(out.Blocks, block)
+			out.Tokens += tokens
+			continue
+		}
+		if block.Trimmable && remaining >= minTrimTokens {
+			block.Content = b.trim(block.Content, remaining)
+			out.Blocks = append(out.Blocks, block)
+			out.Tokens += CountTokens(b.model, block.Content)
+			out.Trimmed = append(out.Trimmed, block.Name)
+			continue
+		}
+		out.Dropped = append(out.Dropped, block.Name)
+	}
+	if len(out.Trimmed) > 0 || len(out.Dropped) > 0 {
+		slog.Info("Context budget applied", "budget", b.budget, "tokens", out.Tokens, "trimmed", out.Trimmed, "dropped", out.Dropped)
+	}
+	return out
+}
+
+// trim cuts content to at most tokens, at the last line boundary that fits
+func (b *ContextBuilder) trim(content string, tokens int) string {
+	ratio := float64(len(content)) / float64(max(CountTokens(b.model, content), 1))
+	limit := int(float64(tokens)*ratio) - len(trimmedMarker)
+	if limit <= 0 {
+		return strings.TrimSpace(trimmedMarker)
+	}
+	cut := content[:min(limit, len(content))]
+	if i := strings.LastIndexByte(cut, '\n'); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + trimmedMarker
+}
+
+// Get returns the admitted content of the named block, or "" if it was dropped
+func (c *BuiltContext) Get(name string) string {
+	for _, block := range c.Blocks {
+		if block.Name == name {
+			return block.Content
+		}
+	}
+	return ""
+}
+
+// String joins the admitted blocks in priority order
+func (c *BuiltContext) String() string {
+	parts := make([]string, 0, len(c.Blocks))
+	for _, block := range c.Blocks {
+		parts = append(parts, strings.TrimRight(block.Content, "\n"))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Names of the blocks of an issue prompt
+const (
+	blockIssue      = "issue"
+	blockCandidates = "candidate_files"
+	blockCode       = "code"
+	blockLinked     = "linked_context"
+	blockImpact     = "impact"
+	blockAPI        = "api_surface"
+	blockInfra      = "infrastructure"
+	blockSummaries  = "file_summaries"
+	blockAnalysis   = "analysis"
+	blockOwnership  = "ownership"
+)
+
+// buildIssueContext fits the issue body and the gathered context into the configured budget.
+// analysis is the repository analysis of the candidate files, if the caller loads it.
+func buildIssueContext(issue *github.Issue, issueCtx IssueContext, analysis string) *BuiltContext {
+	cfg := config.GetConfig()
+	b := NewContextBuilder(cfg.AI.Model, cfg.AI.ContextTokens)
+	// The body is trimmable so a pasted log cannot crowd out everything else
+	b.Add(ContextBlock{Name: blockIssue, Priority: PriorityIssue, Content: issue.GetBody(), Trimmable: true})
+	if len(issueCtx.Candidates) > 0 {
+		// Ranked most relevant first, so trimming to the budget keeps the top candidates
+		b.Add(ContextBlock{Name: blockCandidates, Priority: PriorityCandidateFiles, Content: renderCandidates(issueCtx.Candidates), Trimmable: true})
+	} else if len(issueCtx.CandidateFiles) > 0 {
+		b.Add(ContextBlock{Name: blockCandidates, Priority: PriorityCandidateFiles,
+			Content: "Files referenced by stack traces in the issue (inspect these first):\n- " + strings.Join(issueCtx.CandidateFiles, "\n- ")})
+	}
+	b.Add(ContextBlock{Name: blockCode, Priority: PriorityCode, Content: issueCtx.CodeContext, Trimmable: true})
+	b.Add(ContextBlock{Name: blockLinked, Priority: PriorityLinked, Content: issueCtx.LinkedContext, Trimmable: true})
+	b.Add(ContextBlock{Name: blockImpact, Priority: PriorityImpact, Content: issueCtx.ImpactContext, Trimmable: true})
+	b.Add(ContextBlock{Name: blockAPI, Priority: PriorityAPI, Content: issueCtx.APIContext, Trimmable: true})
+	b.Add(ContextBlock{Name: blockInfra, Priority: PriorityInfra, Content: issueCtx.InfraContext, Trimmable: true})
+	b.Add(ContextBlock{Name: blockSummaries, Priority: PrioritySummaries, Content: issueCtx.FileSummaries, Trimmable: true})
+	if analysis != "" {
+		b.Add(ContextBlock{Name: blockAnalysis, Priority: PriorityAnalysis, Content: "Repository analysis for these files:\n" + analysis, Trimmable: true})
+	}
+	b.Add(ContextBlock{Name: blockOwnership, Priority: PriorityOwnership, Content: issueCtx.OwnershipContext, Trimmable: true})
+	return b.Build()
+}
+
+// renderCandidates lists ranked candidate files with their scores and reasons, one per line
+func renderCandidates(candidates []FileCandidate) string {
+	var b strings.Builder
+	b.WriteString("Candidate files, most relevant first (inspect these first):\n")
+	for _, c := range candidates {
+		b.WriteString(fmt.Sprintf("- %s (relevance %.2f): %s\n", c.File, c.Score, strings.Join(c.Reasons, "; ")))
+	}
+	return b.String()
+}
+
+// admittedCandidates returns the candidate files whose line survived the context budget
+func admittedCandidates(issueCtx IssueContext, ranking string) []string {
+	if len(issueCtx.Candidates) == 0 {
+		return issueCtx.CandidateFiles
+	}
+	var files []string
+	for _, c := range issueCtx.Candidates {
+		if strings.Contains(ranking, "- "+c.File+" (") {
+			files = append(files, c.File)
+		}
+	}
+	return files
+}
@@ -0,0 +1,114 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"devflow-agent/packages/config"
+
+	"google.golang.org/genai"
+)
+
+// contextCaches remembers the Gemini caches this process created or found, by cache key
+var contextCaches = struct {
+	sync.Mutex
+	byKey map[string]*genai.CachedContent
+}{byKey: map[string]*genai.CachedContent{}}
+
+// LoadKnowledgeBaseContext returns the repository analysis and structure documents of a
+// checkout for context caching, or "" when caching is off. The structure is left out when
+// both do not fit ai.context_cache.max_tokens, and the analysis too when it alone does not.
+func LoadKnowledgeBaseContext(repoPath string) string {
+	cfg := config.GetConfig()
+	if !cfg.AI.ContextCache.Enabled {
+		return ""
+	}
+	var parts []string
+	for _, doc := range []struct{ title, file string }{
+		{"Repository analysis", cfg.Files.AnalysisFile},
+		{"Repository structure", cfg.Files.StructureFile},
+	} {
+		data, err := os.ReadFile(cfg.GetDevflowPath(repoPath, doc.file))
+		if err != nil {
+			continue
+		}
+		part := "# " + doc.title + "\n\n" + string(data)
+		if limit := cfg.AI.ContextCache.MaxTokens; limit > 0 && CountTokens(cfg.AI.Model, strings.Join(append(parts, part), "\n\n")) > limit {
+			break
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "The repository's knowledge base follows; prefer it to listing and reading files to find your way around.\n\n" +
+		strings.Join(parts, "\n\n")
+}
+
+// cachedContent returns the name of a Gemini cache holding the system instruction and tools
+// of a model's requests, creating it on first use. Caches are keyed by their content, so one
+// is shared by every run against the same knowledge base version until its TTL lapses, which
+// each use extends. It returns "" when caching is off, the content is below the provider's
+// minimum or the cache cannot be created; the caller then sends the content inline.
+func cachedContent(ctx context.Context, client *genai.Client, model, systemInstruction string, tools []*genai.Tool) string {
+	cacheCfg := config.GetConfig().AI.ContextCache
+	if !cacheCfg.Enabled || CountTokens(model, systemInstruction) < cacheCfg.MinTokens {
+		return ""
+	}
+	toolJSON, err := json.Marshal(tools)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(model + "\x00" + systemInstruction + "\x00" + string(toolJSON)))
+	displayName := "devflow-" + hex.EncodeToString(sum[:])[:32]
+	ttl := time.Duration(cacheCfg.TTLMinutes) * time.Minute
+
+	contextCaches.Lock()
+	defer contextCaches.Unlock()
+	cache := contextCaches.byKey[displayName]
+	if cache == nil {
+		// Another process, or an earlier run of this one, may have created it
+		for c, err := range client.Caches.All(ctx) {
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to list context caches", "error", err)
+				break
+			}
+			if c.DisplayName == displayName && strings.TrimPrefix(c.Model, "models/") == model && time.Until(c.ExpireTime) > time.Minute {
+				cache = c
+				break
+			}
+		}
+	}
+	switch {
+	case cache == nil:
+		created, err := client.Caches.Create(ctx, model, &genai.CreateCachedContentConfig{
+			DisplayName:       displayName,
+			TTL:               ttl,
+			SystemInstruction: genai.NewContentFromText(systemInstruction, genai.RoleUser),
+			Tools:             tools,
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to create context cache, sending the context inline", "model", model, "error", err)
+			return ""
+		}
+		slog.InfoContext(ctx, "Created context cache", "model", model, "cache", created.Name, "tokens", CountTokens(model, systemInstruction))
+		cache = created
+	case time.Until(cache.ExpireTime) < ttl/2:
+		if updated, err := client.Caches.Update(ctx, cache.Name, &genai.UpdateCachedContentConfig{TTL: ttl}); err == nil {
+			cache = updated
+		} else if time.Until(cache.ExpireTime) < time.Minute {
+			slog.WarnContext(ctx, "Context cache expiring and could not be extended", "cache", cache.Name, "error", err)
+			delete(contextCaches.byKey, displayName)
+			return ""
+		}
+	}
+	contextCaches.byKey[displayName] = cache
+	return cache.Name
+}
@@ -0,0 +1,43 @@
+package ai
+
+import (
+	"context"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/prompts"
+	"fmt"
+	"strings"
+)
+
+// Formats of a generated pull request description
+const (
+	DescribeFull    = "full"
+	DescribeMinimal = "minimal"
+)
+
+// DescribePullRequest writes a pull request description from its final diff. format is
+// DescribeFull or DescribeMinimal; maxTokens caps the reply, 0 meaning ai.max_output_tokens.
+// A diff over the context budget is trimmed, so large pull requests are described from
+// their first files.
+func DescribePullRequest(ctx context.Context, title, diff, format string, maxTokens int32) (string, error) {
+	if format != DescribeFull && format != DescribeMinimal {
+		return "", fmt.Errorf("unknown description format %q", format)
+	}
+	cfg := config.GetConfig()
+	built := NewContextBuilder(cfg.AI.Model, cfg.AI.ContextTokens).
+		Add(ContextBlock{Name: blockCode, Priority: PriorityCode, Content: diff, Trimmable: true}).
+		Build()
+
+	prompt, err := prompts.Render(prompts.DescribePR, prompts.Vars{
+		"Title":  title,
+		"Diff":   built.Get(blockCode),
+		"Format": format,
+	})
+	if err != nil {
+		return "", err
+	}
+	body, err := generateText(ctx, "describe-pr", prompt, "", maxTokens)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(body), nil
+}
@@ -0,0 +1,38 @@
+package ai
+
+import (
+	"context"
+	"devflow-agent/packages/prompts"
+	"encoding/json"
+	"fmt"
+)
+
+// DiscussionTriage is the model's assessment of a feature proposal raised in Discussions
+type DiscussionTriage struct {
+	Summary            string   `json:"summary"`
+	Actionable         bool     `json:"actionable"`
+	AcceptanceCriteria []string `json:"acceptance_criteria"`
+	OpenQuestions      []string `json:"open_questions"`
+}
+
+// TriageDiscussion summarizes a proposal, judges whether it is ready to become an issue and
+// drafts its acceptance criteria
+func TriageDiscussion(ctx context.Context, title, body, category string) (*DiscussionTriage, error) {
+	prompt, err := prompts.Render(prompts.DiscussionTriage, prompts.Vars{
+		"Title":    title,
+		"Body":     body,
+		"Category": category,
+	})
+	if err != nil {
+		return nil, err
+	}
+	text, err := generateText(ctx, "discussion-triage", prompt, "application/json", 0)
+	if err != nil {
+		return nil, err
+	}
+	var triage DiscussionTriage
+	if err := json.Unmarshal([]byte(text), &triage); err != nil {
+		return nil, fmt.Errorf("failed to parse discussion triage: %w", err)
+	}
+	return &triage, nil
+}
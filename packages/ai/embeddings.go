@@ -0,0 +1,64 @@
+package ai
+
+import (
+	"context"
+	"devflow-agent/packages/config"
+	"fmt"
+	"math"
+	"os"
+
+	"google.golang.org/genai"
+)
+
+// EmbedTexts returns an embedding of each text, in order, from ai.embedding_model
+func EmbedTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	cfg := config.GetConfig()
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" {
+		return nil, &LLMError{Op: "embed", Err: fmt.Errorf("GEMINI_API_KEY not set in environment")}
+	}
+	ctx, cancel := config.StageContext(ctx, cfg.Timeouts.LLMSeconds)
+	defer cancel()
+
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  apiKey,
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		return nil, &LLMError{Op: "embed", Err: err}
+	}
+	contents := make([]*genai.Content, len(texts))
+	for i, text := range texts {
+		contents[i] = genai.NewContentFromText(text, genai.RoleUser)
+	}
+	resp, err := client.Models.EmbedContent(ctx, cfg.AI.EmbeddingModel, contents, &genai.EmbedContentConfig{TaskType: "SEMANTIC_SIMILARITY"})
+	if err != nil {
+		return nil, &LLMError{Op: "embed", Err: err}
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, &LLMError{Op: "embed", Err: fmt.Errorf("got %d embeddings for %d texts", len(resp.Embeddings), len(texts))}
+	}
+	vectors := make([][]float32, len(texts))
+	for i, e := range resp.Embeddings {
+		vectors[i] = e.Values
+	}
+	return vectors, nil
+}
+
+// CosineSimilarity returns the cosine of the angle between two embeddings, or 0 when they
+// differ in length or either is zero
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
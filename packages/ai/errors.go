@@ -0,0 +1,15 @@
+package ai
+
+import "fmt"
+
+// LLMError reports a failure talking to the model or the agent server
+type LLMError struct {
+	Op  string // e.g. "agent", "repo-analysis"
+	Err error
+}
+
+func (e *LLMError) Error() string {
+	return fmt.Sprintf("%s failed: %v", e.Op, e.Err)
+}
+
+func (e *LLMError) Unwrap() error { return e.Err }
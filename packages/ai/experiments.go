@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"devflow-agent/packages/config"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// PromptVariant is the arm of a prompt experiment a run was assigned
+type PromptVariant struct {
+	Experiment   string
+	Variant      string
+	Slot         string
+	Instructions string
+}
+
+// AssignPromptVariants picks a variant of every configured experiment for an issue. Pinned
+// repositories get their variant; other runs are split by weight on a hash of the issue, so
+// the same issue keeps its variant across retries.
+func AssignPromptVariants(cfg *config.Config, repoName string, issueNumber int) []PromptVariant {
+	var out []PromptVariant
+	for _, exp := range cfg.Experiments {
+		variant, ok := pinnedVariant(exp, repoName)
+		if !ok {
+			variant = weightedVariant(exp, fmt.Sprintf("%s:%s#%d", exp.Name, strings.ToLower(repoName), issueNumber))
+		}
+		out = append(out, PromptVariant{
+			Experiment:   exp.Name,
+			Variant:      variant.Name,
+			Slot:         exp.Slot,
+			Instructions: strings.TrimSpace(variant.Instructions),
+		})
+	}
+	return out
+}
+
+func pinnedVariant(exp config.ExperimentConfig, repoName string) (config.PromptVariantConfig, bool) {
+	for repo, name := range exp.Repos {
+		if !strings.EqualFold(repo, repoName) {
+			continue
+		}
+		for _, v := range exp.Variants {
+			if v.Name == name {
+				return v, true
+			}
+		}
+	}
+	return config.PromptVariantConfig{}, false
+}
+
+func weightedVariant(exp config.ExperimentConfig, key string) config.PromptVariantConfig {
+	total := 0
+	for _, v := range exp.Variants {
+		total += v.Weight
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	n := int(h.Sum32() % uint32(total))
+	for _, v := range exp.Variants {
+		if n < v.Weight {
+			return v
+		}
+		n -= v.Weight
+	}
+	return exp.Variants[len(exp.Variants)-1]
+}
+
+// slotInstructions joins the instructions of the variants that apply to a prompt slot
+func slotInstructions(variants []PromptVariant, slot string) string {
+	var parts []string
+	for _, v := range variants {
+		if v.Slot == slot && v.Instructions != "" {
+			parts = append(parts, v.Instructions)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,122 @@
+package ai
+
+import (
+	"context"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/prompts"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// FileSummaryInput is a source file to be summarized
+type FileSummaryInput struct {
+	Path     string
+	Language string
+	Content  string
+}
+
+// SummarizeFiles asks the LLM for a 2-3 sentence summary of each file, sending files in
+// batches of cfg.AI.SummaryBatchSize. Failed batches are skipped, so the returned map may
+// be partial; an error is only returned when the stage deadline cuts the run short.
+func SummarizeFiles(ctx context.Context, files []FileSummaryInput) (map[string]string, error) {
+	cfg := config.GetConfig()
+
+	batchSize := cfg.AI.SummaryBatchSize
+	if batchSize <= 0 {
+		batchSize = 20
+	}
+
+	summaries := make(map[string]string)
+	for start := 0; start < len(files); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return summaries, &LLMError{Op: "file-summaries", Err: err}
+		}
+		end := min(start+batchSize, len(files))
+		batch, err := summarizeBatch(ctx, files[start:end])
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to summarize file batch", "from", start, "to", end, "error", err)
+			continue
+		}
+		for path, summary := range batch {
+			summaries[path] = strings.TrimSpace(summary)
+		}
+	}
+
+	slog.InfoContext(ctx, "Generated file summaries", "files", len(files), "summarized", len(summaries))
+	return summaries, nil
+}
+
+// summarizeBatch sends one batch of files and parses the path -> summary JSON reply. Summaries
+// of paths that are not in the batch are dropped, and the files they should have covered are
+// sent again with the made-up paths pointed out, up to cfg.AI.PathValidationRetries times.
+func summarizeBatch(ctx context.Context, files []FileSummaryInput) (map[string]string, error) {
+	cfg := config.GetConfig()
+
+	maxChars := cfg.AI.SummaryMaxFileChars
+	if maxChars <= 0 {
+		maxChars = 4000
+	}
+
+	batch := make([]FileSummaryInput, 0, len(files))
+	for _, f := range files {
+		if len(f.Content) > maxChars {
+			f.Content = f.Content[:maxChars] + "\n... (truncated)"
+		}
+		batch = append(batch, f)
+	}
+	temperature := float32(cfg.AI.RepoAnalysisTemperature)
+	genConfig := &genai.GenerateContentConfig{
+		Temperature:      &temperature,
+		MaxOutputTokens:  int32(cfg.AI.MaxOutputTokens),
+		ResponseMIMEType: "application/json",
+	}
+
+	summaries := make(map[string]string)
+	pending, correction := batch, ""
+	for attempt := 0; ; attempt++ {
+		prompt, err := prompts.Render(prompts.FileSummaries, prompts.Vars{"Files": pending})
+		if err != nil {
+			return nil, err
+		}
+		text, _, err := generateContent(ctx, "file-summaries", prompt+correction, genConfig)
+		if err != nil {
+			if len(summaries) > 0 {
+				return summaries, nil
+			}
+			return nil, err
+		}
+		var reply map[string]string
+		if err := json.Unmarshal([]byte(text), &reply); err != nil {
+			if len(summaries) > 0 {
+				return summaries, nil
+			}
+			return nil, fmt.Errorf("failed to parse summaries: %w", err)
+		}
+
+		inBatch := func(path string) bool {
+			return slices.ContainsFunc(pending, func(f FileSummaryInput) bool { return f.Path == path })
+		}
+		for path, summary := range reply {
+			if inBatch(path) {
+				summaries[path] = summary
+			}
+		}
+		unknown := unknownPaths(slices.Sorted(maps.Keys(reply)), inBatch)
+		pending = slices.DeleteFunc(slices.Clone(pending), func(f FileSummaryInput) bool { _, ok := summaries[f.Path]; return ok })
+		if len(unknown) == 0 || len(pending) == 0 {
+			return summaries, nil
+		}
+		if attempt >= cfg.AI.PathValidationRetries {
+			slog.WarnContext(ctx, "Dropped summaries of files not in the batch", "unknown", unknown, "unsummarized", len(pending))
+			return summaries, nil
+		}
+		slog.WarnContext(ctx, "Summaries named files not in the batch, asking again", "unknown", unknown, "unsummarized", len(pending))
+		correction = pathCorrection(unknown, "the file paths exactly as given above")
+	}
+}
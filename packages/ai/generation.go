@@ -0,0 +1,87 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+
+	"devflow-agent/packages/config"
+)
+
+// GenerationSettings are the sampling settings of an agent run: the global ai settings with
+// the repository's overrides applied
+type GenerationSettings struct {
+	Temperature     float32 `json:"temperature"`
+	MaxOutputTokens int32   `json:"max_output_tokens"`  // the agent's responses, which carry the code
+	PRBodyMaxTokens int32   `json:"pr_body_max_tokens"` // the pull request description and its translation
+}
+
+// GenerationSettingsError reports repository overrides a configured model cannot honor
+type GenerationSettingsError struct {
+	Problems []string
+}
+
+func (e *GenerationSettingsError) Error() string {
+	return "invalid ai settings: " + strings.Join(e.Problems, "; ")
+}
+
+// providerLimits returns the highest temperature and output token count a model accepts;
+// maxTokens is 0 when the limit is unknown, as for OpenAI-compatible endpoints
+func providerLimits(cfg *config.Config, model string) (maxTemperature float32, maxTokens int32) {
+	m := strings.ToLower(model)
+	switch {
+	case isOpenAICompatibleModel(cfg, model):
+		return 2, 0
+	case isClaudeModel(model):
+		switch {
+		case strings.Contains(m, "opus-4"):
+			return 1, 32000
+		case strings.Contains(m, "-4"):
+			return 1, 64000
+		}
+		return 1, 8192
+	case strings.HasPrefix(m, "gemini-2.5") || strings.HasPrefix(m, "gemini-3"):
+		return 2, 65536
+	}
+	return 2, 8192
+}
+
+// ResolveGenerationSettings applies a repository's ai overrides to the global settings. Every
+// model in the fallback chain may serve the run, so the result must suit each of them.
+func ResolveGenerationSettings(cfg *config.Config, overrides config.RepoAIConfig) (GenerationSettings, error) {
+	settings := GenerationSettings{
+		Temperature:     cfg.AI.Temperature,
+		MaxOutputTokens: cfg.AI.MaxOutputTokens,
+		PRBodyMaxTokens: cfg.AI.MaxOutputTokens,
+	}
+	if overrides.Temperature != nil {
+		settings.Temperature = *overrides.Temperature
+	}
+	if overrides.MaxOutputTokens != 0 {
+		settings.MaxOutputTokens = overrides.MaxOutputTokens
+	}
+	if overrides.PRBodyMaxTokens != 0 {
+		settings.PRBodyMaxTokens = overrides.PRBodyMaxTokens
+	}
+
+	var problems []string
+	if settings.Temperature < 0 {
+		problems = append(problems, fmt.Sprintf("temperature %g is negative", settings.Temperature))
+	}
+	if settings.MaxOutputTokens < 0 || settings.PRBodyMaxTokens < 0 {
+		problems = append(problems, "token limits must be positive")
+	}
+	for _, model := range modelChain(cfg) {
+		maxTemperature, maxTokens := providerLimits(cfg, model)
+		if settings.Temperature > maxTemperature {
+			problems = append(problems, fmt.Sprintf("temperature %g is above %g, the maximum of %s", settings.Temperature, maxTemperature, model))
+		}
+		if maxTokens > 0 && max(settings.MaxOutputTokens, settings.PRBodyMaxTokens) > maxTokens {
+			problems = append(problems, fmt.Sprintf("%d output tokens are above %d, the maximum of %s",
+				max(settings.MaxOutputTokens, settings.PRBodyMaxTokens), maxTokens, model))
+		}
+	}
+	if len(problems) > 0 {
+		return settings, &GenerationSettingsError{Problems: problems}
+	}
+	return settings, nil
+}
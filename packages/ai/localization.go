@@ -0,0 +1,191 @@
+package ai
+
+import (
+	"context"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/prompts"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"google.golang.org/genai"
+)
+
+// languageNames maps the language codes DevFlow detects or accepts to names the model understands
+var languageNames = map[string]string{
+	"en": "English",
+	"ja": "Japanese",
+	"zh": "Chinese",
+	"ko": "Korean",
+	"ru": "Russian",
+	"es": "Spanish",
+	"de": "German",
+	"fr": "French",
+	"pt": "Portuguese",
+	"it": "Italian",
+}
+
+// LanguageName returns the English name of a language code, or the code itself if unknown
+func LanguageName(code string) string {
+	if name, ok := languageNames[strings.ToLower(code)]; ok {
+		return name
+	}
+	return code
+}
+
+// IsEnglish reports whether a language code needs no translation
+func IsEnglish(code string) bool {
+	code = strings.ToLower(code)
+	return code == "" || code == "en" || strings.HasPrefix(code, "en-")
+}
+
+// stopwords are frequent words that tell Latin-script languages apart
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "to", "of", "when", "should", "not", "with", "this"},
+	"es": {"el", "la", "los", "las", "de", "que", "y", "es", "cuando", "no", "con", "para", "una"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "mit", "wenn", "ein", "eine", "zu", "auf"},
+	"fr": {"le", "la", "les", "et", "est", "pas", "avec", "quand", "une", "des", "pour", "dans"},
+	"pt": {"o", "os", "as", "de", "que", "e", "não", "com", "quando", "uma", "para", "está"},
+	"it": {"il", "lo", "gli", "di", "che", "e", "è", "non", "con", "quando", "una", "per"},
+}
+
+// DetectLanguage guesses the language of issue text without a model call: the script decides
+// for CJK, Korean and Cyrillic, stopword counts for Latin-script languages. Code blocks are
+// ignored and English is the fallback.
+func DetectLanguage(text string) string {
+	text = stripCodeBlocks(text)
+
+	var kana, han, hangul, cyrillic, letters int
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		}
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if letters == 0 {
+		return "en"
+	}
+	switch {
+	case kana*10 > letters:
+		return "ja"
+	case hangul*10 > letters:
+		return "ko"
+	case han*10 > letters:
+		return "zh"
+	case cyrillic*3 > letters:
+		return "ru"
+	}
+
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for lang, words := range stopwords {
+			for _, w := range words {
+				if word == w {
+					counts[lang]++
+				}
+			}
+		}
+	}
+	best := "en"
+	for _, lang := range []string{"es", "de", "fr", "pt", "it"} {
+		// Require a clear margin so mixed text and identifiers stay English
+		if counts[lang] > counts[best] && counts[lang] >= 3 {
+			best = lang
+		}
+	}
+	return best
+}
+
+// stripCodeBlocks drops fenced code, which is language-neutral and would skew detection
+func stripCodeBlocks(text string) string {
+	var b strings.Builder
+	inFence := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if !inFence {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// TranslateIssue translates an issue's title and body to English for the agent. Code, paths,
+// identifiers and error messages are kept verbatim.
+func TranslateIssue(ctx context.Context, title, body, lang string) (string, string, error) {
+	prompt, err := prompts.Render(prompts.TranslateIssue, prompts.Vars{
+		"Language": LanguageName(lang),
+		"Title":    title,
+		"Body":     body,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	text, err := generateText(ctx, "translate-issue", prompt, "application/json", 0)
+	if err != nil {
+		return "", "", err
+	}
+	var out struct {
+		Title string `json:"title"`
+		Body  string `json:"body"`
+	}
+	if err := json.Unmarshal([]byte(text), &out); err != nil {
+		return "", "", fmt.Errorf("failed to parse issue translation: %w", err)
+	}
+	return out.Title, out.Body, nil
+}
+
+// Localize translates DevFlow-authored markdown (PR bodies, status comments) into lang.
+// English targets are returned unchanged.
+func Localize(ctx context.Context, text, lang string) (string, error) {
+	return LocalizeLimited(ctx, text, lang, 0)
+}
+
+// LocalizeLimited is Localize with the reply capped at maxTokens output tokens; 0 uses
+// ai.max_output_tokens
+func LocalizeLimited(ctx context.Context, text, lang string, maxTokens int32) (string, error) {
+	if IsEnglish(lang) || strings.TrimSpace(text) == "" {
+		return text, nil
+	}
+	prompt, err := prompts.Render(prompts.Localize, prompts.Vars{"Language": LanguageName(lang), "Text": text})
+	if err != nil {
+		return "", err
+	}
+
+	out, err := generateText(ctx, "localize", prompt, "", maxTokens)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// generateText runs a single deterministic generation with the configured model, falling
+// back to the next model on failure; mimeType "application/json" asks for a JSON reply and
+// maxTokens caps the reply, 0 meaning ai.max_output_tokens
+func generateText(ctx context.Context, op, prompt, mimeType string, maxTokens int32) (string, error) {
+	cfg := config.GetConfig()
+	if maxTokens == 0 {
+		maxTokens = cfg.AI.MaxOutputTokens
+	}
+	temperature := float32(0)
+	genConfig := &genai.GenerateContentConfig{
+		Temperature:      &temperature,
+		MaxOutputTokens:  maxTokens,
+		ResponseMIMEType: mimeType,
+	}
+	text, _, err := generateContent(ctx, op, prompt, genConfig)
+	return text, err
+}
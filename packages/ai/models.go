@@ -0,0 +1,205 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"devflow-agent/packages/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// AnthropicBaseURL is where Claude fallback models are called; ANTHROPIC_BASE_URL overrides it
+var AnthropicBaseURL = "https://api.anthropic.com"
+
+// anthropicVersion is the Messages API version DevFlow speaks
+const anthropicVersion = "2023-06-01"
+
+// modelChain returns the primary model followed by the configured fallbacks, in order and
+// without repeats
+func modelChain(cfg *config.Config) []string {
+	chain := []string{cfg.AI.Model}
+	for _, m := range cfg.AI.FallbackModels {
+		m = strings.TrimSpace(m)
+		if m != "" && !containsModel(chain, m) {
+			chain = append(chain, m)
+		}
+	}
+	return chain
+}
+
+func containsModel(models []string, model string) bool {
+	for _, m := range models {
+		if strings.EqualFold(m, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// isClaudeModel reports whether model is served by Anthropic rather than Gemini
+func isClaudeModel(model string) bool {
+	return strings.HasPrefix(strings.ToLower(model), "claude")
+}
+
+// isGeminiModel reports whether model is served by the Gemini API, the only provider with
+// the chat and tool-calling support the native agent loop needs
+func isGeminiModel(cfg *config.Config, model string) bool {
+	return !isClaudeModel(model) && !isOpenAICompatibleModel(cfg, model)
+}
+
+// generateContent runs a single-prompt generation on the primary model and, when it errors,
+// times out or returns no content, on each fallback model in turn. It returns the text and
+// the model that produced it; the error of the last model tried is returned when all fail.
+func generateContent(ctx context.Context, op, prompt string, genConfig *genai.GenerateContentConfig) (string, string, error) {
+	cfg := config.GetConfig()
+	chain := modelChain(cfg)
+
+	var lastErr error
+	for i, model := range chain {
+		if err := ctx.Err(); err != nil {
+			return "", "", &LLMError{Op: op, Err: err}
+		}
+		if i > 0 {
+			slog.WarnContext(ctx, "Falling back to next model", "op", op, "model", model, "previousError", lastErr)
+		}
+
+		text, err := generateWithModel(ctx, cfg, model, prompt, genConfig)
+		var blocked *SafetyBlockError
+		if errors.As(err, &blocked) && cfg.AI.SafetyRetry {
+			slog.WarnContext(ctx, "Model blocked the prompt, retrying with a sanitized prompt", "op", op, "model", model, "reason", blocked.Reason)
+			text, err = generateWithModel(ctx, cfg, model, sanitizePrompt(prompt), genConfig)
+		}
+		if err == nil {
+			if i > 0 {
+				slog.InfoContext(ctx, "Fallback model produced the result", "op", op, "model", model)
+			}
+			return text, model, nil
+		}
+		slog.ErrorContext(ctx, "Model call failed", "op", op, "model", model, "error", err)
+		lastErr = fmt.Errorf("%s: %w", model, err)
+	}
+	return "", "", &LLMError{Op: op, Err: lastErr}
+}
+
+// generateWithModel runs one generation on model within the stage timeout. Each model gets
+// the full timeout, so a hung primary does not starve the fallbacks.
+func generateWithModel(ctx context.Context, cfg *config.Config, model, prompt string, genConfig *genai.GenerateContentConfig) (string, error) {
+	ctx, cancel := config.StageContext(ctx, cfg.Timeouts.LLMSeconds)
+	defer cancel()
+	if isOpenAICompatibleModel(cfg, model) {
+		return generateOpenAICompatible(ctx, cfg, model, prompt, genConfig)
+	}
+	if isClaudeModel(model) {
+		return generateAnthropic(ctx, model, prompt, genConfig)
+	}
+	withSafety := *genConfig
+	withSafety.SafetySettings = safetySettings(cfg)
+	return generateGemini(ctx, model, prompt, &withSafety)
+}
+
+// generateGemini runs one generation on a Gemini model
+func generateGemini(ctx context.Context, model, prompt string, genConfig *genai.GenerateContentConfig) (string, error) {
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" {
+		return "", fmt.Errorf("GEMINI_API_KEY not set in environment")
+	}
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  apiKey,
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		return "", err
+	}
+	result, err := client.Models.GenerateContent(ctx, model, genai.Text(prompt), genConfig)
+	if err != nil {
+		return "", err
+	}
+	if blocked := safetyBlock(model, result); blocked != nil {
+		return "", blocked
+	}
+	if result == nil || result.Text() == "" {
+		return "", fmt.Errorf("no content generated")
+	}
+	return result.Text(), nil
+}
+
+// generateAnthropic runs one generation on a Claude model through the Messages API
+func generateAnthropic(ctx context.Context, model, prompt string, genConfig *genai.GenerateContentConfig) (string, error) {
+	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		return "", fmt.Errorf("ANTHROPIC_API_KEY not set in environment")
+	}
+	baseURL := AnthropicBaseURL
+	if env := os.Getenv("ANTHROPIC_BASE_URL"); env != "" {
+		baseURL = env
+	}
+
+	payload := map[string]any{
+		"model":      model,
+		"max_tokens": max(genConfig.MaxOutputTokens, 1024),
+		"messages":   []map[string]string{{"role": "user", "content": prompt}},
+	}
+	if genConfig.Temperature != nil {
+		payload["temperature"] = min(*genConfig.Temperature, 1)
+	}
+	if genConfig.ResponseMIMEType == "application/json" {
+		payload["system"] = "Reply with a single JSON value and nothing else."
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("anthropic API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var message struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string `json:"stop_reason"`
+	}
+	if err := json.Unmarshal(respBody, &message); err != nil {
+		return "", fmt.Errorf("failed to parse anthropic response: %w", err)
+	}
+	if message.StopReason == "refusal" {
+		return "", &SafetyBlockError{Model: model, Reason: "REFUSAL"}
+	}
+	var text strings.Builder
+	for _, c := range message.Content {
+		if c.Type == "text" {
+			text.WriteString(c.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", errors.New("no content generated")
+	}
+	return text.String(), nil
+}
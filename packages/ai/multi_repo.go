@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"context"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/prompts"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// RepoOverview is what the planner knows about one repository of a cross-repo change
+type RepoOverview struct {
+	Repo     string
+	Overview string
+}
+
+// RepoChangeset is the part of a cross-repo change assigned to one repository
+type RepoChangeset struct {
+	Repo string `json:"repo"`
+	Task string `json:"task"`
+}
+
+// MultiRepoPlan is the planner's split of a cross-repo change
+type MultiRepoPlan struct {
+	Changesets []RepoChangeset
+	// Confidence is the planner's confidence, from 0 to 1, that the split and the shared
+	// contract are right; nil when it reported none
+	Confidence *float64
+}
+
+// PlanMultiRepoChanges splits an issue into per-repository tasks. Repositories that need no
+// change are left out; the returned changesets keep the order of repos.
+func PlanMultiRepoChanges(ctx context.Context, issueTitle, issueBody string, repos []RepoOverview) (*MultiRepoPlan, error) {
+	cfg := config.GetConfig()
+
+	prompt, err := prompts.Render(prompts.MultiRepoPlan, prompts.Vars{
+		"IssueTitle": issueTitle,
+		"IssueBody":  issueBody,
+		"Repos":      repos,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	temperature := float32(cfg.AI.RepoAnalysisTemperature)
+	genConfig := &genai.GenerateContentConfig{
+		Temperature:      &temperature,
+		MaxOutputTokens:  int32(cfg.AI.MaxOutputTokens),
+		ResponseMIMEType: "application/json",
+	}
+
+	text, _, err := generateContent(ctx, "multi-repo-plan", prompt, genConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan struct {
+		Changesets []RepoChangeset `json:"changesets"`
+		Confidence *float64        `json:"confidence"`
+	}
+	if err := json.Unmarshal([]byte(text), &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse multi-repo plan: %w", err)
+	}
+
+	// Keep only repositories we were asked about, in their original order
+	tasks := make(map[string]string)
+	for _, c := range plan.Changesets {
+		if strings.TrimSpace(c.Task) != "" {
+			tasks[strings.ToLower(c.Repo)] = c.Task
+		}
+	}
+	result := &MultiRepoPlan{Confidence: plan.Confidence}
+	for _, r := range repos {
+		if task, ok := tasks[strings.ToLower(r.Repo)]; ok {
+			result.Changesets = append(result.Changesets, RepoChangeset{Repo: r.Repo, Task: task})
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,118 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"devflow-agent/packages/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// isOpenAICompatibleModel reports whether model is routed to ai.openai_compatible
+func isOpenAICompatibleModel(cfg *config.Config, model string) bool {
+	return cfg.AI.OpenAICompatible.BaseURL != "" && containsModel(cfg.AI.OpenAICompatible.Models, model)
+}
+
+// generateOpenAICompatible runs one generation through the chat completions API of the
+// configured OpenAI-compatible endpoint
+func generateOpenAICompatible(ctx context.Context, cfg *config.Config, model, prompt string, genConfig *genai.GenerateContentConfig) (string, error) {
+	oc := cfg.AI.OpenAICompatible
+	endpoint, err := url.Parse(strings.TrimRight(oc.BaseURL, "/") + "/chat/completions")
+	if err != nil {
+		return "", fmt.Errorf("invalid ai.openai_compatible.base_url: %w", err)
+	}
+	if oc.APIVersion != "" {
+		endpoint.RawQuery = url.Values{"api-version": {oc.APIVersion}}.Encode()
+	}
+
+	messages := []map[string]string{{"role": "user", "content": prompt}}
+	if genConfig.ResponseMIMEType == "application/json" {
+		messages = append([]map[string]string{{"role": "system", "content": "Reply with a single JSON value and nothing else."}}, messages...)
+	}
+	payload := map[string]any{
+		"model":    model,
+		"messages": messages,
+	}
+	if genConfig.MaxOutputTokens > 0 {
+		payload["max_tokens"] = genConfig.MaxOutputTokens
+	}
+	if genConfig.Temperature != nil {
+		payload["temperature"] = *genConfig.Temperature
+	}
+	if genConfig.TopP != nil {
+		payload["top_p"] = *genConfig.TopP
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if oc.APIKeyEnv != "" {
+		if key := os.Getenv(oc.APIKeyEnv); key != "" {
+			if oc.APIVersion != "" {
+				req.Header.Set("api-key", key) // Azure OpenAI
+			} else {
+				req.Header.Set("Authorization", "Bearer "+key)
+			}
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+				Refusal string `json:"refusal"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Error *struct {
+			Code    any    `json:"code"` // a string on OpenAI and Azure, a number on some proxies
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &completion); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("failed to parse chat completion: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Azure rejects prompts its content filter flags with a content_filter error
+		if completion.Error != nil && fmt.Sprint(completion.Error.Code) == "content_filter" {
+			return "", &SafetyBlockError{Model: model, Reason: "CONTENT_FILTER", Message: completion.Error.Message}
+		}
+		return "", fmt.Errorf("chat completions API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if len(completion.Choices) == 0 {
+		return "", errors.New("no content generated")
+	}
+
+	choice := completion.Choices[0]
+	if choice.FinishReason == "content_filter" || choice.Message.Refusal != "" {
+		return "", &SafetyBlockError{Model: model, Reason: "CONTENT_FILTER", Message: choice.Message.Refusal}
+	}
+	if choice.Message.Content == "" {
+		return "", errors.New("no content generated")
+	}
+	return choice.Message.Content, nil
+}
@@ -0,0 +1,52 @@
+package ai
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// citedPathPattern matches a path cited in inline code, as `path` or `path:line`
+var citedPathPattern = regexp.MustCompile("`((?:[A-Za-z0-9_.\\-]+/)*[A-Za-z0-9_\\-][A-Za-z0-9_.\\-]*\\.[A-Za-z][A-Za-z0-9]*)(?::\\d+(?:-\\d+)?)?`")
+
+// IsRepoFile returns a check of whether a repository-relative path is a file in repoPath
+func IsRepoFile(repoPath string) func(string) bool {
+	return func(rel string) bool {
+		info, err := os.Stat(filepath.Join(repoPath, filepath.FromSlash(rel)))
+		return err == nil && !info.IsDir()
+	}
+}
+
+// citedPaths returns the distinct paths text cites in inline code, in order of appearance
+func citedPaths(text string) []string {
+	var paths []string
+	seen := map[string]bool{}
+	for _, m := range citedPathPattern.FindAllStringSubmatch(text, -1) {
+		path := strings.TrimPrefix(m[1], "./")
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// unknownPaths returns the paths isFile rejects: ones the model made up rather than read
+func unknownPaths(paths []string, isFile func(string) bool) []string {
+	var unknown []string
+	for _, path := range paths {
+		if !isFile(path) {
+			unknown = append(unknown, path)
+		}
+	}
+	return unknown
+}
+
+// pathCorrection is appended to a prompt sent again because the reply named paths that do
+// not exist, so the model corrects them instead of guessing again
+func pathCorrection(unknown []string, allowed string) string {
+	return fmt.Sprintf("\n\nYour previous reply named files that do not exist: %s. Use only %s; "+
+		"do not invent, shorten or guess paths.", strings.Join(unknown, ", "), allowed)
+}
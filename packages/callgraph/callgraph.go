@@ -0,0 +1,150 @@
+// Package callgraph extracts function-level call graphs from Go and TypeScript sources, for
+// impact analysis such as which callers break when a function's signature changes.
+package callgraph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Function is a function or method and the functions of the repository it calls. IDs are
+// "<import path>.Name" or "<import path>.(*Type).Name" for Go, "<file>#Name" or
+// "<file>#Class.method" for TypeScript.
+type Function struct {
+	ID        string   `json:"id"`
+	File      string   `json:"file"` // repo-relative, slash-separated
+	Name      string   `json:"name"`
+	Line      int      `json:"line"`
+	Signature string   `json:"signature,omitempty"`
+	Calls     []string `json:"calls,omitempty"`
+}
+
+// Graph is the call graph of a repository
+type Graph struct {
+	Functions []Function `json:"functions"`
+
+	byID    map[string]*Function
+	callers map[string][]string
+}
+
+// Caller is a function that calls, directly (Depth 1) or through others, the function analyzed
+type Caller struct {
+	*Function
+	Depth int
+}
+
+// Build extracts the call graph of the Go modules and the TypeScript project in repoPath.
+// A language whose toolchain is unavailable is skipped.
+func Build(ctx context.Context, repoPath string) (*Graph, error) {
+	goFuncs, err := buildGo(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("go call graph: %w", err)
+	}
+	tsFuncs, err := buildTypeScript(ctx, repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("typescript call graph: %w", err)
+	}
+	g := &Graph{Functions: append(goFuncs, tsFuncs...)}
+	sort.Slice(g.Functions, func(i, j int) bool { return g.Functions[i].ID < g.Functions[j].ID })
+	return g, nil
+}
+
+// Load reads a call graph written by Write
+func Load(path string) (*Graph, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read call graph: %w", err)
+	}
+	var g Graph
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("failed to parse call graph: %w", err)
+	}
+	return &g, nil
+}
+
+// Write saves the call graph as JSON
+func (g *Graph) Write(path string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal call graph: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (g *Graph) index() {
+	if g.byID != nil {
+		return
+	}
+	g.byID = make(map[string]*Function, len(g.Functions))
+	g.callers = map[string][]string{}
+	for i := range g.Functions {
+		fn := &g.Functions[i]
+		g.byID[fn.ID] = fn
+		for _, callee := range fn.Calls {
+			g.callers[callee] = append(g.callers[callee], fn.ID)
+		}
+	}
+}
+
+// Find returns the functions whose ID or name is name, or whose ID ends in "."+name or
+// "#"+name, so "Type.Method" or a bare function name is enough
+func (g *Graph) Find(name string) []*Function {
+	g.index()
+	if fn, ok := g.byID[name]; ok {
+		return []*Function{fn}
+	}
+	var out []*Function
+	for i := range g.Functions {
+		fn := &g.Functions[i]
+		if fn.Name == name || strings.HasSuffix(fn.ID, "."+name) || strings.HasSuffix(fn.ID, "#"+name) {
+			out = append(out, fn)
+		}
+	}
+	return out
+}
+
+// InFile returns the functions defined in a repo-relative file, in line order
+func (g *Graph) InFile(file string) []*Function {
+	var out []*Function
+	for i := range g.Functions {
+		if g.Functions[i].File == file {
+			out = append(out, &g.Functions[i])
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Line < out[j].Line })
+	return out
+}
+
+// Callers returns the functions that reach id within depth calls, nearest first
+func (g *Graph) Callers(id string, depth int) []Caller {
+	g.index()
+	seen := map[string]bool{id: true}
+	var out []Caller
+	frontier := []string{id}
+	for d := 1; d <= depth && len(frontier) > 0; d++ {
+		var next []string
+		for _, callee := range frontier {
+			for _, caller := range g.callers[callee] {
+				if seen[caller] {
+					continue
+				}
+				seen[caller] = true
+				next = append(next, caller)
+				out = append(out, Caller{Function: g.byID[caller], Depth: d})
+			}
+		}
+		sort.Strings(next)
+		frontier = next
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Depth != out[j].Depth {
+			return out[i].Depth < out[j].Depth
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
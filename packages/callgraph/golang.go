@@ -0,0 +1,359 @@
+package callgraph
+
+import (
+	"bufio"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// goPackage is a package of a Go module in the repository
+type goPackage struct {
+	path  string
+	files []*ast.File
+	pkg   *types.Package
+	info  *types.Info
+}
+
+// goImporter type-checks the repository's packages on demand. Packages outside the
+// repository (the standard library and dependencies) are empty stand-ins: calls into them are
+// not part of the call graph, and the type errors they cause are ignored.
+type goImporter struct {
+	fset     *token.FileSet
+	packages map[string]*goPackage
+	checked  map[string]*types.Package
+	checking map[string]bool
+}
+
+func (im *goImporter) Import(importPath string) (*types.Package, error) {
+	if pkg, ok := im.checked[importPath]; ok {
+		return pkg, nil
+	}
+	gp, ok := im.packages[importPath]
+	if !ok || im.checking[importPath] {
+		stub := types.NewPackage(importPath, guessPackageName(importPath))
+		stub.MarkComplete()
+		im.checked[importPath] = stub
+		return stub, nil
+	}
+	im.checking[importPath] = true
+	conf := types.Config{Importer: im, Error: func(error) {}, FakeImportC: true}
+	gp.info = &types.Info{
+		Defs:       map[*ast.Ident]types.Object{},
+		Uses:       map[*ast.Ident]types.Object{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+	}
+	gp.pkg, _ = conf.Check(importPath, im.fset, gp.files, gp.info)
+	im.checked[importPath] = gp.pkg
+	return gp.pkg, nil
+}
+
+// guessPackageName is the conventional name of an import path: "yaml" for gopkg.in/yaml.v3
+func guessPackageName(importPath string) string {
+	name := path.Base(importPath)
+	if strings.HasPrefix(name, "v") && strings.Trim(name[1:], "0123456789") == "" && path.Dir(importPath) != "." {
+		name = path.Base(path.Dir(importPath))
+	}
+	if i := strings.Index(name, ".v"); i > 0 {
+		name = name[:i]
+	}
+	return strings.NewReplacer("-", "_", ".", "_").Replace(strings.TrimPrefix(name, "go-"))
+}
+
+// buildGo extracts the call graph of every Go module in the repository. Only calls between
+// functions of those modules are recorded; a call through an interface leads to every method
+// of the modules' types implementing it.
+func buildGo(repoPath string) ([]Function, error) {
+	fset := token.NewFileSet()
+	im := &goImporter{fset: fset, packages: map[string]*goPackage{}, checked: map[string]*types.Package{}, checking: map[string]bool{}}
+	dirs := map[string][]string{}  // package directory -> its .go files
+	modules := map[string]string{} // module root directory -> module path
+	err := filepath.WalkDir(repoPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != repoPath && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case d.Name() == "go.mod":
+			if mod := readModulePath(p); mod != "" {
+				modules[filepath.Dir(p)] = mod
+			}
+		case strings.HasSuffix(p, ".go") && !strings.HasSuffix(p, "_test.go"):
+			dirs[filepath.Dir(p)] = append(dirs[filepath.Dir(p)], p)
+		}
+		return nil
+	})
+	if err != nil || len(modules) == 0 {
+		return nil, err
+	}
+
+	rel := func(p string) string {
+		r, _ := filepath.Rel(repoPath, p)
+		return filepath.ToSlash(r)
+	}
+	for dir, files := range dirs {
+		importPath := goImportPath(modules, dir)
+		if importPath == "" {
+			continue
+		}
+		// A directory holds one package; files of others (e.g. build-tagged main files) are left out
+		byName := map[string][]*ast.File{}
+		for _, f := range files {
+			file, err := parser.ParseFile(fset, f, nil, parser.SkipObjectResolution)
+			if err != nil || file.Name.Name == "documentation" {
+				continue
+			}
+			byName[file.Name.Name] = append(byName[file.Name.Name], file)
+		}
+		best := ""
+		for name, fs := range byName {
+			if best == "" || len(fs) > len(byName[best]) || (len(fs) == len(byName[best]) && name < best) {
+				best = name
+			}
+		}
+		if best != "" {
+			im.packages[importPath] = &goPackage{path: importPath, files: byName[best]}
+		}
+	}
+
+	paths := make([]string, 0, len(im.packages))
+	for p := range im.packages {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		_, _ = im.Import(p)
+	}
+
+	named := goNamedTypes(im, paths)
+	impls := map[*types.Func][]*types.Func{}
+	var out []Function
+	for _, p := range paths {
+		gp := im.packages[p]
+		if gp.pkg == nil {
+			continue
+		}
+		for _, file := range gp.files {
+			for _, decl := range file.Decls {
+				fd, ok := decl.(*ast.FuncDecl)
+				if !ok || fd.Body == nil {
+					continue
+				}
+				fn, ok := gp.info.Defs[fd.Name].(*types.Func)
+				if !ok {
+					continue
+				}
+				calls := map[string]bool{}
+				ast.Inspect(fd.Body, func(n ast.Node) bool {
+					call, ok := n.(*ast.CallExpr)
+					if !ok {
+						return true
+					}
+					callee := goCallee(gp.info, call)
+					if callee == nil || callee.Pkg() == nil || im.packages[callee.Pkg().Path()] == nil {
+						return true
+					}
+					if isInterfaceMethod(callee) {
+						if _, ok := impls[callee]; !ok {
+							impls[callee] = goImplementations(callee, named)
+						}
+						for _, impl := range impls[callee] {
+							calls[goFuncID(impl)] = true
+						}
+						return true
+					}
+					calls[goFuncID(callee)] = true
+					return true
+				})
+				id := goFuncID(fn)
+				delete(calls, id)
+				pos := fset.Position(fd.Pos())
+				out = append(out, Function{
+					ID:        id,
+					File:      rel(pos.Filename),
+					Name:      goFuncName(fn),
+					Line:      pos.Line,
+					Signature: goSignature(fset, fd),
+					Calls:     sortedKeys(calls),
+				})
+			}
+		}
+	}
+	return out, nil
+}
+
+// readModulePath returns the module path declared by a go.mod file
+func readModulePath(goMod string) string {
+	f, err := os.Open(goMod)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); strings.HasPrefix(line, "module ") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module")), `"`)
+		}
+	}
+	return ""
+}
+
+// goImportPath is the import path of a directory in the innermost module containing it
+func goImportPath(modules map[string]string, dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if mod, ok := modules[d]; ok {
+			r, _ := filepath.Rel(d, dir)
+			if r == "." {
+				return mod
+			}
+			return mod + "/" + filepath.ToSlash(r)
+		}
+		if parent := filepath.Dir(d); parent == d {
+			return ""
+		}
+	}
+}
+
+// goCallee is the function or method a call expression calls, or nil for calls of function
+// values, conversions and builtins
+func goCallee(info *types.Info, call *ast.CallExpr) *types.Func {
+	fun := ast.Unparen(call.Fun)
+	if ix, ok := fun.(*ast.IndexExpr); ok { // explicit instantiation f[T](...)
+		fun = ix.X
+	} else if ix, ok := fun.(*ast.IndexListExpr); ok {
+		fun = ix.X
+	}
+	var obj types.Object
+	switch f := fun.(type) {
+	case *ast.Ident:
+		obj = info.Uses[f]
+	case *ast.SelectorExpr:
+		if sel, ok := info.Selections[f]; ok {
+			obj = sel.Obj()
+		} else {
+			obj = info.Uses[f.Sel]
+		}
+	}
+	fn, _ := obj.(*types.Func)
+	if fn != nil {
+		fn = fn.Origin()
+	}
+	return fn
+}
+
+func isInterfaceMethod(fn *types.Func) bool {
+	recv := fn.Type().(*types.Signature).Recv()
+	return recv != nil && types.IsInterface(recv.Type())
+}
+
+// goNamedTypes lists the non-interface named types of the repository's packages
+func goNamedTypes(im *goImporter, paths []string) []*types.Named {
+	var out []*types.Named
+	for _, p := range paths {
+		pkg := im.packages[p].pkg
+		if pkg == nil {
+			continue
+		}
+		scope := pkg.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			// Implements is unspecified for uninstantiated generic types
+			if named, ok := tn.Type().(*types.Named); ok && !types.IsInterface(named) && named.TypeParams().Len() == 0 {
+				out = append(out, named)
+			}
+		}
+	}
+	return out
+}
+
+// goImplementations returns the methods of named types that implement the interface of method
+func goImplementations(method *types.Func, named []*types.Named) []*types.Func {
+	iface, ok := method.Type().(*types.Signature).Recv().Type().Underlying().(*types.Interface)
+	if !ok {
+		return nil
+	}
+	var out []*types.Func
+	for _, t := range named {
+		var recv types.Type = t
+		if !types.Implements(recv, iface) {
+			recv = types.NewPointer(t)
+			if !types.Implements(recv, iface) {
+				continue
+			}
+		}
+		obj, _, _ := types.LookupFieldOrMethod(recv, true, method.Pkg(), method.Name())
+		if impl, ok := obj.(*types.Func); ok {
+			out = append(out, impl)
+		}
+	}
+	return out
+}
+
+// goFuncID identifies a function like go/ssa does: "pkg.F", "pkg.(T).M" or "pkg.(*T).M"
+func goFuncID(fn *types.Func) string {
+	pkg := ""
+	if fn.Pkg() != nil {
+		pkg = fn.Pkg().Path()
+	}
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return pkg + "." + fn.Name()
+	}
+	return pkg + ".(" + goRecvName(recv.Type()) + ")." + fn.Name()
+}
+
+// goFuncName is a function's name as written in code: "F" or "T.M"
+func goFuncName(fn *types.Func) string {
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return fn.Name()
+	}
+	return strings.TrimPrefix(goRecvName(recv.Type()), "*") + "." + fn.Name()
+}
+
+func goRecvName(t types.Type) string {
+	ptr := ""
+	if p, ok := t.(*types.Pointer); ok {
+		ptr, t = "*", p.Elem()
+	}
+	if named, ok := t.(*types.Named); ok {
+		return ptr + named.Obj().Name()
+	}
+	return ptr + t.String()
+}
+
+// goSignature is the signature as written in the source; the type checker does not know the
+// types of other modules
+func goSignature(fset *token.FileSet, fd *ast.FuncDecl) string {
+	var b strings.Builder
+	if err := printer.Fprint(&b, fset, fd.Type); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
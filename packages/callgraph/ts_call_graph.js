@@ -0,0 +1,108 @@
+// Prints the call graph of the TypeScript project in the directory given as argument, as a
+// JSON array of functions, using the repository's own TypeScript compiler. Exits with status
+// 3 when the repository has no TypeScript installed.
+const fs = require("fs");
+const path = require("path");
+
+const root = path.resolve(process.argv[2] || ".");
+let ts;
+try {
+  ts = require(require.resolve("typescript", { paths: [root] }));
+} catch (e) {
+  process.stderr.write("typescript is not installed in the repository\n");
+  process.exit(3);
+}
+
+const skipDirs = new Set(["node_modules", ".git", ".devflow", "dist", "build", "coverage"]);
+function walk(dir, out) {
+  for (const entry of fs.readdirSync(dir, { withFileTypes: true })) {
+    if (entry.isDirectory()) {
+      if (!skipDirs.has(entry.name) && !entry.name.startsWith(".")) walk(path.join(dir, entry.name), out);
+    } else if (/\.tsx?$/.test(entry.name) && !entry.name.endsWith(".d.ts")) {
+      out.push(path.join(dir, entry.name));
+    }
+  }
+  return out;
+}
+
+let fileNames;
+let options = { noEmit: true, allowJs: false };
+const configPath = path.join(root, "tsconfig.json");
+if (fs.existsSync(configPath)) {
+  const config = ts.readConfigFile(configPath, ts.sys.readFile);
+  const parsed = ts.parseJsonConfigFileContent(config.config || {}, ts.sys, root);
+  fileNames = parsed.fileNames;
+  options = Object.assign(parsed.options, { noEmit: true });
+} else {
+  fileNames = walk(root, []);
+}
+
+const program = ts.createProgram(fileNames, options);
+const checker = program.getTypeChecker();
+const rel = (f) => path.relative(root, f).split(path.sep).join("/");
+const inRepo = (f) => !rel(f).startsWith("..") && !f.includes("/node_modules/") && !f.endsWith(".d.ts");
+
+function className(node) {
+  return node.parent && node.parent.name ? node.parent.name.text : "<anonymous>";
+}
+
+// declName is how code refers to a function declaration: "f", "Class.method" or the name of
+// the variable an arrow function is assigned to
+function declName(node) {
+  if (ts.isFunctionDeclaration(node) && node.name) return node.name.text;
+  if ((ts.isMethodDeclaration(node) || ts.isGetAccessorDeclaration(node) || ts.isSetAccessorDeclaration(node)) && node.name) {
+    return className(node) + "." + node.name.getText();
+  }
+  if (ts.isConstructorDeclaration(node)) return className(node) + ".constructor";
+  if ((ts.isArrowFunction(node) || ts.isFunctionExpression(node)) && ts.isVariableDeclaration(node.parent) && ts.isIdentifier(node.parent.name)) {
+    return node.parent.name.text;
+  }
+  return undefined;
+}
+
+function idOf(node) {
+  const name = declName(node);
+  return name && rel(node.getSourceFile().fileName) + "#" + name;
+}
+
+function signatureOf(node) {
+  try {
+    const sig = checker.getSignatureFromDeclaration(node);
+    return sig ? checker.signatureToString(sig) : "";
+  } catch (e) {
+    return "";
+  }
+}
+
+const functions = new Map();
+for (const sf of program.getSourceFiles()) {
+  if (!inRepo(sf.fileName)) continue;
+  const visit = (node, current) => {
+    const id = idOf(node);
+    if (id) {
+      if (!functions.has(id)) {
+        const { line } = sf.getLineAndCharacterOfPosition(node.getStart());
+        functions.set(id, { id, file: rel(sf.fileName), name: declName(node), line: line + 1, signature: signatureOf(node), calls: new Set() });
+      }
+      current = functions.get(id);
+    }
+    if (current && (ts.isCallExpression(node) || ts.isNewExpression(node))) {
+      let decl;
+      try {
+        const sig = checker.getResolvedSignature(node);
+        decl = sig && sig.getDeclaration();
+      } catch (e) {
+        decl = undefined;
+      }
+      if (decl && inRepo(decl.getSourceFile().fileName)) {
+        const target = idOf(decl);
+        if (target && target !== current.id) current.calls.add(target);
+      }
+    }
+    ts.forEachChild(node, (child) => visit(child, current));
+  };
+  visit(sf, undefined);
+}
+
+const out = [...functions.values()].map((f) => Object.assign(f, { calls: [...f.calls].sort() }));
+process.stdout.write(JSON.stringify(out));
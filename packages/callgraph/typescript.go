@@ -0,0 +1,87 @@
+package callgraph
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// tsHelper walks a TypeScript project with the repository's own compiler API
+//
+//go:embed ts_call_graph.js
+var tsHelper []byte
+
+// tsMissingExit is the helper's exit status when the repository has no TypeScript installed
+const tsMissingExit = 3
+
+// buildTypeScript extracts the call graph of the repository's TypeScript sources with Node
+// and the TypeScript compiler from its node_modules. Without either it returns nothing.
+func buildTypeScript(ctx context.Context, repoPath string) ([]Function, error) {
+	if !hasTypeScript(repoPath) {
+		return nil, nil
+	}
+	node, err := exec.LookPath("node")
+	if err != nil {
+		slog.Info("Skipping TypeScript call graph: node is not installed")
+		return nil, nil
+	}
+	helper, err := os.CreateTemp("", "devflow-ts-call-graph-*.js")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(helper.Name())
+	if _, err := helper.Write(tsHelper); err != nil {
+		helper.Close()
+		return nil, err
+	}
+	helper.Close()
+
+	cmd := exec.CommandContext(ctx, node, helper.Name(), repoPath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == tsMissingExit {
+		slog.Info("Skipping TypeScript call graph: typescript is not installed in the repository")
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var funcs []Function
+	if err := json.Unmarshal(out, &funcs); err != nil {
+		return nil, fmt.Errorf("failed to parse helper output: %w", err)
+	}
+	return funcs, nil
+}
+
+// hasTypeScript reports whether the repository has a tsconfig.json or any .ts file outside
+// node_modules
+func hasTypeScript(repoPath string) bool {
+	if _, err := os.Stat(filepath.Join(repoPath, "tsconfig.json")); err == nil {
+		return true
+	}
+	found := false
+	_ = filepath.WalkDir(repoPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || found {
+			return filepath.SkipAll
+		}
+		if d.IsDir() && p != repoPath && (d.Name() == "node_modules" || strings.HasPrefix(d.Name(), ".")) {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && (strings.HasSuffix(p, ".ts") || strings.HasSuffix(p, ".tsx")) && !strings.HasSuffix(p, ".d.ts") {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found
+}
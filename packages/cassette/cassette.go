@@ -0,0 +1,253 @@
+// Package cassette records the HTTP exchanges with LLM providers to a file and replays them,
+// so the issue to pull request pipeline can run deterministically without API keys or cost.
+// It wraps http.DefaultTransport, which the Gemini, Anthropic and OpenAI-compatible clients
+// use; requests to other hosts pass through untouched.
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"devflow-agent/packages/config"
+)
+
+// Modes of ai.cassette
+const (
+	ModeOff    = ""
+	ModeRecord = "record" // forward requests to the provider and append every exchange to the file
+	ModeReplay = "replay" // answer from the file; a request it has no exchange for fails
+)
+
+// defaultHosts are the providers always intercepted; the OpenAI-compatible and Anthropic
+// endpoints configured are added to them
+var defaultHosts = []string{"generativelanguage.googleapis.com", "api.anthropic.com"}
+
+// Cassette is the file of recorded exchanges
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded request and its response. Headers are not recorded, so the
+// file never holds API keys.
+type Interaction struct {
+	Key         string          `json:"key"` // hash of the method, URL and canonical body
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	Request     json.RawMessage `json:"request,omitempty"`
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	Response    json.RawMessage `json:"response"`
+}
+
+// transport intercepts the requests to the LLM hosts
+type transport struct {
+	next  http.RoundTripper
+	mode  string
+	file  string
+	hosts []string
+
+	mu       sync.Mutex
+	cassette Cassette
+	served   map[string]int // replay: how many exchanges of each key were served
+}
+
+// Install wraps http.DefaultTransport according to cfg. DEVFLOW_LLM_CASSETTE and
+// DEVFLOW_LLM_CASSETTE_MODE override the file and mode, so tests can turn it on without
+// changing the config. In replay mode placeholder API keys are set when none are, because the
+// clients refuse to run without one.
+func Install(cfg *config.Config) error {
+	c := cfg.AI.Cassette
+	if env := os.Getenv("DEVFLOW_LLM_CASSETTE"); env != "" {
+		c.File = env
+	}
+	if env := os.Getenv("DEVFLOW_LLM_CASSETTE_MODE"); env != "" {
+		c.Mode = env
+	}
+	if c.Mode == ModeOff {
+		return nil
+	}
+	if c.Mode != ModeRecord && c.Mode != ModeReplay {
+		return fmt.Errorf("unknown cassette mode %q, expected record or replay", c.Mode)
+	}
+	if c.File == "" {
+		return fmt.Errorf("cassette mode %s needs a file", c.Mode)
+	}
+
+	t := &transport{next: http.DefaultTransport, mode: c.Mode, file: c.File, served: make(map[string]int)}
+	t.hosts = append(append([]string{}, defaultHosts...), c.Hosts...)
+	for _, base := range []string{cfg.AI.OpenAICompatible.BaseURL, os.Getenv("ANTHROPIC_BASE_URL")} {
+		if u, err := url.Parse(base); err == nil && u.Host != "" {
+			t.hosts = append(t.hosts, u.Host)
+		}
+	}
+
+	switch c.Mode {
+	case ModeReplay:
+		data, err := os.ReadFile(c.File)
+		if err != nil {
+			return fmt.Errorf("failed to read cassette: %w", err)
+		}
+		if err := json.Unmarshal(data, &t.cassette); err != nil {
+			return fmt.Errorf("failed to parse cassette %s: %w", c.File, err)
+		}
+		for _, key := range []string{"GEMINI_API_KEY", "ANTHROPIC_API_KEY"} {
+			if os.Getenv(key) == "" {
+				os.Setenv(key, "cassette-replay")
+			}
+		}
+	case ModeRecord:
+		// Recording extends an existing cassette
+		if data, err := os.ReadFile(c.File); err == nil {
+			if err := json.Unmarshal(data, &t.cassette); err != nil {
+				return fmt.Errorf("failed to parse cassette %s: %w", c.File, err)
+			}
+		}
+	}
+
+	http.DefaultTransport = t
+	slog.Info("LLM cassette installed", "mode", c.Mode, "file", c.File, "interactions", len(t.cassette.Interactions))
+	return nil
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !slices.Contains(t.hosts, req.URL.Host) {
+		return t.next.RoundTrip(req)
+	}
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	key := requestKey(req, body)
+
+	if t.mode == ModeReplay {
+		in, ok := t.replay(key)
+		if !ok {
+			return nil, fmt.Errorf("cassette %s has no recorded response for %s %s (key %s)", t.file, req.Method, redactURL(req.URL), key[:12])
+		}
+		respBody := decodeBody(in.Response)
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+			StatusCode:    in.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {in.ContentType}},
+			Body:          io.NopCloser(bytes.NewReader(respBody)),
+			ContentLength: int64(len(respBody)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	in := Interaction{
+		Key:         key,
+		Method:      req.Method,
+		URL:         redactURL(req.URL),
+		Request:     encodeBody(body),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Response:    encodeBody(respBody),
+	}
+	if err := t.record(in); err != nil {
+		slog.Warn("Failed to record LLM exchange", "file", t.file, "error", err)
+	}
+	return resp, nil
+}
+
+// replay returns the next recorded exchange for key. Once they are used up the last one is
+// served again, so retries of the same request get the same answer.
+func (t *transport) replay(key string) (Interaction, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var matches []Interaction
+	for _, in := range t.cassette.Interactions {
+		if in.Key == key {
+			matches = append(matches, in)
+		}
+	}
+	if len(matches) == 0 {
+		return Interaction{}, false
+	}
+	n := t.served[key]
+	t.served[key]++
+	return matches[min(n, len(matches)-1)], true
+}
+
+// record appends an exchange and rewrites the cassette file
+func (t *transport) record(in Interaction) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cassette.Interactions = append(t.cassette.Interactions, in)
+	data, err := json.MarshalIndent(&t.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.file, append(data, '\n'), 0644)
+}
+
+// requestKey identifies a request by its method, host, path, query without credentials and
+// body with JSON keys in a canonical order
+func requestKey(req *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", req.Method, redactURL(req.URL))
+	var v any
+	if json.Unmarshal(body, &v) == nil {
+		body, _ = json.Marshal(v)
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// redactURL drops the key query parameter some providers accept instead of a header
+func redactURL(u *url.URL) string {
+	c := *u
+	q := c.Query()
+	q.Del("key")
+	c.RawQuery = q.Encode()
+	return c.String()
+}
+
+// encodeBody keeps JSON bodies readable in the cassette and stores others as JSON strings
+func encodeBody(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+	s, _ := json.Marshal(string(body))
+	return s
+}
+
+func decodeBody(raw json.RawMessage) []byte {
+	var s string
+	if strings.HasPrefix(string(raw), `"`) && json.Unmarshal(raw, &s) == nil {
+		return []byte(s)
+	}
+	return raw
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,25 +18,130 @@ type Config struct {
 	Issues        IssuesConfig        `yaml:"issues"`
 	Labels        []LabelConfig       `yaml:"labels"`
 	AI            AIConfig            `yaml:"ai"`
+	Agent         AgentConfig         `yaml:"agent"`
 	Repository    RepositoryConfig    `yaml:"repository"`
 	Files         FilesConfig         `yaml:"files"`
 	PullRequests  PullRequestsConfig  `yaml:"pull_requests"`
+	Ownership     OwnershipConfig     `yaml:"ownership"`
+	CodeContext   CodeContextConfig   `yaml:"code_context"`
+	RepoDefaults  RepoConfig          `yaml:"repo_defaults"`
+	Timeouts      TimeoutsConfig      `yaml:"timeouts"`
 	Debug         DebugConfig         `yaml:"debug"`
+	Logging       LoggingConfig       `yaml:"logging"`
+
+	DependencyUpgrades DependencyUpgradesConfig `yaml:"dependency_upgrades"`
+	SecurityAlerts     SecurityAlertsConfig     `yaml:"security_alerts"`
+	Store              StoreConfig              `yaml:"store"`
+	Network            NetworkConfig            `yaml:"network"`
+	Queue              QueueConfig              `yaml:"queue"`
+	Deployment         DeploymentConfig         `yaml:"deployment"`
+	Localization       LocalizationConfig       `yaml:"localization"`
+	Admin              AdminConfig              `yaml:"admin"`
+	RunsAPI            RunsAPIConfig            `yaml:"runs_api"`
+	Experiments        []ExperimentConfig       `yaml:"experiments"`
+	Prompts            PromptsConfig            `yaml:"prompts"`
+	Discussions        DiscussionsConfig        `yaml:"discussions"`
+	Projects           ProjectsConfig           `yaml:"projects"`
+	Janitor            JanitorConfig            `yaml:"janitor"`
+	KnowledgeBase      KnowledgeBaseConfig      `yaml:"knowledge_base"`
+	Bot                BotConfig                `yaml:"bot"`
+	GitHub             GitHubConfig             `yaml:"github"`
+	Providers          ProvidersConfig          `yaml:"providers"`
+	Audit              AuditConfig              `yaml:"audit"`
+	DeadLetters        DeadLettersConfig        `yaml:"dead_letters"`
+	Notifications      NotificationsConfig      `yaml:"notifications"`
+	RunWebhooks        []RunWebhookConfig       `yaml:"run_webhooks"`
+	Previews           PreviewsConfig           `yaml:"previews"`
+	Pipeline           PipelineConfig           `yaml:"pipeline"`
+	Plugins            []PluginConfig           `yaml:"plugins"`
+	Auth               AuthConfig               `yaml:"auth"`
 }
 
 // InstallationsConfig contains installation-related configuration
 type InstallationsConfig struct {
-	InitBranch          string `yaml:"init_branch"`
-	InitCommit          string `yaml:"init_commit"`
-	KnowledgeBaseBranch string `yaml:"knowledge_base_branch"`
-	KnowledgeBaseCommit string `yaml:"knowledge_base_commit"`
+	InitBranch          string           `yaml:"init_branch"`
+	InitCommit          string           `yaml:"init_commit"`
+	KnowledgeBaseBranch string           `yaml:"knowledge_base_branch"`
+	KnowledgeBaseCommit string           `yaml:"knowledge_base_commit"`
+	SetupIssue          SetupIssueConfig `yaml:"setup_issue"`
+}
+
+// SetupIssueConfig opens a "DevFlow setup" issue on installation. Its checklist picks the
+// trigger labels, autonomy level, protected paths and notification channel; once its apply
+// box is checked, DevFlow opens a pull request on Branch adding the repository's settings.
+type SetupIssueConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Title          string   `yaml:"title"`
+	Label          string   `yaml:"label"`           // marks the setup issue
+	Branch         string   `yaml:"branch"`          // carries the settings pull request
+	ProtectedPaths []string `yaml:"protected_paths"` // glob patterns offered as checkboxes
 }
 
 // IssuesConfig contains issue handling configuration
 type IssuesConfig struct {
-	RequiredLabels      []string `yaml:"required_labels"`
-	BranchPrefix        string   `yaml:"branch_prefix"`
-	BranchNameMaxLength int      `yaml:"branch_name_max_length"`
+	RequiredLabels      []string            `yaml:"required_labels"`
+	BranchPrefix        string              `yaml:"branch_prefix"`
+	BranchNameMaxLength int                 `yaml:"branch_name_max_length"`
+	LinkedContext       LinkedContextConfig `yaml:"linked_context"`
+	StatusLabels        StatusLabelsConfig  `yaml:"status_labels"`
+	DocsLabel           string              `yaml:"docs_label"`           // triggers documentation-only mode
+	MultiRepoLabel      string              `yaml:"multi_repo_label"`     // coordinates changes across the referenced repos
+	MultiRepoMaxRepos   int                 `yaml:"multi_repo_max_repos"` // cap on repos changed by one issue
+	SmallFixes          SmallFixesConfig    `yaml:"small_fixes"`
+	Queue               RunQueueConfig      `yaml:"queue"`
+	// HeldCheckMinutes is how often triggers held by a repository's schedule are retried
+	HeldCheckMinutes int                  `yaml:"held_check_minutes"`
+	Revisions        IssueRevisionsConfig `yaml:"revisions"`
+	// CleanupOnClose closes DevFlow's open pull requests of an issue closed without them,
+	// deletes their branches and drops the issue's queued and held runs
+	CleanupOnClose bool `yaml:"cleanup_on_close"`
+	// Preflight checks that the run can push its branch and open a pull request (permissions,
+	// archived repository, rulesets) before starting, failing early with a comment if not
+	Preflight bool `yaml:"preflight"`
+}
+
+// IssueRevisionsConfig controls what happens when an issue DevFlow already opened a pull
+// request for changes
+type IssueRevisionsConfig struct {
+	// OnEdit runs the agent again on the open pull request's branch when the issue's title or
+	// body is edited
+	OnEdit bool `yaml:"on_edit"`
+	// OnReopen opens a follow-up pull request when the issue is reopened after its pull
+	// request was merged or closed
+	OnReopen bool `yaml:"on_reopen"`
+}
+
+// SmallFixesConfig offers trivial fixes (one hunk in one file) as a suggested change on a PR
+// the issue references, or a patch on the issue, instead of opening a pull request
+type SmallFixesConfig struct {
+	Enabled         bool `yaml:"enabled"`
+	MaxChangedLines int  `yaml:"max_changed_lines"` // added plus removed lines
+}
+
+// RunQueueConfig limits how many issues of one repository are worked at once. The others
+// wait in order of their priority label, then their 👍 reactions, then when they were triggered.
+type RunQueueConfig struct {
+	RunsPerRepo    int            `yaml:"runs_per_repo"`   // 0 works every triggered issue at once
+	PriorityLabels map[string]int `yaml:"priority_labels"` // higher first; an issue takes its highest, unlisted labels count 0
+	// ParallelRuns is how many more runs may start beside runs_per_repo when the files they
+	// are predicted to change, from the dependency graph, overlap no other run's. A run whose
+	// changes turn out to overlap is redone once the runs before it finish. Needs the mirror cache.
+	ParallelRuns int `yaml:"parallel_runs"`
+}
+
+// StatusLabelsConfig names the lifecycle labels DevFlow keeps on the triggering issue
+type StatusLabelsConfig struct {
+	InProgress string `yaml:"in_progress"`
+	PROpen     string `yaml:"pr_open"`
+	Failed     string `yaml:"failed"`
+}
+
+// LinkedContextConfig controls how referenced issues/PRs are summarized for the agent
+type LinkedContextConfig struct {
+	Enabled          bool `yaml:"enabled"`
+	MaxReferences    int  `yaml:"max_references"`
+	MaxComments      int  `yaml:"max_comments"`
+	MaxCharsPerEntry int  `yaml:"max_chars_per_entry"`
 }
 
 // LabelConfig represents a GitHub label configuration
@@ -44,12 +153,61 @@ type LabelConfig struct {
 
 // AIConfig contains AI-related configuration
 type AIConfig struct {
-	Model                   string  `yaml:"model"`
-	Temperature             float32 `yaml:"temperature"`
-	TopK                    int32   `yaml:"top_k"`
-	TopP                    float32 `yaml:"top_p"`
-	MaxOutputTokens         int32   `yaml:"max_output_tokens"`
-	RepoAnalysisTemperature float32 `yaml:"repo_analysis_temperature"`
+	Model                   string                 `yaml:"model"`
+	Temperature             float32                `yaml:"temperature"`
+	TopK                    int32                  `yaml:"top_k"`
+	TopP                    float32                `yaml:"top_p"`
+	MaxOutputTokens         int32                  `yaml:"max_output_tokens"`
+	RepoAnalysisTemperature float32                `yaml:"repo_analysis_temperature"`
+	SummaryBatchSize        int                    `yaml:"summary_batch_size"`      // files per summarization request
+	SummaryMaxFileChars     int                    `yaml:"summary_max_file_chars"`  // file content sent per file
+	SummaryContextTokens    int                    `yaml:"summary_context_tokens"`  // budget for summaries in issue prompts
+	CandidateFiles          int                    `yaml:"candidate_files"`         // ranked files an issue prompt points the agent at; 0 only uses stack traces
+	ContextTokens           int                    `yaml:"context_tokens"`          // budget for all context in a prompt; 0 is unlimited
+	PathValidationRetries   int                    `yaml:"path_validation_retries"` // re-prompts of a reply naming files that do not exist; 0 drops them
+	FallbackModels          []string               `yaml:"fallback_models"`         // tried in order when the model errors, times out or returns nothing
+	SafetySettings          map[string]string      `yaml:"safety_settings"`         // Gemini harm category -> block threshold
+	SafetyRetry             bool                   `yaml:"safety_retry"`            // retry a safety-blocked prompt once with credentials redacted
+	EmbeddingModel          string                 `yaml:"embedding_model"`         // Gemini model for text embeddings
+	OpenAICompatible        OpenAICompatibleConfig `yaml:"openai_compatible"`
+	Cassette                CassetteConfig         `yaml:"cassette"`
+	ContextCache            ContextCacheConfig     `yaml:"context_cache"`
+}
+
+// ContextCacheConfig caches the knowledge base with Gemini's context caching, once per
+// knowledge base version, for the native agent engine's steps to reference instead of
+// resending it. The Python agent server's model calls are not covered.
+type ContextCacheConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	TTLMinutes int  `yaml:"ttl_minutes"` // how long a cache outlives its last use, across runs
+	MinTokens  int  `yaml:"min_tokens"`  // smaller context is not cached; Gemini rejects caches below its minimum
+	MaxTokens  int  `yaml:"max_tokens"`  // cap on the cached documents: the structure, then the analysis, is left out above it
+}
+
+// CassetteConfig records the agent's exchanges with LLM providers to File, or replays them from
+// it, for deterministic integration tests of the pipeline. The Python agent server's own model
+// calls are not covered; use the native engine for fully replayable runs.
+type CassetteConfig struct {
+	Mode  string   `yaml:"mode"`  // "" (off), record or replay
+	File  string   `yaml:"file"`  // JSON file of recorded exchanges
+	Hosts []string `yaml:"hosts"` // more provider hosts to intercept, e.g. an LLM gateway
+}
+
+// OpenAICompatibleConfig routes models to an endpoint speaking the OpenAI chat completions
+// API, such as Azure OpenAI, vLLM, a LiteLLM proxy or a corporate gateway
+type OpenAICompatibleConfig struct {
+	BaseURL    string   `yaml:"base_url"`    // e.g. http://localhost:8000/v1; empty disables the provider
+	Models     []string `yaml:"models"`      // models served by the endpoint, usable as ai.model or in fallback_models
+	APIKeyEnv  string   `yaml:"api_key_env"` // environment variable holding the key; no key is sent when it is unset
+	APIVersion string   `yaml:"api_version"` // Azure OpenAI only: sent as api-version, with the key in an api-key header
+}
+
+// AgentConfig selects the issue-resolution engine and bounds the native agent loop
+type AgentConfig struct {
+	Engine         string `yaml:"engine"` // "python" (Strands server) or "native" (Go function-calling loop)
+	MaxSteps       int    `yaml:"max_steps"`
+	TimeoutSeconds int    `yaml:"timeout_seconds"`
+	TestCommand    string `yaml:"test_command"`
 }
 
 // RepositoryConfig contains repository-related configuration
@@ -59,6 +217,369 @@ type RepositoryConfig struct {
 	DevflowDirectory string `yaml:"devflow_directory"`
 	TempRepoPrefix   string `yaml:"temp_repo_prefix"`
 	CleanupTempRepos bool   `yaml:"cleanup_temp_repos"`
+	MirrorCacheDir   string `yaml:"mirror_cache_dir"` // bare mirrors reused across runs; empty clones fresh each time
+	WorkspaceDir     string `yaml:"workspace_dir"`    // scratch volume for clones; empty uses the working directory
+	// NormalizeLineEndings stores changed files with the line endings .gitattributes and the
+	// committed files call for, whichever the agent wrote
+	NormalizeLineEndings bool `yaml:"normalize_line_endings"`
+}
+
+// OwnershipConfig controls git history/blame context and reviewer suggestions
+type OwnershipConfig struct {
+	Enabled           bool `yaml:"enabled"`
+	HistoryDepth      int  `yaml:"history_depth"`
+	MaxCommitsPerFile int  `yaml:"max_commits_per_file"`
+	MaxAuthorsPerFile int  `yaml:"max_authors_per_file"`
+	MaxReviewers      int  `yaml:"max_reviewers"`
+	RequestReviewers  bool `yaml:"request_reviewers"`
+}
+
+// CodeContextConfig controls the token budget of the code-files document
+type CodeContextConfig struct {
+	MaxTokens          int `yaml:"max_tokens"`
+	WholeFileMaxTokens int `yaml:"whole_file_max_tokens"`
+	RegionContextLines int `yaml:"region_context_lines"`
+}
+
+// TimeoutsConfig bounds each pipeline stage, in seconds. Zero disables the limit.
+type TimeoutsConfig struct {
+	CloneSeconds    int `yaml:"clone_seconds"`
+	AnalysisSeconds int `yaml:"analysis_seconds"`
+	LLMSeconds      int `yaml:"llm_seconds"`
+	TestsSeconds    int `yaml:"tests_seconds"`
+	PushSeconds     int `yaml:"push_seconds"`
+}
+
+// DependencyUpgradesConfig controls the scheduled dependency upgrade PRs
+type DependencyUpgradesConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	IntervalHours int      `yaml:"interval_hours"`
+	Ecosystems    []string `yaml:"ecosystems"` // "go", "npm", "pip"
+	BranchPrefix  string   `yaml:"branch_prefix"`
+	MaxPRsPerRun  int      `yaml:"max_prs_per_run"` // per repository
+}
+
+// JanitorConfig controls the scheduled cleanup of DevFlow pull requests and branches
+type JanitorConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	IntervalHours  int      `yaml:"interval_hours"`
+	GraceDays      int      `yaml:"grace_days"`      // merged or abandoned branches are kept this long
+	BranchPrefixes []string `yaml:"branch_prefixes"` // only branches with these prefixes are cleaned up
+}
+
+// BotConfig identifies DevFlow's own activity, so it does not react to events it caused
+type BotConfig struct {
+	Logins      []string `yaml:"logins"`      // accounts DevFlow acts as, besides the app's own <slug>[bot]
+	CommitName  string   `yaml:"commit_name"` // identity of the commits DevFlow makes with git
+	CommitEmail string   `yaml:"commit_email"`
+}
+
+// GitHubConfig controls how list calls to the GitHub API are paged and cached
+type GitHubConfig struct {
+	PerPage          int `yaml:"per_page"`           // items requested per page of a list call
+	ETagCacheEntries int `yaml:"etag_cache_entries"` // pages kept for conditional requests; 0 disables caching
+}
+
+// AuthConfig selects how DevFlow authenticates to GitHub. Mode "app" (the default) runs as a
+// GitHub App and receives webhooks. Mode "token" acts with a fine-grained personal access
+// token or an OAuth app user token, for developers who cannot install an app, and polls
+// Repos for labeled issues and slash commands instead.
+type AuthConfig struct {
+	Mode        string   `yaml:"mode"`      // app or token
+	TokenEnv    string   `yaml:"token_env"` // variable holding the token
+	APIURL      string   `yaml:"api_url"`
+	WebURL      string   `yaml:"web_url"` // where repositories are cloned from
+	Repos       []string `yaml:"repos"`   // owner/name of each repository to poll
+	PollSeconds int      `yaml:"poll_seconds"`
+}
+
+// ProvidersConfig connects hosts other than GitHub. Their webhooks arrive on a separate
+// listener, at /azure-devops and /bitbucket.
+type ProvidersConfig struct {
+	ListenAddr  string            `yaml:"listen_addr"`
+	AzureDevOps AzureDevOpsConfig `yaml:"azure_devops"`
+	Bitbucket   BitbucketConfig   `yaml:"bitbucket"`
+}
+
+// AzureDevOpsConfig connects an Azure DevOps organization. Work item tags act as labels, and
+// a work item is resolved in a repository of its project.
+type AzureDevOpsConfig struct {
+	Enabled            bool              `yaml:"enabled"`
+	BaseURL            string            `yaml:"base_url"` // https://dev.azure.com, or an Azure DevOps Server
+	Organization       string            `yaml:"organization"`
+	TokenEnv           string            `yaml:"token_env"`    // personal access token with Code and Work Items read & write
+	WebhookUser        string            `yaml:"webhook_user"` // basic auth configured on the service hooks
+	WebhookPasswordEnv string            `yaml:"webhook_password_env"`
+	Repositories       map[string]string `yaml:"repositories"` // project -> repository; defaults to the project's own name
+}
+
+// BitbucketConfig connects Bitbucket Cloud. An issue's component acts as its label.
+type BitbucketConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	APIURL    string `yaml:"api_url"`
+	WebURL    string `yaml:"web_url"`    // where repositories are cloned from
+	TokenEnv  string `yaml:"token_env"`  // repository or workspace access token
+	SecretEnv string `yaml:"secret_env"` // webhook secret
+}
+
+// KnowledgeBaseConfig controls how the .devflow knowledge base is written
+type KnowledgeBaseConfig struct {
+	// Deterministic keeps timestamps out of the documents (generation time and content hashes
+	// go to the meta file) and orders files by path, so rebuilds of unchanged content diff clean
+	Deterministic bool `yaml:"deterministic"`
+	// Files above LargeFileBytes go into repo-structure.md as their first and last ExcerptLines
+	// lines plus an outline of their declarations; 0 includes every file whole
+	LargeFileBytes int `yaml:"large_file_bytes"`
+	ExcerptLines   int `yaml:"excerpt_lines"`
+	// Symlinks is record (list links with their targets) or skip; links are never followed
+	Symlinks string `yaml:"symlinks"`
+	// RecurseSubmodules checks out and analyzes git submodules and nested repositories, listing
+	// their files under their path; otherwise they are only listed
+	RecurseSubmodules bool `yaml:"recurse_submodules"`
+	// GraphShardFiles is the number of files above which the dependency graph is written as one
+	// shard per top-level directory plus an index, so readers load only the shards they need;
+	// 0 never shards
+	GraphShardFiles int `yaml:"graph_shard_files"`
+	// ArchiveVersions is how many versions of the analysis and dependency graph are kept per
+	// repository in the store for the admin API's history and diffs; 0 disables the archive
+	ArchiveVersions int `yaml:"archive_versions"`
+	// SyncBranch carries the sync commit of repositories whose sync.publish policy opens a
+	// pull request; it is force-pushed, so one pull request stays open at a time
+	SyncBranch string `yaml:"sync_branch"`
+	// VerifyChecksums checks the documents against the checksums of snapshot-meta.json before
+	// a run, regenerating any that were edited by hand or corrupted
+	VerifyChecksums bool `yaml:"verify_checksums"`
+}
+
+// SecurityAlertsConfig controls remediation PRs for Dependabot / vulnerability alerts.
+// probot cannot parse these events, so they are received on a separate listener.
+type SecurityAlertsConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	ListenAddr   string   `yaml:"listen_addr"`
+	BranchPrefix string   `yaml:"branch_prefix"`
+	Severities   []string `yaml:"severities"` // alerts with other severities are ignored; empty accepts all
+	UseAgent     bool     `yaml:"use_agent"`  // let the agent fix code when no version bump applies or tests fail
+}
+
+// DiscussionsConfig triages feature proposals raised in GitHub Discussions and converts them
+// to issues. probot cannot parse discussion webhooks, so they get their own receiver.
+type DiscussionsConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	ListenAddr   string   `yaml:"listen_addr"`
+	Categories   []string `yaml:"categories"`    // triaged on creation; empty triages every category
+	ConvertLabel string   `yaml:"convert_label"` // labeling a discussion with it converts it to an issue
+	ResolveLabel string   `yaml:"resolve_label"` // converts it and starts the agent on the issue
+	IssueLabels  []string `yaml:"issue_labels"`  // added to every converted issue
+	// ResolveIssueLabel is the trigger label (one of issues.required_labels) put on issues to resolve
+	ResolveIssueLabel string `yaml:"resolve_issue_label"`
+}
+
+// ProjectsConfig keeps DevFlow PRs and their issues in step with a GitHub Project (v2) board
+// and milestones
+type ProjectsConfig struct {
+	Enabled          bool               `yaml:"enabled"`
+	InheritMilestone bool               `yaml:"inherit_milestone"` // PRs take their issue's milestone
+	Default          ProjectBoardConfig `yaml:"default"`
+	// Repos gives repositories ("owner/repo") their own board, replacing Default
+	Repos map[string]ProjectBoardConfig `yaml:"repos"`
+}
+
+// ProjectBoardConfig names a project and the status options DevFlow moves items to
+type ProjectBoardConfig struct {
+	ProjectID      string `yaml:"project_id"` // ProjectV2 node ID (PVT_...); empty disables the board
+	StatusField    string `yaml:"status_field"`
+	PROpenedStatus string `yaml:"pr_opened_status"` // the PR's item when DevFlow opens it
+	MergedStatus   string `yaml:"merged_status"`    // the issue's item when the PR merges
+}
+
+// Board returns the project board of a repository
+func (c ProjectsConfig) Board(repoName string) ProjectBoardConfig {
+	for repo, board := range c.Repos {
+		if strings.EqualFold(repo, repoName) {
+			return board
+		}
+	}
+	return c.Default
+}
+
+// StoreConfig selects where workflow runs and cross-worker locks are kept
+type StoreConfig struct {
+	Backend   string `yaml:"backend"` // "file" (default) or "redis"
+	Dir       string `yaml:"dir"`     // file backend
+	RedisURL  string `yaml:"redis_url"`
+	KeyPrefix string `yaml:"key_prefix"` // namespaces redis keys
+	// LockTTLSeconds is how long a lock survives a holder that stopped renewing it
+	LockTTLSeconds int `yaml:"lock_ttl_seconds"`
+	// IdempotencyTTLHours is how long a processed webhook delivery is remembered
+	IdempotencyTTLHours int `yaml:"idempotency_ttl_hours"`
+}
+
+// AdminConfig exposes the admin API (usage and experiment metrics); it authenticates with DEVFLOW_ADMIN_TOKEN
+type AdminConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	ListenAddr string `yaml:"listen_addr"`
+}
+
+// RunsAPIConfig exposes the versioned API CI systems and internal tools request runs through,
+// without labeling issues; it authenticates with the comma-separated keys in DEVFLOW_API_KEYS
+type RunsAPIConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	ListenAddr string `yaml:"listen_addr"`
+}
+
+// AuditConfig records every change the bot makes on the repository host (refs, commits, pull
+// requests, labels, comments and pushes) in the store's append-only audit log
+type AuditConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxValueBytes truncates longer strings, such as blob contents, in recorded inputs and
+	// responses; 0 keeps them whole
+	MaxValueBytes int `yaml:"max_value_bytes"`
+}
+
+// DeadLettersConfig retries issue runs that fail for transient reasons (model or agent
+// server errors, clone failures) and keeps the runs that still fail for inspection
+type DeadLettersConfig struct {
+	Enabled           bool `yaml:"enabled"`
+	MaxAttempts       int  `yaml:"max_attempts"`        // attempts per run, counting the first
+	RetryDelaySeconds int  `yaml:"retry_delay_seconds"` // wait before the first retry, doubled for each one after
+}
+
+// NotificationsConfig names the environment variables holding the chat webhooks operator
+// alerts are posted to; a webhook whose variable is unset is skipped
+type NotificationsConfig struct {
+	SlackWebhookEnv   string `yaml:"slack_webhook_env"`
+	DiscordWebhookEnv string `yaml:"discord_webhook_env"`
+}
+
+// RunWebhookConfig posts run lifecycle events (queued, started, pr_opened, failed) as JSON to
+// an external system such as a dashboard or incident tool
+type RunWebhookConfig struct {
+	URL       string   `yaml:"url"`
+	SecretEnv string   `yaml:"secret_env"` // signs the body (X-DevFlow-Signature-256); none are sent while it is unset
+	Events    []string `yaml:"events"`     // empty for every event
+	Repos     []string `yaml:"repos"`      // owner/name; empty for all
+}
+
+// PreviewsConfig has an external system deploy a preview of each pull request DevFlow opens
+// for an issue, by calling a webhook or running a command with the pull request's details.
+// A preview URL in the answer, or posted later to the admin API, is added to the PR body.
+type PreviewsConfig struct {
+	Enabled          bool     `yaml:"enabled"`
+	WebhookURL       string   `yaml:"webhook_url"`
+	WebhookSecretEnv string   `yaml:"webhook_secret_env"` // signs the webhook body (X-DevFlow-Signature-256)
+	Command          []string `yaml:"command"`            // program and arguments; gets the request on stdin
+	TimeoutSeconds   int      `yaml:"timeout_seconds"`
+	Repos            []string `yaml:"repos"` // owner/name of the repositories to preview; empty for all
+}
+
+// PluginConfig is an external program DevFlow runs at the hooks it subscribes to, sending a
+// JSON request on stdin and reading a JSON response from stdout. A plugin is either a Command
+// or a WASI Module run by Runtime, so organizations can add analyzers, policy checks and
+// post-processing without changing the agent.
+type PluginConfig struct {
+	Name           string         `yaml:"name"`
+	Command        []string       `yaml:"command"` // program and arguments
+	Module         string         `yaml:"module"`  // path of a .wasm module, used when command is empty
+	Runtime        []string       `yaml:"runtime"` // runs the module in the checkout; empty is [wasmtime, run, --dir=.]
+	Hooks          []string       `yaml:"hooks"`   // PluginHook* values
+	Repos          []string       `yaml:"repos"`   // owner/name; empty for all
+	TimeoutSeconds int            `yaml:"timeout_seconds"`
+	Settings       map[string]any `yaml:"settings"` // passed to the plugin in every request
+}
+
+// Hooks a plugin can subscribe to
+const (
+	PluginHookAnalyze     = "analyze"      // adds documents to the knowledge base
+	PluginHookPostProcess = "post_process" // rewrites the agent's changes, e.g. to format them
+	PluginHookPolicy      = "policy"       // checks the agent's changes before they are published
+)
+
+// PromptsConfig locates prompt template overrides. Files named like the embedded templates
+// (e.g. issue_analysis.tmpl) replace them; the rest keep the built-in version.
+type PromptsConfig struct {
+	Dir string `yaml:"dir"`
+}
+
+// Prompt slots an experiment can vary
+const (
+	SlotFileSelection  = "file_selection"
+	SlotCodeGeneration = "code_generation"
+)
+
+// ExperimentConfig is an A/B test of prompt variants for one slot. Each run is assigned a
+// variant by weight, unless its repository is pinned to one.
+type ExperimentConfig struct {
+	Name     string                `yaml:"name"`
+	Slot     string                `yaml:"slot"` // file_selection | code_generation
+	Variants []PromptVariantConfig `yaml:"variants"`
+	// Repos pins repositories ("owner/repo") to a variant by name
+	Repos map[string]string `yaml:"repos"`
+}
+
+// PromptVariantConfig is one arm of an experiment; its instructions are added to the slot's prompt
+type PromptVariantConfig struct {
+	Name         string `yaml:"name"`
+	Weight       int    `yaml:"weight"` // relative share of unpinned runs
+	Instructions string `yaml:"instructions"`
+}
+
+// LocalizationConfig controls how non-English issues are handled; the output language is
+// chosen per repository (RepoConfig.Language)
+type LocalizationConfig struct {
+	// TranslateForModel gives the agent an English translation of non-English issues
+	TranslateForModel bool `yaml:"translate_for_model"`
+}
+
+// DeploymentConfig describes the runtime environment
+type DeploymentConfig struct {
+	// Stateless requires every piece of state that must outlive the process to live outside
+	// the container: runs and locks in redis, clones on the scratch workspace
+	Stateless bool `yaml:"stateless"`
+}
+
+// NetworkConfig sets the outbound proxy and extra trusted CAs. Empty proxy fields fall back
+// to HTTPS_PROXY/HTTP_PROXY/NO_PROXY from the environment.
+type NetworkConfig struct {
+	HTTPSProxy string `yaml:"https_proxy"`
+	HTTPProxy  string `yaml:"http_proxy"`
+	NoProxy    string `yaml:"no_proxy"`
+	CABundle   string `yaml:"ca_bundle"` // PEM file trusted in addition to the system roots; defaults to DEVFLOW_CA_BUNDLE
+}
+
+// QueueConfig splits webhook reception and processing across processes. In "inline" mode
+// (the default) probot receives and handles webhooks itself; "receiver" validates and
+// publishes them to the backend; "worker" consumes and handles them.
+type QueueConfig struct {
+	Mode       string      `yaml:"mode"`        // inline, receiver or worker
+	Backend    string      `yaml:"backend"`     // sqs, nats or kafka
+	ListenAddr string      `yaml:"listen_addr"` // receiver mode
+	Workers    int         `yaml:"workers"`     // concurrent consumers per worker process
+	SQS        SQSConfig   `yaml:"sqs"`
+	NATS       NATSConfig  `yaml:"nats"`
+	Kafka      KafkaConfig `yaml:"kafka"`
+}
+
+// SQSConfig locates the SQS queue; credentials come from the AWS_* environment variables
+type SQSConfig struct {
+	QueueURL                 string `yaml:"queue_url"`
+	Region                   string `yaml:"region"`
+	Endpoint                 string `yaml:"endpoint"` // optional, e.g. for LocalStack
+	WaitSeconds              int    `yaml:"wait_seconds"`
+	VisibilityTimeoutSeconds int    `yaml:"visibility_timeout_seconds"`
+}
+
+// NATSConfig locates the NATS subject; workers share QueueGroup
+type NATSConfig struct {
+	URL        string `yaml:"url"`
+	Subject    string `yaml:"subject"`
+	QueueGroup string `yaml:"queue_group"`
+}
+
+// KafkaConfig reaches Kafka through a REST Proxy
+type KafkaConfig struct {
+	RESTProxyURL  string `yaml:"rest_proxy_url"`
+	Topic         string `yaml:"topic"`
+	ConsumerGroup string `yaml:"consumer_group"`
 }
 
 // DebugConfig contains debug-related configuration
@@ -67,10 +588,35 @@ type DebugConfig struct {
 	CreateDebugFiles bool `yaml:"create_debug_files"`
 }
 
+// LoggingConfig sets the log output. Format is "text" or "json"; level is "debug", "info",
+// "warn" or "error". RedactPatterns are regular expressions masked in every log line, on top
+// of the built-in ones for keys, tokens and Authorization headers.
+type LoggingConfig struct {
+	Format         string   `yaml:"format"`
+	Level          string   `yaml:"level"`
+	RedactPatterns []string `yaml:"redact_patterns"`
+}
+
 // PullRequestsConfig contains PR-related configuration
 type PullRequestsConfig struct {
-	Installation    PRTemplateConfig `yaml:"installation"`
-	IssueResolution PRTemplateConfig `yaml:"issue_resolution"`
+	Installation    PRTemplateConfig   `yaml:"installation"`
+	IssueResolution PRTemplateConfig   `yaml:"issue_resolution"`
+	Duplicates      DuplicatePRsConfig `yaml:"duplicates"`
+	Body            PRBodyConfig       `yaml:"body"`
+}
+
+// PRBodyConfig bounds the descriptions DevFlow writes. Text beyond MaxChars is collapsed into
+// a <details> section, or posted as comments when it does not fit GitHub's limit even then.
+type PRBodyConfig struct {
+	MaxChars int `yaml:"max_chars"` // 0 keeps up to GitHub's limit of 65536 in view
+}
+
+// DuplicatePRsConfig controls the check for an equivalent open DevFlow PR before a new one
+// is opened, e.g. when an issue is relabeled or rephrased
+type DuplicatePRsConfig struct {
+	Enabled        bool    `yaml:"enabled"`
+	MinPathOverlap float64 `yaml:"min_path_overlap"` // share of changed paths in common (Jaccard index)
+	MinSimilarity  float64 `yaml:"min_similarity"`   // cosine similarity of the summary embeddings
 }
 
 // PRTemplateConfig contains PR template configuration
@@ -84,28 +630,74 @@ type FilesConfig struct {
 	StructureFile      string `yaml:"structure_file"`
 	AnalysisFile       string `yaml:"analysis_file"`
 	AnalysisPromptFile string `yaml:"analysis_prompt_file"`
+	AnalysisIndexFile  string `yaml:"analysis_index_file"`
 	MetadataFile       string `yaml:"metadata_file"`
 	DependencyFile     string `yaml:"dependency_file"`
+	CallGraphFile      string `yaml:"call_graph_file"`
 	ReadmeFile         string `yaml:"readme_file"`
 	SummaryFile        string `yaml:"summary_file"`
+	CodeFilesFile      string `yaml:"code_files_file"`
+	InfrastructureFile string `yaml:"infrastructure_file"`
+	APISurfaceFile     string `yaml:"api_surface_file"`
+	MetaFile           string `yaml:"meta_file"`
 }
 
-var globalConfig *Config
+var (
+	configMu     sync.RWMutex
+	globalConfig *Config
+	configPath   string
+)
 
-// LoadConfig loads configuration from the specified file
-func LoadConfig(configPath string) (*Config, error) {
+// LoadConfig loads configuration from the specified file and makes it the global configuration
+func LoadConfig(path string) (*Config, error) {
 	// If no path provided, use default
-	if configPath == "" {
-		configPath = "config/development.yaml"
+	if path == "" {
+		path = "config/development.yaml"
+	}
+
+	config, err := readConfig(path)
+	if err != nil {
+		return nil, err
 	}
 
+	// Set global config
+	configMu.Lock()
+	globalConfig = config
+	configPath = path
+	configMu.Unlock()
+
+	return config, nil
+}
+
+// Use makes c the global configuration without changing the file Reload reads, for callers
+// that derive their settings from a loaded file (e.g. the local development harness)
+func Use(c *Config) {
+	configMu.Lock()
+	globalConfig = c
+	configMu.Unlock()
+}
+
+// Reload re-reads the file the configuration was loaded from and atomically replaces the
+// global configuration. Callers holding the previous *Config keep a consistent snapshot.
+func Reload() (*Config, error) {
+	configMu.RLock()
+	path := configPath
+	configMu.RUnlock()
+	if path == "" {
+		return nil, fmt.Errorf("configuration was never loaded")
+	}
+	return LoadConfig(path)
+}
+
+// readConfig parses a configuration file without touching the global configuration
+func readConfig(path string) (*Config, error) {
 	// Check if file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("config file not found: %s", configPath)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("config file not found: %s", path)
 	}
 
 	// Read the config file
-	data, err := os.ReadFile(configPath)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
@@ -115,26 +707,121 @@ func LoadConfig(configPath string) (*Config, error) {
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	if err := config.applyDeployment(); err != nil {
+		return nil, err
+	}
+	if err := config.validateExperiments(); err != nil {
+		return nil, err
+	}
+	if err := config.validatePlugins(); err != nil {
+		return nil, err
+	}
+	if len(config.Pipeline.Stages) == 0 {
+		config.Pipeline.Stages = defaultPipelineStages()
+	}
+	if err := config.Pipeline.Validate(); err != nil {
+		return nil, fmt.Errorf("pipeline: %w", err)
+	}
+	return &config, nil
+}
 
-	// Set global config
-	globalConfig = &config
+// applyDeployment checks that a stateless deployment keeps no state on the container's disk
+// and forces the settings it implies
+func (c *Config) applyDeployment() error {
+	if !c.Deployment.Stateless {
+		return nil
+	}
+	if c.Store.Backend != "redis" || c.Store.RedisURL == "" {
+		return fmt.Errorf("deployment.stateless requires store.backend redis with store.redis_url")
+	}
+	if c.Repository.WorkspaceDir == "" {
+		return fmt.Errorf("deployment.stateless requires repository.workspace_dir (a scratch volume)")
+	}
+	// Clones are scratch: never leave them behind, and only cache mirrors on the scratch volume
+	c.Repository.CleanupTempRepos = true
+	if c.Repository.MirrorCacheDir != "" {
+		rel, err := filepath.Rel(c.Repository.WorkspaceDir, c.Repository.MirrorCacheDir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("deployment.stateless requires repository.mirror_cache_dir to be inside repository.workspace_dir")
+		}
+	}
+	return nil
+}
 
-	return &config, nil
+// validateExperiments rejects experiments that could not assign a variant
+func (c *Config) validateExperiments() error {
+	names := make(map[string]bool)
+	for _, exp := range c.Experiments {
+		if exp.Name == "" || names[exp.Name] {
+			return fmt.Errorf("experiment names must be unique and non-empty: %q", exp.Name)
+		}
+		names[exp.Name] = true
+		if exp.Slot != SlotFileSelection && exp.Slot != SlotCodeGeneration {
+			return fmt.Errorf("experiment %s: unknown slot %q", exp.Name, exp.Slot)
+		}
+		variants := make(map[string]bool)
+		total := 0
+		for _, v := range exp.Variants {
+			if v.Name == "" || variants[v.Name] || v.Weight < 0 {
+				return fmt.Errorf("experiment %s: invalid variant %q", exp.Name, v.Name)
+			}
+			variants[v.Name] = true
+			total += v.Weight
+		}
+		if total == 0 {
+			return fmt.Errorf("experiment %s: variants need a positive total weight", exp.Name)
+		}
+		for repo, v := range exp.Repos {
+			if !variants[v] {
+				return fmt.Errorf("experiment %s: %s is pinned to unknown variant %q", exp.Name, repo, v)
+			}
+		}
+	}
+	return nil
+}
+
+// validatePlugins rejects plugins that could not be run or subscribe to unknown hooks
+func (c *Config) validatePlugins() error {
+	names := make(map[string]bool)
+	for _, p := range c.Plugins {
+		if p.Name == "" || names[p.Name] {
+			return fmt.Errorf("plugin names must be unique and non-empty: %q", p.Name)
+		}
+		names[p.Name] = true
+		if (len(p.Command) == 0) == (p.Module == "") {
+			return fmt.Errorf("plugin %s: set exactly one of command and module", p.Name)
+		}
+		if len(p.Hooks) == 0 {
+			return fmt.Errorf("plugin %s: no hooks", p.Name)
+		}
+		for _, h := range p.Hooks {
+			if h != PluginHookAnalyze && h != PluginHookPostProcess && h != PluginHookPolicy {
+				return fmt.Errorf("plugin %s: unknown hook %q", p.Name, h)
+			}
+		}
+	}
+	return nil
 }
 
-// GetConfig returns the global configuration instance
+// GetConfig returns the current global configuration. The returned value is shared and
+// must be treated as read-only; LoadConfig must have been called first.
 func GetConfig() *Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
 	if globalConfig == nil {
-		// Try to load default config
-		config, err := LoadConfig("")
-		if err != nil {
-			panic(fmt.Sprintf("Failed to load configuration: %v", err))
-		}
-		return config
+		panic("configuration not loaded: call config.LoadConfig first")
 	}
 	return globalConfig
 }
 
+// StageContext derives a context for a pipeline stage limited to the given number of seconds
+func StageContext(parent context.Context, seconds int) (context.Context, context.CancelFunc) {
+	if seconds <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, time.Duration(seconds)*time.Second)
+}
+
 // GetDevflowPath returns the full path to a devflow file
 func (c *Config) GetDevflowPath(repoPath, fileName string) string {
 	return filepath.Join(repoPath, c.Repository.DevflowDirectory, fileName)
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PipelineFile is the path, relative to the repository root, of a repository's agent pipeline
+const PipelineFile = ".devflow-agent/pipeline.yaml"
+
+// Stages of an agent pipeline, in the order they run
+const (
+	StageTriage       = "triage"        // ask for details when the issue is too thin to work on
+	StageAnalyze      = "analyze"       // give the agent the knowledge base's context for the issue
+	StagePlanApproval = "plan-approval" // post the plan and wait for a reviewer's label
+	StageGenerate     = "generate"      // have the agent change the code
+	StageTest         = "test"          // run the tests on the agent's changes
+	StagePR           = "pr"            // open the pull request
+)
+
+// PipelineStages lists every stage in the order the supervisor runs them
+var PipelineStages = []string{StageTriage, StageAnalyze, StagePlanApproval, StageGenerate, StageTest, StagePR}
+
+// PipelineConfig selects the stages an issue run goes through, so a team can decide how
+// much of the work DevFlow does on its own. Stages run in the order of PipelineStages
+// whatever order they are listed in; generate is always required. Without pr, the agent's
+// changes are posted on the issue as a plan instead of a pull request.
+type PipelineConfig struct {
+	Stages []PipelineStage `yaml:"stages"`
+}
+
+// PipelineStage is one stage of a pipeline with the settings that apply to it
+type PipelineStage struct {
+	Name string `yaml:"name"`
+	// triage: issues whose body is shorter than this get a comment asking for details
+	MinBodyChars int `yaml:"min_body_chars,omitempty"`
+	// plan-approval: the label a reviewer adds to approve the plan, and who is asked to
+	Label     string   `yaml:"label,omitempty"`
+	Reviewers []string `yaml:"reviewers,omitempty"`
+	// test: the command run in the repository; empty uses agent.test_command
+	Command        string `yaml:"command,omitempty"`
+	TimeoutSeconds int    `yaml:"timeout_seconds,omitempty"` // 0 uses timeouts.tests_seconds
+	OnFailure      string `yaml:"on_failure,omitempty"`      // "block" keeps failing changes off a pull request, "note" reports them in it
+}
+
+// defaultPipelineStages is the pipeline of a configuration without one: DevFlow works an
+// issue from the knowledge base to a pull request on its own
+func defaultPipelineStages() []PipelineStage {
+	return []PipelineStage{{Name: StageAnalyze}, {Name: StageGenerate}, {Name: StagePR}}
+}
+
+// Has reports whether the pipeline runs the named stage
+func (p *PipelineConfig) Has(name string) bool {
+	return p.Stage(name) != nil
+}
+
+// Stage returns the named stage's settings, or nil when the pipeline skips it
+func (p *PipelineConfig) Stage(name string) *PipelineStage {
+	for i := range p.Stages {
+		if p.Stages[i].Name == name {
+			return &p.Stages[i]
+		}
+	}
+	return nil
+}
+
+// Validate checks the stage names and fills in the defaults of their settings
+func (p *PipelineConfig) Validate() error {
+	seen := make(map[string]bool, len(p.Stages))
+	for i := range p.Stages {
+		s := &p.Stages[i]
+		if !slices.Contains(PipelineStages, s.Name) {
+			return fmt.Errorf("unknown pipeline stage %q, expected one of %v", s.Name, PipelineStages)
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("pipeline stage %q is listed twice", s.Name)
+		}
+		seen[s.Name] = true
+		switch s.Name {
+		case StageTriage:
+			if s.MinBodyChars <= 0 {
+				s.MinBodyChars = 30
+			}
+		case StagePlanApproval:
+			if s.Label == "" {
+				s.Label = "devflow-plan-approved"
+			}
+		case StageTest:
+			switch s.OnFailure {
+			case "":
+				s.OnFailure = "block"
+			case "block", "note":
+			default:
+				return fmt.Errorf("pipeline stage test: on_failure must be block or note, not %q", s.OnFailure)
+			}
+		}
+	}
+	if !seen[StageGenerate] {
+		return fmt.Errorf("pipeline must include the %s stage", StageGenerate)
+	}
+	return nil
+}
+
+// ParsePipeline parses a repository's pipeline. Empty data yields the global pipeline.
+func ParsePipeline(data []byte) (*PipelineConfig, error) {
+	pipeline := &PipelineConfig{}
+	if len(data) > 0 {
+		if err := yaml.Unmarshal(data, pipeline); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", PipelineFile, err)
+		}
+	}
+	if len(pipeline.Stages) == 0 {
+		pipeline.Stages = append([]PipelineStage{}, GetConfig().Pipeline.Stages...)
+	}
+	if len(pipeline.Stages) == 0 {
+		pipeline.Stages = defaultPipelineStages()
+	}
+	if err := pipeline.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", PipelineFile, err)
+	}
+	return pipeline, nil
+}
+
+// LoadPipeline reads a repository's pipeline from a local checkout. A missing file yields the
+// global pipeline.
+func LoadPipeline(repoPath string) (*PipelineConfig, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, PipelineFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", PipelineFile, err)
+	}
+	return ParsePipeline(data)
+}
@@ -0,0 +1,312 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RepoConfigFile is the path, relative to the repository root, of per-repo settings
+const RepoConfigFile = ".devflow-agent/config.yaml"
+
+// RepoConfig represents settings a repository can define for itself
+type RepoConfig struct {
+	Paths PathPolicyConfig `yaml:"paths"`
+	// Language is the language of PR text and status comments: a code such as "ja", or
+	// "auto" to answer in the language each issue is written in. Empty means English.
+	Language string `yaml:"language"`
+	// Sync decides which pushes to the default branch refresh the knowledge base
+	Sync SyncPolicyConfig `yaml:"sync"`
+	// Issues narrows the labeled issues the agent works on
+	Issues IssueFilterConfig `yaml:"issues"`
+	// Schedule limits when and how often the agent works on the repository's issues
+	Schedule ScheduleConfig `yaml:"schedule"`
+	// Limits bounds what a single agent run may change
+	Limits ChangeLimitsConfig `yaml:"limits"`
+	// AI overrides the global generation settings for the repository's agent runs
+	AI RepoAIConfig `yaml:"ai"`
+	// Links decides how pull requests link the issues they resolve
+	Links IssueLinksConfig `yaml:"links"`
+	// Escalation hands runs the agent is unsure about to a human
+	Escalation EscalationConfig `yaml:"escalation"`
+	// Merge decides whether the pull requests DevFlow opens merge themselves
+	Merge MergeConfig `yaml:"merge"`
+	// Notifications decides where the repository hears about the pull requests DevFlow opens
+	Notifications RepoNotificationsConfig `yaml:"notifications"`
+	// Events turns off the webhook events the repository does not want DevFlow to act on
+	Events EventPolicyConfig `yaml:"events"`
+	// LicenseHeaders puts the repository's license header on the files the agent creates
+	LicenseHeaders LicenseHeaderConfig `yaml:"license_headers"`
+	// GeneratedFiles keeps the agent from editing generated code by hand
+	GeneratedFiles GeneratedFilesConfig `yaml:"generated_files"`
+}
+
+// GeneratedFilesConfig decides what happens to the agent's edits of generated files (.pb.go,
+// files marked DO NOT EDIT, mocks, minified bundles): with Protect they are discarded and the
+// pull request points at the source to change instead
+type GeneratedFilesConfig struct {
+	Protect *bool `yaml:"protect"` // a pointer so repositories can turn the default off
+}
+
+// LicenseHeaderConfig puts a license header at the top of the files the agent creates: Header,
+// commented for the file's type and with {year} replaced by the current year, or else the
+// header most existing files of the same type start with. With Required, new files that take
+// a header but still lack one block the commit.
+type LicenseHeaderConfig struct {
+	Enabled  *bool  `yaml:"enabled"` // a pointer so repositories can turn the default off
+	Header   string `yaml:"header"`  // without comment markers; empty detects it from existing files
+	Required bool   `yaml:"required"`
+}
+
+// EventPolicyConfig lists the webhook events DevFlow acts on for the repository, as an event
+// name ("push", "pull_request_review") or an event and action ("pull_request.closed"). An
+// empty Allow list permits every event not matched by Deny. Events that are turned off are
+// dropped before anything is cloned or generated.
+type EventPolicyConfig struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// Allows reports whether the policy lets DevFlow act on an event with the given action
+func (p EventPolicyConfig) Allows(event, action string) bool {
+	matches := func(entry string) bool {
+		name, act, ok := strings.Cut(entry, ".")
+		return name == event && (!ok || act == action)
+	}
+	if slices.ContainsFunc(p.Deny, matches) {
+		return false
+	}
+	return len(p.Allow) == 0 || slices.ContainsFunc(p.Allow, matches)
+}
+
+// RepoNotificationsConfig posts a message to the chat webhook of Channel, one of the
+// NotifyChannel values, whenever DevFlow opens a pull request for one of the repository's
+// issues. The webhooks are the ones configured under notifications.
+type RepoNotificationsConfig struct {
+	Channel string `yaml:"channel"`
+}
+
+// Values of notifications.channel
+const (
+	NotifyChannelIssue   = "issue"   // comments on the issue only
+	NotifyChannelSlack   = "slack"   // also the Slack webhook
+	NotifyChannelDiscord = "discord" // also the Discord webhook
+)
+
+// MergeConfig turns on GitHub auto-merge for DevFlow's pull requests with Method ("squash",
+// "merge" or "rebase"), so they merge once the base branch's required checks and reviews pass.
+// With MinApprovals, auto-merge is only turned on once that many reviewers approved. When the
+// repository does not allow auto-merge, the pull request gets a comment and waits for a person.
+type MergeConfig struct {
+	Method       string `yaml:"method"`        // empty leaves merging to people
+	MinApprovals int    `yaml:"min_approvals"` // on top of what branch protection requires
+	DeleteBranch *bool  `yaml:"delete_branch"` // a pointer so repositories can turn the default off
+}
+
+// EscalationConfig turns a run scored below MinConfidence into a plan posted on the issue
+// instead of pull requests, and asks Reviewers to take it from there. The score is the lowest
+// confidence, from 0 to 1, the planner and the agent report; a run with no score is never
+// escalated. MinConfidence is a pointer so repositories can set 0 to turn escalation off.
+type EscalationConfig struct {
+	MinConfidence *float64 `yaml:"min_confidence"`
+	Reviewers     []string `yaml:"reviewers"` // logins mentioned on the plan
+}
+
+// IssueLinksConfig decides how a pull request links the issue it resolves and, when
+// SubIssues is set, the issue's open sub-issues and unchecked task list items. Keyword
+// "closes" closes them on merge; "refs" only links them, for teams that close issues by hand.
+type IssueLinksConfig struct {
+	Keyword   string `yaml:"keyword"`    // "closes" or "refs"
+	SubIssues *bool  `yaml:"sub_issues"` // a pointer so repositories can turn the default off
+}
+
+// RepoAIConfig overrides the global ai settings for one repository. Unset or zero fields keep
+// the global values; Temperature is a pointer because 0 is a meaningful choice. Overrides are
+// checked against the limits of every configured model before the agent runs.
+type RepoAIConfig struct {
+	Temperature     *float32 `yaml:"temperature"`
+	MaxOutputTokens int32    `yaml:"max_output_tokens"`  // the agent's responses, which carry the code
+	PRBodyMaxTokens int32    `yaml:"pr_body_max_tokens"` // the pull request description
+}
+
+// ChangeLimitsConfig bounds the changes of one agent run. Deleted files the issue does not
+// name and new binary files are always discarded. Changes above MaxBytes are refused; changes
+// above ConfirmFiles or ConfirmLines only get a pull request once the issue has ConfirmLabel.
+type ChangeLimitsConfig struct {
+	MaxBytes     int64  `yaml:"max_bytes"`     // total size of the changed files; 0 is unlimited
+	ConfirmFiles int    `yaml:"confirm_files"` // 0 never asks
+	ConfirmLines int    `yaml:"confirm_lines"` // added plus removed lines; 0 never asks
+	ConfirmLabel string `yaml:"confirm_label"`
+}
+
+// ScheduleConfig keeps the agent to working hours and a daily budget. Triggers outside the
+// working hours, or beyond MaxRunsPerDay, are held and run once the schedule allows.
+type ScheduleConfig struct {
+	Timezone      string   `yaml:"timezone"`         // IANA name, e.g. Europe/Berlin; empty is UTC
+	WorkingHours  string   `yaml:"working_hours"`    // e.g. "09:00-18:00"; empty is any time
+	WorkingDays   []string `yaml:"working_days"`     // e.g. [mon, tue, wed, thu, fri]; empty is every day
+	MaxRunsPerDay int      `yaml:"max_runs_per_day"` // 0 is unlimited
+}
+
+// IssueFilterConfig scopes the agent beyond the required labels. An issue must match every
+// non-empty list: one of Labels, which narrows the required labels to the ones the repository
+// uses, a title regex, an author (a login, or @org/team-slug for a team's members) and a
+// milestone title. Issues with any of ExcludeLabels are always skipped.
+type IssueFilterConfig struct {
+	Labels        []string `yaml:"labels"`
+	TitlePatterns []string `yaml:"title_patterns"`
+	Authors       []string `yaml:"authors"`
+	Milestones    []string `yaml:"milestones"`
+	ExcludeLabels []string `yaml:"exclude_labels"`
+}
+
+// SyncPolicyConfig lists glob patterns (with ** support) of paths whose changes alone never
+// trigger a knowledge base sync. The knowledge base directory is always ignored. An empty
+// Ignore list uses the global defaults. Publish decides how a synced knowledge base reaches
+// the default branch, one of the SyncPublish policies.
+type SyncPolicyConfig struct {
+	Ignore  []string `yaml:"ignore"`
+	Publish string   `yaml:"publish"`
+}
+
+// Policies of sync.publish
+const (
+	SyncPublishDirect    = "direct"        // push the sync commit straight to the default branch
+	SyncPublishAutoMerge = "pr_auto_merge" // open a pull request that merges once checks pass
+	SyncPublishPR        = "pr"            // open a pull request for a maintainer to review
+	SyncPublishExternal  = "external"      // keep the knowledge base in the store only
+)
+
+// PathPolicyConfig lists glob patterns (with ** support) the agent may or may not modify.
+// An empty Allow list permits every path not matched by Deny.
+type PathPolicyConfig struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// ParseRepoConfig parses per-repo settings and merges them over the global defaults
+func ParseRepoConfig(data []byte) (*RepoConfig, error) {
+	repoCfg := &RepoConfig{}
+	if len(data) > 0 {
+		if err := yaml.Unmarshal(data, repoCfg); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", RepoConfigFile, err)
+		}
+	}
+
+	// Global deny patterns always apply; repos can only add to them
+	defaults := GetConfig().RepoDefaults
+	repoCfg.Paths.Deny = append(append([]string{}, defaults.Paths.Deny...), repoCfg.Paths.Deny...)
+	if len(repoCfg.Paths.Allow) == 0 {
+		repoCfg.Paths.Allow = append([]string{}, defaults.Paths.Allow...)
+	}
+	if repoCfg.Language == "" {
+		repoCfg.Language = defaults.Language
+	}
+	if len(repoCfg.Sync.Ignore) == 0 {
+		repoCfg.Sync.Ignore = append([]string{}, defaults.Sync.Ignore...)
+	}
+	if repoCfg.Sync.Publish == "" {
+		repoCfg.Sync.Publish = defaults.Sync.Publish
+	}
+	// Like deny patterns, global exclude labels always apply
+	repoCfg.Issues.ExcludeLabels = append(append([]string{}, defaults.Issues.ExcludeLabels...), repoCfg.Issues.ExcludeLabels...)
+	if len(repoCfg.Issues.Labels) == 0 {
+		repoCfg.Issues.Labels = append([]string{}, defaults.Issues.Labels...)
+	}
+	if len(repoCfg.Issues.TitlePatterns) == 0 {
+		repoCfg.Issues.TitlePatterns = append([]string{}, defaults.Issues.TitlePatterns...)
+	}
+	if len(repoCfg.Issues.Authors) == 0 {
+		repoCfg.Issues.Authors = append([]string{}, defaults.Issues.Authors...)
+	}
+	if len(repoCfg.Issues.Milestones) == 0 {
+		repoCfg.Issues.Milestones = append([]string{}, defaults.Issues.Milestones...)
+	}
+	if repoCfg.Schedule.Timezone == "" {
+		repoCfg.Schedule.Timezone = defaults.Schedule.Timezone
+	}
+	if repoCfg.Schedule.WorkingHours == "" {
+		repoCfg.Schedule.WorkingHours = defaults.Schedule.WorkingHours
+	}
+	if len(repoCfg.Schedule.WorkingDays) == 0 {
+		repoCfg.Schedule.WorkingDays = append([]string{}, defaults.Schedule.WorkingDays...)
+	}
+	if repoCfg.Schedule.MaxRunsPerDay == 0 {
+		repoCfg.Schedule.MaxRunsPerDay = defaults.Schedule.MaxRunsPerDay
+	}
+	if repoCfg.Limits.MaxBytes == 0 {
+		repoCfg.Limits.MaxBytes = defaults.Limits.MaxBytes
+	}
+	if repoCfg.Limits.ConfirmFiles == 0 {
+		repoCfg.Limits.ConfirmFiles = defaults.Limits.ConfirmFiles
+	}
+	if repoCfg.Limits.ConfirmLines == 0 {
+		repoCfg.Limits.ConfirmLines = defaults.Limits.ConfirmLines
+	}
+	if repoCfg.Limits.ConfirmLabel == "" {
+		repoCfg.Limits.ConfirmLabel = defaults.Limits.ConfirmLabel
+	}
+	if repoCfg.AI.Temperature == nil {
+		repoCfg.AI.Temperature = defaults.AI.Temperature
+	}
+	if repoCfg.AI.MaxOutputTokens == 0 {
+		repoCfg.AI.MaxOutputTokens = defaults.AI.MaxOutputTokens
+	}
+	if repoCfg.AI.PRBodyMaxTokens == 0 {
+		repoCfg.AI.PRBodyMaxTokens = defaults.AI.PRBodyMaxTokens
+	}
+	if repoCfg.Links.Keyword == "" {
+		repoCfg.Links.Keyword = defaults.Links.Keyword
+	}
+	if repoCfg.Links.SubIssues == nil {
+		repoCfg.Links.SubIssues = defaults.Links.SubIssues
+	}
+	if repoCfg.Escalation.MinConfidence == nil {
+		repoCfg.Escalation.MinConfidence = defaults.Escalation.MinConfidence
+	}
+	if len(repoCfg.Escalation.Reviewers) == 0 {
+		repoCfg.Escalation.Reviewers = append([]string{}, defaults.Escalation.Reviewers...)
+	}
+	if repoCfg.Merge.Method == "" {
+		repoCfg.Merge.Method = defaults.Merge.Method
+	}
+	if repoCfg.Merge.MinApprovals == 0 {
+		repoCfg.Merge.MinApprovals = defaults.Merge.MinApprovals
+	}
+	if repoCfg.Merge.DeleteBranch == nil {
+		repoCfg.Merge.DeleteBranch = defaults.Merge.DeleteBranch
+	}
+	if repoCfg.Notifications.Channel == "" {
+		repoCfg.Notifications.Channel = defaults.Notifications.Channel
+	}
+	if repoCfg.LicenseHeaders.Enabled == nil {
+		repoCfg.LicenseHeaders.Enabled = defaults.LicenseHeaders.Enabled
+	}
+	if repoCfg.LicenseHeaders.Header == "" {
+		repoCfg.LicenseHeaders.Header = defaults.LicenseHeaders.Header
+	}
+	// Like path deny patterns, a globally required header stays required
+	repoCfg.LicenseHeaders.Required = repoCfg.LicenseHeaders.Required || defaults.LicenseHeaders.Required
+	if repoCfg.GeneratedFiles.Protect == nil {
+		repoCfg.GeneratedFiles.Protect = defaults.GeneratedFiles.Protect
+	}
+	// Like path deny patterns, globally denied events stay off
+	repoCfg.Events.Deny = append(append([]string{}, defaults.Events.Deny...), repoCfg.Events.Deny...)
+	if len(repoCfg.Events.Allow) == 0 {
+		repoCfg.Events.Allow = append([]string{}, defaults.Events.Allow...)
+	}
+	return repoCfg, nil
+}
+
+// LoadRepoConfig reads per-repo settings from a local checkout. A missing file yields the defaults.
+func LoadRepoConfig(repoPath string) (*RepoConfig, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, RepoConfigFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", RepoConfigFile, err)
+	}
+	return ParseRepoConfig(data)
+}
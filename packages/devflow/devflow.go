@@ -0,0 +1,200 @@
+// Package devflow embeds the DevFlow pipeline in other Go services. It works on local git
+// checkouts without the webhook server or GitHub App credentials: building a repository's
+// knowledge base, resolving an issue into working tree changes and syncing the knowledge base
+// to a commit. Nothing is committed or pushed; callers publish the results their own way.
+//
+// The configuration is process-wide, so every Client of a process shares the one it was
+// last created with.
+package devflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/handlers"
+	"devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+)
+
+// Options configure a Client
+type Options struct {
+	// Config is used as is; without one the file at ConfigPath is loaded, or
+	// config/development.yaml when it is empty
+	Config     *config.Config
+	ConfigPath string
+	// Agent resolves issues in place of the engine the configuration names, e.g. a stub in
+	// tests or an agent of the embedding service
+	Agent ai.Agent
+}
+
+// Client runs the pipeline
+type Client struct {
+	agent ai.Agent
+}
+
+// New returns a Client, loading the configuration unless Options.Config is set
+func New(opts Options) (*Client, error) {
+	if opts.Config != nil {
+		config.Use(opts.Config)
+	} else if _, err := config.LoadConfig(opts.ConfigPath); err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	return &Client{agent: opts.Agent}, nil
+}
+
+// Repo is a local git checkout
+type Repo struct {
+	Path string
+	// Name is the repository's owner/name and URL its clone URL; both label the knowledge base
+	// and are taken from the origin remote when empty
+	Name string
+	URL  string
+}
+
+// resolve returns the absolute checkout path with the repository's name and URL filled in
+func (r Repo) resolve() (Repo, error) {
+	path, err := filepath.Abs(r.Path)
+	if err != nil {
+		return r, err
+	}
+	if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+		return r, fmt.Errorf("%s is not a git checkout", path)
+	}
+	r.Path = path
+	if r.URL == "" {
+		r.URL = path
+		if out, err := exec.Command("git", "-C", path, "remote", "get-url", "origin").Output(); err == nil {
+			r.URL = strings.TrimSpace(string(out))
+		}
+	}
+	if r.Name == "" {
+		r.Name = "local/" + filepath.Base(path)
+		if name, ok := repository.RepoNameFromURL(r.URL); ok && r.URL != path {
+			r.Name = name
+		}
+	}
+	return r, nil
+}
+
+// InitKnowledgeBaseOptions configure Client.InitKnowledgeBase
+type InitKnowledgeBaseOptions struct {
+	Repo Repo
+	// Progress, if not nil, is called with the name of each stage as it starts; the stages are
+	// listed in repository.KBStages
+	Progress func(stage string)
+}
+
+// InitKnowledgeBase builds a checkout's .devflow knowledge base and returns the files it
+// wrote
+func (c *Client) InitKnowledgeBase(ctx context.Context, opts InitKnowledgeBaseOptions) ([]string, error) {
+	repo, err := opts.Repo.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return repository.BuildKnowledgeBase(ctx, repo.Path, repo.URL, repo.Name, opts.Progress)
+}
+
+// Issue is the issue to resolve
+type Issue struct {
+	Number int
+	Title  string
+	Body   string
+	Labels []string
+}
+
+// ResolveIssueOptions configure Client.ResolveIssue
+type ResolveIssueOptions struct {
+	Repo  Repo
+	Issue Issue
+}
+
+// ResolveIssueResult is what the agent did to the working tree
+type ResolveIssueResult struct {
+	Summary      string
+	ChangedFiles []string
+	Operations   []ai.FileOperation // deletions and renames among ChangedFiles
+	Model        string
+	// PlanConfidence and Confidence are the agent's confidence, from 0 to 1, in its plan and
+	// its changes; nil when it reported none
+	PlanConfidence *float64
+	Confidence     *float64
+}
+
+// ResolveIssue runs the agent on an issue and leaves its changes in the checkout's working
+// tree. The checkout needs a knowledge base; changes its path policy forbids are reverted.
+func (c *Client) ResolveIssue(ctx context.Context, opts ResolveIssueOptions) (*ResolveIssueResult, error) {
+	if strings.TrimSpace(opts.Issue.Title) == "" {
+		return nil, errors.New("issue has no title")
+	}
+	repo, err := opts.Repo.resolve()
+	if err != nil {
+		return nil, err
+	}
+	issue := &github.Issue{Number: github.Int(opts.Issue.Number), Title: github.String(opts.Issue.Title), Body: github.String(opts.Issue.Body)}
+	for _, name := range opts.Issue.Labels {
+		issue.Labels = append(issue.Labels, github.Label{Name: github.String(name)})
+	}
+
+	result, err := handlers.ResolveIssueLocally(ctx, repo.Name, repo.Path, issue, c.agent)
+	if err != nil {
+		return nil, err
+	}
+	return &ResolveIssueResult{
+		Summary:        result.Summary,
+		ChangedFiles:   result.ChangesMade,
+		Operations:     repository.FileOperations(repo.Path, result.ChangesMade, result.Operations),
+		Model:          result.Model,
+		PlanConfidence: result.PlanConfidence,
+		Confidence:     result.Confidence,
+	}, nil
+}
+
+// SyncKnowledgeBaseOptions configure Client.SyncKnowledgeBase
+type SyncKnowledgeBaseOptions struct {
+	Repo Repo
+	Ref  string // commit to sync to; HEAD when empty
+}
+
+// SyncKnowledgeBaseResult is the outcome of Client.SyncKnowledgeBase
+type SyncKnowledgeBaseResult struct {
+	SHA      string
+	Upgraded bool // the knowledge base was migrated to the current schema first
+	Changes  []repository.Change
+}
+
+// SyncKnowledgeBase brings a checkout's knowledge base up to a commit, migrating it to the
+// current schema first when it is older
+func (c *Client) SyncKnowledgeBase(ctx context.Context, opts SyncKnowledgeBaseOptions) (*SyncKnowledgeBaseResult, error) {
+	repo, err := opts.Repo.resolve()
+	if err != nil {
+		return nil, err
+	}
+	ref := opts.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	out, err := exec.CommandContext(ctx, "git", "-C", repo.Path, "rev-parse", "--verify", ref+"^{commit}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("unknown commit %q", ref)
+	}
+	result := &SyncKnowledgeBaseResult{SHA: strings.TrimSpace(string(out))}
+
+	if result.Upgraded, err = repository.UpgradeKnowledgeBase(repo.Path, repo.URL, repo.Name); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if result.Changes, err = repository.SyncKnowledgeBase(repo.Path, result.SHA); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,945 @@
+package devharness
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+)
+
+// Repo is the recorded state of a fake repository
+type Repo struct {
+	FullName      string            `json:"full_name"`
+	DefaultBranch string            `json:"default_branch"`
+	Branches      map[string]string `json:"branches"` // name -> commit SHA
+	Labels        []string          `json:"labels"`
+	Issues        []*Issue          `json:"issues"`
+	PullRequests  []*PullRequest    `json:"pull_requests"`
+}
+
+// Issue is an issue of a fake repository with everything DevFlow did to it
+type Issue struct {
+	Number    int       `json:"number"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	State     string    `json:"state"`
+	Author    string    `json:"author"`
+	Labels    []string  `json:"labels"`
+	Milestone int       `json:"milestone,omitempty"`
+	Reactions []string  `json:"reactions,omitempty"`
+	Comments  []Comment `json:"comments,omitempty"`
+}
+
+// Comment is a comment on a fake issue or pull request
+type Comment struct {
+	ID        int64    `json:"id"`
+	Author    string   `json:"author"`
+	Body      string   `json:"body"`
+	Reactions []string `json:"reactions,omitempty"`
+}
+
+// PullRequest is a pull request opened on a fake repository
+type PullRequest struct {
+	Number    int               `json:"number"`
+	Title     string            `json:"title"`
+	Body      string            `json:"body"`
+	Head      string            `json:"head"`
+	Base      string            `json:"base"`
+	Reviewers []string          `json:"reviewers,omitempty"`
+	Files     map[string]string `json:"files"` // path -> content on the head branch; "" for deleted files
+	Comments  []Comment         `json:"comments,omitempty"`
+}
+
+// botLogin is the author of everything DevFlow writes
+const botLogin = "devflow[bot]"
+
+type fakeCommit struct {
+	sha     string
+	tree    string
+	message string
+	parents []string
+}
+
+type fakeRepo struct {
+	fullName      string
+	defaultBranch string
+	refs          map[string]string // "heads/main" -> commit SHA
+	labels        map[string]*github.Label
+	issues        map[int]*Issue
+	pulls         map[int]*PullRequest
+	nextNumber    int
+}
+
+// fakeGitHub serves the subset of the GitHub REST API DevFlow uses from memory. Git objects
+// it did not create itself (those of the seeded commit) are read through readObject.
+type fakeGitHub struct {
+	mu         sync.Mutex
+	baseURL    string
+	repos      map[string]*fakeRepo
+	commits    map[string]*fakeCommit
+	trees      map[string]map[string]string // tree SHA -> path -> blob SHA
+	blobs      map[string]string
+	readObject func(sha string) (string, error)
+	nextID     int64
+}
+
+func newFakeGitHub(readObject func(string) (string, error)) *fakeGitHub {
+	return &fakeGitHub{
+		repos:      make(map[string]*fakeRepo),
+		commits:    make(map[string]*fakeCommit),
+		trees:      make(map[string]map[string]string),
+		blobs:      make(map[string]string),
+		readObject: readObject,
+	}
+}
+
+// seed adds a repository whose default branch points at an existing commit
+func (g *fakeGitHub) seed(fullName, branch, sha, treeSHA string, files map[string]string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.commits[sha] = &fakeCommit{sha: sha, tree: treeSHA, message: "Initial state"}
+	g.trees[treeSHA] = files
+	g.repos[strings.ToLower(fullName)] = &fakeRepo{
+		fullName:      fullName,
+		defaultBranch: branch,
+		refs:          map[string]string{"heads/" + branch: sha},
+		labels:        make(map[string]*github.Label),
+		issues:        make(map[int]*Issue),
+		pulls:         make(map[int]*PullRequest),
+		nextNumber:    1,
+	}
+}
+
+// openIssue files an issue as a user would
+func (g *fakeGitHub) openIssue(fullName, title, body, author string, labels []string) (*Issue, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	r, ok := g.repos[strings.ToLower(fullName)]
+	if !ok {
+		return nil, fmt.Errorf("unknown repository %s", fullName)
+	}
+	is := &Issue{Number: r.nextNumber, Title: title, Body: body, State: "open", Author: author}
+	r.nextNumber++
+	for _, l := range labels {
+		r.ensureLabel(l)
+		is.Labels = append(is.Labels, l)
+	}
+	r.issues[is.Number] = is
+	return is, nil
+}
+
+// state returns a copy of every repository
+func (g *fakeGitHub) state() []Repo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := make([]Repo, 0, len(g.repos))
+	for _, r := range g.repos {
+		repo := Repo{FullName: r.fullName, DefaultBranch: r.defaultBranch, Branches: make(map[string]string)}
+		for ref, sha := range r.refs {
+			if name, ok := strings.CutPrefix(ref, "heads/"); ok {
+				repo.Branches[name] = sha
+			}
+		}
+		for name := range r.labels {
+			repo.Labels = append(repo.Labels, name)
+		}
+		sort.Strings(repo.Labels)
+		for _, n := range sortedKeys(r.issues) {
+			is := *r.issues[n]
+			is.Labels = append([]string(nil), is.Labels...)
+			is.Comments = append([]Comment(nil), is.Comments...)
+			repo.Issues = append(repo.Issues, &is)
+		}
+		for _, n := range sortedKeys(r.pulls) {
+			pr := *r.pulls[n]
+			pr.Files = g.changedFiles(r, &pr)
+			pr.Comments = append([]Comment(nil), pr.Comments...)
+			repo.PullRequests = append(repo.PullRequests, &pr)
+		}
+		out = append(out, repo)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].FullName < out[j].FullName })
+	return out
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// changedFiles compares the trees at the head and base of a pull request
+func (g *fakeGitHub) changedFiles(r *fakeRepo, pr *PullRequest) map[string]string {
+	files := make(map[string]string)
+	head, base := g.treeOf(r, pr.Head), g.treeOf(r, pr.Base)
+	for path, sha := range head {
+		if base[path] != sha {
+			files[path], _ = g.blob(sha)
+		}
+	}
+	for path := range base {
+		if _, ok := head[path]; !ok {
+			files[path] = ""
+		}
+	}
+	return files
+}
+
+func (g *fakeGitHub) treeOf(r *fakeRepo, branch string) map[string]string {
+	if c, ok := g.commits[r.refs["heads/"+branch]]; ok {
+		return g.trees[c.tree]
+	}
+	return nil
+}
+
+func (g *fakeGitHub) blob(sha string) (string, error) {
+	if content, ok := g.blobs[sha]; ok {
+		return content, nil
+	}
+	if g.readObject == nil {
+		return "", fmt.Errorf("unknown blob %s", sha)
+	}
+	return g.readObject(sha)
+}
+
+func (r *fakeRepo) ensureLabel(name string) {
+	if _, ok := r.labels[strings.ToLower(name)]; !ok {
+		r.labels[strings.ToLower(name)] = &github.Label{Name: github.String(name), Color: github.String("ededed")}
+	}
+}
+
+// objectSHA derives a git-like SHA for an object the fake creates
+func objectSHA(kind string, v any) string {
+	data, _ := json.Marshal(v)
+	sum := sha1.Sum(append([]byte(kind+"\x00"), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+// handler routes the REST API under /api/v3/, as for GitHub Enterprise Server
+func (g *fakeGitHub) handler() http.Handler {
+	mux := http.NewServeMux()
+	const repo = "/api/v3/repos/{owner}/{repo}"
+	mux.HandleFunc("GET "+repo, g.withRepo(g.getRepo))
+	mux.HandleFunc("GET "+repo+"/git/refs/{ref...}", g.withRepo(g.getRef))
+	mux.HandleFunc("POST "+repo+"/git/refs", g.withRepo(g.createRef))
+	mux.HandleFunc("PATCH "+repo+"/git/refs/{ref...}", g.withRepo(g.updateRef))
+	mux.HandleFunc("GET "+repo+"/git/commits/{sha}", g.withRepo(g.getCommit))
+	mux.HandleFunc("POST "+repo+"/git/commits", g.withRepo(g.createCommit))
+	mux.HandleFunc("POST "+repo+"/git/blobs", g.withRepo(g.createBlob))
+	mux.HandleFunc("POST "+repo+"/git/trees", g.withRepo(g.createTree))
+	mux.HandleFunc("GET "+repo+"/contents/{path...}", g.withRepo(g.getContents))
+	mux.HandleFunc("PUT "+repo+"/contents/{path...}", g.withRepo(g.createFile))
+	mux.HandleFunc("GET "+repo+"/commits", g.withRepo(g.listCommits))
+	mux.HandleFunc("POST "+repo+"/issues", g.withRepo(g.createIssue))
+	mux.HandleFunc("GET "+repo+"/issues/{number}", g.withRepo(g.getIssue))
+	mux.HandleFunc("PATCH "+repo+"/issues/{number}", g.withRepo(g.editIssue))
+	mux.HandleFunc("GET "+repo+"/issues/{number}/comments", g.withRepo(g.listComments))
+	mux.HandleFunc("POST "+repo+"/issues/{number}/comments", g.withRepo(g.createComment))
+	mux.HandleFunc("GET "+repo+"/issues/{number}/labels", g.withRepo(g.listIssueLabels))
+	mux.HandleFunc("POST "+repo+"/issues/{number}/labels", g.withRepo(g.addIssueLabels))
+	mux.HandleFunc("DELETE "+repo+"/issues/{number}/labels/{name}", g.withRepo(g.removeIssueLabel))
+	mux.HandleFunc("POST "+repo+"/issues/{number}/reactions", g.withRepo(g.createIssueReaction))
+	mux.HandleFunc("POST "+repo+"/issues/comments/{id}/reactions", g.withRepo(g.createCommentReaction))
+	mux.HandleFunc("GET "+repo+"/labels/{name}", g.withRepo(g.getLabel))
+	mux.HandleFunc("POST "+repo+"/labels", g.withRepo(g.createLabel))
+	mux.HandleFunc("DELETE "+repo+"/labels/{name}", g.withRepo(g.deleteLabel))
+	mux.HandleFunc("GET "+repo+"/pulls", g.withRepo(g.listPulls))
+	mux.HandleFunc("POST "+repo+"/pulls", g.withRepo(g.createPull))
+	mux.HandleFunc("PATCH "+repo+"/pulls/{number}", g.withRepo(g.editPull))
+	mux.HandleFunc("GET "+repo+"/pulls/{number}/files", g.withRepo(g.listPullFiles))
+	mux.HandleFunc("POST "+repo+"/pulls/{number}/requested_reviewers", g.withRepo(g.requestReviewers))
+	mux.HandleFunc("POST /api/graphql", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"errors": []map[string]string{{"message": "GraphQL is not supported by the fake GitHub"}}})
+	})
+	return mux
+}
+
+type repoHandler func(w http.ResponseWriter, r *http.Request, repo *fakeRepo)
+
+// withRepo resolves the repository of the path and serializes access to the fake's state
+func (g *fakeGitHub) withRepo(h repoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		repo, ok := g.repos[strings.ToLower(r.PathValue("owner")+"/"+r.PathValue("repo"))]
+		if !ok {
+			notFound(w)
+			return
+		}
+		h(w, r, repo)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func notFound(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+}
+
+func badRequest(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": err.Error()})
+}
+
+func decode(r *http.Request, v any) error {
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+func (g *fakeGitHub) htmlURL(repo *fakeRepo, kind string, number int) string {
+	return fmt.Sprintf("%s/%s/%s/%d", g.baseURL, repo.fullName, kind, number)
+}
+
+func (g *fakeGitHub) getRepo(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	writeJSON(w, http.StatusOK, &github.Repository{
+		FullName:      github.String(repo.fullName),
+		DefaultBranch: github.String(repo.defaultBranch),
+	})
+}
+
+func refJSON(ref, sha string) *github.Reference {
+	return &github.Reference{Ref: github.String("refs/" + ref), Object: &github.GitObject{Type: github.String("commit"), SHA: github.String(sha)}}
+}
+
+func (g *fakeGitHub) getRef(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	ref := r.PathValue("ref")
+	sha, ok := repo.refs[ref]
+	if !ok {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, refJSON(ref, sha))
+}
+
+func (g *fakeGitHub) createRef(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	var req struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	}
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	ref := strings.TrimPrefix(req.Ref, "refs/")
+	if _, ok := repo.refs[ref]; ok {
+		badRequest(w, fmt.Errorf("Reference already exists"))
+		return
+	}
+	if _, ok := g.commits[req.SHA]; !ok {
+		badRequest(w, fmt.Errorf("Object does not exist"))
+		return
+	}
+	repo.refs[ref] = req.SHA
+	writeJSON(w, http.StatusCreated, refJSON(ref, req.SHA))
+}
+
+func (g *fakeGitHub) updateRef(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	ref := r.PathValue("ref")
+	var req struct {
+		SHA   string `json:"sha"`
+		Force bool   `json:"force"`
+	}
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	if _, ok := repo.refs[ref]; !ok {
+		notFound(w)
+		return
+	}
+	if _, ok := g.commits[req.SHA]; !ok {
+		badRequest(w, fmt.Errorf("Object does not exist"))
+		return
+	}
+	repo.refs[ref] = req.SHA
+	writeJSON(w, http.StatusOK, refJSON(ref, req.SHA))
+}
+
+func commitJSON(c *fakeCommit) *github.Commit {
+	out := &github.Commit{SHA: github.String(c.sha), Message: github.String(c.message), Tree: &github.Tree{SHA: github.String(c.tree)}}
+	for _, p := range c.parents {
+		out.Parents = append(out.Parents, github.Commit{SHA: github.String(p)})
+	}
+	return out
+}
+
+func (g *fakeGitHub) getCommit(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	c, ok := g.commits[r.PathValue("sha")]
+	if !ok {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, commitJSON(c))
+}
+
+func (g *fakeGitHub) createCommit(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	var req struct {
+		Message string   `json:"message"`
+		Tree    string   `json:"tree"`
+		Parents []string `json:"parents"`
+	}
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	if _, ok := g.trees[req.Tree]; !ok {
+		badRequest(w, fmt.Errorf("Tree SHA does not exist"))
+		return
+	}
+	g.nextID++
+	c := &fakeCommit{tree: req.Tree, message: req.Message, parents: req.Parents}
+	c.sha = objectSHA("commit", []any{req, g.nextID})
+	g.commits[c.sha] = c
+	writeJSON(w, http.StatusCreated, commitJSON(c))
+}
+
+func (g *fakeGitHub) createBlob(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	var req github.Blob
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	content := req.GetContent()
+	if req.GetEncoding() == "base64" {
+		data, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		content = string(data)
+	}
+	sha := objectSHA("blob", content)
+	g.blobs[sha] = content
+	writeJSON(w, http.StatusCreated, &github.Blob{SHA: github.String(sha)})
+}
+
+func (g *fakeGitHub) createTree(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	var req struct {
+		BaseTree string `json:"base_tree"`
+		Tree     []struct {
+			Path    string  `json:"path"`
+			SHA     *string `json:"sha"`
+			Content *string `json:"content"`
+		} `json:"tree"`
+	}
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	files := make(map[string]string)
+	if req.BaseTree != "" {
+		base, ok := g.trees[req.BaseTree]
+		if !ok {
+			badRequest(w, fmt.Errorf("base_tree does not exist"))
+			return
+		}
+		for path, sha := range base {
+			files[path] = sha
+		}
+	}
+	for _, e := range req.Tree {
+		switch {
+		case e.Content != nil:
+			sha := objectSHA("blob", *e.Content)
+			g.blobs[sha] = *e.Content
+			files[e.Path] = sha
+		case e.SHA == nil || *e.SHA == "":
+			// A null SHA deletes the path
+			delete(files, e.Path)
+		default:
+			files[e.Path] = *e.SHA
+		}
+	}
+	sha := objectSHA("tree", files)
+	g.trees[sha] = files
+	writeJSON(w, http.StatusCreated, &github.Tree{SHA: github.String(sha)})
+}
+
+func (g *fakeGitHub) getContents(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	branch := r.URL.Query().Get("ref")
+	if branch == "" {
+		branch = repo.defaultBranch
+	}
+	sha, ok := g.treeOf(repo, branch)[r.PathValue("path")]
+	if !ok {
+		notFound(w)
+		return
+	}
+	content, err := g.blob(sha)
+	if err != nil {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, &github.RepositoryContent{
+		Type:     github.String("file"),
+		Path:     github.String(r.PathValue("path")),
+		SHA:      github.String(sha),
+		Encoding: github.String("base64"),
+		Content:  github.String(base64.StdEncoding.EncodeToString([]byte(content))),
+	})
+}
+
+// createFile commits a single file onto a branch, as the contents API does
+func (g *fakeGitHub) createFile(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	var req github.RepositoryContentFileOptions
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	branch := req.GetBranch()
+	if branch == "" {
+		branch = repo.defaultBranch
+	}
+	parent, ok := g.commits[repo.refs["heads/"+branch]]
+	if !ok {
+		notFound(w)
+		return
+	}
+	files := make(map[string]string)
+	for path, sha := range g.trees[parent.tree] {
+		files[path] = sha
+	}
+	blobSHA := objectSHA("blob", string(req.Content))
+	g.blobs[blobSHA] = string(req.Content)
+	files[r.PathValue("path")] = blobSHA
+	treeSHA := objectSHA("tree", files)
+	g.trees[treeSHA] = files
+
+	g.nextID++
+	c := &fakeCommit{tree: treeSHA, message: req.GetMessage(), parents: []string{parent.sha}}
+	c.sha = objectSHA("commit", []any{c.tree, c.message, c.parents, g.nextID})
+	g.commits[c.sha] = c
+	repo.refs["heads/"+branch] = c.sha
+	writeJSON(w, http.StatusCreated, &github.RepositoryContentResponse{Commit: *commitJSON(c)})
+}
+
+// listCommits has no history to offer; ownership falls back to the local clone
+func (g *fakeGitHub) listCommits(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	writeJSON(w, http.StatusOK, []*github.RepositoryCommit{})
+}
+
+func pathNumber(r *http.Request, name string) (int, bool) {
+	n, err := strconv.Atoi(r.PathValue(name))
+	return n, err == nil
+}
+
+// issueOrPull finds the issue behind a number; pull requests are issues too
+func (repo *fakeRepo) issueOrPull(r *http.Request) (*Issue, *PullRequest, bool) {
+	n, ok := pathNumber(r, "number")
+	if !ok {
+		return nil, nil, false
+	}
+	if is, ok := repo.issues[n]; ok {
+		return is, nil, true
+	}
+	if pr, ok := repo.pulls[n]; ok {
+		return nil, pr, true
+	}
+	return nil, nil, false
+}
+
+func (g *fakeGitHub) issueJSON(repo *fakeRepo, is *Issue) *github.Issue {
+	out := &github.Issue{
+		Number:  github.Int(is.Number),
+		Title:   github.String(is.Title),
+		Body:    github.String(is.Body),
+		State:   github.String(is.State),
+		User:    &github.User{Login: github.String(is.Author)},
+		HTMLURL: github.String(g.htmlURL(repo, "issues", is.Number)),
+		NodeID:  github.String(fmt.Sprintf("I_%d", is.Number)),
+	}
+	for _, l := range is.Labels {
+		out.Labels = append(out.Labels, github.Label{Name: github.String(l)})
+	}
+	if is.Milestone != 0 {
+		out.Milestone = &github.Milestone{Number: github.Int(is.Milestone)}
+	}
+	return out
+}
+
+func (g *fakeGitHub) pullIssueJSON(repo *fakeRepo, pr *PullRequest) *github.Issue {
+	return &github.Issue{
+		Number:           github.Int(pr.Number),
+		Title:            github.String(pr.Title),
+		Body:             github.String(pr.Body),
+		State:            github.String("open"),
+		User:             &github.User{Login: github.String(botLogin)},
+		HTMLURL:          github.String(g.htmlURL(repo, "pull", pr.Number)),
+		PullRequestLinks: &github.PullRequestLinks{URL: github.String(g.htmlURL(repo, "pull", pr.Number))},
+	}
+}
+
+func (g *fakeGitHub) createIssue(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	var req github.IssueRequest
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	is := &Issue{Number: repo.nextNumber, Title: req.GetTitle(), Body: req.GetBody(), State: "open", Author: botLogin}
+	repo.nextNumber++
+	if req.Labels != nil {
+		for _, l := range *req.Labels {
+			repo.ensureLabel(l)
+			is.Labels = append(is.Labels, l)
+		}
+	}
+	repo.issues[is.Number] = is
+	writeJSON(w, http.StatusCreated, g.issueJSON(repo, is))
+}
+
+func (g *fakeGitHub) getIssue(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	is, pr, ok := repo.issueOrPull(r)
+	switch {
+	case !ok:
+		notFound(w)
+	case pr != nil:
+		writeJSON(w, http.StatusOK, g.pullIssueJSON(repo, pr))
+	default:
+		writeJSON(w, http.StatusOK, g.issueJSON(repo, is))
+	}
+}
+
+func (g *fakeGitHub) editIssue(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	is, _, ok := repo.issueOrPull(r)
+	if !ok || is == nil {
+		notFound(w)
+		return
+	}
+	var req github.IssueRequest
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	if req.Title != nil {
+		is.Title = *req.Title
+	}
+	if req.Body != nil {
+		is.Body = *req.Body
+	}
+	if req.State != nil {
+		is.State = *req.State
+	}
+	if req.Milestone != nil {
+		is.Milestone = *req.Milestone
+	}
+	writeJSON(w, http.StatusOK, g.issueJSON(repo, is))
+}
+
+// comments returns the comment list of an issue or pull request
+func (repo *fakeRepo) comments(r *http.Request) (*[]Comment, bool) {
+	is, pr, ok := repo.issueOrPull(r)
+	switch {
+	case !ok:
+		return nil, false
+	case pr != nil:
+		return &pr.Comments, true
+	default:
+		return &is.Comments, true
+	}
+}
+
+func commentJSON(c Comment) *github.IssueComment {
+	return &github.IssueComment{ID: github.Int64(c.ID), Body: github.String(c.Body), User: &github.User{Login: github.String(c.Author)}}
+}
+
+func (g *fakeGitHub) listComments(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	comments, ok := repo.comments(r)
+	if !ok {
+		notFound(w)
+		return
+	}
+	out := make([]*github.IssueComment, 0, len(*comments))
+	for _, c := range *comments {
+		out = append(out, commentJSON(c))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (g *fakeGitHub) createComment(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	comments, ok := repo.comments(r)
+	if !ok {
+		notFound(w)
+		return
+	}
+	var req github.IssueComment
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	g.nextID++
+	c := Comment{ID: g.nextID, Author: botLogin, Body: req.GetBody()}
+	*comments = append(*comments, c)
+	writeJSON(w, http.StatusCreated, commentJSON(c))
+}
+
+func labelsJSON(names []string) []*github.Label {
+	out := make([]*github.Label, 0, len(names))
+	for _, n := range names {
+		out = append(out, &github.Label{Name: github.String(n)})
+	}
+	return out
+}
+
+func (g *fakeGitHub) listIssueLabels(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	is, _, ok := repo.issueOrPull(r)
+	if !ok || is == nil {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, labelsJSON(is.Labels))
+}
+
+func (g *fakeGitHub) addIssueLabels(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	is, _, ok := repo.issueOrPull(r)
+	if !ok || is == nil {
+		notFound(w)
+		return
+	}
+	var labels []string
+	if err := decode(r, &labels); err != nil {
+		badRequest(w, err)
+		return
+	}
+	for _, l := range labels {
+		repo.ensureLabel(l)
+		if !containsFold(is.Labels, l) {
+			is.Labels = append(is.Labels, l)
+		}
+	}
+	writeJSON(w, http.StatusOK, labelsJSON(is.Labels))
+}
+
+func (g *fakeGitHub) removeIssueLabel(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	is, _, ok := repo.issueOrPull(r)
+	if !ok || is == nil || !containsFold(is.Labels, r.PathValue("name")) {
+		notFound(w)
+		return
+	}
+	kept := is.Labels[:0]
+	for _, l := range is.Labels {
+		if !strings.EqualFold(l, r.PathValue("name")) {
+			kept = append(kept, l)
+		}
+	}
+	is.Labels = kept
+	writeJSON(w, http.StatusOK, labelsJSON(is.Labels))
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *fakeGitHub) createIssueReaction(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	is, _, ok := repo.issueOrPull(r)
+	if !ok || is == nil {
+		notFound(w)
+		return
+	}
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	is.Reactions = append(is.Reactions, req.Content)
+	g.nextID++
+	writeJSON(w, http.StatusCreated, &github.Reaction{ID: github.Int64(g.nextID), Content: github.String(req.Content)})
+}
+
+func (g *fakeGitHub) createCommentReaction(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		notFound(w)
+		return
+	}
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	lists := make([][]Comment, 0, len(repo.issues)+len(repo.pulls))
+	for _, is := range repo.issues {
+		lists = append(lists, is.Comments)
+	}
+	for _, pr := range repo.pulls {
+		lists = append(lists, pr.Comments)
+	}
+	for _, comments := range lists {
+		for i := range comments {
+			if comments[i].ID == id {
+				comments[i].Reactions = append(comments[i].Reactions, req.Content)
+				g.nextID++
+				writeJSON(w, http.StatusCreated, &github.Reaction{ID: github.Int64(g.nextID), Content: github.String(req.Content)})
+				return
+			}
+		}
+	}
+	notFound(w)
+}
+
+func (g *fakeGitHub) getLabel(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	l, ok := repo.labels[strings.ToLower(r.PathValue("name"))]
+	if !ok {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+func (g *fakeGitHub) createLabel(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	var req github.Label
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	key := strings.ToLower(req.GetName())
+	if _, ok := repo.labels[key]; ok {
+		badRequest(w, fmt.Errorf("Label already exists"))
+		return
+	}
+	repo.labels[key] = &req
+	writeJSON(w, http.StatusCreated, &req)
+}
+
+func (g *fakeGitHub) deleteLabel(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	key := strings.ToLower(r.PathValue("name"))
+	if _, ok := repo.labels[key]; !ok {
+		notFound(w)
+		return
+	}
+	delete(repo.labels, key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *fakeGitHub) pullJSON(repo *fakeRepo, pr *PullRequest) *github.PullRequest {
+	return &github.PullRequest{
+		Number:  github.Int(pr.Number),
+		Title:   github.String(pr.Title),
+		Body:    github.String(pr.Body),
+		State:   github.String("open"),
+		HTMLURL: github.String(g.htmlURL(repo, "pull", pr.Number)),
+		User:    &github.User{Login: github.String(botLogin)},
+		Head:    &github.PullRequestBranch{Ref: github.String(pr.Head), Repo: &github.Repository{FullName: github.String(repo.fullName)}},
+		Base:    &github.PullRequestBranch{Ref: github.String(pr.Base)},
+	}
+}
+
+// listPulls lists the pull requests, all of which the fake keeps open
+func (g *fakeGitHub) listPulls(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	prs := []*github.PullRequest{}
+	if state := r.URL.Query().Get("state"); state == "" || state == "open" || state == "all" {
+		// head is "owner:branch"
+		_, head, _ := strings.Cut(r.URL.Query().Get("head"), ":")
+		for _, n := range sortedKeys(repo.pulls) {
+			if head == "" || repo.pulls[n].Head == head {
+				prs = append(prs, g.pullJSON(repo, repo.pulls[n]))
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, prs)
+}
+
+func (g *fakeGitHub) createPull(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	var req github.NewPullRequest
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	for _, branch := range []string{req.GetHead(), req.GetBase()} {
+		if _, ok := repo.refs["heads/"+branch]; !ok {
+			badRequest(w, fmt.Errorf("Validation Failed: branch %s does not exist", branch))
+			return
+		}
+	}
+	for _, pr := range repo.pulls {
+		if pr.Head == req.GetHead() {
+			badRequest(w, fmt.Errorf("A pull request already exists for %s", req.GetHead()))
+			return
+		}
+	}
+	pr := &PullRequest{Number: repo.nextNumber, Title: req.GetTitle(), Body: req.GetBody(), Head: req.GetHead(), Base: req.GetBase()}
+	repo.nextNumber++
+	repo.pulls[pr.Number] = pr
+	writeJSON(w, http.StatusCreated, g.pullJSON(repo, pr))
+}
+
+func (g *fakeGitHub) editPull(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	_, pr, ok := repo.issueOrPull(r)
+	if !ok || pr == nil {
+		notFound(w)
+		return
+	}
+	var req github.PullRequest
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	if req.Title != nil {
+		pr.Title = *req.Title
+	}
+	if req.Body != nil {
+		pr.Body = *req.Body
+	}
+	writeJSON(w, http.StatusOK, g.pullJSON(repo, pr))
+}
+
+func (g *fakeGitHub) listPullFiles(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	_, pr, ok := repo.issueOrPull(r)
+	if !ok || pr == nil {
+		notFound(w)
+		return
+	}
+	head, base := g.treeOf(repo, pr.Head), g.treeOf(repo, pr.Base)
+	var files []*github.CommitFile
+	for path, content := range g.changedFiles(repo, pr) {
+		status := "modified"
+		if _, ok := base[path]; !ok {
+			status = "added"
+		} else if _, ok := head[path]; !ok {
+			status = "removed"
+		}
+		files = append(files, &github.CommitFile{
+			Filename:  github.String(path),
+			Status:    github.String(status),
+			Additions: github.Int(strings.Count(content, "\n")),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].GetFilename() < files[j].GetFilename() })
+	writeJSON(w, http.StatusOK, files)
+}
+
+func (g *fakeGitHub) requestReviewers(w http.ResponseWriter, r *http.Request, repo *fakeRepo) {
+	_, pr, ok := repo.issueOrPull(r)
+	if !ok || pr == nil {
+		notFound(w)
+		return
+	}
+	var req github.ReviewersRequest
+	if err := decode(r, &req); err != nil {
+		badRequest(w, err)
+		return
+	}
+	pr.Reviewers = append(pr.Reviewers, req.Reviewers...)
+	writeJSON(w, http.StatusCreated, g.pullJSON(repo, pr))
+}
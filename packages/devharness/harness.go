@@ -0,0 +1,273 @@
+// Package devharness runs the issue pipeline end to end without network access: a local git
+// repository stands in for the GitHub repository, an in-memory fake serves the GitHub API,
+// and a cassette of recorded replies (or a stub) stands in for the LLM. Contributors use it
+// through `devflow serve --fake`, and tests can drive it directly.
+package devharness
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/handlers"
+	"devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+	"google.golang.org/genai"
+)
+
+// Options configures a Harness
+type Options struct {
+	RepoDir  string // local git repository to run against; it is copied, never modified
+	RepoName string // owner/name it is served as; "local/<directory name>" by default
+	Cassette string // LLM replies to play back; without one every LLM call gets a stub reply
+	Record   string // when set, LLM calls go to the real Gemini API and are recorded here
+}
+
+// Harness is a running offline pipeline
+type Harness struct {
+	RepoName string
+
+	github   *fakeGitHub
+	servers  []*httptest.Server
+	client   *github.Client
+	workDir  string
+	cloneURL func(string) string
+}
+
+// Start sets up the fakes and points DevFlow at them. It replaces the global configuration
+// with a copy of the loaded one that keeps all state in a scratch directory and uses the
+// native agent, so it must run before anything opens the store; Close undoes the rest.
+func Start(opts Options) (*Harness, error) {
+	repoDir, err := filepath.Abs(opts.RepoDir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := runGit(repoDir, "rev-parse", "HEAD"); err != nil {
+		return nil, fmt.Errorf("%s is not a git repository with commits: %w", repoDir, err)
+	}
+	h := &Harness{RepoName: opts.RepoName}
+	if h.RepoName == "" {
+		h.RepoName = "local/" + filepath.Base(repoDir)
+	}
+
+	var cassette *Cassette
+	if opts.Cassette != "" && opts.Record == "" {
+		if cassette, err = LoadCassette(opts.Cassette); err != nil {
+			return nil, err
+		}
+	}
+
+	h.workDir, err = os.MkdirTemp("", "devflow-fake-")
+	if err != nil {
+		return nil, err
+	}
+	// Clones fetch from and push to a bare copy, so the contributor's checkout is left alone
+	origin := filepath.Join(h.workDir, "origin.git")
+	if _, err := runGit("", "clone", "--bare", "--quiet", repoDir, origin); err != nil {
+		os.RemoveAll(h.workDir)
+		return nil, fmt.Errorf("failed to copy %s: %w", repoDir, err)
+	}
+
+	cfg := *config.GetConfig()
+	branch := cfg.Repository.DefaultBranch
+	if _, err := runGit(origin, "rev-parse", "--verify", "refs/heads/"+branch); err != nil {
+		if _, err := runGit(origin, "update-ref", "refs/heads/"+branch, "HEAD"); err != nil {
+			os.RemoveAll(h.workDir)
+			return nil, fmt.Errorf("failed to create branch %s: %w", branch, err)
+		}
+	}
+	sha, treeSHA, files, err := readHead(origin, branch)
+	if err != nil {
+		os.RemoveAll(h.workDir)
+		return nil, err
+	}
+
+	h.github = newFakeGitHub(func(sha string) (string, error) {
+		return runGit(origin, "cat-file", "blob", sha)
+	})
+	h.github.seed(h.RepoName, branch, sha, treeSHA, files)
+	ghServer := httptest.NewServer(h.github.handler())
+	h.github.baseURL = ghServer.URL
+	llmServer := httptest.NewServer(newFakeLLM(cassette, opts.Record).handler())
+	h.servers = []*httptest.Server{ghServer, llmServer}
+
+	h.client, err = github.NewEnterpriseClient(ghServer.URL+"/api/v3/", ghServer.URL+"/api/uploads/", nil)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	genai.SetDefaultBaseURLs(genai.BaseURLParameters{GeminiURL: llmServer.URL})
+	if opts.Record == "" {
+		// The clients refuse to start without a key; the fake never checks it
+		os.Setenv("GEMINI_API_KEY", "fake")
+	}
+
+	h.cloneURL = repository.CloneURL
+	repository.CloneURL = func(repoName string) string {
+		if strings.EqualFold(repoName, h.RepoName) {
+			return origin
+		}
+		return h.cloneURL(repoName)
+	}
+
+	cfg.Agent.Engine = "native"
+	cfg.Bot.Logins = append(append([]string{}, cfg.Bot.Logins...), botLogin)
+	cfg.Repository.WorkspaceDir = filepath.Join(h.workDir, "clones")
+	cfg.Repository.MirrorCacheDir = ""
+	cfg.Repository.CleanupTempRepos = true
+	cfg.Store.Backend = "file"
+	cfg.Store.Dir = filepath.Join(h.workDir, "state")
+	config.Use(&cfg)
+
+	slog.Info("Fake harness started", "repo", h.RepoName, "source", repoDir, "github", ghServer.URL, "llm", llmServer.URL)
+	return h, nil
+}
+
+// readHead returns the commit a branch points to, its tree and the blob of every file
+func readHead(gitDir, branch string) (sha, treeSHA string, files map[string]string, err error) {
+	if sha, err = runGit(gitDir, "rev-parse", "refs/heads/"+branch); err != nil {
+		return "", "", nil, err
+	}
+	if treeSHA, err = runGit(gitDir, "rev-parse", sha+"^{tree}"); err != nil {
+		return "", "", nil, err
+	}
+	out, err := runGit(gitDir, "ls-tree", "-r", sha)
+	if err != nil {
+		return "", "", nil, err
+	}
+	files = make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		// <mode> blob <sha>\t<path>
+		meta, path, ok := strings.Cut(line, "\t")
+		if fields := strings.Fields(meta); ok && len(fields) == 3 && fields[1] == "blob" {
+			files[path] = fields[2]
+		}
+	}
+	return sha, treeSHA, files, nil
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[len(args)-1], err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Close stops the fakes, restores the clone URL and LLM endpoint, and removes the scratch
+// directory. The global configuration keeps pointing at the harness settings.
+func (h *Harness) Close() {
+	for _, s := range h.servers {
+		s.Close()
+	}
+	if h.cloneURL != nil {
+		repository.CloneURL = h.cloneURL
+	}
+	genai.SetDefaultBaseURLs(genai.BaseURLParameters{})
+	os.RemoveAll(h.workDir)
+}
+
+// OpenIssue files an issue on the fake repository and runs the issue pipeline on it as if a
+// maintainer had applied the labels; without labels the first trigger label is used. It
+// returns the issue number along with the pipeline's error.
+func (h *Harness) OpenIssue(title, body string, labels []string) (int, error) {
+	cfg := config.GetConfig()
+	if len(labels) == 0 && len(cfg.Issues.RequiredLabels) > 0 {
+		labels = []string{cfg.Issues.RequiredLabels[0]}
+	}
+	const author = "octocat"
+	is, err := h.github.openIssue(h.RepoName, title, body, author, labels)
+	if err != nil {
+		return 0, err
+	}
+
+	owner, name, err := githubapi.SplitRepoName(h.RepoName)
+	if err != nil {
+		return 0, err
+	}
+	updated := time.Now()
+	issue := &github.Issue{
+		Number:    github.Int(is.Number),
+		Title:     github.String(title),
+		Body:      github.String(body),
+		State:     github.String("open"),
+		User:      &github.User{Login: github.String(author)},
+		UpdatedAt: &updated,
+	}
+	for _, l := range labels {
+		issue.Labels = append(issue.Labels, github.Label{Name: github.String(l)})
+	}
+	event := &github.IssuesEvent{
+		Action: github.String("labeled"),
+		Issue:  issue,
+		Repo: &github.Repository{
+			FullName: github.String(h.RepoName),
+			Name:     github.String(name),
+			Owner:    &github.User{Login: github.String(owner)},
+		},
+		Sender:       &github.User{Login: github.String(author)},
+		Installation: &github.Installation{ID: github.Int64(1)},
+	}
+	if len(labels) > 0 {
+		event.Label = &github.Label{Name: github.String(labels[len(labels)-1])}
+	}
+
+	slog.Info("Fake issue opened", "repo", h.RepoName, "issueNumber", is.Number, "labels", labels)
+	ctx := &probot.Context{Payload: event, GitHub: h.client}
+	return is.Number, handlers.EventHandlers["issues"](ctx)
+}
+
+// State returns what DevFlow has done to the fake repository so far
+func (h *Harness) State() Repo {
+	for _, r := range h.github.state() {
+		if strings.EqualFold(r.FullName, h.RepoName) {
+			return r
+		}
+	}
+	return Repo{}
+}
+
+// NewIssue is an issue to open on the fake repository, as given to POST /issues
+type NewIssue struct {
+	Title  string   `json:"title"`
+	Body   string   `json:"body"`
+	Labels []string `json:"labels"`
+}
+
+// Handler serves the harness over HTTP: POST /issues with {"title", "body", "labels"} runs
+// the pipeline on a new issue and answers once it is done; GET /state returns the repository
+// state.
+func (h *Harness) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /issues", func(w http.ResponseWriter, r *http.Request) {
+		var req NewIssue
+		if err := decode(r, &req); err != nil || strings.TrimSpace(req.Title) == "" {
+			http.Error(w, "expected a JSON body with a title", http.StatusBadRequest)
+			return
+		}
+		number, err := h.OpenIssue(req.Title, req.Body, req.Labels)
+		reply := map[string]any{"number": number, "state": h.State()}
+		if err != nil {
+			reply["error"] = err.Error()
+		}
+		writeJSON(w, http.StatusOK, reply)
+	})
+	mux.HandleFunc("GET /state", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, h.State())
+	})
+	return mux
+}
@@ -0,0 +1,228 @@
+package devharness
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Cassette is a sequence of model replies to play back in place of the Gemini API
+type Cassette struct {
+	Replies []Reply `json:"replies"`
+}
+
+// Reply is one model turn. A reply with Match only answers a request whose prompt contains
+// it; either way each reply is used once, in order.
+type Reply struct {
+	Match         string         `json:"match,omitempty"`
+	Text          string         `json:"text,omitempty"`
+	FunctionCalls []FunctionCall `json:"function_calls,omitempty"`
+}
+
+// FunctionCall is a tool call the model makes, e.g. apply_patch in the native agent
+type FunctionCall struct {
+	Name string         `json:"name"`
+	Args map[string]any `json:"args"`
+}
+
+// stubText answers requests no reply matches
+const stubText = "No recorded reply for this prompt; the fake LLM made no changes."
+
+// realGeminiURL is where record mode sends requests
+const realGeminiURL = "https://generativelanguage.googleapis.com"
+
+// LoadCassette reads a cassette file
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// fakeLLM serves the generateContent endpoint of the Gemini API. It replays a cassette, or
+// in record mode forwards every request to the real API and appends the reply to recordTo.
+type fakeLLM struct {
+	mu       sync.Mutex
+	replies  []Reply
+	used     []bool
+	recordTo string
+	recorded Cassette
+}
+
+func newFakeLLM(cassette *Cassette, recordTo string) *fakeLLM {
+	l := &fakeLLM{recordTo: recordTo}
+	if cassette != nil {
+		l.replies = cassette.Replies
+		l.used = make([]bool, len(cassette.Replies))
+	}
+	return l
+}
+
+// generateRequest is the part of a generateContent request the fake looks at
+type generateRequest struct {
+	Contents         []content `json:"contents"`
+	GenerationConfig struct {
+		ResponseMIMEType string `json:"responseMimeType"`
+	} `json:"generationConfig"`
+}
+
+type content struct {
+	Role  string `json:"role,omitempty"`
+	Parts []part `json:"parts"`
+}
+
+type part struct {
+	Text         string        `json:"text,omitempty"`
+	FunctionCall *FunctionCall `json:"functionCall,omitempty"`
+}
+
+// prompt is the text of the latest user turn, which is what cassette replies match against
+func (r *generateRequest) prompt() string {
+	for i := len(r.Contents) - 1; i >= 0; i-- {
+		if r.Contents[i].Role != "user" {
+			continue
+		}
+		var b strings.Builder
+		for _, p := range r.Contents[i].Parts {
+			b.WriteString(p.Text)
+		}
+		if b.Len() > 0 {
+			return b.String()
+		}
+	}
+	return ""
+}
+
+func (l *fakeLLM) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{version}/models/{call}", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.PathValue("call"), ":generateContent") {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": map[string]any{"code": 404, "message": "only generateContent is faked"}})
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		var req generateRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			badRequest(w, err)
+			return
+		}
+
+		var reply Reply
+		if l.recordTo != "" {
+			reply, err = l.record(r, body)
+			if err != nil {
+				writeJSON(w, http.StatusBadGateway, map[string]any{"error": map[string]any{"code": 502, "message": err.Error()}})
+				return
+			}
+		} else {
+			reply = l.next(&req)
+		}
+		writeJSON(w, http.StatusOK, generateResponse(reply))
+	})
+	return mux
+}
+
+// next takes the first unused reply that applies to the request
+func (l *fakeLLM) next(req *generateRequest) Reply {
+	prompt := req.prompt()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, reply := range l.replies {
+		if l.used[i] || (reply.Match != "" && !strings.Contains(prompt, reply.Match)) {
+			continue
+		}
+		l.used[i] = true
+		return reply
+	}
+	slog.Warn("Fake LLM has no reply for prompt, answering with a stub", "prompt", truncate(prompt, 200))
+	if req.GenerationConfig.ResponseMIMEType == "application/json" {
+		return Reply{Text: "{}"}
+	}
+	return Reply{Text: stubText}
+}
+
+// record forwards a request to the Gemini API and appends its reply to the cassette file
+func (l *fakeLLM) record(r *http.Request, body []byte) (Reply, error) {
+	out, err := http.NewRequestWithContext(r.Context(), http.MethodPost, realGeminiURL+r.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return Reply{}, err
+	}
+	out.Header = r.Header.Clone()
+	resp, err := http.DefaultClient.Do(out)
+	if err != nil {
+		return Reply{}, fmt.Errorf("failed to reach the Gemini API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return Reply{}, fmt.Errorf("Gemini API returned %s: %s", resp.Status, truncate(string(msg), 500))
+	}
+	var decoded struct {
+		Candidates []struct {
+			Content content `json:"content"`
+		} `json:"candidates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return Reply{}, fmt.Errorf("failed to decode Gemini reply: %w", err)
+	}
+	var reply Reply
+	if len(decoded.Candidates) > 0 {
+		for _, p := range decoded.Candidates[0].Content.Parts {
+			if p.FunctionCall != nil {
+				reply.FunctionCalls = append(reply.FunctionCalls, *p.FunctionCall)
+			}
+			reply.Text += p.Text
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recorded.Replies = append(l.recorded.Replies, reply)
+	data, err := json.MarshalIndent(&l.recorded, "", "  ")
+	if err != nil {
+		return Reply{}, err
+	}
+	if err := os.WriteFile(l.recordTo, data, 0644); err != nil {
+		return Reply{}, fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return reply, nil
+}
+
+// generateResponse renders a reply as a generateContent response with a single candidate
+func generateResponse(reply Reply) map[string]any {
+	var parts []part
+	if reply.Text != "" {
+		parts = append(parts, part{Text: reply.Text})
+	}
+	for i := range reply.FunctionCalls {
+		parts = append(parts, part{FunctionCall: &reply.FunctionCalls[i]})
+	}
+	return map[string]any{
+		"candidates": []map[string]any{{
+			"content":      content{Role: "model", Parts: parts},
+			"finishReason": "STOP",
+		}},
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
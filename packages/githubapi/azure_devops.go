@@ -0,0 +1,565 @@
+package githubapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// azureAPIVersion is the Azure DevOps REST API version DevFlow speaks; work item comments
+// are still a preview API
+const (
+	azureAPIVersion        = "7.1"
+	azureCommentAPIVersion = "7.1-preview.4"
+)
+
+// zeroObjectID is the object ID Azure DevOps uses for a ref that does not exist yet
+const zeroObjectID = "0000000000000000000000000000000000000000"
+
+// azureDevOpsClient implements Client on the Azure DevOps REST API. Repositories are named
+// "<project>/<repository>" and issues are the project's work items, with tags as labels.
+type azureDevOpsClient struct {
+	unsupported
+	rest   *restClient
+	staged *stagedCommits
+}
+
+// NewAzureDevOps returns a client for an Azure DevOps organization, e.g. baseURL
+// https://dev.azure.com, authenticated with a personal access token
+func NewAzureDevOps(baseURL, organization, token string) Client {
+	basic := base64.StdEncoding.EncodeToString([]byte(":" + token))
+	return &azureDevOpsClient{
+		rest: &restClient{
+			baseURL:   strings.TrimRight(baseURL, "/") + "/" + url.PathEscape(organization),
+			authorize: func(req *http.Request) { req.Header.Set("Authorization", "Basic "+basic) },
+		},
+		staged: newStagedCommits(),
+	}
+}
+
+// repoAPI returns the Git API path of a repository, with an optional suffix and query
+func (c *azureDevOpsClient) repoAPI(project, repo, suffix string, query url.Values) string {
+	return c.api(fmt.Sprintf("%s/_apis/git/repositories/%s%s", url.PathEscape(project), url.PathEscape(repo), suffix), query)
+}
+
+// api adds the API version to a path
+func (c *azureDevOpsClient) api(path string, query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	if query.Get("api-version") == "" {
+		query.Set("api-version", azureAPIVersion)
+	}
+	return path + "?" + query.Encode()
+}
+
+type azureRef struct {
+	Name     string `json:"name"`
+	ObjectID string `json:"objectId"`
+}
+
+func (c *azureDevOpsClient) GetRef(ctx context.Context, owner, repo, ref string) (*Reference, error) {
+	var refs struct {
+		Value []azureRef `json:"value"`
+	}
+	if err := c.rest.do(ctx, http.MethodGet, c.repoAPI(owner, repo, "/refs", url.Values{"filter": {ref}}), nil, &refs); err != nil {
+		return nil, err
+	}
+	// filter is a prefix match
+	for _, r := range refs.Value {
+		if r.Name == "refs/"+ref {
+			return &Reference{Ref: r.Name, SHA: r.ObjectID}, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (c *azureDevOpsClient) ListBranches(ctx context.Context, owner, repo string) ([]Reference, error) {
+	var refs struct {
+		Value []azureRef `json:"value"`
+	}
+	if err := c.rest.do(ctx, http.MethodGet, c.repoAPI(owner, repo, "/refs", url.Values{"filter": {"heads/"}}), nil, &refs); err != nil {
+		return nil, err
+	}
+	out := make([]Reference, 0, len(refs.Value))
+	for _, r := range refs.Value {
+		out = append(out, Reference{Ref: r.Name, SHA: r.ObjectID})
+	}
+	return out, nil
+}
+
+// updateRefs moves refs, failing when any update is rejected
+func (c *azureDevOpsClient) updateRefs(ctx context.Context, owner, repo string, updates ...map[string]string) error {
+	var result struct {
+		Value []struct {
+			Name         string `json:"name"`
+			Success      bool   `json:"success"`
+			UpdateStatus string `json:"updateStatus"`
+		} `json:"value"`
+	}
+	if err := c.rest.do(ctx, http.MethodPost, c.repoAPI(owner, repo, "/refs", nil), updates, &result); err != nil {
+		return err
+	}
+	for _, r := range result.Value {
+		if !r.Success {
+			return fmt.Errorf("failed to update %s: %s", r.Name, r.UpdateStatus)
+		}
+	}
+	return nil
+}
+
+func (c *azureDevOpsClient) CreateRef(ctx context.Context, owner, repo, ref, sha string) error {
+	if staged := c.staged.take(sha); staged != nil {
+		// A push to a new branch starts it from the commit given as its old object
+		return c.push(ctx, owner, repo, ref, staged.Parent, staged)
+	}
+	return c.updateRefs(ctx, owner, repo, map[string]string{"name": ref, "oldObjectId": zeroObjectID, "newObjectId": sha})
+}
+
+func (c *azureDevOpsClient) UpdateRef(ctx context.Context, owner, repo, ref, sha string, force bool) error {
+	if !strings.HasPrefix(ref, "refs/") {
+		ref = "refs/" + ref
+	}
+	current, err := c.GetRef(ctx, owner, repo, strings.TrimPrefix(ref, "refs/"))
+	if err != nil {
+		return err
+	}
+	if staged := c.staged.take(sha); staged != nil {
+		if staged.Parent != current.SHA {
+			return fmt.Errorf("%s moved to %s since the commit was staged on %s", ref, current.SHA, staged.Parent)
+		}
+		return c.push(ctx, owner, repo, ref, current.SHA, staged)
+	}
+	return c.updateRefs(ctx, owner, repo, map[string]string{"name": ref, "oldObjectId": current.SHA, "newObjectId": sha})
+}
+
+func (c *azureDevOpsClient) DeleteRef(ctx context.Context, owner, repo, ref string) error {
+	current, err := c.GetRef(ctx, owner, repo, ref)
+	if err != nil {
+		return err
+	}
+	return c.updateRefs(ctx, owner, repo, map[string]string{"name": current.Ref, "oldObjectId": current.SHA, "newObjectId": zeroObjectID})
+}
+
+// push creates a commit of the staged files on ref, whose current commit is oldObjectID
+func (c *azureDevOpsClient) push(ctx context.Context, owner, repo, ref, oldObjectID string, commit *stagedCommit) error {
+	changes := make([]map[string]any, 0, len(commit.Files)+len(commit.Deleted))
+	for _, path := range commit.Deleted {
+		changes = append(changes, map[string]any{"changeType": "delete", "item": map[string]string{"path": "/" + path}})
+	}
+	for path, content := range commit.Files {
+		// Pushes must say whether a file is new
+		changeType := "edit"
+		if _, err := c.getItem(ctx, owner, repo, path, commit.Parent); errors.Is(err, ErrNotFound) {
+			changeType = "add"
+		} else if err != nil {
+			return err
+		}
+		changes = append(changes, map[string]any{
+			"changeType": changeType,
+			"item":       map[string]string{"path": "/" + path},
+			"newContent": map[string]string{"content": base64.StdEncoding.EncodeToString([]byte(content)), "contentType": "base64encoded"},
+		})
+	}
+	push := map[string]any{
+		"refUpdates": []map[string]string{{"name": ref, "oldObjectId": oldObjectID}},
+		"commits": []map[string]any{{
+			"comment": commit.Message,
+			"parents": []string{commit.Parent},
+			"changes": changes,
+		}},
+	}
+	return c.rest.do(ctx, http.MethodPost, c.repoAPI(owner, repo, "/pushes", nil), push, nil)
+}
+
+// getItem reads a file at a commit
+func (c *azureDevOpsClient) getItem(ctx context.Context, owner, repo, path, commit string) ([]byte, error) {
+	query := url.Values{"path": {"/" + strings.TrimPrefix(path, "/")}, "$format": {"octetStream"}}
+	if commit != "" {
+		query.Set("versionDescriptor.version", commit)
+		query.Set("versionDescriptor.versionType", "commit")
+	}
+	var data []byte
+	err := c.rest.do(ctx, http.MethodGet, c.repoAPI(owner, repo, "/items", query), nil, &data)
+	return data, err
+}
+
+func (c *azureDevOpsClient) GetCommit(ctx context.Context, owner, repo, sha string) (*Commit, error) {
+	var commit struct {
+		CommitID  string   `json:"commitId"`
+		TreeID    string   `json:"treeId"`
+		Comment   string   `json:"comment"`
+		Parents   []string `json:"parents"`
+		Committer struct {
+			Date time.Time `json:"date"`
+		} `json:"committer"`
+	}
+	if err := c.rest.do(ctx, http.MethodGet, c.repoAPI(owner, repo, "/commits/"+url.PathEscape(sha), nil), nil, &commit); err != nil {
+		return nil, err
+	}
+	return &Commit{SHA: commit.CommitID, TreeSHA: commit.TreeID, Message: commit.Comment, Parents: commit.Parents, Date: commit.Committer.Date}, nil
+}
+
+func (c *azureDevOpsClient) CreateBlob(ctx context.Context, owner, repo, content string) (string, error) {
+	return c.staged.createBlob(content), nil
+}
+
+func (c *azureDevOpsClient) CreateTree(ctx context.Context, owner, repo, baseTreeSHA string, entries []TreeEntry) (string, error) {
+	return c.staged.createTree(entries)
+}
+
+func (c *azureDevOpsClient) CreateCommit(ctx context.Context, owner, repo, message, treeSHA string, parents []string) (*Commit, error) {
+	return c.staged.createCommit(message, treeSHA, parents)
+}
+
+func (c *azureDevOpsClient) GetRepository(ctx context.Context, owner, repo string) (*Repository, error) {
+	var r struct {
+		Name          string `json:"name"`
+		DefaultBranch string `json:"defaultBranch"`
+		Project       struct {
+			Name string `json:"name"`
+		} `json:"project"`
+	}
+	if err := c.rest.do(ctx, http.MethodGet, c.repoAPI(owner, repo, "", nil), nil, &r); err != nil {
+		return nil, err
+	}
+	return &Repository{FullName: r.Project.Name + "/" + r.Name, DefaultBranch: strings.TrimPrefix(r.DefaultBranch, "refs/heads/")}, nil
+}
+
+func (c *azureDevOpsClient) CreateFile(ctx context.Context, owner, repo, path, message, branch string, content []byte) error {
+	head, err := c.GetRef(ctx, owner, repo, "heads/"+branch)
+	if err != nil {
+		return err
+	}
+	return c.push(ctx, owner, repo, head.Ref, head.SHA, &stagedCommit{Message: message, Parent: head.SHA, Files: map[string]string{path: string(content)}})
+}
+
+func (c *azureDevOpsClient) GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error) {
+	return c.getItem(ctx, owner, repo, path, "")
+}
+
+// workItem is the part of a work item DevFlow reads
+type workItem struct {
+	ID     int `json:"id"`
+	Fields struct {
+		Title       string `json:"System.Title"`
+		Description string `json:"System.Description"`
+		ReproSteps  string `json:"Microsoft.VSTS.TCM.ReproSteps"`
+		State       string `json:"System.State"`
+		Tags        string `json:"System.Tags"`
+		CreatedBy   struct {
+			UniqueName string `json:"uniqueName"`
+		} `json:"System.CreatedBy"`
+	} `json:"fields"`
+	Links struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"_links"`
+}
+
+func (c *azureDevOpsClient) getWorkItem(ctx context.Context, owner string, number int) (*workItem, error) {
+	var wi workItem
+	path := c.api(fmt.Sprintf("%s/_apis/wit/workitems/%d", url.PathEscape(owner), number), url.Values{"$expand": {"links"}})
+	if err := c.rest.do(ctx, http.MethodGet, path, nil, &wi); err != nil {
+		return nil, err
+	}
+	return &wi, nil
+}
+
+func (c *azureDevOpsClient) GetIssue(ctx context.Context, owner, repo string, number int) (*Issue, error) {
+	wi, err := c.getWorkItem(ctx, owner, number)
+	if err != nil {
+		return nil, err
+	}
+	body := wi.Fields.Description
+	if body == "" {
+		body = wi.Fields.ReproSteps // bugs describe themselves in repro steps
+	}
+	state := "open"
+	if s := strings.ToLower(wi.Fields.State); s == "closed" || s == "done" || s == "removed" || s == "resolved" {
+		state = "closed"
+	}
+	return &Issue{
+		Number:      wi.ID,
+		Title:       wi.Fields.Title,
+		Body:        HTMLToText(body),
+		State:       state,
+		AuthorLogin: wi.Fields.CreatedBy.UniqueName,
+		HTMLURL:     wi.Links.HTML.Href,
+	}, nil
+}
+
+func (c *azureDevOpsClient) ListIssueComments(ctx context.Context, owner, repo string, number int) ([]Comment, error) {
+	var comments struct {
+		Comments []struct {
+			ID        int64  `json:"id"`
+			Text      string `json:"text"`
+			CreatedBy struct {
+				UniqueName string `json:"uniqueName"`
+			} `json:"createdBy"`
+		} `json:"comments"`
+	}
+	path := c.api(fmt.Sprintf("%s/_apis/wit/workItems/%d/comments", url.PathEscape(owner), number), url.Values{"api-version": {azureCommentAPIVersion}})
+	if err := c.rest.do(ctx, http.MethodGet, path, nil, &comments); err != nil {
+		return nil, err
+	}
+	out := make([]Comment, 0, len(comments.Comments))
+	for _, cm := range comments.Comments {
+		out = append(out, Comment{ID: cm.ID, Body: HTMLToText(cm.Text), AuthorLogin: cm.CreatedBy.UniqueName})
+	}
+	return out, nil
+}
+
+func (c *azureDevOpsClient) CreateIssueComment(ctx context.Context, owner, repo string, number int, body string) (*Comment, error) {
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	path := c.api(fmt.Sprintf("%s/_apis/wit/workItems/%d/comments", url.PathEscape(owner), number), url.Values{"api-version": {azureCommentAPIVersion}, "format": {"markdown"}})
+	if err := c.rest.do(ctx, http.MethodPost, path, map[string]string{"text": body}, &created); err != nil {
+		return nil, err
+	}
+	return &Comment{ID: created.ID, Body: body}, nil
+}
+
+func (c *azureDevOpsClient) ListIssueLabels(ctx context.Context, owner, repo string, number int) ([]string, error) {
+	wi, err := c.getWorkItem(ctx, owner, number)
+	if err != nil {
+		return nil, err
+	}
+	return SplitAzureTags(wi.Fields.Tags), nil
+}
+
+// setTags replaces a work item's tags
+func (c *azureDevOpsClient) setTags(ctx context.Context, owner string, number int, tags []string) error {
+	patch, err := jsonBody("application/json-patch+json", []map[string]string{{"op": "add", "path": "/fields/System.Tags", "value": strings.Join(tags, "; ")}})
+	if err != nil {
+		return err
+	}
+	return c.rest.do(ctx, http.MethodPatch, c.api(fmt.Sprintf("%s/_apis/wit/workitems/%d", url.PathEscape(owner), number), nil), patch, nil)
+}
+
+func (c *azureDevOpsClient) AddIssueLabels(ctx context.Context, owner, repo string, number int, labels []string) error {
+	tags, err := c.ListIssueLabels(ctx, owner, repo, number)
+	if err != nil {
+		return err
+	}
+	for _, l := range labels {
+		if !containsFold(tags, l) {
+			tags = append(tags, l)
+		}
+	}
+	return c.setTags(ctx, owner, number, tags)
+}
+
+func (c *azureDevOpsClient) RemoveIssueLabel(ctx context.Context, owner, repo string, number int, label string) error {
+	tags, err := c.ListIssueLabels(ctx, owner, repo, number)
+	if err != nil {
+		return err
+	}
+	kept := tags[:0]
+	for _, t := range tags {
+		if !strings.EqualFold(t, label) {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == len(tags) {
+		return ErrNotFound
+	}
+	return c.setTags(ctx, owner, number, kept)
+}
+
+// Tags need not be created before use, so every label exists
+func (c *azureDevOpsClient) GetLabel(ctx context.Context, owner, repo, name string) (*Label, error) {
+	return &Label{Name: name}, nil
+}
+
+func (c *azureDevOpsClient) CreateLabel(ctx context.Context, owner, repo string, label Label) error {
+	return nil
+}
+
+type azurePullRequest struct {
+	PullRequestID int       `json:"pullRequestId"`
+	Title         string    `json:"title"`
+	Description   string    `json:"description"`
+	SourceRefName string    `json:"sourceRefName"`
+	TargetRefName string    `json:"targetRefName"`
+	Status        string    `json:"status"` // active, completed or abandoned
+	ClosedDate    time.Time `json:"closedDate"`
+	CreatedBy     struct {
+		UniqueName string `json:"uniqueName"`
+	} `json:"createdBy"`
+	Repository struct {
+		Name    string `json:"name"`
+		WebURL  string `json:"webUrl"`
+		Project struct {
+			Name string `json:"name"`
+		} `json:"project"`
+	} `json:"repository"`
+}
+
+// azureDescriptionLimit is the longest pull request description Azure DevOps accepts
+const azureDescriptionLimit = 4000
+
+func (c *azureDevOpsClient) convertPullRequest(pr azurePullRequest) *PullRequest {
+	state := "open"
+	if pr.Status != "active" {
+		state = "closed"
+	}
+	return &PullRequest{
+		Number:      pr.PullRequestID,
+		HTMLURL:     fmt.Sprintf("%s/pullrequest/%d", pr.Repository.WebURL, pr.PullRequestID),
+		Title:       pr.Title,
+		Body:        pr.Description,
+		AuthorLogin: pr.CreatedBy.UniqueName,
+		HeadRef:     strings.TrimPrefix(pr.SourceRefName, "refs/heads/"),
+		BaseRef:     strings.TrimPrefix(pr.TargetRefName, "refs/heads/"),
+		HeadRepo:    pr.Repository.Project.Name + "/" + pr.Repository.Name,
+		State:       state,
+		Merged:      pr.Status == "completed",
+		ClosedAt:    pr.ClosedDate,
+	}
+}
+
+func (c *azureDevOpsClient) CreatePullRequest(ctx context.Context, owner, repo string, pr NewPullRequest) (*PullRequest, error) {
+	var created azurePullRequest
+	err := c.rest.do(ctx, http.MethodPost, c.repoAPI(owner, repo, "/pullrequests", nil), map[string]string{
+		"sourceRefName": "refs/heads/" + pr.Head,
+		"targetRefName": "refs/heads/" + pr.Base,
+		"title":         pr.Title,
+		"description":   truncate(pr.Body, azureDescriptionLimit),
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return c.convertPullRequest(created), nil
+}
+
+func (c *azureDevOpsClient) EditPullRequestBody(ctx context.Context, owner, repo string, number int, body string) error {
+	return c.rest.do(ctx, http.MethodPatch, c.repoAPI(owner, repo, fmt.Sprintf("/pullrequests/%d", number), nil),
+		map[string]string{"description": truncate(body, azureDescriptionLimit)}, nil)
+}
+
+func (c *azureDevOpsClient) ListPullRequests(ctx context.Context, owner, repo, state, head string) ([]PullRequest, error) {
+	status := map[string]string{"open": "active", "closed": "all", "all": "all"}[state]
+	if status == "" {
+		status = "active"
+	}
+	query := url.Values{"searchCriteria.status": {status}, "$top": {"1000"}}
+	if _, branch, ok := strings.Cut(head, ":"); ok {
+		query.Set("searchCriteria.sourceRefName", "refs/heads/"+branch)
+	}
+	var prs struct {
+		Value []azurePullRequest `json:"value"`
+	}
+	if err := c.rest.do(ctx, http.MethodGet, c.repoAPI(owner, repo, "/pullrequests", query), nil, &prs); err != nil {
+		return nil, err
+	}
+	out := make([]PullRequest, 0, len(prs.Value))
+	for _, pr := range prs.Value {
+		converted := c.convertPullRequest(pr)
+		if state == "closed" && converted.State != "closed" {
+			continue
+		}
+		out = append(out, *converted)
+	}
+	return out, nil
+}
+
+func (c *azureDevOpsClient) ListPullRequestFiles(ctx context.Context, owner, repo string, number int) ([]PullRequestFile, error) {
+	var iterations struct {
+		Value []struct {
+			ID int `json:"id"`
+		} `json:"value"`
+	}
+	if err := c.rest.do(ctx, http.MethodGet, c.repoAPI(owner, repo, fmt.Sprintf("/pullrequests/%d/iterations", number), nil), nil, &iterations); err != nil {
+		return nil, err
+	}
+	if len(iterations.Value) == 0 {
+		return nil, nil
+	}
+	// Changes of the latest iteration are relative to the target branch
+	latest := iterations.Value[len(iterations.Value)-1].ID
+	var changes struct {
+		ChangeEntries []struct {
+			ChangeType string `json:"changeType"`
+			Item       struct {
+				Path string `json:"path"`
+			} `json:"item"`
+		} `json:"changeEntries"`
+	}
+	path := c.repoAPI(owner, repo, fmt.Sprintf("/pullrequests/%d/iterations/%d/changes", number, latest), url.Values{"$top": {"2000"}})
+	if err := c.rest.do(ctx, http.MethodGet, path, nil, &changes); err != nil {
+		return nil, err
+	}
+	statuses := map[string]string{"add": "added", "edit": "modified", "delete": "removed", "rename": "renamed"}
+	out := make([]PullRequestFile, 0, len(changes.ChangeEntries))
+	for _, ch := range changes.ChangeEntries {
+		status := statuses[strings.Split(ch.ChangeType, ", ")[0]]
+		if status == "" {
+			status = "modified"
+		}
+		out = append(out, PullRequestFile{Filename: strings.TrimPrefix(ch.Item.Path, "/"), Status: status})
+	}
+	return out, nil
+}
+
+func (c *azureDevOpsClient) ClosePullRequest(ctx context.Context, owner, repo string, number int) error {
+	return c.rest.do(ctx, http.MethodPatch, c.repoAPI(owner, repo, fmt.Sprintf("/pullrequests/%d", number), nil), map[string]string{"status": "abandoned"}, nil)
+}
+
+// SplitAzureTags splits a work item's System.Tags field ("a; b") into tags
+func SplitAzureTags(field string) []string {
+	var tags []string
+	for _, t := range strings.Split(field, ";") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+var (
+	htmlBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|h[1-6])>`)
+	htmlTags   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// HTMLToText reduces the HTML of work item fields and comments to plain text
+func HTMLToText(s string) string {
+	s = htmlBreaks.ReplaceAllString(s, "\n")
+	s = htmlTags.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit-3] + "..."
+}
+
+// jsonBody encodes v as a request body of the given content type
+func jsonBody(contentType string, v any) (rawBody, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return rawBody{}, err
+	}
+	return rawBody{contentType: contentType, data: data}, nil
+}
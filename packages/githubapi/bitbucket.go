@@ -0,0 +1,422 @@
+package githubapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// bitbucketClient implements Client on the Bitbucket Cloud REST API. Repositories are named
+// "<workspace>/<repository>". Bitbucket issues have no labels; an issue's component stands in
+// for one.
+type bitbucketClient struct {
+	unsupported
+	rest   *restClient
+	staged *stagedCommits
+}
+
+// NewBitbucket returns a client for Bitbucket Cloud, e.g. apiURL https://api.bitbucket.org/2.0,
+// authenticated with a repository or workspace access token
+func NewBitbucket(apiURL, token string) Client {
+	return &bitbucketClient{
+		rest: &restClient{
+			baseURL:   apiURL,
+			authorize: func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) },
+		},
+		staged: newStagedCommits(),
+	}
+}
+
+func (c *bitbucketClient) repoAPI(owner, repo, suffix string) string {
+	return fmt.Sprintf("repositories/%s/%s%s", url.PathEscape(owner), url.PathEscape(repo), suffix)
+}
+
+// list fetches every page of a paginated endpoint, calling add with each page's values
+func (c *bitbucketClient) list(ctx context.Context, path string, add func(page *bitbucketPage) error) error {
+	for path != "" {
+		var page bitbucketPage
+		if err := c.rest.do(ctx, http.MethodGet, path, nil, &page); err != nil {
+			return err
+		}
+		if err := add(&page); err != nil {
+			return err
+		}
+		path = page.Next
+	}
+	return nil
+}
+
+type bitbucketPage struct {
+	Values json.RawMessage `json:"values"`
+	Next   string          `json:"next"`
+}
+
+type bitbucketBranch struct {
+	Name   string `json:"name"`
+	Target struct {
+		Hash string `json:"hash"`
+	} `json:"target"`
+}
+
+func (c *bitbucketClient) GetRef(ctx context.Context, owner, repo, ref string) (*Reference, error) {
+	name, ok := strings.CutPrefix(ref, "heads/")
+	if !ok {
+		return nil, ErrUnsupported // only branches are needed
+	}
+	var branch bitbucketBranch
+	if err := c.rest.do(ctx, http.MethodGet, c.repoAPI(owner, repo, "/refs/branches/"+url.PathEscape(name)), nil, &branch); err != nil {
+		return nil, err
+	}
+	return &Reference{Ref: "refs/heads/" + branch.Name, SHA: branch.Target.Hash}, nil
+}
+
+func (c *bitbucketClient) ListBranches(ctx context.Context, owner, repo string) ([]Reference, error) {
+	var out []Reference
+	err := c.list(ctx, c.repoAPI(owner, repo, "/refs/branches?pagelen=100"), func(page *bitbucketPage) error {
+		var branches []bitbucketBranch
+		if err := json.Unmarshal(page.Values, &branches); err != nil {
+			return err
+		}
+		for _, b := range branches {
+			out = append(out, Reference{Ref: "refs/heads/" + b.Name, SHA: b.Target.Hash})
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (c *bitbucketClient) CreateRef(ctx context.Context, owner, repo, ref, sha string) error {
+	name := strings.TrimPrefix(ref, "refs/heads/")
+	if staged := c.staged.take(sha); staged != nil {
+		return c.push(ctx, owner, repo, name, staged)
+	}
+	return c.rest.do(ctx, http.MethodPost, c.repoAPI(owner, repo, "/refs/branches"), map[string]any{
+		"name":   name,
+		"target": map[string]string{"hash": sha},
+	}, nil)
+}
+
+func (c *bitbucketClient) UpdateRef(ctx context.Context, owner, repo, ref, sha string, force bool) error {
+	name := strings.TrimPrefix(strings.TrimPrefix(ref, "refs/"), "heads/")
+	if staged := c.staged.take(sha); staged != nil {
+		return c.push(ctx, owner, repo, name, staged)
+	}
+	// Branches cannot be moved to an existing commit, only recreated on it
+	if !force {
+		return fmt.Errorf("moving %s to an existing commit needs force on Bitbucket: %w", name, ErrUnsupported)
+	}
+	if err := c.DeleteRef(ctx, owner, repo, "heads/"+name); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return c.CreateRef(ctx, owner, repo, "refs/heads/"+name, sha)
+}
+
+func (c *bitbucketClient) DeleteRef(ctx context.Context, owner, repo, ref string) error {
+	name := strings.TrimPrefix(strings.TrimPrefix(ref, "refs/"), "heads/")
+	return c.rest.do(ctx, http.MethodDelete, c.repoAPI(owner, repo, "/refs/branches/"+url.PathEscape(name)), nil, nil)
+}
+
+// push commits the staged files on top of the staged parent and points branch at the result
+func (c *bitbucketClient) push(ctx context.Context, owner, repo, branch string, commit *stagedCommit) error {
+	var form bytes.Buffer
+	w := multipart.NewWriter(&form)
+	fields := map[string]string{"message": commit.Message, "branch": branch, "parents": commit.Parent}
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			return err
+		}
+	}
+	for _, path := range commit.Deleted {
+		// Paths listed under files without content of their own are deleted
+		if err := w.WriteField("files", path); err != nil {
+			return err
+		}
+	}
+	for path, content := range commit.Files {
+		// A form field named after a path sets that file's content
+		if err := w.WriteField(path, content); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.rest.do(ctx, http.MethodPost, c.repoAPI(owner, repo, "/src"), rawBody{contentType: w.FormDataContentType(), data: form.Bytes()}, nil)
+}
+
+func (c *bitbucketClient) GetCommit(ctx context.Context, owner, repo, sha string) (*Commit, error) {
+	var commit struct {
+		Hash    string    `json:"hash"`
+		Message string    `json:"message"`
+		Date    time.Time `json:"date"`
+		Parents []struct {
+			Hash string `json:"hash"`
+		} `json:"parents"`
+	}
+	if err := c.rest.do(ctx, http.MethodGet, c.repoAPI(owner, repo, "/commit/"+url.PathEscape(sha)), nil, &commit); err != nil {
+		return nil, err
+	}
+	// The API exposes no tree IDs; staged trees only need an opaque base
+	out := &Commit{SHA: commit.Hash, TreeSHA: commit.Hash, Message: commit.Message, Date: commit.Date}
+	for _, p := range commit.Parents {
+		out.Parents = append(out.Parents, p.Hash)
+	}
+	return out, nil
+}
+
+func (c *bitbucketClient) CreateBlob(ctx context.Context, owner, repo, content string) (string, error) {
+	return c.staged.createBlob(content), nil
+}
+
+func (c *bitbucketClient) CreateTree(ctx context.Context, owner, repo, baseTreeSHA string, entries []TreeEntry) (string, error) {
+	return c.staged.createTree(entries)
+}
+
+func (c *bitbucketClient) CreateCommit(ctx context.Context, owner, repo, message, treeSHA string, parents []string) (*Commit, error) {
+	return c.staged.createCommit(message, treeSHA, parents)
+}
+
+func (c *bitbucketClient) GetRepository(ctx context.Context, owner, repo string) (*Repository, error) {
+	var r struct {
+		FullName   string `json:"full_name"`
+		MainBranch struct {
+			Name string `json:"name"`
+		} `json:"mainbranch"`
+	}
+	if err := c.rest.do(ctx, http.MethodGet, c.repoAPI(owner, repo, ""), nil, &r); err != nil {
+		return nil, err
+	}
+	return &Repository{FullName: r.FullName, DefaultBranch: r.MainBranch.Name}, nil
+}
+
+func (c *bitbucketClient) CreateFile(ctx context.Context, owner, repo, path, message, branch string, content []byte) error {
+	head, err := c.GetRef(ctx, owner, repo, "heads/"+branch)
+	if err != nil {
+		return err
+	}
+	return c.push(ctx, owner, repo, branch, &stagedCommit{Message: message, Parent: head.SHA, Files: map[string]string{path: string(content)}})
+}
+
+func (c *bitbucketClient) GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error) {
+	var data []byte
+	err := c.rest.do(ctx, http.MethodGet, c.repoAPI(owner, repo, "/src/HEAD/"+strings.TrimPrefix(path, "/")), nil, &data)
+	return data, err
+}
+
+// bitbucketIssue is the part of an issue DevFlow reads
+type bitbucketIssue struct {
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	State   string `json:"state"` // new, open, resolved, on hold, invalid, duplicate, wontfix, closed
+	Content struct {
+		Raw string `json:"raw"`
+	} `json:"content"`
+	Reporter struct {
+		Nickname string `json:"nickname"`
+	} `json:"reporter"`
+	Component *struct {
+		Name string `json:"name"`
+	} `json:"component"`
+	Links struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
+}
+
+func (c *bitbucketClient) GetIssue(ctx context.Context, owner, repo string, number int) (*Issue, error) {
+	var is bitbucketIssue
+	if err := c.rest.do(ctx, http.MethodGet, c.repoAPI(owner, repo, fmt.Sprintf("/issues/%d", number)), nil, &is); err != nil {
+		return nil, err
+	}
+	state := "open"
+	if is.State != "new" && is.State != "open" && is.State != "on hold" {
+		state = "closed"
+	}
+	return &Issue{
+		Number:      is.ID,
+		Title:       is.Title,
+		Body:        is.Content.Raw,
+		State:       state,
+		AuthorLogin: is.Reporter.Nickname,
+		HTMLURL:     is.Links.HTML.Href,
+	}, nil
+}
+
+func (c *bitbucketClient) ListIssueComments(ctx context.Context, owner, repo string, number int) ([]Comment, error) {
+	var out []Comment
+	err := c.list(ctx, c.repoAPI(owner, repo, fmt.Sprintf("/issues/%d/comments?pagelen=100", number)), func(page *bitbucketPage) error {
+		var comments []struct {
+			ID      int64 `json:"id"`
+			Content struct {
+				Raw string `json:"raw"`
+			} `json:"content"`
+			User struct {
+				Nickname string `json:"nickname"`
+			} `json:"user"`
+		}
+		if err := json.Unmarshal(page.Values, &comments); err != nil {
+			return err
+		}
+		for _, cm := range comments {
+			out = append(out, Comment{ID: cm.ID, Body: cm.Content.Raw, AuthorLogin: cm.User.Nickname})
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (c *bitbucketClient) CreateIssueComment(ctx context.Context, owner, repo string, number int, body string) (*Comment, error) {
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	err := c.rest.do(ctx, http.MethodPost, c.repoAPI(owner, repo, fmt.Sprintf("/issues/%d/comments", number)),
+		map[string]any{"content": map[string]string{"raw": body}}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &Comment{ID: created.ID, Body: body}, nil
+}
+
+func (c *bitbucketClient) ListIssueLabels(ctx context.Context, owner, repo string, number int) ([]string, error) {
+	var is bitbucketIssue
+	if err := c.rest.do(ctx, http.MethodGet, c.repoAPI(owner, repo, fmt.Sprintf("/issues/%d", number)), nil, &is); err != nil {
+		return nil, err
+	}
+	if is.Component == nil {
+		return nil, nil
+	}
+	return []string{is.Component.Name}, nil
+}
+
+type bitbucketPullRequest struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	State       string    `json:"state"` // OPEN, MERGED, DECLINED or SUPERSEDED
+	UpdatedOn   time.Time `json:"updated_on"`
+	Author      struct {
+		Nickname string `json:"nickname"`
+	} `json:"author"`
+	Source      bitbucketEndpoint `json:"source"`
+	Destination bitbucketEndpoint `json:"destination"`
+	Links       struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
+}
+
+type bitbucketEndpoint struct {
+	Branch struct {
+		Name string `json:"name"`
+	} `json:"branch"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+func convertBitbucketPullRequest(pr bitbucketPullRequest) *PullRequest {
+	out := &PullRequest{
+		Number:      pr.ID,
+		HTMLURL:     pr.Links.HTML.Href,
+		Title:       pr.Title,
+		Body:        pr.Description,
+		AuthorLogin: pr.Author.Nickname,
+		HeadRef:     pr.Source.Branch.Name,
+		BaseRef:     pr.Destination.Branch.Name,
+		HeadRepo:    pr.Source.Repository.FullName,
+		State:       "open",
+		Merged:      pr.State == "MERGED",
+	}
+	if pr.State != "OPEN" {
+		out.State = "closed"
+		out.ClosedAt = pr.UpdatedOn // closing is the last update a closed PR gets
+	}
+	return out
+}
+
+func (c *bitbucketClient) CreatePullRequest(ctx context.Context, owner, repo string, pr NewPullRequest) (*PullRequest, error) {
+	var created bitbucketPullRequest
+	err := c.rest.do(ctx, http.MethodPost, c.repoAPI(owner, repo, "/pullrequests"), map[string]any{
+		"title":       pr.Title,
+		"description": pr.Body,
+		"source":      map[string]any{"branch": map[string]string{"name": pr.Head}},
+		"destination": map[string]any{"branch": map[string]string{"name": pr.Base}},
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return convertBitbucketPullRequest(created), nil
+}
+
+func (c *bitbucketClient) EditPullRequestBody(ctx context.Context, owner, repo string, number int, body string) error {
+	return c.rest.do(ctx, http.MethodPut, c.repoAPI(owner, repo, fmt.Sprintf("/pullrequests/%d", number)), map[string]string{"description": body}, nil)
+}
+
+func (c *bitbucketClient) ListPullRequests(ctx context.Context, owner, repo, state, head string) ([]PullRequest, error) {
+	query := url.Values{"pagelen": {"50"}}
+	switch state {
+	case "closed":
+		query["state"] = []string{"MERGED", "DECLINED", "SUPERSEDED"}
+	case "all":
+		query["state"] = []string{"OPEN", "MERGED", "DECLINED", "SUPERSEDED"}
+	default:
+		query["state"] = []string{"OPEN"}
+	}
+	if _, branch, ok := strings.Cut(head, ":"); ok {
+		query.Set("q", fmt.Sprintf("source.branch.name = %q", branch))
+	}
+	var out []PullRequest
+	err := c.list(ctx, c.repoAPI(owner, repo, "/pullrequests?"+query.Encode()), func(page *bitbucketPage) error {
+		var prs []bitbucketPullRequest
+		if err := json.Unmarshal(page.Values, &prs); err != nil {
+			return err
+		}
+		for _, pr := range prs {
+			out = append(out, *convertBitbucketPullRequest(pr))
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (c *bitbucketClient) ListPullRequestFiles(ctx context.Context, owner, repo string, number int) ([]PullRequestFile, error) {
+	var out []PullRequestFile
+	err := c.list(ctx, c.repoAPI(owner, repo, fmt.Sprintf("/pullrequests/%d/diffstat?pagelen=100", number)), func(page *bitbucketPage) error {
+		var stats []struct {
+			Status string `json:"status"` // added, removed, modified or renamed
+			Old    *struct {
+				Path string `json:"path"`
+			} `json:"old"`
+			New *struct {
+				Path string `json:"path"`
+			} `json:"new"`
+		}
+		if err := json.Unmarshal(page.Values, &stats); err != nil {
+			return err
+		}
+		for _, s := range stats {
+			f := PullRequestFile{Status: s.Status}
+			if s.New != nil {
+				f.Filename = s.New.Path
+			} else if s.Old != nil {
+				f.Filename = s.Old.Path
+			}
+			out = append(out, f)
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (c *bitbucketClient) ClosePullRequest(ctx context.Context, owner, repo string, number int) error {
+	return c.rest.do(ctx, http.MethodPost, c.repoAPI(owner, repo, fmt.Sprintf("/pullrequests/%d/decline", number)), nil, nil)
+}
@@ -0,0 +1,250 @@
+// Package githubapi defines the GitHub operations devflow performs, independent of the
+// client library used to perform them, so the library can be upgraded or faked.
+package githubapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the requested GitHub resource does not exist
+var ErrNotFound = errors.New("github resource not found")
+
+// ErrUnsupported is returned by providers other than GitHub for operations their host lacks
+var ErrUnsupported = errors.New("operation not supported by this provider")
+
+// Reference is a git ref such as "refs/heads/main"
+type Reference struct {
+	Ref string
+	SHA string
+}
+
+// Commit is a git commit (for ListCommits, AuthorLogin is the GitHub login of the author)
+type Commit struct {
+	SHA         string
+	TreeSHA     string
+	Message     string
+	AuthorLogin string
+	AuthorEmail string // set by ListCommits
+	Parents     []string
+	Date        time.Time // committer date; set by GetCommit
+}
+
+// TreeEntry is a file entry in a git tree. An entry with Delete set removes Path from the
+// base tree; its mode and SHA are ignored.
+type TreeEntry struct {
+	Path   string
+	Mode   string
+	Type   string
+	SHA    string
+	Delete bool
+}
+
+// Modes of a tree entry
+const (
+	ModeFile       = "100644"
+	ModeExecutable = "100755"
+	ModeSymlink    = "120000" // the blob holds the link target
+)
+
+// Repository holds the repository attributes devflow needs
+type Repository struct {
+	FullName      string
+	DefaultBranch string
+	Archived      bool
+	// CanPush is whether the authenticated user may push; nil when the host does not say, as
+	// for GitHub App installation tokens
+	CanPush *bool
+}
+
+// BranchRule is a ruleset rule applying to a branch, e.g. "creation", "update" or
+// "branch_name_pattern", with its parameters undecoded
+type BranchRule struct {
+	Type       string          `json:"type"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+	RulesetID  int64           `json:"ruleset_id"`
+}
+
+// Ruleset is a repository or organization ruleset. CurrentUserCanBypass says whether the
+// caller, e.g. the app's installation, is on its bypass list: "always",
+// "pull_requests_only" or "never".
+type Ruleset struct {
+	ID                   int64  `json:"id"`
+	Name                 string `json:"name"`
+	CurrentUserCanBypass string `json:"current_user_can_bypass"`
+}
+
+// Issue is an issue or pull request as seen through the issues API
+type Issue struct {
+	Number        int
+	Title         string
+	Body          string
+	State         string
+	AuthorLogin   string
+	IsPullRequest bool
+	HTMLURL       string
+	NodeID        string // GraphQL ID
+	Milestone     int    // milestone number; 0 when none
+	ThumbsUp      int    // 👍 reactions
+	RepoName      string // full name of the issue's repository; only set by ListSubIssues
+}
+
+// NewIssue describes an issue to open
+type NewIssue struct {
+	Title  string
+	Body   string
+	Labels []string
+}
+
+// Comment is a comment on an issue or pull request
+type Comment struct {
+	ID          int64
+	Body        string
+	AuthorLogin string
+}
+
+// Label is a repository label
+type Label struct {
+	Name        string
+	Color       string
+	Description string
+}
+
+// NewPullRequest describes a pull request to open
+type NewPullRequest struct {
+	Title               string
+	Head                string
+	Base                string
+	Body                string
+	MaintainerCanModify bool
+}
+
+// PullRequest is a pull request. Title, AuthorLogin, State, Merged, ClosedAt and HeadRepo
+// are only set by ListPullRequests.
+type PullRequest struct {
+	Number      int
+	HTMLURL     string
+	NodeID      string // GraphQL ID
+	Title       string
+	Body        string
+	AuthorLogin string
+	HeadRef     string
+	BaseRef     string
+	HeadRepo    string // full name of the repository holding the head branch
+	State       string // "open" or "closed"
+	Merged      bool
+	ClosedAt    time.Time
+}
+
+// ReviewComment is a pull request review comment on lines StartLine..Line of Path as of
+// CommitID (a single line when StartLine is 0)
+type ReviewComment struct {
+	Body      string
+	Path      string
+	CommitID  string
+	StartLine int
+	Line      int
+}
+
+// Review is a pull request review; State is "APPROVED", "CHANGES_REQUESTED", "COMMENTED",
+// "DISMISSED" or "PENDING"
+type Review struct {
+	AuthorLogin string
+	State       string
+}
+
+// PullRequestFile is a file changed by a pull request
+type PullRequestFile struct {
+	Filename string
+	Status   string
+	Patch    string
+}
+
+// Pager fetches every page of a REST list endpoint and decodes all items into out, a pointer to
+// a slice. path is relative to the API root and may carry a query.
+type Pager func(ctx context.Context, path string, out any) error
+
+// Client is the set of GitHub operations used by devflow
+type Client interface {
+	// Git data
+	GetRef(ctx context.Context, owner, repo, ref string) (*Reference, error)
+	CreateRef(ctx context.Context, owner, repo, ref, sha string) error
+	UpdateRef(ctx context.Context, owner, repo, ref, sha string, force bool) error
+	GetCommit(ctx context.Context, owner, repo, sha string) (*Commit, error)
+	CreateCommit(ctx context.Context, owner, repo, message, treeSHA string, parents []string) (*Commit, error)
+	CreateBlob(ctx context.Context, owner, repo, content string) (string, error)
+	CreateTree(ctx context.Context, owner, repo, baseTreeSHA string, entries []TreeEntry) (string, error)
+	// ListBranches returns the heads of all branches, as refs/heads/<name>
+	ListBranches(ctx context.Context, owner, repo string) ([]Reference, error)
+	DeleteRef(ctx context.Context, owner, repo, ref string) error
+	// ListBranchRules returns the ruleset rules that apply to a branch, which need not exist
+	ListBranchRules(ctx context.Context, owner, repo, branch string) ([]BranchRule, error)
+	// GetRuleset returns a ruleset applying to the repository, organization rulesets included
+	GetRuleset(ctx context.Context, owner, repo string, id int64) (*Ruleset, error)
+
+	// Repositories
+	GetRepository(ctx context.Context, owner, repo string) (*Repository, error)
+	CreateFile(ctx context.Context, owner, repo, path, message, branch string, content []byte) error
+	ListCommits(ctx context.Context, owner, repo, path string, limit int) ([]Commit, error)
+	GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error)
+
+	// Issues, comments, labels and reactions
+	GetIssue(ctx context.Context, owner, repo string, number int) (*Issue, error)
+	CreateIssue(ctx context.Context, owner, repo string, issue NewIssue) (*Issue, error)
+	ListIssueComments(ctx context.Context, owner, repo string, number int) ([]Comment, error)
+	CreateIssueComment(ctx context.Context, owner, repo string, number int, body string) (*Comment, error)
+	EditIssueComment(ctx context.Context, owner, repo string, commentID int64, body string) error
+	ListIssueLabels(ctx context.Context, owner, repo string, number int) ([]string, error)
+	AddIssueLabels(ctx context.Context, owner, repo string, number int, labels []string) error
+	RemoveIssueLabel(ctx context.Context, owner, repo string, number int, label string) error
+	GetLabel(ctx context.Context, owner, repo, name string) (*Label, error)
+	CreateLabel(ctx context.Context, owner, repo string, label Label) error
+	DeleteLabel(ctx context.Context, owner, repo, name string) error
+	CreateIssueReaction(ctx context.Context, owner, repo string, number int, content string) error
+	CreateCommentReaction(ctx context.Context, owner, repo string, commentID int64, content string) error
+	SetIssueMilestone(ctx context.Context, owner, repo string, number, milestone int) error
+	// ListSubIssues returns the sub-issues of an issue, which may belong to other repositories
+	ListSubIssues(ctx context.Context, owner, repo string, number int) ([]Issue, error)
+
+	// Organizations
+	// IsTeamMember reports whether user is an active member of the team org/teamSlug
+	IsTeamMember(ctx context.Context, org, teamSlug, user string) (bool, error)
+
+	// Pull requests
+	CreatePullRequest(ctx context.Context, owner, repo string, pr NewPullRequest) (*PullRequest, error)
+	EditPullRequestBody(ctx context.Context, owner, repo string, number int, body string) error
+	ListPullRequestFiles(ctx context.Context, owner, repo string, number int) ([]PullRequestFile, error)
+	RequestReviewers(ctx context.Context, owner, repo string, number int, reviewers []string) error
+	// ListReviews returns a pull request's reviews, oldest first
+	ListReviews(ctx context.Context, owner, repo string, number int) ([]Review, error)
+	// CreateReviewComment comments on lines of a pull request's diff, returning the comment's URL
+	CreateReviewComment(ctx context.Context, owner, repo string, number int, comment ReviewComment) (string, error)
+	// ListPullRequests lists pull requests in a state ("open", "closed" or "all"), only those
+	// from the branch head ("owner:branch") when it is not empty
+	ListPullRequests(ctx context.Context, owner, repo, state, head string) ([]PullRequest, error)
+	ClosePullRequest(ctx context.Context, owner, repo string, number int) error
+	// EnableAutoMerge merges a pull request once its required reviews and checks pass, with
+	// method "MERGE", "SQUASH" or "REBASE"
+	EnableAutoMerge(ctx context.Context, prNodeID, method string) error
+
+	// Discussions and Projects (v2), which are only exposed through GraphQL
+	AddDiscussionComment(ctx context.Context, discussionNodeID, body string) error
+	// AddProjectItem adds an issue or PR to a project, returning its item (the existing one
+	// if it is already there)
+	AddProjectItem(ctx context.Context, projectNodeID, contentNodeID string) (string, error)
+	// SetProjectItemOption sets a single-select field (e.g. Status) of an item by option name
+	SetProjectItemOption(ctx context.Context, projectNodeID, itemID, field, option string) error
+}
+
+// SplitRepoName splits "owner/repo" into its parts
+func SplitRepoName(repoName string) (string, string, error) {
+	parts := strings.Split(repoName, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid repository name format %q, expected 'owner/repo'", repoName)
+	}
+	return parts[0], parts[1], nil
+}
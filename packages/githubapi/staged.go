@@ -0,0 +1,182 @@
+package githubapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// stagedCommits emulates the git data API on hosts that only accept whole commits: blobs,
+// trees and commits are kept in memory, and the provider pushes a staged commit's files when
+// a ref is pointed at it. Base trees are the parent commit's, so only changed files are kept.
+// File modes are not kept: these hosts' push APIs write regular files.
+type stagedCommits struct {
+	mu      sync.Mutex
+	blobs   map[string]string
+	trees   map[string]stagedTree
+	commits map[string]*stagedCommit
+}
+
+// stagedTree is the change a staged tree makes to its base
+type stagedTree struct {
+	Files   map[string]string // path -> content
+	Deleted []string
+}
+
+// stagedCommit is a commit waiting to be pushed
+type stagedCommit struct {
+	Message string
+	Parent  string
+	Files   map[string]string // path -> content
+	Deleted []string          // paths removed
+}
+
+const (
+	stagedBlobPrefix   = "staged-blob-"
+	stagedTreePrefix   = "staged-tree-"
+	stagedCommitPrefix = "staged-commit-"
+)
+
+func newStagedCommits() *stagedCommits {
+	return &stagedCommits{blobs: map[string]string{}, trees: map[string]stagedTree{}, commits: map[string]*stagedCommit{}}
+}
+
+func stagedID(prefix string, parts ...string) string {
+	sum := sha1.Sum([]byte(strings.Join(parts, "\x00")))
+	return prefix + hex.EncodeToString(sum[:])
+}
+
+func (s *stagedCommits) createBlob(content string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := stagedID(stagedBlobPrefix, content)
+	s.blobs[id] = content
+	return id
+}
+
+func (s *stagedCommits) createTree(entries []TreeEntry) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tree := stagedTree{Files: make(map[string]string, len(entries))}
+	parts := make([]string, 0, 2*len(entries))
+	for _, e := range entries {
+		if e.Delete {
+			tree.Deleted = append(tree.Deleted, e.Path)
+			parts = append(parts, e.Path, "deleted")
+			continue
+		}
+		content, ok := s.blobs[e.SHA]
+		if !ok {
+			return "", fmt.Errorf("tree entry %s refers to unknown blob %s", e.Path, e.SHA)
+		}
+		tree.Files[e.Path] = content
+		parts = append(parts, e.Path, e.SHA)
+	}
+	sort.Strings(parts)
+	id := stagedID(stagedTreePrefix, parts...)
+	s.trees[id] = tree
+	return id, nil
+}
+
+func (s *stagedCommits) createCommit(message, treeSHA string, parents []string) (*Commit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tree, ok := s.trees[treeSHA]
+	if !ok {
+		return nil, fmt.Errorf("unknown tree %s", treeSHA)
+	}
+	if len(parents) != 1 {
+		return nil, fmt.Errorf("commits need exactly one parent, got %d", len(parents))
+	}
+	id := stagedID(stagedCommitPrefix, message, treeSHA, parents[0])
+	s.commits[id] = &stagedCommit{Message: message, Parent: parents[0], Files: tree.Files, Deleted: tree.Deleted}
+	return &Commit{SHA: id, TreeSHA: treeSHA, Message: message, Parents: parents}, nil
+}
+
+// take removes and returns the staged commit with the given ID, or nil when sha is a real one
+func (s *stagedCommits) take(sha string) *stagedCommit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.commits[sha]
+	delete(s.commits, sha)
+	return c
+}
+
+// restClient sends JSON requests to a provider's REST API
+type restClient struct {
+	baseURL   string
+	authorize func(req *http.Request)
+	http      *http.Client
+}
+
+// do sends a request with an optional JSON body and decodes a JSON reply into out. A 404
+// becomes ErrNotFound.
+func (c *restClient) do(ctx context.Context, method, url string, body, out any) error {
+	var reader io.Reader
+	contentType := "application/json"
+	switch b := body.(type) {
+	case nil:
+	case rawBody:
+		reader, contentType = bytes.NewReader(b.data), b.contentType
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = strings.TrimRight(c.baseURL, "/") + "/" + strings.TrimLeft(url, "/")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	c.authorize(req)
+
+	client := c.http
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned %d: %s", method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if raw, ok := out.(*[]byte); ok {
+		*raw = data
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// rawBody is a request body sent as is, such as a multipart form or a JSON patch
+type rawBody struct {
+	contentType string
+	data        []byte
+}
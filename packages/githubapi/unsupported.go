@@ -0,0 +1,139 @@
+package githubapi
+
+import "context"
+
+// unsupported implements Client with every operation failing with ErrUnsupported. Providers
+// embed it and override what their host offers.
+type unsupported struct{}
+
+func (unsupported) GetRef(context.Context, string, string, string) (*Reference, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) CreateRef(context.Context, string, string, string, string) error {
+	return ErrUnsupported
+}
+func (unsupported) UpdateRef(context.Context, string, string, string, string, bool) error {
+	return ErrUnsupported
+}
+func (unsupported) GetCommit(context.Context, string, string, string) (*Commit, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) CreateCommit(context.Context, string, string, string, string, []string) (*Commit, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) CreateBlob(context.Context, string, string, string) (string, error) {
+	return "", ErrUnsupported
+}
+func (unsupported) CreateTree(context.Context, string, string, string, []TreeEntry) (string, error) {
+	return "", ErrUnsupported
+}
+func (unsupported) ListBranches(context.Context, string, string) ([]Reference, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) DeleteRef(context.Context, string, string, string) error {
+	return ErrUnsupported
+}
+func (unsupported) ListBranchRules(context.Context, string, string, string) ([]BranchRule, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) GetRuleset(context.Context, string, string, int64) (*Ruleset, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) GetRepository(context.Context, string, string) (*Repository, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) CreateFile(context.Context, string, string, string, string, string, []byte) error {
+	return ErrUnsupported
+}
+func (unsupported) ListCommits(context.Context, string, string, string, int) ([]Commit, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) GetFileContent(context.Context, string, string, string) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) GetIssue(context.Context, string, string, int) (*Issue, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) CreateIssue(context.Context, string, string, NewIssue) (*Issue, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) ListIssueComments(context.Context, string, string, int) ([]Comment, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) CreateIssueComment(context.Context, string, string, int, string) (*Comment, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) EditIssueComment(context.Context, string, string, int64, string) error {
+	return ErrUnsupported
+}
+func (unsupported) ListIssueLabels(context.Context, string, string, int) ([]string, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) AddIssueLabels(context.Context, string, string, int, []string) error {
+	return ErrUnsupported
+}
+func (unsupported) RemoveIssueLabel(context.Context, string, string, int, string) error {
+	return ErrUnsupported
+}
+func (unsupported) GetLabel(context.Context, string, string, string) (*Label, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) CreateLabel(context.Context, string, string, Label) error {
+	return ErrUnsupported
+}
+func (unsupported) DeleteLabel(context.Context, string, string, string) error {
+	return ErrUnsupported
+}
+func (unsupported) CreateIssueReaction(context.Context, string, string, int, string) error {
+	return ErrUnsupported
+}
+func (unsupported) CreateCommentReaction(context.Context, string, string, int64, string) error {
+	return ErrUnsupported
+}
+func (unsupported) SetIssueMilestone(context.Context, string, string, int, int) error {
+	return ErrUnsupported
+}
+func (unsupported) ListSubIssues(context.Context, string, string, int) ([]Issue, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) IsTeamMember(context.Context, string, string, string) (bool, error) {
+	return false, ErrUnsupported
+}
+func (unsupported) CreatePullRequest(context.Context, string, string, NewPullRequest) (*PullRequest, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) EditPullRequestBody(context.Context, string, string, int, string) error {
+	return ErrUnsupported
+}
+func (unsupported) ListPullRequestFiles(context.Context, string, string, int) ([]PullRequestFile, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) RequestReviewers(context.Context, string, string, int, []string) error {
+	return ErrUnsupported
+}
+func (unsupported) ListReviews(context.Context, string, string, int) ([]Review, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) CreateReviewComment(context.Context, string, string, int, ReviewComment) (string, error) {
+	return "", ErrUnsupported
+}
+func (unsupported) ListPullRequests(context.Context, string, string, string, string) ([]PullRequest, error) {
+	return nil, ErrUnsupported
+}
+func (unsupported) ClosePullRequest(context.Context, string, string, int) error {
+	return ErrUnsupported
+}
+func (unsupported) EnableAutoMerge(context.Context, string, string) error {
+	return ErrUnsupported
+}
+func (unsupported) AddDiscussionComment(context.Context, string, string) error {
+	return ErrUnsupported
+}
+func (unsupported) AddProjectItem(context.Context, string, string) (string, error) {
+	return "", ErrUnsupported
+}
+func (unsupported) SetProjectItemOption(context.Context, string, string, string, string) error {
+	return ErrUnsupported
+}
+
+var _ Client = unsupported{}
@@ -0,0 +1,604 @@
+package githubapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// v17Client implements Client on top of go-github v17, the version go-probot is built on
+type v17Client struct {
+	gh    *github.Client
+	pager Pager
+}
+
+// NewV17 wraps a go-github v17 client; list operations fetch all their pages through pager
+func NewV17(gh *github.Client, pager Pager) Client {
+	return &v17Client{gh: gh, pager: pager}
+}
+
+// wrapErr maps 404 responses to ErrNotFound
+func wrapErr(resp *github.Response, err error) error {
+	if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// list fetches every page of a list endpoint, mapping a 404 to ErrNotFound
+func (c *v17Client) list(ctx context.Context, path string, out any) error {
+	err := c.pager(ctx, path, out)
+	var errResp *github.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (c *v17Client) GetRef(ctx context.Context, owner, repo, ref string) (*Reference, error) {
+	r, resp, err := c.gh.Git.GetRef(ctx, owner, repo, ref)
+	if err != nil {
+		return nil, wrapErr(resp, err)
+	}
+	return &Reference{Ref: r.GetRef(), SHA: r.GetObject().GetSHA()}, nil
+}
+
+func (c *v17Client) CreateRef(ctx context.Context, owner, repo, ref, sha string) error {
+	_, resp, err := c.gh.Git.CreateRef(ctx, owner, repo, &github.Reference{
+		Ref:    github.String(ref),
+		Object: &github.GitObject{SHA: github.String(sha)},
+	})
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) UpdateRef(ctx context.Context, owner, repo, ref, sha string, force bool) error {
+	_, resp, err := c.gh.Git.UpdateRef(ctx, owner, repo, &github.Reference{
+		Ref:    github.String(ref),
+		Object: &github.GitObject{SHA: github.String(sha)},
+	}, force)
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) GetCommit(ctx context.Context, owner, repo, sha string) (*Commit, error) {
+	commit, resp, err := c.gh.Git.GetCommit(ctx, owner, repo, sha)
+	if err != nil {
+		return nil, wrapErr(resp, err)
+	}
+	out := &Commit{SHA: commit.GetSHA(), TreeSHA: commit.GetTree().GetSHA(), Message: commit.GetMessage(), Date: commit.GetCommitter().GetDate()}
+	for _, p := range commit.Parents {
+		out.Parents = append(out.Parents, p.GetSHA())
+	}
+	return out, nil
+}
+
+func (c *v17Client) CreateCommit(ctx context.Context, owner, repo, message, treeSHA string, parents []string) (*Commit, error) {
+	parentCommits := make([]github.Commit, len(parents))
+	for i, sha := range parents {
+		parentCommits[i] = github.Commit{SHA: github.String(sha)}
+	}
+	created, resp, err := c.gh.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+		Message: github.String(message),
+		Tree:    &github.Tree{SHA: github.String(treeSHA)},
+		Parents: parentCommits,
+	})
+	if err != nil {
+		return nil, wrapErr(resp, err)
+	}
+	return &Commit{SHA: created.GetSHA(), TreeSHA: treeSHA, Message: message, Parents: parents}, nil
+}
+
+func (c *v17Client) CreateBlob(ctx context.Context, owner, repo, content string) (string, error) {
+	blob, resp, err := c.gh.Git.CreateBlob(ctx, owner, repo, &github.Blob{
+		Content:  github.String(content),
+		Encoding: github.String("utf-8"),
+	})
+	if err != nil {
+		return "", wrapErr(resp, err)
+	}
+	return blob.GetSHA(), nil
+}
+
+// v17TreeEntry is a tree entry as the API takes it. go-github drops a nil SHA, but deleting a
+// path takes an explicit "sha": null.
+type v17TreeEntry struct {
+	Path string  `json:"path"`
+	Mode string  `json:"mode"`
+	Type string  `json:"type"`
+	SHA  *string `json:"sha"`
+}
+
+func (c *v17Client) CreateTree(ctx context.Context, owner, repo, baseTreeSHA string, entries []TreeEntry) (string, error) {
+	body := struct {
+		BaseTree string         `json:"base_tree,omitempty"`
+		Tree     []v17TreeEntry `json:"tree"`
+	}{BaseTree: baseTreeSHA, Tree: make([]v17TreeEntry, len(entries))}
+	for i, e := range entries {
+		entry := v17TreeEntry{Path: e.Path, Mode: e.Mode, Type: e.Type, SHA: github.String(e.SHA)}
+		if e.Delete {
+			entry.Mode, entry.Type, entry.SHA = ModeFile, "blob", nil
+		}
+		body.Tree[i] = entry
+	}
+	req, err := c.gh.NewRequest(http.MethodPost, fmt.Sprintf("repos/%s/%s/git/trees", owner, repo), &body)
+	if err != nil {
+		return "", err
+	}
+	tree := new(github.Tree)
+	resp, err := c.gh.Do(ctx, req, tree)
+	if err != nil {
+		return "", wrapErr(resp, err)
+	}
+	return tree.GetSHA(), nil
+}
+
+func (c *v17Client) ListBranches(ctx context.Context, owner, repo string) ([]Reference, error) {
+	var refs []*github.Reference
+	if err := c.list(ctx, fmt.Sprintf("repos/%s/%s/git/refs/heads", owner, repo), &refs); err != nil {
+		return nil, err
+	}
+	out := make([]Reference, 0, len(refs))
+	for _, r := range refs {
+		out = append(out, Reference{Ref: r.GetRef(), SHA: r.GetObject().GetSHA()})
+	}
+	return out, nil
+}
+
+func (c *v17Client) DeleteRef(ctx context.Context, owner, repo, ref string) error {
+	resp, err := c.gh.Git.DeleteRef(ctx, owner, repo, ref)
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) ListBranchRules(ctx context.Context, owner, repo, branch string) ([]BranchRule, error) {
+	segments := strings.Split(branch, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	var rules []BranchRule
+	if err := c.list(ctx, fmt.Sprintf("repos/%s/%s/rules/branches/%s", owner, repo, strings.Join(segments, "/")), &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (c *v17Client) GetRuleset(ctx context.Context, owner, repo string, id int64) (*Ruleset, error) {
+	req, err := c.gh.NewRequest("GET", fmt.Sprintf("repos/%s/%s/rulesets/%d?includes_parents=true", owner, repo, id), nil)
+	if err != nil {
+		return nil, err
+	}
+	var ruleset Ruleset
+	resp, err := c.gh.Do(ctx, req, &ruleset)
+	if err != nil {
+		return nil, wrapErr(resp, err)
+	}
+	return &ruleset, nil
+}
+
+func (c *v17Client) GetRepository(ctx context.Context, owner, repo string) (*Repository, error) {
+	r, resp, err := c.gh.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return nil, wrapErr(resp, err)
+	}
+	out := &Repository{FullName: r.GetFullName(), DefaultBranch: r.GetDefaultBranch(), Archived: r.GetArchived()}
+	if r.Permissions != nil {
+		if push, ok := (*r.Permissions)["push"]; ok {
+			out.CanPush = &push
+		}
+	}
+	return out, nil
+}
+
+func (c *v17Client) CreateFile(ctx context.Context, owner, repo, path, message, branch string, content []byte) error {
+	_, resp, err := c.gh.Repositories.CreateFile(ctx, owner, repo, path, &github.RepositoryContentFileOptions{
+		Message: github.String(message),
+		Content: content,
+		Branch:  github.String(branch),
+	})
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) ListCommits(ctx context.Context, owner, repo, path string, limit int) ([]Commit, error) {
+	commits, resp, err := c.gh.Repositories.ListCommits(ctx, owner, repo, &github.CommitsListOptions{
+		Path:        path,
+		ListOptions: github.ListOptions{PerPage: limit},
+	})
+	if err != nil {
+		return nil, wrapErr(resp, err)
+	}
+	out := make([]Commit, 0, len(commits))
+	for _, rc := range commits {
+		out = append(out, Commit{
+			SHA:         rc.GetSHA(),
+			Message:     rc.GetCommit().GetMessage(),
+			AuthorLogin: rc.GetAuthor().GetLogin(),
+			AuthorEmail: rc.GetCommit().GetAuthor().GetEmail(),
+		})
+	}
+	return out, nil
+}
+
+func (c *v17Client) GetFileContent(ctx context.Context, owner, repo, path string) ([]byte, error) {
+	file, _, resp, err := c.gh.Repositories.GetContents(ctx, owner, repo, path, nil)
+	if err != nil {
+		return nil, wrapErr(resp, err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+func (c *v17Client) GetIssue(ctx context.Context, owner, repo string, number int) (*Issue, error) {
+	issue, resp, err := c.gh.Issues.Get(ctx, owner, repo, number)
+	if err != nil {
+		return nil, wrapErr(resp, err)
+	}
+	return convertIssue(issue), nil
+}
+
+func (c *v17Client) CreateIssue(ctx context.Context, owner, repo string, issue NewIssue) (*Issue, error) {
+	req := &github.IssueRequest{Title: github.String(issue.Title), Body: github.String(issue.Body)}
+	if len(issue.Labels) > 0 {
+		req.Labels = &issue.Labels
+	}
+	created, resp, err := c.gh.Issues.Create(ctx, owner, repo, req)
+	if err != nil {
+		return nil, wrapErr(resp, err)
+	}
+	return convertIssue(created), nil
+}
+
+func convertIssue(issue *github.Issue) *Issue {
+	return &Issue{
+		Number:        issue.GetNumber(),
+		Title:         issue.GetTitle(),
+		Body:          issue.GetBody(),
+		State:         issue.GetState(),
+		AuthorLogin:   issue.GetUser().GetLogin(),
+		IsPullRequest: issue.IsPullRequest(),
+		HTMLURL:       issue.GetHTMLURL(),
+		NodeID:        issue.GetNodeID(),
+		Milestone:     issue.GetMilestone().GetNumber(),
+		ThumbsUp:      issue.GetReactions().GetPlusOne(),
+	}
+}
+
+func (c *v17Client) SetIssueMilestone(ctx context.Context, owner, repo string, number, milestone int) error {
+	_, resp, err := c.gh.Issues.Edit(ctx, owner, repo, number, &github.IssueRequest{Milestone: &milestone})
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) ListSubIssues(ctx context.Context, owner, repo string, number int) ([]Issue, error) {
+	var issues []*github.Issue
+	if err := c.list(ctx, fmt.Sprintf("repos/%s/%s/issues/%d/sub_issues", owner, repo, number), &issues); err != nil {
+		return nil, err
+	}
+	out := make([]Issue, 0, len(issues))
+	for _, issue := range issues {
+		sub := convertIssue(issue)
+		// repository_url is https://api.github.com/repos/<owner>/<repo>
+		if _, name, ok := strings.Cut(issue.GetRepositoryURL(), "/repos/"); ok {
+			sub.RepoName = name
+		}
+		out = append(out, *sub)
+	}
+	return out, nil
+}
+
+func (c *v17Client) IsTeamMember(ctx context.Context, org, teamSlug, user string) (bool, error) {
+	req, err := c.gh.NewRequest("GET", fmt.Sprintf("orgs/%s/teams/%s/memberships/%s", org, teamSlug, user), nil)
+	if err != nil {
+		return false, err
+	}
+	var membership github.Membership
+	resp, err := c.gh.Do(ctx, req, &membership)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return membership.GetState() == "active", nil
+}
+
+func (c *v17Client) ListIssueComments(ctx context.Context, owner, repo string, number int) ([]Comment, error) {
+	var comments []*github.IssueComment
+	if err := c.list(ctx, fmt.Sprintf("repos/%s/%s/issues/%d/comments", owner, repo, number), &comments); err != nil {
+		return nil, err
+	}
+	out := make([]Comment, 0, len(comments))
+	for _, cm := range comments {
+		out = append(out, Comment{ID: cm.GetID(), Body: cm.GetBody(), AuthorLogin: cm.GetUser().GetLogin()})
+	}
+	return out, nil
+}
+
+func (c *v17Client) CreateIssueComment(ctx context.Context, owner, repo string, number int, body string) (*Comment, error) {
+	cm, resp, err := c.gh.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: github.String(body)})
+	if err != nil {
+		return nil, wrapErr(resp, err)
+	}
+	return &Comment{ID: cm.GetID(), Body: cm.GetBody(), AuthorLogin: cm.GetUser().GetLogin()}, nil
+}
+
+func (c *v17Client) EditIssueComment(ctx context.Context, owner, repo string, commentID int64, body string) error {
+	_, resp, err := c.gh.Issues.EditComment(ctx, owner, repo, commentID, &github.IssueComment{Body: github.String(body)})
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) ListIssueLabels(ctx context.Context, owner, repo string, number int) ([]string, error) {
+	var labels []*github.Label
+	if err := c.list(ctx, fmt.Sprintf("repos/%s/%s/issues/%d/labels", owner, repo, number), &labels); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(labels))
+	for _, l := range labels {
+		names = append(names, l.GetName())
+	}
+	return names, nil
+}
+
+func (c *v17Client) AddIssueLabels(ctx context.Context, owner, repo string, number int, labels []string) error {
+	_, resp, err := c.gh.Issues.AddLabelsToIssue(ctx, owner, repo, number, labels)
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) RemoveIssueLabel(ctx context.Context, owner, repo string, number int, label string) error {
+	resp, err := c.gh.Issues.RemoveLabelForIssue(ctx, owner, repo, number, label)
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) GetLabel(ctx context.Context, owner, repo, name string) (*Label, error) {
+	l, resp, err := c.gh.Issues.GetLabel(ctx, owner, repo, name)
+	if err != nil {
+		return nil, wrapErr(resp, err)
+	}
+	return &Label{Name: l.GetName(), Color: l.GetColor(), Description: l.GetDescription()}, nil
+}
+
+func (c *v17Client) CreateLabel(ctx context.Context, owner, repo string, label Label) error {
+	_, resp, err := c.gh.Issues.CreateLabel(ctx, owner, repo, &github.Label{
+		Name:        github.String(label.Name),
+		Color:       github.String(label.Color),
+		Description: github.String(label.Description),
+	})
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) DeleteLabel(ctx context.Context, owner, repo, name string) error {
+	resp, err := c.gh.Issues.DeleteLabel(ctx, owner, repo, name)
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) CreateIssueReaction(ctx context.Context, owner, repo string, number int, content string) error {
+	_, resp, err := c.gh.Reactions.CreateIssueReaction(ctx, owner, repo, number, content)
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) CreateCommentReaction(ctx context.Context, owner, repo string, commentID int64, content string) error {
+	_, resp, err := c.gh.Reactions.CreateIssueCommentReaction(ctx, owner, repo, commentID, content)
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) CreatePullRequest(ctx context.Context, owner, repo string, pr NewPullRequest) (*PullRequest, error) {
+	created, resp, err := c.gh.PullRequests.Create(ctx, owner, repo, &github.NewPullRequest{
+		Title:               github.String(pr.Title),
+		Head:                github.String(pr.Head),
+		Base:                github.String(pr.Base),
+		Body:                github.String(pr.Body),
+		MaintainerCanModify: github.Bool(pr.MaintainerCanModify),
+	})
+	if err != nil {
+		return nil, wrapErr(resp, err)
+	}
+	return convertPullRequest(created), nil
+}
+
+func (c *v17Client) EditPullRequestBody(ctx context.Context, owner, repo string, number int, body string) error {
+	_, resp, err := c.gh.PullRequests.Edit(ctx, owner, repo, number, &github.PullRequest{Body: github.String(body)})
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) ListPullRequestFiles(ctx context.Context, owner, repo string, number int) ([]PullRequestFile, error) {
+	var files []*github.CommitFile
+	if err := c.list(ctx, fmt.Sprintf("repos/%s/%s/pulls/%d/files", owner, repo, number), &files); err != nil {
+		return nil, err
+	}
+	out := make([]PullRequestFile, 0, len(files))
+	for _, f := range files {
+		out = append(out, PullRequestFile{Filename: f.GetFilename(), Status: f.GetStatus(), Patch: f.GetPatch()})
+	}
+	return out, nil
+}
+
+func (c *v17Client) ListReviews(ctx context.Context, owner, repo string, number int) ([]Review, error) {
+	var reviews []*github.PullRequestReview
+	if err := c.list(ctx, fmt.Sprintf("repos/%s/%s/pulls/%d/reviews", owner, repo, number), &reviews); err != nil {
+		return nil, err
+	}
+	out := make([]Review, 0, len(reviews))
+	for _, r := range reviews {
+		out = append(out, Review{AuthorLogin: r.GetUser().GetLogin(), State: r.GetState()})
+	}
+	return out, nil
+}
+
+func (c *v17Client) RequestReviewers(ctx context.Context, owner, repo string, number int, reviewers []string) error {
+	_, resp, err := c.gh.PullRequests.RequestReviewers(ctx, owner, repo, number, github.ReviewersRequest{Reviewers: reviewers})
+	return wrapErr(resp, err)
+}
+
+func (c *v17Client) CreateReviewComment(ctx context.Context, owner, repo string, number int, comment ReviewComment) (string, error) {
+	// go-github v17 predates line-based review comments, so the request is built by hand
+	body := map[string]any{
+		"body":      comment.Body,
+		"path":      comment.Path,
+		"commit_id": comment.CommitID,
+		"line":      comment.Line,
+		"side":      "RIGHT",
+	}
+	if comment.StartLine > 0 && comment.StartLine < comment.Line {
+		body["start_line"] = comment.StartLine
+		body["start_side"] = "RIGHT"
+	}
+	req, err := c.gh.NewRequest("POST", fmt.Sprintf("repos/%s/%s/pulls/%d/comments", owner, repo, number), body)
+	if err != nil {
+		return "", err
+	}
+	var created github.PullRequestComment
+	resp, err := c.gh.Do(ctx, req, &created)
+	if err != nil {
+		return "", wrapErr(resp, err)
+	}
+	return created.GetHTMLURL(), nil
+}
+
+func (c *v17Client) ListPullRequests(ctx context.Context, owner, repo, state, head string) ([]PullRequest, error) {
+	query := url.Values{}
+	if state != "" {
+		query.Set("state", state)
+	}
+	if head != "" {
+		query.Set("head", head)
+	}
+	var prs []*github.PullRequest
+	if err := c.list(ctx, fmt.Sprintf("repos/%s/%s/pulls?%s", owner, repo, query.Encode()), &prs); err != nil {
+		return nil, err
+	}
+	out := make([]PullRequest, 0, len(prs))
+	for _, pr := range prs {
+		out = append(out, *convertPullRequest(pr))
+	}
+	return out, nil
+}
+
+func (c *v17Client) ClosePullRequest(ctx context.Context, owner, repo string, number int) error {
+	_, resp, err := c.gh.PullRequests.Edit(ctx, owner, repo, number, &github.PullRequest{State: github.String("closed")})
+	return wrapErr(resp, err)
+}
+
+func convertPullRequest(pr *github.PullRequest) *PullRequest {
+	return &PullRequest{
+		Number:      pr.GetNumber(),
+		HTMLURL:     pr.GetHTMLURL(),
+		NodeID:      pr.GetNodeID(),
+		Title:       pr.GetTitle(),
+		Body:        pr.GetBody(),
+		AuthorLogin: pr.GetUser().GetLogin(),
+		HeadRef:     pr.GetHead().GetRef(),
+		BaseRef:     pr.GetBase().GetRef(),
+		HeadRepo:    pr.GetHead().GetRepo().GetFullName(),
+		State:       pr.GetState(),
+		Merged:      pr.MergedAt != nil,
+		ClosedAt:    pr.GetClosedAt(),
+	}
+}
+
+// graphQLPath is relative to the REST base URL: api.github.com/graphql on github.com,
+// <host>/api/graphql on Enterprise Server (REST under /api/v3/)
+const graphQLPath = "../graphql"
+
+// graphql posts a GraphQL request and decodes its data into out
+func (c *v17Client) graphql(ctx context.Context, query string, variables map[string]any, out any) error {
+	req, err := c.gh.NewRequest("POST", graphQLPath, map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	var reply struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	resp, err := c.gh.Do(ctx, req, &reply)
+	if err != nil {
+		return wrapErr(resp, err)
+	}
+	if len(reply.Errors) > 0 {
+		return fmt.Errorf("graphql: %s", reply.Errors[0].Message)
+	}
+	if out == nil || len(reply.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(reply.Data, out)
+}
+
+func (c *v17Client) EnableAutoMerge(ctx context.Context, prNodeID, method string) error {
+	err := c.graphql(ctx, `mutation($id: ID!, $method: PullRequestMergeMethod!) { enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method}) { clientMutationId } }`,
+		map[string]any{"id": prNodeID, "method": method}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to enable auto-merge: %w", err)
+	}
+	return nil
+}
+
+func (c *v17Client) AddDiscussionComment(ctx context.Context, discussionNodeID, body string) error {
+	err := c.graphql(ctx, `mutation($id: ID!, $body: String!) { addDiscussionComment(input: {discussionId: $id, body: $body}) { comment { id } } }`,
+		map[string]any{"id": discussionNodeID, "body": body}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to comment on discussion: %w", err)
+	}
+	return nil
+}
+
+func (c *v17Client) AddProjectItem(ctx context.Context, projectNodeID, contentNodeID string) (string, error) {
+	var out struct {
+		AddProjectV2ItemByID struct {
+			Item struct {
+				ID string `json:"id"`
+			} `json:"item"`
+		} `json:"addProjectV2ItemById"`
+	}
+	err := c.graphql(ctx, `mutation($project: ID!, $content: ID!) { addProjectV2ItemById(input: {projectId: $project, contentId: $content}) { item { id } } }`,
+		map[string]any{"project": projectNodeID, "content": contentNodeID}, &out)
+	if err != nil {
+		return "", fmt.Errorf("failed to add project item: %w", err)
+	}
+	return out.AddProjectV2ItemByID.Item.ID, nil
+}
+
+func (c *v17Client) SetProjectItemOption(ctx context.Context, projectNodeID, itemID, field, option string) error {
+	var fields struct {
+		Node struct {
+			Field struct {
+				ID      string `json:"id"`
+				Options []struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"options"`
+			} `json:"field"`
+		} `json:"node"`
+	}
+	err := c.graphql(ctx, `query($project: ID!, $field: String!) { node(id: $project) { ... on ProjectV2 { field(name: $field) { ... on ProjectV2SingleSelectField { id options { id name } } } } } }`,
+		map[string]any{"project": projectNodeID, "field": field}, &fields)
+	if err != nil {
+		return fmt.Errorf("failed to read project field %s: %w", field, err)
+	}
+	if fields.Node.Field.ID == "" {
+		return fmt.Errorf("project has no single-select field %q: %w", field, ErrNotFound)
+	}
+	optionID := ""
+	for _, o := range fields.Node.Field.Options {
+		if strings.EqualFold(o.Name, option) {
+			optionID = o.ID
+		}
+	}
+	if optionID == "" {
+		return fmt.Errorf("project field %s has no option %q: %w", field, option, ErrNotFound)
+	}
+	err = c.graphql(ctx, `mutation($project: ID!, $item: ID!, $field: ID!, $option: String!) { updateProjectV2ItemFieldValue(input: {projectId: $project, itemId: $item, fieldId: $field, value: {singleSelectOptionId: $option}}) { projectV2Item { id } } }`,
+		map[string]any{"project": projectNodeID, "item": itemID, "field": fields.Node.Field.ID, "option": optionID}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to set project field %s: %w", field, err)
+	}
+	return nil
+}
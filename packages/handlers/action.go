@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// RunAction handles the event that triggered the current GitHub Actions job, for
+// repositories that run DevFlow as a workflow step instead of installing the App. It reads
+// the GITHUB_* variables the runner sets and authenticates with GITHUB_TOKEN.
+//
+// Webhook events go through EventHandlers, push syncs the knowledge base, and
+// workflow_dispatch and schedule (re)build it.
+func RunAction() error {
+	eventName := os.Getenv("GITHUB_EVENT_NAME")
+	repoName := os.Getenv("GITHUB_REPOSITORY")
+	token := os.Getenv("GITHUB_TOKEN")
+	if eventName == "" || repoName == "" {
+		return fmt.Errorf("GITHUB_EVENT_NAME and GITHUB_REPOSITORY must be set; is this running in GitHub Actions?")
+	}
+	if token == "" {
+		return fmt.Errorf("GITHUB_TOKEN not set; pass it to the step with env: GITHUB_TOKEN: ${{ secrets.GITHUB_TOKEN }}")
+	}
+
+	apiURL := envOr("GITHUB_API_URL", "https://api.github.com")
+	serverURL := envOr("GITHUB_SERVER_URL", "https://github.com")
+	ctx, err := repository.NewTokenContext(apiURL, token)
+	if err != nil {
+		return err
+	}
+	configureActionRun(serverURL, token)
+
+	slog.Info("Running as a GitHub Action", "event", eventName, "repo", repoName)
+	switch eventName {
+	case "workflow_dispatch", "schedule":
+		return initializeDevflowKnowledgeBase(ctx, repoName)
+	case "push":
+		return dispatchActionEvent(ctx, eventName, ignoreOwnEvents(eventName, withEventPolicy(eventName, HandlePush)))
+	}
+	handler, ok := EventHandlers[eventName]
+	if !ok {
+		slog.Info("DevFlow does not handle this event, nothing to do", "event", eventName)
+		return nil
+	}
+	return dispatchActionEvent(ctx, eventName, handler)
+}
+
+// dispatchActionEvent parses the event payload the runner saved and runs handler on it
+func dispatchActionEvent(ctx *probot.Context, eventName string, handler func(ctx *probot.Context) error) error {
+	path := os.Getenv("GITHUB_EVENT_PATH")
+	if path == "" {
+		return fmt.Errorf("GITHUB_EVENT_PATH not set")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read event payload: %w", err)
+	}
+	payload, err := github.ParseWebHook(eventName, data)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s event: %w", eventName, err)
+	}
+	ctx.Payload = payload
+	return handler(ctx)
+}
+
+// configureActionRun points git and the working directories at the runner
+func configureActionRun(serverURL, token string) {
+	configureGitToken(serverURL, token)
+
+	// Runners are discarded after the job, so there is no point caching mirrors, and they
+	// have no Python environment for the Strands agent
+	cfg := *config.GetConfig()
+	cfg.Agent.Engine = "native"
+	cfg.Repository.MirrorCacheDir = ""
+	if tmp := os.Getenv("RUNNER_TEMP"); tmp != "" {
+		cfg.Repository.WorkspaceDir = filepath.Join(tmp, "devflow", "clones")
+		cfg.Store.Dir = filepath.Join(tmp, "devflow", "state")
+	}
+	config.Use(&cfg)
+}
+
+// configureGitToken makes git clone from serverURL with token. Git gets the token as an extra
+// header, like actions/checkout, so it never appears in clone URLs or logs.
+func configureGitToken(serverURL, token string) {
+	serverURL = strings.TrimSuffix(serverURL, "/")
+	basic := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+	os.Setenv("GIT_CONFIG_COUNT", "1")
+	os.Setenv("GIT_CONFIG_KEY_0", "http."+serverURL+"/.extraheader")
+	os.Setenv("GIT_CONFIG_VALUE_0", "AUTHORIZATION: basic "+basic)
+	os.Setenv("GIT_TERMINAL_PROMPT", "0")
+
+	repository.CloneURL = func(repoName string) string {
+		return fmt.Sprintf("%s/%s.git", serverURL, repoName)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/store"
+)
+
+// usageMetrics is the admin API view of a set of usage counters, with derived rates
+type usageMetrics struct {
+	Runs                  int64   `json:"runs"`
+	RunsFailed            int64   `json:"runs_failed"`
+	PRsOpened             int64   `json:"prs_opened"`
+	PRsMerged             int64   `json:"prs_merged"`
+	PRsClosedUnmerged     int64   `json:"prs_closed_unmerged"`
+	MergeRate             float64 `json:"merge_rate"` // merged / (merged + closed unmerged)
+	ReviewIterations      int64   `json:"review_iterations"`
+	AvgReviewIterations   float64 `json:"avg_review_iterations"` // per closed PR
+	AvgTimeToMergeSeconds float64 `json:"avg_time_to_merge_seconds"`
+	RunSuccessRate        float64 `json:"run_success_rate"`
+	UpdatedAt             string  `json:"updated_at,omitempty"`
+}
+
+func newUsageMetrics(u *store.Usage) usageMetrics {
+	c := u.Counters
+	m := usageMetrics{
+		Runs:              c[store.UsageRuns],
+		RunsFailed:        c[store.UsageRunsFailed],
+		PRsOpened:         c[store.UsagePRsOpened],
+		PRsMerged:         c[store.UsagePRsMerged],
+		PRsClosedUnmerged: c[store.UsagePRsClosedUnmerged],
+		ReviewIterations:  c[store.UsageReviewIterations],
+	}
+	if !u.Updated.IsZero() {
+		m.UpdatedAt = u.Updated.Format("2006-01-02T15:04:05Z")
+	}
+	if closed := m.PRsMerged + m.PRsClosedUnmerged; closed > 0 {
+		m.MergeRate = float64(m.PRsMerged) / float64(closed)
+		m.AvgReviewIterations = float64(m.ReviewIterations) / float64(closed)
+	}
+	if m.PRsMerged > 0 {
+		m.AvgTimeToMergeSeconds = float64(c[store.UsageTimeToMergeSeconds]) / float64(m.PRsMerged)
+	}
+	if m.Runs > 0 {
+		m.RunSuccessRate = float64(m.Runs-m.RunsFailed) / float64(m.Runs)
+	}
+	return m
+}
+
+// repoMetrics is the usage of one repository
+type repoMetrics struct {
+	Repo string `json:"repo"`
+	usageMetrics
+}
+
+// variantMetrics is the outcome of one arm of a prompt experiment
+type variantMetrics struct {
+	Variant string `json:"variant"`
+	Weight  int    `json:"weight"` // 0 for variants no longer configured
+	usageMetrics
+}
+
+// experimentReport compares the variants of a prompt experiment
+type experimentReport struct {
+	Name     string           `json:"name"`
+	Slot     string           `json:"slot,omitempty"`
+	Variants []variantMetrics `json:"variants"`
+}
+
+// StartAdminServer serves the admin API on admin.listen_addr. Requests must carry the
+// DEVFLOW_ADMIN_TOKEN as a bearer token.
+func StartAdminServer() {
+	cfg := config.GetConfig().Admin
+	if !cfg.Enabled {
+		return
+	}
+	token := os.Getenv("DEVFLOW_ADMIN_TOKEN")
+	if token == "" {
+		slog.Error("Cannot start admin API: DEVFLOW_ADMIN_TOKEN is not set")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics/repos", handleRepoMetrics)
+	mux.HandleFunc("GET /metrics/repos/{owner}/{repo}", handleRepoMetrics)
+	mux.HandleFunc("GET /experiments", handleExperiments)
+	mux.HandleFunc("GET /experiments/{name}", handleExperiments)
+	mux.HandleFunc("GET /analyses/{owner}/{repo}", handleAnalyses)
+	mux.HandleFunc("GET /analyses/{owner}/{repo}/diff", handleAnalysisDiff)
+	mux.HandleFunc("GET /analyses/{owner}/{repo}/{version}", handleAnalysisVersion)
+	mux.HandleFunc("GET /audit/{owner}/{repo}", handleAudit)
+	mux.HandleFunc("GET /dead-letters", handleDeadLetters)
+	mux.HandleFunc("GET /dead-letters/{owner}/{repo}/{number}", handleDeadLetter)
+	mux.HandleFunc("POST /dead-letters/{owner}/{repo}/{number}/requeue", handleRequeueDeadLetter)
+	mux.HandleFunc("GET /knowledge-base/{owner}/{repo}/rebuild", handleRebuildKBStatus)
+	mux.HandleFunc("POST /knowledge-base/{owner}/{repo}/rebuild", handleRebuildKB)
+	mux.HandleFunc("POST /previews/{owner}/{repo}/{number}", handlePreviewURL)
+	slog.Info("Admin API started", "addr", cfg.ListenAddr)
+	go func() {
+		if err := http.ListenAndServe(cfg.ListenAddr, requireAdminToken(token, mux)); err != nil {
+			slog.Error("Admin API stopped", "error", err)
+		}
+	}()
+}
+
+func requireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleRepoMetrics lists usage metrics of every repository, or of the one named in the path
+func handleRepoMetrics(w http.ResponseWriter, r *http.Request) {
+	usage, err := store.DefaultUsage()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	all, err := usage.ListUsage(store.UsageByRepo)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	want := ""
+	if owner := r.PathValue("owner"); owner != "" {
+		want = owner + "/" + r.PathValue("repo")
+	}
+	metrics := make([]repoMetrics, 0, len(all))
+	for _, u := range all {
+		if want == "" || strings.EqualFold(u.Key, want) {
+			metrics = append(metrics, repoMetrics{Repo: u.Key, usageMetrics: newUsageMetrics(u)})
+		}
+	}
+	if want != "" && len(metrics) == 0 {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if want != "" {
+		_ = json.NewEncoder(w).Encode(metrics[0])
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"repos": metrics})
+}
+
+// handleExperiments reports the outcome metrics of every variant of each prompt experiment,
+// or of the one named in the path. Experiments removed from the config are still reported
+// while they have recorded runs.
+func handleExperiments(w http.ResponseWriter, r *http.Request) {
+	usage, err := store.DefaultUsage()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	all, err := usage.ListUsage(store.UsageByVariant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recorded := make(map[string]*store.Usage, len(all))
+	for _, u := range all {
+		recorded[u.Key] = u
+	}
+
+	var reports []*experimentReport
+	byName := make(map[string]*experimentReport)
+	for _, exp := range config.GetConfig().Experiments {
+		report := &experimentReport{Name: exp.Name, Slot: exp.Slot}
+		for _, v := range exp.Variants {
+			u := recorded[exp.Name+"/"+v.Name]
+			if u == nil {
+				u = &store.Usage{}
+			}
+			delete(recorded, exp.Name+"/"+v.Name)
+			report.Variants = append(report.Variants, variantMetrics{Variant: v.Name, Weight: v.Weight, usageMetrics: newUsageMetrics(u)})
+		}
+		reports = append(reports, report)
+		byName[exp.Name] = report
+	}
+	for _, u := range all {
+		if recorded[u.Key] == nil {
+			continue
+		}
+		name, variant, _ := strings.Cut(u.Key, "/")
+		report := byName[name]
+		if report == nil {
+			report = &experimentReport{Name: name}
+			reports = append(reports, report)
+			byName[name] = report
+		}
+		report.Variants = append(report.Variants, variantMetrics{Variant: variant, usageMetrics: newUsageMetrics(u)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if want := r.PathValue("name"); want != "" {
+		report := byName[want]
+		if report == nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(report)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"experiments": reports})
+}
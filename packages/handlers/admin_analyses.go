@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	repoActions "devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+)
+
+// analysisSummary is the admin API view of an archived analysis, without document contents
+type analysisSummary struct {
+	Version   int64          `json:"version"`
+	CommitSHA string         `json:"commit_sha"`
+	CreatedAt string         `json:"created_at"`
+	Sizes     map[string]int `json:"sizes"` // document name -> bytes
+}
+
+// handleAnalyses lists the archived analysis versions of a repository, newest first
+func handleAnalyses(w http.ResponseWriter, r *http.Request) {
+	versions, ok := listAnalyses(w, r)
+	if !ok {
+		return
+	}
+	summaries := make([]analysisSummary, 0, len(versions))
+	for _, v := range versions {
+		s := analysisSummary{Version: v.Version, CommitSHA: v.CommitSHA, CreatedAt: v.CreatedAt.Format("2006-01-02T15:04:05Z"), Sizes: map[string]int{}}
+		for name, content := range v.Files {
+			s.Sizes[name] = len(content)
+		}
+		summaries = append(summaries, s)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"repo": repoPathValue(r), "versions": summaries})
+}
+
+// handleAnalysisVersion returns one archived version with its documents, or only the
+// document named by ?file= as plain text
+func handleAnalysisVersion(w http.ResponseWriter, r *http.Request) {
+	versions, ok := listAnalyses(w, r)
+	if !ok {
+		return
+	}
+	v := findAnalysis(versions, r.PathValue("version"))
+	if v == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	if file := r.URL.Query().Get("file"); file != "" {
+		content, ok := v.Files[file]
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(content))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// handleAnalysisDiff returns a unified diff of one archived document between two versions.
+// ?file= defaults to the analysis, ?to= to the newest version and ?from= to the one before it.
+func handleAnalysisDiff(w http.ResponseWriter, r *http.Request) {
+	versions, ok := listAnalyses(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	file := query.Get("file")
+	if file == "" {
+		file = repoActions.ArchivedDocuments()[0]
+	}
+	if !slices.Contains(repoActions.ArchivedDocuments(), file) {
+		http.Error(w, fmt.Sprintf("file must be one of %v", repoActions.ArchivedDocuments()), http.StatusBadRequest)
+		return
+	}
+
+	to := versions[0]
+	if want := query.Get("to"); want != "" {
+		to = findAnalysis(versions, want)
+	}
+	var from *store.AnalysisVersion
+	if want := query.Get("from"); want != "" {
+		from = findAnalysis(versions, want)
+	} else if to != nil {
+		// versions are newest first, so the one before to follows it
+		for i, v := range versions {
+			if v == to && i+1 < len(versions) {
+				from = versions[i+1]
+			}
+		}
+	}
+	if from == nil || to == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	diff, err := repoActions.DiffAnalyses(from, to, file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	_, _ = w.Write([]byte(diff))
+}
+
+// listAnalyses loads the archived versions of the repository in the path, replying with an
+// error when it has none
+func listAnalyses(w http.ResponseWriter, r *http.Request) ([]*store.AnalysisVersion, bool) {
+	archive, err := store.DefaultArchive()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	versions, err := archive.ListAnalyses(repoPathValue(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if len(versions) == 0 {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil, false
+	}
+	return versions, true
+}
+
+// findAnalysis returns the version numbered want, or nil
+func findAnalysis(versions []*store.AnalysisVersion, want string) *store.AnalysisVersion {
+	n, err := strconv.ParseInt(want, 10, 64)
+	if err != nil {
+		return nil
+	}
+	for _, v := range versions {
+		if v.Version == n {
+			return v
+		}
+	}
+	return nil
+}
+
+func repoPathValue(r *http.Request) string {
+	return r.PathValue("owner") + "/" + r.PathValue("repo")
+}
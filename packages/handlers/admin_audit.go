@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"devflow-agent/packages/store"
+)
+
+// defaultAuditLimit is how many entries /audit returns without ?limit=
+const defaultAuditLimit = 100
+
+// handleAudit lists a repository's audit entries, newest first. ?run=, ?action= and ?since=
+// (RFC 3339) narrow them; ?limit= caps how many are returned, 0 returning all.
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := store.AuditQuery{RunID: query.Get("run"), Action: query.Get("action"), Limit: defaultAuditLimit}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		q.Since = t
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			http.Error(w, "limit must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+
+	audit, err := store.DefaultAudit()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entries, err := audit.ListAudit(repoPathValue(r), q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []*store.AuditEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"repo": repoPathValue(r), "entries": entries})
+}
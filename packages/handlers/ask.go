@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// askMaxFiles caps the files whose code is quoted to answer a question
+const askMaxFiles = 6
+
+func init() {
+	commandHandlers["ask"] = handleAskCommand
+}
+
+// handleAskCommand answers "/devflow ask <question>" from the knowledge base. It only reads
+// the repository, so anyone who can comment may ask.
+func handleAskCommand(ctx *probot.Context, event *github.IssueCommentEvent, cmd slashCommand) error {
+	repoName := event.GetRepo().GetFullName()
+	number := event.GetIssue().GetNumber()
+	question := strings.TrimSpace(cmd.Args)
+	if question == "" {
+		return repoActions.PostIssueComment(ctx, repoName, number,
+			fmt.Sprintf("Ask a question about the code, e.g. `%s ask where are webhook signatures verified?`", commandPrefix))
+	}
+
+	answer, kbCommit, err := answerRepoQuestion(repoName, question)
+	if err != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to answer question", "repo", repoName, "issueNumber", number, "error", err)
+		return repoActions.PostIssueComment(ctx, repoName, number, askFailureComment(err))
+	}
+
+	var b strings.Builder
+	b.WriteString("> " + strings.ReplaceAll(question, "\n", "\n> ") + "\n\n")
+	b.WriteString(answer + "\n\n")
+	if kbCommit != "" {
+		b.WriteString(fmt.Sprintf("<sub>Answered from the DevFlow knowledge base at %.7s.</sub>\n", kbCommit))
+	}
+	return repoActions.PostIssueComment(ctx, repoName, number, b.String())
+}
+
+// answerRepoQuestion answers a question from a fresh clone's knowledge base, returning the
+// answer and the commit the knowledge base describes
+func answerRepoQuestion(repoName, question string) (string, string, error) {
+	cfg := config.GetConfig()
+	runCtx := context.Background()
+
+	repoPath, _, err := repoActions.CloneRepository(runCtx, repoName)
+	if err != nil {
+		return "", "", err
+	}
+	defer func() { _ = repoActions.CleanupRepo(repoPath) }()
+
+	if _, err := os.Stat(cfg.GetDevflowPath(repoPath, cfg.Files.StructureFile)); os.IsNotExist(err) {
+		return "", "", &repoActions.KBMissingError{RepoName: repoName}
+	}
+	kbCommit := ""
+	if data, err := os.ReadFile(filepath.Join(repoPath, ".devflow", "devflow-commit.txt")); err == nil {
+		kbCommit = strings.TrimSpace(string(data))
+	}
+
+	// Files named by stack traces first, then the files whose summaries match the question best
+	kb := ai.IssueContext{CandidateFiles: repoActions.StackTraceCandidateFiles(repoPath, question)}
+	files := kb.CandidateFiles
+	if summaries, err := repoActions.LoadFileSummaries(cfg.GetDevflowPath(repoPath, cfg.Files.MetadataFile)); err != nil {
+		slog.Warn("File summaries unavailable", "error", err)
+	} else {
+		kb.FileSummaries = repoActions.RenderFileSummaries(summaries, question, cfg.AI.SummaryContextTokens)
+		for _, f := range repoActions.RelevantFiles(summaries, question, askMaxFiles) {
+			if len(files) < askMaxFiles && !slices.Contains(files, f) {
+				files = append(files, f)
+			}
+		}
+	}
+	if len(files) > 0 {
+		codeFilesPath := cfg.GetDevflowPath(repoPath, cfg.Files.CodeFilesFile)
+		if doc, err := repoActions.CreateCodeFilesDocument(repoPath, files, question, codeFilesPath); err != nil {
+			slog.Warn("Failed to build code files document", "error", err)
+		} else {
+			kb.CodeContext = doc
+		}
+	}
+	kb.InfraContext = repoActions.LoadInfrastructureContext(cfg.GetDevflowPath(repoPath, cfg.Files.InfrastructureFile),
+		question, cfg.CodeContext.MaxTokens)
+	kb.APIContext = repoActions.LoadAPISurfaceContext(cfg.GetDevflowPath(repoPath, cfg.Files.APISurfaceFile),
+		question, cfg.CodeContext.MaxTokens)
+	analysis, err := ai.LoadAnalysisSections(cfg.GetDevflowPath(repoPath, cfg.Files.AnalysisFile),
+		cfg.GetDevflowPath(repoPath, cfg.Files.AnalysisIndexFile), files)
+	if err != nil {
+		slog.Warn("Repository analysis unavailable", "error", err)
+	}
+
+	llmCtx, cancel := config.StageContext(runCtx, cfg.Timeouts.LLMSeconds)
+	defer cancel()
+	answer, err := ai.AnswerRepoQuestion(llmCtx, repoName, question, kb, analysis, ai.IsRepoFile(repoPath))
+	if err != nil {
+		return "", "", err
+	}
+	return answer, kbCommit, nil
+}
+
+// askFailureComment explains why a question could not be answered
+func askFailureComment(err error) string {
+	var kbErr *repoActions.KBMissingError
+	var cloneErr *repoActions.CloneError
+	var safetyErr *ai.SafetyBlockError
+	var title string
+	switch {
+	case errors.As(err, &kbErr):
+		title = "DevFlow has no knowledge base for this repository yet. Merge the \"Initialize Devflow Knowledge Base\" pull request, then ask again."
+	case errors.As(err, &cloneErr):
+		title = "DevFlow could not clone the repository to answer this question."
+	case errors.As(err, &safetyErr):
+		title = "The AI model declined to answer this question. " + safetyErr.Explain() + " Try rephrasing it."
+	case errors.Is(err, context.DeadlineExceeded):
+		title = "DevFlow ran out of time answering this question. Try a narrower question."
+	default:
+		title = "DevFlow could not answer this question. Try again later."
+	}
+	return fmt.Sprintf("%s\n\n<details><summary>Error details</summary>\n\n```\n%v\n```\n</details>", title, err)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// isBotPR reports whether DevFlow opened a pull request from one of its branches
+func isBotPR(pr *github.PullRequest) bool {
+	return repository.IsBotLogin(pr.GetUser().GetLogin()) && isDevflowBranch(pr.GetHead().GetRef())
+}
+
+// applyMergeStrategy turns on auto-merge for DevFlow's pull request according to the
+// repository's merge settings: when it is opened, or once it has enough approvals
+func applyMergeStrategy(ctx *probot.Context, repoName string, pr *github.PullRequest) {
+	if !isBotPR(pr) || pr.GetState() != "open" {
+		return
+	}
+	repoCfg, err := repository.FetchRepoConfig(ctx, repoName)
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to read merge settings", "repo", repoName, "error", err)
+		return
+	}
+	merge := repoCfg.Merge
+	if merge.Method == "" {
+		return
+	}
+	if merge.MinApprovals > 0 {
+		approvals, err := repository.CountApprovals(ctx, repoName, pr.GetNumber())
+		if err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to count approvals", "prNumber", pr.GetNumber(), "error", err)
+			return
+		}
+		if approvals < merge.MinApprovals {
+			slog.InfoContext(logging.For(ctx), "Waiting for approvals before auto-merge", "prNumber", pr.GetNumber(),
+				"approvals", approvals, "required", merge.MinApprovals)
+			return
+		}
+	}
+	if err := repository.EnableAutoMerge(ctx, pr.GetNodeID(), merge.Method); err != nil {
+		slog.WarnContext(logging.For(ctx), "Could not enable auto-merge", "prNumber", pr.GetNumber(), "error", err)
+		explainNoAutoMerge(ctx, repoName, pr.GetNumber(), err)
+		return
+	}
+	slog.InfoContext(logging.For(ctx), "Enabled auto-merge", "prNumber", pr.GetNumber(), "method", merge.Method)
+}
+
+// explainNoAutoMerge tells a pull request's reviewers, once, that it has to be merged by hand
+func explainNoAutoMerge(ctx *probot.Context, repoName string, prNumber int, cause error) {
+	claims, err := store.DefaultClaimer()
+	if err != nil {
+		return
+	}
+	if claimed, err := claims.Claim(fmt.Sprintf("no-auto-merge:%s:%d", repoName, prNumber), store.IdempotencyTTL()); err != nil || !claimed {
+		return
+	}
+	body := fmt.Sprintf("DevFlow could not turn on auto-merge for this pull request, so it waits to be merged by hand.\n\n"+
+		"> %s\n\nAllow auto-merge in the repository settings and protect the base branch with required checks "+
+		"for DevFlow's pull requests to merge themselves.", strings.ReplaceAll(cause.Error(), "\n", " "))
+	if err := repository.PostIssueComment(ctx, repoName, prNumber, body); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to comment on pull request", "prNumber", prNumber, "error", err)
+	}
+}
+
+// deleteMergedBranch deletes the head branch of DevFlow's merged pull request when the
+// repository's merge settings ask for it
+func deleteMergedBranch(ctx *probot.Context, repoName string, pr *github.PullRequest) {
+	if !isBotPR(pr) || pr.GetHead().GetRepo().GetFullName() != repoName {
+		return
+	}
+	repoCfg, err := repository.FetchRepoConfig(ctx, repoName)
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to read merge settings", "repo", repoName, "error", err)
+		return
+	}
+	if repoCfg.Merge.DeleteBranch == nil || !*repoCfg.Merge.DeleteBranch {
+		return
+	}
+	branch := pr.GetHead().GetRef()
+	if err := repository.DeleteBranch(ctx, repoName, branch); err != nil {
+		// GitHub may have deleted it already when the repository deletes merged branches
+		slog.InfoContext(logging.For(ctx), "Did not delete merged branch", "branch", branch, "error", err)
+		return
+	}
+	slog.InfoContext(logging.For(ctx), "Deleted merged branch", "branch", branch, "prNumber", pr.GetNumber())
+}
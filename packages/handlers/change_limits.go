@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// applyChangeLimits drops the agent's changes that the repository's limits never allow, and
+// reports whether the rest may be published. Changes above a hard limit, or above a threshold
+// while the issue lacks the confirmation label, are not published and the issue says why.
+func applyChangeLimits(ctx *probot.Context, lang, repoName string, issue *github.Issue, repoPath, plan string, limits config.ChangeLimitsConfig, result *ai.PythonAgentResult, prNotes *[]string) bool {
+	issueNumber := issue.GetNumber()
+	kept, discarded := repoActions.FilterChangeLimits(repoPath, result.ChangesMade, plan, result.Operations)
+	if len(discarded) > 0 {
+		slog.WarnContext(logging.For(ctx), "Discarding changes the change limits do not allow", "files", len(discarded))
+		repoActions.RevertPaths(repoPath, pathsOf(discarded))
+		*prNotes = append(*prNotes, "### Discarded by change limits\n\nThe following changes were discarded:\n\n"+repoActions.FormatPathViolations(discarded))
+		result.ChangesMade = kept
+	}
+	if len(result.ChangesMade) == 0 {
+		return true
+	}
+
+	size := repoActions.MeasureChanges(repoPath, result.ChangesMade)
+	refuse, confirm := repoActions.ChangeLimitReasons(size, limits)
+	var msg string
+	switch {
+	case refuse != "":
+		msg = fmt.Sprintf("DevFlow did not open a pull request: %s. Split the issue into smaller ones, or raise `limits.max_bytes` in `.devflow-agent/config.yaml`.", refuse)
+	case confirm != "" && !hasLabel(issue.Labels, limits.ConfirmLabel):
+		msg = fmt.Sprintf("DevFlow did not open a pull request because the change is large: %s. A maintainer can add the `%s` label to this issue to run DevFlow again and open the pull request anyway.", confirm, limits.ConfirmLabel)
+	default:
+		return true
+	}
+	slog.WarnContext(logging.For(ctx), "Changes exceed the change limits, not publishing", "issueNumber", issueNumber,
+		"files", size.Files, "bytes", size.Bytes, "lines", size.Lines)
+	if err := repoActions.PostIssueComment(ctx, repoName, issueNumber, localize(lang, msg)); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to post change limits comment", "issueNumber", issueNumber, "error", err)
+	}
+	return false
+}
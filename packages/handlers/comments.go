@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"devflow-agent/packages/logging"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// commandPrefix starts every slash command, e.g. "/devflow help"
+const commandPrefix = "/devflow"
+
+// slashCommand is a parsed "/devflow <name> <args>" comment
+type slashCommand struct {
+	Name string
+	Args string
+}
+
+// commandHandler runs a slash command posted on an issue or pull request
+type commandHandler func(ctx *probot.Context, event *github.IssueCommentEvent, cmd slashCommand) error
+
+// commandHandlers maps slash command names to their handlers
+var commandHandlers = map[string]commandHandler{}
+
+func init() {
+	// Registered here because help lists commandHandlers itself
+	commandHandlers["help"] = handleHelpCommand
+}
+
+// HandleIssueComment dispatches slash commands found in new issue and PR comments
+func HandleIssueComment(ctx *probot.Context) error {
+	event := ctx.Payload.(*github.IssueCommentEvent)
+	if event.GetAction() != "created" {
+		return nil
+	}
+	// Never react to bots (including ourselves)
+	if event.GetComment().GetUser().GetType() == "Bot" {
+		return nil
+	}
+
+	cmd, ok := parseSlashCommand(event.GetComment().GetBody())
+	if !ok {
+		return nil
+	}
+
+	repoName := event.GetRepo().GetFullName()
+	commentID := event.GetComment().GetID()
+	slog.InfoContext(logging.For(ctx), "Slash command received", "repo", repoName, "issueNumber", event.GetIssue().GetNumber(), "command", cmd.Name)
+
+	handler, known := commandHandlers[cmd.Name]
+	if !known {
+		_ = repoActions.AddIssueCommentReaction(ctx, repoName, commentID, repoActions.ReactionConfused)
+		return repoActions.PostIssueComment(ctx, repoName, event.GetIssue().GetNumber(),
+			fmt.Sprintf("Unknown command `%s`. Try `%s help`.", cmd.Name, commandPrefix))
+	}
+
+	// Confirm receipt before doing any (potentially slow) work
+	_ = repoActions.AddIssueCommentReaction(ctx, repoName, commentID, repoActions.ReactionEyes)
+	return handler(ctx, event, cmd)
+}
+
+// parseSlashCommand extracts the first "/devflow <name> [args]" line from a comment body
+func parseSlashCommand(body string) (slashCommand, bool) {
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line != commandPrefix && !strings.HasPrefix(line, commandPrefix+" ") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, commandPrefix))
+		if len(fields) == 0 {
+			return slashCommand{Name: "help"}, true
+		}
+		args := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(line, commandPrefix)), fields[0]))
+		return slashCommand{Name: strings.ToLower(fields[0]), Args: args}, true
+	}
+	return slashCommand{}, false
+}
+
+func handleHelpCommand(ctx *probot.Context, event *github.IssueCommentEvent, cmd slashCommand) error {
+	names := make([]string, 0, len(commandHandlers))
+	for name := range commandHandlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Available DevFlow commands:\n\n")
+	for _, name := range names {
+		b.WriteString(fmt.Sprintf("- `%s %s`\n", commandPrefix, name))
+	}
+	return repoActions.PostIssueComment(ctx, event.GetRepo().GetFullName(), event.GetIssue().GetNumber(), b.String())
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// maxAlertErrorBytes caps the error quoted in a chat alert; Discord rejects messages over
+// 2000 characters
+const maxAlertErrorBytes = 1000
+
+// retryTransient calls attempt until it succeeds, fails for a reason retrying cannot fix, or
+// dead_letters.max_attempts is used up, waiting retry_delay_seconds before the first retry
+// and twice as long before each one after. It returns the error of every failed attempt.
+func retryTransient(ctx *probot.Context, attempt func() error) ([]string, error) {
+	cfg := config.GetConfig().DeadLetters
+	maxAttempts := 1
+	if cfg.Enabled && cfg.MaxAttempts > 1 {
+		maxAttempts = cfg.MaxAttempts
+	}
+	delay := time.Duration(cfg.RetryDelaySeconds) * time.Second
+
+	var errs []string
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil {
+			return errs, nil
+		}
+		errs = append(errs, err.Error())
+		if n >= maxAttempts || !transientFailure(err) {
+			return errs, err
+		}
+		slog.WarnContext(logging.For(ctx), "Run failed, retrying", "attempt", n, "maxAttempts", maxAttempts, "delay", delay, "error", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// deadLetterRun records a run that still failed after its retries and alerts the configured
+// chat webhooks. It returns the note appended to the issue's failure comment, empty when
+// dead letters are disabled or the run could not be recorded.
+func deadLetterRun(ctx *probot.Context, kind, repoName string, issueNumber int, issueTitle string, errs []string) string {
+	if !config.GetConfig().DeadLetters.Enabled || len(errs) == 0 {
+		return ""
+	}
+	d := &store.DeadLetter{
+		RunID:       store.RunID(kind, repoName, issueNumber),
+		Kind:        kind,
+		Repo:        repoName,
+		IssueNumber: issueNumber,
+		IssueTitle:  issueTitle,
+		Attempts:    len(errs),
+		Errors:      errs,
+	}
+	issueURL := ""
+	switch event := ctx.Payload.(type) {
+	case *github.IssuesEvent:
+		d.InstallationID = event.GetInstallation().GetID()
+		issueURL = event.GetIssue().GetHTMLURL()
+		if trigger, err := json.Marshal(event); err == nil {
+			d.Trigger = trigger
+		}
+	case *github.IssueCommentEvent:
+		d.InstallationID = event.GetInstallation().GetID()
+		issueURL = event.GetIssue().GetHTMLURL()
+	}
+
+	letters, err := store.DefaultDeadLetters()
+	if err == nil {
+		err = letters.SaveDeadLetter(d)
+	}
+	if err != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to dead-letter run", "run", d.RunID, "error", err)
+		return ""
+	}
+	slog.ErrorContext(logging.For(ctx), "Run dead-lettered", "run", d.RunID, "attempts", d.Attempts)
+
+	lastErr := errs[len(errs)-1]
+	if len(lastErr) > maxAlertErrorBytes {
+		lastErr = strings.ToValidUTF8(lastErr[:maxAlertErrorBytes], "") + "..."
+	}
+	alert := fmt.Sprintf("DevFlow gave up on %s#%d (%s) after %d attempt(s): %s", repoName, issueNumber, issueTitle, d.Attempts, lastErr)
+	if issueURL != "" {
+		alert += "\n" + issueURL
+	}
+	notifyOperators(ctx, alert)
+
+	return "\n\nThe run has been set aside for the DevFlow operators, who can queue it again once the cause is fixed."
+}
+
+// clearDeadLetter drops the issue's dead letter once a later run of it succeeds
+func clearDeadLetter(ctx *probot.Context, repoName string, issueNumber int) {
+	if !config.GetConfig().DeadLetters.Enabled {
+		return
+	}
+	letters, err := store.DefaultDeadLetters()
+	if err == nil {
+		err = letters.DeleteDeadLetter(repoName, issueNumber)
+	}
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to clear dead letter", "issueNumber", issueNumber, "error", err)
+	}
+}
+
+// notifyOperators posts text to the Slack and Discord webhooks named in notifications.
+// Failures are logged: an alert must never fail the run it reports.
+func notifyOperators(ctx *probot.Context, text string) {
+	notifyChannels(ctx, text, config.NotifyChannelSlack, config.NotifyChannelDiscord)
+}
+
+// notifyChannels posts text to the webhooks of the given channels that notifications names
+func notifyChannels(ctx *probot.Context, text string, channels ...string) {
+	cfg := config.GetConfig().Notifications
+	webhooks := []struct {
+		name, env string
+		payload   map[string]string
+	}{
+		{config.NotifyChannelSlack, cfg.SlackWebhookEnv, map[string]string{"text": text}},
+		{config.NotifyChannelDiscord, cfg.DiscordWebhookEnv, map[string]string{"content": text}},
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, hook := range webhooks {
+		if !slices.Contains(channels, hook.name) {
+			continue
+		}
+		url := ""
+		if hook.env != "" {
+			url = os.Getenv(hook.env)
+		}
+		if url == "" {
+			continue
+		}
+		body, _ := json.Marshal(hook.payload)
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("webhook returned %s", resp.Status)
+			}
+		}
+		if err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to post notification", "channel", hook.name, "error", err)
+		}
+	}
+}
+
+// handleDeadLetters lists dead-lettered runs, newest first; ?repo=owner/name narrows them
+func handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	letters, err := store.DefaultDeadLetters()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	all, err := letters.ListDeadLetters()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	repo := r.URL.Query().Get("repo")
+	out := []*store.DeadLetter{}
+	for _, d := range all {
+		if repo == "" || d.Repo == repo {
+			out = append(out, d)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"dead_letters": out})
+}
+
+// handleDeadLetter returns the dead letter of one issue
+func handleDeadLetter(w http.ResponseWriter, r *http.Request) {
+	d, ok := getDeadLetter(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(d)
+}
+
+// handleRequeueDeadLetter queues a dead-lettered run again and removes its dead letter. A
+// failed issue run with a checkpoint is resumed from it; any other run replays its trigger.
+// The run continues in the background, reporting on the issue as usual.
+func handleRequeueDeadLetter(w http.ResponseWriter, r *http.Request) {
+	d, ok := getDeadLetter(w, r)
+	if !ok {
+		return
+	}
+	var resume *store.Run
+	if d.Kind == issueRunKind {
+		if runs, err := store.Default(); err == nil {
+			if run, err := runs.GetRun(d.RunID); err == nil && run.Status == store.StatusFailed && run.Checkpoint != nil {
+				resume = run
+			}
+		}
+	}
+	if resume == nil && len(d.Trigger) == 0 {
+		http.Error(w, "dead letter has neither a checkpoint to resume nor a trigger to replay", http.StatusConflict)
+		return
+	}
+	app, err := repoActions.AppFromEnv()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	letters, err := store.DefaultDeadLetters()
+	if err == nil {
+		err = letters.DeleteDeadLetter(d.Repo, d.IssueNumber)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Requeueing dead-lettered run", "run", d.RunID, "resume", resume != nil)
+	go func() {
+		if err := requeueDeadLetter(app, d, resume); err != nil {
+			slog.Error("Requeued run failed", "run", d.RunID, "error", err)
+		}
+	}()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]any{"requeued": d.RunID, "resumed": resume != nil})
+}
+
+// requeueDeadLetter runs a dead-lettered run again under its installation: resume is the
+// failed run to continue from its checkpoint, or nil to replay the trigger
+func requeueDeadLetter(app *probot.App, d *store.DeadLetter, resume *store.Run) error {
+	ctx, err := repoActions.NewInstallationContext(app, d.InstallationID)
+	if err != nil {
+		return err
+	}
+	var event github.IssuesEvent
+	if len(d.Trigger) > 0 {
+		if err := json.Unmarshal(d.Trigger, &event); err != nil {
+			return fmt.Errorf("invalid dead letter trigger: %w", err)
+		}
+		ctx.Payload = &event
+	}
+
+	if resume != nil {
+		logging.Bind(ctx, "run_id", resume.ID)
+		lease, ok, err := lockIssue(d.Repo, d.IssueNumber)
+		if err != nil {
+			return err
+		} else if !ok {
+			return errors.New("issue is already being processed")
+		}
+		defer lease.Release()
+		return resumeIssueRun(ctx, config.GetConfig(), lease, resume, d.IssueTitle)
+	}
+	if d.Kind == multiRepoRunKind {
+		return runMultiRepoWorkflow(ctx, &event, d.Repo, d.IssueNumber, d.IssueTitle)
+	}
+	return runIssueWorkflow(ctx, d.Repo, d.IssueNumber, d.IssueTitle, nil)
+}
+
+// getDeadLetter loads the dead letter named by the {owner}/{repo}/{number} path, writing the
+// error response when there is none
+func getDeadLetter(w http.ResponseWriter, r *http.Request) (*store.DeadLetter, bool) {
+	number, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil {
+		http.Error(w, "issue number must be a number", http.StatusBadRequest)
+		return nil, false
+	}
+	letters, err := store.DefaultDeadLetters()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	d, err := letters.GetDeadLetter(repoPathValue(r), number)
+	if errors.Is(err, store.ErrDeadLetterNotFound) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return d, true
+}
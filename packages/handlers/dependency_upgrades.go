@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/repository"
+	"devflow-agent/packages/upgrades"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// maxTestOutputChars bounds the test log quoted in an upgrade PR body
+const maxTestOutputChars = 3000
+
+// StartDependencyUpgradeScheduler runs the dependency upgrade workflow for every installed
+// repository on the configured interval. It returns immediately; the loop runs in the background.
+func StartDependencyUpgradeScheduler() {
+	cfg := config.GetConfig().DependencyUpgrades
+	if !cfg.Enabled {
+		return
+	}
+	interval := time.Duration(cfg.IntervalHours) * time.Hour
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	slog.Info("Dependency upgrade scheduler started", "interval", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			runScheduledDependencyUpgrades()
+		}
+	}()
+}
+
+// runScheduledDependencyUpgrades upgrades dependencies in every repository the app can access
+func runScheduledDependencyUpgrades() {
+	app, err := repository.AppFromEnv()
+	if err != nil {
+		slog.Error("Cannot run scheduled dependency upgrades", "error", err)
+		return
+	}
+	installations, err := repository.ListInstalledRepositories(context.Background(), app)
+	if err != nil {
+		slog.Error("Failed to list installed repositories", "error", err)
+		return
+	}
+
+	for installationID, repos := range installations {
+		ctx, err := repository.NewInstallationContext(app, installationID)
+		if err != nil {
+			slog.Error("Failed to authenticate installation", "installationID", installationID, "error", err)
+			continue
+		}
+		for _, repoName := range repos {
+			if err := RunDependencyUpgrades(ctx, repoName); err != nil {
+				slog.Error("Dependency upgrade run failed", "repo", repoName, "error", err)
+			}
+		}
+	}
+}
+
+// RunDependencyUpgrades opens one PR per outdated dependency of the repository, each on its
+// own branch with the manifest/lockfile changes and the result of the repository's tests
+func RunDependencyUpgrades(ctx *probot.Context, repoName string) error {
+	cfg := config.GetConfig()
+	upgradeCfg := cfg.DependencyUpgrades
+
+	repoPath, _, err := repository.CloneRepository(context.Background(), repoName)
+	if err != nil {
+		return fmt.Errorf("failed to clone repository: %w", err)
+	}
+	defer func() { _ = repository.CleanupRepo(repoPath) }()
+
+	found, err := upgrades.DetectOutdated(context.Background(), repoPath, upgradeCfg.Ecosystems)
+	if err != nil {
+		return fmt.Errorf("failed to detect outdated dependencies: %w", err)
+	}
+	slog.InfoContext(logging.For(ctx), "Outdated dependencies detected", "repo", repoName, "count", len(found))
+
+	opened := 0
+	for _, u := range found {
+		if upgradeCfg.MaxPRsPerRun > 0 && opened >= upgradeCfg.MaxPRsPerRun {
+			slog.InfoContext(logging.For(ctx), "Dependency upgrade PR limit reached", "repo", repoName, "limit", upgradeCfg.MaxPRsPerRun)
+			break
+		}
+		branchName := upgradeCfg.BranchPrefix + u.BranchSuffix()
+		if repository.BranchExists(ctx, repoName, branchName) {
+			continue
+		}
+
+		if err := openUpgradePR(ctx, cfg, repoName, repoPath, branchName, u); err != nil {
+			slog.ErrorContext(logging.For(ctx), "Failed to open dependency upgrade PR", "repo", repoName, "upgrade", u.String(), "error", err)
+		} else {
+			opened++
+		}
+	}
+	return nil
+}
+
+// openUpgradePR applies one upgrade to the checkout, tests it, pushes it to branchName and
+// opens the PR. The checkout is reset afterwards so upgrades stay independent.
+func openUpgradePR(ctx *probot.Context, cfg *config.Config, repoName, repoPath, branchName string, u upgrades.Upgrade) error {
+	defer revertWorkingTree(repoPath)
+
+	if err := upgrades.Apply(context.Background(), repoPath, u); err != nil {
+		return err
+	}
+	changed, err := upgrades.ChangedFiles(repoPath)
+	if err != nil {
+		return err
+	}
+
+	testStatus, testOutput, _ := runUpgradeTests(cfg, repoPath)
+	commitMessage := fmt.Sprintf("Bump %s from %s to %s", u.Name, u.Current, u.Latest)
+	_, err = pushChangesAsPR(ctx, repoName, repoPath, branchName, commitMessage, commitMessage,
+		upgradePRBody(u, changed, testStatus, testOutput), changed)
+	return err
+}
+
+// pushChangesAsPR commits the changed repo-relative files to a new branch and opens a PR
+func pushChangesAsPR(ctx *probot.Context, repoName, repoPath, branchName, commitMessage, title, body string, changed []string) (*githubapi.PullRequest, error) {
+	var files []string
+	for _, f := range changed {
+		abs := filepath.Join(repoPath, f)
+		if _, err := os.Stat(abs); err == nil {
+			files = append(files, abs)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no file changes to commit")
+	}
+
+	if err := repository.CreateBranch(ctx, repoName, branchName); err != nil {
+		return nil, err
+	}
+	if err := repository.CommitMultipleFiles(ctx, repoName, branchName, commitMessage, files, false, repoPath); err != nil {
+		return nil, err
+	}
+	pr, err := openPullRequest(ctx, repoName, branchName, title, body)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(logging.For(ctx), "Pull request opened", "repo", repoName, "branch", branchName, "prNumber", pr.Number)
+	return pr, nil
+}
+
+// revertWorkingTree discards every local modification so the next change starts clean
+func revertWorkingTree(repoPath string) {
+	changed, err := upgrades.ChangedFiles(repoPath)
+	if err != nil {
+		slog.Warn("Failed to list changes to revert", "error", err)
+		return
+	}
+	repository.RevertPaths(repoPath, changed)
+}
+
+// runUpgradeTests runs the configured test command and returns a status line, its output and
+// whether the tests passed. A missing test command counts as passing.
+func runUpgradeTests(cfg *config.Config, repoPath string) (string, string, bool) {
+	return runTestCommand(repoPath, cfg.Agent.TestCommand, cfg.Timeouts.TestsSeconds)
+}
+
+// runTestCommand runs a test command in repoPath, limited to seconds (0 is no limit), and
+// returns a status line, its output and whether the tests passed
+func runTestCommand(repoPath, command string, seconds int) (string, string, bool) {
+	if command == "" {
+		return "Not run (no test command configured)", "", true
+	}
+	testCtx, cancel := config.StageContext(context.Background(), seconds)
+	defer cancel()
+
+	cmd := exec.CommandContext(testCtx, "sh", "-c", command)
+	cmd.Dir = repoPath
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if len(output) > maxTestOutputChars {
+		output = "...\n" + output[len(output)-maxTestOutputChars:]
+	}
+	if err != nil {
+		return fmt.Sprintf("❌ Failed (%v)", err), output, false
+	}
+	return "✅ Passed", output, true
+}
+
+func upgradePRBody(u upgrades.Upgrade, changed []string, testStatus, testOutput string) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Bumps `%s` from `%s` to `%s` in `%s`.\n\n", u.Name, u.Current, u.Latest, u.Manifest))
+	b.WriteString("### Changed files\n\n")
+	for _, f := range changed {
+		b.WriteString(fmt.Sprintf("- `%s`\n", f))
+	}
+	b.WriteString(testResultsMarkdown(testStatus, testOutput))
+	b.WriteString("\n---\n*Opened automatically by DevFlow's scheduled dependency upgrades.*\n")
+	return b.String()
+}
+
+// testResultsMarkdown renders a test status with its output folded away
+func testResultsMarkdown(status, output string) string {
+	md := fmt.Sprintf("\n### Tests\n\n%s\n", status)
+	if output != "" {
+		md += "\n<details><summary>Test output</summary>\n\n```\n" + output + "\n```\n</details>\n"
+	}
+	return md
+}
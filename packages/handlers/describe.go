@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// describeAssociations may rewrite any pull request's description; a pull request's author
+// may always rewrite their own
+var describeAssociations = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+
+func init() {
+	commandHandlers["describe"] = handleDescribeCommand
+}
+
+// handleDescribeCommand rewrites a pull request's description from its final diff, for when
+// the one written with the changes is unusable: "/devflow describe [--template full|minimal]".
+// The issues the old description closed or referenced stay linked from the new one.
+func handleDescribeCommand(ctx *probot.Context, event *github.IssueCommentEvent, cmd slashCommand) error {
+	repoName := event.GetRepo().GetFullName()
+	pr := event.GetIssue()
+	number := pr.GetNumber()
+	if !pr.IsPullRequest() {
+		return repoActions.PostIssueComment(ctx, repoName, number, fmt.Sprintf("`%s describe` works on pull requests only.", commandPrefix))
+	}
+	commenter := event.GetComment().GetUser().GetLogin()
+	if !slices.Contains(describeAssociations, event.GetComment().GetAuthorAssociation()) && !strings.EqualFold(commenter, pr.GetUser().GetLogin()) {
+		return repoActions.PostIssueComment(ctx, repoName, number,
+			fmt.Sprintf("@%s only maintainers and the pull request's author can rewrite its description.", commenter))
+	}
+	format, ok := parseDescribeArgs(cmd.Args)
+	if !ok {
+		return repoActions.PostIssueComment(ctx, repoName, number,
+			fmt.Sprintf("Usage: `%s describe [--template %s|%s]`", commandPrefix, ai.DescribeFull, ai.DescribeMinimal))
+	}
+
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
+	files, err := repoActions.NewGitHubClient(ctx).ListPullRequestFiles(context.Background(), owner, repo, number)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return repoActions.PostIssueComment(ctx, repoName, number, "This pull request has no changes to describe.")
+	}
+
+	cfg := config.GetConfig()
+	generation, err := ai.ResolveGenerationSettings(cfg, triggerRepoConfig(ctx, repoName).AI)
+	if err != nil {
+		return repoActions.PostIssueComment(ctx, repoName, number, failureComment(err))
+	}
+	llmCtx, cancel := config.StageContext(logging.For(ctx), cfg.Timeouts.LLMSeconds)
+	defer cancel()
+	description, err := ai.DescribePullRequest(llmCtx, pr.GetTitle(), renderPullRequestDiff(files), format, generation.PRBodyMaxTokens)
+	if err != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to describe pull request", "prNumber", number, "error", err)
+		return repoActions.PostIssueComment(ctx, repoName, number,
+			fmt.Sprintf("DevFlow could not write a new description. The current one is unchanged.\n\n<details><summary>Error details</summary>\n\n```\n%v\n```\n</details>", err))
+	}
+
+	lang := issueLanguage(ctx, repoName, pr)
+	body := localizeLimited(lang, description, generation.PRBodyMaxTokens) +
+		fmt.Sprintf("\n\n<sub>Description written by DevFlow from the diff, as requested by @%s.</sub>", commenter)
+	body, overflow := gatePRBody(linkIssues(body, bodyLinks(pr.GetBody())))
+	if err := repoActions.UpdatePullRequestBody(ctx, repoName, &githubapi.PullRequest{Number: number}, body); err != nil {
+		return err
+	}
+	postPRBodyOverflow(ctx, repoName, number, overflow)
+	slog.InfoContext(logging.For(ctx), "Pull request description rewritten from its diff", "prNumber", number, "format", format, "files", len(files))
+	return repoActions.PostIssueComment(ctx, repoName, number, localize(lang, "Updated the description of this pull request from its diff."))
+}
+
+// parseDescribeArgs reads "--template <format>" (or "--template=<format>"); the default is
+// the full format
+func parseDescribeArgs(args string) (string, bool) {
+	fields := strings.Fields(strings.ReplaceAll(args, "=", " "))
+	switch {
+	case len(fields) == 0:
+		return ai.DescribeFull, true
+	case len(fields) == 2 && fields[0] == "--template":
+		format := strings.ToLower(fields[1])
+		return format, format == ai.DescribeFull || format == ai.DescribeMinimal
+	}
+	return "", false
+}
+
+// renderPullRequestDiff joins the patches of a pull request's files into one diff
+func renderPullRequestDiff(files []githubapi.PullRequestFile) string {
+	var b strings.Builder
+	for _, f := range files {
+		b.WriteString(fmt.Sprintf("diff --git a/%s b/%s (%s)\n", f.Filename, f.Filename, f.Status))
+		if f.Patch == "" {
+			b.WriteString("(binary or too large to show)\n")
+			continue
+		}
+		b.WriteString(strings.TrimSuffix(f.Patch, "\n") + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// StartDiscussionReceiver listens for discussion and discussion_comment webhooks, which
+// probot's event parser does not support, and handles them in the background
+func StartDiscussionReceiver() {
+	cfg := config.GetConfig().Discussions
+	if !cfg.Enabled {
+		return
+	}
+	app, err := repository.AppFromEnv()
+	if err != nil {
+		slog.Error("Cannot start discussion receiver", "error", err)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", discussionWebhookHandler(app))
+	slog.Info("Discussion receiver started", "addr", cfg.ListenAddr)
+	go func() {
+		if err := http.ListenAndServe(cfg.ListenAddr, mux); err != nil {
+			slog.Error("Discussion receiver stopped", "error", err)
+		}
+	}()
+}
+
+func discussionWebhookHandler(app *probot.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := github.ValidatePayload(r, []byte(app.Secret))
+		if err != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		eventType := github.WebHookType(r)
+		if eventType == "ping" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		ev, err := repository.ParseDiscussionEvent(eventType, payload)
+		if err != nil {
+			slog.Warn("Rejected discussion webhook", "event", eventType, "error", err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		// DevFlow's own replies must not trigger it again
+		if ev.SenderIsBot {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		ctx, err := repository.NewInstallationContext(app, ev.InstallationID)
+		if err != nil {
+			slog.Error("Failed to authenticate installation", "installationID", ev.InstallationID, "error", err)
+			http.Error(w, "Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !eventAllowed(ctx, ev.RepoName, ev.Type, ev.Action) {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		go func() {
+			if err := handleDiscussionEvent(ctx, ev); err != nil {
+				slog.Error("Discussion event failed", "repo", ev.RepoName, "discussion", ev.Discussion.Number, "error", err)
+			}
+		}()
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// handleDiscussionEvent triages new proposals and converts discussions on request. Resolving
+// through the agent is only possible with the resolve label, since anyone may comment.
+func handleDiscussionEvent(ctx *probot.Context, ev *repository.DiscussionEvent) error {
+	cfg := config.GetConfig().Discussions
+	switch {
+	case ev.Type == "discussion" && ev.Action == "created":
+		if len(cfg.Categories) > 0 && !slices.ContainsFunc(cfg.Categories, func(c string) bool { return strings.EqualFold(c, ev.Discussion.Category) }) {
+			return nil
+		}
+		return triageDiscussion(ctx, ev)
+	case ev.Type == "discussion" && ev.Action == "labeled":
+		switch {
+		case cfg.ResolveLabel != "" && strings.EqualFold(ev.Label, cfg.ResolveLabel):
+			return convertDiscussion(ctx, ev, true)
+		case cfg.ConvertLabel != "" && strings.EqualFold(ev.Label, cfg.ConvertLabel):
+			return convertDiscussion(ctx, ev, false)
+		}
+	case ev.Type == "discussion_comment" && ev.Action == "created":
+		if cmd, ok := parseSlashCommand(ev.CommentBody); ok && cmd.Name == "issue" {
+			return convertDiscussion(ctx, ev, false)
+		}
+	}
+	return nil
+}
+
+// triageDiscussion replies to a new proposal with a summary, draft acceptance criteria and
+// open questions
+func triageDiscussion(ctx *probot.Context, ev *repository.DiscussionEvent) error {
+	d := ev.Discussion
+	triage, err := ai.TriageDiscussion(logging.For(ctx), d.Title, d.Body, d.Category)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("**DevFlow triage**\n\n" + triage.Summary + "\n")
+	writeTriageSections(&b, triage)
+	if triage.Actionable {
+		b.WriteString("\nThis looks ready to implement. Reply `/devflow issue` to turn it into an issue.")
+	} else {
+		b.WriteString("\nAnswering the open questions would make this ready for an issue.")
+	}
+	return repository.PostDiscussionComment(ctx, d, b.String())
+}
+
+// convertDiscussion opens an issue for a discussion, with acceptance criteria drafted by the
+// model, and links it back. With resolve the issue carries the trigger label, so the issue
+// pipeline picks it up as if a maintainer had labeled it.
+func convertDiscussion(ctx *probot.Context, ev *repository.DiscussionEvent, resolve bool) error {
+	cfg := config.GetConfig().Discussions
+	d := ev.Discussion
+
+	// Label and command can both arrive, and deliveries can repeat; convert once
+	claims, err := store.DefaultClaimer()
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("discussion:%s#%d:convert", ev.RepoName, d.Number)
+	ok, err := claims.Claim(key, store.IdempotencyTTL())
+	if err != nil {
+		return err
+	} else if !ok {
+		slog.InfoContext(logging.For(ctx), "Discussion already converted", "repo", ev.RepoName, "discussion", d.Number)
+		return nil
+	}
+
+	var body strings.Builder
+	body.WriteString(fmt.Sprintf("Converted from discussion #%d (%s) opened by @%s.\n\n", d.Number, d.HTMLURL, d.AuthorLogin))
+	body.WriteString(strings.TrimSpace(d.Body) + "\n")
+	triage, err := ai.TriageDiscussion(logging.For(ctx), d.Title, d.Body, d.Category)
+	if err != nil {
+		// The issue is still useful without drafted criteria
+		slog.WarnContext(logging.For(ctx), "Failed to draft acceptance criteria", "discussion", d.Number, "error", err)
+	} else {
+		writeTriageSections(&body, triage)
+	}
+
+	labels := append([]string(nil), cfg.IssueLabels...)
+	if resolve && cfg.ResolveIssueLabel != "" {
+		labels = append(labels, cfg.ResolveIssueLabel)
+	}
+	issue, err := repository.CreateIssue(ctx, ev.RepoName, d.Title, body.String(), labels)
+	if err != nil {
+		if uErr := claims.Unclaim(key); uErr != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to release discussion claim", "key", key, "error", uErr)
+		}
+		return err
+	}
+	slog.InfoContext(logging.For(ctx), "Converted discussion to issue", "repo", ev.RepoName, "discussion", d.Number, "issueNumber", issue.Number, "resolve", resolve)
+
+	reply := fmt.Sprintf("DevFlow opened #%d to track this proposal.", issue.Number)
+	if resolve {
+		reply = fmt.Sprintf("DevFlow opened #%d for this proposal and is working on it.", issue.Number)
+	}
+	return repository.PostDiscussionComment(ctx, d, reply)
+}
+
+func writeTriageSections(b *strings.Builder, triage *ai.DiscussionTriage) {
+	if len(triage.AcceptanceCriteria) > 0 {
+		b.WriteString("\n### Acceptance criteria\n\n")
+		for _, c := range triage.AcceptanceCriteria {
+			b.WriteString("- [ ] " + c + "\n")
+		}
+	}
+	if len(triage.OpenQuestions) > 0 {
+		b.WriteString("\n### Open questions\n\n")
+		for _, q := range triage.OpenQuestions {
+			b.WriteString("- " + q + "\n")
+		}
+	}
+}
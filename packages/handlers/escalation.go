@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// maxPlanDiffBytes keeps an escalated run's diff well under GitHub's 65536-character comments
+const maxPlanDiffBytes = 30000
+
+// scoreRun scores a run by the lowest of the confidences reported, clamped to 0-1, and
+// decides whether the repository's escalation threshold hands it to a human. It returns nil
+// when neither confidence was reported.
+func scoreRun(plan, change *float64, esc config.EscalationConfig) *store.RunConfidence {
+	conf := &store.RunConfidence{Plan: plan, Change: change, Score: 1}
+	if esc.MinConfidence != nil {
+		conf.Threshold = *esc.MinConfidence
+	}
+	reported := false
+	for _, c := range []*float64{plan, change} {
+		if c != nil {
+			conf.Score = min(conf.Score, max(*c, 0))
+			reported = true
+		}
+	}
+	if !reported {
+		return nil
+	}
+	conf.Escalated = conf.Score < conf.Threshold
+	return conf
+}
+
+// escalateIssueRun posts the agent's changes on the issue as a plan for the reviewers instead
+// of opening a pull request, and records the run as escalated with its score
+func escalateIssueRun(ctx *probot.Context, lang, repoName, repoPath string, issue *github.Issue, result *ai.PythonAgentResult, conf *store.RunConfidence, reviewers []string, variants map[string]string, candidates []store.FileCandidate) {
+	issueNumber := issue.GetNumber()
+	slog.InfoContext(logging.For(ctx), "Agent unsure of its changes, escalating to a human", "issueNumber", issueNumber,
+		"score", conf.Score, "threshold", conf.Threshold)
+
+	comment := escalationComment("open a pull request", conf, reviewers, renderRunPlan(repoPath, result))
+	if err := repoActions.PostIssueComment(ctx, repoName, issueNumber, localize(lang, comment)); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to post escalation comment", "issueNumber", issueNumber, "error", err)
+	}
+	if err := repoActions.SetIssueStatus(ctx, repoName, issueNumber, ""); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to clear issue status", "issueNumber", issueNumber, "error", err)
+	}
+
+	runs, err := store.Default()
+	if err == nil {
+		err = runs.SaveRun(&store.Run{
+			ID:          store.RunID(issueRunKind, repoName, issueNumber),
+			Kind:        issueRunKind,
+			Repo:        repoName,
+			IssueNumber: issueNumber,
+			Status:      store.StatusEscalated,
+			Variants:    variants,
+			Confidence:  conf,
+			Candidates:  candidates,
+		})
+	}
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to record escalated run", "issueNumber", issueNumber, "error", err)
+	}
+}
+
+// renderRunPlan renders the agent's summary, the files it changed and its diff as a plan
+func renderRunPlan(repoPath string, result *ai.PythonAgentResult) string {
+	var plan strings.Builder
+	if result.Summary != "" {
+		plan.WriteString("### Plan\n\n" + result.Summary + "\n\n")
+	}
+	plan.WriteString("### Files it would change\n\n- " + strings.Join(result.ChangesMade, "\n- ") + "\n")
+	if diff := repoActions.ProposedDiff(repoPath, result.ChangesMade, maxPlanDiffBytes); diff != "" {
+		plan.WriteString("\n<details><summary>Proposed changes</summary>\n\n```diff\n" + diff + "```\n</details>\n")
+	}
+	return plan.String()
+}
+
+// mentionAll mentions every login, with or without a leading @
+func mentionAll(logins []string) string {
+	mentions := make([]string, len(logins))
+	for i, l := range logins {
+		mentions[i] = "@" + strings.TrimPrefix(l, "@")
+	}
+	return strings.Join(mentions, " ")
+}
+
+// escalationComment explains why DevFlow did not go ahead with what it would have done and
+// asks the reviewers to pick up the plan
+func escalationComment(action string, conf *store.RunConfidence, reviewers []string, plan string) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("DevFlow is not confident enough in this issue's solution to %s (confidence %.2f, below %.2f). Here is its plan for a human to review instead.\n\n",
+		action, conf.Score, conf.Threshold))
+	b.WriteString(plan)
+	b.WriteString("\n")
+	if len(reviewers) > 0 {
+		b.WriteString(mentionAll(reviewers) + ", could you review this plan? ")
+	}
+	b.WriteString("Implement it by hand, or clarify the issue and re-apply the trigger label to run DevFlow again.")
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// eventPolicyTTL is how long a repository's event policy is reused before its settings are
+// read again, so busy repositories do not cost an API call per delivery
+const eventPolicyTTL = time.Minute
+
+var eventPolicies struct {
+	sync.Mutex
+	byRepo map[string]cachedEventPolicy
+}
+
+type cachedEventPolicy struct {
+	policy  config.EventPolicyConfig
+	fetched time.Time
+}
+
+// withEventPolicy wraps a handler so events the repository turned off under events are
+// dropped. Events without a repository, such as installations, always run.
+func withEventPolicy(event string, handler func(ctx *probot.Context) error) func(ctx *probot.Context) error {
+	return func(ctx *probot.Context) error {
+		p, ok := ctx.Payload.(interface{ GetRepo() *github.Repository })
+		if !ok || p.GetRepo() == nil {
+			return handler(ctx)
+		}
+		action := ""
+		if a, ok := ctx.Payload.(interface{ GetAction() string }); ok {
+			action = a.GetAction()
+		}
+		if !eventAllowed(ctx, p.GetRepo().GetFullName(), event, action) {
+			return nil
+		}
+		return handler(ctx)
+	}
+}
+
+// eventAllowed reports whether the repository's event policy lets DevFlow act on an event
+func eventAllowed(ctx *probot.Context, repoName, event, action string) bool {
+	if repoEventPolicy(ctx, repoName).Allows(event, action) {
+		return true
+	}
+	slog.InfoContext(logging.For(ctx), "Event turned off by repository settings", "repo", repoName, "event", event, "action", action)
+	return false
+}
+
+// repoEventPolicy returns the repository's event policy, read at most once per eventPolicyTTL
+func repoEventPolicy(ctx *probot.Context, repoName string) config.EventPolicyConfig {
+	eventPolicies.Lock()
+	cached, ok := eventPolicies.byRepo[repoName]
+	eventPolicies.Unlock()
+	if ok && time.Since(cached.fetched) < eventPolicyTTL {
+		return cached.policy
+	}
+
+	policy := triggerRepoConfig(ctx, repoName).Events
+	eventPolicies.Lock()
+	if eventPolicies.byRepo == nil {
+		eventPolicies.byRepo = make(map[string]cachedEventPolicy)
+	}
+	eventPolicies.byRepo[repoName] = cachedEventPolicy{policy: policy, fetched: time.Now()}
+	eventPolicies.Unlock()
+	return policy
+}
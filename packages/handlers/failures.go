@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	repoActions "devflow-agent/packages/repository"
+)
+
+// failureComment maps a workflow error to an issue comment explaining what went wrong
+// and what the user can do about it.
+func failureComment(err error) string {
+	var (
+		cloneErr  *repoActions.CloneError
+		kbErr     *repoActions.KBMissingError
+		schemaErr *repoActions.KBSchemaError
+		llmErr    *ai.LLMError
+		safetyErr *ai.SafetyBlockError
+		genErr    *ai.GenerationSettingsError
+		commitErr *repoActions.CommitError
+		prErr     *repoActions.PRError
+		policyErr *repoActions.PolicyViolationError
+		headerErr *repoActions.LicenseHeaderError
+	)
+
+	var title, remediation string
+	switch {
+	case errors.As(err, &kbErr):
+		title = "DevFlow isn't fully set up for this repository yet."
+		remediation = "Merge the \"Initialize Devflow Knowledge Base\" pull request DevFlow opened for this repository, then re-apply the label to this issue."
+	case errors.As(err, &schemaErr):
+		title = "This repository's knowledge base was written by a newer version of DevFlow."
+		remediation = fmt.Sprintf("Upgrade the DevFlow agent to a version that reads knowledge base schema %d, then re-apply the label to this issue.", schemaErr.Found)
+	case errors.As(err, &policyErr):
+		title = "The proposed changes touch paths DevFlow is not allowed to modify."
+		remediation = "Adjust `paths.allow` / `paths.deny` in `.devflow-agent/config.yaml` if these paths should be editable, or make the change manually:\n\n" +
+			repoActions.FormatPathViolations(policyErr.Violations)
+	case errors.As(err, &headerErr):
+		title = "The proposed changes add files without the license header this repository requires."
+		remediation = "Turn on `license_headers.enabled` in `.devflow-agent/config.yaml` so DevFlow adds the header, or add it to these files manually:\n\n- " +
+			strings.Join(headerErr.Files, "\n- ")
+	case errors.As(err, &genErr):
+		title = "The AI settings in this repository's `.devflow-agent/config.yaml` exceed what the configured models accept."
+		remediation = "Adjust `ai.temperature`, `ai.max_output_tokens` or `ai.pr_body_max_tokens` in `.devflow-agent/config.yaml`, then re-apply the label:\n\n- " + strings.Join(genErr.Problems, "\n- ")
+	case errors.As(err, &cloneErr):
+		title = "DevFlow could not clone the repository."
+		remediation = "Check that the DevFlow app still has access to this repository (Settings → GitHub Apps) and that GitHub is reachable, then re-apply the label."
+	case errors.As(err, &safetyErr):
+		title = "The AI model declined to work on this issue. " + safetyErr.Explain()
+		remediation = "Safety filters can trip on exploit code, credentials or strong language in the issue or the code it points to. Rephrase the issue or move such material out of it, then re-apply the label. Maintainers can relax the thresholds under `ai.safety_settings`."
+	case errors.As(err, &llmErr):
+		title = "The AI model or agent server did not return a usable result."
+		remediation = "This is usually transient (rate limits or provider outages). Re-apply the label to try again; if it keeps failing, simplify the issue description or split it into smaller issues."
+	case errors.As(err, &commitErr):
+		title = fmt.Sprintf("DevFlow produced changes but could not push them to `%s`.", commitErr.Branch)
+		remediation = "Make sure the app has **Contents: Read and write** permission and that no branch protection rule blocks the branch, then comment `/devflow retry` to push the same changes again without re-running the agent."
+	case errors.As(err, &prErr):
+		title = fmt.Sprintf("Changes were pushed to `%s`, but the pull request could not be opened.", prErr.Branch)
+		remediation = "Check that the app has **Pull requests: Read and write** permission, then comment `/devflow retry` to open it, or open a pull request from that branch manually."
+	case errors.Is(err, context.DeadlineExceeded):
+		title = "DevFlow ran out of time."
+		remediation = "Stage limits are configured under `timeouts`. Re-apply the label to try again, or narrow the scope of the issue."
+	default:
+		title = "DevFlow could not resolve this issue."
+		remediation = "Remove and re-add the trigger label to try again."
+	}
+
+	return fmt.Sprintf("%s\n\n%s\n\n<details><summary>Error details</summary>\n\n```\n%v\n```\n</details>", title, remediation, err)
+}
+
+// transientFailure reports whether err is worth retrying unchanged: model or agent server
+// errors and failed clones. Safety blocks and rejected generation settings fail the same
+// way every time.
+func transientFailure(err error) bool {
+	var (
+		cloneErr  *repoActions.CloneError
+		llmErr    *ai.LLMError
+		safetyErr *ai.SafetyBlockError
+		genErr    *ai.GenerationSettingsError
+	)
+	if errors.As(err, &safetyErr) || errors.As(err, &genErr) {
+		return false
+	}
+	return errors.As(err, &llmErr) || errors.As(err, &cloneErr)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/store"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// deliveryIDs maps the contexts built by queue workers to the delivery they handle; probot
+// does not expose the delivery header to inline handlers
+var deliveryIDs sync.Map // *probot.Context -> string
+
+// deliveryKey identifies the webhook delivery behind an issue event. Redeliveries carry the
+// same delivery ID and an identical payload, so without the ID the issue's updated_at
+// (which every issue action bumps) stands in for it.
+func deliveryKey(ctx *probot.Context, event *github.IssuesEvent) string {
+	if id, ok := deliveryIDs.Load(ctx); ok {
+		return id.(string)
+	}
+	return event.Issue.GetUpdatedAt().UTC().Format("20060102T150405Z")
+}
+
+// claimIssueEvent records the idempotency key of an issue event before it is processed.
+// ok is false when another delivery of the same event was already claimed. done must be
+// called with the processing result; a failed run gives up its claim so it can be retried.
+func claimIssueEvent(ctx *probot.Context, event *github.IssuesEvent, repoName string, issueNumber int) (done func(error), ok bool, err error) {
+	claims, err := store.DefaultClaimer()
+	if err != nil {
+		return nil, false, err
+	}
+	key := fmt.Sprintf("issue:%s#%d:%s:%s", repoName, issueNumber, event.GetAction(), deliveryKey(ctx, event))
+	ok, err = claims.Claim(key, store.IdempotencyTTL())
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return func(runErr error) {
+		if runErr == nil {
+			return
+		}
+		if err := claims.Unclaim(key); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to release idempotency key", "key", key, "error", err)
+		}
+	}, true, nil
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// handleIssueClosed clears the issue's lifecycle labels and, with issues.cleanup_on_close,
+// abandons DevFlow's work on it: open pull requests are closed and their branches deleted,
+// and runs still queued or held are dropped, in every worker process. A pull request that
+// closed the issue by merging is no longer open, so it is left alone. The issue gets a note of
+// what was cleaned up.
+func handleIssueClosed(ctx *probot.Context, event *github.IssuesEvent, repoName string, issueNumber int) error {
+	cfg := config.GetConfig()
+	if err := repoActions.SetIssueStatus(ctx, repoName, issueNumber, ""); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to clear issue status", "issueNumber", issueNumber, "error", err)
+	}
+	if !cfg.Issues.CleanupOnClose {
+		return nil
+	}
+
+	var done []string
+	if err := recordIssueClosed(repoName, issueNumber); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to record closed issue, runs queued by other workers may still start", "issueNumber", issueNumber, "error", err)
+	}
+	queued := cancelQueuedRuns(repoName, issueNumber)
+	held := cancelHeldTrigger(ctx, repoName, issueNumber)
+	if queued || held {
+		done = append(done, "dropped its queued run")
+	}
+	closed, err := closeIssuePRs(ctx, repoName, issueNumber)
+	done = append(done, closed...)
+	if len(done) > 0 {
+		lang := issueLanguage(ctx, repoName, event.Issue)
+		note := "This issue was closed, so DevFlow " + strings.Join(done, ", ") + "."
+		if cErr := repoActions.PostIssueComment(ctx, repoName, issueNumber, localize(lang, note)); cErr != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to post issue cleanup note", "issueNumber", issueNumber, "error", cErr)
+		}
+	}
+	return err
+}
+
+// closeIssuePRs closes the issue's open DevFlow pull requests, the ones from its issue
+// branches, and deletes their branches. It returns what it did, one entry per pull request.
+func closeIssuePRs(ctx *probot.Context, repoName string, issueNumber int) ([]string, error) {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return nil, err
+	}
+	client := repoActions.NewGitHubClient(ctx)
+	open, err := client.ListPullRequests(context.Background(), owner, repo, "open", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list open pull requests: %w", err)
+	}
+
+	var done []string
+	var errs []error
+	for _, pr := range open {
+		if n, ok := issueNumberFromBranch(pr.HeadRef); !ok || n != issueNumber || !strings.EqualFold(pr.HeadRepo, repoName) {
+			continue
+		}
+		if err := client.ClosePullRequest(context.Background(), owner, repo, pr.Number); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close #%d: %w", pr.Number, err))
+			continue
+		}
+		entry := fmt.Sprintf("closed #%d", pr.Number)
+		if err := repoActions.DeleteBranch(ctx, repoName, pr.HeadRef); err != nil && !errors.Is(err, githubapi.ErrNotFound) {
+			slog.WarnContext(logging.For(ctx), "Failed to delete branch of closed issue", "branch", pr.HeadRef, "error", err)
+		} else {
+			entry += fmt.Sprintf(" and deleted its branch `%s`", pr.HeadRef)
+		}
+		slog.InfoContext(logging.For(ctx), "Closed pull request of closed issue", "issueNumber", issueNumber, "prNumber", pr.Number, "branch", pr.HeadRef)
+		done = append(done, entry)
+	}
+	return done, errors.Join(errs...)
+}
+
+// cancelHeldTrigger drops the issue's trigger held by the repository's schedule, reporting
+// whether there was one
+func cancelHeldTrigger(ctx *probot.Context, repoName string, issueNumber int) bool {
+	runs, err := store.Default()
+	if err != nil {
+		return false
+	}
+	run, err := runs.GetRun(store.RunID(heldRunKind, repoName, issueNumber))
+	if err != nil || run.Status != store.StatusHeld {
+		return false
+	}
+	run.Status = store.StatusCancelled
+	if err := runs.SaveRun(run); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to cancel held trigger", "issueNumber", issueNumber, "error", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// triggerRepoConfig reads the repository settings that gate a trigger. Settings that cannot
+// be read fall back to the global defaults.
+func triggerRepoConfig(ctx *probot.Context, repoName string) *config.RepoConfig {
+	repoCfg, err := repoActions.FetchRepoConfig(ctx, repoName)
+	if err == nil {
+		return repoCfg
+	}
+	slog.WarnContext(logging.For(ctx), "Could not read repository settings, applying defaults", "repo", repoName, "error", err)
+	repoCfg, _ = config.ParseRepoConfig(nil)
+	return repoCfg
+}
+
+// issueFilterReason returns why the repository's issue filters exclude an issue, or "" when
+// the agent may work on it
+func issueFilterReason(ctx *probot.Context, repoName string, issue *github.Issue, filters config.IssueFilterConfig) string {
+	for _, label := range filters.ExcludeLabels {
+		if hasLabel(issue.Labels, label) {
+			return fmt.Sprintf("labeled %s", label)
+		}
+	}
+	if len(filters.Labels) > 0 && !slices.ContainsFunc(filters.Labels, func(label string) bool { return hasLabel(issue.Labels, label) }) {
+		return "has none of the repository's trigger labels"
+	}
+	if len(filters.TitlePatterns) > 0 && !slices.ContainsFunc(filters.TitlePatterns, func(pattern string) bool {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			slog.WarnContext(logging.For(ctx), "Ignoring invalid title pattern", "repo", repoName, "pattern", pattern, "error", err)
+			return false
+		}
+		return re.MatchString(issue.GetTitle())
+	}) {
+		return "title matches no title pattern"
+	}
+	if len(filters.Milestones) > 0 && !slices.ContainsFunc(filters.Milestones, func(m string) bool {
+		return issue.Milestone != nil && strings.EqualFold(m, issue.Milestone.GetTitle())
+	}) {
+		return "not in an allowed milestone"
+	}
+	if len(filters.Authors) > 0 && !isAllowedAuthor(ctx, repoName, issue.GetUser().GetLogin(), filters.Authors) {
+		return fmt.Sprintf("author %s is not allowed", issue.GetUser().GetLogin())
+	}
+	return ""
+}
+
+// isAllowedAuthor reports whether login is one of authors, or a member of one of the
+// @org/team-slug entries among them
+func isAllowedAuthor(ctx *probot.Context, repoName, login string, authors []string) bool {
+	client := repoActions.NewGitHubClient(ctx)
+	for _, author := range authors {
+		team, isTeam := strings.CutPrefix(author, "@")
+		if !isTeam {
+			if strings.EqualFold(author, login) {
+				return true
+			}
+			continue
+		}
+		org, slug, ok := strings.Cut(team, "/")
+		if !ok {
+			slog.WarnContext(logging.For(ctx), "Ignoring author entry that is not @org/team-slug", "repo", repoName, "author", author)
+			continue
+		}
+		member, err := client.IsTeamMember(context.Background(), org, slug, login)
+		if err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to check team membership", "repo", repoName, "team", team, "user", login, "error", err)
+			continue
+		}
+		if member {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// Link keywords of repo settings links.keyword
+const (
+	linkCloses = "closes"
+	linkRefs   = "refs"
+)
+
+var (
+	// closingRefPattern matches GitHub's closing keywords, e.g. "Fixes #12"
+	closingRefPattern = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?)\s+#(\d+)\b`)
+	// refsPattern matches a reference that links an issue without closing it, e.g. "Refs #12"
+	refsPattern = regexp.MustCompile(`(?i)\brefs?\s+#(\d+)\b`)
+)
+
+// issueLink is an issue a pull request links to, and whether merging it closes the issue
+type issueLink struct {
+	Number int
+	Closes bool
+}
+
+// issueLinks returns the issues a pull request resolving issue links to: the issue itself
+// and, unless the repository turned them off, its open sub-issues and unchecked task list
+// items. links.keyword decides whether merging closes them.
+func issueLinks(ctx *probot.Context, repoName string, issue *github.Issue, links config.IssueLinksConfig) []issueLink {
+	closes := true
+	switch strings.ToLower(links.Keyword) {
+	case linkCloses, "":
+	case linkRefs:
+		closes = false
+	default:
+		slog.WarnContext(logging.For(ctx), "Ignoring unknown link keyword, closing issues", "repo", repoName, "keyword", links.Keyword)
+	}
+
+	numbers := []int{issue.GetNumber()}
+	if links.SubIssues == nil || *links.SubIssues {
+		numbers = append(numbers, repoActions.SubIssueNumbers(ctx, repoName, issue)...)
+	}
+	result := make([]issueLink, 0, len(numbers))
+	for _, n := range numbers {
+		result = append(result, issueLink{Number: n, Closes: closes})
+	}
+	return result
+}
+
+// closingRefs returns the issue numbers a PR body closes, in order of appearance
+func closingRefs(prBody string) []int {
+	return refNumbers(closingRefPattern, prBody)
+}
+
+// bodyLinks returns the issues a PR body closes, then those it only references
+func bodyLinks(prBody string) []issueLink {
+	var links []issueLink
+	closing := closingRefs(prBody)
+	for _, n := range closing {
+		links = append(links, issueLink{Number: n, Closes: true})
+	}
+	for _, n := range refNumbers(refsPattern, prBody) {
+		if !slices.Contains(closing, n) {
+			links = append(links, issueLink{Number: n})
+		}
+	}
+	return links
+}
+
+func refNumbers(pattern *regexp.Regexp, text string) []int {
+	var refs []int
+	for _, m := range pattern.FindAllStringSubmatch(text, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && !slices.Contains(refs, n) {
+			refs = append(refs, n)
+		}
+	}
+	return refs
+}
+
+// linkIssues makes a PR body link to every issue in links, prepending a "Closes #N" or
+// "Refs #N" line for each one it does not link to yet. Closing keywords the body uses for
+// issues that must stay open are turned into "Refs".
+func linkIssues(prBody string, links []issueLink) string {
+	keep := make(map[int]bool)
+	for _, link := range links {
+		if !link.Closes {
+			keep[link.Number] = true
+		}
+	}
+	if len(keep) > 0 {
+		prBody = closingRefPattern.ReplaceAllStringFunc(prBody, func(ref string) string {
+			n, _ := strconv.Atoi(closingRefPattern.FindStringSubmatch(ref)[1])
+			if !keep[n] {
+				return ref
+			}
+			return fmt.Sprintf("Refs #%d", n)
+		})
+	}
+
+	closing, referenced := closingRefs(prBody), refNumbers(refsPattern, prBody)
+	var lines []string
+	for _, link := range links {
+		switch {
+		case slices.Contains(closing, link.Number):
+		case link.Closes:
+			lines = append(lines, fmt.Sprintf("Closes #%d", link.Number))
+			closing = append(closing, link.Number)
+		case !slices.Contains(referenced, link.Number):
+			lines = append(lines, fmt.Sprintf("Refs #%d", link.Number))
+			referenced = append(referenced, link.Number)
+		}
+	}
+	if len(lines) == 0 {
+		return prBody
+	}
+	if prBody == "" {
+		return strings.Join(lines, "\n")
+	}
+	return strings.Join(lines, "\n") + "\n\n" + prBody
+}
+
+// renderIssueLinks renders links as the lines linkIssues would prepend
+func renderIssueLinks(links []issueLink) string {
+	return linkIssues("", links)
+}
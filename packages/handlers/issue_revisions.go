@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// issueRevision is a run for an issue DevFlow already opened a pull request for. It either
+// adds commits to that pull request or opens a follow-up one on a branch of its own.
+type issueRevision struct {
+	Branch     string
+	UpdatePR   *store.RunPR // open pull request the run commits to
+	FollowUpOf *store.RunPR // merged or closed pull request the run follows up on
+}
+
+// handleIssueRevised runs the agent again for an issue whose requirements changed after
+// DevFlow opened a pull request for it: an edited title or body updates the open pull request,
+// reopening the issue after its pull request was merged or closed opens a follow-up one.
+// Issues DevFlow never opened a pull request for wait for their trigger label as usual.
+func handleIssueRevised(ctx *probot.Context, event *github.IssuesEvent, repoName string, issueNumber int, issueTitle string) error {
+	cfg := config.GetConfig()
+	action := event.GetAction()
+	if (action == "edited" && !cfg.Issues.Revisions.OnEdit) || (action == "reopened" && !cfg.Issues.Revisions.OnReopen) {
+		return nil
+	}
+	if action == "edited" && !requirementsEdited(event) {
+		return nil
+	}
+	if !hasRequiredLabels(event.Issue.Labels) || hasLabel(event.Issue.Labels, cfg.Issues.MultiRepoLabel) {
+		return nil
+	}
+	if reason := issueFilterReason(ctx, repoName, event.Issue, triggerRepoConfig(ctx, repoName).Issues); reason != "" {
+		slog.InfoContext(logging.For(ctx), "Issue excluded by issue filters - skipping", "issueNumber", issueNumber, "reason", reason)
+		return nil
+	}
+
+	pr, err := issuePullRequest(ctx, repoName, issueNumber, issueTitle)
+	if err != nil || pr == nil {
+		return err
+	}
+	previous := &store.RunPR{Repo: repoName, Branch: pr.HeadRef, Number: pr.Number, URL: pr.HTMLURL}
+	var revision *issueRevision
+	switch {
+	case action == "edited" && pr.State == "open":
+		revision = &issueRevision{Branch: pr.HeadRef, UpdatePR: previous}
+	case action == "reopened" && pr.State != "open":
+		branch := fmt.Sprintf("%s%d-followup-%d", cfg.Issues.BranchPrefix, issueNumber, pr.Number)
+		if branchExists(ctx, repoName, branch) {
+			slog.InfoContext(logging.For(ctx), "Follow-up already processed - branch exists", "issueNumber", issueNumber, "branch", branch)
+			return nil
+		}
+		revision = &issueRevision{Branch: branch, FollowUpOf: previous}
+	default:
+		slog.InfoContext(logging.For(ctx), "Nothing to revise for issue", "issueNumber", issueNumber, "action", action, "prState", pr.State)
+		return nil
+	}
+
+	done, ok, err := claimIssueEvent(ctx, event, repoName, issueNumber)
+	if err != nil {
+		return err
+	} else if !ok {
+		slog.InfoContext(logging.For(ctx), "Duplicate delivery of issue event - skipping", "issueNumber", issueNumber, "action", action)
+		return nil
+	}
+	slog.InfoContext(logging.For(ctx), "Issue revised - running the agent again", "issueNumber", issueNumber, "action", action, "prNumber", pr.Number, "branch", revision.Branch)
+	_ = repoActions.AddIssueReaction(ctx, repoName, issueNumber, repoActions.ReactionEyes)
+	err = runIssueWorkflow(ctx, repoName, issueNumber, issueTitle, revision)
+	done(err)
+	return err
+}
+
+// requirementsEdited reports whether an edit changed the issue's title or body, rather than
+// only, say, its milestone
+func requirementsEdited(event *github.IssuesEvent) bool {
+	changes := event.Changes
+	if changes == nil {
+		return false
+	}
+	if changes.Title != nil && changes.Title.From != nil && *changes.Title.From != event.Issue.GetTitle() {
+		return true
+	}
+	return changes.Body != nil && changes.Body.From != nil && strings.TrimSpace(*changes.Body.From) != strings.TrimSpace(event.Issue.GetBody())
+}
+
+// issuePullRequest returns the latest pull request DevFlow opened for an issue, open or not,
+// or nil when there is none. The branch comes from the issue's last run, since the title it
+// was named after may have been edited since.
+func issuePullRequest(ctx *probot.Context, repoName string, issueNumber int, issueTitle string) (*githubapi.PullRequest, error) {
+	cfg := config.GetConfig()
+	branches := []string{fmt.Sprintf("%s%d-%s", cfg.Issues.BranchPrefix, issueNumber, repoActions.SanitizeBranchName(issueTitle))}
+	if runs, err := store.Default(); err == nil {
+		if run, err := runs.GetRun(store.RunID(issueRunKind, repoName, issueNumber)); err == nil {
+			for _, pr := range run.PRs {
+				branches = append([]string{pr.Branch}, branches...)
+			}
+		} else if !errors.Is(err, store.ErrRunNotFound) {
+			slog.WarnContext(logging.For(ctx), "Failed to load the issue's last run", "issueNumber", issueNumber, "error", err)
+		}
+	}
+
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return nil, err
+	}
+	client := repoActions.NewGitHubClient(ctx)
+	for _, branch := range branches {
+		prs, err := client.ListPullRequests(context.Background(), owner, repo, "all", owner+":"+branch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up the pull request of %s: %w", branch, err)
+		}
+		if len(prs) > 0 {
+			return &prs[0], nil
+		}
+	}
+	return nil, nil
+}
+
+// revisionContext tells the agent what the earlier pull request already changed, for a pass
+// that continues it
+func revisionContext(revision *issueRevision, files []string) string {
+	if revision == nil || revision.UpdatePR == nil {
+		return ""
+	}
+	return fmt.Sprintf("The issue was edited after DevFlow opened pull request #%d for it. The working tree already holds "+
+		"that pull request's changes to:\n- %s\n\nKeep what still fits the edited issue, change what no longer does, and add what it now asks for.",
+		revision.UpdatePR.Number, strings.Join(files, "\n- "))
+}
+
+// followUpNote is the pull request note of a follow-up run
+func followUpNote(revision *issueRevision) string {
+	if revision == nil || revision.FollowUpOf == nil {
+		return ""
+	}
+	return fmt.Sprintf("### Follow-up\n\nThe issue was reopened after #%d was closed; this pull request follows up on it.", revision.FollowUpOf.Number)
+}
@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+const issueRunKind = "issue"
+
+// Stages of an issue run that can be resumed with /devflow retry
+const (
+	stageCommit = "commit"
+	stagePR     = "pull_request"
+)
+
+func init() {
+	commandHandlers["retry"] = handleRetryCommand
+}
+
+// lockIssue takes the lock that keeps replicas from working the same issue at once.
+// ok is false when another worker holds it.
+func lockIssue(repoName string, issueNumber int) (lease *store.Lease, ok bool, err error) {
+	locker, err := store.DefaultLocker()
+	if err != nil {
+		return nil, false, err
+	}
+	lease, err = locker.TryLock(fmt.Sprintf("issue:%s#%d", repoName, issueNumber), store.LockTTL())
+	if errors.Is(err, store.ErrLocked) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return lease, true, nil
+}
+
+// newIssueRun checkpoints the agent's output: the changed files' contents and modes (deleted
+// files have none), the commit message and the PR title and body, so the publishing stages
+// can be repeated without the clone. prBodyMaxTokens caps the translation of the PR body; 0
+// uses ai.max_output_tokens. The body links to every issue in links.
+func newIssueRun(repoName string, issueNumber int, issueTitle, lang, repoPath, branchName, commitMessage, issueAuthor string, result *ai.PythonAgentResult, prNotes []string, prBodyMaxTokens int32, links []issueLink) (*store.Run, error) {
+	cp := &store.Checkpoint{
+		Branch:        branchName,
+		CommitMessage: commitMessage,
+		Files:         make(map[string]string, len(result.ChangesMade)),
+		Modes:         map[string]string{},
+		Summary:       result.Summary,
+		ChangedFiles:  result.ChangesMade,
+		PRNotes:       prNotes,
+		IssueAuthor:   issueAuthor,
+		Language:      lang,
+		IssueLinks:    renderIssueLinks(links),
+	}
+	for _, rel := range result.ChangesMade {
+		content, mode, err := repoActions.ReadTreeFile(filepath.Join(repoPath, rel))
+		if os.IsNotExist(err) {
+			// Deleted files have no content; committing a missing file deletes it
+			continue
+		} else if err != nil {
+			return nil, &repoActions.CommitError{Branch: branchName, Err: fmt.Errorf("failed to read %s: %w", rel, err)}
+		}
+		cp.Files[rel] = string(content)
+		if mode != githubapi.ModeFile {
+			cp.Modes[rel] = mode
+		}
+	}
+
+	cp.PRTitle = fmt.Sprintf("[#%d] %s", issueNumber, issueTitle)
+	if result.PRBodyFile != "" {
+		prBodyPath := filepath.Join(repoPath, result.PRBodyFile)
+		slog.Info("Attempting to read AI-generated PR body", "path", prBodyPath)
+		if content, err := os.ReadFile(prBodyPath); err != nil {
+			slog.Warn("Failed to read generated PR body, using fallback", "error", err, "path", prBodyPath)
+			cp.UsePRTemplate = true
+		} else {
+			cp.PRBody = linkIssues(localizeLimited(lang, appendPRNotes(string(content), prNotes), prBodyMaxTokens), links)
+		}
+	} else {
+		slog.Info("No PR body file returned by agent, composing PR body with closing link")
+		baseBody := fmt.Sprintf(
+			"Summary:\n%s\n\nModified files:\n- %s\n\nPlease review the automated changes generated by the AI agent.",
+			result.Summary,
+			strings.Join(result.ChangesMade, "\n- "),
+		)
+		cp.PRBody = linkIssues(localizeLimited(lang, appendPRNotes(baseBody, prNotes), prBodyMaxTokens), links)
+	}
+
+	return &store.Run{
+		ID:          store.RunID(issueRunKind, repoName, issueNumber),
+		Kind:        issueRunKind,
+		Repo:        repoName,
+		IssueNumber: issueNumber,
+		Status:      store.StatusRunning,
+		Checkpoint:  cp,
+	}, nil
+}
+
+// publishIssueRun runs the stages after the agent: branch and commit, then the pull request
+// and its follow-ups. Stages the checkpoint records as done are skipped. The run is saved
+// after every stage; on failure it keeps the failed stage so /devflow retry can resume it.
+// repoPath is the clone the files came from, or empty when resuming from the checkpoint.
+func publishIssueRun(ctx *probot.Context, cfg *config.Config, lease *store.Lease, run *store.Run, issueTitle, repoPath string) error {
+	runs, err := store.Default()
+	if err != nil {
+		return err
+	}
+	cp := run.Checkpoint
+	fail := func(stage string, err error) error {
+		run.Status, run.Stage = store.StatusFailed, stage
+		run.Errors = append(run.Errors, err.Error())
+		if sErr := runs.SaveRun(run); sErr != nil {
+			slog.ErrorContext(logging.For(ctx), "Failed to checkpoint issue run", "run", run.ID, "error", sErr)
+		}
+		return err
+	}
+
+	run.Status, run.Stage = store.StatusRunning, ""
+	if err := runs.SaveRun(run); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to checkpoint issue run; it cannot be resumed", "run", run.ID, "error", err)
+	}
+
+	// Past this point the run has visible side effects; a worker whose lease lapsed stops here
+	if err := lease.Check(); err != nil {
+		return err
+	}
+
+	// An issue that was relabeled or rephrased may already have an equivalent PR open; a
+	// revision of DevFlow's own pull request would find that one
+	if cp.UpdatePR == nil {
+		dup, err := repoActions.FindDuplicatePR(ctx, run.Repo, cp.ChangedFiles, issueTitle+"\n\n"+cp.Summary)
+		if err != nil {
+			slog.WarnContext(logging.For(ctx), "Duplicate pull request check failed, opening a new one", "repo", run.Repo, "error", err)
+		} else if dup != nil {
+			return linkDuplicatePR(ctx, cfg, run, dup)
+		}
+	}
+
+	if !cp.Committed {
+		if err := commitCheckpoint(ctx, run.Repo, cp, repoPath); err != nil {
+			return fail(stageCommit, err)
+		}
+		cp.Committed = true
+		// The files are on the branch now; keep the record small
+		cp.Files = nil
+		if err := runs.SaveRun(run); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to checkpoint issue run", "run", run.ID, "error", err)
+		}
+	}
+
+	if cp.UpdatePR != nil {
+		return finishPRUpdate(ctx, cfg, run)
+	}
+
+	var pr *githubapi.PullRequest
+	if cp.UsePRTemplate {
+		links := cp.IssueLinks
+		if links == "" {
+			// checkpoints from before issue links were recorded
+			links = fmt.Sprintf("Closes #%d", run.IssueNumber)
+		}
+		pr, err = repoActions.CreateIssueResolutionPR(
+			ctx,
+			run.Repo,
+			cp.Branch,
+			run.IssueNumber,
+			issueTitle,
+			links,
+			cp.Summary,
+			appendPRNotes(fmt.Sprintf("Modified files:\n- %s", strings.Join(cp.ChangedFiles, "\n- ")), cp.PRNotes),
+			"Please review the automated changes generated by the AI agent.",
+		)
+	} else {
+		slog.InfoContext(logging.For(ctx), "Creating PR", "length", len(cp.PRBody))
+		pr, err = openPullRequest(ctx, run.Repo, cp.Branch, cp.PRTitle, cp.PRBody)
+	}
+	if err != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to create PR", "error", err)
+		return fail(stagePR, err)
+	}
+
+	_ = repoActions.AddIssueReaction(ctx, run.Repo, run.IssueNumber, repoActions.ReactionRocket)
+	if err := repoActions.SetIssueStatus(ctx, run.Repo, run.IssueNumber, cfg.Issues.StatusLabels.PROpen); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to mark issue PR open", "issueNumber", run.IssueNumber, "error", err)
+	}
+	if err := repoActions.PostIssueComment(ctx, run.Repo, run.IssueNumber, localize(cp.Language, fmt.Sprintf("DevFlow opened %s for this issue.", pr.HTMLURL))); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to post PR link comment", "issueNumber", run.IssueNumber, "error", err)
+	}
+	if channel := triggerRepoConfig(ctx, run.Repo).Notifications.Channel; channel != config.NotifyChannelIssue {
+		notifyChannels(ctx, fmt.Sprintf("DevFlow opened %s for %s#%d: %s", pr.HTMLURL, run.Repo, run.IssueNumber, issueTitle), channel)
+	}
+
+	// Tag likely domain experts for the changed files
+	if err := repoActions.TagReviewers(ctx, run.Repo, pr, cp.Reviewers); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to tag reviewers", "error", err)
+	}
+	requestPreview(ctx, run.Repo, cp.Branch, pr, run.IssueNumber)
+
+	// The clone can still precompute the knowledge base update the merge will need
+	if repoPath != "" {
+		cacheKBDelta(ctx, run, repoPath)
+	}
+
+	run.Status = store.StatusCompleted
+	run.PRs = []store.RunPR{{Repo: run.Repo, Branch: cp.Branch, Number: pr.Number, URL: pr.HTMLURL}}
+	postRunEvent(ctx, runEvent{Event: runEventPROpened, RunID: run.ID, Kind: run.Kind, Repo: run.Repo, IssueNumber: run.IssueNumber, PR: &run.PRs[0]})
+	if err := runs.SaveRun(run); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to save issue run", "run", run.ID, "error", err)
+	}
+
+	slog.InfoContext(logging.For(ctx), "Issue workflow completed successfully",
+		"issueNumber", run.IssueNumber,
+		"branch", cp.Branch,
+		"prNumber", pr.Number,
+		"prURL", pr.HTMLURL,
+		"modifiedFiles", len(cp.ChangedFiles))
+	return nil
+}
+
+// finishPRUpdate completes a run that added its commit to the open pull request of an edited
+// issue, telling the issue and the pull request what changed
+func finishPRUpdate(ctx *probot.Context, cfg *config.Config, run *store.Run) error {
+	cp, pr := run.Checkpoint, run.Checkpoint.UpdatePR
+	if err := repoActions.SetIssueStatus(ctx, run.Repo, run.IssueNumber, cfg.Issues.StatusLabels.PROpen); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to mark issue PR open", "issueNumber", run.IssueNumber, "error", err)
+	}
+	comment := fmt.Sprintf("DevFlow updated %s for the edited issue.", pr.URL)
+	if err := repoActions.PostIssueComment(ctx, run.Repo, run.IssueNumber, localize(cp.Language, comment)); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to post PR update comment", "issueNumber", run.IssueNumber, "error", err)
+	}
+	summary := fmt.Sprintf("#%d was edited, so DevFlow revised this pull request:\n\n%s\n\nFiles the agent touched:\n- %s",
+		run.IssueNumber, cp.Summary, strings.Join(cp.ChangedFiles, "\n- "))
+	if err := repoActions.PostIssueComment(ctx, run.Repo, pr.Number, localize(cp.Language, appendPRNotes(summary, cp.PRNotes))); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to post revision summary", "prNumber", pr.Number, "error", err)
+	}
+
+	runs, err := store.Default()
+	if err != nil {
+		return err
+	}
+	run.Status = store.StatusCompleted
+	run.PRs = []store.RunPR{*pr}
+	if err := runs.SaveRun(run); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to save issue run", "run", run.ID, "error", err)
+	}
+	slog.InfoContext(logging.For(ctx), "Issue revision pushed to its pull request", "issueNumber", run.IssueNumber, "prNumber", pr.Number, "branch", cp.Branch)
+	return nil
+}
+
+// linkDuplicatePR completes a run whose changes an open pull request already makes: the issue
+// gets a link to that PR instead of a second one
+func linkDuplicatePR(ctx *probot.Context, cfg *config.Config, run *store.Run, dup *repoActions.DuplicatePR) error {
+	slog.InfoContext(logging.For(ctx), "Equivalent pull request already open, not opening another",
+		"repo", run.Repo,
+		"issueNumber", run.IssueNumber,
+		"prNumber", dup.PR.Number,
+		"pathOverlap", dup.PathOverlap,
+		"similarity", dup.Similarity)
+
+	comment := fmt.Sprintf("%s already makes these changes (same files, equivalent summary), so DevFlow did not open another pull request.", dup.PR.HTMLURL)
+	if err := repoActions.PostIssueComment(ctx, run.Repo, run.IssueNumber, localize(run.Checkpoint.Language, comment)); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to link duplicate pull request", "issueNumber", run.IssueNumber, "error", err)
+	}
+	if err := repoActions.SetIssueStatus(ctx, run.Repo, run.IssueNumber, cfg.Issues.StatusLabels.PROpen); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to mark issue PR open", "issueNumber", run.IssueNumber, "error", err)
+	}
+
+	runs, err := store.Default()
+	if err != nil {
+		return err
+	}
+	run.Status = store.StatusCompleted
+	run.PRs = []store.RunPR{{Repo: run.Repo, Branch: dup.PR.HeadRef, Number: dup.PR.Number, URL: dup.PR.HTMLURL}}
+	if err := runs.SaveRun(run); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to save issue run", "run", run.ID, "error", err)
+	}
+	return nil
+}
+
+// commitCheckpoint pushes the checkpointed files to the run's branch. Without a clone the
+// repository is checked out again and the files written over it, so the commit is checked
+// against the repository's current config, license headers and .gitattributes.
+func commitCheckpoint(ctx *probot.Context, repoName string, cp *store.Checkpoint, repoPath string) error {
+	if repoPath == "" {
+		dir, _, err := repoActions.CloneRepository(logging.For(ctx), repoName)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := repoActions.CleanupRepo(dir); err != nil {
+				slog.WarnContext(logging.For(ctx), "Failed to cleanup repository", "repoPath", dir, "error", err)
+			}
+		}()
+		for _, rel := range cp.ChangedFiles {
+			// A changed file without checkpointed content was deleted
+			path := filepath.Join(dir, rel)
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return &repoActions.CommitError{Branch: cp.Branch, Err: err}
+			}
+			if content, ok := cp.Files[rel]; ok {
+				if err := writeCheckpointFile(path, content, cp.Modes[rel]); err != nil {
+					return &repoActions.CommitError{Branch: cp.Branch, Err: err}
+				}
+			}
+		}
+		repoPath = dir
+	}
+
+	// A retried commit finds the branch created by the failed attempt
+	if !repoActions.BranchExists(ctx, repoName, cp.Branch) {
+		if err := repoActions.CreateBranch(ctx, repoName, cp.Branch); err != nil {
+			slog.ErrorContext(logging.For(ctx), "Failed to create branch", "error", err)
+			return &repoActions.CommitError{Branch: cp.Branch, Err: err}
+		}
+	}
+
+	absolutePaths := make([]string, 0, len(cp.ChangedFiles))
+	for _, rel := range cp.ChangedFiles {
+		absolutePaths = append(absolutePaths, filepath.Join(repoPath, rel))
+	}
+	if err := repoActions.CommitMultipleFiles(ctx, repoName, cp.Branch, cp.CommitMessage, absolutePaths, false, repoPath); err != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to commit files", "error", err)
+		var violation *repoActions.PolicyViolationError
+		var headerErr *repoActions.LicenseHeaderError
+		if errors.As(err, &violation) || errors.As(err, &headerErr) {
+			return err
+		}
+		return &repoActions.CommitError{Branch: cp.Branch, Err: err}
+	}
+	return nil
+}
+
+// writeCheckpointFile recreates a checkpointed file with its tree mode, so a retried commit
+// keeps executable bits and symlinks
+func writeCheckpointFile(path, content, mode string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	switch mode {
+	case githubapi.ModeSymlink:
+		return os.Symlink(filepath.FromSlash(content), path)
+	case githubapi.ModeExecutable:
+		return os.WriteFile(path, []byte(content), 0755)
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// retryAssociations may resume a failed run, which pushes a branch and opens a pull request
+var retryAssociations = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+
+// handleRetryCommand resumes a failed issue run from the stage it stopped at, reusing the
+// checkpointed agent output
+func handleRetryCommand(ctx *probot.Context, event *github.IssueCommentEvent, cmd slashCommand) error {
+	cfg := config.GetConfig()
+	repoName := event.GetRepo().GetFullName()
+	issueNumber := event.GetIssue().GetNumber()
+	if !slices.Contains(retryAssociations, event.GetComment().GetAuthorAssociation()) {
+		return repoActions.PostIssueComment(ctx, repoName, issueNumber,
+			fmt.Sprintf("@%s only maintainers can resume a failed run.", event.GetComment().GetUser().GetLogin()))
+	}
+
+	runs, err := store.Default()
+	if err != nil {
+		return err
+	}
+	runID := store.RunID(issueRunKind, repoName, issueNumber)
+	logging.Bind(ctx, "run_id", runID)
+	run, err := runs.GetRun(runID)
+	if errors.Is(err, store.ErrRunNotFound) || (err == nil && (run.Status != store.StatusFailed || run.Checkpoint == nil)) {
+		return repoActions.PostIssueComment(ctx, repoName, issueNumber,
+			"There is no failed run to resume for this issue. Re-apply the trigger label to start over.")
+	} else if err != nil {
+		return err
+	}
+
+	lease, ok, err := lockIssue(repoName, issueNumber)
+	if err != nil {
+		return err
+	} else if !ok {
+		return repoActions.PostIssueComment(ctx, repoName, issueNumber, "DevFlow is already working on this issue.")
+	}
+	defer lease.Release()
+	return resumeIssueRun(ctx, cfg, lease, run, event.GetIssue().GetTitle())
+}
+
+// resumeIssueRun repeats the publishing stages of a failed run from its checkpoint, keeping
+// the issue's lifecycle label and failure comment up to date. The caller holds the lease.
+func resumeIssueRun(ctx *probot.Context, cfg *config.Config, lease *store.Lease, run *store.Run, issueTitle string) error {
+	repoName, issueNumber := run.Repo, run.IssueNumber
+	slog.InfoContext(logging.For(ctx), "Resuming issue run", "run", run.ID, "stage", run.Stage)
+	if err := repoActions.SetIssueStatus(ctx, repoName, issueNumber, cfg.Issues.StatusLabels.InProgress); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to mark issue in progress", "issueNumber", issueNumber, "error", err)
+	}
+	err := publishIssueRun(ctx, cfg, lease, run, issueTitle, "")
+	if err != nil {
+		if sErr := repoActions.SetIssueStatus(ctx, repoName, issueNumber, cfg.Issues.StatusLabels.Failed); sErr != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to mark issue failed", "issueNumber", issueNumber, "error", sErr)
+		}
+		comment := failureComment(err) + deadLetterRun(ctx, issueRunKind, repoName, issueNumber, issueTitle, []string{err.Error()})
+		if cErr := repoActions.PostIssueComment(ctx, repoName, issueNumber, localize(run.Checkpoint.Language, comment)); cErr != nil {
+			slog.ErrorContext(logging.For(ctx), "Failed to post failure comment", "issueNumber", issueNumber, "error", cErr)
+		}
+	} else {
+		clearDeadLetter(ctx, repoName, issueNumber)
+	}
+	return err
+}
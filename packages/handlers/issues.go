@@ -4,7 +4,10 @@ import (
 	"context"
 	"devflow-agent/packages/ai"
 	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
 	repoActions "devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -15,17 +18,52 @@ import (
 	"github.com/swinton/go-probot/probot"
 )
 
-// ensureClosingLink prepends "Closes #<n>" unless a closing keyword is already present.
-func ensureClosingLink(prBody string, issueNumber int) string {
-	linkLine := fmt.Sprintf("Closes #%d", issueNumber)
-	low := strings.ToLower(prBody)
-	if strings.Contains(low, "closes #") || strings.Contains(low, "fixes #") || strings.Contains(low, "resolves #") {
-		return prBody
+// appendPRNotes appends additional markdown sections (e.g. policy notices) to a PR body.
+func appendPRNotes(body string, notes []string) string {
+	for _, note := range notes {
+		body += "\n\n" + note
 	}
-	if prBody == "" {
-		return linkLine
+	return body
+}
+
+// postPartialResults salvages the work done before a stage timed out by posting it on the issue
+func postPartialResults(ctx *probot.Context, repoName string, issueNumber int, stage string, issueCtx ai.IssueContext, result *ai.PythonAgentResult) {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("DevFlow ran out of time during the **%s** stage. Here is what it found so far.\n", stage))
+	if result != nil {
+		if result.Summary != "" {
+			b.WriteString("\n### Proposed changes\n\n" + result.Summary + "\n")
+		}
+		if len(result.ChangesMade) > 0 {
+			b.WriteString("\n### Files the agent modified\n\n- " + strings.Join(result.ChangesMade, "\n- ") + "\n")
+		}
+	}
+	if len(issueCtx.CandidateFiles) > 0 {
+		b.WriteString("\n### Candidate files\n\n- " + strings.Join(issueCtx.CandidateFiles, "\n- ") + "\n")
+	}
+	if issueCtx.OwnershipContext != "" {
+		b.WriteString("\n" + issueCtx.OwnershipContext + "\n")
+	}
+	if err := repoActions.PostIssueComment(ctx, repoName, issueNumber, b.String()); err != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to post partial results", "issueNumber", issueNumber, "error", err)
+	}
+}
+
+// pathsOf returns the paths of the given policy violations.
+func pathsOf(violations []repoActions.PathViolation) []string {
+	paths := make([]string, len(violations))
+	for i, v := range violations {
+		paths[i] = v.Path
+	}
+	return paths
+}
+
+func generatedPaths(generated []repoActions.GeneratedFile) []string {
+	paths := make([]string, len(generated))
+	for i, g := range generated {
+		paths[i] = g.Path
 	}
-	return linkLine + "\n\n" + prBody
+	return paths
 }
 
 func HandleIssues(ctx *probot.Context) error {
@@ -38,19 +76,28 @@ func HandleIssues(ctx *probot.Context) error {
 	repoName := event.Repo.GetFullName()
 	action := event.GetAction()
 
-	slog.Info(" Issue Action:", "action", action)
-	slog.Info(" Issue", "issueNumber", issueNumber, "issueTitle", issueTitle)
-	slog.Info(" Repository:", "repoName", repoName)
+	slog.InfoContext(logging.For(ctx), " Issue Action:", "action", action)
+	slog.InfoContext(logging.For(ctx), " Issue", "issueNumber", issueNumber, "issueTitle", issueTitle)
+	slog.InfoContext(logging.For(ctx), " Repository:", "repoName", repoName)
 
 	// Process different actions using switch case
 	switch action {
 	case "opened":
-		slog.Info("Issue opened - will process when labeled", "issueNumber", issueNumber)
+		slog.InfoContext(logging.For(ctx), "Issue opened - will process when labeled", "issueNumber", issueNumber)
 		return nil
 	case "labeled":
 		return handleIssueLabeled(ctx, event, repoName, issueNumber, issueTitle)
+	case "edited":
+		if isSetupIssue(event.Issue) {
+			return handleSetupIssueEdited(ctx, event, repoName)
+		}
+		return handleIssueRevised(ctx, event, repoName, issueNumber, issueTitle)
+	case "reopened":
+		return handleIssueRevised(ctx, event, repoName, issueNumber, issueTitle)
+	case "closed":
+		return handleIssueClosed(ctx, event, repoName, issueNumber)
 	default:
-		slog.Info("Skipping action", "action", action)
+		slog.InfoContext(logging.For(ctx), "Skipping action", "action", action)
 		return nil
 	}
 }
@@ -61,55 +108,261 @@ func handleIssueOpened(ctx *probot.Context, event *github.IssuesEvent, repoName
 	if hasRequiredLabels(event.Issue.Labels) {
 		branchName := fmt.Sprintf("%s%d-%s", cfg.Issues.BranchPrefix, issueNumber, repoActions.SanitizeBranchName(issueTitle))
 		if branchExists(ctx, repoName, branchName) {
-			slog.Info("Issue already processed - branch exists", "issueNumber", issueNumber, "branch", branchName)
+			slog.InfoContext(logging.For(ctx), "Issue already processed - branch exists", "issueNumber", issueNumber, "branch", branchName)
+			return nil
+		}
+
+		done, ok, err := claimIssueEvent(ctx, event, repoName, issueNumber)
+		if err != nil {
+			return err
+		} else if !ok {
+			slog.InfoContext(logging.For(ctx), "Duplicate delivery of issue event - skipping", "issueNumber", issueNumber, "action", event.GetAction())
 			return nil
 		}
 
-		slog.Info("Issue opened with required labels - proceeding with workflow", "issueNumber", issueNumber)
-		return processIssue(ctx, repoName, issueNumber, issueTitle)
+		slog.InfoContext(logging.For(ctx), "Issue opened with required labels - proceeding with workflow", "issueNumber", issueNumber)
+		err = runIssueWorkflow(ctx, repoName, issueNumber, issueTitle, nil)
+		done(err)
+		return err
 	}
 
-	slog.Info(" Issue opened without required labels - waiting for labels", "issueNumber", issueNumber)
+	slog.InfoContext(logging.For(ctx), " Issue opened without required labels - waiting for labels", "issueNumber", issueNumber)
 	return nil
 }
 
 func handleIssueLabeled(ctx *probot.Context, event *github.IssuesEvent, repoName string, issueNumber int, issueTitle string) error {
 	cfg := config.GetConfig()
+	// Our own status label changes must not re-trigger the workflow
+	if repoActions.IsStatusLabel(event.GetLabel().GetName()) {
+		slog.InfoContext(logging.For(ctx), "Ignoring status label event", "issueNumber", issueNumber, "label", event.GetLabel().GetName())
+		return nil
+	}
+
 	// Check if the newly labeled issue now has required labels
 	if !hasRequiredLabels(event.Issue.Labels) {
-		slog.Info("Issue labeled but still missing required labels", "issueNumber", issueNumber)
+		slog.InfoContext(logging.For(ctx), "Issue labeled but still missing required labels", "issueNumber", issueNumber)
 		return nil
 	}
 
-	// Check if we've already processed this issue (deduplication)
+	// Repository filters and schedule are checked before anything is claimed or cloned
+	repoCfg := triggerRepoConfig(ctx, repoName)
+	if reason := issueFilterReason(ctx, repoName, event.Issue, repoCfg.Issues); reason != "" {
+		slog.InfoContext(logging.For(ctx), "Issue excluded by issue filters - skipping", "issueNumber", issueNumber, "reason", reason)
+		return nil
+	}
+	if held, err := holdForSchedule(ctx, event, repoName, repoCfg.Schedule); err != nil || held {
+		return err
+	}
+
+	// Redeliveries and other replicas receiving the same event stop here
+	done, ok, err := claimIssueEvent(ctx, event, repoName, issueNumber)
+	if err != nil {
+		return err
+	} else if !ok {
+		slog.InfoContext(logging.For(ctx), "Duplicate delivery of issue event - skipping", "issueNumber", issueNumber, "action", event.GetAction())
+		return nil
+	}
+
+	// Cross-repo issues are deduplicated through their run in the store instead of a branch
+	if hasLabel(event.Issue.Labels, cfg.Issues.MultiRepoLabel) {
+		_ = repoActions.AddIssueReaction(ctx, repoName, issueNumber, repoActions.ReactionEyes)
+		countScheduledRun(ctx, repoName, repoCfg.Schedule)
+		err = runMultiRepoWorkflow(ctx, event, repoName, issueNumber, issueTitle)
+		done(err)
+		return err
+	}
+
+	// A different event for an issue that was already handled (e.g. relabeling)
 	branchName := fmt.Sprintf("%s%d-%s", cfg.Issues.BranchPrefix, issueNumber, repoActions.SanitizeBranchName(issueTitle))
 	if branchExists(ctx, repoName, branchName) {
-		slog.Info(" Issue already processed - branch exists", "issueNumber", issueNumber, "branch", branchName)
+		slog.InfoContext(logging.For(ctx), " Issue already processed - branch exists", "issueNumber", issueNumber, "branch", branchName)
 		return nil
 	}
 
-	slog.Info("Issue labeled with required labels - proceeding with workflow", "issueNumber", issueNumber)
-	return processIssue(ctx, repoName, issueNumber, issueTitle)
+	slog.InfoContext(logging.For(ctx), "Issue labeled with required labels - proceeding with workflow", "issueNumber", issueNumber)
+	// Instant acknowledgment, ahead of any status comment
+	_ = repoActions.AddIssueReaction(ctx, repoName, issueNumber, repoActions.ReactionEyes)
+	countScheduledRun(ctx, repoName, repoCfg.Schedule)
+	err = runIssueWorkflow(ctx, repoName, issueNumber, issueTitle, nil)
+	done(err)
+	return err
 }
 
-func processIssue(ctx *probot.Context, repoName string, issueNumber int, issueTitle string) error {
+// runIssueWorkflow processes an issue while keeping its lifecycle label and failure comment up
+// to date. revision is set for a run revising a pull request DevFlow already opened for it.
+func runIssueWorkflow(ctx *probot.Context, repoName string, issueNumber int, issueTitle string, revision *issueRevision) error {
 	cfg := config.GetConfig()
+	logging.Bind(ctx, "run_id", store.RunID(issueRunKind, repoName, issueNumber))
+
+	// Replicas can receive the same delivery (or a retry of it); only one of them works the issue
+	issue := ctx.Payload.(*github.IssuesEvent).Issue
+	lang := issueLanguage(ctx, repoName, issue)
+
+	lease, ok, err := lockIssue(repoName, issueNumber)
+	if err != nil {
+		return err
+	} else if !ok {
+		slog.InfoContext(logging.For(ctx), "Issue already being processed by another worker", "issueNumber", issueNumber)
+		return nil
+	}
+	defer lease.Release()
+
+	// Missing permissions or a ruleset would only stop the run at its push; say so up front
+	if cfg.Issues.Preflight {
+		branchName := fmt.Sprintf("%s%d-%s", cfg.Issues.BranchPrefix, issueNumber, repoActions.SanitizeBranchName(issueTitle))
+		if revision != nil {
+			branchName = revision.Branch
+		}
+		installationID := ctx.Payload.(*github.IssuesEvent).GetInstallation().GetID()
+		if problems := repoActions.PreflightProblems(ctx, repoName, branchName, installationID); len(problems) > 0 {
+			slog.WarnContext(logging.For(ctx), "Pre-flight check failed, not starting the run", "issueNumber", issueNumber, "problems", problems)
+			if err := repoActions.SetIssueStatus(ctx, repoName, issueNumber, cfg.Issues.StatusLabels.Failed); err != nil {
+				slog.WarnContext(logging.For(ctx), "Failed to mark issue failed", "issueNumber", issueNumber, "error", err)
+			}
+			return repoActions.PostIssueComment(ctx, repoName, issueNumber, localize(lang, repoActions.PreflightComment(problems)))
+		}
+	}
+
+	// Other issues of the repository may be ahead of this one, unless they change other files
+	files := repoActions.PredictIssueFiles(repoName, issue.GetTitle()+"\n"+issue.GetBody())
+	slot, err := acquireRunSlot(ctx, lang, repoName, issue, files)
+	if errors.Is(err, errRunCancelled) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() { slot.Release() }()
+	ev := runEvent{Event: runEventStarted, RunID: store.RunID(issueRunKind, repoName, issueNumber), Kind: issueRunKind, Repo: repoName, IssueNumber: issueNumber}
+	postRunEvent(ctx, ev)
+
+	if err := repoActions.SetIssueStatus(ctx, repoName, issueNumber, cfg.Issues.StatusLabels.InProgress); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to mark issue in progress", "issueNumber", issueNumber, "error", err)
+	}
+
+	attemptErrs, err := retryTransient(ctx, func() error {
+		return processIssue(ctx, cfg, lease, slot, lang, repoName, issueNumber, issueTitle, revision)
+	})
+	if errors.Is(err, errRunConflict) {
+		// The prediction missed: redo the run in turn, without a file set to run beside others
+		slog.InfoContext(logging.For(ctx), "Parallel run changed files of another run, redoing it in turn", "issueNumber", issueNumber, "error", err)
+		slot.Release()
+		// slot keeps the released slot until the new one is held, so the deferred Release has one
+		var turn *runSlot
+		turn, err = acquireRunSlot(ctx, lang, repoName, issue, nil)
+		if errors.Is(err, errRunCancelled) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		slot = turn
+		attemptErrs, err = retryTransient(ctx, func() error {
+			return processIssue(ctx, cfg, lease, slot, lang, repoName, issueNumber, issueTitle, revision)
+		})
+	}
+	deltas := map[string]int64{store.UsageRuns: 1}
+	if err != nil {
+		deltas[store.UsageRunsFailed] = 1
+	}
+	recordUsage(repoName, deltas)
+	for _, v := range ai.AssignPromptVariants(cfg, repoName, issueNumber) {
+		recordVariantUsage(v.Experiment, v.Variant, deltas)
+	}
+	if err != nil {
+		ev.Event, ev.Error = runEventFailed, err.Error()
+		postRunEvent(ctx, ev)
+		if sErr := repoActions.SetIssueStatus(ctx, repoName, issueNumber, cfg.Issues.StatusLabels.Failed); sErr != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to mark issue failed", "issueNumber", issueNumber, "error", sErr)
+		}
+		comment := failureComment(err) + deadLetterRun(ctx, issueRunKind, repoName, issueNumber, issueTitle, attemptErrs)
+		if cErr := repoActions.PostIssueComment(ctx, repoName, issueNumber, localize(lang, comment)); cErr != nil {
+			slog.ErrorContext(logging.For(ctx), "Failed to post failure comment", "issueNumber", issueNumber, "error", cErr)
+		}
+	} else {
+		clearDeadLetter(ctx, repoName, issueNumber)
+	}
+	return err
+}
+
+// issueCodeFilesFallback is how many summary-matched files the code document covers when an
+// issue has no candidate files
+const issueCodeFilesFallback = 6
+
+// gatherIssueContext collects the context for an issue from a checkout and its knowledge
+// base: candidate files from pasted stack traces, file summaries, infrastructure and API
+// documents, ownership and code. Linked issues need the GitHub API and are left to the caller.
+func gatherIssueContext(cfg *config.Config, repoName, repoPath string, issue *github.Issue, issueText string) ai.IssueContext {
+	issueCtx := issueOnlyContext(cfg, repoName, issue)
+	summaries, err := repoActions.LoadFileSummaries(cfg.GetDevflowPath(repoPath, cfg.Files.MetadataFile))
+	if err != nil {
+		slog.Warn("File summaries unavailable", "error", err)
+	} else {
+		issueCtx.FileSummaries = repoActions.RenderFileSummaries(summaries,
+			issueText, cfg.AI.SummaryContextTokens)
+	}
+	if cfg.AI.CandidateFiles > 0 {
+		// Stack traces and paths are matched in the original body too, in case translation mangled them
+		rankText := issueText
+		if !strings.Contains(issueText, issue.GetBody()) {
+			rankText += "\n" + issue.GetBody()
+		}
+		issueCtx.Candidates = repoActions.RankFileCandidates(repoPath, rankText, summaries, cfg.AI.CandidateFiles)
+		for _, c := range issueCtx.Candidates {
+			issueCtx.CandidateFiles = append(issueCtx.CandidateFiles, c.File)
+		}
+		slog.Info("Ranked candidate files", "issueNumber", issue.GetNumber(), "candidates", issueCtx.CandidateFiles)
+	} else {
+		issueCtx.CandidateFiles = repoActions.StackTraceCandidateFiles(repoPath, issue.GetBody())
+	}
+	issueCtx.InfraContext = repoActions.LoadInfrastructureContext(cfg.GetDevflowPath(repoPath, cfg.Files.InfrastructureFile),
+		issueText, cfg.CodeContext.MaxTokens)
+	issueCtx.APIContext = repoActions.LoadAPISurfaceContext(cfg.GetDevflowPath(repoPath, cfg.Files.APISurfaceFile),
+		issueText, cfg.CodeContext.MaxTokens)
+	issueCtx.ImpactContext = repoActions.RenderImpactContext(cfg.GetDevflowPath(repoPath, cfg.Files.CallGraphFile),
+		issueCtx.CandidateFiles, cfg.CodeContext.MaxTokens)
+	issueCtx.OwnershipContext = repoActions.RenderOwnershipContext(
+		repoActions.CollectFileOwnership(repoPath, issueCtx.CandidateFiles))
+	// Without candidates the code document covers the files whose summaries match the issue best
+	codeFiles := issueCtx.CandidateFiles
+	if len(codeFiles) == 0 {
+		codeFiles = repoActions.RelevantFiles(summaries, issueText, issueCodeFilesFallback)
+	}
+	if len(codeFiles) > 0 {
+		codeFilesPath := cfg.GetDevflowPath(repoPath, cfg.Files.CodeFilesFile)
+		if doc, err := repoActions.CreateCodeFilesDocument(repoPath, codeFiles, issueText, codeFilesPath); err != nil {
+			slog.Warn("Failed to build code files document", "error", err)
+		} else {
+			issueCtx.CodeContext = doc
+		}
+	}
+	return issueCtx
+}
+
+// processIssue runs the workflow with cfg, the configuration taken when the run started;
+// helpers that call config.GetConfig() themselves see a reload made mid-run. lease is the
+// issue lock held by the caller; lang is the language PR text and comments are written in; revision, if set, names
+// the branch and pull request the run revises.
+func processIssue(ctx *probot.Context, cfg *config.Config, lease *store.Lease, slot *runSlot, lang, repoName string, issueNumber int, issueTitle string, revision *issueRevision) error {
 	event := ctx.Payload.(*github.IssuesEvent)
 	branchName := fmt.Sprintf("%s%d-%s", cfg.Issues.BranchPrefix, issueNumber, repoActions.SanitizeBranchName(issueTitle))
+	if revision != nil {
+		branchName = revision.Branch
+	}
 
-	slog.Info("Starting Python Strands agent workflow", "issueNumber", issueNumber, "branch", branchName)
+	slog.InfoContext(logging.For(ctx), "Starting Python Strands agent workflow", "issueNumber", issueNumber, "branch", branchName)
+
+	runCtx := logging.For(ctx)
 
 	// Clone repository
-	repoPath, _, err := repoActions.CloneRepository(repoName)
+	repoPath, _, err := repoActions.CloneRepository(runCtx, repoName)
 	if err != nil {
-		slog.Error("Failed to clone repository", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to clone repository", "error", err)
 		return err
 	}
 
 	// --- Ensure .devflow reflects latest origin/main BEFORE invoking Python agent ---
 	headSHA, err := repoActions.GetOriginMainSHA(repoPath)
 	if err != nil {
-		slog.Error("Failed to resolve origin/main", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to resolve origin/main", "error", err)
 		return err
 	}
 	devflowCommitPath := filepath.Join(repoPath, ".devflow", "devflow-commit.txt")
@@ -117,171 +370,278 @@ func processIssue(ctx *probot.Context, repoName string, issueNumber int, issueTi
 	if b, err := os.ReadFile(devflowCommitPath); err == nil {
 		devflowSHA = strings.TrimSpace(string(b))
 	}
-	if devflowSHA != headSHA {
-		slog.Info("Devflow stale; syncing", "devflow", devflowSHA, "head", headSHA)
+	if schema, err := repoActions.KnowledgeBaseSchema(repoPath); err == nil && schema > repoActions.KnowledgeBaseSchemaVersion {
+		return &repoActions.KBSchemaError{Found: schema, Supported: repoActions.KnowledgeBaseSchemaVersion}
+	}
+	if devflowSHA != headSHA || repoActions.KnowledgeBaseOutdated(repoPath) {
+		slog.InfoContext(logging.For(ctx), "Devflow stale; syncing", "devflow", devflowSHA, "head", headSHA)
 		if err := repoActions.RunIncrementalDevflowSync(ctx, repoName, repoPath, headSHA); err != nil {
-			slog.Error("Devflow incremental sync failed", "error", err)
+			slog.ErrorContext(logging.For(ctx), "Devflow incremental sync failed", "error", err)
 			return err
 		}
 		// refresh HEAD just in case
 		if _, err := repoActions.GetOriginMainSHA(repoPath); err != nil {
-			slog.Warn("Post-sync fetch failed", "error", err)
+			slog.WarnContext(logging.For(ctx), "Post-sync fetch failed", "error", err)
 		}
 	}
 
 	// Check if knowledge base exists
 	repoStructureFile := cfg.GetDevflowPath(repoPath, cfg.Files.StructureFile)
 	if _, err := os.Stat(repoStructureFile); os.IsNotExist(err) {
-		slog.Error("Devflow knowledge base not initialized for repo", "repo", repoName)
-
-		// Post a helpful comment on the issue instead of trying to initialize here
-		issue := event.Issue
-		owner := event.GetRepo().GetOwner().GetLogin()
-		name := event.GetRepo().GetName()
+		slog.ErrorContext(logging.For(ctx), "Devflow knowledge base not initialized for repo", "repo", repoName)
 
-		commentBody := `DevFlow isn't fully set up for this repository yet.
-
-	Please merge the "Initialize Devflow Knowledge Base" PR (branch "devflow-init") that DevFlow created for this repo, and then re-apply the label to this issue.`
-
-		_, _, cErr := ctx.GitHub.Issues.CreateComment(
-			context.Background(),
-			owner,
-			name,
-			int(issue.GetNumber()),
-			&github.IssueComment{Body: &commentBody},
-		)
-		if cErr != nil {
-			slog.Error("Failed to post missing-knowledge-base comment", "error", cErr)
-		}
+		// The failure comment explains how to finish setup
+		return &repoActions.KBMissingError{RepoName: repoName}
+	}
 
-		return fmt.Errorf("devflow knowledge base not initialized for repo %s", repoName)
+	// Documents edited or corrupted since the last sync are regenerated before the agent reads them
+	if regenerated, err := repoActions.VerifyKnowledgeBase(runCtx, repoPath, repoActions.CloneURL(repoName), repoName); err != nil {
+		slog.ErrorContext(logging.For(ctx), "Knowledge base failed verification", "error", err)
+		return err
+	} else if len(regenerated) > 0 {
+		slog.WarnContext(logging.For(ctx), "Regenerated drifted knowledge base documents", "files", regenerated)
 	}
 
-	// Call Python Strands agent
-	result, err := ai.CallPythonStrandsAgent(repoPath, event.Issue)
+	repoCfg, err := config.LoadRepoConfig(repoPath)
 	if err != nil {
-		slog.Error("Python agent failed", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to load repository config", "error", err)
 		return err
 	}
-
-	// Use the results
-	for _, file := range result.ChangesMade {
-		fmt.Printf("Changed: %s\n", file)
+	// The repository's pipeline decides which stages run; a broken one fails the run visibly
+	pipeline, err := config.LoadPipeline(repoPath)
+	if err != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to load repository pipeline", "error", err)
+		return err
+	}
+	// The repository's generation overrides must suit every model that may serve the run
+	generation, err := ai.ResolveGenerationSettings(cfg, repoCfg.AI)
+	if err != nil {
+		return err
 	}
 
-	// Create branch and commit changes
-	if len(result.ChangesMade) > 0 {
-		if err := repoActions.CreateBranch(ctx, repoName, branchName); err != nil {
-			slog.Error("Failed to create branch", "error", err)
-			return err
+	// Non-English issues reach the agent with an English translation; context selection
+	// matches the translated text against the (English) knowledge base too
+	agentIssue := translateIssueForModel(runCtx, cfg, event.Issue)
+	issueText := agentIssue.GetTitle() + "\n" + agentIssue.GetBody()
+
+	if stage := pipeline.Stage(config.StageTriage); stage != nil && !triageIssue(ctx, lang, repoName, event.Issue, stage) {
+		if err := repoActions.SetIssueStatus(ctx, repoName, issueNumber, ""); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to clear issue status", "issueNumber", issueNumber, "error", err)
 		}
+		cleanupIssueClone(ctx, cfg, repoPath)
+		return nil
+	}
 
-		commitMessage := fmt.Sprintf("Resolve issue #%d: %s\n\n%s", issueNumber, issueTitle, result.Summary)
+	// Gather context from issues/PRs referenced in the issue body and, unless the pipeline
+	// skips analysis, the knowledge base
+	issueCtx := issueOnlyContext(cfg, repoName, event.Issue)
+	if pipeline.Has(config.StageAnalyze) {
+		issueCtx = gatherIssueContext(cfg, repoName, repoPath, event.Issue, issueText)
+	}
+	issueCtx.LinkedContext = repoActions.BuildLinkedIssueContext(ctx, repoName, event.Issue)
+	issueCtx.Generation = &generation
 
-		// Convert relative paths to absolute for commit
-		absolutePaths := make([]string, len(result.ChangesMade))
-		for i, relPath := range result.ChangesMade {
-			absolutePaths[i] = filepath.Join(repoPath, relPath)
+	// A pass over an open pull request starts from the changes it already makes
+	if revision != nil && revision.UpdatePR != nil {
+		files, err := repoActions.CheckoutBranchChanges(repoPath, revision.UpdatePR.Branch)
+		if err != nil {
+			return fmt.Errorf("failed to check out pull request #%d: %w", revision.UpdatePR.Number, err)
 		}
+		issueCtx.LinkedContext = strings.TrimSpace(revisionContext(revision, files) + "\n\n" + issueCtx.LinkedContext)
+	}
+	docsMode := issueCtx.Mode == "docs"
 
-		if err := repoActions.CommitMultipleFiles(ctx, repoName, branchName, commitMessage, absolutePaths, false, repoPath); err != nil {
-			slog.Error("Failed to commit files", "error", err)
-			return err
+	// Resolve the issue with the configured agent engine
+	result, err := ai.ResolveIssue(runCtx, repoPath, agentIssue, issueCtx)
+	if err != nil {
+		slog.ErrorContext(logging.For(ctx), "Agent failed", "engine", cfg.Agent.Engine, "error", err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			postPartialResults(ctx, repoName, issueNumber, "agent", issueCtx, nil)
 		}
+		return err
+	}
 
-		// Create PR with AI-generated body if available
-		var pr *github.PullRequest
-		if result.PRBodyFile != "" {
-			// Read the generated PR body
-			prBodyPath := filepath.Join(repoPath, result.PRBodyFile)
-			slog.Info("Attempting to read AI-generated PR body", "path", prBodyPath)
-
-			prBodyContent, err := os.ReadFile(prBodyPath)
-			if err != nil {
-				slog.Warn("Failed to read generated PR body, using fallback", "error", err, "path", prBodyPath)
-				// Fallback to default PR creation
-				pr, err = repoActions.CreateIssueResolutionPR(
-					ctx,
-					repoName,
-					branchName,
-					issueNumber,
-					issueTitle,
-					result.Summary,
-					fmt.Sprintf("Modified files:\n- %s", strings.Join(result.ChangesMade, "\n- ")),
-					"Please review the automated changes generated by the AI agent.",
-				)
-				if err != nil {
-					slog.Error("Failed to create PR with fallback", "error", err)
-					return err
+	// Drop changes the repository's path policy forbids before committing anything
+	allowed, violations := repoActions.FilterByPathPolicy(repoCfg.Paths, result.ChangesMade)
+	var prNotes []string
+	if note := followUpNote(revision); note != "" {
+		prNotes = append(prNotes, note)
+	}
+	if len(violations) > 0 {
+		slog.WarnContext(logging.For(ctx), "Agent modified files forbidden by path policy", "violations", len(violations))
+		repoActions.RevertPaths(repoPath, pathsOf(violations))
+		note := "The following changes were discarded because the repository's path policy does not allow DevFlow to modify them:\n\n" +
+			repoActions.FormatPathViolations(violations)
+		if len(allowed) == 0 {
+			if cErr := repoActions.PostIssueComment(ctx, repoName, issueNumber, note+"\nNo other changes were produced, so no pull request was opened."); cErr != nil {
+				slog.ErrorContext(logging.For(ctx), "Failed to post path policy comment", "error", cErr)
+			}
+		}
+		prNotes = append(prNotes, "### Blocked by path policy\n\n"+note)
+		result.ChangesMade = allowed
+	}
+	// Generated files are changed through their generator, never by hand
+	if protect := repoCfg.GeneratedFiles.Protect; protect != nil && *protect {
+		kept, generated := repoActions.SplitGeneratedChanges(repoPath, result.ChangesMade)
+		if len(generated) > 0 {
+			slog.WarnContext(logging.For(ctx), "Agent edited generated files", "files", generatedPaths(generated))
+			repoActions.RevertPaths(repoPath, generatedPaths(generated))
+			note := repoActions.GeneratedFilesNote(generated)
+			if len(kept) == 0 {
+				if cErr := repoActions.PostIssueComment(ctx, repoName, issueNumber, note+"\nNo other changes were produced, so no pull request was opened."); cErr != nil {
+					slog.ErrorContext(logging.For(ctx), "Failed to post generated files comment", "error", cErr)
 				}
-			} else {
-				// Use the AI-generated PR body directly
-				prTitle := fmt.Sprintf("[#%d] %s", issueNumber, issueTitle) // neutral title is fine
-				bodyWithLink := ensureClosingLink(string(prBodyContent), issueNumber)
+			}
+			prNotes = append(prNotes, note)
+			result.ChangesMade = kept
+		}
+	}
+	repoActions.AddLicenseHeaders(repoPath, repoCfg.LicenseHeaders, result.ChangesMade)
 
-				slog.Info("Creating PR with AI-generated body", "length", len(bodyWithLink))
-				pr, err = repoActions.CreatePullRequest(ctx, repoName, branchName, prTitle, bodyWithLink)
+	// Documentation mode must not ship code changes
+	if docsMode {
+		docs, code := repoActions.SplitDocumentationChanges(repoPath, result.ChangesMade)
+		if len(code) > 0 {
+			slog.WarnContext(logging.For(ctx), "Discarding code changes in documentation mode", "files", code)
+			repoActions.RevertPaths(repoPath, code)
+			prNotes = append(prNotes, repoActions.DocsModeNote(code))
+			result.ChangesMade = docs
+		}
+	}
 
-				if err != nil {
-					slog.Error("Failed to create PR with AI-generated body", "error", err)
-					return err
+	// Workflow files can only be pushed when the installation has the workflows permission
+	if others, workflows := repoActions.SplitWorkflowChanges(result.ChangesMade); len(workflows) > 0 {
+		perms, pErr := repoActions.GetInstallationPermissions(ctx, event.GetInstallation().GetID())
+		if pErr != nil {
+			slog.WarnContext(logging.For(ctx), "Could not determine app permissions, treating workflows as read-only", "error", pErr)
+		}
+		if !repoActions.CanWriteWorkflows(perms) {
+			slog.WarnContext(logging.For(ctx), "Dropping workflow changes: app lacks workflows permission", "files", workflows)
+			repoActions.RevertPaths(repoPath, workflows)
+			note := repoActions.WorkflowPermissionNote(workflows)
+			if len(others) == 0 {
+				if cErr := repoActions.PostIssueComment(ctx, repoName, issueNumber, note+"\n\nNo other changes were produced, so no pull request was opened."); cErr != nil {
+					slog.ErrorContext(logging.For(ctx), "Failed to post workflow permission comment", "error", cErr)
 				}
-				slog.Info("PR created successfully with AI-generated description")
 			}
-		} else {
-			slog.Info("No PR body file returned by agent, composing PR body with closing link")
+			prNotes = append(prNotes, note)
+			result.ChangesMade = others
+		}
+	}
 
-			prTitle := fmt.Sprintf("[#%d] %s", issueNumber, issueTitle)
+	// Unrequested deletions and new binaries are dropped; large changes may need confirmation
+	if !applyChangeLimits(ctx, lang, repoName, event.Issue, repoPath, issueText, repoCfg.Limits, result, &prNotes) {
+		result.ChangesMade = nil
+	}
 
-			baseBody := fmt.Sprintf(
-				"Summary:\n%s\n\nModified files:\n- %s\n\nPlease review the automated changes generated by the AI agent.",
-				result.Summary,
-				strings.Join(result.ChangesMade, "\n- "),
-			)
+	// The organization's plugins post-process the changes and check them against its policies
+	if len(result.ChangesMade) > 0 {
+		ok, err := applyPlugins(ctx, lang, repoName, repoPath, event.Issue, repoCfg.Paths, result, &prNotes)
+		if err != nil {
+			return err
+		} else if !ok {
+			result.ChangesMade = nil
+		}
+	}
 
-			bodyWithLink := ensureClosingLink(baseBody, issueNumber)
+	// A run started beside others must not have touched their files
+	if err := slot.Claim(result.ChangesMade); err != nil {
+		if cleanupErr := repoActions.CleanupRepo(repoPath); cleanupErr != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to cleanup temporary repository", "error", cleanupErr)
+		}
+		return err
+	}
 
-			pr, err = repoActions.CreatePullRequest(ctx, repoName, branchName, prTitle, bodyWithLink)
-			if err != nil {
-				slog.Error("Failed to create PR", "error", err)
-				return err
-			}
+	// Deletions and renames are listed in the pull request as the checkout now shows them
+	if len(result.ChangesMade) > 0 {
+		result.Operations = repoActions.FileOperations(repoPath, result.ChangesMade, result.Operations)
+		if len(result.Operations) > 0 {
+			prNotes = append(prNotes, "### Deleted and renamed files\n\n"+repoActions.FormatFileOperations(result.Operations))
 		}
+	}
 
-		slog.Info("Python agent workflow completed successfully",
-			"issueNumber", issueNumber,
-			"branch", branchName,
-			"prNumber", pr.GetNumber(),
-			"prURL", pr.GetHTMLURL(),
-			"modifiedFiles", len(result.ChangesMade))
-	} else {
-		slog.Info("No files were modified by the agent", "issueNumber", issueNumber)
+	// Use the results
+	for _, file := range result.ChangesMade {
+		fmt.Printf("Changed: %s\n", file)
 	}
 
-	// Cleanup
-	if cfg.Repository.CleanupTempRepos {
-		if cleanupErr := repoActions.CleanupRepo(repoPath); cleanupErr != nil {
-			slog.Error("Failed to cleanup temporary repository", "error", cleanupErr)
-		} else {
-			slog.Info("Temporary repository cleaned up", "repoPath", repoPath)
+	// Changes the agent is unsure of become a plan for a human instead of a pull request
+	confidence := scoreRun(result.PlanConfidence, result.Confidence, repoCfg.Escalation)
+	escalated := len(result.ChangesMade) > 0 && confidence != nil && confidence.Escalated
+	if escalated {
+		escalateIssueRun(ctx, lang, repoName, repoPath, event.Issue, result, confidence, repoCfg.Escalation.Reviewers, variantNames(issueCtx.PromptVariants), runCandidates(issueCtx))
+	} else if len(result.ChangesMade) > 0 && !runPipelineGates(ctx, cfg, lang, repoName, repoPath, event.Issue, pipeline, result, &prNotes) {
+		// The pipeline stopped short of a pull request and the issue says why
+		if err := repoActions.SetIssueStatus(ctx, repoName, issueNumber, ""); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to clear issue status", "issueNumber", issueNumber, "error", err)
+		}
+	} else if len(result.ChangesMade) > 0 && len(prNotes) == 0 && cfg.Issues.SmallFixes.Enabled && !docsMode && revision == nil &&
+		offerSmallFix(ctx, cfg, lang, repoName, repoPath, event.Issue, result) {
+		if err := repoActions.SetIssueStatus(ctx, repoName, issueNumber, ""); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to clear issue status", "issueNumber", issueNumber, "error", err)
+		}
+	} else if len(result.ChangesMade) > 0 {
+		// Create branch and commit changes
+		commitMessage := fmt.Sprintf("Resolve issue #%d: %s\n\n%s", issueNumber, issueTitle, result.Summary)
+		if docsMode {
+			commitMessage = fmt.Sprintf("Document issue #%d: %s\n\n%s", issueNumber, issueTitle, result.Summary)
+		} else if revision != nil && revision.UpdatePR != nil {
+			commitMessage = fmt.Sprintf("Revise for edited issue #%d: %s\n\n%s", issueNumber, issueTitle, result.Summary)
+		}
+		// The primary authors of the files the agent changed are tagged on the pull request
+		owners := repoActions.CollectFileOwnership(repoPath, result.ChangesMade)
+		reviewers := repoActions.SuggestReviewers(ctx, repoName, owners, event.Issue.GetUser().GetLogin())
+		run, err := newIssueRun(repoName, issueNumber, issueTitle, lang, repoPath, branchName, commitMessage, event.Issue.GetUser().GetLogin(), result, prNotes, generation.PRBodyMaxTokens, issueLinks(ctx, repoName, event.Issue, repoCfg.Links))
+		if err != nil {
+			return err
+		}
+		run.Checkpoint.Reviewers = reviewers
+		if revision != nil {
+			run.Checkpoint.UpdatePR = revision.UpdatePR
+		}
+		run.Variants = variantNames(issueCtx.PromptVariants)
+		run.Confidence = confidence
+		run.Candidates = runCandidates(issueCtx)
+		if err := publishIssueRun(ctx, cfg, lease, run, issueTitle, repoPath); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && run.Stage == stageCommit {
+				postPartialResults(ctx, repoName, issueNumber, "push", issueCtx, result)
+			}
+			return err
+		}
+	} else {
+		slog.InfoContext(logging.For(ctx), "No files were modified by the agent", "issueNumber", issueNumber)
+		if err := repoActions.SetIssueStatus(ctx, repoName, issueNumber, ""); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to clear issue status", "issueNumber", issueNumber, "error", err)
 		}
 	}
 
+	cleanupIssueClone(ctx, cfg, repoPath)
 	return nil
 }
 
-func branchExists(ctx *probot.Context, repoName, branchName string) bool {
-	parts := strings.Split(repoName, "/")
-	if len(parts) != 2 {
-		slog.Error("Invalid repo name format", "repoName", repoName)
-		return false
+// cleanupIssueClone removes the run's clone when temporary repositories are not kept
+func cleanupIssueClone(ctx *probot.Context, cfg *config.Config, repoPath string) {
+	if !cfg.Repository.CleanupTempRepos {
+		return
+	}
+	if cleanupErr := repoActions.CleanupRepo(repoPath); cleanupErr != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to cleanup temporary repository", "error", cleanupErr)
+	} else {
+		slog.InfoContext(logging.For(ctx), "Temporary repository cleaned up", "repoPath", repoPath)
 	}
+}
 
-	owner := parts[0]
-	repo := parts[1]
+// runCandidates keeps the ranked candidate files of a run, so its file choice can be explained
+func runCandidates(issueCtx ai.IssueContext) []store.FileCandidate {
+	out := make([]store.FileCandidate, 0, len(issueCtx.Candidates))
+	for _, c := range issueCtx.Candidates {
+		out = append(out, store.FileCandidate{File: c.File, Score: c.Score, Reasons: c.Reasons})
+	}
+	return out
+}
 
-	_, _, err := ctx.GitHub.Git.GetRef(context.Background(), owner, repo, "refs/heads/"+branchName)
-	return err == nil // If no error, branch exists
+func branchExists(ctx *probot.Context, repoName, branchName string) bool {
+	return repoActions.BranchExists(ctx, repoName, branchName)
 }
 
 // hasRequiredLabels checks if the issue has any of the required labels
@@ -310,6 +670,19 @@ func hasRequiredLabels(labels []github.Label) bool {
 	return false
 }
 
+// hasLabel checks if the issue carries the given label (case-insensitive)
+func hasLabel(labels []github.Label, name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, label := range labels {
+		if strings.EqualFold(label.GetName(), name) {
+			return true
+		}
+	}
+	return false
+}
+
 // Helper function to get label names for logging
 func getIssueLabelNames(labels []github.Label) []string {
 	var labelNames []string
@@ -323,123 +696,61 @@ func getIssueLabelNames(labels []github.Label) []string {
 
 // initializeDevflowKnowledgeBaseFromIssues creates the Devflow knowledge base from the issues handler
 func initializeDevflowKnowledgeBaseFromIssues(ctx *probot.Context, repoName string) error {
-	slog.Info("Initializing Devflow knowledge base from issues handler", "repo", repoName)
+	slog.InfoContext(logging.For(ctx), "Initializing Devflow knowledge base from issues handler", "repo", repoName)
 
 	// Clone repository temporarily
-	repoPath, repoURL, err := repoActions.CloneRepository(repoName)
+	repoPath, repoURL, err := repoActions.CloneRepository(logging.For(ctx), repoName)
 	if err != nil {
-		slog.Error("Failed to clone repository for knowledge base initialization", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to clone repository for knowledge base initialization", "error", err)
 		return err
 	}
 	defer func() {
 		if cleanupErr := repoActions.CleanupRepo(repoPath); cleanupErr != nil {
-			slog.Error("Failed to cleanup repository", "repoPath", repoPath, "error", cleanupErr)
+			slog.ErrorContext(logging.For(ctx), "Failed to cleanup repository", "repoPath", repoPath, "error", cleanupErr)
 		}
 	}()
 
-	// Create .devflow directory
 	cfg := config.GetConfig()
-	devflowDir := cfg.GetDevflowDir(repoPath)
-	if err := repoActions.CreateDirectory(devflowDir); err != nil {
-		slog.Error("Failed to create .devflow directory", "error", err)
-		return err
-	}
-
-	// Step 1: Generate repo-structure.md using RepoAnalyzer (flattened structure)
-	structureFile := cfg.GetDevflowPath(repoPath, cfg.Files.StructureFile)
-	if err := repoActions.AnalyzeRepo(ctx, structureFile, repoPath, repoURL); err != nil {
-		slog.Error("Failed to generate repo structure", "error", err)
-		return err
-	}
-
-	// Step 2: Save debug files (only if debug mode is enabled)
-	var metadataFile, promptFile string
-	if cfg.Debug.CreateDebugFiles {
-		// Save file metadata as JSON
-		metadataFile = cfg.GetDevflowPath(repoPath, cfg.Files.MetadataFile)
-		if err := repoActions.SaveFileMetadata(repoPath, metadataFile); err != nil {
-			slog.Error("Failed to save file metadata", "error", err)
-			return err
-		}
-
-		// Save analysis prompt (using repo structure content)
-		promptFile = cfg.GetDevflowPath(repoPath, cfg.Files.AnalysisPromptFile)
-		if err := repoActions.SaveAnalysisPrompt(repoPath, repoURL, structureFile, promptFile); err != nil {
-			slog.Error("Failed to save analysis prompt", "error", err)
-			return err
-		}
-		slog.Info("Debug files created", "metadata", metadataFile, "prompt", promptFile)
-	}
-
-	// Step 4: Generate LLM analysis
-	analysisFile := cfg.GetDevflowPath(repoPath, cfg.Files.AnalysisFile)
-	if err := repoActions.GenerateRepoAnalysisWithLLM(repoPath, repoURL, structureFile, analysisFile); err != nil {
-		slog.Error("Failed to generate LLM analysis", "error", err)
-		return err
-	}
-
-	// Step 5: Build dependency graph
-	dependencyFile := cfg.GetDevflowPath(repoPath, cfg.Files.DependencyFile)
-	if err := repoActions.GenerateDependencyGraph(repoPath, dependencyFile); err != nil {
-		slog.Error("Failed to generate dependency graph", "error", err)
-		return err
-	}
-
-	// Step 6: Create .devflow/README.md
-	readmeFile := cfg.GetDevflowPath(repoPath, cfg.Files.ReadmeFile)
-	if err := repoActions.CreateDevflowReadme(readmeFile, repoName); err != nil {
-		slog.Error("Failed to create Devflow README", "error", err)
+	devflowFiles, err := repoActions.BuildKnowledgeBase(logging.For(ctx), repoPath, repoURL, repoName, nil)
+	if err != nil {
 		return err
 	}
 
 	// Step 5: Commit all files to the repository
 	branchName := cfg.Installations.KnowledgeBaseBranch
 	if err := repoActions.CreateBranch(ctx, repoName, branchName); err != nil {
-		slog.Error("Failed to create knowledge base branch", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to create knowledge base branch", "error", err)
 		return err
 	}
 
-	// Prepare files to commit (core files always, debug files conditionally)
-	devflowFiles := []string{
-		structureFile,
-		analysisFile,
-		dependencyFile,
-		readmeFile,
-	}
-
-	// Add debug files if they were created
-	if cfg.Debug.CreateDebugFiles {
-		devflowFiles = append(devflowFiles, metadataFile, promptFile)
-	}
-
 	// Commit all files in a single commit
 	if err := repoActions.CommitMultipleFiles(ctx, repoName, branchName, cfg.Installations.KnowledgeBaseCommit, devflowFiles, true, ""); err != nil {
-		slog.Error("Failed to commit Devflow files", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to commit Devflow files", "error", err)
 		return err
 	}
 
 	// Create pull request for knowledge base initialization (temporary - will be replaced with actual issue resolution)
 	pr, err := repoActions.CreateInstallationPR(ctx, repoName, branchName)
 	if err != nil {
-		slog.Error("Failed to create pull request", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to create pull request", "error", err)
 		return err
 	}
 
 	// Cleanup temporary repository (if enabled)
 	if cfg.Repository.CleanupTempRepos {
 		if cleanupErr := repoActions.CleanupRepo(repoPath); cleanupErr != nil {
-			slog.Error("Failed to cleanup temporary repository", "repoPath", repoPath, "error", cleanupErr)
+			slog.ErrorContext(logging.For(ctx), "Failed to cleanup temporary repository", "repoPath", repoPath, "error", cleanupErr)
 		} else {
-			slog.Info("Temporary repository cleaned up", "repoPath", repoPath)
+			slog.InfoContext(logging.For(ctx), "Temporary repository cleaned up", "repoPath", repoPath)
 		}
 	} else {
-		slog.Info("Temporary repository preserved for debugging", "repoPath", repoPath)
+		slog.InfoContext(logging.For(ctx), "Temporary repository preserved for debugging", "repoPath", repoPath)
 	}
 
-	slog.Info("Devflow knowledge base initialized successfully",
+	slog.InfoContext(logging.For(ctx), "Devflow knowledge base initialized successfully",
 		"repo", repoName,
 		"branch", branchName,
-		"prNumber", pr.GetNumber(),
-		"prURL", pr.GetHTMLURL())
+		"prNumber", pr.Number,
+		"prURL", pr.HTMLURL)
 	return nil
 }
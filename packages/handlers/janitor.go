@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/repository"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// StartJanitor periodically cleans up DevFlow pull requests and branches in every
+// repository the app can access
+func StartJanitor() {
+	cfg := config.GetConfig().Janitor
+	if !cfg.Enabled {
+		return
+	}
+	interval := time.Duration(cfg.IntervalHours) * time.Hour
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	slog.Info("Janitor started", "interval", interval, "graceDays", cfg.GraceDays)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			runScheduledJanitor()
+		}
+	}()
+}
+
+// runScheduledJanitor runs the janitor on every repository the app can access
+func runScheduledJanitor() {
+	app, err := repository.AppFromEnv()
+	if err != nil {
+		slog.Error("Cannot run janitor", "error", err)
+		return
+	}
+	installations, err := repository.ListInstalledRepositories(context.Background(), app)
+	if err != nil {
+		slog.Error("Failed to list installed repositories", "error", err)
+		return
+	}
+
+	for installationID, repos := range installations {
+		ctx, err := repository.NewInstallationContext(app, installationID)
+		if err != nil {
+			slog.Error("Failed to authenticate installation", "installationID", installationID, "error", err)
+			continue
+		}
+		for _, repoName := range repos {
+			if err := RunJanitor(ctx, repoName); err != nil {
+				slog.Error("Janitor run failed", "repo", repoName, "error", err)
+			}
+		}
+	}
+}
+
+// RunJanitor closes open DevFlow PRs whose issue was closed without merging them, then
+// deletes DevFlow branches with no open PR once they have been merged or abandoned for the
+// grace period. Issues are told about both.
+func RunJanitor(ctx *probot.Context, repoName string) error {
+	cfg := config.GetConfig().Janitor
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
+	client := repository.NewGitHubClient(ctx)
+	runCtx := context.Background()
+
+	info, err := client.GetRepository(runCtx, owner, repo)
+	if err != nil {
+		return fmt.Errorf("failed to get repository: %w", err)
+	}
+
+	open, err := client.ListPullRequests(runCtx, owner, repo, "open", "")
+	if err != nil {
+		return fmt.Errorf("failed to list open pull requests: %w", err)
+	}
+	inUse := make(map[string]bool)
+	for _, pr := range open {
+		if !strings.EqualFold(pr.HeadRepo, repoName) || !isJanitorBranch(cfg, pr.HeadRef) {
+			continue
+		}
+		if closeOrphanedPR(ctx, client, repoName, pr) {
+			continue
+		}
+		inUse[pr.HeadRef] = true
+	}
+
+	branches, err := client.ListBranches(runCtx, owner, repo)
+	if err != nil {
+		return fmt.Errorf("failed to list branches: %w", err)
+	}
+	cutoff := time.Now().Add(-time.Duration(cfg.GraceDays) * 24 * time.Hour)
+	for _, b := range branches {
+		branch := strings.TrimPrefix(b.Ref, "refs/heads/")
+		if branch == info.DefaultBranch || inUse[branch] || !isJanitorBranch(cfg, branch) {
+			continue
+		}
+		reason, lastActivity, err := branchStatus(runCtx, client, owner, repo, branch, b.SHA)
+		if err != nil {
+			slog.WarnContext(logging.For(ctx), "Janitor could not inspect branch", "repo", repoName, "branch", branch, "error", err)
+			continue
+		}
+		if reason == "" || lastActivity.After(cutoff) {
+			continue
+		}
+		if err := client.DeleteRef(runCtx, owner, repo, b.Ref); err != nil {
+			slog.ErrorContext(logging.For(ctx), "Janitor failed to delete branch", "repo", repoName, "branch", branch, "error", err)
+			continue
+		}
+		slog.InfoContext(logging.For(ctx), "Janitor deleted branch", "repo", repoName, "branch", branch, "reason", reason)
+		if issueNumber, ok := issueNumberFromBranch(branch); ok {
+			comment := fmt.Sprintf("DevFlow deleted the branch `%s`: %s.", branch, reason)
+			if err := repository.PostIssueComment(ctx, repoName, issueNumber, comment); err != nil {
+				slog.WarnContext(logging.For(ctx), "Failed to comment on branch cleanup", "issueNumber", issueNumber, "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+// closeOrphanedPR closes an issue PR whose issue is closed, reporting whether it did
+func closeOrphanedPR(ctx *probot.Context, client githubapi.Client, repoName string, pr githubapi.PullRequest) bool {
+	issueNumber, ok := issueNumberFromBranch(pr.HeadRef)
+	if !ok {
+		return false
+	}
+	owner, repo, _ := githubapi.SplitRepoName(repoName)
+	issue, err := client.GetIssue(context.Background(), owner, repo, issueNumber)
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Janitor could not fetch the issue of a PR", "repo", repoName, "pr", pr.Number, "issueNumber", issueNumber, "error", err)
+		return false
+	}
+	if issue.State != "closed" {
+		return false
+	}
+
+	if err := client.ClosePullRequest(context.Background(), owner, repo, pr.Number); err != nil {
+		slog.ErrorContext(logging.For(ctx), "Janitor failed to close PR", "repo", repoName, "pr", pr.Number, "error", err)
+		return false
+	}
+	slog.InfoContext(logging.For(ctx), "Janitor closed PR of closed issue", "repo", repoName, "pr", pr.Number, "issueNumber", issueNumber)
+	comment := fmt.Sprintf("DevFlow closed %s because this issue was closed without merging it. Its branch will be deleted after %d days.",
+		pr.HTMLURL, config.GetConfig().Janitor.GraceDays)
+	if err := repository.PostIssueComment(ctx, repoName, issueNumber, comment); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to comment on PR cleanup", "issueNumber", issueNumber, "error", err)
+	}
+	return true
+}
+
+// branchStatus explains why a branch without an open PR can go and since when: its last PR
+// was merged or closed, or no PR was ever opened from it. An empty reason keeps the branch.
+func branchStatus(ctx context.Context, client githubapi.Client, owner, repo, branch, headSHA string) (string, time.Time, error) {
+	prs, err := client.ListPullRequests(ctx, owner, repo, "all", owner+":"+branch)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	var last *githubapi.PullRequest
+	for i := range prs {
+		if prs[i].State == "open" {
+			return "", time.Time{}, nil
+		}
+		if last == nil || prs[i].ClosedAt.After(last.ClosedAt) {
+			last = &prs[i]
+		}
+	}
+	if last != nil {
+		if last.Merged {
+			return fmt.Sprintf("%s was merged", last.HTMLURL), last.ClosedAt, nil
+		}
+		return fmt.Sprintf("%s was closed without merging", last.HTMLURL), last.ClosedAt, nil
+	}
+
+	commit, err := client.GetCommit(ctx, owner, repo, headSHA)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return "no pull request was opened from it", commit.Date, nil
+}
+
+// isJanitorBranch reports whether a branch is one of DevFlow's, by the configured prefixes
+func isJanitorBranch(cfg config.JanitorConfig, branch string) bool {
+	for _, prefix := range cfg.BranchPrefixes {
+		if prefix != "" && strings.HasPrefix(branch, prefix) {
+			return true
+		}
+	}
+	return false
+}
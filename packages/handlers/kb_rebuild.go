@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// rebuildAssociations may force a knowledge base rebuild, which repeats the whole analysis
+var rebuildAssociations = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+
+func init() {
+	commandHandlers["rebuild-kb"] = handleRebuildKBCommand
+}
+
+// kbRebuild is the progress of a repository's latest knowledge base rebuild in this process
+type kbRebuild struct {
+	Repo       string     `json:"repo"`
+	Stage      string     `json:"stage"` // stage in progress, or the one that failed
+	Done       []string   `json:"done"`  // stages finished
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// kbRebuilds holds the latest rebuild of each repository, for the admin API
+var kbRebuilds = struct {
+	sync.Mutex
+	byRepo map[string]*kbRebuild
+}{byRepo: map[string]*kbRebuild{}}
+
+// handleRebuildKBCommand regenerates the repository's knowledge base from scratch:
+// "/devflow rebuild-kb". Progress is reported in a comment on the issue it was posted on.
+func handleRebuildKBCommand(ctx *probot.Context, event *github.IssueCommentEvent, cmd slashCommand) error {
+	repoName := event.GetRepo().GetFullName()
+	number := event.GetIssue().GetNumber()
+	commenter := event.GetComment().GetUser().GetLogin()
+	if !slices.Contains(rebuildAssociations, event.GetComment().GetAuthorAssociation()) {
+		return repoActions.PostIssueComment(ctx, repoName, number,
+			fmt.Sprintf("@%s only maintainers can rebuild the knowledge base.", commenter))
+	}
+	return rebuildKnowledgeBase(ctx, repoName, number)
+}
+
+// rebuildKnowledgeBase clones the repository and rebuilds its knowledge base from scratch.
+// When issueNumber is not 0, a comment on it lists the stages and is updated as each starts.
+func rebuildKnowledgeBase(ctx *probot.Context, repoName string, issueNumber int) error {
+	rebuild := &kbRebuild{Repo: repoName, StartedAt: time.Now().UTC()}
+	kbRebuilds.Lock()
+	if prev, ok := kbRebuilds.byRepo[repoName]; ok && prev.FinishedAt == nil {
+		kbRebuilds.Unlock()
+		if issueNumber != 0 {
+			return repoActions.PostIssueComment(ctx, repoName, issueNumber, "The knowledge base of this repository is already being rebuilt.")
+		}
+		return fmt.Errorf("knowledge base of %s is already being rebuilt", repoName)
+	}
+	kbRebuilds.byRepo[repoName] = rebuild
+	kbRebuilds.Unlock()
+	slog.InfoContext(logging.For(ctx), "Rebuilding knowledge base from scratch", "repo", repoName)
+
+	var commentID int64
+	report := func() {
+		if issueNumber == 0 {
+			return
+		}
+		kbRebuilds.Lock()
+		body := rebuildProgressComment(rebuild)
+		kbRebuilds.Unlock()
+		var err error
+		if commentID == 0 {
+			commentID, err = repoActions.CreateIssueComment(ctx, repoName, issueNumber, body)
+		} else {
+			err = repoActions.EditIssueComment(ctx, repoName, commentID, body)
+		}
+		if err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to report knowledge base rebuild progress", "issueNumber", issueNumber, "error", err)
+		}
+	}
+	finish := func(err error) error {
+		kbRebuilds.Lock()
+		now := time.Now().UTC()
+		rebuild.FinishedAt = &now
+		if err != nil {
+			rebuild.Error = err.Error()
+		} else {
+			rebuild.Done = append(rebuild.Done, rebuild.Stage)
+			rebuild.Stage = ""
+		}
+		kbRebuilds.Unlock()
+		report()
+		return err
+	}
+
+	report()
+	repoPath, _, err := repoActions.CloneRepository(logging.For(ctx), repoName)
+	if err != nil {
+		return finish(err)
+	}
+	if config.GetConfig().Repository.CleanupTempRepos {
+		defer func() {
+			if cleanupErr := repoActions.CleanupRepo(repoPath); cleanupErr != nil {
+				slog.ErrorContext(logging.For(ctx), "Failed to cleanup repository", "repoPath", repoPath, "error", cleanupErr)
+			}
+		}()
+	}
+	err = repoActions.RebuildKnowledgeBase(ctx, repoName, repoPath, func(stage string) {
+		kbRebuilds.Lock()
+		if rebuild.Stage != "" {
+			rebuild.Done = append(rebuild.Done, rebuild.Stage)
+		}
+		rebuild.Stage = stage
+		kbRebuilds.Unlock()
+		slog.InfoContext(logging.For(ctx), "Knowledge base rebuild stage", "repo", repoName, "stage", stage)
+		report()
+	})
+	return finish(err)
+}
+
+// rebuildProgressComment renders a rebuild as a checklist of its stages
+func rebuildProgressComment(rebuild *kbRebuild) string {
+	var b strings.Builder
+	b.WriteString("### Rebuilding the DevFlow knowledge base\n\n")
+	for _, stage := range repoActions.KBStages {
+		switch {
+		case slices.Contains(rebuild.Done, stage):
+			b.WriteString("- [x] " + stage + "\n")
+		case stage == rebuild.Stage && rebuild.Error != "":
+			b.WriteString("- [ ] " + stage + " ❌\n")
+		case stage == rebuild.Stage:
+			b.WriteString("- [ ] " + stage + " ⏳\n")
+		default:
+			b.WriteString("- [ ] " + stage + "\n")
+		}
+	}
+	switch {
+	case rebuild.Error != "":
+		b.WriteString("\nThe rebuild failed: " + rebuild.Error + "\n")
+	case rebuild.FinishedAt != nil:
+		b.WriteString(fmt.Sprintf("\nDone in %s. The new knowledge base is published according to this repository's sync settings.\n",
+			rebuild.FinishedAt.Sub(rebuild.StartedAt).Round(time.Second)))
+	}
+	return b.String()
+}
+
+// handleRebuildKB starts a knowledge base rebuild of the repository in the path; ?issue=N
+// reports its progress in a comment on that issue. The rebuild continues in the background.
+func handleRebuildKB(w http.ResponseWriter, r *http.Request) {
+	repoName := repoPathValue(r)
+	issueNumber := 0
+	if v := r.URL.Query().Get("issue"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "issue must be a number", http.StatusBadRequest)
+			return
+		}
+		issueNumber = n
+	}
+	kbRebuilds.Lock()
+	prev, running := kbRebuilds.byRepo[repoName]
+	running = running && prev.FinishedAt == nil
+	kbRebuilds.Unlock()
+	if running {
+		http.Error(w, "a rebuild of this repository is already running", http.StatusConflict)
+		return
+	}
+
+	ctx, _, ok := repoInstallationContext(w, r, repoName)
+	if !ok {
+		return
+	}
+
+	go func() {
+		if err := rebuildKnowledgeBase(ctx, repoName, issueNumber); err != nil {
+			slog.Error("Knowledge base rebuild failed", "repo", repoName, "error", err)
+		}
+	}()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]any{"rebuilding": repoName, "stages": repoActions.KBStages})
+}
+
+// handleRebuildKBStatus returns the progress of the repository's latest rebuild
+func handleRebuildKBStatus(w http.ResponseWriter, r *http.Request) {
+	kbRebuilds.Lock()
+	defer kbRebuilds.Unlock()
+	rebuild, ok := kbRebuilds.byRepo[repoPathValue(r)]
+	if !ok {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rebuild)
+}
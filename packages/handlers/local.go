@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+)
+
+// ResolveIssueLocally runs the agent on an issue against a local checkout and leaves its
+// changes in the working tree; nothing is committed and GitHub is not contacted, so linked
+// issues are not followed. Changes the repository's path policy (or documentation mode)
+// does not allow are reverted. A nil agent runs the configured engine.
+func ResolveIssueLocally(ctx context.Context, repoName, repoPath string, issue *github.Issue, agent ai.Agent) (*ai.PythonAgentResult, error) {
+	cfg := config.GetConfig()
+	if _, err := os.Stat(cfg.GetDevflowPath(repoPath, cfg.Files.StructureFile)); os.IsNotExist(err) {
+		return nil, &repoActions.KBMissingError{RepoName: repoName}
+	}
+
+	repoCfg, err := config.LoadRepoConfig(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	generation, err := ai.ResolveGenerationSettings(cfg, repoCfg.AI)
+	if err != nil {
+		return nil, err
+	}
+
+	agentIssue := translateIssueForModel(ctx, cfg, issue)
+	issueCtx := gatherIssueContext(cfg, repoName, repoPath, issue, agentIssue.GetTitle()+"\n"+agentIssue.GetBody())
+	issueCtx.Generation = &generation
+
+	if agent == nil {
+		agent = ai.ResolveIssue
+	}
+	result, err := agent(ctx, repoPath, agentIssue, issueCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, violations := repoActions.FilterByPathPolicy(repoCfg.Paths, result.ChangesMade)
+	if len(violations) > 0 {
+		slog.WarnContext(ctx, "Reverting changes forbidden by path policy", "files", pathsOf(violations))
+		repoActions.RevertPaths(repoPath, pathsOf(violations))
+		result.ChangesMade = allowed
+	}
+	if protect := repoCfg.GeneratedFiles.Protect; protect != nil && *protect {
+		kept, generated := repoActions.SplitGeneratedChanges(repoPath, result.ChangesMade)
+		if len(generated) > 0 {
+			slog.WarnContext(ctx, "Reverting edits to generated files", "files", generatedPaths(generated))
+			repoActions.RevertPaths(repoPath, generatedPaths(generated))
+			result.ChangesMade = kept
+		}
+	}
+	if issueCtx.Mode == "docs" {
+		docs, code := repoActions.SplitDocumentationChanges(repoPath, result.ChangesMade)
+		if len(code) > 0 {
+			slog.WarnContext(ctx, "Reverting code changes in documentation mode", "files", code)
+			repoActions.RevertPaths(repoPath, code)
+			result.ChangesMade = docs
+		}
+	}
+	repoActions.AddLicenseHeaders(repoPath, repoCfg.LicenseHeaders, result.ChangesMade)
+	if cfg.Repository.NormalizeLineEndings {
+		repoActions.NormalizeLineEndings(repoPath, result.ChangesMade)
+	}
+	return result, nil
+}
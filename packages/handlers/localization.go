@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// issueLanguage resolves the language DevFlow writes PR text and status comments in for an
+// issue, from the repository's `language` setting. English is the fallback.
+func issueLanguage(ctx *probot.Context, repoName string, issue *github.Issue) string {
+	repoCfg, err := repoActions.FetchRepoConfig(ctx, repoName)
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Could not read repository settings, answering in English", "repo", repoName, "error", err)
+		return "en"
+	}
+	lang := strings.ToLower(strings.TrimSpace(repoCfg.Language))
+	if lang == "auto" {
+		lang = ai.DetectLanguage(issue.GetTitle() + "\n" + issue.GetBody())
+	}
+	if lang == "" {
+		return "en"
+	}
+	return lang
+}
+
+// localize translates DevFlow-authored markdown into lang, falling back to the English text
+// when translation fails so the message is still delivered
+func localize(lang, text string) string {
+	return localizeLimited(lang, text, 0)
+}
+
+// localizeLimited is localize with the translation capped at maxTokens output tokens; 0 uses
+// ai.max_output_tokens
+func localizeLimited(lang, text string, maxTokens int32) string {
+	if ai.IsEnglish(lang) {
+		return text
+	}
+	out, err := ai.LocalizeLimited(context.Background(), text, lang, maxTokens)
+	if err != nil {
+		slog.Warn("Failed to localize message, posting in English", "language", lang, "error", err)
+		return text
+	}
+	return out
+}
+
+// translateIssueForModel returns the issue the agent works from: the original when it is in
+// English (or translation is disabled), otherwise a copy with an English title and body that
+// still quotes the original text
+func translateIssueForModel(ctx context.Context, cfg *config.Config, issue *github.Issue) *github.Issue {
+	if !cfg.Localization.TranslateForModel {
+		return issue
+	}
+	lang := ai.DetectLanguage(issue.GetTitle() + "\n" + issue.GetBody())
+	if ai.IsEnglish(lang) {
+		return issue
+	}
+	title, body, err := ai.TranslateIssue(ctx, issue.GetTitle(), issue.GetBody(), lang)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to translate issue, sending the original", "language", lang, "error", err)
+		return issue
+	}
+	slog.InfoContext(ctx, "Translated issue for the agent", "issueNumber", issue.GetNumber(), "language", lang)
+	body = fmt.Sprintf("%s\n\n---\nOriginal issue (%s):\n\n%s\n\n%s", body, ai.LanguageName(lang), issue.GetTitle(), issue.GetBody())
+	translated := *issue
+	translated.Title = &title
+	translated.Body = &body
+	return &translated
+}
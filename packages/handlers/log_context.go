@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"devflow-agent/packages/logging"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// withLogContext wraps a handler so every line it logs through logging.For(ctx) carries the
+// event, delivery, repository and issue or pull request it is handling
+func withLogContext(event string, handler func(ctx *probot.Context) error) func(ctx *probot.Context) error {
+	return func(ctx *probot.Context) error {
+		args := []any{"event", event}
+		if id, ok := deliveryIDs.Load(ctx); ok {
+			args = append(args, "delivery_id", id)
+		}
+		if p, ok := ctx.Payload.(interface{ GetRepo() *github.Repository }); ok && p.GetRepo() != nil {
+			args = append(args, "repo", p.GetRepo().GetFullName())
+		}
+		switch p := ctx.Payload.(type) {
+		case *github.IssuesEvent:
+			args = append(args, "issue", p.GetIssue().GetNumber())
+		case *github.IssueCommentEvent:
+			args = append(args, "issue", p.GetIssue().GetNumber())
+		case *github.PullRequestEvent:
+			args = append(args, "pr", p.GetPullRequest().GetNumber())
+		case *github.PullRequestReviewEvent:
+			args = append(args, "pr", p.GetPullRequest().GetNumber())
+		}
+
+		logging.Bind(ctx, args...)
+		defer logging.Release(ctx)
+		return handler(ctx)
+	}
+}
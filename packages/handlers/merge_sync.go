@@ -1,9 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"log/slog"
+	"strconv"
+	"strings"
 
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
 	"devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
 
 	"github.com/google/go-github/github"
 	"github.com/swinton/go-probot/probot"
@@ -12,38 +19,139 @@ import (
 // Triggered on PR close; if merged into default branch, sync .devflow incrementally.
 func HandlePullRequest(ctx *probot.Context) error {
 	ev := ctx.Payload.(*github.PullRequestEvent)
+	recordPullRequestUsage(ev)
+	syncProjectBoard(ctx, ev)
+	if ev.GetAction() == "opened" {
+		applyMergeStrategy(ctx, ev.Repo.GetFullName(), ev.PullRequest)
+	}
 	if ev.GetAction() != "closed" || !ev.PullRequest.GetMerged() {
 		return nil
 	}
+	clearIssueStatusForPR(ctx, ev)
+	deleteMergedBranch(ctx, ev.Repo.GetFullName(), ev.PullRequest)
 	if ev.PullRequest.Base.GetRef() != "main" { // optional: only if merged into main
 		return nil
 	}
+	if isOwnKnowledgeBasePR(ev.PullRequest) {
+		slog.InfoContext(logging.For(ctx), "Merged DevFlow knowledge base PR; no sync needed", "repo", ev.Repo.GetFullName(), "pr", ev.PullRequest.GetNumber())
+		return nil
+	}
 
 	baseRef := ev.PullRequest.Base.GetRef() // e.g., "main"
 	repoName := ev.Repo.GetFullName()
 
-	slog.Info("PR closed event", "repo", repoName, "base", baseRef, "merged", true)
+	slog.InfoContext(logging.For(ctx), "PR closed event", "repo", repoName, "base", baseRef, "merged", true)
+	if skipSync(ctx, repoName, mergedPRPaths(ctx, ev)) {
+		return nil
+	}
+	if applyCachedKBDelta(ctx, ev) {
+		return nil
+	}
 
 	// Clone and sync against origin/main
-	repoPath, _, err := repository.CloneRepository(repoName)
+	repoPath, _, err := repository.CloneRepository(logging.For(ctx), repoName)
 	if err != nil {
-		slog.Error("Clone failed for merge sync", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Clone failed for merge sync", "error", err)
 		return err
 	}
 	defer func() { _ = repository.CleanupRepo(repoPath) }()
 
 	headSHA, err := repository.GetOriginMainSHA(repoPath)
 	if err != nil {
-		slog.Error("Resolve origin/main failed", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Resolve origin/main failed", "error", err)
 		return err
 	}
 	if err := repository.RunIncrementalDevflowSync(ctx, repoName, repoPath, headSHA); err != nil {
-		slog.Error("Incremental devflow sync (PR) failed", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Incremental devflow sync (PR) failed", "error", err)
 		return err
 	}
 	return nil
 }
 
+// cacheKBDelta computes the knowledge base update of an issue run's pull request and keeps it
+// with the run, so the merge can be synced without a clone
+func cacheKBDelta(ctx *probot.Context, run *store.Run, repoPath string) {
+	owner, repo, err := githubapi.SplitRepoName(run.Repo)
+	if err != nil {
+		return
+	}
+	client := repository.NewGitHubClient(ctx)
+	ref, err := client.GetRef(context.Background(), owner, repo, "heads/"+run.Checkpoint.Branch)
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Not caching knowledge base delta", "error", err)
+		return
+	}
+	head, err := client.GetCommit(context.Background(), owner, repo, ref.SHA)
+	if err != nil || len(head.Parents) != 1 {
+		slog.WarnContext(logging.For(ctx), "Not caching knowledge base delta: cannot resolve the branch's parent", "error", err)
+		return
+	}
+	delta, err := repository.ComputeKBDelta(repoPath, run.Checkpoint.ChangedFiles, head.SHA, head.Parents[0])
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Not caching knowledge base delta", "error", err)
+		return
+	}
+	run.KBDelta = delta
+	slog.InfoContext(logging.For(ctx), "Cached knowledge base delta for the pull request", "files", len(delta.Files))
+}
+
+// applyCachedKBDelta syncs the knowledge base for a merged DevFlow pull request from the delta
+// cached with its issue run. It reports false when there is none or it no longer applies.
+func applyCachedKBDelta(ctx *probot.Context, ev *github.PullRequestEvent) bool {
+	issueNumber, ok := issueNumberFromBranch(ev.PullRequest.Head.GetRef())
+	if !ok {
+		return false
+	}
+	runs, err := store.Default()
+	if err != nil {
+		return false
+	}
+	repoName := ev.Repo.GetFullName()
+	run, err := runs.GetRun(store.RunID(issueRunKind, repoName, issueNumber))
+	if err != nil || run.KBDelta == nil || len(run.PRs) == 0 || run.PRs[0].Number != ev.PullRequest.GetNumber() {
+		return false
+	}
+	applied, err := repository.ApplyKBDelta(ctx, repoName, run.KBDelta, ev.PullRequest.Head.GetSHA(), ev.PullRequest.GetMergeCommitSHA())
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to apply cached knowledge base delta, syncing from a clone", "error", err)
+		return false
+	}
+	if !applied {
+		return false
+	}
+	run.KBDelta = nil
+	if err := runs.SaveRun(run); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to save issue run", "run", run.ID, "error", err)
+	}
+	return true
+}
+
+// issueNumberFromBranch parses the issue number out of a DevFlow issue branch, which is named
+// <branch_prefix><issue number>-<slug>
+func issueNumberFromBranch(ref string) (int, bool) {
+	prefix := config.GetConfig().Issues.BranchPrefix
+	if prefix == "" || !strings.HasPrefix(ref, prefix) {
+		return 0, false
+	}
+	numPart := strings.SplitN(strings.TrimPrefix(ref, prefix), "-", 2)[0]
+	issueNumber, err := strconv.Atoi(numPart)
+	if err != nil {
+		return 0, false
+	}
+	return issueNumber, true
+}
+
+// clearIssueStatusForPR removes lifecycle labels from the issue a merged DevFlow PR resolved
+func clearIssueStatusForPR(ctx *probot.Context, ev *github.PullRequestEvent) {
+	issueNumber, ok := issueNumberFromBranch(ev.PullRequest.Head.GetRef())
+	if !ok {
+		return
+	}
+	if err := repository.SetIssueStatus(ctx, ev.Repo.GetFullName(), issueNumber, ""); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to clear issue status after merge", "issueNumber", issueNumber, "error", err)
+	}
+}
+
 // Triggered on any push; if branch is main, sync .devflow incrementally.
 func HandlePush(ctx *probot.Context) error {
 	ev := ctx.Payload.(*github.PushEvent)
@@ -53,24 +161,83 @@ func HandlePush(ctx *probot.Context) error {
 	if ref != "refs/heads/main" {
 		return nil
 	}
+	if isOwnPush(ev) {
+		slog.InfoContext(logging.For(ctx), "Ignoring DevFlow's own push", "repo", repoName, "after", ev.GetAfter())
+		return nil
+	}
 
-	slog.Info("Push to main detected", "repo", repoName)
+	slog.InfoContext(logging.For(ctx), "Push to main detected", "repo", repoName)
+	if skipSync(ctx, repoName, pushChangedPaths(ev)) {
+		return nil
+	}
 
-	repoPath, _, err := repository.CloneRepository(repoName)
+	repoPath, _, err := repository.CloneRepository(logging.For(ctx), repoName)
 	if err != nil {
-		slog.Error("Clone failed for push sync", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Clone failed for push sync", "error", err)
 		return err
 	}
 	defer func() { _ = repository.CleanupRepo(repoPath) }()
 
 	headSHA, err := repository.GetOriginMainSHA(repoPath)
 	if err != nil {
-		slog.Error("Resolve origin/main failed", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Resolve origin/main failed", "error", err)
 		return err
 	}
 	if err := repository.RunIncrementalDevflowSync(ctx, repoName, repoPath, headSHA); err != nil {
-		slog.Error("Incremental devflow sync (push) failed", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Incremental devflow sync (push) failed", "error", err)
 		return err
 	}
 	return nil
 }
+
+// skipSync reports whether a change to the default branch touching paths can skip the
+// knowledge base sync under the repository's sync policy
+func skipSync(ctx *probot.Context, repoName string, paths []string) bool {
+	if len(paths) == 0 {
+		return false
+	}
+	repoCfg, err := repository.FetchRepoConfig(ctx, repoName)
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to read repo config; syncing anyway", "repo", repoName, "error", err)
+		return false
+	}
+	reason := repository.SyncSkipReason(repoCfg.Sync, paths)
+	if reason == "" {
+		return false
+	}
+	slog.InfoContext(logging.For(ctx), "Skipping knowledge base sync", "repo", repoName, "reason", reason, "paths", len(paths))
+	return true
+}
+
+// pushChangedPaths lists the paths a push's commits touched, or nil when the payload leaves
+// some commits out
+func pushChangedPaths(ev *github.PushEvent) []string {
+	if ev.GetForced() || ev.GetSize() > len(ev.Commits) {
+		return nil
+	}
+	var paths []string
+	for _, c := range ev.Commits {
+		paths = append(paths, c.Added...)
+		paths = append(paths, c.Removed...)
+		paths = append(paths, c.Modified...)
+	}
+	return paths
+}
+
+// mergedPRPaths lists the paths a merged pull request changed, or nil when they cannot all
+// be listed
+func mergedPRPaths(ctx *probot.Context, ev *github.PullRequestEvent) []string {
+	owner, repo, err := githubapi.SplitRepoName(ev.Repo.GetFullName())
+	if err != nil {
+		return nil
+	}
+	files, err := repository.NewGitHubClient(ctx).ListPullRequestFiles(context.Background(), owner, repo, ev.PullRequest.GetNumber())
+	if err != nil || len(files) != ev.PullRequest.GetChangedFiles() {
+		return nil
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Filename
+	}
+	return paths
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+const multiRepoRunKind = "multi_repo"
+
+// runMultiRepoWorkflow resolves an issue that needs coordinated changes in several repositories
+// of the installation, tracking the linked PRs as one run in the store
+func runMultiRepoWorkflow(ctx *probot.Context, event *github.IssuesEvent, repoName string, issueNumber int, issueTitle string) error {
+	cfg := config.GetConfig()
+	runs, err := store.Default()
+	if err != nil {
+		return err
+	}
+	runID := store.RunID(multiRepoRunKind, repoName, issueNumber)
+	logging.Bind(ctx, "run_id", runID)
+	if run, err := runs.GetRun(runID); err == nil && run.Status != store.StatusFailed && run.Status != store.StatusEscalated {
+		slog.InfoContext(logging.For(ctx), "Multi-repo issue already processed", "issueNumber", issueNumber, "run", runID, "status", run.Status)
+		return nil
+	}
+
+	if err := repoActions.SetIssueStatus(ctx, repoName, issueNumber, cfg.Issues.StatusLabels.InProgress); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to mark issue in progress", "issueNumber", issueNumber, "error", err)
+	}
+	run := &store.Run{ID: runID, Kind: multiRepoRunKind, Repo: repoName, IssueNumber: issueNumber, Status: store.StatusRunning}
+	postRunEvent(ctx, runEvent{Event: runEventStarted, RunID: runID, Kind: multiRepoRunKind, Repo: repoName, IssueNumber: issueNumber})
+	err = processMultiRepoIssue(ctx, cfg, runs, run, event.Issue)
+	if err != nil {
+		run.Status = store.StatusFailed
+		run.Errors = append(run.Errors, err.Error())
+		postRunEvent(ctx, runEvent{Event: runEventFailed, RunID: runID, Kind: multiRepoRunKind, Repo: repoName, IssueNumber: issueNumber, Error: err.Error()})
+		if sErr := repoActions.SetIssueStatus(ctx, repoName, issueNumber, cfg.Issues.StatusLabels.Failed); sErr != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to mark issue failed", "issueNumber", issueNumber, "error", sErr)
+		}
+		comment := failureComment(err) + deadLetterRun(ctx, multiRepoRunKind, repoName, issueNumber, issueTitle, []string{err.Error()})
+		if cErr := repoActions.PostIssueComment(ctx, repoName, issueNumber, comment); cErr != nil {
+			slog.ErrorContext(logging.For(ctx), "Failed to post failure comment", "issueNumber", issueNumber, "error", cErr)
+		}
+	} else {
+		clearDeadLetter(ctx, repoName, issueNumber)
+	}
+	if sErr := runs.SaveRun(run); sErr != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to save multi-repo run", "run", runID, "error", sErr)
+	}
+	return err
+}
+
+// processMultiRepoIssue plans per-repository changesets, lets the agent implement each one in
+// its own clone, opens a PR per repository and cross-references them
+func processMultiRepoIssue(ctx *probot.Context, cfg *config.Config, runs store.RunStore, run *store.Run, issue *github.Issue) error {
+	runCtx := logging.For(ctx)
+	issueText := issue.GetTitle() + "\n" + issue.GetBody()
+
+	accessible, err := repoActions.InstallationRepositories(runCtx, ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list installation repositories: %w", err)
+	}
+	repos := []string{run.Repo}
+	for _, r := range repoActions.ReferencedRepositories(issueText, accessible) {
+		if !strings.EqualFold(r, run.Repo) {
+			repos = append(repos, r)
+		}
+	}
+	if cfg.Issues.MultiRepoMaxRepos > 0 && len(repos) > cfg.Issues.MultiRepoMaxRepos {
+		repos = repos[:cfg.Issues.MultiRepoMaxRepos]
+	}
+	if len(repos) < 2 {
+		return fmt.Errorf("the issue does not reference any other repository this app is installed on (use owner/name)")
+	}
+	run.Repos = repos
+	if err := runs.SaveRun(run); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to save multi-repo run", "run", run.ID, "error", err)
+	}
+
+	// Clone every repository up front so the planner sees all of them
+	repoPaths := make(map[string]string)
+	defer func() {
+		for _, p := range repoPaths {
+			_ = repoActions.CleanupRepo(p)
+		}
+	}()
+	var overviews []ai.RepoOverview
+	for _, r := range repos {
+		repoPath, _, err := repoActions.CloneRepository(runCtx, r)
+		if err != nil {
+			return fmt.Errorf("failed to clone %s: %w", r, err)
+		}
+		repoPaths[r] = repoPath
+		overviews = append(overviews, ai.RepoOverview{Repo: r, Overview: repoActions.RepoOverview(repoPath)})
+	}
+
+	plan, err := ai.PlanMultiRepoChanges(runCtx, issue.GetTitle(), issue.GetBody(), overviews)
+	if err != nil {
+		return err
+	}
+	changesets := plan.Changesets
+	if len(changesets) == 0 {
+		return fmt.Errorf("the planner found no repository that needs changes")
+	}
+	slog.InfoContext(logging.For(ctx), "Multi-repo plan ready", "issueNumber", run.IssueNumber, "repos", len(changesets))
+
+	// A plan the planner is unsure of goes to a human before any repository is changed
+	repoCfg, err := config.LoadRepoConfig(repoPaths[run.Repo])
+	if err != nil {
+		return err
+	}
+	run.Confidence = scoreRun(plan.Confidence, nil, repoCfg.Escalation)
+	if run.Confidence != nil && run.Confidence.Escalated {
+		escalateMultiRepoPlan(ctx, run, changesets, repoCfg.Escalation.Reviewers)
+		return nil
+	}
+
+	branchName := fmt.Sprintf("%s%d-%s", cfg.Issues.BranchPrefix, run.IssueNumber, repoActions.SanitizeBranchName(issue.GetTitle()))
+	issueRef := fmt.Sprintf("%s#%d", run.Repo, run.IssueNumber)
+	planned := make([]string, len(changesets))
+	for i, cs := range changesets {
+		planned[i] = cs.Repo
+	}
+
+	prs := make(map[string]*githubapi.PullRequest)
+	for _, cs := range changesets {
+		pr, err := applyRepoChangeset(ctx, cfg, cs, repoPaths[cs.Repo], branchName, issue, issueRef, planned, cs.Repo == run.Repo)
+		if err != nil {
+			slog.ErrorContext(logging.For(ctx), "Failed to apply changeset", "repo", cs.Repo, "error", err)
+			run.Errors = append(run.Errors, fmt.Sprintf("%s: %v", cs.Repo, err))
+			continue
+		}
+		prs[cs.Repo] = pr
+		run.PRs = append(run.PRs, store.RunPR{Repo: cs.Repo, Branch: branchName, Number: pr.Number, URL: pr.HTMLURL})
+		postRunEvent(ctx, runEvent{Event: runEventPROpened, RunID: run.ID, Kind: run.Kind, Repo: run.Repo, IssueNumber: run.IssueNumber, PR: &run.PRs[len(run.PRs)-1]})
+		if err := runs.SaveRun(run); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to save multi-repo run", "run", run.ID, "error", err)
+		}
+	}
+	if len(run.PRs) == 0 {
+		return errors.New("no pull request could be opened in any repository:\n- " + strings.Join(run.Errors, "\n- "))
+	}
+
+	// Now that every PR exists, link each one to its siblings
+	links := linkedPRsMarkdown(run.PRs)
+	for repo, pr := range prs {
+		if err := repoActions.UpdatePullRequestBody(ctx, repo, pr, pr.Body+"\n\n"+links); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to cross-reference linked PRs", "repo", repo, "prNumber", pr.Number, "error", err)
+		}
+	}
+
+	run.Status = store.StatusCompleted
+	if len(run.Errors) > 0 {
+		run.Status = store.StatusPartial
+	}
+	comment := "DevFlow opened linked pull requests for this issue:\n\n" + links
+	if len(run.Errors) > 0 {
+		comment += "\nSome repositories could not be changed:\n\n- " + strings.Join(run.Errors, "\n- ") + "\n"
+	}
+	if err := repoActions.PostIssueComment(ctx, run.Repo, run.IssueNumber, comment); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to post linked PRs comment", "issueNumber", run.IssueNumber, "error", err)
+	}
+	if err := repoActions.SetIssueStatus(ctx, run.Repo, run.IssueNumber, cfg.Issues.StatusLabels.PROpen); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to mark issue PR open", "issueNumber", run.IssueNumber, "error", err)
+	}
+	return nil
+}
+
+// escalateMultiRepoPlan posts the planner's changesets on the issue for the reviewers instead
+// of changing any repository
+func escalateMultiRepoPlan(ctx *probot.Context, run *store.Run, changesets []ai.RepoChangeset, reviewers []string) {
+	slog.InfoContext(logging.For(ctx), "Planner unsure of the multi-repo plan, escalating to a human", "issueNumber", run.IssueNumber,
+		"score", run.Confidence.Score, "threshold", run.Confidence.Threshold)
+	var plan strings.Builder
+	for _, cs := range changesets {
+		plan.WriteString(fmt.Sprintf("### %s\n\n%s\n\n", cs.Repo, cs.Task))
+	}
+	comment := escalationComment("change these repositories", run.Confidence, reviewers, plan.String())
+	if err := repoActions.PostIssueComment(ctx, run.Repo, run.IssueNumber, comment); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to post escalation comment", "issueNumber", run.IssueNumber, "error", err)
+	}
+	if err := repoActions.SetIssueStatus(ctx, run.Repo, run.IssueNumber, ""); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to clear issue status", "issueNumber", run.IssueNumber, "error", err)
+	}
+	run.Status = store.StatusEscalated
+}
+
+// applyRepoChangeset runs the agent on one repository's task and opens its PR
+func applyRepoChangeset(ctx *probot.Context, cfg *config.Config, cs ai.RepoChangeset, repoPath, branchName string, issue *github.Issue, issueRef string, planned []string, isIssueRepo bool) (*githubapi.PullRequest, error) {
+	if repoActions.BranchExists(ctx, cs.Repo, branchName) {
+		return nil, fmt.Errorf("branch %s already exists", branchName)
+	}
+
+	task := &github.Issue{
+		Title: github.String(fmt.Sprintf("%s (%s part)", issue.GetTitle(), cs.Repo)),
+		Body: github.String(fmt.Sprintf("%s\n\n---\nThis is one part of a coordinated change for %s across %s. "+
+			"Only change this repository.\n\nOriginal issue:\n\n%s", cs.Task, issueRef, strings.Join(planned, ", "), issue.GetBody())),
+	}
+	repoCfg, err := config.LoadRepoConfig(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	generation, err := ai.ResolveGenerationSettings(cfg, repoCfg.AI)
+	if err != nil {
+		return nil, err
+	}
+	issueCtx := ai.IssueContext{Generation: &generation}
+	if summaries, err := repoActions.LoadFileSummaries(cfg.GetDevflowPath(repoPath, cfg.Files.MetadataFile)); err == nil {
+		issueCtx.FileSummaries = repoActions.RenderFileSummaries(summaries, task.GetTitle()+"\n"+task.GetBody(), cfg.AI.SummaryContextTokens)
+	}
+
+	result, err := ai.ResolveIssue(logging.For(ctx), repoPath, task, issueCtx)
+	if err != nil {
+		return nil, fmt.Errorf("agent failed: %w", err)
+	}
+
+	allowed, violations := repoActions.FilterByPathPolicy(repoCfg.Paths, result.ChangesMade)
+	var notes []string
+	if len(violations) > 0 {
+		repoActions.RevertPaths(repoPath, pathsOf(violations))
+		notes = append(notes, "### Blocked by path policy\n\n"+repoActions.FormatPathViolations(violations))
+	}
+	if protect := repoCfg.GeneratedFiles.Protect; protect != nil && *protect {
+		kept, generated := repoActions.SplitGeneratedChanges(repoPath, allowed)
+		if len(generated) > 0 {
+			repoActions.RevertPaths(repoPath, generatedPaths(generated))
+			notes = append(notes, repoActions.GeneratedFilesNote(generated))
+			allowed = kept
+		}
+	}
+	repoActions.AddLicenseHeaders(repoPath, repoCfg.LicenseHeaders, allowed)
+	// The task is this repository's plan: only deletions it names are kept
+	allowed, discarded := repoActions.FilterChangeLimits(repoPath, allowed, task.GetBody(), result.Operations)
+	if len(discarded) > 0 {
+		repoActions.RevertPaths(repoPath, pathsOf(discarded))
+		notes = append(notes, "### Discarded by change limits\n\n"+repoActions.FormatPathViolations(discarded))
+	}
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("the agent produced no changes")
+	}
+	if ops := repoActions.FileOperations(repoPath, allowed, result.Operations); len(ops) > 0 {
+		notes = append(notes, "### Deleted and renamed files\n\n"+repoActions.FormatFileOperations(ops))
+	}
+	size := repoActions.MeasureChanges(repoPath, allowed)
+	if refuse, confirm := repoActions.ChangeLimitReasons(size, repoCfg.Limits); refuse != "" {
+		return nil, fmt.Errorf("change limits: %s", refuse)
+	} else if confirm != "" && !hasLabel(issue.Labels, repoCfg.Limits.ConfirmLabel) {
+		return nil, fmt.Errorf("change limits: %s; add the %s label to the issue to allow it", confirm, repoCfg.Limits.ConfirmLabel)
+	}
+
+	title := fmt.Sprintf("[%s] %s", issueRef, issue.GetTitle())
+	body := fmt.Sprintf("Part of a coordinated change for %s.\n\n### Task\n\n%s\n\n### Summary\n\n%s\n\nModified files:\n- %s",
+		issueRef, cs.Task, result.Summary, strings.Join(allowed, "\n- "))
+	body = appendPRNotes(body, notes)
+	if isIssueRepo {
+		body = linkIssues(body, issueLinks(ctx, cs.Repo, issue, repoCfg.Links))
+	}
+	commitMessage := fmt.Sprintf("%s\n\n%s", title, result.Summary)
+	return pushChangesAsPR(ctx, cs.Repo, repoPath, branchName, commitMessage, title, body, allowed)
+}
+
+// linkedPRsMarkdown lists the pull requests of a multi-repo run
+func linkedPRsMarkdown(prs []store.RunPR) string {
+	var b strings.Builder
+	b.WriteString("### Linked pull requests\n\n")
+	for _, pr := range prs {
+		b.WriteString(fmt.Sprintf("- %s#%d (%s)\n", pr.Repo, pr.Number, pr.URL))
+	}
+	return b.String()
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// triageIssue runs the pipeline's triage stage and reports whether the issue says enough to
+// work on. A thin issue gets a comment asking its author for details.
+func triageIssue(ctx *probot.Context, lang, repoName string, issue *github.Issue, stage *config.PipelineStage) bool {
+	body := strings.TrimSpace(issue.GetBody())
+	if len([]rune(body)) >= stage.MinBodyChars {
+		return true
+	}
+	slog.InfoContext(logging.For(ctx), "Issue too thin to work on, asking for details", "issueNumber", issue.GetNumber(), "chars", len([]rune(body)))
+	msg := fmt.Sprintf("@%s, DevFlow needs more to go on before working on this issue. Please describe the expected and the actual behaviour, "+
+		"and add steps to reproduce or the files involved if you know them, then re-apply the trigger label.", issue.GetUser().GetLogin())
+	if err := repoActions.PostIssueComment(ctx, repoName, issue.GetNumber(), localize(lang, msg)); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to post triage comment", "issueNumber", issue.GetNumber(), "error", err)
+	}
+	return false
+}
+
+// issueOnlyContext is the context of a run without the knowledge base, which is all the agent
+// gets when the pipeline skips analysis
+func issueOnlyContext(cfg *config.Config, repoName string, issue *github.Issue) ai.IssueContext {
+	issueCtx := ai.IssueContext{PromptVariants: ai.AssignPromptVariants(cfg, repoName, issue.GetNumber())}
+	for _, v := range issueCtx.PromptVariants {
+		slog.Info("Prompt variant assigned", "experiment", v.Experiment, "variant", v.Variant, "issueNumber", issue.GetNumber())
+	}
+	if hasLabel(issue.Labels, cfg.Issues.DocsLabel) {
+		issueCtx.Mode = "docs"
+	}
+	return issueCtx
+}
+
+// runPipelineGates runs the pipeline's stages between the agent's changes and their pull
+// request, and reports whether the pull request may be opened. plan-approval posts the plan
+// until the issue has the approval label, test runs the tests on the changes and, without a
+// pr stage, the changes are posted on the issue instead. Every stop leaves a comment.
+func runPipelineGates(ctx *probot.Context, cfg *config.Config, lang, repoName, repoPath string, issue *github.Issue, pipeline *config.PipelineConfig, result *ai.PythonAgentResult, prNotes *[]string) bool {
+	issueNumber := issue.GetNumber()
+	post := func(msg string) {
+		if err := repoActions.PostIssueComment(ctx, repoName, issueNumber, localize(lang, msg)); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to post pipeline comment", "issueNumber", issueNumber, "error", err)
+		}
+	}
+
+	if stage := pipeline.Stage(config.StagePlanApproval); stage != nil && !hasLabel(issue.Labels, stage.Label) {
+		slog.InfoContext(logging.For(ctx), "Waiting for plan approval", "issueNumber", issueNumber, "label", stage.Label)
+		var b strings.Builder
+		b.WriteString("This repository's pipeline asks for a plan to be approved before DevFlow opens a pull request. Here is its plan.\n\n")
+		b.WriteString(renderRunPlan(repoPath, result))
+		b.WriteString("\n")
+		if len(stage.Reviewers) > 0 {
+			b.WriteString(mentionAll(stage.Reviewers) + ", could you review this plan? ")
+		}
+		b.WriteString(fmt.Sprintf("Add the `%s` label to this issue to approve it; DevFlow then runs again and opens the pull request.", stage.Label))
+		post(b.String())
+		return false
+	}
+
+	if stage := pipeline.Stage(config.StageTest); stage != nil {
+		command := stage.Command
+		if command == "" {
+			command = cfg.Agent.TestCommand
+		}
+		seconds := stage.TimeoutSeconds
+		if seconds == 0 {
+			seconds = cfg.Timeouts.TestsSeconds
+		}
+		status, output, passed := runTestCommand(repoPath, command, seconds)
+		slog.InfoContext(logging.For(ctx), "Pipeline tests finished", "issueNumber", issueNumber, "passed", passed)
+		if !passed && stage.OnFailure == "block" {
+			post("DevFlow did not open a pull request because the tests failed on its changes.\n" + testResultsMarkdown(status, output) +
+				"\nClarify the issue and re-apply the trigger label to run DevFlow again.")
+			return false
+		}
+		*prNotes = append(*prNotes, strings.TrimPrefix(testResultsMarkdown(status, output), "\n"))
+	}
+
+	if !pipeline.Has(config.StagePR) {
+		slog.InfoContext(logging.For(ctx), "Pipeline has no pr stage, posting the changes on the issue", "issueNumber", issueNumber)
+		post("This repository's pipeline stops before pull requests, so here are the changes DevFlow proposes for a human to apply.\n\n" +
+			renderRunPlan(repoPath, result))
+		return false
+	}
+	return true
+}
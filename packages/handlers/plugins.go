@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/plugins"
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// applyPlugins runs the post_process plugins on the agent's changes, then the policy plugins,
+// and reports whether the changes may be published. Files a post-processor touched join the
+// changes when the path policy allows them. Policy errors keep the changes off a pull request
+// and the issue says why; warnings are noted in the pull request. A policy plugin that cannot
+// run fails the run, so a broken check never lets changes through. Each plugin gets the
+// analysis timeout unless its own timeout_seconds is shorter.
+func applyPlugins(ctx *probot.Context, lang, repoName, repoPath string, issue *github.Issue, paths config.PathPolicyConfig, result *ai.PythonAgentResult, prNotes *[]string) (bool, error) {
+	issueNumber := issue.GetNumber()
+	runCtx := logging.For(ctx)
+	run := func(p config.PluginConfig, hook string) (*plugins.Response, error) {
+		stageCtx, cancel := config.StageContext(runCtx, config.GetConfig().Timeouts.AnalysisSeconds)
+		defer cancel()
+		return plugins.Run(stageCtx, p, plugins.Request{Hook: hook, Repo: repoName, RepoPath: repoPath, Files: result.ChangesMade, IssueNumber: issueNumber})
+	}
+
+	for _, p := range plugins.For(config.PluginHookPostProcess, repoName) {
+		resp, err := run(p, config.PluginHookPostProcess)
+		if err != nil {
+			slog.WarnContext(runCtx, "Post-process plugin failed, keeping the changes as they are", "plugin", p.Name, "error", err)
+			continue
+		}
+		var touched []string
+		for _, f := range resp.ChangedFiles {
+			rel := filepath.ToSlash(filepath.Clean(f))
+			if filepath.IsAbs(f) {
+				if r, err := filepath.Rel(repoPath, f); err == nil {
+					rel = filepath.ToSlash(r)
+				}
+			}
+			if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || filepath.IsAbs(rel) || slices.Contains(result.ChangesMade, rel) {
+				continue
+			}
+			touched = append(touched, rel)
+		}
+		allowed, violations := repoActions.FilterByPathPolicy(paths, touched)
+		if len(violations) > 0 {
+			slog.WarnContext(runCtx, "Reverting plugin changes the path policy forbids", "plugin", p.Name, "files", len(violations))
+			repoActions.RevertPaths(repoPath, pathsOf(violations))
+		}
+		result.ChangesMade = append(result.ChangesMade, allowed...)
+		slog.InfoContext(runCtx, "Post-process plugin finished", "plugin", p.Name, "added", len(allowed))
+	}
+
+	var errs, warnings []plugins.Violation
+	for _, p := range plugins.For(config.PluginHookPolicy, repoName) {
+		resp, err := run(p, config.PluginHookPolicy)
+		if err != nil {
+			return false, err
+		}
+		for _, v := range resp.Violations {
+			if v.Severity == plugins.SeverityWarning {
+				warnings = append(warnings, v)
+			} else {
+				errs = append(errs, v)
+			}
+		}
+	}
+	if len(warnings) > 0 {
+		*prNotes = append(*prNotes, "### Policy warnings\n\n"+plugins.FormatViolations(warnings))
+	}
+	if len(errs) == 0 {
+		return true, nil
+	}
+	slog.WarnContext(runCtx, "Changes fail policy checks, not publishing", "issueNumber", issueNumber, "violations", len(errs))
+	msg := "DevFlow did not open a pull request because its changes fail the organization's policy checks:\n\n" + plugins.FormatViolations(errs) +
+		"\nClarify the issue and re-apply the trigger label to run DevFlow again."
+	if err := repoActions.PostIssueComment(ctx, repoName, issueNumber, localize(lang, msg)); err != nil {
+		slog.WarnContext(runCtx, "Failed to post policy check comment", "issueNumber", issueNumber, "error", err)
+	}
+	return false, nil
+}
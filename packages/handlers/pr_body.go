@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// prBodyLimit stays under GitHub's 65536 character limit for PR bodies and comments, leaving
+// room for the closing links and markers added after trimming
+const prBodyLimit = 65000
+
+// overflowNotice ends a description whose overflow was posted as comments
+const overflowNotice = "_The rest of this description is posted in the comments below._"
+
+var (
+	// reasoningBlockPattern matches model reasoning wrapped in tags
+	reasoningBlockPattern = regexp.MustCompile(`(?is)<(thinking|reasoning|scratchpad)>.*?</(?:thinking|reasoning|scratchpad)>\s*`)
+	// editStrategyPattern matches the decision log the automation prompt asks the agent to print
+	editStrategyPattern = regexp.MustCompile(`(?ms)^\s*EDIT_STRATEGY:\s*\{.*?^\}[ \t]*\n?`)
+	// fenceLinePattern matches the lines opening or closing a fenced code block
+	fenceLinePattern = regexp.MustCompile("(?m)^[ \t]*(```|~~~)")
+)
+
+// gatePRBody makes a generated description fit to post: leaked reasoning is removed, code
+// fences and <details> sections are closed, and text beyond pull_requests.body.max_chars is
+// collapsed into a <details> section. What does not fit GitHub's limit even then is returned
+// as overflow, in parts to post as comments. Every issue the body closes or references is
+// still linked from the part that is kept.
+func gatePRBody(body string) (string, []string) {
+	links := bodyLinks(body)
+	body = cleanPRBody(body)
+	maxChars := config.GetConfig().PullRequests.Body.MaxChars
+	if maxChars <= 0 || maxChars > prBodyLimit {
+		maxChars = prBodyLimit
+	}
+
+	var overflow []string
+	if len(body) > maxChars {
+		visible, rest := cutMarkdown(body, maxChars)
+		collapsed := visible + "\n\n<details><summary>Full description (continued)</summary>\n\n" + rest + "\n\n</details>"
+		if len(collapsed) <= prBodyLimit {
+			body = collapsed
+		} else {
+			body = visible + "\n\n" + overflowNotice
+			for rest != "" {
+				var part string
+				part, rest = cutMarkdown(rest, prBodyLimit)
+				overflow = append(overflow, part)
+			}
+		}
+	}
+	return linkIssues(body, links), overflow
+}
+
+// cleanPRBody strips leaked reasoning and balances the markdown that would otherwise swallow
+// the rest of the page
+func cleanPRBody(body string) string {
+	body = reasoningBlockPattern.ReplaceAllString(body, "")
+	body = editStrategyPattern.ReplaceAllString(body, "")
+	body = strings.TrimSpace(body)
+	if len(fenceLinePattern.FindAllString(body, -1))%2 == 1 {
+		body += "\n```"
+	}
+	if open := strings.Count(body, "<details") - strings.Count(body, "</details>"); open > 0 {
+		body += strings.Repeat("\n</details>", open)
+	}
+	return body
+}
+
+// cutMarkdown splits markdown into a head of at most limit bytes, cut at a line break when
+// there is one, and the rest. A code block open at the cut is closed in the head and reopened
+// in the rest, so both render.
+func cutMarkdown(text string, limit int) (string, string) {
+	const fence = "\n```"
+	if len(text) <= limit {
+		return text, ""
+	}
+	limit -= len(fence)
+	cut := strings.LastIndex(text[:limit], "\n")
+	if cut <= 0 {
+		cut = limit
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+	}
+	head, rest := text[:cut], strings.TrimLeft(text[cut:], "\n")
+	if len(fenceLinePattern.FindAllString(head, -1))%2 == 1 {
+		head += fence
+		rest = "```\n" + rest
+	}
+	return head, rest
+}
+
+// openPullRequest gates a generated description, opens the pull request and posts the
+// description's overflow on it
+func openPullRequest(ctx *probot.Context, repoName, branchName, title, body string) (*githubapi.PullRequest, error) {
+	body, overflow := gatePRBody(body)
+	pr, err := repoActions.CreatePullRequest(ctx, repoName, branchName, title, body)
+	if err != nil {
+		return nil, err
+	}
+	postPRBodyOverflow(ctx, repoName, pr.Number, overflow)
+	return pr, nil
+}
+
+// postPRBodyOverflow posts the parts of a description that did not fit the pull request body
+func postPRBodyOverflow(ctx *probot.Context, repoName string, prNumber int, overflow []string) {
+	for i, part := range overflow {
+		header := fmt.Sprintf("**Description, continued (%d/%d)**\n\n", i+1, len(overflow))
+		if err := repoActions.PostIssueComment(ctx, repoName, prNumber, header+part); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to post description overflow", "prNumber", prNumber, "error", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// requestPreview asks the preview hook to deploy a pull request DevFlow opened and adds the
+// URL it answers with to the PR body. It runs in the background so a slow deployment does
+// not hold up the run; failures are only logged.
+func requestPreview(ctx *probot.Context, repoName, branch string, pr *githubapi.PullRequest, issueNumber int) {
+	cfg := config.GetConfig().Previews
+	if !cfg.Enabled || (len(cfg.Repos) > 0 && !slices.Contains(cfg.Repos, repoName)) {
+		return
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+	req := repoActions.PreviewRequest{Repo: repoName, Branch: branch, PRNumber: pr.Number, PRURL: pr.HTMLURL, IssueNumber: issueNumber}
+	go func() {
+		runCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		url, err := repoActions.RequestPreview(runCtx, cfg, req)
+		if err != nil {
+			slog.WarnContext(logging.For(ctx), "Preview hook failed", "prNumber", pr.Number, "error", err)
+			return
+		}
+		if url == "" {
+			slog.InfoContext(logging.For(ctx), "Preview requested, waiting for the hook to report its URL", "prNumber", pr.Number)
+			return
+		}
+		if err := repoActions.SetPreviewURL(ctx, repoName, pr.Number, url); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to add preview URL to PR body", "prNumber", pr.Number, "error", err)
+			return
+		}
+		slog.InfoContext(logging.For(ctx), "Preview URL added to PR body", "prNumber", pr.Number, "url", url)
+	}()
+}
+
+// handlePreviewURL lets a preview hook that deploys asynchronously report the URL later:
+// POST {"url": ...} to /previews/{owner}/{repo}/{number}. The number is the pull request's.
+func handlePreviewURL(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil {
+		http.Error(w, "pull request number must be a number", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.URL == "" {
+		http.Error(w, `expected {"url": "..."}`, http.StatusBadRequest)
+		return
+	}
+	repoName := repoPathValue(r)
+	runs, err := store.Default()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Only pull requests DevFlow opened for an issue can be given a preview
+	run := findRunByPR(runs, repoName, number)
+	if run == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	var event struct {
+		Installation struct {
+			ID int64 `json:"id"`
+		} `json:"installation"`
+	}
+	_ = json.Unmarshal(run.Trigger, &event)
+	ctx, err := previewContext(r.Context(), repoName, event.Installation.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := repoActions.SetPreviewURL(ctx, repoName, number, body.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	slog.Info("Preview URL reported", "repo", repoName, "prNumber", number, "url", body.URL)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findRunByPR returns the issue run that opened the pull request, or nil
+func findRunByPR(runs store.RunStore, repoName string, number int) *store.Run {
+	all, err := runs.ListRuns()
+	if err != nil {
+		return nil
+	}
+	for _, run := range all {
+		for _, pr := range run.PRs {
+			if pr.Repo == repoName && pr.Number == number {
+				return run
+			}
+		}
+	}
+	return nil
+}
+
+// previewContext authenticates as the installation that has access to the repository
+func previewContext(runCtx context.Context, repoName string, installationID int64) (*probot.Context, error) {
+	app, err := repoActions.AppFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if installationID == 0 {
+		installations, err := repoActions.ListInstalledRepositories(runCtx, app)
+		if err != nil {
+			return nil, err
+		}
+		for id, repos := range installations {
+			if slices.Contains(repos, repoName) {
+				installationID = id
+			}
+		}
+	}
+	return repoActions.NewInstallationContext(app, installationID)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"log/slog"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// syncProjectBoard files a newly opened DevFlow PR on the repository's board and in its issue's
+// milestone, and moves the issue to the merged status once the PR merges. Failures are logged:
+// board bookkeeping must not fail the webhook.
+func syncProjectBoard(ctx *probot.Context, ev *github.PullRequestEvent) {
+	cfg := config.GetConfig().Projects
+	if !cfg.Enabled {
+		return
+	}
+	pr := ev.GetPullRequest()
+	issueNumber, ok := issueNumberFromBranch(pr.GetHead().GetRef())
+	if !ok {
+		return
+	}
+	opened := ev.GetAction() == "opened"
+	merged := ev.GetAction() == "closed" && pr.GetMerged()
+	if !opened && !merged {
+		return
+	}
+
+	repoName := ev.GetRepo().GetFullName()
+	board := cfg.Board(repoName)
+	issue, err := repository.GetIssue(ctx, repoName, issueNumber)
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to load issue for project sync", "repo", repoName, "issueNumber", issueNumber, "error", err)
+		return
+	}
+
+	if opened {
+		if cfg.InheritMilestone && issue.Milestone != 0 && pr.Milestone == nil {
+			if err := repository.SetMilestone(ctx, repoName, pr.GetNumber(), issue.Milestone); err != nil {
+				slog.WarnContext(logging.For(ctx), "Failed to inherit issue milestone", "prNumber", pr.GetNumber(), "error", err)
+			}
+		}
+		if board.ProjectID != "" {
+			if err := repository.MoveOnBoard(ctx, board, pr.GetNodeID(), board.PROpenedStatus); err != nil {
+				slog.WarnContext(logging.For(ctx), "Failed to add PR to project", "prNumber", pr.GetNumber(), "error", err)
+			}
+		}
+		return
+	}
+
+	if board.ProjectID != "" && board.MergedStatus != "" {
+		if err := repository.MoveOnBoard(ctx, board, issue.NodeID, board.MergedStatus); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to move issue on project", "issueNumber", issueNumber, "error", err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// StartProviderReceiver listens for Azure DevOps service hooks and Bitbucket Cloud webhooks.
+// Labeled work items and issues run through the same workflow as GitHub issues.
+func StartProviderReceiver() {
+	cfg := config.GetConfig().Providers
+	mux := http.NewServeMux()
+	if cfg.AzureDevOps.Enabled {
+		client, err := repository.NewAzureDevOpsClient()
+		if err != nil {
+			slog.Error("Cannot start Azure DevOps receiver", "error", err)
+		} else {
+			mux.HandleFunc("POST /azure-devops", azureDevOpsWebhookHandler(client))
+		}
+	}
+	if cfg.Bitbucket.Enabled {
+		client, err := repository.NewBitbucketClient()
+		if err != nil {
+			slog.Error("Cannot start Bitbucket receiver", "error", err)
+		} else {
+			mux.HandleFunc("POST /bitbucket", bitbucketWebhookHandler(client))
+		}
+	}
+	if !cfg.AzureDevOps.Enabled && !cfg.Bitbucket.Enabled {
+		return
+	}
+
+	slog.Info("Provider receiver started", "addr", cfg.ListenAddr)
+	go func() {
+		if err := http.ListenAndServe(cfg.ListenAddr, mux); err != nil {
+			slog.Error("Provider receiver stopped", "error", err)
+		}
+	}()
+}
+
+// azureDevOpsWebhookHandler accepts service hooks authenticated with the basic auth
+// credentials set on the subscription
+func azureDevOpsWebhookHandler(client githubapi.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.GetConfig().Providers.AzureDevOps
+		user, password, ok := r.BasicAuth()
+		expected := os.Getenv(cfg.WebhookPasswordEnv)
+		if !ok || expected == "" || user != cfg.WebhookUser || subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1 {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		ev, err := repository.ParseAzureDevOpsEvent(payload)
+		if err != nil {
+			slog.Warn("Rejected Azure DevOps service hook", "error", err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		dispatchProviderIssueEvent(client, ev)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// bitbucketWebhookHandler accepts webhooks signed with the secret set on the repository
+func bitbucketWebhookHandler(client githubapi.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		secret := os.Getenv(config.GetConfig().Providers.Bitbucket.SecretEnv)
+		if secret == "" || !validBitbucketSignature(r.Header.Get("X-Hub-Signature"), payload, secret) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		eventKey := r.Header.Get("X-Event-Key")
+		if eventKey == "diagnostics:ping" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		ev, err := repository.ParseBitbucketEvent(eventKey, r.Header.Get("X-Request-UUID"), payload)
+		if err != nil {
+			slog.Warn("Rejected Bitbucket webhook", "event", eventKey, "error", err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		dispatchProviderIssueEvent(client, ev)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// validBitbucketSignature checks the sha256=<hex HMAC> signature of a Bitbucket webhook
+func validBitbucketSignature(signature string, payload []byte, secret string) bool {
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// dispatchProviderIssueEvent hands an event that added a required label to the issues
+// handler as a GitHub "labeled" event, with API calls and clones going to the provider
+func dispatchProviderIssueEvent(client githubapi.Client, ev *repository.ProviderIssueEvent) {
+	var trigger string
+	for _, label := range ev.AddedLabels {
+		if hasRequiredLabels([]github.Label{{Name: github.String(label)}}) {
+			trigger = label
+			break
+		}
+	}
+	if trigger == "" {
+		slog.Info("Provider event added no required label - skipping", "repo", ev.RepoName, "issueNumber", ev.Number)
+		return
+	}
+
+	labels := make([]github.Label, len(ev.Labels))
+	for i, name := range ev.Labels {
+		labels[i] = github.Label{Name: github.String(name)}
+	}
+	sender := &github.User{Login: github.String(ev.Sender)}
+	event := &github.IssuesEvent{
+		Action: github.String("labeled"),
+		Label:  &github.Label{Name: github.String(trigger)},
+		Issue: &github.Issue{
+			Number:    github.Int(ev.Number),
+			Title:     github.String(ev.Title),
+			Body:      github.String(ev.Body),
+			Labels:    labels,
+			User:      sender,
+			UpdatedAt: &ev.UpdatedAt,
+		},
+		Repo:   &github.Repository{FullName: github.String(ev.RepoName)},
+		Sender: sender,
+	}
+
+	ctx := repository.NewProviderContext(client, ev.RepoName, ev.CloneURL)
+	ctx.Payload = event
+	if ev.DeliveryID != "" {
+		deliveryIDs.Store(ctx, ev.DeliveryID)
+	}
+	go func(ctx *probot.Context) {
+		defer repository.ReleaseProviderContext(ctx)
+		defer deliveryIDs.Delete(ctx)
+		if err := EventHandlers["issues"](ctx); err != nil {
+			slog.Error("Provider issue event failed", "repo", ev.RepoName, "issueNumber", ev.Number, "error", err)
+		}
+	}(ctx)
+}
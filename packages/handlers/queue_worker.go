@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/queue"
+	"devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// queueWorkerRestartDelay is the pause before a stopped queue consumer reconnects
+const queueWorkerRestartDelay = 10 * time.Second
+
+// EventHandlers maps webhook event types to their handlers. main registers them with probot
+// in inline mode; queue workers dispatch through the same table.
+var EventHandlers = map[string]func(ctx *probot.Context) error{
+	"issues":                    HandleIssues,
+	"issue_comment":             HandleIssueComment,
+	"installation_repositories": HandleInstallations,
+	"pull_request":              HandlePullRequest,
+	"pull_request_review":       HandlePullRequestReview,
+}
+
+// ServeQueueReceiver validates webhook deliveries and publishes them to the configured bus.
+// It blocks serving HTTP on queue.listen_addr.
+func ServeQueueReceiver() error {
+	cfg := config.GetConfig().Queue
+	app, err := repository.AppFromEnv()
+	if err != nil {
+		return err
+	}
+	bus, err := queue.New(cfg)
+	if err != nil {
+		return err
+	}
+	defer bus.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		payload, err := github.ValidatePayload(r, []byte(app.Secret))
+		if err != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		ev := queue.Event{Type: github.WebHookType(r), DeliveryID: github.DeliveryID(r), Payload: payload}
+		if _, ok := EventHandlers[ev.Type]; !ok {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if err := bus.Publish(r.Context(), ev); err != nil {
+			slog.Error("Failed to publish webhook", "event", ev.Type, "delivery", ev.DeliveryID, "error", err)
+			// A 5xx lets the delivery be redelivered from GitHub
+			http.Error(w, "Server Error", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	slog.Info("Webhook receiver publishing to queue", "addr", cfg.ListenAddr, "backend", cfg.Backend)
+	return http.ListenAndServe(cfg.ListenAddr, mux)
+}
+
+// RunQueueWorkers consumes webhook events with queue.workers concurrent consumers and runs
+// them through EventHandlers. A consumer that stops is reconnected after a pause; it blocks
+// until ctx is cancelled.
+func RunQueueWorkers(ctx context.Context) error {
+	cfg := config.GetConfig().Queue
+	app, err := repository.AppFromEnv()
+	if err != nil {
+		return err
+	}
+	workers := max(cfg.Workers, 1)
+
+	// Each consumer gets its own connection so the backend balances events across them
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		bus, err := queue.New(cfg)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for {
+				slog.InfoContext(ctx, "Queue worker started", "worker", worker, "backend", cfg.Backend)
+				err := bus.Consume(ctx, func(ctx context.Context, ev queue.Event) error {
+					return dispatchEvent(app, ev)
+				})
+				bus.Close()
+				if ctx.Err() != nil {
+					return
+				}
+				slog.ErrorContext(ctx, "Queue worker stopped, restarting", "worker", worker, "error", err)
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(queueWorkerRestartDelay):
+					}
+					if bus, err = queue.New(cfg); err == nil {
+						break
+					}
+					slog.ErrorContext(ctx, "Failed to reconnect queue worker", "worker", worker, "error", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// dispatchEvent rebuilds the probot context for a queued event and runs its handler.
+// Handler failures are logged rather than returned: handlers report failures on the issue
+// themselves, and redelivering would repeat that. Only failures to start the handler
+// (e.g. authentication) are returned so the backend can retry.
+func dispatchEvent(app *probot.App, ev queue.Event) error {
+	handler, ok := EventHandlers[ev.Type]
+	if !ok {
+		return nil
+	}
+	payload, err := github.ParseWebHook(ev.Type, ev.Payload)
+	if err != nil {
+		slog.Error("Dropping unparseable event", "event", ev.Type, "delivery", ev.DeliveryID, "error", err)
+		return nil
+	}
+	var inst struct {
+		Installation struct {
+			ID int64 `json:"id"`
+		} `json:"installation"`
+	}
+	_ = json.Unmarshal(ev.Payload, &inst)
+
+	ctx, err := repository.NewInstallationContext(app, inst.Installation.ID)
+	if err != nil {
+		return err
+	}
+	ctx.Payload = payload
+	deliveryIDs.Store(ctx, ev.DeliveryID)
+	defer deliveryIDs.Delete(ctx)
+
+	slog.Info("Handling queued event", "event", ev.Type, "delivery", ev.DeliveryID, "installation", inst.Installation.ID)
+	if err := handler(ctx); err != nil {
+		slog.Error("Queued event handler failed", "event", ev.Type, "delivery", ev.DeliveryID, "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+const (
+	// runSlotPollInterval is how often the issue at the head of a queue tries for a run slot
+	runSlotPollInterval = 5 * time.Second
+	// queueRefreshInterval is how often a queued issue rereads its labels and reactions, so
+	// votes cast while it waits move it up
+	queueRefreshInterval = time.Minute
+)
+
+// errRunConflict is returned by runSlot.Claim when a run started beside the others changed
+// files another run works on, so it must be redone once they finish
+var errRunConflict = errors.New("changes overlap the files of another run of the repository")
+
+// errRunCancelled is returned by acquireRunSlot when the issue was closed while it waited
+var errRunCancelled = errors.New("issue closed while its run was queued")
+
+// closedRunKind marks an issue closed in the run store, so runs of it queued by other worker
+// processes drop out too
+const closedRunKind = "closed"
+
+// queuedRun is an issue waiting for its turn to run
+type queuedRun struct {
+	issueNumber int
+	priority    int      // from issues.queue.priority_labels
+	votes       int      // 👍 reactions
+	files       []string // predicted to change; nil when unknown
+	queuedAt    time.Time
+	cancelled   bool // the issue was closed while it waited
+}
+
+// activeRun is an issue run in progress in this process
+type activeRun struct {
+	issueNumber int
+	files       map[string]bool // predicted or changed; nil when it may change anything
+	parallel    bool            // started beside the runs holding the slots
+}
+
+// runQueues holds this process's waiting issues per repository, in the order they run, and
+// its runs in progress
+var runQueues = struct {
+	sync.Mutex
+	waiting map[string][]*queuedRun
+	active  map[string][]*activeRun
+}{waiting: map[string][]*queuedRun{}, active: map[string][]*activeRun{}}
+
+// runSlot is an issue's turn to run: one of the repository's run slots, or for a parallel
+// run none, while its predicted files overlap no other run's
+type runSlot struct {
+	repoName string
+	lease    *store.Lease
+	run      *activeRun // nil when issues.queue is off
+	released bool
+}
+
+// Claim records the files the run changed. A parallel run fails with errRunConflict when
+// they overlap those of another run; the runs holding slots always go ahead.
+func (s *runSlot) Claim(changed []string) error {
+	if s.run == nil {
+		return nil
+	}
+	runQueues.Lock()
+	defer runQueues.Unlock()
+	if s.run.files == nil {
+		s.run.files = map[string]bool{}
+	}
+	for _, f := range changed {
+		s.run.files[f] = true
+	}
+	if !s.run.parallel {
+		return nil
+	}
+	for _, other := range runQueues.active[s.repoName] {
+		if other != s.run && overlaps(s.run.files, other.files) {
+			return fmt.Errorf("%w: issue #%d", errRunConflict, other.issueNumber)
+		}
+	}
+	return nil
+}
+
+// Release ends the run's turn; later calls do nothing
+func (s *runSlot) Release() {
+	runQueues.Lock()
+	defer runQueues.Unlock()
+	if s.released || s.run == nil {
+		return
+	}
+	s.released = true
+	active := runQueues.active[s.repoName]
+	for i, r := range active {
+		if r == s.run {
+			active = append(active[:i], active[i+1:]...)
+			break
+		}
+	}
+	if len(active) == 0 {
+		delete(runQueues.active, s.repoName)
+	} else {
+		runQueues.active[s.repoName] = active
+	}
+	if s.lease != nil {
+		s.lease.Release()
+	}
+}
+
+// overlaps reports whether two file sets share a file; a nil set may hold any file
+func overlaps(a, b map[string]bool) bool {
+	if a == nil || b == nil {
+		return true
+	}
+	for f := range a {
+		if b[f] {
+			return true
+		}
+	}
+	return false
+}
+
+func fileSet(files []string) map[string]bool {
+	if len(files) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(files))
+	for _, f := range files {
+		set[f] = true
+	}
+	return set
+}
+
+// sortRunQueue orders a queue by priority label, then 👍 reactions, then age
+func sortRunQueue(queue []*queuedRun) {
+	sort.SliceStable(queue, func(i, j int) bool {
+		a, b := queue[i], queue[j]
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		if a.votes != b.votes {
+			return a.votes > b.votes
+		}
+		return a.queuedAt.Before(b.queuedAt)
+	})
+}
+
+// issuePriority returns the highest priority among the issue's labels
+func issuePriority(labels []string, priorities map[string]int) int {
+	priority, found := 0, false
+	for _, name := range labels {
+		if p, ok := priorities[name]; ok && (!found || p > priority) {
+			priority, found = p, true
+		}
+	}
+	return priority
+}
+
+// acquireRunSlot waits for the issue's turn to run among the repository's other issues and
+// returns it; the caller releases it when done. An issue runs once it heads the queue and
+// one of the issues.queue.runs_per_repo slots is free. With parallel_runs, an issue whose
+// predicted files (see repository.PredictIssueFiles) overlap none of the runs in progress or
+// queued ahead of it starts right away in a worktree of its own. While the issue waits, a
+// comment on it reports its place in the queue; the comment is updated when the place
+// changes and once the run starts. The slots are store locks, so the limit holds across
+// replicas; the order and parallel runs are kept per process.
+func acquireRunSlot(ctx *probot.Context, lang, repoName string, issue *github.Issue, files []string) (*runSlot, error) {
+	cfg := config.GetConfig().Issues.Queue
+	if cfg.RunsPerRepo <= 0 {
+		return &runSlot{repoName: repoName}, nil
+	}
+	issueNumber := issue.GetNumber()
+	labels := make([]string, len(issue.Labels))
+	for i, l := range issue.Labels {
+		labels[i] = l.GetName()
+	}
+	run := &queuedRun{
+		issueNumber: issueNumber,
+		priority:    issuePriority(labels, cfg.PriorityLabels),
+		votes:       issue.GetReactions().GetPlusOne(),
+		files:       files,
+		queuedAt:    time.Now(),
+	}
+
+	runQueues.Lock()
+	idle := len(runQueues.waiting[repoName]) == 0
+	runQueues.Unlock()
+	if idle {
+		if slot, err := tryRunSlot(repoName, run, cfg); err != nil || slot != nil {
+			return slot, err
+		}
+	}
+
+	position := joinRunQueue(repoName, run)
+	defer leaveRunQueue(repoName, run)
+	slog.InfoContext(logging.For(ctx), "Issue queued behind other runs of the repository", "issueNumber", issueNumber,
+		"position", position, "priority", run.priority, "votes", run.votes)
+	postRunEvent(ctx, runEvent{Event: runEventQueued, RunID: store.RunID(issueRunKind, repoName, issueNumber), Kind: issueRunKind,
+		Repo: repoName, IssueNumber: issueNumber, Position: position})
+	commentID, err := repoActions.CreateIssueComment(ctx, repoName, issueNumber, localize(lang, queuePositionComment(position, cfg.RunsPerRepo)))
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to post queue position", "issueNumber", issueNumber, "error", err)
+	}
+
+	ticker := time.NewTicker(runSlotPollInterval)
+	defer ticker.Stop()
+	refreshed := time.Now()
+	for range ticker.C {
+		if queuedRunCancelled(run) || issueClosedSince(repoName, issueNumber, run.queuedAt) {
+			slog.InfoContext(logging.For(ctx), "Queued issue was closed, dropping its run", "issueNumber", issueNumber)
+			if commentID != 0 {
+				_ = repoActions.EditIssueComment(ctx, repoName, commentID, localize(lang, "DevFlow dropped this issue from the queue because it was closed."))
+			}
+			return nil, errRunCancelled
+		}
+		if time.Since(refreshed) >= queueRefreshInterval {
+			refreshQueuedRun(ctx, repoName, run, cfg.PriorityLabels)
+			refreshed = time.Now()
+		}
+		slot, err := tryRunSlot(repoName, run, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if slot != nil {
+			slog.InfoContext(logging.For(ctx), "Queued issue starting", "issueNumber", issueNumber,
+				"waited", time.Since(run.queuedAt).Round(time.Second), "parallel", slot.run.parallel)
+			msg := "DevFlow has started working on this issue."
+			if slot.run.parallel {
+				msg = "DevFlow has started working on this issue beside the repository's other runs, which change different files."
+			}
+			if commentID != 0 {
+				_ = repoActions.EditIssueComment(ctx, repoName, commentID, localize(lang, msg))
+			}
+			return slot, nil
+		}
+		current := runQueuePosition(repoName, run)
+		if current != position && commentID != 0 {
+			if err := repoActions.EditIssueComment(ctx, repoName, commentID, localize(lang, queuePositionComment(current, cfg.RunsPerRepo))); err != nil {
+				slog.WarnContext(logging.For(ctx), "Failed to update queue position", "issueNumber", issueNumber, "error", err)
+			}
+		}
+		position = current
+	}
+	return nil, errors.New("run queue stopped")
+}
+
+// queuePositionComment tells an issue's author where the issue stands in its repository's queue
+func queuePositionComment(position, runsPerRepo int) string {
+	return fmt.Sprintf("DevFlow has queued this issue: this repository already has %d issue run(s) in progress. "+
+		"It is **#%d** in the queue, which is ordered by priority label, then 👍 reactions on the issue, then the time it was triggered.",
+		runsPerRepo, position)
+}
+
+// tryRunSlot starts run if it is its turn, returning nil when it must keep waiting
+func tryRunSlot(repoName string, run *queuedRun, cfg config.RunQueueConfig) (*runSlot, error) {
+	if runQueuePosition(repoName, run) <= 1 {
+		lease, err := lockRunSlot(repoName, cfg.RunsPerRepo)
+		if err != nil || lease != nil {
+			if lease == nil {
+				return nil, err
+			}
+			active := &activeRun{issueNumber: run.issueNumber, files: fileSet(run.files)}
+			runQueues.Lock()
+			runQueues.active[repoName] = append(runQueues.active[repoName], active)
+			runQueues.Unlock()
+			return &runSlot{repoName: repoName, lease: lease, run: active}, nil
+		}
+	}
+	if cfg.ParallelRuns <= 0 || len(run.files) == 0 {
+		return nil, nil
+	}
+
+	runQueues.Lock()
+	defer runQueues.Unlock()
+	files := fileSet(run.files)
+	holding, parallel := 0, 0
+	for _, other := range runQueues.active[repoName] {
+		if other.parallel {
+			parallel++
+		} else {
+			holding++
+		}
+		if overlaps(files, other.files) {
+			return nil, nil
+		}
+	}
+	// Slots held by other replicas belong to runs whose files are unknown here
+	if holding < cfg.RunsPerRepo || parallel >= cfg.ParallelRuns {
+		return nil, nil
+	}
+	for _, ahead := range runQueues.waiting[repoName] {
+		if ahead == run {
+			break
+		}
+		if overlaps(files, fileSet(ahead.files)) {
+			return nil, nil
+		}
+	}
+	active := &activeRun{issueNumber: run.issueNumber, files: files, parallel: true}
+	runQueues.active[repoName] = append(runQueues.active[repoName], active)
+	return &runSlot{repoName: repoName, run: active}, nil
+}
+
+// lockRunSlot takes a free run slot of the repository, returning nil when all are taken
+func lockRunSlot(repoName string, slots int) (*store.Lease, error) {
+	locker, err := store.DefaultLocker()
+	if err != nil {
+		return nil, err
+	}
+	for i := range slots {
+		lease, err := locker.TryLock(fmt.Sprintf("run-slot:%s:%d", repoName, i), store.LockTTL())
+		if errors.Is(err, store.ErrLocked) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return lease, nil
+	}
+	return nil, nil
+}
+
+// joinRunQueue adds run to the repository's queue and returns its 1-based position
+func joinRunQueue(repoName string, run *queuedRun) int {
+	runQueues.Lock()
+	defer runQueues.Unlock()
+	runQueues.waiting[repoName] = append(runQueues.waiting[repoName], run)
+	sortRunQueue(runQueues.waiting[repoName])
+	return positionLocked(repoName, run)
+}
+
+func leaveRunQueue(repoName string, run *queuedRun) {
+	runQueues.Lock()
+	defer runQueues.Unlock()
+	queue := runQueues.waiting[repoName]
+	for i, r := range queue {
+		if r == run {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(queue) == 0 {
+		delete(runQueues.waiting, repoName)
+	} else {
+		runQueues.waiting[repoName] = queue
+	}
+}
+
+// cancelQueuedRuns drops the issue's runs waiting in this process's queue of the repository,
+// reporting whether there were any
+func cancelQueuedRuns(repoName string, issueNumber int) bool {
+	runQueues.Lock()
+	defer runQueues.Unlock()
+	cancelled := false
+	for _, r := range runQueues.waiting[repoName] {
+		if r.issueNumber == issueNumber {
+			r.cancelled, cancelled = true, true
+		}
+	}
+	return cancelled
+}
+
+// recordIssueClosed stores that the issue was closed, for issueClosedSince in every process
+func recordIssueClosed(repoName string, issueNumber int) error {
+	runs, err := store.Default()
+	if err != nil {
+		return err
+	}
+	return runs.SaveRun(&store.Run{ID: store.RunID(closedRunKind, repoName, issueNumber), Kind: closedRunKind,
+		Repo: repoName, IssueNumber: issueNumber, Status: store.StatusCancelled})
+}
+
+// issueClosedSince reports whether the issue was closed after since, when its run was queued;
+// a run triggered again after the issue was reopened is not affected by the earlier close
+func issueClosedSince(repoName string, issueNumber int, since time.Time) bool {
+	runs, err := store.Default()
+	if err != nil {
+		return false
+	}
+	closed, err := runs.GetRun(store.RunID(closedRunKind, repoName, issueNumber))
+	return err == nil && closed.UpdatedAt.After(since)
+}
+
+func queuedRunCancelled(run *queuedRun) bool {
+	runQueues.Lock()
+	defer runQueues.Unlock()
+	return run.cancelled
+}
+
+// runQueuePosition re-sorts the repository's queue and returns run's 1-based position, 0
+// when it is not queued
+func runQueuePosition(repoName string, run *queuedRun) int {
+	runQueues.Lock()
+	defer runQueues.Unlock()
+	sortRunQueue(runQueues.waiting[repoName])
+	return positionLocked(repoName, run)
+}
+
+func positionLocked(repoName string, run *queuedRun) int {
+	for i, r := range runQueues.waiting[repoName] {
+		if r == run {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// refreshQueuedRun rereads a queued issue's labels and 👍 reactions. Failures keep the
+// previous values.
+func refreshQueuedRun(ctx *probot.Context, repoName string, run *queuedRun, priorities map[string]int) {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return
+	}
+	client := repoActions.NewGitHubClient(ctx)
+	issue, err := client.GetIssue(context.Background(), owner, repo, run.issueNumber)
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to refresh queued issue", "issueNumber", run.issueNumber, "error", err)
+		return
+	}
+	labels, err := client.ListIssueLabels(context.Background(), owner, repo, run.issueNumber)
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to refresh queued issue labels", "issueNumber", run.issueNumber, "error", err)
+		return
+	}
+	runQueues.Lock()
+	defer runQueues.Unlock()
+	run.votes = issue.ThumbsUp
+	run.priority = issuePriority(labels, priorities)
+}
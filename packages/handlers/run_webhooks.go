@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/store"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// Run lifecycle events posted to run_webhooks
+const (
+	runEventQueued   = "queued"
+	runEventStarted  = "started"
+	runEventPROpened = "pr_opened"
+	runEventFailed   = "failed"
+)
+
+// runEvent is the JSON body of a run webhook
+type runEvent struct {
+	Event       string       `json:"event"`
+	RunID       string       `json:"run_id"`
+	Kind        string       `json:"kind"` // "issue" or "multi_repo"
+	Repo        string       `json:"repo"`
+	IssueNumber int          `json:"issue_number"`
+	Position    int          `json:"position,omitempty"` // queued: place in the repository's queue
+	PR          *store.RunPR `json:"pr,omitempty"`       // pr_opened
+	Error       string       `json:"error,omitempty"`    // failed
+	Timestamp   time.Time    `json:"timestamp"`
+}
+
+// runWebhookPending is how many events a webhook holds while earlier ones are being delivered
+const runWebhookPending = 256
+
+// runWebhookDelivery is an event waiting to be posted to a run webhook
+type runWebhookDelivery struct {
+	logCtx context.Context
+	hook   config.RunWebhookConfig
+	event  string
+	body   []byte
+}
+
+// runWebhookQueues holds each run webhook's pending deliveries by URL. One goroutine per URL
+// posts them, so a webhook receives events in order and a slow one never holds up a run.
+var runWebhookQueues = struct {
+	sync.Mutex
+	byURL map[string]chan runWebhookDelivery
+}{byURL: map[string]chan runWebhookDelivery{}}
+
+var runWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// postRunEvent queues ev for every run webhook subscribed to it and returns without waiting for
+// the deliveries. Failures are logged and never fail the run.
+func postRunEvent(ctx *probot.Context, ev runEvent) {
+	hooks := config.GetConfig().RunWebhooks
+	if len(hooks) == 0 {
+		return
+	}
+	ev.Timestamp = time.Now().UTC()
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	for _, hook := range hooks {
+		if len(hook.Events) > 0 && !slices.Contains(hook.Events, ev.Event) {
+			continue
+		}
+		if len(hook.Repos) > 0 && !slices.ContainsFunc(hook.Repos, func(r string) bool { return strings.EqualFold(r, ev.Repo) }) {
+			continue
+		}
+		if hook.SecretEnv != "" && os.Getenv(hook.SecretEnv) == "" {
+			// The receiver expects signed events; sending unsigned ones would let anyone forge them
+			slog.ErrorContext(logging.For(ctx), "Not posting run webhook: its secret is not set", "event", ev.Event, "url", hook.URL, "secretEnv", hook.SecretEnv)
+			continue
+		}
+		queueRunWebhook(runWebhookDelivery{logCtx: logging.For(ctx), hook: hook, event: ev.Event, body: body})
+	}
+}
+
+// queueRunWebhook adds d to its webhook's queue, starting the webhook's sender on first use.
+// An event that finds the queue full is dropped rather than blocking the run.
+func queueRunWebhook(d runWebhookDelivery) {
+	runWebhookQueues.Lock()
+	queue, ok := runWebhookQueues.byURL[d.hook.URL]
+	if !ok {
+		queue = make(chan runWebhookDelivery, runWebhookPending)
+		runWebhookQueues.byURL[d.hook.URL] = queue
+		go sendRunWebhooks(queue)
+	}
+	runWebhookQueues.Unlock()
+	select {
+	case queue <- d:
+	default:
+		slog.ErrorContext(d.logCtx, "Dropping run webhook: too many deliveries pending", "event", d.event, "url", d.hook.URL)
+	}
+}
+
+// sendRunWebhooks posts a webhook's queued events one at a time
+func sendRunWebhooks(queue <-chan runWebhookDelivery) {
+	for d := range queue {
+		if err := deliverRunEvent(runWebhookClient, d.hook, d.event, d.body); err != nil {
+			slog.WarnContext(d.logCtx, "Failed to post run webhook", "event", d.event, "url", d.hook.URL, "error", err)
+		}
+	}
+}
+
+func deliverRunEvent(client *http.Client, hook config.RunWebhookConfig, event string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-DevFlow-Event", event)
+	if hook.SecretEnv != "" {
+		secret := os.Getenv(hook.SecretEnv)
+		if secret == "" {
+			return fmt.Errorf("%s is not set, refusing to send the event unsigned", hook.SecretEnv)
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-DevFlow-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
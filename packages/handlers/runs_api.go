@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// Runs requested through the runs API; an analysis run answers the issue from the knowledge
+// base without writing to the repository
+const (
+	apiResolveRunKind  = "api_resolve"
+	apiAnalysisRunKind = "api_analysis"
+)
+
+// runRequest is the body of POST /v1/repos/{owner}/{repo}/runs. Either IssueNumber names an
+// existing issue, or Title and Body describe one: a resolve run opens it, an analysis run
+// only reads it. Labels are applied to the run as if the issue carried them, e.g. a mode
+// label, without being added on GitHub.
+type runRequest struct {
+	Mode        string   `json:"mode"` // "resolve" (the default) or "analysis"
+	IssueNumber int      `json:"issue_number"`
+	Title       string   `json:"title"`
+	Body        string   `json:"body"`
+	Labels      []string `json:"labels"`
+}
+
+// apiRun is the runs API view of a run
+type apiRun struct {
+	ID          string        `json:"id"`
+	Repo        string        `json:"repo"`
+	Mode        string        `json:"mode"`
+	IssueNumber int           `json:"issue_number,omitempty"`
+	Status      string        `json:"status"`
+	Stage       string        `json:"stage,omitempty"`
+	PRs         []store.RunPR `json:"prs,omitempty"`
+	Errors      []string      `json:"errors,omitempty"`
+	Answer      string        `json:"answer,omitempty"`
+	LinkedRun   string        `json:"linked_run,omitempty"` // held or skipped: the run holding the issue
+	CreatedAt   string        `json:"created_at"`
+	UpdatedAt   string        `json:"updated_at"`
+}
+
+func newAPIRun(run *store.Run, id string) apiRun {
+	mode := "resolve"
+	if run.Kind == apiAnalysisRunKind {
+		mode = "analysis"
+	}
+	return apiRun{
+		ID:          id,
+		Repo:        run.Repo,
+		Mode:        mode,
+		IssueNumber: run.IssueNumber,
+		Status:      run.Status,
+		Stage:       run.Stage,
+		PRs:         run.PRs,
+		Errors:      run.Errors,
+		Answer:      run.Answer,
+		LinkedRun:   run.LinkedRun,
+		CreatedAt:   run.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:   run.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+// apiRunStoreID is the store ID of a runs API run; the ID callers see is unique only within
+// the repository
+func apiRunStoreID(repoName, id string) string {
+	return "api-" + repoName + "-" + id
+}
+
+// StartRunsAPI serves the runs API on runs_api.listen_addr. Requests must carry one of the
+// keys in DEVFLOW_API_KEYS as a bearer token.
+func StartRunsAPI() {
+	cfg := config.GetConfig().RunsAPI
+	if !cfg.Enabled {
+		return
+	}
+	var keys []string
+	for _, key := range strings.Split(os.Getenv("DEVFLOW_API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		slog.Error("Cannot start runs API: DEVFLOW_API_KEYS is not set")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/repos/{owner}/{repo}/runs", handleCreateRun)
+	mux.HandleFunc("GET /v1/repos/{owner}/{repo}/runs/{id}", handleGetRun)
+	slog.Info("Runs API started", "addr", cfg.ListenAddr)
+	go func() {
+		if err := http.ListenAndServe(cfg.ListenAddr, requireAPIKey(keys, mux)); err != nil {
+			slog.Error("Runs API stopped", "error", err)
+		}
+	}()
+}
+
+func requireAPIKey(keys []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		ok := 0
+		for _, key := range keys {
+			// Every key is compared, so the time taken does not tell which one came close
+			ok |= subtle.ConstantTimeCompare(got, []byte(key))
+		}
+		if ok != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleCreateRun starts a run on the repository in the path and returns its ID with 202;
+// the run continues in the background and is polled through handleGetRun
+func handleCreateRun(w http.ResponseWriter, r *http.Request) {
+	repoName := repoPathValue(r)
+	var req runRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	kind := apiResolveRunKind
+	switch req.Mode {
+	case "", "resolve":
+	case "analysis":
+		kind = apiAnalysisRunKind
+	default:
+		http.Error(w, `mode must be "resolve" or "analysis"`, http.StatusBadRequest)
+		return
+	}
+	if req.IssueNumber == 0 && strings.TrimSpace(req.Title) == "" {
+		http.Error(w, "issue_number or title is required", http.StatusBadRequest)
+		return
+	}
+	runs, err := store.Default()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx, installationID, ok := repoInstallationContext(w, r, repoName)
+	if !ok {
+		return
+	}
+
+	if req.IssueNumber != 0 {
+		issue, err := repoActions.GetIssue(ctx, repoName, req.IssueNumber)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		} else if issue.IsPullRequest {
+			http.Error(w, "issue_number names a pull request", http.StatusBadRequest)
+			return
+		}
+		req.Title, req.Body = issue.Title, issue.Body
+	} else if kind == apiResolveRunKind {
+		// The pipeline reports on and links its pull request to an issue, so the text gets one
+		issue, err := repoActions.CreateIssue(ctx, repoName, req.Title, req.Body, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		req.IssueNumber = issue.Number
+	}
+
+	id := newAPIRunID()
+	run := &store.Run{ID: apiRunStoreID(repoName, id), Kind: kind, Repo: repoName, IssueNumber: req.IssueNumber, Status: store.StatusRunning}
+	if err := runs.SaveRun(run); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logging.Bind(ctx, "run_id", run.ID)
+	slog.InfoContext(logging.For(ctx), "Run requested through the runs API", "repo", repoName, "kind", kind, "issueNumber", req.IssueNumber)
+
+	resp := newAPIRun(run, id)
+	go func() {
+		if kind == apiAnalysisRunKind {
+			finishAPIRun(ctx, runs, run, analyzeAPIRun(run, req))
+			return
+		}
+		finishAPIRun(ctx, runs, run, resolveAPIRun(ctx, runs, run, req, installationID))
+	}()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleGetRun returns the status of a run started through the runs API
+func handleGetRun(w http.ResponseWriter, r *http.Request) {
+	runs, err := store.Default()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id := r.PathValue("id")
+	run, err := runs.GetRun(apiRunStoreID(repoPathValue(r), id))
+	if errors.Is(err, store.ErrRunNotFound) || (err == nil && run.Kind != apiResolveRunKind && run.Kind != apiAnalysisRunKind) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newAPIRun(run, id))
+}
+
+// resolveAPIRun runs the issue workflow as a labeling would, then takes the outcome, pull
+// requests included, from the issue's run. A workflow that did not run the agent leaves the
+// run held, when the repository's schedule holds the trigger, or skipped, linked to the
+// issue's run when another worker has it.
+func resolveAPIRun(ctx *probot.Context, runs store.RunStore, run *store.Run, req runRequest, installationID int64) error {
+	labels := make([]github.Label, len(req.Labels))
+	for i, name := range req.Labels {
+		labels[i] = github.Label{Name: github.String(name)}
+	}
+	ctx.Payload = &github.IssuesEvent{
+		Action: github.String("labeled"),
+		Issue: &github.Issue{
+			Number: github.Int(req.IssueNumber),
+			Title:  github.String(req.Title),
+			Body:   github.String(req.Body),
+			Labels: labels,
+		},
+		Repo:         &github.Repository{FullName: github.String(run.Repo)},
+		Installation: &github.Installation{ID: github.Int64(installationID)},
+	}
+	if err := runIssueWorkflow(ctx, run.Repo, req.IssueNumber, req.Title, nil); err != nil {
+		return err
+	}
+
+	issueRun, err := runs.GetRun(store.RunID(issueRunKind, run.Repo, req.IssueNumber))
+	if err == nil && !issueRun.UpdatedAt.Before(run.CreatedAt) {
+		run.Status, run.Stage, run.PRs = issueRun.Status, issueRun.Stage, issueRun.PRs
+		run.Errors = append(run.Errors, issueRun.Errors...)
+		return nil
+	}
+
+	held, hErr := runs.GetRun(store.RunID(heldRunKind, run.Repo, req.IssueNumber))
+	switch {
+	case hErr == nil && held.Status == store.StatusHeld && !held.UpdatedAt.Before(run.CreatedAt):
+		run.Status, run.LinkedRun = store.StatusHeld, held.ID
+	case err == nil && issueRun.Status == store.StatusRunning:
+		run.Status, run.LinkedRun = store.StatusSkipped, issueRun.ID
+		run.Errors = append(run.Errors, "the issue is already being worked on by another run")
+	default:
+		// Pre-flight, scope and limit checks explain themselves on the issue
+		run.Status = store.StatusSkipped
+		run.Errors = append(run.Errors, "the issue workflow stopped before the agent ran; see the issue's comments")
+	}
+	return nil
+}
+
+// analyzeAPIRun answers the issue from the repository's knowledge base
+func analyzeAPIRun(run *store.Run, req runRequest) error {
+	answer, _, err := answerRepoQuestion(run.Repo, strings.TrimSpace(req.Title+"\n\n"+req.Body))
+	if err != nil {
+		return err
+	}
+	run.Answer = answer
+	return nil
+}
+
+// finishAPIRun records the outcome of a runs API run
+func finishAPIRun(ctx *probot.Context, runs store.RunStore, run *store.Run, err error) {
+	switch {
+	case err != nil:
+		slog.ErrorContext(logging.For(ctx), "Runs API run failed", "run", run.ID, "error", err)
+		run.Status = store.StatusFailed
+		run.Errors = append(run.Errors, err.Error())
+	case run.Status == store.StatusRunning:
+		run.Status = store.StatusCompleted
+	}
+	if sErr := runs.SaveRun(run); sErr != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to save runs API run", "run", run.ID, "error", sErr)
+	}
+}
+
+func newAPIRunID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// repoInstallationContext returns a context authenticated as the app's installation on a
+// repository, and the installation's ID, writing the error response when there is none
+func repoInstallationContext(w http.ResponseWriter, r *http.Request, repoName string) (*probot.Context, int64, bool) {
+	app, err := repoActions.AppFromEnv()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, 0, false
+	}
+	installations, err := repoActions.ListInstalledRepositories(r.Context(), app)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, 0, false
+	}
+	var installationID int64
+	for id, repos := range installations {
+		if slices.Contains(repos, repoName) {
+			installationID = id
+		}
+	}
+	if installationID == 0 {
+		http.Error(w, "the app is not installed on "+repoName, http.StatusNotFound)
+		return nil, 0, false
+	}
+	ctx, err := repoActions.NewInstallationContext(app, installationID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, 0, false
+	}
+	return ctx, installationID, true
+}
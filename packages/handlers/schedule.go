@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// heldRunKind is the run kind of triggers held by a repository's schedule
+const heldRunKind = "held"
+
+// scheduleHoldReason returns why a repository's schedule holds a trigger at now, or "" when
+// it may run
+func scheduleHoldReason(sched config.ScheduleConfig, repoName string, now time.Time) (string, error) {
+	loc, err := time.LoadLocation(sched.Timezone)
+	if err != nil {
+		return "", fmt.Errorf("invalid schedule timezone %q: %w", sched.Timezone, err)
+	}
+	local := now.In(loc)
+
+	if len(sched.WorkingDays) > 0 {
+		day := strings.ToLower(local.Weekday().String()[:3])
+		if !slices.ContainsFunc(sched.WorkingDays, func(d string) bool { return strings.HasPrefix(strings.ToLower(d), day) }) {
+			return "outside working days", nil
+		}
+	}
+	if sched.WorkingHours != "" {
+		start, end, err := parseWorkingHours(sched.WorkingHours)
+		if err != nil {
+			return "", err
+		}
+		minute := local.Hour()*60 + local.Minute()
+		// A range such as 22:00-06:00 spans midnight
+		inside := minute >= start && minute < end
+		if start > end {
+			inside = minute >= start || minute < end
+		}
+		if !inside {
+			return "outside working hours", nil
+		}
+	}
+	if sched.MaxRunsPerDay > 0 {
+		usage, err := store.DefaultUsage()
+		if err != nil {
+			return "", err
+		}
+		today, err := usage.GetUsage(store.UsageByDay, dailyUsageKey(repoName, local))
+		if err != nil {
+			return "", err
+		}
+		if today.Counters[store.UsageRuns] >= int64(sched.MaxRunsPerDay) {
+			return fmt.Sprintf("daily limit of %d runs reached", sched.MaxRunsPerDay), nil
+		}
+	}
+	return "", nil
+}
+
+// parseWorkingHours parses "HH:MM-HH:MM" into minutes since midnight
+func parseWorkingHours(hours string) (int, int, error) {
+	from, to, ok := strings.Cut(hours, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid working hours %q, expected HH:MM-HH:MM", hours)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid working hours %q: %w", hours, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid working hours %q: %w", hours, err)
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
+}
+
+// dailyUsageKey is the usage key counting a repository's runs on the day of t
+func dailyUsageKey(repoName string, t time.Time) string {
+	return repoName + "/" + t.Format("2006-01-02")
+}
+
+// countScheduledRun counts a run against the repository's daily limit
+func countScheduledRun(ctx *probot.Context, repoName string, sched config.ScheduleConfig) {
+	if sched.MaxRunsPerDay <= 0 {
+		return
+	}
+	loc, err := time.LoadLocation(sched.Timezone)
+	if err != nil {
+		return
+	}
+	usage, err := store.DefaultUsage()
+	if err == nil {
+		err = usage.IncrUsage(store.UsageByDay, dailyUsageKey(repoName, time.Now().In(loc)), map[string]int64{store.UsageRuns: 1})
+	}
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to count run against the daily limit", "repo", repoName, "error", err)
+	}
+}
+
+// holdForSchedule saves an issue trigger the repository's schedule does not allow yet, so
+// the held trigger releaser handles it later. An invalid schedule never holds anything.
+func holdForSchedule(ctx *probot.Context, event *github.IssuesEvent, repoName string, sched config.ScheduleConfig) (bool, error) {
+	issueNumber := event.Issue.GetNumber()
+	reason, err := scheduleHoldReason(sched, repoName, time.Now())
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Ignoring invalid schedule", "repo", repoName, "error", err)
+		return false, nil
+	}
+	if reason == "" {
+		return false, nil
+	}
+	// Only installation events can be replayed with fresh credentials
+	if event.GetInstallation().GetID() == 0 {
+		slog.WarnContext(logging.For(ctx), "Cannot hold a trigger without an installation, running it now", "issueNumber", issueNumber, "reason", reason)
+		return false, nil
+	}
+
+	runs, err := store.Default()
+	if err != nil {
+		return false, err
+	}
+	trigger, err := json.Marshal(event)
+	if err != nil {
+		return false, err
+	}
+	id := store.RunID(heldRunKind, repoName, issueNumber)
+	run, err := runs.GetRun(id)
+	alreadyHeld := err == nil && run.Status == store.StatusHeld
+	if err != nil && !errors.Is(err, store.ErrRunNotFound) {
+		return false, err
+	}
+	if !alreadyHeld {
+		run = &store.Run{ID: id, Kind: heldRunKind, Repo: repoName, IssueNumber: issueNumber}
+	}
+	run.Status = store.StatusHeld
+	run.Trigger = trigger
+	if err := runs.SaveRun(run); err != nil {
+		return false, err
+	}
+	slog.InfoContext(logging.For(ctx), "Holding issue trigger until the repository's schedule allows it", "issueNumber", issueNumber, "reason", reason)
+
+	if !alreadyHeld {
+		lang := issueLanguage(ctx, repoName, event.Issue)
+		msg := fmt.Sprintf("DevFlow will start on this issue later: this repository's schedule does not allow it right now (%s).", reason)
+		if err := repoActions.PostIssueComment(ctx, repoName, issueNumber, localize(lang, msg)); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to comment on held issue", "issueNumber", issueNumber, "error", err)
+		}
+	}
+	return true, nil
+}
+
+// StartHeldTriggerReleaser periodically hands held triggers back to the issues handler, which
+// runs them if the schedule now allows it and holds them again otherwise
+func StartHeldTriggerReleaser() {
+	interval := time.Duration(config.GetConfig().Issues.HeldCheckMinutes) * time.Minute
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			releaseHeldTriggers()
+		}
+	}()
+}
+
+// releaseHeldTriggers replays every held trigger, oldest first
+func releaseHeldTriggers() {
+	runs, err := store.Default()
+	if err != nil {
+		slog.Error("Cannot release held triggers", "error", err)
+		return
+	}
+	all, err := runs.ListRuns()
+	if err != nil {
+		slog.Error("Failed to list held triggers", "error", err)
+		return
+	}
+	var held []*store.Run
+	for _, run := range all {
+		if run.Kind == heldRunKind && run.Status == store.StatusHeld {
+			held = append(held, run)
+		}
+	}
+	if len(held) == 0 {
+		return
+	}
+	sort.Slice(held, func(i, j int) bool { return held[i].CreatedAt.Before(held[j].CreatedAt) })
+
+	app, err := repoActions.AppFromEnv()
+	if err != nil {
+		slog.Error("Cannot release held triggers", "error", err)
+		return
+	}
+	for _, run := range held {
+		if err := releaseHeldTrigger(app, runs, run); err != nil {
+			slog.Error("Failed to release held trigger", "repo", run.Repo, "issueNumber", run.IssueNumber, "error", err)
+		}
+	}
+}
+
+// releaseHeldTrigger replays one held trigger with the issue's current state and labels. The
+// run is marked released unless the handler held it again.
+func releaseHeldTrigger(app *probot.App, runs store.RunStore, run *store.Run) error {
+	var event github.IssuesEvent
+	if err := json.Unmarshal(run.Trigger, &event); err != nil {
+		return fmt.Errorf("invalid held trigger: %w", err)
+	}
+	ctx, err := repoActions.NewInstallationContext(app, event.GetInstallation().GetID())
+	if err != nil {
+		return err
+	}
+	owner, repo, err := githubapi.SplitRepoName(run.Repo)
+	if err != nil {
+		return err
+	}
+
+	client := repoActions.NewGitHubClient(ctx)
+	issue, err := client.GetIssue(context.Background(), owner, repo, run.IssueNumber)
+	if err != nil {
+		return err
+	}
+	labels, err := client.ListIssueLabels(context.Background(), owner, repo, run.IssueNumber)
+	if err != nil {
+		return err
+	}
+	held := run.UpdatedAt
+	if issue.State == "open" {
+		event.Issue.State = github.String(issue.State)
+		event.Issue.Labels = nil
+		for _, name := range labels {
+			event.Issue.Labels = append(event.Issue.Labels, github.Label{Name: github.String(name)})
+		}
+		ctx.Payload = &event
+		slog.Info("Releasing held issue trigger", "repo", run.Repo, "issueNumber", run.IssueNumber)
+		if err := EventHandlers["issues"](ctx); err != nil {
+			slog.Error("Held issue trigger failed", "repo", run.Repo, "issueNumber", run.IssueNumber, "error", err)
+		}
+	}
+
+	current, err := runs.GetRun(run.ID)
+	if err != nil {
+		return err
+	}
+	if current.Status == store.StatusHeld && current.UpdatedAt.Equal(held) {
+		current.Status = store.StatusReleased
+		return runs.SaveRun(current)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/repository"
+	"devflow-agent/packages/upgrades"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// StartSecurityAlertReceiver listens for dependabot_alert and repository_vulnerability_alert
+// webhooks, which probot's event parser does not support, and remediates them in the background
+func StartSecurityAlertReceiver() {
+	cfg := config.GetConfig().SecurityAlerts
+	if !cfg.Enabled {
+		return
+	}
+	app, err := repository.AppFromEnv()
+	if err != nil {
+		slog.Error("Cannot start security alert receiver", "error", err)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", securityAlertHandler(app))
+	slog.Info("Security alert receiver started", "addr", cfg.ListenAddr)
+	go func() {
+		if err := http.ListenAndServe(cfg.ListenAddr, mux); err != nil {
+			slog.Error("Security alert receiver stopped", "error", err)
+		}
+	}()
+}
+
+func securityAlertHandler(app *probot.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := github.ValidatePayload(r, []byte(app.Secret))
+		if err != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		eventType := github.WebHookType(r)
+		if eventType == "ping" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		alert, err := repository.ParseSecurityAlert(eventType, payload)
+		if err != nil {
+			slog.Warn("Rejected security alert webhook", "event", eventType, "error", err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if alert == nil || !severityAccepted(alert.Advisory.Severity) {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		ctx, err := repository.NewInstallationContext(app, alert.InstallationID)
+		if err != nil {
+			slog.Error("Failed to authenticate installation", "installationID", alert.InstallationID, "error", err)
+			http.Error(w, "Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !eventAllowed(ctx, alert.RepoName, eventType, "") {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		go func() {
+			if err := RemediateSecurityAlert(ctx, alert.RepoName, alert.Advisory); err != nil {
+				slog.Error("Security alert remediation failed", "repo", alert.RepoName, "advisory", alert.Advisory.ID(), "error", err)
+			}
+		}()
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// severityAccepted reports whether alerts of this severity should be remediated
+func severityAccepted(severity string) bool {
+	accepted := config.GetConfig().SecurityAlerts.Severities
+	if len(accepted) == 0 {
+		return true
+	}
+	for _, s := range accepted {
+		if strings.EqualFold(s, severity) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemediateSecurityAlert opens a fix PR for a vulnerability alert. It bumps the package to the
+// first patched version when the ecosystem is supported, and falls back to the agent when no
+// bump applies or the bump breaks the tests (e.g. the vulnerable API is used directly).
+func RemediateSecurityAlert(ctx *probot.Context, repoName string, adv repository.SecurityAdvisory) error {
+	cfg := config.GetConfig()
+	branchName := cfg.SecurityAlerts.BranchPrefix + repository.SanitizeBranchName(adv.ID())
+	if repository.BranchExists(ctx, repoName, branchName) {
+		slog.InfoContext(logging.For(ctx), "Security fix branch already exists", "repo", repoName, "branch", branchName)
+		return nil
+	}
+
+	runCtx := logging.For(ctx)
+	repoPath, _, err := repository.CloneRepository(runCtx, repoName)
+	if err != nil {
+		return fmt.Errorf("failed to clone repository: %w", err)
+	}
+	defer func() { _ = repository.CleanupRepo(repoPath) }()
+
+	var remediation []string
+	bumped := false
+	if u, ok := advisoryUpgrade(adv); ok {
+		if err := upgrades.Apply(runCtx, repoPath, u); err != nil {
+			slog.WarnContext(logging.For(ctx), "Automatic security bump failed", "advisory", adv.ID(), "error", err)
+			revertWorkingTree(repoPath)
+		} else {
+			bumped = true
+			remediation = append(remediation, fmt.Sprintf("Bumped `%s` to the first patched version `%s`.", u.Name, u.Latest))
+		}
+	}
+	testStatus, testOutput, testsPassed := runUpgradeTests(cfg, repoPath)
+
+	if cfg.SecurityAlerts.UseAgent && (!bumped || !testsPassed) {
+		issue := advisoryIssue(adv, bumped, testOutput)
+		result, err := ai.ResolveIssue(runCtx, repoPath, issue, ai.IssueContext{})
+		if err != nil {
+			if !bumped {
+				return fmt.Errorf("agent failed to remediate advisory: %w", err)
+			}
+			slog.WarnContext(logging.For(ctx), "Agent failed to fix code after security bump", "advisory", adv.ID(), "error", err)
+		} else if result.Summary != "" {
+			remediation = append(remediation, result.Summary)
+		}
+		testStatus, testOutput, _ = runUpgradeTests(cfg, repoPath)
+	}
+
+	changed, err := upgrades.ChangedFiles(repoPath)
+	if err != nil {
+		return err
+	}
+	repoCfg, err := config.LoadRepoConfig(repoPath)
+	if err != nil {
+		return err
+	}
+	allowed, violations := repository.FilterByPathPolicy(repoCfg.Paths, changed)
+	if len(violations) > 0 {
+		repository.RevertPaths(repoPath, pathsOf(violations))
+		remediation = append(remediation, "Changes blocked by the repository's path policy were discarded:\n\n"+
+			repository.FormatPathViolations(violations))
+	}
+	if len(allowed) == 0 {
+		return fmt.Errorf("no remediation changes produced for %s", adv.ID())
+	}
+
+	title := fmt.Sprintf("Fix %s severity advisory %s in %s", strings.ToLower(adv.Severity), adv.ID(), adv.Package)
+	body := securityPRBody(adv, remediation, allowed, testStatus, testOutput)
+	_, err = pushChangesAsPR(ctx, repoName, repoPath, branchName, title, title, body, allowed)
+	return err
+}
+
+// advisoryUpgrade maps an advisory onto a version bump the upgrades planner can apply
+func advisoryUpgrade(adv repository.SecurityAdvisory) (upgrades.Upgrade, bool) {
+	if adv.PatchedVersion == "" || adv.Manifest == "" || adv.Package == "" {
+		return upgrades.Upgrade{}, false
+	}
+	u := upgrades.Upgrade{Ecosystem: adv.Ecosystem, Manifest: adv.Manifest, Name: adv.Package, Current: adv.VulnerableRange, Latest: adv.PatchedVersion}
+	switch adv.Ecosystem {
+	case upgrades.EcosystemGo:
+		if !strings.HasPrefix(u.Latest, "v") {
+			u.Latest = "v" + u.Latest
+		}
+	case upgrades.EcosystemNPM, upgrades.EcosystemPython:
+	default:
+		return upgrades.Upgrade{}, false
+	}
+	return u, true
+}
+
+// advisoryIssue phrases the advisory as an issue for the agent
+func advisoryIssue(adv repository.SecurityAdvisory, bumped bool, testOutput string) *github.Issue {
+	var body strings.Builder
+	body.WriteString(adv.Markdown())
+	body.WriteString("\n### Task\n\n")
+	if bumped {
+		body.WriteString(fmt.Sprintf("`%s` has already been bumped to `%s`, but the tests fail afterwards. "+
+			"Update the code that uses the package so it works with the patched version. Do not downgrade the package.\n", adv.Package, adv.PatchedVersion))
+		if testOutput != "" {
+			body.WriteString("\nTest output:\n\n```\n" + testOutput + "\n```\n")
+		}
+	} else {
+		body.WriteString("Remediate this vulnerability. Upgrade the affected package in its manifest and lockfile if a patched " +
+			"version exists; otherwise change the code so it no longer uses the vulnerable API, or guards against the attack.\n")
+	}
+	return &github.Issue{
+		Title: github.String(fmt.Sprintf("Security advisory %s in %s", adv.ID(), adv.Package)),
+		Body:  github.String(body.String()),
+	}
+}
+
+func securityPRBody(adv repository.SecurityAdvisory, remediation, changed []string, testStatus, testOutput string) string {
+	var b strings.Builder
+	b.WriteString(adv.Markdown())
+	b.WriteString("\n### Remediation\n\n")
+	for _, r := range remediation {
+		b.WriteString(r + "\n\n")
+	}
+	b.WriteString("### Changed files\n\n")
+	for _, f := range changed {
+		b.WriteString(fmt.Sprintf("- `%s`\n", f))
+	}
+	b.WriteString(testResultsMarkdown(testStatus, testOutput))
+	b.WriteString("\n---\n*Opened automatically by DevFlow in response to a security alert.*\n")
+	return b.String()
+}
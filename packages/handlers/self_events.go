@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"log/slog"
+	"slices"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// ownEventsHandled lists the event actions DevFlow still handles when it caused them itself:
+// issues it opens from discussions are resolved through the issues handler, and its own pull
+// requests feed the project board and usage records
+var ownEventsHandled = map[string][]string{
+	"issues":       {"opened", "labeled"},
+	"pull_request": {"opened", "closed"},
+}
+
+func init() {
+	// Every entry point (probot, queue workers, Actions) dispatches through this table
+	for event, handler := range EventHandlers {
+		EventHandlers[event] = withLogContext(event, ignoreOwnEvents(event, withEventPolicy(event, handler)))
+	}
+}
+
+// ignoreOwnEvents wraps a handler so events sent by DevFlow's own bot account are dropped,
+// apart from those in ownEventsHandled
+func ignoreOwnEvents(event string, handler func(ctx *probot.Context) error) func(ctx *probot.Context) error {
+	return func(ctx *probot.Context) error {
+		sender, ok := ctx.Payload.(interface{ GetSender() *github.User })
+		if !ok || !repository.IsBotLogin(sender.GetSender().GetLogin()) {
+			return handler(ctx)
+		}
+		action := ""
+		if a, ok := ctx.Payload.(interface{ GetAction() string }); ok {
+			action = a.GetAction()
+		}
+		if slices.Contains(ownEventsHandled[event], action) {
+			return handler(ctx)
+		}
+		slog.InfoContext(logging.For(ctx), "Ignoring event DevFlow caused itself", "event", event, "action", action, "sender", sender.GetSender().GetLogin())
+		return nil
+	}
+}
+
+// isOwnPush reports whether every commit of a push was made by DevFlow, such as the
+// knowledge base commits a direct sync pushes to main
+func isOwnPush(ev *github.PushEvent) bool {
+	if repository.IsBotLogin(ev.GetSender().GetLogin()) {
+		return true
+	}
+	if len(ev.Commits) == 0 {
+		return false
+	}
+	for _, c := range ev.Commits {
+		if !repository.IsBotCommitAuthor(c.GetAuthor().GetName(), c.GetAuthor().GetEmail()) {
+			return false
+		}
+	}
+	return true
+}
+
+// isOwnKnowledgeBasePR reports whether a pull request is one DevFlow opened to add or update
+// the knowledge base, whose merge needs no sync
+func isOwnKnowledgeBasePR(pr *github.PullRequest) bool {
+	cfg := config.GetConfig().Installations
+	head := pr.GetHead().GetRef()
+	return repository.IsBotLogin(pr.GetUser().GetLogin()) &&
+		(head == cfg.KnowledgeBaseBranch || head == cfg.InitBranch || head == config.GetConfig().KnowledgeBase.SyncBranch)
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+	"gopkg.in/yaml.v3"
+)
+
+// Autonomy levels offered by the setup issue, from the most cautious
+const (
+	autonomyPlan   = "plan"   // plan-approval stage before pull requests
+	autonomyReview = "review" // pull requests people review and merge
+	autonomyMerge  = "merge"  // pull requests that merge themselves
+)
+
+// setupItemPattern matches a checklist item of the setup issue with its hidden key, such as
+// "- [x] `docs/**` <!-- deny:docs/** -->"
+var setupItemPattern = regexp.MustCompile(`(?m)^\s*[-*] \[([ xX])\] .*<!-- ([a-z]+)(?::(.*?))? -->\s*$`)
+
+// setupChoices is what the checked boxes of a setup issue ask for
+type setupChoices struct {
+	Labels   []string
+	Autonomy string
+	Deny     []string
+	Channel  string
+	Apply    bool
+}
+
+// openSetupIssue opens the setup issue on a newly installed repository, unless it already
+// has settings
+func openSetupIssue(ctx *probot.Context, repoName string) error {
+	cfg := config.GetConfig()
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
+	_, err = repoActions.NewGitHubClient(ctx).GetFileContent(context.Background(), owner, repo, config.RepoConfigFile)
+	if err == nil {
+		slog.InfoContext(logging.For(ctx), "Repository already has settings, no setup issue", "repo", repoName)
+		return nil
+	} else if !errors.Is(err, githubapi.ErrNotFound) {
+		return err
+	}
+	issue, err := repoActions.CreateIssue(ctx, repoName, cfg.Installations.SetupIssue.Title, renderSetupIssue(cfg), []string{cfg.Installations.SetupIssue.Label})
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(logging.For(ctx), "Opened setup issue", "repo", repoName, "issueNumber", issue.Number)
+	return nil
+}
+
+// renderSetupIssue writes the checklist of the setup issue with the defaults checked
+func renderSetupIssue(cfg *config.Config) string {
+	item := func(checked bool, text, key string) string {
+		box := " "
+		if checked {
+			box = "x"
+		}
+		return fmt.Sprintf("- [%s] %s <!-- %s -->\n", box, text, key)
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("DevFlow is installed on this repository. Choose how it should work here by checking the boxes below, "+
+		"then check **Apply**: DevFlow answers with a pull request adding `%s`. Change the boxes and check Apply again to update it.\n", config.RepoConfigFile))
+
+	b.WriteString("\n### Trigger labels\n\nDevFlow works on issues carrying one of the checked labels.\n\n")
+	for _, label := range cfg.Issues.RequiredLabels {
+		b.WriteString(item(true, "`"+label+"`", "label:"+label))
+	}
+
+	b.WriteString("\n### Autonomy\n\nCheck one; when several are checked the most cautious applies.\n\n")
+	b.WriteString(item(false, "**Plan first**: post a plan on the issue and wait for a reviewer's approval label before opening a pull request", "autonomy:"+autonomyPlan))
+	b.WriteString(item(true, "**Pull requests**: open pull requests for people to review and merge", "autonomy:"+autonomyReview))
+	b.WriteString(item(false, "**Auto-merge**: open pull requests that merge themselves once the required checks and reviews pass", "autonomy:"+autonomyMerge))
+
+	b.WriteString("\n### Protected paths\n\nDevFlow never changes the checked paths. Add your own as more checked items holding a pattern in backticks.\n\n")
+	for _, pattern := range cfg.Installations.SetupIssue.ProtectedPaths {
+		b.WriteString(item(true, "`"+pattern+"`", "deny:"+pattern))
+	}
+
+	b.WriteString("\n### Notifications\n\nWhere to hear about the pull requests DevFlow opens, besides the issue. The first checked applies.\n\n")
+	b.WriteString(item(true, "Issue comments only", "notify:"+config.NotifyChannelIssue))
+	b.WriteString(item(false, "Slack", "notify:"+config.NotifyChannelSlack))
+	b.WriteString(item(false, "Discord", "notify:"+config.NotifyChannelDiscord))
+
+	b.WriteString("\n### Apply\n\n")
+	b.WriteString(item(false, "Open a pull request with these settings", "apply"))
+	return b.String()
+}
+
+// customDenyPattern matches a checked protected path someone added without a hidden key
+var customDenyPattern = regexp.MustCompile("^\\s*[-*] \\[[xX]\\] `([^`]+)`\\s*$")
+
+// parseSetupIssue reads the checked boxes of a setup issue's body
+func parseSetupIssue(body string) setupChoices {
+	var choices setupChoices
+	autonomy := []string{}
+	section := ""
+	for _, line := range strings.Split(body, "\n") {
+		if heading, ok := strings.CutPrefix(strings.TrimSpace(line), "### "); ok {
+			section = strings.ToLower(heading)
+			continue
+		}
+		m := setupItemPattern.FindStringSubmatch(line)
+		if m == nil {
+			if c := customDenyPattern.FindStringSubmatch(line); c != nil && section == "protected paths" {
+				choices.Deny = append(choices.Deny, c[1])
+			}
+			continue
+		}
+		if m[1] == " " {
+			continue
+		}
+		switch key, value := m[2], strings.TrimSpace(m[3]); key {
+		case "label":
+			choices.Labels = append(choices.Labels, value)
+		case "autonomy":
+			autonomy = append(autonomy, value)
+		case "deny":
+			choices.Deny = append(choices.Deny, value)
+		case "notify":
+			if choices.Channel == "" {
+				choices.Channel = value
+			}
+		case "apply":
+			choices.Apply = true
+		}
+	}
+	for _, level := range []string{autonomyPlan, autonomyReview, autonomyMerge} {
+		if slices.Contains(autonomy, level) {
+			choices.Autonomy = level
+			break
+		}
+	}
+	return choices
+}
+
+// sameSettings reports whether two setups ask for the same settings, apply aside
+func (c setupChoices) sameSettings(other setupChoices) bool {
+	return slices.Equal(c.Labels, other.Labels) && c.Autonomy == other.Autonomy &&
+		slices.Equal(c.Deny, other.Deny) && c.Channel == other.Channel
+}
+
+// renderSetupFiles turns the choices into the repository's settings file and, for the plan
+// first autonomy, its pipeline
+func renderSetupFiles(cfg *config.Config, choices setupChoices) (map[string][]byte, error) {
+	settings := map[string]any{}
+	if len(choices.Labels) > 0 {
+		settings["issues"] = map[string]any{"labels": choices.Labels}
+	}
+	if len(choices.Deny) > 0 {
+		settings["paths"] = map[string]any{"deny": choices.Deny}
+	}
+	if choices.Autonomy == autonomyMerge {
+		settings["merge"] = map[string]any{"method": "squash"}
+	}
+	if choices.Channel != "" {
+		settings["notifications"] = map[string]any{"channel": choices.Channel}
+	}
+	data, err := marshalSetupYAML("DevFlow settings for this repository", settings)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{config.RepoConfigFile: data}
+
+	if choices.Autonomy == autonomyPlan {
+		pipeline := config.PipelineConfig{Stages: append([]config.PipelineStage{}, cfg.Pipeline.Stages...)}
+		if !pipeline.Has(config.StagePlanApproval) {
+			pipeline.Stages = append(pipeline.Stages, config.PipelineStage{Name: config.StagePlanApproval})
+			slices.SortStableFunc(pipeline.Stages, func(a, b config.PipelineStage) int {
+				return slices.Index(config.PipelineStages, a.Name) - slices.Index(config.PipelineStages, b.Name)
+			})
+		}
+		if err := pipeline.Validate(); err != nil {
+			return nil, err
+		}
+		data, err := marshalSetupYAML("DevFlow's pipeline for this repository", &pipeline)
+		if err != nil {
+			return nil, err
+		}
+		files[config.PipelineFile] = data
+	}
+	return files, nil
+}
+
+// marshalSetupYAML renders v as a settings file headed by a comment naming where it came from
+func marshalSetupYAML(title string, v any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("# " + title + ", written from the setup issue\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// handleSetupIssueEdited proposes the settings of a setup issue whose apply box is checked.
+// Edits that leave the checked settings as they were are ignored.
+func handleSetupIssueEdited(ctx *probot.Context, event *github.IssuesEvent, repoName string) error {
+	cfg := config.GetConfig()
+	issueNumber := event.Issue.GetNumber()
+	choices := parseSetupIssue(event.Issue.GetBody())
+	if !choices.Apply {
+		return nil
+	}
+	if event.Changes != nil && event.Changes.Body != nil && event.Changes.Body.From != nil {
+		if before := parseSetupIssue(*event.Changes.Body.From); before.Apply && before.sameSettings(choices) {
+			return nil
+		}
+	}
+
+	files, err := renderSetupFiles(cfg, choices)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Adds the settings chosen in #%d.\n\nChange the boxes of the issue and check Apply again to update this pull request; "+
+		"DevFlow uses the settings once it is merged.", issueNumber)
+	pr, err := repoActions.ProposeFiles(ctx, repoName, cfg.Installations.SetupIssue.Branch, "chore(devflow): add repository settings", "chore(devflow): add repository settings", body, files)
+	if err != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to propose repository settings", "issueNumber", issueNumber, "error", err)
+		if cErr := repoActions.PostIssueComment(ctx, repoName, issueNumber, fmt.Sprintf("DevFlow could not open the settings pull request: %v", err)); cErr != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to post setup comment", "issueNumber", issueNumber, "error", cErr)
+		}
+		return err
+	}
+	slog.InfoContext(logging.For(ctx), "Proposed repository settings from setup issue", "issueNumber", issueNumber, "prNumber", pr.Number)
+	return repoActions.PostIssueComment(ctx, repoName, issueNumber, fmt.Sprintf("DevFlow proposed these settings in %s.", pr.HTMLURL))
+}
+
+// isSetupIssue reports whether an issue is the setup issue DevFlow opened
+func isSetupIssue(issue *github.Issue) bool {
+	setup := config.GetConfig().Installations.SetupIssue
+	return setup.Enabled && hasLabel(issue.Labels, setup.Label) && repoActions.IsBotLogin(issue.GetUser().GetLogin())
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	repoActions "devflow-agent/packages/repository"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// offerSmallFix posts a trivial agent change as a suggested change on an open PR the issue
+// references, or else as a patch on the issue. It reports whether it posted, in which case
+// no pull request is opened.
+func offerSmallFix(ctx *probot.Context, cfg *config.Config, lang, repoName, repoPath string, issue *github.Issue, result *ai.PythonAgentResult) bool {
+	fix, ok := repoActions.DetectSmallFix(repoPath, result.ChangesMade, cfg.Issues.SmallFixes.MaxChangedLines)
+	if !ok {
+		return false
+	}
+	issueNumber := issue.GetNumber()
+	slog.InfoContext(logging.For(ctx), "Agent change is a small fix", "issueNumber", issueNumber, "file", fix.File, "lines", fmt.Sprintf("%d-%d", fix.StartLine, fix.EndLine))
+
+	if url, prNumber, ok := suggestOnReferencedPR(ctx, repoName, repoPath, issue, fix, result.Summary); ok {
+		comment := fmt.Sprintf("This looks like a small fix, so DevFlow suggested it on #%d instead of opening a pull request: %s", prNumber, url)
+		if err := repoActions.PostIssueComment(ctx, repoName, issueNumber, localize(lang, comment)); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to link suggested change", "issueNumber", issueNumber, "error", err)
+		}
+		return true
+	}
+
+	var b strings.Builder
+	b.WriteString(localize(lang, fmt.Sprintf("This looks like a small fix, so DevFlow is posting it here instead of opening a pull request.\n\n%s", result.Summary)))
+	b.WriteString("\n\n```diff\n" + strings.TrimRight(fix.Patch, "\n") + "\n```\n")
+	if err := repoActions.PostIssueComment(ctx, repoName, issueNumber, b.String()); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to post small fix, opening a pull request instead", "issueNumber", issueNumber, "error", err)
+		return false
+	}
+	return true
+}
+
+// suggestOnReferencedPR tries each open pull request of the repository that the issue
+// references, returning the suggestion's URL and the PR it was posted on
+func suggestOnReferencedPR(ctx *probot.Context, repoName, repoPath string, issue *github.Issue, fix *repoActions.SmallFix, summary string) (string, int, bool) {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return "", 0, false
+	}
+	client := repoActions.NewGitHubClient(ctx)
+	body := fmt.Sprintf("Suggested by DevFlow for #%d: %s", issue.GetNumber(), summary)
+	for _, ref := range repoActions.ExtractIssueReferences(issue.GetTitle()+"\n"+issue.GetBody(), repoName) {
+		if !strings.EqualFold(ref.RepoName, repoName) || ref.Number == issue.GetNumber() {
+			continue
+		}
+		referenced, err := client.GetIssue(context.Background(), owner, repo, ref.Number)
+		if err != nil || !referenced.IsPullRequest || referenced.State != "open" {
+			continue
+		}
+		url, err := repoActions.SuggestOnPullRequest(ctx, repoName, repoPath, ref.Number, fix, body)
+		if err != nil {
+			slog.InfoContext(logging.For(ctx), "Cannot suggest the fix on referenced PR", "pr", ref.Number, "error", err)
+			continue
+		}
+		return url, ref.Number, true
+	}
+	return "", 0, false
+}
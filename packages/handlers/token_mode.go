@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"devflow-agent/packages/config"
+	repoActions "devflow-agent/packages/repository"
+	"devflow-agent/packages/store"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// pollOverlap is how far each poll reaches back before the previous one, so events GitHub
+// indexes late are not missed; the idempotency claims drop the ones seen twice
+const pollOverlap = time.Minute
+
+// RunTokenMode runs DevFlow with a personal access token or OAuth app user token instead of
+// a GitHub App, for developers who cannot install an app. It polls auth.repos every
+// auth.poll_seconds for labeled issues and slash commands and hands them to EventHandlers as
+// if they had arrived as webhooks. Only events after startup are handled. It returns when
+// runCtx is done.
+func RunTokenMode(runCtx context.Context) error {
+	cfg := config.GetConfig().Auth
+	token := ""
+	if cfg.TokenEnv != "" {
+		token = os.Getenv(cfg.TokenEnv)
+	}
+	if token == "" {
+		return fmt.Errorf("auth.mode is token but %s is not set", cfg.TokenEnv)
+	}
+	if len(cfg.Repos) == 0 {
+		return fmt.Errorf("auth.mode is token but auth.repos lists no repositories to poll")
+	}
+	apiURL := cfg.APIURL
+	if apiURL == "" {
+		apiURL = "https://api.github.com"
+	}
+	webURL := cfg.WebURL
+	if webURL == "" {
+		webURL = "https://github.com"
+	}
+	interval := time.Duration(cfg.PollSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	configureGitToken(webURL, token)
+
+	slog.Info("Running with a token, polling repositories", "repos", cfg.Repos, "interval", interval)
+	since := map[string]time.Time{}
+	start := time.Now()
+	for _, repoName := range cfg.Repos {
+		since[repoName] = start
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-runCtx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		for _, repoName := range cfg.Repos {
+			polledAt := time.Now()
+			if err := pollRepository(runCtx, apiURL, token, repoName, since[repoName]); err != nil {
+				slog.Error("Failed to poll repository", "repo", repoName, "error", err)
+				continue
+			}
+			since[repoName] = polledAt.Add(-pollOverlap)
+		}
+	}
+}
+
+// pollRepository dispatches the events of repoName since the given time that no earlier poll
+// dispatched
+func pollRepository(runCtx context.Context, apiURL, token, repoName string, since time.Time) error {
+	ctx, err := repoActions.NewTokenContext(apiURL, token)
+	if err != nil {
+		return err
+	}
+	events, err := repoActions.PollRepositoryEvents(runCtx, ctx, repoName, since, func(body string) bool {
+		_, ok := parseSlashCommand(body)
+		return ok
+	})
+	if err != nil {
+		return err
+	}
+	claims, err := store.DefaultClaimer()
+	if err != nil {
+		return err
+	}
+	for _, ev := range events {
+		ok, err := claims.Claim("poll:"+repoName+":"+ev.ID, store.IdempotencyTTL())
+		if err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		handler, found := EventHandlers[ev.Type]
+		if !found {
+			continue
+		}
+		evCtx, err := repoActions.NewTokenContext(apiURL, token)
+		if err != nil {
+			return err
+		}
+		evCtx.Payload = ev.Payload
+		deliveryIDs.Store(evCtx, "poll-"+ev.ID)
+		go func(ctx *probot.Context, ev repoActions.PolledEvent) {
+			defer deliveryIDs.Delete(ctx)
+			if err := handler(ctx); err != nil {
+				slog.Error("Polled event failed", "repo", repoName, "event", ev.Type, "id", ev.ID, "error", err)
+			}
+		}(evCtx, ev)
+	}
+	return nil
+}
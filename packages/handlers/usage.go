@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"log/slog"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/store"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// recordUsage adds to a repository's usage counters; failures only cost accuracy, so they are logged
+func recordUsage(repoName string, deltas map[string]int64) {
+	usage, err := store.DefaultUsage()
+	if err == nil {
+		err = usage.IncrUsage(store.UsageByRepo, repoName, deltas)
+	}
+	if err != nil {
+		slog.Warn("Failed to record usage", "repo", repoName, "error", err)
+	}
+}
+
+// recordVariantUsage adds to the counters of a prompt experiment's variant
+func recordVariantUsage(experiment, variant string, deltas map[string]int64) {
+	usage, err := store.DefaultUsage()
+	if err == nil {
+		err = usage.IncrUsage(store.UsageByVariant, experiment+"/"+variant, deltas)
+	}
+	if err != nil {
+		slog.Warn("Failed to record variant usage", "experiment", experiment, "variant", variant, "error", err)
+	}
+}
+
+// variantNames maps each experiment to the variant assigned in it
+func variantNames(variants []ai.PromptVariant) map[string]string {
+	if len(variants) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(variants))
+	for _, v := range variants {
+		out[v.Experiment] = v.Variant
+	}
+	return out
+}
+
+// recordPRUsage adds PR outcome counters to the repository and, for issue PRs, to the prompt
+// variants recorded on the issue's run
+func recordPRUsage(repoName, headRef string, deltas map[string]int64) {
+	recordUsage(repoName, deltas)
+	issueNumber, ok := issueNumberFromBranch(headRef)
+	if !ok {
+		return
+	}
+	runs, err := store.Default()
+	if err != nil {
+		return
+	}
+	run, err := runs.GetRun(store.RunID(issueRunKind, repoName, issueNumber))
+	if err != nil {
+		return
+	}
+	for experiment, variant := range run.Variants {
+		recordVariantUsage(experiment, variant, deltas)
+	}
+}
+
+// isDevflowBranch reports whether a PR head branch was opened by DevFlow
+func isDevflowBranch(ref string) bool {
+	cfg := config.GetConfig()
+	for _, prefix := range []string{cfg.Issues.BranchPrefix, cfg.DependencyUpgrades.BranchPrefix, cfg.SecurityAlerts.BranchPrefix} {
+		if prefix != "" && strings.HasPrefix(ref, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordPullRequestUsage counts DevFlow PRs being opened, merged or closed unmerged, and the
+// time they took to merge
+func recordPullRequestUsage(ev *github.PullRequestEvent) {
+	pr := ev.GetPullRequest()
+	if !isDevflowBranch(pr.GetHead().GetRef()) {
+		return
+	}
+	repoName, head := ev.GetRepo().GetFullName(), pr.GetHead().GetRef()
+	switch {
+	case ev.GetAction() == "opened":
+		recordPRUsage(repoName, head, map[string]int64{store.UsagePRsOpened: 1})
+	case ev.GetAction() == "closed" && pr.GetMerged():
+		deltas := map[string]int64{store.UsagePRsMerged: 1}
+		if !pr.GetCreatedAt().IsZero() && pr.GetMergedAt().After(pr.GetCreatedAt()) {
+			deltas[store.UsageTimeToMergeSeconds] = int64(pr.GetMergedAt().Sub(pr.GetCreatedAt()).Seconds())
+		}
+		recordPRUsage(repoName, head, deltas)
+	case ev.GetAction() == "closed":
+		recordPRUsage(repoName, head, map[string]int64{store.UsagePRsClosedUnmerged: 1})
+	}
+}
+
+// HandlePullRequestReview counts review rounds on DevFlow PRs: every review that requests
+// changes sends the PR through another iteration. Approvals may turn on auto-merge.
+func HandlePullRequestReview(ctx *probot.Context) error {
+	ev := ctx.Payload.(*github.PullRequestReviewEvent)
+	if ev.GetAction() == "submitted" && strings.EqualFold(ev.GetReview().GetState(), "approved") {
+		applyMergeStrategy(ctx, ev.GetRepo().GetFullName(), ev.GetPullRequest())
+		return nil
+	}
+	if ev.GetAction() != "submitted" || !strings.EqualFold(ev.GetReview().GetState(), "changes_requested") {
+		return nil
+	}
+	head := ev.GetPullRequest().GetHead().GetRef()
+	if !isDevflowBranch(head) {
+		return nil
+	}
+	recordPRUsage(ev.GetRepo().GetFullName(), head, map[string]int64{store.UsageReviewIterations: 1})
+	return nil
+}
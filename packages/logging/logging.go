@@ -0,0 +1,159 @@
+// Package logging sets up the process logger and carries per-event attributes (run ID,
+// repository, issue, delivery ID) through contexts, so every log line written while handling
+// an event can be traced back to it.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"devflow-agent/packages/config"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// level is shared by every handler Configure installs, so a reload can change it in place
+var level = new(slog.LevelVar)
+
+// Configure makes the default logger write cfg.Format to stdout at cfg.Level. Log lines
+// carry the attributes attached to the context they are logged with, and keys, tokens and
+// Authorization headers are masked in all of them. The standard log
+// package, which probot logs request headers through, is demoted to the debug level.
+func Configure(cfg config.LoggingConfig) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(orDefault(cfg.Level, "info"))); err != nil {
+		return fmt.Errorf("invalid logging.level %q: %w", cfg.Level, err)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(orDefault(cfg.Format, "text")) {
+	case "text":
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	default:
+		return fmt.Errorf("invalid logging.format %q: want text or json", cfg.Format)
+	}
+	handler, err := newRedactHandler(handler, cfg.RedactPatterns)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+
+	// Attributes from the context are added first so they are redacted too
+	handler = contextHandler{handler}
+	slog.SetDefault(slog.New(handler))
+	// SetDefault routes the log package at the info level; set after it to override
+	log.SetFlags(0)
+	log.SetOutput(slog.NewLogLogger(handler, slog.LevelDebug).Writer())
+	return nil
+}
+
+func orDefault(v, fallback string) string {
+	if v == "" {
+		return fallback
+	}
+	return v
+}
+
+type attrsKey struct{}
+
+// With returns a copy of ctx whose log lines also carry args, given as alternating keys and
+// values like slog.Info's. Later values replace earlier ones with the same key.
+func With(ctx context.Context, args ...any) context.Context {
+	var added []slog.Attr
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.Add(args...)
+	r.Attrs(func(a slog.Attr) bool {
+		added = append(added, a)
+		return true
+	})
+
+	existing := Attrs(ctx)
+	merged := make([]slog.Attr, 0, len(existing)+len(added))
+	for _, a := range existing {
+		if !hasKey(added, a.Key) {
+			merged = append(merged, a)
+		}
+	}
+	return context.WithValue(ctx, attrsKey{}, append(merged, added...))
+}
+
+// Attrs returns the attributes attached to ctx with With
+func Attrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+func hasKey(attrs []slog.Attr, key string) bool {
+	for _, a := range attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// contextHandler adds the attributes attached to a record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := Attrs(ctx)
+	if len(attrs) == 0 {
+		return h.Handler.Handle(ctx, r)
+	}
+	// Keys the line sets itself win, so JSON output never repeats a key
+	var own []slog.Attr
+	r.Attrs(func(a slog.Attr) bool {
+		own = append(own, a)
+		return true
+	})
+	r = r.Clone()
+	for _, a := range attrs {
+		if !hasKey(own, a.Key) {
+			r.AddAttrs(a)
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// eventContexts holds the log context of each webhook context being handled; handlers pass
+// *probot.Context down their call tree rather than a context.Context
+var eventContexts sync.Map // *probot.Context -> context.Context
+
+// For returns the log context bound to a webhook context, or an empty one
+func For(ctx *probot.Context) context.Context {
+	if c, ok := eventContexts.Load(ctx); ok {
+		return c.(context.Context)
+	}
+	return context.Background()
+}
+
+// Bind attaches args to the log context of a webhook context, adding to those already bound
+func Bind(ctx *probot.Context, args ...any) {
+	eventContexts.Store(ctx, With(For(ctx), args...))
+}
+
+// Release forgets the log context of a webhook context once it has been handled
+func Release(ctx *probot.Context) {
+	eventContexts.Delete(ctx)
+}
@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretKeySuffixes end the attribute keys whose values are always masked, once the key is
+// lowercased and stripped of "_" and "-" (so accessToken, access_token and token all match)
+var secretKeySuffixes = []string{"token", "secret", "password", "passwd", "authorization", "apikey", "privatekey", "keydata", "credential", "credentials"}
+
+func isSecretKey(key string) bool {
+	key = strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+	for _, suffix := range secretKeySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretPatterns match secrets inside messages and string values. The text matched by a
+// first and second group is kept around the mask, so the line still shows what was masked.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(-----BEGIN [A-Z ]*PRIVATE KEY-----)[\s\S]*?(?:-----END [A-Z ]*PRIVATE KEY-----|$)`),
+	regexp.MustCompile(`(?i)(authorization["']?\s*[:=]\s*\[?\s*["']?(?:bearer|basic|token)?\s*)[^\s"',\]]+`),
+	regexp.MustCompile(`(://)[^/\s:@]+(?::[^/\s@]*)?(@)`),                                           // credentials in URLs
+	regexp.MustCompile(`\b(gh[pousr]_)[A-Za-z0-9]{20,}`),                                            // GitHub tokens
+	regexp.MustCompile(`\b(github_pat_)[A-Za-z0-9_]{20,}`),                                          // GitHub fine-grained tokens
+	regexp.MustCompile(`\b(AIza)[0-9A-Za-z_\-]{30,}`),                                               // Google API keys
+	regexp.MustCompile(`\b(sk-(?:ant-)?)[A-Za-z0-9_\-]{20,}`),                                       // OpenAI and Anthropic keys
+	regexp.MustCompile(`(?i)((?:api[_-]?key|token|secret|password)["']?\s*[:=]\s*["']?)[^\s"'&,]+`), // key=value pairs
+}
+
+// redactHandler masks secrets in every record before passing it on
+type redactHandler struct {
+	slog.Handler
+	patterns []*regexp.Regexp
+}
+
+// newRedactHandler wraps h so secrets are masked, using the built-in patterns and extra,
+// a list of regular expressions whose whole match is masked
+func newRedactHandler(h slog.Handler, extra []string) (slog.Handler, error) {
+	patterns := append([]*regexp.Regexp(nil), secretPatterns...)
+	for _, p := range extra {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid logging.redact_patterns entry %q: %w", p, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return redactHandler{Handler: h, patterns: patterns}, nil
+}
+
+func (h redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	clean := slog.NewRecord(r.Time, r.Level, h.redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		clean.AddAttrs(h.redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, clean)
+}
+
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		clean[i] = h.redactAttr(a)
+	}
+	return redactHandler{Handler: h.Handler.WithAttrs(clean), patterns: h.patterns}
+}
+
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{Handler: h.Handler.WithGroup(name), patterns: h.patterns}
+}
+
+func (h redactHandler) redactAttr(a slog.Attr) slog.Attr {
+	if isSecretKey(a.Key) && a.Value.Kind() != slog.KindGroup {
+		return slog.String(a.Key, redacted)
+	}
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, h.redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		clean := make([]any, len(group))
+		for i, ga := range group {
+			clean[i] = h.redactAttr(ga)
+		}
+		return slog.Group(a.Key, clean...)
+	case slog.KindAny:
+		// Errors and other values are logged through their text, which may quote a URL or header
+		if s := fmt.Sprint(v.Any()); h.redact(s) != s {
+			return slog.String(a.Key, h.redact(s))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// redact masks every secret in s
+func (h redactHandler) redact(s string) string {
+	for _, re := range h.patterns {
+		switch re.NumSubexp() {
+		case 0:
+			s = re.ReplaceAllString(s, redacted)
+		case 1:
+			s = re.ReplaceAllString(s, "${1}"+redacted)
+		default:
+			s = re.ReplaceAllString(s, "${1}"+redacted+"${2}")
+		}
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+// Package network applies the outbound proxy and TLS trust settings to every HTTP client and
+// subprocess devflow starts.
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"devflow-agent/packages/config"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Configure installs a transport honoring the proxy and CA bundle settings as
+// http.DefaultTransport, which the GitHub, LLM and agent-server clients all use, and exports
+// the same settings to the environment inherited by git and package-manager subprocesses.
+// Explicit settings take precedence over HTTPS_PROXY/HTTP_PROXY/NO_PROXY from the environment;
+// the CA bundle falls back to DEVFLOW_CA_BUNDLE, which the Python agent server also reads.
+func Configure(cfg config.NetworkConfig) error {
+	if cfg.HTTPSProxy != "" {
+		setEnv("HTTPS_PROXY", cfg.HTTPSProxy)
+	}
+	if cfg.HTTPProxy != "" {
+		setEnv("HTTP_PROXY", cfg.HTTPProxy)
+	}
+	if cfg.NoProxy != "" {
+		setEnv("NO_PROXY", cfg.NoProxy)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Read the environment now that it holds the configured values; http.ProxyFromEnvironment
+	// caches its first read, which may have happened before Configure ran
+	proxyFunc := httpproxy.FromEnvironment().ProxyFunc()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+
+	caBundle := cfg.CABundle
+	if caBundle == "" {
+		caBundle = os.Getenv("DEVFLOW_CA_BUNDLE")
+	}
+	if caBundle != "" {
+		caPath, err := filepath.Abs(caBundle)
+		if err != nil {
+			return err
+		}
+		pem, err := os.ReadFile(caPath)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA bundle %s", caPath)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+
+		// Subprocesses each read their own variable
+		setEnv("GIT_SSL_CAINFO", caPath)
+		setEnv("NODE_EXTRA_CA_CERTS", caPath)
+		setEnv("PIP_CERT", caPath)
+		setEnv("REQUESTS_CA_BUNDLE", caPath)
+		setEnv("SSL_CERT_FILE", caPath)
+	}
+
+	http.DefaultTransport = transport
+	slog.Info("Outbound network configured",
+		"httpsProxy", redact(os.Getenv("HTTPS_PROXY")), "noProxy", os.Getenv("NO_PROXY"), "caBundle", cfg.CABundle)
+	return nil
+}
+
+// setEnv sets both spellings, since tools disagree on whether proxy variables are upper or lower case
+func setEnv(name, value string) {
+	_ = os.Setenv(name, value)
+	switch name {
+	case "HTTPS_PROXY", "HTTP_PROXY", "NO_PROXY":
+		_ = os.Setenv(strings.ToLower(name), value)
+	}
+}
+
+// redact hides proxy credentials in logs
+func redact(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy
+	}
+	return u.Redacted()
+}
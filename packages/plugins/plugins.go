@@ -0,0 +1,135 @@
+// Package plugins runs the external analyzers, policy checks and post-processors configured
+// under plugins. A plugin gets one JSON Request on stdin and answers one JSON Response on
+// stdout; it runs in the repository checkout.
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"devflow-agent/packages/config"
+)
+
+// maxResponseBytes bounds what a plugin may answer
+const maxResponseBytes = 8 << 20
+
+// defaultWasmRuntime runs a WASI module with access to the checkout it is started in
+var defaultWasmRuntime = []string{"wasmtime", "run", "--dir=."}
+
+// Severities of a policy violation
+const (
+	SeverityError   = "error"   // keeps the changes off a pull request
+	SeverityWarning = "warning" // reported in the pull request
+)
+
+// Request is what a plugin receives on stdin
+type Request struct {
+	Hook        string         `json:"hook"`
+	Repo        string         `json:"repo"`
+	RepoPath    string         `json:"repo_path"`
+	Files       []string       `json:"files,omitempty"` // the agent's changes, relative to RepoPath
+	IssueNumber int            `json:"issue_number,omitempty"`
+	Settings    map[string]any `json:"settings,omitempty"`
+}
+
+// Response is what a plugin answers on stdout. Each hook reads its own field.
+type Response struct {
+	Documents    []Document  `json:"documents,omitempty"`     // analyze
+	ChangedFiles []string    `json:"changed_files,omitempty"` // post_process
+	Violations   []Violation `json:"violations,omitempty"`    // policy
+}
+
+// Document is a knowledge base document an analyze plugin produced
+type Document struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// Violation is a policy check's finding about one of the agent's changes
+type Violation struct {
+	Plugin   string `json:"-"`
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+// For returns the configured plugins subscribed to hook for the repository
+func For(hook, repoName string) []config.PluginConfig {
+	var out []config.PluginConfig
+	for _, p := range config.GetConfig().Plugins {
+		if slices.Contains(p.Hooks, hook) && (len(p.Repos) == 0 || slices.Contains(p.Repos, repoName)) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Run runs a plugin in req.RepoPath with req on stdin and parses its answer. A plugin that
+// exits non-zero, runs past its timeout or answers something other than JSON fails.
+func Run(ctx context.Context, p config.PluginConfig, req Request) (*Response, error) {
+	req.Settings = p.Settings
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if p.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(p.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+
+	argv := p.Command
+	if len(argv) == 0 {
+		runtime := p.Runtime
+		if len(runtime) == 0 {
+			runtime = defaultWasmRuntime
+		}
+		argv = append(append([]string{}, runtime...), p.Module)
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = req.RepoPath
+	cmd.Stdin = bytes.NewReader(payload)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s failed at %s: %w: %s", p.Name, req.Hook, err, strings.TrimSpace(stderr.String()))
+	}
+	if len(out) > maxResponseBytes {
+		return nil, fmt.Errorf("plugin %s answered %d bytes, more than %d", p.Name, len(out), maxResponseBytes)
+	}
+
+	resp := &Response{}
+	if out = bytes.TrimSpace(out); len(out) > 0 {
+		if err := json.Unmarshal(out, resp); err != nil {
+			return nil, fmt.Errorf("plugin %s answered invalid JSON: %w", p.Name, err)
+		}
+	}
+	for i := range resp.Violations {
+		resp.Violations[i].Plugin = p.Name
+		if resp.Violations[i].Severity != SeverityWarning {
+			resp.Violations[i].Severity = SeverityError
+		}
+	}
+	return resp, nil
+}
+
+// FormatViolations renders violations as a markdown list
+func FormatViolations(violations []Violation) string {
+	var b strings.Builder
+	for _, v := range violations {
+		loc := v.File
+		if v.Line > 0 {
+			loc = fmt.Sprintf("%s:%d", v.File, v.Line)
+		}
+		b.WriteString(fmt.Sprintf("- `%s` %s (%s)\n", loc, v.Message, v.Plugin))
+	}
+	return b.String()
+}
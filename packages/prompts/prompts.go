@@ -0,0 +1,300 @@
+// Package prompts renders the LLM prompts from versioned text/template files. The default set
+// is embedded in the binary; a deployment can override any of them with a file of the same
+// name in prompts.dir.
+//
+// Every template starts with a header comment giving its version and documenting each
+// variable it may use:
+//
+//	{{/*
+//	version: 2
+//	IssueTitle: issue title
+//	*/ -}}
+package prompts
+
+import (
+	"devflow-agent/packages/config"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Template names
+const (
+	IssueAnalysis         = "issue_analysis"
+	RepoAnalysis          = "repo_analysis"
+	RepoStructureAnalysis = "repo_structure_analysis"
+	AgentSystem           = "agent_system"
+	DocsAgentSystem       = "docs_agent_system"
+	TranslateIssue        = "translate_issue"
+	Localize              = "localize"
+	FileSummaries         = "file_summaries"
+	MultiRepoPlan         = "multi_repo_plan"
+	DiscussionTriage      = "discussion_triage"
+	AskRepo               = "ask_repo"
+	DescribePR            = "describe_pr"
+)
+
+// required lists the variables each template must use: the inputs callers provide that the
+// prompt would be meaningless without
+var required = map[string][]string{
+	IssueAnalysis:         {"IssueTitle", "IssueDescription", "RepoContent"},
+	RepoAnalysis:          {"RepoURL", "FileSummaries"},
+	RepoStructureAnalysis: {"StructureContent"},
+	AgentSystem:           nil,
+	DocsAgentSystem:       nil,
+	TranslateIssue:        {"Language", "Title", "Body"},
+	Localize:              {"Language", "Text"},
+	FileSummaries:         {"Files"},
+	MultiRepoPlan:         {"IssueTitle", "IssueBody", "Repos"},
+	DiscussionTriage:      {"Title", "Body"},
+	AskRepo:               {"Question", "Context"},
+	DescribePR:            {"Title", "Diff"},
+}
+
+// Vars holds the values of a template's variables
+type Vars map[string]any
+
+// Template is a parsed prompt template
+type Template struct {
+	Name    string
+	Version int
+	Source  string            // "embedded" or the override file
+	Vars    map[string]string // documented variable -> description
+	tmpl    *template.Template
+}
+
+// set is the loaded templates for one override directory
+type set struct {
+	dir       string
+	templates map[string]*Template
+}
+
+var (
+	mu      sync.Mutex
+	current *set
+)
+
+// Render executes the named template with vars. The template set follows prompts.dir, so a
+// config reload that changes it takes effect on the next render.
+func Render(name string, vars Vars) (string, error) {
+	t, err := Get(name)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, map[string]any(vars)); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s (v%d): %w", name, t.Version, err)
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// Get returns the named template of the current set
+func Get(name string) (*Template, error) {
+	s, err := load(config.GetConfig().Prompts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := s.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt template %q", name)
+	}
+	return t, nil
+}
+
+// Check loads and lints the configured template set, logging the version of each template
+func Check() error {
+	s, err := load(config.GetConfig().Prompts.Dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedNames() {
+		t := s.templates[name]
+		slog.Info("Prompt template loaded", "name", name, "version", t.Version, "source", t.Source)
+	}
+	return nil
+}
+
+// load returns the template set for dir, re-reading it when dir changed
+func load(dir string) (*set, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if current != nil && current.dir == dir {
+		return current, nil
+	}
+	templates, err := Lint(dir)
+	if err != nil {
+		return nil, err
+	}
+	current = &set{dir: dir, templates: templates}
+	return current, nil
+}
+
+// Lint parses the embedded templates with the overrides in dir (which may be empty) and
+// checks each one: the header has a version and documents every variable the template uses,
+// and every required variable is used. All problems are reported together.
+func Lint(dir string) (map[string]*Template, error) {
+	templates := make(map[string]*Template, len(required))
+	var errs []error
+	for _, name := range sortedNames() {
+		src, source, err := readTemplate(dir, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		t, err := parseTemplate(name, source, src)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		templates[name] = t
+	}
+	if dir != "" {
+		// A misspelled override would silently never be used
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		for _, path := range matches {
+			if _, ok := required[strings.TrimSuffix(filepath.Base(path), ".tmpl")]; !ok {
+				errs = append(errs, fmt.Errorf("%s: not a known prompt template", path))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid prompt templates: %w", errors.Join(errs...))
+	}
+	return templates, nil
+}
+
+func sortedNames() []string {
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readTemplate(dir, name string) (string, string, error) {
+	if dir != "" {
+		path := filepath.Join(dir, name+".tmpl")
+		if data, err := os.ReadFile(path); err == nil {
+			return string(data), path, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", "", fmt.Errorf("failed to read prompt override %s: %w", path, err)
+		}
+	}
+	data, err := defaultTemplates.ReadFile("templates/" + name + ".tmpl")
+	if err != nil {
+		return "", "", fmt.Errorf("missing embedded prompt template %s: %w", name, err)
+	}
+	return string(data), "embedded", nil
+}
+
+func parseTemplate(name, source, src string) (*Template, error) {
+	t := &Template{Name: name, Source: source, Vars: make(map[string]string)}
+	if err := parseHeader(t, src); err != nil {
+		return nil, fmt.Errorf("%s (%s): %w", name, source, err)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s (%s): %w", name, source, err)
+	}
+	t.tmpl = tmpl
+
+	used := make(map[string]bool)
+	collectFields(tmpl.Tree.Root, used)
+	for v := range used {
+		if _, ok := t.Vars[v]; !ok {
+			return nil, fmt.Errorf("%s (%s): variable %s is not documented in the header", name, source, v)
+		}
+	}
+	for _, v := range required[name] {
+		if !used[v] {
+			return nil, fmt.Errorf("%s (%s): required variable %s is not used", name, source, v)
+		}
+	}
+	return t, nil
+}
+
+// parseHeader reads the leading {{/* ... */}} comment: "version: N" and "Var: description" lines
+func parseHeader(t *Template, src string) error {
+	if !strings.HasPrefix(src, "{{/*") {
+		return fmt.Errorf("missing header comment")
+	}
+	end := strings.Index(src, "*/")
+	if end < 0 {
+		return fmt.Errorf("unterminated header comment")
+	}
+	for _, line := range strings.Split(src[len("{{/*"):end], "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "version" {
+			v, err := strconv.Atoi(value)
+			if err != nil || v <= 0 {
+				return fmt.Errorf("invalid version %q", value)
+			}
+			t.Version = v
+			continue
+		}
+		t.Vars[key] = value
+	}
+	if t.Version == 0 {
+		return fmt.Errorf("header has no version")
+	}
+	return nil
+}
+
+// collectFields records the top-level variables a template references. Inside range and with
+// blocks the dot is rebound, so only their pipelines are inspected.
+func collectFields(node parse.Node, used map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			collectFields(c, used)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, used)
+	case *parse.IfNode:
+		collectFields(n.Pipe, used)
+		collectFields(n.List, used)
+		collectFields(n.ElseList, used)
+	case *parse.RangeNode:
+		collectFields(n.Pipe, used)
+		collectFields(n.ElseList, used)
+	case *parse.WithNode:
+		collectFields(n.Pipe, used)
+		collectFields(n.ElseList, used)
+	case *parse.TemplateNode:
+		collectFields(n.Pipe, used)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				collectFields(arg, used)
+			}
+		}
+	case *parse.FieldNode:
+		used[n.Ident[0]] = true
+	case *parse.ChainNode:
+		collectFields(n.Node, used)
+	}
+}
@@ -0,0 +1,174 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"devflow-agent/packages/config"
+)
+
+const kafkaContentType = "application/vnd.kafka.binary.v2+json"
+
+// kafkaBus produces to and consumes from Kafka through a Confluent-compatible REST Proxy (v2
+// API). Workers join one consumer group, so partitions are spread across replicas; offsets are
+// committed only after an event was handled.
+type kafkaBus struct {
+	cfg     config.KafkaConfig
+	client  *http.Client
+	baseURI string // consumer instance URI, set by Consume
+}
+
+func newKafkaBus(cfg config.KafkaConfig) (*kafkaBus, error) {
+	if cfg.RESTProxyURL == "" || cfg.Topic == "" {
+		return nil, fmt.Errorf("queue.kafka.rest_proxy_url and queue.kafka.topic are required")
+	}
+	cfg.RESTProxyURL = strings.TrimSuffix(cfg.RESTProxyURL, "/")
+	return &kafkaBus{cfg: cfg, client: &http.Client{}}, nil
+}
+
+func (b *kafkaBus) Publish(ctx context.Context, ev Event) error {
+	value, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	// Binary records are base64 encoded by encoding/json; keying by delivery keeps retries of
+	// the same delivery on one partition
+	records := map[string]any{"records": []map[string]any{{"key": []byte(ev.DeliveryID), "value": value}}}
+	return b.do(ctx, http.MethodPost, b.cfg.RESTProxyURL+"/topics/"+b.cfg.Topic, records, nil)
+}
+
+func (b *kafkaBus) Consume(ctx context.Context, h Handler) error {
+	group := b.cfg.ConsumerGroup
+	if group == "" {
+		group = "devflow-workers"
+	}
+	hostname, _ := os.Hostname()
+	var instance struct {
+		InstanceID string `json:"instance_id"`
+		BaseURI    string `json:"base_uri"`
+	}
+	if err := b.do(ctx, http.MethodPost, b.cfg.RESTProxyURL+"/consumers/"+group, map[string]any{
+		"name":               fmt.Sprintf("%s-%d", hostname, time.Now().UnixNano()),
+		"format":             "binary",
+		"auto.offset.reset":  "earliest",
+		"auto.commit.enable": "false",
+	}, &instance); err != nil {
+		return fmt.Errorf("failed to create Kafka consumer: %w", err)
+	}
+	b.baseURI = instance.BaseURI
+	if err := b.do(ctx, http.MethodPost, b.baseURI+"/subscription", map[string]any{"topics": []string{b.cfg.Topic}}, nil); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", b.cfg.Topic, err)
+	}
+
+	for ctx.Err() == nil {
+		var records []struct {
+			Topic     string `json:"topic"`
+			Value     []byte `json:"value"`
+			Partition int    `json:"partition"`
+			Offset    int64  `json:"offset"`
+		}
+		if err := b.do(ctx, http.MethodGet, b.baseURI+"/records", nil, &records); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			slog.Warn("Kafka poll failed, retrying", "error", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		if len(records) == 0 {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		// A partition stops at its first failed record: committing a later offset would skip it
+		failed := map[int]bool{}
+		for _, r := range records {
+			if failed[r.Partition] {
+				continue
+			}
+			var ev Event
+			if err := json.Unmarshal(r.Value, &ev); err != nil {
+				slog.Error("Dropping malformed Kafka record", "partition", r.Partition, "offset", r.Offset, "error", err)
+			} else if err := h(ctx, ev); err != nil {
+				slog.Warn("Event handling failed, retrying from its offset", "partition", r.Partition, "offset", r.Offset, "error", err)
+				failed[r.Partition] = true
+				// Rewind the consumer so the next poll fetches the record again
+				if err := b.do(ctx, http.MethodPost, b.baseURI+"/positions", map[string]any{
+					"offsets": []map[string]any{{"topic": r.Topic, "partition": r.Partition, "offset": r.Offset}},
+				}, nil); err != nil {
+					slog.Warn("Failed to seek Kafka consumer back", "partition", r.Partition, "offset", r.Offset, "error", err)
+				}
+				continue
+			}
+			if err := b.do(ctx, http.MethodPost, b.baseURI+"/offsets", map[string]any{
+				"offsets": []map[string]any{{"topic": r.Topic, "partition": r.Partition, "offset": r.Offset}},
+			}, nil); err != nil {
+				slog.Warn("Failed to commit Kafka offset", "partition", r.Partition, "offset", r.Offset, "error", err)
+			}
+		}
+		if len(failed) > 0 {
+			time.Sleep(5 * time.Second)
+		}
+	}
+	return ctx.Err()
+}
+
+// Close removes the consumer instance so the group rebalances immediately
+func (b *kafkaBus) Close() error {
+	if b.baseURI == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return b.do(ctx, http.MethodDelete, b.baseURI, nil, nil)
+}
+
+func (b *kafkaBus) do(ctx context.Context, method, url string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	// Produced and fetched records use the binary embedded format; consumer management does not
+	if in != nil {
+		if strings.Contains(url, "/consumers/") {
+			req.Header.Set("Content-Type", "application/vnd.kafka.v2+json")
+		} else {
+			req.Header.Set("Content-Type", kafkaContentType)
+		}
+	}
+	if strings.HasSuffix(url, "/records") {
+		req.Header.Set("Accept", kafkaContentType)
+	} else {
+		req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Kafka REST proxy %s %s returned %d: %s", method, url, resp.StatusCode, respBody)
+	}
+	if out != nil && len(respBody) > 0 {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
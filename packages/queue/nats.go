@@ -0,0 +1,243 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"devflow-agent/packages/config"
+)
+
+// natsPendingEvents is how many received events a worker holds while its handler is busy
+const natsPendingEvents = 1024
+
+// natsMaxBackoff caps the wait between reconnection attempts
+const natsMaxBackoff = 30 * time.Second
+
+// natsBus speaks the core NATS text protocol. Workers subscribe in a queue group, so each
+// event goes to exactly one of them. Core NATS does not persist messages: events published
+// while no worker is connected are lost. A lost connection is redialed and the subscription
+// renewed.
+type natsBus struct {
+	cfg    config.NATSConfig
+	mu     sync.Mutex // guards conn and serializes writes
+	conn   net.Conn
+	reader *bufio.Reader // read by one goroutine at a time: the handshake, then Consume
+}
+
+func newNATSBus(cfg config.NATSConfig) (*natsBus, error) {
+	if cfg.URL == "" || cfg.Subject == "" {
+		return nil, fmt.Errorf("queue.nats.url and queue.nats.subject are required")
+	}
+	b := &natsBus{cfg: cfg}
+	if err := b.connect(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// connect dials the server and completes the CONNECT handshake, replacing any previous
+// connection
+func (b *natsBus) connect() error {
+	u, err := url.Parse(b.cfg.URL)
+	if err != nil {
+		return fmt.Errorf("invalid NATS URL: %w", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+
+	// The server greets with INFO before accepting CONNECT
+	if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, "INFO") {
+		conn.Close()
+		return fmt.Errorf("unexpected NATS greeting %q: %v", strings.TrimSpace(line), err)
+	}
+	opts := map[string]any{"verbose": false, "pedantic": false, "name": "devflow-agent", "lang": "go", "version": "1"}
+	if u.User != nil {
+		opts["user"] = u.User.Username()
+		opts["pass"], _ = u.User.Password()
+	}
+	connect, _ := json.Marshal(opts)
+	if _, err := io.WriteString(conn, "CONNECT "+string(connect)+"\r\nPING\r\n"); err != nil {
+		conn.Close()
+		return err
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("NATS handshake failed: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "PONG" {
+			break
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			conn.Close()
+			return fmt.Errorf("NATS rejected connection: %s", line)
+		}
+	}
+
+	b.mu.Lock()
+	if b.conn != nil {
+		b.conn.Close()
+	}
+	b.conn, b.reader = conn, reader
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *natsBus) write(s string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := io.WriteString(b.conn, s)
+	return err
+}
+
+func (b *natsBus) Publish(ctx context.Context, ev Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("PUB %s %d\r\n%s\r\n", b.cfg.Subject, len(data), data)
+	if err := b.write(msg); err != nil {
+		// The server dropped the connection since the last delivery; redial once
+		slog.Warn("NATS connection lost, reconnecting", "error", err)
+		if err := b.connect(); err != nil {
+			return err
+		}
+		return b.write(msg)
+	}
+	return nil
+}
+
+// Consume reads the subscription on one goroutine, which keeps answering the server's PINGs,
+// and handles events in turn on another, so a run of several minutes does not get the
+// connection dropped as stale. A lost connection is redialed with backoff until ctx ends.
+func (b *natsBus) Consume(ctx context.Context, h Handler) error {
+	events := make(chan Event, natsPendingEvents)
+	handled := make(chan struct{})
+	go func() {
+		defer close(handled)
+		for ev := range events {
+			if ctx.Err() != nil {
+				return
+			}
+			// Core NATS has no redelivery, so a failed event is only logged
+			if err := h(ctx, ev); err != nil {
+				slog.Error("Event handling failed", "event", ev.Type, "delivery", ev.DeliveryID, "error", err)
+			}
+		}
+	}()
+	defer func() {
+		close(events)
+		<-handled
+	}()
+	go func() {
+		<-ctx.Done()
+		b.Close()
+	}()
+
+	backoff := time.Second
+	for {
+		err := b.subscribe()
+		if err == nil {
+			backoff = time.Second
+			err = b.read(events)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		slog.Warn("NATS connection lost, reconnecting", "error", err, "retryIn", backoff)
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, natsMaxBackoff)
+			if err := b.connect(); err != nil {
+				slog.Warn("NATS reconnection failed", "error", err, "retryIn", backoff)
+				continue
+			}
+			if ctx.Err() != nil {
+				// Cancelled while dialing: the new connection missed the close
+				b.Close()
+				return ctx.Err()
+			}
+			break
+		}
+	}
+}
+
+func (b *natsBus) subscribe() error {
+	if b.cfg.QueueGroup != "" {
+		return b.write(fmt.Sprintf("SUB %s %s 1\r\n", b.cfg.Subject, b.cfg.QueueGroup))
+	}
+	return b.write(fmt.Sprintf("SUB %s 1\r\n", b.cfg.Subject))
+}
+
+// read passes the subscription's events to events until the connection fails. Events that
+// arrive while events is full are dropped, as the server would drop them for a slow consumer.
+func (b *natsBus) read(events chan<- Event) error {
+	b.mu.Lock()
+	reader := b.reader
+	b.mu.Unlock()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PING":
+			if err := b.write("PONG\r\n"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS error: %s", line)
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return fmt.Errorf("malformed NATS message header %q", line)
+			}
+			data := make([]byte, size+2) // payload + CRLF
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return err
+			}
+			var ev Event
+			if err := json.Unmarshal(data[:size], &ev); err != nil {
+				slog.Error("Dropping malformed NATS message", "error", err)
+				continue
+			}
+			select {
+			case events <- ev:
+			default:
+				slog.Error("Dropping NATS message: worker is too far behind", "event", ev.Type, "delivery", ev.DeliveryID)
+			}
+		}
+	}
+}
+
+func (b *natsBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conn.Close()
+}
@@ -0,0 +1,42 @@
+// Package queue decouples webhook reception from processing: a receiver publishes validated
+// webhook deliveries to a message bus and any number of workers consume them.
+package queue
+
+import (
+	"context"
+	"fmt"
+
+	"devflow-agent/packages/config"
+)
+
+// Event is one validated webhook delivery
+type Event struct {
+	Type       string `json:"type"`        // X-GitHub-Event
+	DeliveryID string `json:"delivery_id"` // X-GitHub-Delivery
+	Payload    []byte `json:"payload"`     // raw request body
+}
+
+// Handler processes one event. Returning an error leaves the message unacknowledged so the
+// backend can redeliver it.
+type Handler func(ctx context.Context, ev Event) error
+
+// Bus publishes and consumes events
+type Bus interface {
+	Publish(ctx context.Context, ev Event) error
+	// Consume delivers events to h until ctx is cancelled or the connection fails
+	Consume(ctx context.Context, h Handler) error
+	Close() error
+}
+
+// New connects to the backend selected by cfg.Backend
+func New(cfg config.QueueConfig) (Bus, error) {
+	switch cfg.Backend {
+	case "sqs":
+		return newSQSBus(cfg.SQS)
+	case "nats":
+		return newNATSBus(cfg.NATS)
+	case "kafka":
+		return newKafkaBus(cfg.Kafka)
+	}
+	return nil, fmt.Errorf("unknown queue backend %q (expected sqs, nats or kafka)", cfg.Backend)
+}
@@ -0,0 +1,185 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"devflow-agent/packages/config"
+)
+
+// sqsBus talks to Amazon SQS through its JSON protocol. Credentials come from the standard
+// AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY / AWS_SESSION_TOKEN environment variables.
+type sqsBus struct {
+	cfg      config.SQSConfig
+	endpoint string
+	client   *http.Client
+}
+
+func newSQSBus(cfg config.SQSConfig) (*sqsBus, error) {
+	if cfg.QueueURL == "" || cfg.Region == "" {
+		return nil, fmt.Errorf("queue.sqs.queue_url and queue.sqs.region are required")
+	}
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "" || os.Getenv("AWS_SECRET_ACCESS_KEY") == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set for the sqs backend")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://sqs.%s.amazonaws.com/", cfg.Region)
+	}
+	return &sqsBus{cfg: cfg, endpoint: endpoint, client: &http.Client{}}, nil
+}
+
+func (b *sqsBus) Publish(ctx context.Context, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return b.call(ctx, "SendMessage", map[string]any{
+		"QueueUrl":    b.cfg.QueueURL,
+		"MessageBody": string(body),
+	}, nil)
+}
+
+func (b *sqsBus) Consume(ctx context.Context, h Handler) error {
+	wait := b.cfg.WaitSeconds
+	if wait <= 0 || wait > 20 {
+		wait = 20
+	}
+	for ctx.Err() == nil {
+		var out struct {
+			Messages []struct {
+				MessageID     string `json:"MessageId"`
+				ReceiptHandle string `json:"ReceiptHandle"`
+				Body          string `json:"Body"`
+			} `json:"Messages"`
+		}
+		req := map[string]any{
+			"QueueUrl":            b.cfg.QueueURL,
+			"MaxNumberOfMessages": 1,
+			"WaitTimeSeconds":     wait,
+		}
+		if b.cfg.VisibilityTimeoutSeconds > 0 {
+			req["VisibilityTimeout"] = b.cfg.VisibilityTimeoutSeconds
+		}
+		if err := b.call(ctx, "ReceiveMessage", req, &out); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			slog.Warn("SQS receive failed, retrying", "error", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for _, m := range out.Messages {
+			var ev Event
+			if err := json.Unmarshal([]byte(m.Body), &ev); err != nil {
+				slog.Error("Dropping malformed SQS message", "messageId", m.MessageID, "error", err)
+			} else if err := h(ctx, ev); err != nil {
+				// Left in the queue; it becomes visible again after the visibility timeout
+				slog.Warn("Event handling failed, leaving message for redelivery", "messageId", m.MessageID, "error", err)
+				continue
+			}
+			if err := b.call(ctx, "DeleteMessage", map[string]any{
+				"QueueUrl":      b.cfg.QueueURL,
+				"ReceiptHandle": m.ReceiptHandle,
+			}, nil); err != nil {
+				slog.Warn("Failed to delete SQS message", "messageId", m.MessageID, "error", err)
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+func (b *sqsBus) Close() error { return nil }
+
+// call invokes one SQS action, decoding the response into out when it is non-nil
+func (b *sqsBus) call(ctx context.Context, action string, in any, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	signV4(req, body, b.cfg.Region, "sqs", time.Now().UTC())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SQS %s returned %d: %s", action, resp.StatusCode, respBody)
+	}
+	if out != nil {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
+
+// signV4 adds AWS Signature Version 4 headers to req
+func signV4(req *http.Request, body []byte, region, service string, now time.Time) {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	payloadHash := sha256Hex(body)
+
+	signedHeaders := "content-type;host;x-amz-date;x-amz-target"
+	canonicalHeaders := fmt.Sprintf("content-type:%s\nhost:%s\nx-amz-date:%s\nx-amz-target:%s\n",
+		req.Header.Get("Content-Type"), req.URL.Host, amzDate, req.Header.Get("X-Amz-Target"))
+	if token := req.Header.Get("X-Amz-Security-Token"); token != "" {
+		signedHeaders = "content-type;host;x-amz-date;x-amz-security-token;x-amz-target"
+		canonicalHeaders = fmt.Sprintf("content-type:%s\nhost:%s\nx-amz-date:%s\nx-amz-security-token:%s\nx-amz-target:%s\n",
+			req.Header.Get("Content-Type"), req.URL.Host, amzDate, token, req.Header.Get("X-Amz-Target"))
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%s",
+		req.Method, path, req.URL.Query().Encode(), canonicalHeaders, signedHeaders, payloadHash)
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := fmt.Sprintf("AWS4-HMAC-SHA256\n%s\n%s\n%s", amzDate, scope, sha256Hex([]byte(canonicalRequest)))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/store"
+)
+
+// ArchivedDocuments are the knowledge base documents kept in the analysis archive
+func ArchivedDocuments() []string {
+	files := config.GetConfig().Files
+	return []string{files.AnalysisFile, files.DependencyFile}
+}
+
+// ArchiveAnalysis stores a checkout's archived documents in the analysis archive. Archiving
+// is best effort: failures are logged and never fail the build or sync that wrote them.
+func ArchiveAnalysis(repoPath, repoName, commitSHA string) {
+	files := map[string]string{}
+	for _, name := range ArchivedDocuments() {
+		content, err := os.ReadFile(config.GetConfig().GetDevflowPath(repoPath, name))
+		if err == nil {
+			files[name] = string(content)
+		}
+	}
+	archiveDocuments(repoName, commitSHA, files)
+}
+
+// archiveDelta archives the documents of a knowledge base delta applied for commitSHA. Files
+// are keyed by their path in the repository; documents the delta did not change are carried
+// over from the newest archived version.
+func archiveDelta(repoName, commitSHA string, deltaFiles map[string]string) {
+	files := map[string]string{}
+	for rel, content := range deltaFiles {
+		files[path.Base(rel)] = content
+	}
+	archiveDocuments(repoName, commitSHA, files)
+}
+
+// archiveDocuments saves a new version unless it matches the newest archived one
+func archiveDocuments(repoName, commitSHA string, files map[string]string) {
+	keep := config.GetConfig().KnowledgeBase.ArchiveVersions
+	if keep <= 0 {
+		return
+	}
+	archive, err := store.DefaultArchive()
+	if err != nil {
+		slog.Warn("Analysis archive unavailable", "repo", repoName, "error", err)
+		return
+	}
+	versions, err := archive.ListAnalyses(repoName)
+	if err != nil {
+		slog.Warn("Failed to list archived analyses", "repo", repoName, "error", err)
+		return
+	}
+
+	v := &store.AnalysisVersion{Repo: repoName, CommitSHA: commitSHA, Files: map[string]string{}}
+	changed := len(versions) == 0
+	for _, name := range ArchivedDocuments() {
+		content, ok := files[name]
+		if len(versions) > 0 {
+			if !ok {
+				content, ok = versions[0].Files[name]
+			}
+			changed = changed || content != versions[0].Files[name]
+		}
+		if ok {
+			v.Files[name] = content
+		}
+	}
+	if !changed || len(v.Files) == 0 {
+		return
+	}
+	if err := archive.ArchiveAnalysis(v, keep); err != nil {
+		slog.Warn("Failed to archive analysis", "repo", repoName, "error", err)
+		return
+	}
+	slog.Info("Archived analysis", "repo", repoName, "version", v.Version, "sha", commitSHA)
+}
+
+// DiffAnalyses returns a unified diff of one archived document between two versions, empty
+// when the document is unchanged
+func DiffAnalyses(from, to *store.AnalysisVersion, name string) (string, error) {
+	dir, err := os.MkdirTemp("", "devflow_archive_diff_")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	// Relative paths label the diff with the version numbers, e.g. a/v3/repo-analysis.md
+	var paths []string
+	for _, v := range []*store.AnalysisVersion{from, to} {
+		rel := filepath.Join("v"+strconv.FormatInt(v.Version, 10), name)
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(rel)), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, rel), []byte(v.Files[name]), 0644); err != nil {
+			return "", err
+		}
+		paths = append(paths, rel)
+	}
+
+	cmd := exec.Command("git", "diff", "--no-index", "--no-color", "--", paths[0], paths[1])
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	// git diff --no-index exits 1 when the files differ
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return "", fmt.Errorf("git diff failed: %w", err)
+	}
+	return string(out), nil
+}
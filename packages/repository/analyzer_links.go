@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"devflow-agent/packages/config"
+)
+
+// maxSubmoduleDepth limits how deep submodules of submodules are analyzed
+const maxSubmoduleDepth = 2
+
+// SubmoduleInfo is a git submodule or nested repository found while analyzing a checkout
+type SubmoduleInfo struct {
+	Path   string // relative to the repository root, with forward slashes
+	URL    string // empty for nested repositories not declared in .gitmodules
+	Status string
+}
+
+// SymlinkInfo is a symbolic link found while analyzing a checkout
+type SymlinkInfo struct {
+	Path   string
+	Target string
+}
+
+// parseGitmodules returns the path and URL of each submodule declared in .gitmodules
+func parseGitmodules(root string) map[string]string {
+	declared := map[string]string{}
+	content, err := os.ReadFile(filepath.Join(root, ".gitmodules"))
+	if err != nil {
+		return declared
+	}
+	var path, url string
+	flush := func() {
+		if path != "" {
+			declared[strings.Trim(filepath.ToSlash(path), "/")] = url
+		}
+		path, url = "", ""
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			flush()
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "path":
+			path = strings.TrimSpace(value)
+		case "url":
+			url = strings.TrimSpace(value)
+		}
+	}
+	flush()
+	return declared
+}
+
+// relSlash returns path relative to the analyzed root, with forward slashes
+func (r *RepoAnalyzer) relSlash(path string) string {
+	rel, _ := filepath.Rel(r.LocalPath, path)
+	return filepath.ToSlash(rel)
+}
+
+// isNestedRepo reports whether a directory is a declared submodule or has its own .git
+func (r *RepoAnalyzer) isNestedRepo(path string) bool {
+	if _, ok := r.declared[r.relSlash(path)]; ok {
+		return true
+	}
+	_, err := os.Lstat(filepath.Join(path, ".git"))
+	return err == nil
+}
+
+// recordSymlink lists a symbolic link with its target, unless knowledge_base.symlinks is skip
+func (r *RepoAnalyzer) recordSymlink(path string) {
+	if strings.EqualFold(config.GetConfig().KnowledgeBase.Symlinks, "skip") || r.shouldIgnoreFile(path, filepath.Base(path)) {
+		return
+	}
+	target, err := os.Readlink(path)
+	if err != nil {
+		slog.Warn("Failed to read symbolic link", "path", path, "error", err)
+		return
+	}
+	target = filepath.ToSlash(target)
+	resolved := target
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(filepath.Dir(path), resolved)
+	}
+	if rel, err := filepath.Rel(r.LocalPath, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		target += " (outside the repository)"
+	}
+	r.Symlinks = append(r.Symlinks, SymlinkInfo{Path: r.relSlash(path), Target: target})
+}
+
+// analyzeNestedRepo records a submodule or nested repository. With knowledge_base.recurse_submodules
+// it is checked out if needed and analyzed on its own, its files listed under its path.
+func (r *RepoAnalyzer) analyzeNestedRepo(path string) {
+	rel := r.relSlash(path)
+	url, declared := r.declared[rel]
+	r.Submodules = append(r.Submodules, SubmoduleInfo{Path: rel, URL: url})
+	sub := &r.Submodules[len(r.Submodules)-1]
+
+	switch {
+	case !config.GetConfig().KnowledgeBase.RecurseSubmodules:
+		sub.Status = "not analyzed"
+	case r.depth >= maxSubmoduleDepth:
+		sub.Status = "not analyzed, nested too deep"
+	case !r.checkoutSubmodule(path, rel, declared):
+		sub.Status = "not checked out"
+	default:
+		nested := &RepoAnalyzer{LocalPath: path, RepoURL: url, depth: r.depth + 1}
+		if err := nested.analyzeFiles(); err != nil {
+			slog.Warn("Failed to analyze submodule", "path", rel, "error", err)
+			sub.Status = "analysis failed"
+			return
+		}
+		sub.Status = fmt.Sprintf("analyzed, %d files", len(nested.Files))
+		for _, f := range nested.Files {
+			f.RelativePath = filepath.Join(filepath.FromSlash(rel), f.RelativePath)
+			r.Files = append(r.Files, f)
+		}
+		for _, s := range nested.Submodules {
+			s.Path = rel + "/" + s.Path
+			r.Submodules = append(r.Submodules, s)
+		}
+		for _, l := range nested.Symlinks {
+			l.Path = rel + "/" + l.Path
+			r.Symlinks = append(r.Symlinks, l)
+		}
+	}
+}
+
+// checkoutSubmodule makes sure a nested repository has a working tree, initializing declared
+// submodules that the clone left empty
+func (r *RepoAnalyzer) checkoutSubmodule(path, rel string, declared bool) bool {
+	if _, err := os.Lstat(filepath.Join(path, ".git")); err == nil {
+		return true
+	}
+	if !declared {
+		return false
+	}
+	cmd := exec.Command("git", "-C", r.LocalPath, "submodule", "update", "--init", "--depth=1", "--", rel)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		slog.Warn("Failed to check out submodule", "path", rel, "error", err, "output", strings.TrimSpace(string(out)))
+		return false
+	}
+	_, err := os.Lstat(filepath.Join(path, ".git"))
+	return err == nil
+}
+
+// writeLinks lists the submodules, nested repositories and symbolic links of the repository
+func (r *RepoAnalyzer) writeLinks(writer *bufio.Writer) {
+	if len(r.Submodules) > 0 {
+		writer.WriteString("# Submodules\n")
+		for _, s := range r.Submodules {
+			source := s.URL
+			if source == "" {
+				source = "nested repository"
+			}
+			writer.WriteString(fmt.Sprintf("- %s (%s): %s\n", s.Path, source, s.Status))
+		}
+		writer.WriteString("\n")
+	}
+	if len(r.Symlinks) > 0 {
+		writer.WriteString("# Symbolic Links\n")
+		for _, l := range r.Symlinks {
+			writer.WriteString(fmt.Sprintf("- %s -> %s\n", l.Path, l.Target))
+		}
+		writer.WriteString("\n")
+	}
+}
@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// APIKeywords are issue words that make the API surface document relevant to a prompt
+var APIKeywords = []string{
+	"api", "endpoint", "route", "rest", "http", "request", "response", "openapi", "swagger",
+	"graphql", "query", "mutation", "resolver", "subscription", "grpc", "rpc", "proto", "protobuf",
+}
+
+// APISurface collects the API definitions found in a repository
+type APISurface struct {
+	OpenAPI  []string
+	GraphQL  []string
+	Protobuf []string
+}
+
+var (
+	graphqlTypeRegex    = regexp.MustCompile(`^(?:extend\s+)?(type|input|enum|interface|union|scalar)\s+(\w+)`)
+	graphqlFieldRegex   = regexp.MustCompile(`^(\w+)\s*(\([^)]*\))?\s*:\s*([\w!\[\]]+)`)
+	protoPackageRegex   = regexp.MustCompile(`^package\s+([\w.]+)\s*;`)
+	protoServiceRegex   = regexp.MustCompile(`^service\s+(\w+)`)
+	protoRPCRegex       = regexp.MustCompile(`^rpc\s+(\w+)\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*returns\s*\(\s*(stream\s+)?([\w.]+)\s*\)`)
+	protoMessageRegex   = regexp.MustCompile(`^(message|enum)\s+(\w+)`)
+	openAPIHTTPMethods  = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+	graphqlRootTypes    = map[string]bool{"Query": true, "Mutation": true, "Subscription": true}
+	openAPIMarkerRegexp = regexp.MustCompile(`(?m)^\s*"?(openapi|swagger)"?\s*:`)
+)
+
+// AnalyzeAPISurface scans the repository for OpenAPI/Swagger specs, GraphQL schemas and
+// protobuf files
+func AnalyzeAPISurface(repoPath string) (*APISurface, error) {
+	return AnalyzeAPISurfaceFS(OSFS(repoPath))
+}
+
+// AnalyzeAPISurfaceFS is AnalyzeAPISurface on any FS
+func AnalyzeAPISurfaceFS(fsys FS) (*APISurface, error) {
+	surface := &APISurface{}
+
+	err := fs.WalkDir(fsys, ".", func(relPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if relPath != "." && shouldIgnoreForStructure(relPath, d.Name()) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if shouldIgnoreForStructure(relPath, d.Name()) {
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(d.Name()))
+		switch ext {
+		case ".yaml", ".yml", ".json", ".graphql", ".graphqls", ".gql", ".proto":
+		default:
+			return nil
+		}
+
+		content, err := fsys.ReadFile(relPath)
+		if err != nil || isBinary(content) {
+			return nil
+		}
+
+		switch ext {
+		case ".graphql", ".graphqls", ".gql":
+			if entry := summarizeGraphQL(relPath, content); entry != "" {
+				surface.GraphQL = append(surface.GraphQL, entry)
+			}
+		case ".proto":
+			if entry := summarizeProto(relPath, content); entry != "" {
+				surface.Protobuf = append(surface.Protobuf, entry)
+			}
+		default:
+			if openAPIMarkerRegexp.Match(content) {
+				if entry := summarizeOpenAPI(relPath, content); entry != "" {
+					surface.OpenAPI = append(surface.OpenAPI, entry)
+				}
+			}
+		}
+		return nil
+	})
+	return surface, err
+}
+
+// summarizeOpenAPI lists every operation of an OpenAPI 3 or Swagger 2 document
+func summarizeOpenAPI(relPath string, content []byte) string {
+	var doc struct {
+		OpenAPI string `yaml:"openapi"`
+		Swagger string `yaml:"swagger"`
+		Info    struct {
+			Title   string `yaml:"title"`
+			Version string `yaml:"version"`
+		} `yaml:"info"`
+		BasePath string                    `yaml:"basePath"`
+		Paths    map[string]map[string]any `yaml:"paths"`
+	}
+	// JSON is valid YAML, so one parser covers both spec formats
+	if err := yaml.Unmarshal(content, &doc); err != nil || len(doc.Paths) == 0 {
+		return ""
+	}
+
+	version := doc.OpenAPI
+	if version == "" {
+		version = "swagger " + doc.Swagger
+	}
+	lines := []string{fmt.Sprintf("- `%s` (%s, %s %s)", relPath, version, doc.Info.Title, doc.Info.Version)}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		for _, method := range openAPIHTTPMethods {
+			op, ok := doc.Paths[p][method].(map[string]any)
+			if !ok {
+				continue
+			}
+			line := fmt.Sprintf("  - `%s %s%s`", strings.ToUpper(method), doc.BasePath, p)
+			if id, _ := op["operationId"].(string); id != "" {
+				line += " " + id
+			}
+			if summary, _ := op["summary"].(string); summary != "" {
+				line += ": " + strings.TrimSpace(summary)
+			}
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// summarizeGraphQL lists the types of a GraphQL schema, with the fields of the root
+// Query/Mutation/Subscription types spelled out
+func summarizeGraphQL(relPath string, content []byte) string {
+	var types []string
+	var operations []string
+	currentRoot := ""
+	depth := 0
+	for _, raw := range strings.Split(string(content), "\n") {
+		line := strings.TrimSpace(raw)
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		if depth == 0 {
+			if m := graphqlTypeRegex.FindStringSubmatch(line); m != nil {
+				if graphqlRootTypes[m[2]] {
+					currentRoot = m[2]
+				} else {
+					types = append(types, fmt.Sprintf("%s `%s`", m[1], m[2]))
+				}
+			}
+		} else if depth == 1 && currentRoot != "" {
+			if m := graphqlFieldRegex.FindStringSubmatch(line); m != nil {
+				operations = append(operations, fmt.Sprintf("  - %s `%s%s: %s`", strings.ToLower(currentRoot), m[1], m[2], m[3]))
+			}
+		}
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+		if depth <= 0 {
+			depth = 0
+			currentRoot = ""
+		}
+	}
+	if len(types) == 0 && len(operations) == 0 {
+		return ""
+	}
+
+	lines := []string{fmt.Sprintf("- `%s`", relPath)}
+	lines = append(lines, operations...)
+	if len(types) > 0 {
+		lines = append(lines, "  - types: "+strings.Join(types, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// summarizeProto lists the package, services with their RPCs, and messages of a .proto file
+func summarizeProto(relPath string, content []byte) string {
+	pkg := ""
+	service := ""
+	var rpcs, messages []string
+	for _, raw := range strings.Split(string(content), "\n") {
+		line := strings.TrimSpace(raw)
+		if m := protoPackageRegex.FindStringSubmatch(line); m != nil {
+			pkg = m[1]
+		} else if m := protoServiceRegex.FindStringSubmatch(line); m != nil {
+			service = m[1]
+		} else if m := protoRPCRegex.FindStringSubmatch(line); m != nil {
+			rpcs = append(rpcs, fmt.Sprintf("  - rpc `%s.%s(%s%s) returns (%s%s)`", service, m[1], m[2], m[3], m[4], m[5]))
+		} else if m := protoMessageRegex.FindStringSubmatch(line); m != nil && !strings.HasPrefix(raw, " ") && !strings.HasPrefix(raw, "\t") {
+			messages = append(messages, fmt.Sprintf("`%s`", m[2]))
+		}
+	}
+	if len(rpcs) == 0 && len(messages) == 0 {
+		return ""
+	}
+
+	header := fmt.Sprintf("- `%s`", relPath)
+	if pkg != "" {
+		header += fmt.Sprintf(" (package %s)", pkg)
+	}
+	lines := append([]string{header}, rpcs...)
+	if len(messages) > 0 {
+		lines = append(lines, "  - messages: "+strings.Join(messages, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Markdown renders the API surface, omitting empty categories
+func (s *APISurface) Markdown() string {
+	var b strings.Builder
+	b.WriteString("# API Surface\n\n")
+	b.WriteString("When changing an endpoint, update both its handler and the definition listed here.\n\n")
+	sections := []struct {
+		title   string
+		entries []string
+	}{
+		{"OpenAPI / Swagger", s.OpenAPI},
+		{"GraphQL", s.GraphQL},
+		{"Protocol Buffers / gRPC", s.Protobuf},
+	}
+	empty := true
+	for _, section := range sections {
+		if len(section.entries) == 0 {
+			continue
+		}
+		empty = false
+		b.WriteString("## " + section.title + "\n\n")
+		b.WriteString(strings.Join(section.entries, "\n") + "\n\n")
+	}
+	if empty {
+		b.WriteString("No OpenAPI specs, GraphQL schemas or protobuf files were found.\n")
+	}
+	return b.String()
+}
+
+// GenerateAPISurface writes the condensed API surface document to outputFile
+func GenerateAPISurface(repoPath, outputFile string) error {
+	slog.Info("Generating API surface", "output", outputFile)
+
+	surface, err := AnalyzeAPISurface(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to analyze API surface: %w", err)
+	}
+	return os.WriteFile(outputFile, []byte(surface.Markdown()), 0644)
+}
+
+// LoadAPISurfaceContext returns the API surface document when the issue mentions endpoints,
+// schemas or RPCs, truncated to maxTokens (0 means no limit)
+func LoadAPISurfaceContext(apiFile, issueText string, maxTokens int) string {
+	return loadKeywordGatedDocument(apiFile, issueText, APIKeywords, maxTokens)
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bradleyfalzon/ghinstallation"
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// AppFromEnv builds the GitHub App credentials from the same environment variables probot
+// reads, for work that is not triggered by a webhook (e.g. scheduled tasks)
+func AppFromEnv() (*probot.App, error) {
+	baseURL := os.Getenv("GITHUB_BASE_URL")
+	if baseURL == "" {
+		return nil, fmt.Errorf("GITHUB_BASE_URL not set in environment")
+	}
+	id, err := strconv.ParseInt(os.Getenv("GITHUB_APP_ID"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_APP_ID: %w", err)
+	}
+	key, err := os.ReadFile(os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+	}
+	return &probot.App{BaseURL: baseURL, ID: id, Key: key, Secret: os.Getenv("GITHUB_APP_WEBHOOK_SECRET")}, nil
+}
+
+// NewInstallationContext returns a probot context authenticated as the given installation,
+// equivalent to the one probot hands to webhook handlers (without a payload)
+func NewInstallationContext(app *probot.App, installationID int64) (*probot.Context, error) {
+	itr, err := ghinstallation.New(http.DefaultTransport, app.ID, installationID, app.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation transport: %w", err)
+	}
+	itr.BaseURL = app.BaseURL
+	client, err := github.NewEnterpriseClient(app.BaseURL, app.BaseURL, &http.Client{Transport: itr})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := probot.NewContext(app)
+	ctx.GitHub = client
+	return ctx, nil
+}
+
+// NewTokenContext returns a probot context authenticated with a plain token, such as the
+// GITHUB_TOKEN of an Actions run. apiURL is the REST root (e.g. https://api.github.com). The
+// context has no App, so app-level calls like GetInstallationPermissions are unavailable.
+func NewTokenContext(apiURL, token string) (*probot.Context, error) {
+	base, err := url.Parse(strings.TrimSuffix(apiURL, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid API URL %q: %w", apiURL, err)
+	}
+	client := github.NewClient(&http.Client{Transport: &tokenTransport{token: token, base: http.DefaultTransport}})
+	client.BaseURL = base
+	return &probot.Context{GitHub: client}, nil
+}
+
+// tokenTransport authenticates every request with a bearer token
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+// ListInstalledRepositories returns the full names of the repositories each installation of
+// the app can access, keyed by installation ID
+func ListInstalledRepositories(ctx context.Context, app *probot.App) (map[int64][]string, error) {
+	tr, err := ghinstallation.NewAppsTransport(http.DefaultTransport, app.ID, app.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create app transport: %w", err)
+	}
+	tr.BaseURL = app.BaseURL
+	appClient, err := github.NewEnterpriseClient(app.BaseURL, app.BaseURL, &http.Client{Transport: tr})
+	if err != nil {
+		return nil, err
+	}
+
+	var installations []*github.Installation
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := appClient.Apps.ListInstallations(ctx, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list installations: %w", err)
+		}
+		installations = append(installations, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	repos := make(map[int64][]string)
+	for _, inst := range installations {
+		instCtx, err := NewInstallationContext(app, inst.GetID())
+		if err != nil {
+			return nil, err
+		}
+		names, err := InstallationRepositories(ctx, instCtx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list repositories of installation %d: %w", inst.GetID(), err)
+		}
+		repos[inst.GetID()] = names
+	}
+	return repos, nil
+}
+
+// InstallationRepositories returns the full names of the repositories the installation behind
+// an installation-authenticated context can access
+func InstallationRepositories(runCtx context.Context, ctx *probot.Context) ([]string, error) {
+	var names []string
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := ctx.GitHub.Apps.ListRepos(runCtx, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range page {
+			names = append(names, r.GetFullName())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return names, nil
+}
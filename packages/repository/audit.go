@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"unicode/utf8"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/store"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// auditedClient records every mutating call of the client it wraps in the audit log. Reads
+// pass through unrecorded.
+type auditedClient struct {
+	githubapi.Client
+	ctx *probot.Context
+}
+
+// withAudit wraps client so its changes are audited, when audit.enabled is set
+func withAudit(ctx *probot.Context, client githubapi.Client) githubapi.Client {
+	if !config.GetConfig().Audit.Enabled {
+		return client
+	}
+	return &auditedClient{Client: client, ctx: ctx}
+}
+
+// RecordAudit adds an entry for a change made on repoName to the audit log, tagged with the
+// run, delivery and event of ctx. input and response are encoded as JSON, with strings over
+// audit.max_value_bytes truncated. Failing to record is logged, never returned: the change
+// has already happened.
+func RecordAudit(ctx *probot.Context, repoName, action string, input, response any, err error) {
+	cfg := config.GetConfig().Audit
+	if !cfg.Enabled {
+		return
+	}
+	entry := &store.AuditEntry{
+		Repo:     repoName,
+		Action:   action,
+		Input:    auditJSON(input, cfg.MaxValueBytes),
+		Response: auditJSON(response, cfg.MaxValueBytes),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	for _, a := range logging.Attrs(logging.For(ctx)) {
+		switch a.Key {
+		case "run_id":
+			entry.RunID = a.Value.String()
+		case "delivery_id":
+			entry.Delivery = a.Value.String()
+		case "event":
+			entry.Event = a.Value.String()
+		case "repo":
+			if entry.Repo == "" {
+				entry.Repo = a.Value.String()
+			}
+		}
+	}
+
+	audit, sErr := store.DefaultAudit()
+	if sErr == nil {
+		sErr = audit.AppendAudit(entry)
+	}
+	if sErr != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to record audit entry", "repo", repoName, "action", action, "error", sErr)
+	}
+}
+
+// auditJSON encodes v with long strings truncated; nil stays empty
+func auditJSON(v any, maxBytes int) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil || maxBytes <= 0 {
+		return data
+	}
+	var generic any
+	if json.Unmarshal(data, &generic) != nil {
+		return data
+	}
+	if data, err = json.Marshal(truncateStrings(generic, maxBytes)); err != nil {
+		return nil
+	}
+	return data
+}
+
+// truncateStrings shortens every string in a decoded JSON value to maxBytes
+func truncateStrings(v any, maxBytes int) any {
+	switch t := v.(type) {
+	case string:
+		if len(t) > maxBytes {
+			cut := maxBytes
+			for cut > 0 && !utf8.RuneStart(t[cut]) {
+				cut--
+			}
+			return fmt.Sprintf("%s... (%d bytes)", t[:cut], len(t))
+		}
+	case map[string]any:
+		for k, item := range t {
+			t[k] = truncateStrings(item, maxBytes)
+		}
+	case []any:
+		for i, item := range t {
+			t[i] = truncateStrings(item, maxBytes)
+		}
+	}
+	return v
+}
+
+func (c *auditedClient) record(owner, repo, action string, input, response any, err error) {
+	repoName := ""
+	if owner != "" {
+		repoName = owner + "/" + repo
+	}
+	RecordAudit(c.ctx, repoName, action, input, response, err)
+}
+
+func (c *auditedClient) CreateRef(ctx context.Context, owner, repo, ref, sha string) error {
+	err := c.Client.CreateRef(ctx, owner, repo, ref, sha)
+	c.record(owner, repo, "create_ref", map[string]any{"ref": ref, "sha": sha}, nil, err)
+	return err
+}
+
+func (c *auditedClient) UpdateRef(ctx context.Context, owner, repo, ref, sha string, force bool) error {
+	err := c.Client.UpdateRef(ctx, owner, repo, ref, sha, force)
+	c.record(owner, repo, "update_ref", map[string]any{"ref": ref, "sha": sha, "force": force}, nil, err)
+	return err
+}
+
+func (c *auditedClient) CreateCommit(ctx context.Context, owner, repo, message, treeSHA string, parents []string) (*githubapi.Commit, error) {
+	commit, err := c.Client.CreateCommit(ctx, owner, repo, message, treeSHA, parents)
+	c.record(owner, repo, "create_commit", map[string]any{"message": message, "tree": treeSHA, "parents": parents}, commit, err)
+	return commit, err
+}
+
+func (c *auditedClient) CreateBlob(ctx context.Context, owner, repo, content string) (string, error) {
+	sha, err := c.Client.CreateBlob(ctx, owner, repo, content)
+	c.record(owner, repo, "create_blob", map[string]any{"content": content}, map[string]any{"sha": sha}, err)
+	return sha, err
+}
+
+func (c *auditedClient) CreateTree(ctx context.Context, owner, repo, baseTreeSHA string, entries []githubapi.TreeEntry) (string, error) {
+	sha, err := c.Client.CreateTree(ctx, owner, repo, baseTreeSHA, entries)
+	c.record(owner, repo, "create_tree", map[string]any{"base_tree": baseTreeSHA, "entries": entries}, map[string]any{"sha": sha}, err)
+	return sha, err
+}
+
+func (c *auditedClient) DeleteRef(ctx context.Context, owner, repo, ref string) error {
+	err := c.Client.DeleteRef(ctx, owner, repo, ref)
+	c.record(owner, repo, "delete_ref", map[string]any{"ref": ref}, nil, err)
+	return err
+}
+
+func (c *auditedClient) CreateFile(ctx context.Context, owner, repo, path, message, branch string, content []byte) error {
+	err := c.Client.CreateFile(ctx, owner, repo, path, message, branch, content)
+	c.record(owner, repo, "create_file", map[string]any{"path": path, "message": message, "branch": branch, "content": string(content)}, nil, err)
+	return err
+}
+
+func (c *auditedClient) CreateIssue(ctx context.Context, owner, repo string, issue githubapi.NewIssue) (*githubapi.Issue, error) {
+	created, err := c.Client.CreateIssue(ctx, owner, repo, issue)
+	c.record(owner, repo, "create_issue", issue, created, err)
+	return created, err
+}
+
+func (c *auditedClient) CreateIssueComment(ctx context.Context, owner, repo string, number int, body string) (*githubapi.Comment, error) {
+	comment, err := c.Client.CreateIssueComment(ctx, owner, repo, number, body)
+	c.record(owner, repo, "create_comment", map[string]any{"number": number, "body": body}, comment, err)
+	return comment, err
+}
+
+func (c *auditedClient) EditIssueComment(ctx context.Context, owner, repo string, commentID int64, body string) error {
+	err := c.Client.EditIssueComment(ctx, owner, repo, commentID, body)
+	c.record(owner, repo, "edit_comment", map[string]any{"comment_id": commentID, "body": body}, nil, err)
+	return err
+}
+
+func (c *auditedClient) AddIssueLabels(ctx context.Context, owner, repo string, number int, labels []string) error {
+	err := c.Client.AddIssueLabels(ctx, owner, repo, number, labels)
+	c.record(owner, repo, "add_labels", map[string]any{"number": number, "labels": labels}, nil, err)
+	return err
+}
+
+func (c *auditedClient) RemoveIssueLabel(ctx context.Context, owner, repo string, number int, label string) error {
+	err := c.Client.RemoveIssueLabel(ctx, owner, repo, number, label)
+	c.record(owner, repo, "remove_label", map[string]any{"number": number, "label": label}, nil, err)
+	return err
+}
+
+func (c *auditedClient) CreateLabel(ctx context.Context, owner, repo string, label githubapi.Label) error {
+	err := c.Client.CreateLabel(ctx, owner, repo, label)
+	c.record(owner, repo, "create_label", label, nil, err)
+	return err
+}
+
+func (c *auditedClient) DeleteLabel(ctx context.Context, owner, repo, name string) error {
+	err := c.Client.DeleteLabel(ctx, owner, repo, name)
+	c.record(owner, repo, "delete_label", map[string]any{"name": name}, nil, err)
+	return err
+}
+
+func (c *auditedClient) CreateIssueReaction(ctx context.Context, owner, repo string, number int, content string) error {
+	err := c.Client.CreateIssueReaction(ctx, owner, repo, number, content)
+	c.record(owner, repo, "create_reaction", map[string]any{"number": number, "content": content}, nil, err)
+	return err
+}
+
+func (c *auditedClient) CreateCommentReaction(ctx context.Context, owner, repo string, commentID int64, content string) error {
+	err := c.Client.CreateCommentReaction(ctx, owner, repo, commentID, content)
+	c.record(owner, repo, "create_reaction", map[string]any{"comment_id": commentID, "content": content}, nil, err)
+	return err
+}
+
+func (c *auditedClient) SetIssueMilestone(ctx context.Context, owner, repo string, number, milestone int) error {
+	err := c.Client.SetIssueMilestone(ctx, owner, repo, number, milestone)
+	c.record(owner, repo, "set_milestone", map[string]any{"number": number, "milestone": milestone}, nil, err)
+	return err
+}
+
+func (c *auditedClient) CreatePullRequest(ctx context.Context, owner, repo string, pr githubapi.NewPullRequest) (*githubapi.PullRequest, error) {
+	created, err := c.Client.CreatePullRequest(ctx, owner, repo, pr)
+	c.record(owner, repo, "create_pull_request", pr, created, err)
+	return created, err
+}
+
+func (c *auditedClient) EditPullRequestBody(ctx context.Context, owner, repo string, number int, body string) error {
+	err := c.Client.EditPullRequestBody(ctx, owner, repo, number, body)
+	c.record(owner, repo, "edit_pull_request", map[string]any{"number": number, "body": body}, nil, err)
+	return err
+}
+
+func (c *auditedClient) RequestReviewers(ctx context.Context, owner, repo string, number int, reviewers []string) error {
+	err := c.Client.RequestReviewers(ctx, owner, repo, number, reviewers)
+	c.record(owner, repo, "request_reviewers", map[string]any{"number": number, "reviewers": reviewers}, nil, err)
+	return err
+}
+
+func (c *auditedClient) CreateReviewComment(ctx context.Context, owner, repo string, number int, comment githubapi.ReviewComment) (string, error) {
+	url, err := c.Client.CreateReviewComment(ctx, owner, repo, number, comment)
+	c.record(owner, repo, "create_review_comment", map[string]any{"number": number, "comment": comment}, map[string]any{"url": url}, err)
+	return url, err
+}
+
+func (c *auditedClient) ClosePullRequest(ctx context.Context, owner, repo string, number int) error {
+	err := c.Client.ClosePullRequest(ctx, owner, repo, number)
+	c.record(owner, repo, "close_pull_request", map[string]any{"number": number}, nil, err)
+	return err
+}
+
+func (c *auditedClient) EnableAutoMerge(ctx context.Context, prNodeID, method string) error {
+	err := c.Client.EnableAutoMerge(ctx, prNodeID, method)
+	c.record("", "", "enable_auto_merge", map[string]any{"pull_request": prNodeID, "method": method}, nil, err)
+	return err
+}
+
+func (c *auditedClient) AddDiscussionComment(ctx context.Context, discussionNodeID, body string) error {
+	err := c.Client.AddDiscussionComment(ctx, discussionNodeID, body)
+	c.record("", "", "add_discussion_comment", map[string]any{"discussion": discussionNodeID, "body": body}, nil, err)
+	return err
+}
+
+func (c *auditedClient) AddProjectItem(ctx context.Context, projectNodeID, contentNodeID string) (string, error) {
+	item, err := c.Client.AddProjectItem(ctx, projectNodeID, contentNodeID)
+	c.record("", "", "add_project_item", map[string]any{"project": projectNodeID, "content": contentNodeID}, map[string]any{"item": item}, err)
+	return item, err
+}
+
+func (c *auditedClient) SetProjectItemOption(ctx context.Context, projectNodeID, itemID, field, option string) error {
+	err := c.Client.SetProjectItemOption(ctx, projectNodeID, itemID, field, option)
+	c.record("", "", "set_project_item_option", map[string]any{"project": projectNodeID, "item": itemID, "field": field, "option": option}, nil, err)
+	return err
+}
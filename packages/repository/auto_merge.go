@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"devflow-agent/packages/githubapi"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// mergeMethods maps merge.method settings to GitHub's merge methods
+var mergeMethods = map[string]string{"merge": "MERGE", "squash": "SQUASH", "rebase": "REBASE"}
+
+// EnableAutoMerge turns on auto-merge for a pull request with method "merge", "squash" or
+// "rebase". GitHub refuses when the repository does not allow auto-merge.
+func EnableAutoMerge(ctx *probot.Context, prNodeID, method string) error {
+	gqlMethod, ok := mergeMethods[strings.ToLower(method)]
+	if !ok {
+		return fmt.Errorf("unknown merge method %q, expected merge, squash or rebase", method)
+	}
+	return NewGitHubClient(ctx).EnableAutoMerge(context.Background(), prNodeID, gqlMethod)
+}
+
+// CountApprovals returns how many reviewers currently approve a pull request: those whose
+// latest approving or rejecting review is an approval
+func CountApprovals(ctx *probot.Context, repoName string, prNumber int) (int, error) {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return 0, err
+	}
+	reviews, err := NewGitHubClient(ctx).ListReviews(context.Background(), owner, repo, prNumber)
+	if err != nil {
+		return 0, err
+	}
+	latest := map[string]string{}
+	for _, r := range reviews {
+		switch r.State {
+		case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+			latest[r.AuthorLogin] = r.State
+		}
+	}
+	approvals := 0
+	for _, state := range latest {
+		if state == "APPROVED" {
+			approvals++
+		}
+	}
+	return approvals, nil
+}
+
+// DeleteBranch deletes a branch of the repository
+func DeleteBranch(ctx *probot.Context, repoName, branch string) error {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
+	return NewGitHubClient(ctx).DeleteRef(context.Background(), owner, repo, "heads/"+branch)
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"devflow-agent/packages/config"
+
+	"github.com/bradleyfalzon/ghinstallation"
+	"github.com/google/go-github/github"
+)
+
+// appLoginRetry is how long to wait before looking the app's login up again after a failure
+const appLoginRetry = 10 * time.Minute
+
+var appLogin struct {
+	sync.Mutex
+	login       string
+	lastAttempt time.Time
+}
+
+// BotLogins returns the accounts DevFlow acts as: the configured bot.logins plus the app's
+// own "<slug>[bot]" account when GitHub App credentials are available
+func BotLogins() []string {
+	logins := append([]string{}, config.GetConfig().Bot.Logins...)
+	if login := appBotLogin(); login != "" {
+		logins = append(logins, login)
+	}
+	return logins
+}
+
+// IsBotLogin reports whether login is one of DevFlow's own accounts
+func IsBotLogin(login string) bool {
+	if login == "" {
+		return false
+	}
+	for _, l := range BotLogins() {
+		if strings.EqualFold(l, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBotCommitAuthor reports whether a commit author is the identity DevFlow commits as
+func IsBotCommitAuthor(name, email string) bool {
+	cfg := config.GetConfig().Bot
+	return (cfg.CommitEmail != "" && strings.EqualFold(email, cfg.CommitEmail)) ||
+		(cfg.CommitName != "" && name == cfg.CommitName)
+}
+
+// appBotLogin looks up the app's bot account once, retrying after appLoginRetry on failure
+func appBotLogin() string {
+	appLogin.Lock()
+	defer appLogin.Unlock()
+	if appLogin.login != "" || time.Since(appLogin.lastAttempt) < appLoginRetry {
+		return appLogin.login
+	}
+	appLogin.lastAttempt = time.Now()
+
+	app, err := AppFromEnv()
+	if err != nil {
+		return "" // not running as a GitHub App, e.g. in an Actions run
+	}
+	tr, err := ghinstallation.NewAppsTransport(http.DefaultTransport, app.ID, app.Key)
+	if err != nil {
+		slog.Warn("Cannot look up the app's bot login", "error", err)
+		return ""
+	}
+	tr.BaseURL = app.BaseURL
+	client, err := github.NewEnterpriseClient(app.BaseURL, app.BaseURL, &http.Client{Transport: tr})
+	if err != nil {
+		slog.Warn("Cannot look up the app's bot login", "error", err)
+		return ""
+	}
+	info, _, err := client.Apps.Get(context.Background(), "")
+	if err != nil || info.GetHTMLURL() == "" {
+		slog.Warn("Cannot look up the app's bot login", "error", err)
+		return ""
+	}
+	// go-github v17 has no slug field; the app's page is .../apps/<slug>
+	appLogin.login = path.Base(info.GetHTMLURL()) + "[bot]"
+	slog.Info("Resolved the app's bot login", "login", appLogin.login)
+	return appLogin.login
+}
@@ -3,10 +3,11 @@ package repository
 import (
 	"context"
 	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
 	"log/slog"
 	"strings"
 
-	"github.com/google/go-github/github"
 	"github.com/swinton/go-probot/probot"
 )
 
@@ -14,36 +15,42 @@ func CreateBranch(ctx *probot.Context, repoName, branchName string) error {
 	cfg := config.GetConfig()
 
 	// Split repo name
-	parts := strings.Split(repoName, "/")
-	owner := parts[0]
-	repo := parts[1]
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
+	client := NewGitHubClient(ctx)
 
 	// Get main branch reference
-	mainRef, _, err := ctx.GitHub.Git.GetRef(context.Background(), owner, repo, "refs/heads/"+cfg.Repository.DefaultBranch)
+	mainRef, err := client.GetRef(context.Background(), owner, repo, "refs/heads/"+cfg.Repository.DefaultBranch)
 	if err != nil {
-		slog.Error("Clone Failed", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Clone Failed", "error", err)
 		return err
 	}
 
-	slog.Info("Creating branch on GitHub", "branch", branchName)
+	slog.InfoContext(logging.For(ctx), "Creating branch on GitHub", "branch", branchName)
 	// Create new branch reference
-	newRef := &github.Reference{
-		Ref: github.String("refs/heads/" + branchName),
-		Object: &github.GitObject{
-			SHA: mainRef.Object.SHA,
-		},
-	}
-
-	_, _, err = ctx.GitHub.Git.CreateRef(context.Background(), owner, repo, newRef)
+	err = client.CreateRef(context.Background(), owner, repo, "refs/heads/"+branchName, mainRef.SHA)
 	if err != nil {
-		slog.Error("Failed to create a Branch", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to create a Branch", "error", err)
 		return err
 	}
 
-	slog.Info("Branch created on GitHub", "branch", branchName)
+	slog.InfoContext(logging.For(ctx), "Branch created on GitHub", "branch", branchName)
 	return nil
 }
 
+// BranchExists reports whether a branch exists on GitHub
+func BranchExists(ctx *probot.Context, repoName, branchName string) bool {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		slog.ErrorContext(logging.For(ctx), "Invalid repo name format", "repoName", repoName)
+		return false
+	}
+	_, err = NewGitHubClient(ctx).GetRef(context.Background(), owner, repo, "refs/heads/"+branchName)
+	return err == nil
+}
+
 func SanitizeBranchName(title string) string {
 	cfg := config.GetConfig()
 	sanitized := strings.ReplaceAll(title, " ", "-")
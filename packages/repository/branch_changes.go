@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CheckoutBranchChanges brings the changes a branch makes since it left the checkout's HEAD
+// into the working tree, leaving HEAD and the index alone, so another agent pass starts from
+// them and reports them as its own. It returns the paths the branch changes.
+func CheckoutBranchChanges(repoPath, branch string) ([]string, error) {
+	if _, err := git(repoPath, "fetch", "origin", branch); err != nil {
+		return nil, err
+	}
+	diff := func() (string, error) {
+		return git(repoPath, "diff", "--name-status", "--no-renames", "HEAD...FETCH_HEAD")
+	}
+	out, err := diff()
+	if err != nil {
+		// A shallow clone may not reach the commit the branch left from
+		if _, uErr := git(repoPath, "fetch", "--unshallow", "origin"); uErr != nil {
+			return nil, err
+		}
+		if _, err := git(repoPath, "fetch", "origin", branch); err != nil {
+			return nil, err
+		}
+		if out, err = diff(); err != nil {
+			return nil, err
+		}
+	}
+
+	var changed []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		status, path, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		if status == "D" {
+			if err := os.Remove(filepath.Join(repoPath, filepath.FromSlash(path))); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		} else if _, err := git(repoPath, "checkout", "FETCH_HEAD", "--", path); err != nil {
+			return nil, fmt.Errorf("failed to check out %s of %s: %w", path, branch, err)
+		}
+		changed = append(changed, path)
+	}
+	if _, err := git(repoPath, "reset", "-q"); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
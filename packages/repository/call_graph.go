@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"devflow-agent/packages/callgraph"
+	"devflow-agent/packages/config"
+)
+
+// maxImpactCallers is how many callers of one function the impact context names
+const maxImpactCallers = 8
+
+// GenerateCallGraph writes the function-level call graph of the repository's Go and
+// TypeScript sources
+func GenerateCallGraph(ctx context.Context, repoPath, outputFile string) error {
+	slog.Info("Generating call graph", "output", outputFile)
+	graph, err := callgraph.Build(ctx, repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to build call graph: %w", err)
+	}
+	return graph.Write(outputFile)
+}
+
+// RenderImpactContext lists, for the functions defined in files, the functions in other files
+// calling them: what may break when their signatures or behavior change. It stops once
+// maxTokens is reached (0 means no limit) and is empty without a call graph.
+func RenderImpactContext(callGraphFile string, files []string, maxTokens int) string {
+	if len(files) == 0 {
+		return ""
+	}
+	graph, err := callgraph.Load(callGraphFile)
+	if err != nil {
+		slog.Debug("Call graph unavailable", "error", err)
+		return ""
+	}
+
+	var b strings.Builder
+	header := "## Callers of the candidate files\n\nChanging the signature or behavior of these functions affects their callers:\n\n"
+	b.WriteString(header)
+	for _, file := range files {
+		for _, fn := range graph.InFile(file) {
+			var callers []string
+			for _, c := range graph.Callers(fn.ID, 1) {
+				if c.File != file {
+					callers = append(callers, fmt.Sprintf("`%s` (%s:%d)", c.Name, c.File, c.Line))
+				}
+			}
+			if len(callers) == 0 {
+				continue
+			}
+			more := ""
+			if len(callers) > maxImpactCallers {
+				more = fmt.Sprintf(" and %d more", len(callers)-maxImpactCallers)
+				callers = callers[:maxImpactCallers]
+			}
+			line := fmt.Sprintf("- `%s` (%s:%d) `%s` is called by %s%s\n", fn.Name, fn.File, fn.Line, fn.Signature, strings.Join(callers, ", "), more)
+			if maxTokens > 0 && EstimateTokens(b.String()+line) > maxTokens {
+				return b.String()
+			}
+			b.WriteString(line)
+		}
+	}
+	if b.Len() == len(header) {
+		return ""
+	}
+	return b.String()
+}
+
+// callGraphStage generates the call graph during a knowledge base build. It returns the file
+// written, or "" when the graph could not be built, which does not fail the build.
+func callGraphStage(repoPath string) string {
+	cfg := config.GetConfig()
+	if cfg.Files.CallGraphFile == "" {
+		return ""
+	}
+	file := cfg.GetDevflowPath(repoPath, cfg.Files.CallGraphFile)
+	ctx, cancel := config.StageContext(context.Background(), cfg.Timeouts.AnalysisSeconds)
+	defer cancel()
+	if err := GenerateCallGraph(ctx, repoPath, file); err != nil {
+		slog.Warn("Failed to generate call graph, continuing without it", "error", err)
+		return ""
+	}
+	return file
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+)
+
+// FilterChangeLimits splits an agent's changed files into kept files and discarded ones: deleted
+// files the plan does not name, and new binary files. plan is the text the agent worked from,
+// such as the issue; a deletion is kept when it names the file's whole path, or when the file
+// was renamed. reported are the operations the agent reported, see FileOperations.
+func FilterChangeLimits(repoPath string, changed []string, plan string, reported []ai.FileOperation) ([]string, []PathViolation) {
+	renamedFrom := map[string]bool{}
+	for _, op := range FileOperations(repoPath, changed, reported) {
+		if op.Op == ai.FileOpRename {
+			renamedFrom[op.From] = true
+		}
+	}
+	var kept []string
+	var discarded []PathViolation
+	for _, rel := range changed {
+		content, err := os.ReadFile(filepath.Join(repoPath, rel))
+		switch {
+		case os.IsNotExist(err):
+			if !mentionsPath(plan, filepath.ToSlash(rel)) && !renamedFrom[rel] {
+				discarded = append(discarded, PathViolation{Path: rel, Reason: "deleted, but the issue does not ask for it"})
+				continue
+			}
+		case err == nil && isBinary(content) && !existsAtHead(repoPath, rel):
+			discarded = append(discarded, PathViolation{Path: rel, Reason: "new binary file"})
+			continue
+		}
+		kept = append(kept, rel)
+	}
+	return kept, discarded
+}
+
+// mentionsPath reports whether text names rel as a whole path rather than as part of a longer
+// one: "pkg/util.go" is not mentioned by "internal/pkg/util.go" or "pkg/util.go.bak"
+func mentionsPath(text, rel string) bool {
+	for i := 0; ; {
+		j := strings.Index(text[i:], rel)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(rel)
+		before := strings.TrimSuffix(text[:start], "./")
+		after := text[end:]
+		startsPath := before == "" || !isPathChar(before[len(before)-1])
+		// A dot right after the path ends a sentence unless a name continues past it
+		endsPath := after == "" || !isPathChar(after[0]) || (after[0] == '.' && (len(after) == 1 || !isPathChar(after[1]) || after[1] == '.'))
+		if startsPath && endsPath {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isPathChar(c byte) bool {
+	return c == '/' || c == '.' || c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// existsAtHead reports whether a repo-relative path is tracked in the checkout's HEAD commit
+func existsAtHead(repoPath, rel string) bool {
+	_, err := git(repoPath, "cat-file", "-e", "HEAD:"+filepath.ToSlash(rel))
+	return err == nil
+}
+
+// ChangeSize is the size of an agent's changes
+type ChangeSize struct {
+	Files int
+	Bytes int64 // total size of the written files
+	Lines int   // added plus removed lines
+}
+
+// MeasureChanges sums the size of the changed files of a checkout against HEAD
+func MeasureChanges(repoPath string, changed []string) ChangeSize {
+	size := ChangeSize{Files: len(changed)}
+	for _, rel := range changed {
+		content, err := os.ReadFile(filepath.Join(repoPath, rel))
+		if err == nil {
+			size.Bytes += int64(len(content))
+		}
+		if !existsAtHead(repoPath, rel) {
+			size.Lines += bytes.Count(content, []byte("\n"))
+			continue
+		}
+		// numstat prints "added<TAB>removed<TAB>path", or "-" counts for binary files
+		out, err := git(repoPath, "diff", "--numstat", "HEAD", "--", rel)
+		if err != nil {
+			continue
+		}
+		if fields := strings.Fields(out); len(fields) >= 2 {
+			added, _ := strconv.Atoi(fields[0])
+			removed, _ := strconv.Atoi(fields[1])
+			size.Lines += added + removed
+		}
+	}
+	return size
+}
+
+// ChangeLimitReasons checks changes against a repository's limits. refuse is set when the
+// changes exceed a hard limit; confirm when they need the confirmation label.
+func ChangeLimitReasons(size ChangeSize, limits config.ChangeLimitsConfig) (refuse, confirm string) {
+	if limits.MaxBytes > 0 && size.Bytes > limits.MaxBytes {
+		refuse = fmt.Sprintf("the changed files total %d bytes, above the limit of %d", size.Bytes, limits.MaxBytes)
+	}
+	switch {
+	case limits.ConfirmFiles > 0 && size.Files > limits.ConfirmFiles:
+		confirm = fmt.Sprintf("%d files changed, above the threshold of %d", size.Files, limits.ConfirmFiles)
+	case limits.ConfirmLines > 0 && size.Lines > limits.ConfirmLines:
+		confirm = fmt.Sprintf("%d lines changed, above the threshold of %d", size.Lines, limits.ConfirmLines)
+	}
+	return refuse, confirm
+}
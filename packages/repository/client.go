@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"devflow-agent/packages/githubapi"
+	"fmt"
+	"regexp"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// NewGitHubClient builds the GitHub API client for a webhook context; its changes are
+// recorded in the audit log. Replace it to inject a different implementation (e.g. a fake in
+// tests).
+var NewGitHubClient = func(ctx *probot.Context) githubapi.Client {
+	if client, ok := providerClient(ctx); ok {
+		return withAudit(ctx, client)
+	}
+	return withAudit(ctx, githubapi.NewV17(ctx.GitHub, func(runCtx context.Context, path string, out any) error {
+		return Paginate(runCtx, ctx.GitHub, path, out)
+	}))
+}
+
+// CloneURL returns the URL a repository is cloned from.
+// Replace it to clone from elsewhere (e.g. a local directory in the development harness).
+var CloneURL = func(repoName string) string {
+	if u, ok := providerCloneURL(repoName); ok {
+		return u
+	}
+	return fmt.Sprintf("https://github.com/%s.git", repoName)
+}
+
+// githubRemote matches the owner/name of a GitHub remote URL (https or ssh)
+var githubRemote = regexp.MustCompile(`[/:]([^/:]+/[^/]+?)(\.git)?/?$`)
+
+// RepoNameFromURL returns the owner/name of a remote URL, https or ssh
+func RepoNameFromURL(url string) (string, bool) {
+	if m := githubRemote.FindStringSubmatch(url); m != nil {
+		return m[1], true
+	}
+	return "", false
+}
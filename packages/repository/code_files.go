@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// CodeRegion is a contiguous, named range of lines within a file (1-based, inclusive)
+type CodeRegion struct {
+	Name      string
+	StartLine int
+	EndLine   int
+	Score     int
+}
+
+var keywordPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]{3,}`)
+
+var keywordStopwords = map[string]bool{
+	"this": true, "that": true, "with": true, "when": true, "from": true, "have": true,
+	"should": true, "would": true, "could": true, "there": true, "their": true, "which": true,
+	"what": true, "where": true, "into": true, "also": true, "does": true, "than": true,
+	"then": true, "them": true, "they": true, "will": true, "just": true, "like": true,
+	"some": true, "only": true, "make": true, "need": true, "want": true, "issue": true,
+	"please": true, "same": true, "currently": true, "instead": true, "because": true,
+}
+
+// EstimateTokens approximates the token count of text for the configured model
+func EstimateTokens(text string) int {
+	return ai.CountTokens(config.GetConfig().AI.Model, text)
+}
+
+// ExtractIssueKeywords returns lowercase identifier-like words from issue text for relevance scoring.
+func ExtractIssueKeywords(text string) []string {
+	seen := make(map[string]bool)
+	var keywords []string
+	for _, w := range keywordPattern.FindAllString(text, -1) {
+		lw := strings.ToLower(w)
+		if keywordStopwords[lw] || seen[lw] {
+			continue
+		}
+		seen[lw] = true
+		keywords = append(keywords, lw)
+	}
+	return keywords
+}
+
+// CreateCodeFilesDocument writes code-files.md for the given repo-relative files within the
+// configured token budget. Small files are included whole; large files are reduced to the
+// functions/regions most relevant to the issue, followed by an index of omitted sections.
+// Generated files are only listed, with the source to change instead.
+func CreateCodeFilesDocument(repoPath string, files []string, issueText, outputFile string) (string, error) {
+	cfg := config.GetConfig()
+	budget := cfg.CodeContext.MaxTokens
+	keywords := ExtractIssueKeywords(issueText)
+
+	var b strings.Builder
+	b.WriteString("# Code Files\n\n")
+
+	generated := FindGeneratedFiles(repoPath, files)
+	used := 0
+	var skipped []string
+	var generatedFiles []GeneratedFile
+	for _, rel := range files {
+		if g, ok := generated[rel]; ok {
+			generatedFiles = append(generatedFiles, g)
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(repoPath, rel))
+		if err != nil {
+			slog.Warn("Skipping unreadable file for code context", "file", rel, "error", err)
+			continue
+		}
+		if isBinary(content) {
+			continue
+		}
+
+		section := renderCodeFileSection(rel, content, keywords, cfg.CodeContext)
+		tokens := EstimateTokens(section)
+		if budget > 0 && used+tokens > budget {
+			skipped = append(skipped, rel)
+			continue
+		}
+		b.WriteString(section)
+		used += tokens
+	}
+
+	if len(skipped) > 0 {
+		b.WriteString("## Omitted Files (token budget exceeded)\n")
+		for _, rel := range skipped {
+			b.WriteString("- " + rel + "\n")
+		}
+	}
+	if len(generatedFiles) > 0 {
+		b.WriteString("\n## Generated Files (do not edit)\n")
+		b.WriteString("These files are generated. Edits to them are discarded; change their source instead.\n\n")
+		b.WriteString(formatGeneratedFiles(generatedFiles))
+	}
+
+	doc := b.String()
+	if outputFile != "" {
+		if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(outputFile, []byte(doc), 0644); err != nil {
+			return "", fmt.Errorf("failed to write code files document: %w", err)
+		}
+	}
+
+	slog.Info("Code files document assembled", "files", len(files), "omitted", len(skipped), "generated", len(generatedFiles), "estimatedTokens", used)
+	return doc, nil
+}
+
+func renderCodeFileSection(rel string, content []byte, keywords []string, cc config.CodeContextConfig) string {
+	language := getLanguage(filepath.Ext(rel))
+	text := string(content)
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("## File: %s\n", rel))
+
+	if cc.WholeFileMaxTokens <= 0 || EstimateTokens(text) <= cc.WholeFileMaxTokens {
+		b.WriteString(fmt.Sprintf("````%s\n", language))
+		b.WriteString(text)
+		if !strings.HasSuffix(text, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString("````\n\n")
+		return b.String()
+	}
+
+	lines := strings.Split(text, "\n")
+	regions := findCodeRegions(rel, content, lines)
+	scoreRegions(regions, lines, keywords)
+
+	var included, omitted []CodeRegion
+	for _, r := range regions {
+		if r.Score > 0 {
+			included = append(included, r)
+		} else {
+			omitted = append(omitted, r)
+		}
+	}
+
+	b.WriteString(fmt.Sprintf("_Large file (%d lines): showing %d of %d regions relevant to the issue._\n\n", len(lines), len(included), len(regions)))
+	for _, r := range included {
+		start := max(1, r.StartLine-cc.RegionContextLines)
+		end := min(len(lines), r.EndLine+cc.RegionContextLines)
+		b.WriteString(fmt.Sprintf("### %s (lines %d-%d)\n", r.Name, start, end))
+		b.WriteString(fmt.Sprintf("````%s\n", language))
+		b.WriteString(strings.Join(lines[start-1:end], "\n"))
+		b.WriteString("\n````\n\n")
+	}
+
+	if len(omitted) > 0 {
+		b.WriteString("**Omitted sections:**\n")
+		for _, r := range omitted {
+			b.WriteString(fmt.Sprintf("- %s (lines %d-%d)\n", r.Name, r.StartLine, r.EndLine))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// findCodeRegions splits a file into top-level declarations. Go files are parsed with
+// go/ast; other languages use the line-based analyzers from the knowledge base builder.
+func findCodeRegions(rel string, content []byte, lines []string) []CodeRegion {
+	if strings.HasSuffix(rel, ".go") {
+		if regions, err := goCodeRegions(content); err == nil {
+			return regions
+		}
+	}
+
+	fileInfo := DevflowFileInfo{RelativePath: rel, Language: getLanguage(filepath.Ext(rel))}
+	if fileInfo.Language != "go" {
+		analyzeFileByLanguage(content, &fileInfo)
+	}
+
+	type marker struct {
+		name string
+		line int
+	}
+	var markers []marker
+	for _, fn := range fileInfo.Functions {
+		markers = append(markers, marker{fn.Name, fn.LineNumber})
+	}
+	for _, cls := range fileInfo.Classes {
+		markers = append(markers, marker{cls.Name, cls.LineNumber})
+	}
+	sort.Slice(markers, func(i, j int) bool { return markers[i].line < markers[j].line })
+
+	var regions []CodeRegion
+	if len(markers) == 0 || markers[0].line > 1 {
+		end := len(lines)
+		if len(markers) > 0 {
+			end = markers[0].line - 1
+		}
+		regions = append(regions, CodeRegion{Name: "header", StartLine: 1, EndLine: end})
+	}
+	for i, m := range markers {
+		end := len(lines)
+		if i+1 < len(markers) {
+			end = markers[i+1].line - 1
+		}
+		if end < m.line {
+			continue
+		}
+		regions = append(regions, CodeRegion{Name: m.name, StartLine: m.line, EndLine: end})
+	}
+	return regions
+}
+
+func goCodeRegions(content []byte) ([]CodeRegion, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var regions []CodeRegion
+	for _, decl := range file.Decls {
+		start := fset.Position(decl.Pos()).Line
+		end := fset.Position(decl.End()).Line
+		name := "declaration"
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				start = fset.Position(d.Doc.Pos()).Line
+			}
+			name = d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				name = fmt.Sprintf("(%s).%s", exprString(d.Recv.List[0].Type), d.Name.Name)
+			}
+		case *ast.GenDecl:
+			if d.Doc != nil {
+				start = fset.Position(d.Doc.Pos()).Line
+			}
+			name = d.Tok.String()
+			if len(d.Specs) == 1 {
+				if ts, ok := d.Specs[0].(*ast.TypeSpec); ok {
+					name = "type " + ts.Name.Name
+				}
+			}
+		}
+		regions = append(regions, CodeRegion{Name: name, StartLine: start, EndLine: end})
+	}
+
+	// Package clause and imports are always useful context
+	if len(regions) > 0 && regions[0].StartLine > 1 {
+		regions = append([]CodeRegion{{Name: "package", StartLine: 1, EndLine: regions[0].StartLine - 1, Score: 1}}, regions...)
+	}
+	for i := range regions {
+		if regions[i].Name == "import" {
+			regions[i].Score = 1
+		}
+	}
+	return regions, nil
+}
+
+func exprString(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return "*" + exprString(e.X)
+	case *ast.Ident:
+		return e.Name
+	case *ast.IndexExpr:
+		return exprString(e.X)
+	default:
+		return "?"
+	}
+}
+
+// scoreRegions counts issue keyword occurrences within each region.
+func scoreRegions(regions []CodeRegion, lines []string, keywords []string) {
+	for i := range regions {
+		r := &regions[i]
+		if r.StartLine < 1 || r.EndLine > len(lines) || r.StartLine > r.EndLine {
+			continue
+		}
+		body := strings.ToLower(strings.Join(lines[r.StartLine-1:r.EndLine], "\n"))
+		for _, kw := range keywords {
+			r.Score += strings.Count(body, kw)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// rootShardName names the shard of the files at the repository root
+const rootShardName = "_root"
+
+// DependencyShard is the part of a sharded dependency graph under one top-level directory
+type DependencyShard struct {
+	Dir       string   `json:"dir"`                  // "" for the files at the repository root
+	File      string   `json:"file"`                 // relative to the index's directory
+	Files     []string `json:"files"`                // so callers pick shards without opening them
+	DependsOn []string `json:"depends_on,omitempty"` // directories of the other shards its files depend on
+}
+
+// Files lists the graph's files. A sharded graph lists them all, whichever shards are loaded.
+func (g *DependencyGraph) Files() []string {
+	var files []string
+	if len(g.Shards) > 0 {
+		for _, shard := range g.Shards {
+			files = append(files, shard.Files...)
+		}
+		return files
+	}
+	for _, node := range g.Nodes {
+		files = append(files, node.File)
+	}
+	return files
+}
+
+// dependencyShardDir is the directory beside a dependency graph index that holds its shards
+func dependencyShardDir(indexFile string) string {
+	return strings.TrimSuffix(indexFile, filepath.Ext(indexFile))
+}
+
+// DependencyShardFiles returns the shard files of the dependency graph at indexFile, none
+// when it is not sharded
+func DependencyShardFiles(indexFile string) []string {
+	graph, err := readDependencyGraph(func(name string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(filepath.Dir(indexFile), filepath.FromSlash(name)))
+	}, filepath.Base(indexFile), func(*DependencyGraph) []string { return nil })
+	if err != nil {
+		return nil
+	}
+	files := make([]string, len(graph.Shards))
+	for i, shard := range graph.Shards {
+		files[i] = filepath.Join(filepath.Dir(indexFile), filepath.FromSlash(shard.File))
+	}
+	return files
+}
+
+func topLevelDir(file string) string {
+	if dir, _, ok := strings.Cut(file, "/"); ok {
+		return dir
+	}
+	return ""
+}
+
+// writeShardedDependencyGraph writes graph as one shard per top-level directory beside
+// indexFile, and indexFile as the index of the shards. Shards are encoded node by node, so
+// a shard is never held serialized in memory whole.
+func writeShardedDependencyGraph(indexFile string, graph DependencyGraph) error {
+	dir := dependencyShardDir(indexFile)
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove old dependency graph shards: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	byDir := map[string][]DependencyNode{}
+	for _, node := range graph.Nodes {
+		byDir[topLevelDir(node.File)] = append(byDir[topLevelDir(node.File)], node)
+	}
+	index := DependencyGraph{GeneratedAt: graph.GeneratedAt, RepoURL: graph.RepoURL}
+	for _, d := range slices.Sorted(maps.Keys(byDir)) {
+		name := d
+		if name == "" {
+			name = rootShardName
+		}
+		shard := DependencyShard{Dir: d, File: path.Join(filepath.Base(dir), name+".json")}
+		dependsOn := map[string]bool{}
+		for _, node := range byDir[d] {
+			shard.Files = append(shard.Files, node.File)
+			for _, dep := range node.Dependencies {
+				if td := topLevelDir(dep); td != d {
+					dependsOn[td] = true
+				}
+			}
+		}
+		shard.DependsOn = slices.Sorted(maps.Keys(dependsOn))
+		if err := writeDependencyShard(filepath.Join(dir, name+".json"), byDir[d]); err != nil {
+			return fmt.Errorf("failed to write dependency graph shard %s: %w", shard.File, err)
+		}
+		index.Shards = append(index.Shards, shard)
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal dependency graph index: %w", err)
+	}
+	return os.WriteFile(indexFile, data, 0644)
+}
+
+func writeDependencyShard(file string, nodes []DependencyNode) (err error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+	}()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	if _, err := w.WriteString(`{"nodes":[`); err != nil {
+		return err
+	}
+	for i, node := range nodes {
+		if i > 0 {
+			if err := w.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(node); err != nil {
+			return err
+		}
+	}
+	if _, err := w.WriteString("]}\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// readDependencyGraph reads the dependency graph index indexName through read, which opens
+// files relative to the index's directory. Of a sharded graph, only the shards of the
+// directories selectShards returns are loaded, all of them when selectShards is nil.
+func readDependencyGraph(read func(name string) ([]byte, error), indexName string, selectShards func(index *DependencyGraph) []string) (*DependencyGraph, error) {
+	data, err := read(indexName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dependency graph: %w", err)
+	}
+	var graph DependencyGraph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		return nil, fmt.Errorf("failed to parse dependency graph: %w", err)
+	}
+	if len(graph.Shards) == 0 {
+		return &graph, nil
+	}
+
+	var dirs []string
+	if selectShards != nil {
+		dirs = selectShards(&graph)
+	}
+	for _, shard := range graph.Shards {
+		if selectShards != nil && !slices.Contains(dirs, shard.Dir) {
+			continue
+		}
+		data, err := read(shard.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dependency graph shard %s: %w", shard.File, err)
+		}
+		var part DependencyGraph
+		if err := json.Unmarshal(data, &part); err != nil {
+			return nil, fmt.Errorf("failed to parse dependency graph shard %s: %w", shard.File, err)
+		}
+		graph.Nodes = append(graph.Nodes, part.Nodes...)
+	}
+	return &graph, nil
+}
+
+// relevantShards selects the shards text is about: those holding the files it names, and
+// those depending on them, which hold the files importing them
+func relevantShards(text string) func(index *DependencyGraph) []string {
+	return func(index *DependencyGraph) []string {
+		named := map[string]bool{}
+		for f := range namedFiles(index.Files(), text) {
+			named[topLevelDir(f)] = true
+		}
+		var dirs []string
+		for _, shard := range index.Shards {
+			if named[shard.Dir] || slices.ContainsFunc(shard.DependsOn, func(d string) bool { return named[d] }) {
+				dirs = append(dirs, shard.Dir)
+			}
+		}
+		return dirs
+	}
+}
+
+// LoadRelevantDependencyGraph reads a dependency graph for a text such as an issue. Of a
+// sharded graph it loads only the shards holding the files the text names and the files
+// importing them; Files still lists every file.
+func LoadRelevantDependencyGraph(graphFile, text string) (*DependencyGraph, error) {
+	return readDependencyGraph(func(name string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(filepath.Dir(graphFile), filepath.FromSlash(name)))
+	}, filepath.Base(graphFile), relevantShards(text))
+}
+
+// namedFiles returns the files text names: in a stack trace, by path, or by a file name no
+// other file shares
+func namedFiles(files []string, text string) map[string]bool {
+	named := map[string]bool{}
+	for _, f := range MapFramesToRepoFiles(ParseStackTraces(text), files) {
+		named[f] = true
+	}
+	byName := map[string][]string{}
+	for _, f := range files {
+		byName[path.Base(f)] = append(byName[path.Base(f)], f)
+		if strings.Contains(text, f) {
+			named[f] = true
+		}
+	}
+	for name, matches := range byName {
+		if len(matches) == 1 && strings.Contains(name, ".") && strings.Contains(text, name) {
+			named[matches[0]] = true
+		}
+	}
+	return named
+}
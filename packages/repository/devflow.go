@@ -2,6 +2,7 @@ package repository
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/fs"
@@ -18,7 +19,7 @@ import (
 
 // DevflowFileInfo represents a file with enhanced metadata for Devflow analysis
 type DevflowFileInfo struct {
-	Path         string
+	Path         string `json:"-"` // absolute path in the clone, kept out of file-metadata.json
 	RelativePath string
 	Size         int64
 	Language     string
@@ -28,6 +29,7 @@ type DevflowFileInfo struct {
 	Exports      []string
 	Purpose      string
 	Role         string
+	Generated    *GeneratedFile `json:",omitempty"` // set for generated files, which get no summary
 }
 
 // FunctionInfo represents a function within a file
@@ -58,11 +60,14 @@ type DependencyNode struct {
 	Imports      []string `json:"imports"`
 }
 
-// DependencyGraph represents the complete dependency graph
+// DependencyGraph represents the complete dependency graph. A graph of more files than
+// knowledge_base.graph_shard_files is written as an index of Shards, one per top-level
+// directory, whose nodes are only loaded when read.
 type DependencyGraph struct {
-	Nodes       []DependencyNode `json:"nodes"`
-	GeneratedAt time.Time        `json:"generated_at"`
-	RepoURL     string           `json:"repo_url"`
+	Nodes       []DependencyNode  `json:"nodes"`
+	GeneratedAt time.Time         `json:"generated_at,omitzero"` // zero in deterministic mode
+	RepoURL     string            `json:"repo_url"`
+	Shards      []DependencyShard `json:"shards,omitempty"`
 }
 
 // CreateDirectory creates a directory if it doesn't exist
@@ -95,7 +100,7 @@ This document provides a comprehensive overview of the repository structure and
 
 ## Directory Structure
 
-`, repoName, repoURL, time.Now().Format("2006-01-02 15:04:05"))
+`, repoName, repoURL, generatedStamp())
 
 	writer.WriteString(header)
 
@@ -189,8 +194,8 @@ This document provides a comprehensive overview of the repository structure and
 }
 
 // GenerateRepoAnalysis creates an LLM-generated analysis of the repository
-func GenerateRepoAnalysis(repoPath, repoURL, outputFile string) error {
-	slog.Info("Generating repository analysis", "output", outputFile)
+func GenerateRepoAnalysis(ctx context.Context, repoPath, repoURL, outputFile string) error {
+	slog.InfoContext(ctx, "Generating repository analysis", "output", outputFile)
 
 	// First, analyze all files to extract metadata
 	files, err := analyzeFilesForDevflow(repoPath)
@@ -221,7 +226,7 @@ func GenerateRepoAnalysis(repoPath, repoURL, outputFile string) error {
 		Files:   aiFiles,
 	}
 
-	result, err := ai.AnalyzeRepositoryWithAI(analysis)
+	result, err := ai.AnalyzeRepositoryWithAI(ctx, analysis)
 	if err != nil {
 		return fmt.Errorf("failed to generate AI analysis: %w", err)
 	}
@@ -234,15 +239,27 @@ func GenerateRepoAnalysis(repoPath, repoURL, outputFile string) error {
 func GenerateDependencyGraph(repoPath, outputFile string) error {
 	slog.Info("Generating dependency graph", "output", outputFile)
 
-	nodes, err := buildDependencyGraph(repoPath)
+	nodes, err := BuildDependencyGraph(OSFS(repoPath))
 	if err != nil {
 		return fmt.Errorf("failed to build dependency graph: %w", err)
 	}
 
 	graph := DependencyGraph{
-		Nodes:       nodes,
-		GeneratedAt: time.Now(),
-		RepoURL:     "", // Will be set by caller if needed
+		Nodes:   nodes,
+		RepoURL: "", // Will be set by caller if needed
+	}
+	if !config.GetConfig().KnowledgeBase.Deterministic {
+		graph.GeneratedAt = time.Now()
+	}
+
+	shardDir := dependencyShardDir(outputFile)
+	if limit := config.GetConfig().KnowledgeBase.GraphShardFiles; limit > 0 && len(nodes) > limit {
+		slog.Info("Sharding dependency graph by top-level directory", "files", len(nodes), "dir", shardDir)
+		return writeShardedDependencyGraph(outputFile, graph)
+	}
+	// A graph that shrank below the threshold leaves no stale shards behind
+	if err := os.RemoveAll(shardDir); err != nil {
+		return fmt.Errorf("failed to remove old dependency graph shards: %w", err)
 	}
 
 	jsonData, err := json.MarshalIndent(graph, "", "  ")
@@ -253,15 +270,53 @@ func GenerateDependencyGraph(repoPath, outputFile string) error {
 	return os.WriteFile(outputFile, jsonData, 0644)
 }
 
-// SaveFileMetadata saves the extracted file metadata as JSON
-func SaveFileMetadata(repoPath, outputFile string) error {
-	slog.Info("Saving file metadata", "output", outputFile)
+// LoadDependencyGraph reads a previously generated dependency graph, with all the shards of
+// a sharded one
+func LoadDependencyGraph(graphFile string) (*DependencyGraph, error) {
+	return readDependencyGraph(func(name string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(filepath.Dir(graphFile), filepath.FromSlash(name)))
+	}, filepath.Base(graphFile), nil)
+}
+
+// SaveFileMetadata saves the extracted file metadata as JSON, with each file's Purpose
+// filled from an LLM-generated summary
+func SaveFileMetadata(ctx context.Context, repoPath, outputFile string) error {
+	slog.InfoContext(ctx, "Saving file metadata", "output", outputFile)
 
 	files, err := analyzeFilesForDevflow(repoPath)
 	if err != nil {
 		return fmt.Errorf("failed to analyze files for metadata: %w", err)
 	}
 
+	rels := make([]string, len(files))
+	for i, f := range files {
+		rels[i] = f.RelativePath
+	}
+	generated := FindGeneratedFiles(repoPath, rels)
+	var inputs []ai.FileSummaryInput
+	for i, f := range files {
+		if g, ok := generated[f.RelativePath]; ok {
+			files[i].Generated = &g
+			continue
+		}
+		if f.Language == "" {
+			continue
+		}
+		content, err := os.ReadFile(f.Path)
+		if err != nil {
+			continue
+		}
+		inputs = append(inputs, ai.FileSummaryInput{Path: f.RelativePath, Language: f.Language, Content: string(content)})
+	}
+	summaries, err := ai.SummarizeFiles(ctx, inputs)
+	if err != nil {
+		// Keep whatever was summarized before the failure
+		slog.WarnContext(ctx, "File summaries incomplete", "error", err)
+	}
+	for i := range files {
+		files[i].Purpose = summaries[files[i].RelativePath]
+	}
+
 	jsonData, err := json.MarshalIndent(files, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal file metadata: %w", err)
@@ -281,45 +336,10 @@ func SaveAnalysisPrompt(repoPath, repoURL, structureFile, outputFile string) err
 	}
 
 	// Create the LLM prompt using the repo structure content
-	prompt := fmt.Sprintf(`You are an expert code analyst. Analyze the following repository and provide comprehensive insights about the codebase.
-
-# Repository Information
-**Repository URL:** %s
-
-# Repository Structure and Code Analysis
-%s
-
-# Your Task
-Provide a comprehensive analysis in markdown format that includes:
-
-## Repository Overview
-1. **Project Type**: What kind of project is this? (web app, CLI tool, library, etc.)
-2. **Architecture**: Describe the overall architecture and structure
-3. **Technology Stack**: Identify the main technologies and frameworks used
-4. **Entry Points**: Identify the main entry points and how the application starts
-
-## File Analysis
-For each important file, provide:
-1. **Purpose**: What is this file's primary purpose?
-2. **Role**: How does it fit into the larger system?
-3. **Key Functions/Classes**: Brief description of main functions/classes and their logic
-4. **Dependencies**: What other files/modules does it depend on?
-5. **Business Logic**: What business rules or logic does it implement?
-
-## System Relationships
-1. **Data Flow**: How does data flow through the system?
-2. **Key Components**: What are the most important components?
-3. **Integration Points**: Where do different parts of the system connect?
-4. **API/Interface Design**: How do components communicate?
-
-## Development Insights
-1. **Code Quality**: Overall assessment of code organization and patterns
-2. **Design Patterns**: What design patterns are used?
-3. **Potential Issues**: Any obvious problems or areas for improvement?
-4. **Scalability**: How well would this scale?
-5. **Maintainability**: How easy would this be to maintain and extend?
-
-Format your response in clean markdown with appropriate headers and code blocks. Be specific and detailed in your analysis, referencing actual code when relevant.`, repoURL, string(structureContent))
+	prompt, err := ai.BuildRepoStructurePrompt(repoURL, string(structureContent))
+	if err != nil {
+		return err
+	}
 
 	// Add header to make it clear this is the LLM input
 	promptWithHeader := fmt.Sprintf(`# LLM Analysis Prompt
@@ -334,8 +354,8 @@ This file contains the exact prompt that would be sent to the LLM for repository
 }
 
 // GenerateRepoAnalysisWithLLM generates AI analysis using the repo structure content
-func GenerateRepoAnalysisWithLLM(repoPath, repoURL, structureFile, outputFile string) error {
-	slog.Info("Generating LLM analysis", "output", outputFile)
+func GenerateRepoAnalysisWithLLM(ctx context.Context, repoPath, repoURL, structureFile, outputFile string) error {
+	slog.InfoContext(ctx, "Generating LLM analysis", "output", outputFile)
 
 	// Read the repo-structure.md file (created by RepoAnalyzer)
 	structureContent, err := os.ReadFile(structureFile)
@@ -350,12 +370,21 @@ func GenerateRepoAnalysisWithLLM(repoPath, repoURL, structureFile, outputFile st
 	}
 
 	// Generate AI analysis
-	result, err := ai.AnalyzeRepositoryFromStructure(analysis)
+	result, err := ai.AnalyzeRepositoryFromStructure(ctx, analysis)
 	if err != nil {
 		return fmt.Errorf("failed to generate AI analysis: %w", err)
 	}
 
-	return os.WriteFile(outputFile, []byte(result.MarkdownContent), 0644)
+	if err := os.WriteFile(outputFile, []byte(result.MarkdownContent), 0644); err != nil {
+		return err
+	}
+
+	// Section index so agents can load only the parts of the analysis they need
+	indexFile := filepath.Join(filepath.Dir(outputFile), config.GetConfig().Files.AnalysisIndexFile)
+	if err := ai.WriteAnalysisIndex(repoPath, outputFile, indexFile); err != nil {
+		slog.WarnContext(ctx, "Failed to write analysis index", "error", err)
+	}
+	return nil
 }
 
 // CreateDevflowReadme creates a README file for the .devflow directory
@@ -368,12 +397,16 @@ This directory contains the Devflow knowledge base for **%s**.
 
 ## Files
 
-- **repo-structure.md**: Flattened repository structure with complete file contents and AST analysis
-- **file-metadata.json**: Extracted metadata (functions, classes, imports) from all source files
+- **repo-structure.md**: Flattened repository structure with complete file contents (excerpts and an outline for large files) and AST analysis
+- **file-metadata.json**: Extracted metadata (functions, classes, imports) and a short LLM summary of each source file
 - **repo-analysis-prompt.md**: The exact prompt that would be sent to the LLM for analysis
 - **dependency-graph.json**: Dependency relationships between files
+- **infrastructure.md**: Database migrations, Terraform/CloudFormation resources, Dockerfiles, Compose services and Kubernetes objects
+- **api-surface.md**: Condensed OpenAPI/Swagger operations, GraphQL schema and protobuf services
 - **repo-analysis.md**: AI-generated analysis (created when LLM analysis is enabled)
+- **repo-analysis-index.json**: Byte offsets of each repo-analysis.md section and the files it mentions
 - **README.md**: This file
+- **kb-meta.json**: The knowledge base schema version, when it was generated and a content hash of each file
 
 ## Purpose
 
@@ -390,7 +423,7 @@ These files are automatically generated and maintained by the Devflow agent. The
 ---
 
 *This knowledge base was generated by Devflow Agent*
-`, repoName, time.Now().Format("2006-01-02 15:04:05"))
+`, repoName, generatedStamp())
 
 	return os.WriteFile(outputFile, []byte(readme), 0644)
 }
@@ -485,6 +518,7 @@ func identifyKeyDirectories(allPaths map[string]bool) []KeyDirectory {
 			}
 		}
 	}
+	sort.Slice(keyDirs, func(i, j int) bool { return keyDirs[i].Name < keyDirs[j].Name })
 
 	return keyDirs
 }
@@ -536,14 +570,7 @@ func analyzeFilesForDevflow(repoPath string) ([]DevflowFileInfo, error) {
 		}
 
 		// Analyze file content based on language
-		switch language {
-		case "go":
-			analyzeGoFile(content, &fileInfo)
-		case "javascript", "typescript":
-			analyzeJSFile(content, &fileInfo)
-		case "python":
-			analyzePythonFile(content, &fileInfo)
-		}
+		analyzeFileByLanguage(content, &fileInfo)
 
 		files = append(files, fileInfo)
 		return nil
@@ -552,33 +579,30 @@ func analyzeFilesForDevflow(repoPath string) ([]DevflowFileInfo, error) {
 	return files, err
 }
 
-func buildDependencyGraph(repoPath string) ([]DependencyNode, error) {
+// BuildDependencyGraph lists the files of a checkout with the imports and exports that link them
+func BuildDependencyGraph(fsys FS) ([]DependencyNode, error) {
 	var nodes []DependencyNode
 
-	err := filepath.WalkDir(repoPath, func(path string, d fs.DirEntry, err error) error {
+	err := fs.WalkDir(fsys, ".", func(relPath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if relPath == "." {
+			return nil
+		}
 
 		if d.IsDir() {
-			if shouldIgnoreForStructure(path, d.Name()) {
+			if shouldIgnoreForStructure(relPath, d.Name()) {
 				return fs.SkipDir
 			}
 			return nil
 		}
 
-		relPath, _ := filepath.Rel(repoPath, path)
-		if relPath == "." {
-			return nil
-		}
-
-		relPath = strings.ReplaceAll(relPath, "\\", "/")
-
 		if shouldIgnoreForStructure(relPath, d.Name()) {
 			return nil
 		}
 
-		content, err := os.ReadFile(path)
+		content, err := fsys.ReadFile(relPath)
 		if err != nil {
 			return nil
 		}
@@ -599,20 +623,17 @@ func buildDependencyGraph(repoPath string) ([]DependencyNode, error) {
 		}
 
 		// Extract dependencies based on language
-		switch language {
-		case "go":
-			extractGoDependencies(content, &node)
-		case "javascript", "typescript":
-			extractJSDependencies(content, &node)
-		case "python":
-			extractPythonDependencies(content, &node)
-		}
+		extractDependenciesByLanguage(content, &node)
 
 		nodes = append(nodes, node)
 		return nil
 	})
+	if err != nil {
+		return nodes, err
+	}
 
-	return nodes, err
+	resolveDependencies(nodes)
+	return nodes, nil
 }
 
 // Language-specific analysis functions
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"devflow-agent/packages/githubapi"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// Discussion is the part of a GitHub Discussion DevFlow works with
+type Discussion struct {
+	NodeID      string // GraphQL ID, needed to comment
+	Number      int
+	Title       string
+	Body        string
+	Category    string
+	AuthorLogin string
+	HTMLURL     string
+	Labels      []string
+}
+
+// DiscussionEvent is a parsed discussion or discussion_comment webhook
+type DiscussionEvent struct {
+	Type           string // "discussion" or "discussion_comment"
+	Action         string
+	RepoName       string
+	InstallationID int64
+	Discussion     Discussion
+	Label          string // the label added, for "labeled"
+	CommentBody    string // for discussion_comment
+	CommentAuthor  string
+	SenderIsBot    bool
+}
+
+type discussionPayload struct {
+	Action     string `json:"action"`
+	Discussion struct {
+		NodeID   string `json:"node_id"`
+		Number   int    `json:"number"`
+		Title    string `json:"title"`
+		Body     string `json:"body"`
+		HTMLURL  string `json:"html_url"`
+		Category struct {
+			Name string `json:"name"`
+		} `json:"category"`
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		Labels []struct {
+			Name string `json:"name"`
+		} `json:"labels"`
+	} `json:"discussion"`
+	Label struct {
+		Name string `json:"name"`
+	} `json:"label"`
+	Comment struct {
+		Body string `json:"body"`
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	} `json:"comment"`
+	Sender struct {
+		Type string `json:"type"`
+	} `json:"sender"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Installation struct {
+		ID int64 `json:"id"`
+	} `json:"installation"`
+}
+
+// ParseDiscussionEvent parses a discussion or discussion_comment webhook, which the go-github
+// version probot uses does not know
+func ParseDiscussionEvent(eventType string, payload []byte) (*DiscussionEvent, error) {
+	if eventType != "discussion" && eventType != "discussion_comment" {
+		return nil, fmt.Errorf("unsupported discussion event %q", eventType)
+	}
+	var p discussionPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse %s payload: %w", eventType, err)
+	}
+	d := p.Discussion
+	ev := &DiscussionEvent{
+		Type:           eventType,
+		Action:         p.Action,
+		RepoName:       p.Repository.FullName,
+		InstallationID: p.Installation.ID,
+		Discussion: Discussion{
+			NodeID:      d.NodeID,
+			Number:      d.Number,
+			Title:       d.Title,
+			Body:        d.Body,
+			Category:    d.Category.Name,
+			AuthorLogin: d.User.Login,
+			HTMLURL:     d.HTMLURL,
+		},
+		Label:         p.Label.Name,
+		CommentBody:   p.Comment.Body,
+		CommentAuthor: p.Comment.User.Login,
+		SenderIsBot:   p.Sender.Type == "Bot",
+	}
+	for _, l := range d.Labels {
+		ev.Discussion.Labels = append(ev.Discussion.Labels, l.Name)
+	}
+	return ev, nil
+}
+
+// PostDiscussionComment replies on a discussion
+func PostDiscussionComment(ctx *probot.Context, d Discussion, body string) error {
+	if err := NewGitHubClient(ctx).AddDiscussionComment(context.Background(), d.NodeID, body); err != nil {
+		return fmt.Errorf("failed to comment on discussion #%d: %w", d.Number, err)
+	}
+	return nil
+}
+
+// CreateIssue opens an issue with the given labels
+func CreateIssue(ctx *probot.Context, repoName, title, body string, labels []string) (*githubapi.Issue, error) {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return nil, err
+	}
+	issue, err := NewGitHubClient(ctx).CreateIssue(context.Background(), owner, repo, githubapi.NewIssue{Title: title, Body: body, Labels: labels})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create issue: %w", err)
+	}
+	return issue, nil
+}
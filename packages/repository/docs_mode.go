@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// docExtensions are file types that are documentation in their entirety
+var docExtensions = map[string]bool{
+	".md": true, ".markdown": true, ".mdx": true, ".rst": true, ".adoc": true, ".txt": true,
+}
+
+// commentPrefixes start a comment line in the languages the knowledge base analyzes
+var commentPrefixes = []string{"//", "#", "/*", "*", "*/", "--", `"""`, "'''", "///", "<!--"}
+
+// IsDocumentationPath reports whether a repository-relative path is a documentation file
+func IsDocumentationPath(path string) bool {
+	path = filepath.ToSlash(path)
+	if strings.HasPrefix(path, "docs/") || strings.HasPrefix(path, "doc/") || strings.Contains(path, "/docs/") {
+		return true
+	}
+	return docExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// SplitDocumentationChanges separates changed files into documentation changes and code
+// changes. Source files count as documentation only when every changed line is a comment
+// or blank, which covers godoc/docstring updates.
+func SplitDocumentationChanges(repoPath string, files []string) (docs, code []string) {
+	for _, f := range files {
+		if IsDocumentationPath(f) || commentOnlyDiff(repoPath, f) {
+			docs = append(docs, f)
+		} else {
+			code = append(code, f)
+		}
+	}
+	return docs, code
+}
+
+// commentOnlyDiff reports whether the working-tree changes to a tracked file only add,
+// remove or edit comment lines
+func commentOnlyDiff(repoPath, file string) bool {
+	out, err := git(repoPath, "diff", "--unified=0", "HEAD", "--", file)
+	if err != nil || strings.TrimSpace(out) == "" {
+		// Untracked (new) source files are code
+		return false
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---") {
+			continue
+		}
+		if !strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "-") {
+			continue
+		}
+		text := strings.TrimSpace(line[1:])
+		if text == "" {
+			continue
+		}
+		isComment := false
+		for _, prefix := range commentPrefixes {
+			if strings.HasPrefix(text, prefix) {
+				isComment = true
+				break
+			}
+		}
+		if !isComment {
+			return false
+		}
+	}
+	return true
+}
+
+// DocsModeNote explains in the PR why code changes were left out of a documentation run
+func DocsModeNote(code []string) string {
+	return "### Code changes discarded\n\nThis issue was handled in documentation mode, so the following non-documentation changes were not included:\n\n- " +
+		strings.Join(code, "\n- ")
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// DuplicatePR is an open DevFlow pull request equivalent to one about to be opened
+type DuplicatePR struct {
+	PR          githubapi.PullRequest
+	PathOverlap float64 // Jaccard index of the changed paths
+	Similarity  float64 // cosine similarity of the descriptions
+}
+
+// FindDuplicatePR looks for an open DevFlow pull request in repoName that changes the same
+// paths as the planned one and describes the same change. description is the planned PR's
+// title and summary. It returns nil when there is none or the check is disabled.
+func FindDuplicatePR(ctx *probot.Context, repoName string, paths []string, description string) (*DuplicatePR, error) {
+	cfg := config.GetConfig()
+	if !cfg.PullRequests.Duplicates.Enabled || len(paths) == 0 {
+		return nil, nil
+	}
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return nil, err
+	}
+	client := NewGitHubClient(ctx)
+
+	open, err := client.ListPullRequests(context.Background(), owner, repo, "open", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list open pull requests: %w", err)
+	}
+
+	// Comparing paths is cheap, so only PRs that pass it are embedded
+	var candidates []DuplicatePR
+	for _, pr := range open {
+		if !isDevflowPR(pr, repoName) {
+			continue
+		}
+		files, err := client.ListPullRequestFiles(context.Background(), owner, repo, pr.Number)
+		if err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to list files of open pull request", "repo", repoName, "prNumber", pr.Number, "error", err)
+			continue
+		}
+		prPaths := make([]string, 0, len(files))
+		for _, f := range files {
+			prPaths = append(prPaths, f.Filename)
+		}
+		if overlap := pathOverlap(paths, prPaths); overlap >= cfg.PullRequests.Duplicates.MinPathOverlap {
+			candidates = append(candidates, DuplicatePR{PR: pr, PathOverlap: overlap})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	texts := []string{description}
+	for _, c := range candidates {
+		texts = append(texts, c.PR.Title+"\n\n"+c.PR.Body)
+	}
+	vectors, err := ai.EmbedTexts(context.Background(), texts)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *DuplicatePR
+	for i := range candidates {
+		candidates[i].Similarity = ai.CosineSimilarity(vectors[0], vectors[i+1])
+		slog.DebugContext(logging.For(ctx), "Compared planned pull request with open one", "repo", repoName, "prNumber", candidates[i].PR.Number,
+			"pathOverlap", candidates[i].PathOverlap, "similarity", candidates[i].Similarity)
+		if candidates[i].Similarity >= cfg.PullRequests.Duplicates.MinSimilarity && (best == nil || candidates[i].Similarity > best.Similarity) {
+			best = &candidates[i]
+		}
+	}
+	return best, nil
+}
+
+// isDevflowPR reports whether a pull request was opened by DevFlow for an issue: its head is
+// an issue branch in the repository itself
+func isDevflowPR(pr githubapi.PullRequest, repoName string) bool {
+	prefix := config.GetConfig().Issues.BranchPrefix
+	return prefix != "" && strings.HasPrefix(pr.HeadRef, prefix) && strings.EqualFold(pr.HeadRepo, repoName)
+}
+
+// pathOverlap returns the Jaccard index of two sets of paths
+func pathOverlap(a, b []string) float64 {
+	set := make(map[string]bool, len(a))
+	for _, p := range a {
+		set[p] = true
+	}
+	union := len(set)
+	shared := 0
+	seen := make(map[string]bool, len(b))
+	for _, p := range b {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if set[p] {
+			shared++
+		} else {
+			union++
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
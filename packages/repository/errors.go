@@ -0,0 +1,59 @@
+package repository
+
+import "fmt"
+
+// CloneError reports that the repository could not be cloned or checked out
+type CloneError struct {
+	RepoName string
+	Err      error
+}
+
+func (e *CloneError) Error() string {
+	return fmt.Sprintf("failed to clone %s: %v", e.RepoName, e.Err)
+}
+
+func (e *CloneError) Unwrap() error { return e.Err }
+
+// KBMissingError reports that the repository has no DevFlow knowledge base yet
+type KBMissingError struct {
+	RepoName string
+}
+
+func (e *KBMissingError) Error() string {
+	return fmt.Sprintf("devflow knowledge base not initialized for repo %s", e.RepoName)
+}
+
+// KBSchemaError reports a knowledge base written by a newer agent than this one, whose
+// format this agent cannot read
+type KBSchemaError struct {
+	Found     int
+	Supported int
+}
+
+func (e *KBSchemaError) Error() string {
+	return fmt.Sprintf("knowledge base schema version %d is newer than the supported version %d", e.Found, e.Supported)
+}
+
+// CommitError reports that changes could not be committed to the work branch
+type CommitError struct {
+	Branch string
+	Err    error
+}
+
+func (e *CommitError) Error() string {
+	return fmt.Sprintf("failed to commit to branch %s: %v", e.Branch, e.Err)
+}
+
+func (e *CommitError) Unwrap() error { return e.Err }
+
+// PRError reports that the branch was pushed but the pull request could not be opened
+type PRError struct {
+	Branch string
+	Err    error
+}
+
+func (e *PRError) Error() string {
+	return fmt.Sprintf("failed to open pull request for branch %s: %v", e.Branch, e.Err)
+}
+
+func (e *PRError) Unwrap() error { return e.Err }
@@ -0,0 +1,24 @@
+package repository
+
+import "strings"
+
+// ProposedDiff renders the uncommitted changes to files as one unified diff, new files
+// included, cut at a line boundary once it exceeds maxBytes (0 keeps it whole)
+func ProposedDiff(repoPath string, files []string, maxBytes int) string {
+	if len(files) == 0 {
+		return ""
+	}
+	// New files only show up in the diff once git knows about them
+	for _, f := range files {
+		_, _ = git(repoPath, "add", "--intent-to-add", "--", f)
+	}
+	out, err := git(repoPath, append([]string{"diff", "--no-color", "HEAD", "--"}, files...)...)
+	if err != nil {
+		return ""
+	}
+	if maxBytes > 0 && len(out) > maxBytes {
+		cut := strings.LastIndex(out[:maxBytes], "\n")
+		out = out[:cut+1] + "... (diff truncated)\n"
+	}
+	return out
+}
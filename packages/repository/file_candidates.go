@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"log/slog"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+)
+
+// Weights of the signals that make a file a candidate for an issue
+const (
+	weightStackTrace = 1.0
+	weightPath       = 0.8
+	weightFileName   = 0.6
+	weightKeyword    = 0.1 // per distinct issue keyword in the file's path or summary
+	maxKeywordWeight = 0.5
+	weightNeighbour  = 0.3 // imports, or is imported by, a file the issue names
+)
+
+// RankFileCandidates scores the files of the knowledge base by how likely an issue is about
+// them and returns the best limit (all when limit is 0), highest first. Each candidate says why
+// it was picked: a stack trace frame, its path or name in the issue text, issue keywords in its
+// path or summary, or a dependency on a file the issue names. Scores are clamped to 0-1.
+func RankFileCandidates(repoPath, issueText string, summaries map[string]string, limit int) []ai.FileCandidate {
+	cfg := config.GetConfig()
+	var files []string
+	var graph *DependencyGraph
+	if g, err := LoadRelevantDependencyGraph(cfg.GetDevflowPath(repoPath, cfg.Files.DependencyFile), issueText); err != nil {
+		slog.Warn("Dependency graph unavailable, ranking summarized files only", "error", err)
+		for f := range summaries {
+			files = append(files, f)
+		}
+		sort.Strings(files)
+	} else {
+		graph = g
+		files = g.Files()
+	}
+	return rankFileCandidates(files, graph, summaries, issueText, limit)
+}
+
+// rankFileCandidates ranks files, the nodes of graph when it is not nil, against text
+func rankFileCandidates(files []string, graph *DependencyGraph, summaries map[string]string, text string, limit int) []ai.FileCandidate {
+	scores := map[string]float64{}
+	reasons := map[string][]string{}
+	add := func(file string, weight float64, reason string) {
+		scores[file] += weight
+		reasons[file] = append(reasons[file], reason)
+	}
+
+	named := map[string]bool{}
+	for _, f := range MapFramesToRepoFiles(ParseStackTraces(text), files) {
+		add(f, weightStackTrace, "in a stack trace of the issue")
+		named[f] = true
+	}
+	byName := map[string][]string{}
+	for _, f := range files {
+		byName[path.Base(f)] = append(byName[path.Base(f)], f)
+	}
+	for _, f := range files {
+		if strings.Contains(text, f) {
+			add(f, weightPath, "path named in the issue")
+			named[f] = true
+		} else if matches := byName[path.Base(f)]; len(matches) == 1 && strings.Contains(path.Base(f), ".") && strings.Contains(text, path.Base(f)) {
+			// A bare file name only counts when no other file shares it
+			add(f, weightFileName, "file name named in the issue")
+			named[f] = true
+		}
+	}
+
+	keywords := ExtractIssueKeywords(text)
+	for _, f := range files {
+		lower := strings.ToLower(f + " " + summaries[f])
+		var matched []string
+		for _, kw := range keywords {
+			if strings.Contains(lower, kw) {
+				matched = append(matched, kw)
+			}
+		}
+		if len(matched) > 0 {
+			shown := matched[:min(len(matched), 5)]
+			add(f, min(weightKeyword*float64(len(matched)), maxKeywordWeight), "matches issue keywords: "+strings.Join(shown, ", "))
+		}
+	}
+
+	if graph != nil && len(named) > 0 {
+		for _, node := range graph.Nodes {
+			for _, dep := range node.Dependencies {
+				if named[node.File] && !named[dep] {
+					add(dep, weightNeighbour, "imported by "+node.File)
+				}
+				if named[dep] && !named[node.File] {
+					add(node.File, weightNeighbour, "imports "+dep)
+				}
+			}
+		}
+	}
+
+	ranked := make([]string, 0, len(scores))
+	for f := range scores {
+		ranked = append(ranked, f)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i]] != scores[ranked[j]] {
+			return scores[ranked[i]] > scores[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
+	})
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	out := make([]ai.FileCandidate, 0, len(ranked))
+	for _, f := range ranked {
+		out = append(out, ai.FileCandidate{File: f, Score: math.Round(min(scores[f], 1)*100) / 100, Reasons: reasons[f]})
+	}
+	return out
+}
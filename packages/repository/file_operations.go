@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"devflow-agent/packages/ai"
+)
+
+// FileOperations lists the deletions and renames among an agent's changed files, as they stand
+// in the checkout. Renames the agent reported are kept when the checkout still shows them; a
+// deleted file whose HEAD content was written unchanged to a new path is a rename too.
+func FileOperations(repoPath string, changed []string, reported []ai.FileOperation) []ai.FileOperation {
+	var deleted, added []string
+	for _, rel := range changed {
+		_, err := os.Lstat(filepath.Join(repoPath, rel))
+		switch {
+		case os.IsNotExist(err) && existsAtHead(repoPath, rel):
+			deleted = append(deleted, rel)
+		case err == nil && !existsAtHead(repoPath, rel):
+			added = append(added, rel)
+		}
+	}
+
+	var ops []ai.FileOperation
+	renamed := map[string]bool{}
+	rename := func(from, to string) {
+		ops = append(ops, ai.FileOperation{Op: ai.FileOpRename, Path: to, From: from})
+		renamed[from], renamed[to] = true, true
+	}
+	for _, op := range reported {
+		if op.Op == ai.FileOpRename && slices.Contains(deleted, op.From) && slices.Contains(added, op.Path) && !renamed[op.From] && !renamed[op.Path] {
+			rename(op.From, op.Path)
+		}
+	}
+	for _, from := range deleted {
+		if renamed[from] {
+			continue
+		}
+		headSHA, err := git(repoPath, "rev-parse", "HEAD:"+filepath.ToSlash(from))
+		if err != nil {
+			continue
+		}
+		for _, to := range added {
+			if renamed[to] {
+				continue
+			}
+			if sha, err := git(repoPath, "hash-object", "--", to); err == nil && strings.TrimSpace(sha) == strings.TrimSpace(headSHA) {
+				rename(from, to)
+				break
+			}
+		}
+	}
+	for _, rel := range deleted {
+		if !renamed[rel] {
+			ops = append(ops, ai.FileOperation{Op: ai.FileOpDelete, Path: rel})
+		}
+	}
+	return ops
+}
+
+// FormatFileOperations renders deletions and renames as a markdown list
+func FormatFileOperations(ops []ai.FileOperation) string {
+	var b strings.Builder
+	for _, op := range ops {
+		switch op.Op {
+		case ai.FileOpRename:
+			b.WriteString(fmt.Sprintf("- Renamed `%s` to `%s`\n", op.From, op.Path))
+		case ai.FileOpDelete:
+			b.WriteString(fmt.Sprintf("- Deleted `%s`\n", op.Path))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+
+	"devflow-agent/packages/config"
+)
+
+// PredictIssueFiles estimates the files a run of an issue will change, from the dependency
+// graph on the default branch of the repository's cached mirror: the files the issue names,
+// by path, unique file name or stack trace, together with the files they import and the files
+// importing them. It returns nil when there is no mirror or graph or the issue names no file,
+// meaning the run may change anything.
+func PredictIssueFiles(repoName, issueText string) []string {
+	cfg := config.GetConfig()
+	if cfg.Repository.MirrorCacheDir == "" {
+		return nil
+	}
+	mirror := mirrorPath(cfg.Repository.MirrorCacheDir, repoName)
+	if _, err := os.Stat(filepath.Join(mirror, "HEAD")); err != nil {
+		return nil
+	}
+	read := func(name string) ([]byte, error) {
+		out, err := git(mirror, "show", "origin/"+cfg.Repository.DefaultBranch+":"+path.Join(cfg.Repository.DevflowDirectory, name))
+		return []byte(out), err
+	}
+	graph, err := readDependencyGraph(read, cfg.Files.DependencyFile, relevantShards(issueText))
+	if err != nil {
+		slog.Debug("No dependency graph in mirror to predict changed files", "repo", repoName, "error", err)
+		return nil
+	}
+	return predictFiles(graph, issueText)
+}
+
+// predictFiles returns the graph's files named in text with their direct neighbours
+func predictFiles(graph *DependencyGraph, text string) []string {
+	files := graph.Files()
+	named := namedFiles(files, text)
+	if len(named) == 0 {
+		return nil
+	}
+
+	predicted := map[string]bool{}
+	for _, node := range graph.Nodes {
+		if named[node.File] {
+			predicted[node.File] = true
+			for _, dep := range node.Dependencies {
+				predicted[dep] = true
+			}
+			continue
+		}
+		for _, dep := range node.Dependencies {
+			if named[dep] {
+				predicted[node.File] = true
+				break
+			}
+		}
+	}
+	out := make([]string, 0, len(predicted))
+	for _, f := range files {
+		if predicted[f] {
+			out = append(out, f)
+		}
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// LoadFileSummaries reads file-metadata.json and returns the non-empty summaries by
+// repository-relative path; generated files have none
+func LoadFileSummaries(metadataFile string) (map[string]string, error) {
+	data, err := os.ReadFile(metadataFile)
+	if err != nil {
+		return nil, err
+	}
+	var files []DevflowFileInfo
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("failed to parse file metadata: %w", err)
+	}
+
+	summaries := make(map[string]string)
+	for _, f := range files {
+		if f.Purpose != "" && f.Generated == nil {
+			summaries[f.RelativePath] = f.Purpose
+		}
+	}
+	return summaries, nil
+}
+
+// RankFileSummaries orders the summarized files by how often the text's keywords appear in
+// their path and summary, most relevant first (ties by path)
+func RankFileSummaries(summaries map[string]string, text string) []string {
+	keywords := ExtractIssueKeywords(text)
+	scores := make(map[string]int, len(summaries))
+	paths := make([]string, 0, len(summaries))
+	for path, summary := range summaries {
+		lower := strings.ToLower(path + " " + summary)
+		for _, kw := range keywords {
+			scores[path] += strings.Count(lower, kw)
+		}
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if scores[paths[i]] != scores[paths[j]] {
+			return scores[paths[i]] > scores[paths[j]]
+		}
+		return paths[i] < paths[j]
+	})
+	return paths
+}
+
+// RelevantFiles returns up to limit summarized files that share at least one keyword with
+// the text, most relevant first
+func RelevantFiles(summaries map[string]string, text string, limit int) []string {
+	keywords := ExtractIssueKeywords(text)
+	var files []string
+	for _, path := range RankFileSummaries(summaries, text) {
+		if len(files) == limit {
+			break
+		}
+		lower := strings.ToLower(path + " " + summaries[path])
+		for _, kw := range keywords {
+			if strings.Contains(lower, kw) {
+				files = append(files, path)
+				break
+			}
+		}
+	}
+	return files
+}
+
+// RenderFileSummaries renders file summaries as a prompt section, most relevant to the
+// issue first, stopping once maxTokens is reached (0 means no limit)
+func RenderFileSummaries(summaries map[string]string, issueText string, maxTokens int) string {
+	if len(summaries) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("## File summaries\n\nUse these summaries to decide which files to read.\n\n")
+	omitted := 0
+	for _, path := range RankFileSummaries(summaries, issueText) {
+		line := fmt.Sprintf("- `%s`: %s\n", path, summaries[path])
+		if maxTokens > 0 && EstimateTokens(b.String()+line) > maxTokens {
+			omitted++
+			continue
+		}
+		b.WriteString(line)
+	}
+	if omitted > 0 {
+		b.WriteString(fmt.Sprintf("\n(%d less relevant files omitted)\n", omitted))
+	}
+	return b.String()
+}
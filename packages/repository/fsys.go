@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// FS is the read side of a checkout or knowledge base. Paths are slash-separated and relative
+// to its root, as in io/fs.
+type FS interface {
+	fs.ReadDirFS
+	fs.ReadFileFS
+	fs.StatFS
+}
+
+// WritableFS is an FS the knowledge base can be written to
+type WritableFS interface {
+	FS
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	MkdirAll(name string, perm fs.FileMode) error
+	RemoveAll(name string) error
+}
+
+// osFS is a directory on disk
+type osFS struct {
+	FS
+	root string
+}
+
+// OSFS returns the directory root on disk as a WritableFS
+func OSFS(root string) WritableFS {
+	return &osFS{FS: os.DirFS(root).(FS), root: root}
+}
+
+func (o *osFS) path(name string) string {
+	return filepath.Join(o.root, filepath.FromSlash(name))
+}
+
+func (o *osFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(o.path(name), data, perm)
+}
+
+func (o *osFS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(o.path(name), perm)
+}
+
+func (o *osFS) RemoveAll(name string) error {
+	return os.RemoveAll(o.path(name))
+}
+
+// MemFS is a WritableFS held in memory, for analyzing repositories in tests and for
+// knowledge bases kept outside a checkout. It is safe for concurrent use.
+type MemFS struct {
+	mu    sync.RWMutex
+	files fstest.MapFS
+}
+
+// NewMemFS returns a MemFS holding files, keyed by slash-separated path
+func NewMemFS(files map[string]string) *MemFS {
+	m := &MemFS{files: fstest.MapFS{}}
+	for name, content := range files {
+		m.files[path.Clean(name)] = &fstest.MapFile{Data: []byte(content), Mode: 0644, ModTime: time.Now()}
+	}
+	return m
+}
+
+// Files returns the content of every file, keyed by path
+func (m *MemFS) Files() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[string]string, len(m.files))
+	for name, f := range m.files {
+		if !f.Mode.IsDir() {
+			out[name] = string(f.Data)
+		}
+	}
+	return out
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.Open(name)
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.ReadDir(name)
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.ReadFile(name)
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.Stat(name)
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = &fstest.MapFile{Data: append([]byte{}, data...), Mode: perm, ModTime: time.Now()}
+	return nil
+}
+
+// MkdirAll records an empty directory; directories holding files exist implicitly
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		m.files[name] = &fstest.MapFile{Mode: fs.ModeDir | perm, ModTime: time.Now()}
+	}
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for p := range m.files {
+		if name == "." || p == name || (len(p) > len(name) && p[:len(name)+1] == name+"/") {
+			delete(m.files, p)
+		}
+	}
+	return nil
+}
+
+// Sub returns the part of fsys under dir, writable when fsys is
+func Sub(fsys WritableFS, dir string) WritableFS {
+	if o, ok := fsys.(*osFS); ok {
+		return OSFS(o.path(dir))
+	}
+	return &subFS{parent: fsys, dir: path.Clean(dir)}
+}
+
+// subFS is a directory of another WritableFS
+type subFS struct {
+	parent WritableFS
+	dir    string
+}
+
+func (s *subFS) full(name string) string { return path.Join(s.dir, name) }
+
+func (s *subFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	return s.parent.Open(s.full(name))
+}
+
+func (s *subFS) ReadDir(name string) ([]fs.DirEntry, error) { return s.parent.ReadDir(s.full(name)) }
+func (s *subFS) ReadFile(name string) ([]byte, error)       { return s.parent.ReadFile(s.full(name)) }
+func (s *subFS) Stat(name string) (fs.FileInfo, error)      { return s.parent.Stat(s.full(name)) }
+
+func (s *subFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return s.parent.WriteFile(s.full(name), data, perm)
+}
+
+func (s *subFS) MkdirAll(name string, perm fs.FileMode) error {
+	return s.parent.MkdirAll(s.full(name), perm)
+}
+
+func (s *subFS) RemoveAll(name string) error { return s.parent.RemoveAll(s.full(name)) }
@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// generatedHeadBytes is how much of a file is read to tell whether it is generated
+const generatedHeadBytes = 2048
+
+// generatedMarkerLines is how many lines from the top a generated-code marker must be within
+const generatedMarkerLines = 10
+
+// minifiedLineBytes is the average line length above which a script or stylesheet is minified
+const minifiedLineBytes = 300
+
+// generatedSuffixes are file name endings code generators use
+var generatedSuffixes = []string{
+	".pb.go", ".pb.gw.go", ".pb.validate.go", "_pb2.py", "_pb2_grpc.py", "_pb2.pyi", ".pb.cc", ".pb.h",
+	"_pb.js", "_pb.d.ts", "_grpc_pb.js", ".gen.go", "_gen.go", "_generated.go", ".g.dart", ".freezed.dart",
+	".designer.cs", ".g.cs", ".min.js", ".min.css",
+}
+
+// mockDirs are directories that hold generated mocks
+var mockDirs = map[string]bool{"mocks": true, "mock": true, "__mocks__": true}
+
+// generatedMarker matches the comments generators put at the top of their output, e.g. Go's
+// "Code generated by protoc-gen-go. DO NOT EDIT." or Facebook's @generated
+var generatedMarker = regexp.MustCompile(`DO NOT EDIT|@generated|(?i:auto-generated|autogenerated) (?:file|code)`)
+
+// generatedSourceLine matches the line naming the file generated code was produced from, e.g.
+// "// source: api/v1/user.proto" (protoc) or "// Source: store.go" (mockgen)
+var generatedSourceLine = regexp.MustCompile(`(?m)^\s*(?://|#|\*)\s*[Ss]ource:\s*(\S+)`)
+
+// GeneratedFile is a file produced by a code generator, which is changed through its source
+type GeneratedFile struct {
+	Path   string
+	Reason string // why it counts as generated, e.g. "DO NOT EDIT marker"
+	Source string // what to change instead, e.g. "`api/user.proto`"; "" when unknown
+}
+
+// FindGeneratedFiles returns the generated files among files (repo-relative paths of a
+// checkout): those with a generator's file name suffix such as .pb.go, mocks in mock
+// directories or mock_*.go files, files starting with a "DO NOT EDIT" or @generated marker,
+// minified scripts and stylesheets, and those .gitattributes marks linguist-generated. A
+// file marked -linguist-generated is never generated.
+func FindGeneratedFiles(repoPath string, files []string) map[string]GeneratedFile {
+	return findGeneratedFiles(repoPath, files, func(rel string) ([]byte, error) {
+		return readHead(filepath.Join(repoPath, filepath.FromSlash(rel)))
+	})
+}
+
+func findGeneratedFiles(repoPath string, files []string, read func(rel string) ([]byte, error)) map[string]GeneratedFile {
+	generated := map[string]GeneratedFile{}
+	if len(files) == 0 {
+		return generated
+	}
+	attrs := linguistGenerated(repoPath, files)
+	for _, rel := range files {
+		head, err := read(rel)
+		if err != nil {
+			continue
+		}
+		reason := generatedReason(rel, head)
+		switch attrs[rel] {
+		case "set", "true":
+			if reason == "" {
+				reason = "marked linguist-generated in .gitattributes"
+			}
+		case "unset", "false":
+			reason = "" // the repository says it is written by hand
+		}
+		if reason != "" {
+			generated[rel] = GeneratedFile{Path: rel, Reason: reason, Source: generatorSource(repoPath, rel, head)}
+		}
+	}
+	return generated
+}
+
+// generatedReason says why a file whose content starts with head is generated, "" if it is not
+func generatedReason(rel string, head []byte) string {
+	lower := strings.ToLower(path.Base(rel))
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return fmt.Sprintf("`%s` file", suffix)
+		}
+	}
+	if strings.HasSuffix(lower, ".go") && (strings.HasPrefix(lower, "mock_") || strings.HasSuffix(lower, "_mock.go")) {
+		return "mock file"
+	}
+	for _, dir := range strings.Split(path.Dir(rel), "/") {
+		if mockDirs[dir] {
+			return "in a mocks directory"
+		}
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return ""
+	}
+	top := head
+	for i, n := 0, 0; i < len(head); i++ {
+		if head[i] == '\n' {
+			if n++; n == generatedMarkerLines {
+				top = head[:i]
+				break
+			}
+		}
+	}
+	if m := generatedMarker.Find(top); m != nil {
+		return fmt.Sprintf("starts with a %q marker", m)
+	}
+	switch path.Ext(lower) {
+	case ".js", ".mjs", ".cjs", ".css":
+		if lines := bytes.Count(head, []byte("\n")) + 1; len(head) >= generatedHeadBytes && len(head)/lines > minifiedLineBytes {
+			return "minified"
+		}
+	}
+	return ""
+}
+
+// generatorSource names what a generated file is produced from: the file its header names,
+// the .proto beside it, the unminified file, or the //go:generate directive of its package
+func generatorSource(repoPath, rel string, head []byte) string {
+	if m := generatedSourceLine.FindSubmatch(head); m != nil {
+		return fmt.Sprintf("`%s`", m[1])
+	}
+	dir, base := path.Split(rel)
+	for _, pair := range [][2]string{{".pb.go", ".proto"}, {"_pb2.py", ".proto"}, {".pb.cc", ".proto"}, {".min.js", ".js"}, {".min.css", ".css"}} {
+		if stem, ok := strings.CutSuffix(base, pair[0]); ok {
+			if _, err := os.Stat(filepath.Join(repoPath, filepath.FromSlash(dir+stem+pair[1]))); err == nil {
+				return fmt.Sprintf("`%s`", dir+stem+pair[1])
+			}
+		}
+	}
+	if strings.HasSuffix(base, ".go") {
+		if file, directive := goGenerateDirective(repoPath, dir, base); directive != "" {
+			return fmt.Sprintf("`%s` in `%s`", directive, file)
+		}
+	}
+	return ""
+}
+
+// goGenerateDirective finds the //go:generate directive in dir that produces base: the one
+// naming it, or the directory's only directive
+func goGenerateDirective(repoPath, dir, base string) (file, directive string) {
+	entries, err := os.ReadDir(filepath.Join(repoPath, filepath.FromSlash(dir)))
+	if err != nil {
+		return "", ""
+	}
+	stem := strings.TrimSuffix(base, ".go")
+	var found [][2]string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") || e.Name() == base {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(repoPath, filepath.FromSlash(dir), e.Name()))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, "//go:generate ") {
+				continue
+			}
+			if strings.Contains(line, stem) {
+				return dir + e.Name(), line
+			}
+			found = append(found, [2]string{dir + e.Name(), line})
+		}
+	}
+	if len(found) == 1 {
+		return found[0][0], found[0][1]
+	}
+	return "", ""
+}
+
+// linguistGenerated returns the linguist-generated attribute .gitattributes gives each file
+func linguistGenerated(repoPath string, files []string) map[string]string {
+	attrs := map[string]string{}
+	cmd := exec.Command("git", "-C", repoPath, "check-attr", "-z", "--stdin", "linguist-generated")
+	cmd.Stdin = strings.NewReader(strings.Join(files, "\x00") + "\x00")
+	out, err := cmd.Output()
+	if err != nil {
+		return attrs
+	}
+	// <path> NUL <attribute> NUL <info> NUL
+	parts := strings.Split(string(out), "\x00")
+	for i := 0; i+2 < len(parts); i += 3 {
+		attrs[parts[i]] = parts[i+2]
+	}
+	return attrs
+}
+
+// readHead returns up to generatedHeadBytes from the start of a file
+func readHead(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, generatedHeadBytes)
+	n, err := f.Read(buf)
+	if n == 0 && err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// SplitGeneratedChanges separates the agent's changes to files that were generated before the
+// run, which are changed through their generator instead, from the rest. Generated files are
+// judged by their committed content, so removing a DO NOT EDIT marker does not unlock one;
+// new files are never held back.
+func SplitGeneratedChanges(repoPath string, files []string) (kept []string, generated []GeneratedFile) {
+	var tracked []string
+	for _, rel := range files {
+		if existsAtHead(repoPath, rel) {
+			tracked = append(tracked, rel)
+		}
+	}
+	found := findGeneratedFiles(repoPath, tracked, func(rel string) ([]byte, error) {
+		out, err := git(repoPath, "show", "HEAD:"+rel)
+		if len(out) > generatedHeadBytes {
+			out = out[:generatedHeadBytes]
+		}
+		return []byte(out), err
+	})
+	for _, rel := range files {
+		if g, ok := found[rel]; ok {
+			generated = append(generated, g)
+		} else {
+			kept = append(kept, rel)
+		}
+	}
+	return kept, generated
+}
+
+// GeneratedFilesNote explains why changes to generated files were discarded and what to change
+func GeneratedFilesNote(generated []GeneratedFile) string {
+	var b strings.Builder
+	b.WriteString("### Generated files left unchanged\n\nThe following files are generated, so DevFlow discarded its direct edits to them. Change their source and rerun the generator instead:\n\n")
+	b.WriteString(formatGeneratedFiles(generated))
+	return b.String()
+}
+
+// formatGeneratedFiles renders generated files and their sources as a markdown list
+func formatGeneratedFiles(generated []GeneratedFile) string {
+	var b strings.Builder
+	for _, g := range generated {
+		if g.Source != "" {
+			b.WriteString(fmt.Sprintf("- `%s` (%s): generated from %s\n", g.Path, g.Reason, g.Source))
+		} else {
+			b.WriteString(fmt.Sprintf("- `%s` (%s)\n", g.Path, g.Reason))
+		}
+	}
+	return b.String()
+}
+
+// writeGeneratedFileNote stands in for a generated file's contents in repo-structure.md
+func writeGeneratedFileNote(writer *bufio.Writer, g GeneratedFile) {
+	note := fmt.Sprintf("_Generated file (%s): contents omitted, do not edit it directly", g.Reason)
+	if g.Source != "" {
+		note += "; it is generated from " + g.Source
+	}
+	writer.WriteString(note + "._\n\n")
+}
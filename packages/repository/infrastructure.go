@@ -0,0 +1,413 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// InfraKeywords are issue words that make the infrastructure summary relevant to a prompt
+var InfraKeywords = []string{
+	"column", "table", "migration", "schema", "database", "sql",
+	"port", "docker", "dockerfile", "compose", "container",
+	"kubernetes", "k8s", "helm", "deployment", "ingress",
+	"terraform", "cloudformation", "infrastructure", "bucket", "env",
+}
+
+// InfraSummary collects the schema and infrastructure facts found in a repository
+type InfraSummary struct {
+	Migrations     []string
+	Terraform      []string
+	CloudFormation []string
+	Dockerfiles    []string
+	Compose        []string
+	Kubernetes     []string
+}
+
+var (
+	sqlCreateTableRegex = regexp.MustCompile(`(?is)create\s+table\s+(?:if\s+not\s+exists\s+)?[` + "`" + `"\[]?([\w.]+)[` + "`" + `"\]]?\s*\((.*?)\)\s*;`)
+	sqlAlterTableRegex  = regexp.MustCompile(`(?i)alter\s+table\s+(?:if\s+exists\s+)?[` + "`" + `"\[]?([\w.]+)[` + "`" + `"\]]?\s+(add|drop|alter|rename)\s+(?:column\s+)?(?:if\s+(?:not\s+)?exists\s+)?[` + "`" + `"\[]?(\w+)`)
+	sqlCreateIndexRegex = regexp.MustCompile(`(?i)create\s+(?:unique\s+)?index\s+(?:if\s+not\s+exists\s+)?(\w+)\s+on\s+([\w.]+)`)
+	tfBlockRegex        = regexp.MustCompile(`^(resource|data|module|variable|output)\s+"([^"]+)"(?:\s+"([^"]+)")?`)
+	issueWordRegex      = regexp.MustCompile(`[a-z0-9]+`)
+)
+
+// AnalyzeInfrastructure scans the repository for migrations, Terraform, CloudFormation,
+// Dockerfiles, docker-compose files and Kubernetes manifests
+func AnalyzeInfrastructure(repoPath string) (*InfraSummary, error) {
+	return AnalyzeInfrastructureFS(OSFS(repoPath))
+}
+
+// AnalyzeInfrastructureFS is AnalyzeInfrastructure on any FS
+func AnalyzeInfrastructureFS(fsys FS) (*InfraSummary, error) {
+	summary := &InfraSummary{}
+
+	err := fs.WalkDir(fsys, ".", func(relPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if relPath != "." && shouldIgnoreForStructure(relPath, d.Name()) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if shouldIgnoreForStructure(relPath, d.Name()) {
+			return nil
+		}
+
+		name := strings.ToLower(d.Name())
+		ext := filepath.Ext(name)
+		isYAML := ext == ".yaml" || ext == ".yml"
+		if ext != ".sql" && ext != ".tf" && ext != ".json" && !isYAML && !strings.Contains(name, "dockerfile") {
+			return nil
+		}
+
+		content, err := fsys.ReadFile(relPath)
+		if err != nil || isBinary(content) {
+			return nil
+		}
+
+		switch {
+		case ext == ".sql":
+			if entry := summarizeSQL(relPath, content); entry != "" {
+				summary.Migrations = append(summary.Migrations, entry)
+			}
+		case ext == ".tf":
+			if entry := summarizeTerraform(relPath, content); entry != "" {
+				summary.Terraform = append(summary.Terraform, entry)
+			}
+		case name == "dockerfile" || strings.HasPrefix(name, "dockerfile.") || strings.HasSuffix(name, ".dockerfile"):
+			summary.Dockerfiles = append(summary.Dockerfiles, summarizeDockerfile(relPath, content))
+		case isYAML && (strings.HasPrefix(name, "docker-compose") || strings.HasPrefix(name, "compose.")):
+			if entry := summarizeCompose(relPath, content); entry != "" {
+				summary.Compose = append(summary.Compose, entry)
+			}
+		case isYAML || ext == ".json":
+			if entry := summarizeCloudFormation(relPath, content); entry != "" {
+				summary.CloudFormation = append(summary.CloudFormation, entry)
+			} else if isYAML {
+				if entry := summarizeKubernetes(relPath, content); entry != "" {
+					summary.Kubernetes = append(summary.Kubernetes, entry)
+				}
+			}
+		}
+		return nil
+	})
+	return summary, err
+}
+
+// summarizeSQL lists the tables, columns and indexes a SQL file creates or alters
+func summarizeSQL(relPath string, content []byte) string {
+	var lines []string
+	for _, m := range sqlCreateTableRegex.FindAllStringSubmatch(string(content), -1) {
+		var columns []string
+		for _, def := range splitSQLColumns(m[2]) {
+			fields := strings.Fields(def)
+			if len(fields) < 2 {
+				continue
+			}
+			switch strings.ToUpper(fields[0]) {
+			case "PRIMARY", "FOREIGN", "UNIQUE", "CONSTRAINT", "CHECK", "KEY", "INDEX":
+				continue
+			}
+			columns = append(columns, strings.Trim(fields[0], "`\"[]")+" "+fields[1])
+		}
+		lines = append(lines, fmt.Sprintf("  - create table `%s` (%s)", m[1], strings.Join(columns, ", ")))
+	}
+	for _, m := range sqlAlterTableRegex.FindAllStringSubmatch(string(content), -1) {
+		lines = append(lines, fmt.Sprintf("  - alter table `%s`: %s `%s`", m[1], strings.ToLower(m[2]), m[3]))
+	}
+	for _, m := range sqlCreateIndexRegex.FindAllStringSubmatch(string(content), -1) {
+		lines = append(lines, fmt.Sprintf("  - index `%s` on `%s`", m[1], m[2]))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("- `%s`\n%s", relPath, strings.Join(lines, "\n"))
+}
+
+// splitSQLColumns splits a column list on top-level commas
+func splitSQLColumns(body string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range body {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(body[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(body[start:]))
+}
+
+// summarizeTerraform lists the resources, data sources, modules, variables and outputs of a .tf file
+func summarizeTerraform(relPath string, content []byte) string {
+	var blocks []string
+	for _, line := range strings.Split(string(content), "\n") {
+		m := tfBlockRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		if m[3] != "" {
+			blocks = append(blocks, fmt.Sprintf("%s `%s.%s`", m[1], m[2], m[3]))
+		} else {
+			blocks = append(blocks, fmt.Sprintf("%s `%s`", m[1], m[2]))
+		}
+	}
+	if len(blocks) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("- `%s`: %s", relPath, strings.Join(blocks, ", "))
+}
+
+// summarizeDockerfile lists base images, exposed ports and the entrypoint of a Dockerfile
+func summarizeDockerfile(relPath string, content []byte) string {
+	var facts []string
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "FROM":
+			facts = append(facts, "from "+fields[1])
+		case "EXPOSE":
+			facts = append(facts, "expose "+strings.Join(fields[1:], " "))
+		case "ENTRYPOINT", "CMD":
+			facts = append(facts, strings.ToLower(fields[0])+" "+strings.Join(fields[1:], " "))
+		case "ENV", "ARG":
+			facts = append(facts, strings.ToLower(fields[0])+" "+strings.SplitN(fields[1], "=", 2)[0])
+		}
+	}
+	return fmt.Sprintf("- `%s`: %s", relPath, strings.Join(facts, "; "))
+}
+
+// summarizeCompose lists each docker-compose service with its image or build context and ports
+func summarizeCompose(relPath string, content []byte) string {
+	var doc struct {
+		Services map[string]struct {
+			Image string `yaml:"image"`
+			Build any    `yaml:"build"`
+			Ports []any  `yaml:"ports"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(content, &doc); err != nil || len(doc.Services) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(doc.Services))
+	for name := range doc.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{fmt.Sprintf("- `%s`", relPath)}
+	for _, name := range names {
+		svc := doc.Services[name]
+		source := svc.Image
+		if source == "" && svc.Build != nil {
+			source = "built locally"
+		}
+		line := fmt.Sprintf("  - service `%s` (%s)", name, source)
+		if len(svc.Ports) > 0 {
+			ports := make([]string, len(svc.Ports))
+			for i, p := range svc.Ports {
+				ports[i] = fmt.Sprint(p)
+			}
+			line += " ports " + strings.Join(ports, ", ")
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// summarizeCloudFormation lists the resources of a CloudFormation template, or returns ""
+// if the file is not one
+func summarizeCloudFormation(relPath string, content []byte) string {
+	if !bytes.Contains(content, []byte("AWSTemplateFormatVersion")) && !bytes.Contains(content, []byte("AWS::")) {
+		return ""
+	}
+	var doc struct {
+		Resources map[string]struct {
+			Type string `yaml:"Type"`
+		} `yaml:"Resources"`
+	}
+	// JSON is valid YAML, so one parser covers both template formats. Intrinsic function tags
+	// such as !Ref only fail their own nodes.
+	if err := yaml.Unmarshal(content, &doc); err != nil && len(doc.Resources) == 0 {
+		return ""
+	}
+	if len(doc.Resources) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(doc.Resources))
+	for name := range doc.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resources := make([]string, len(names))
+	for i, name := range names {
+		resources[i] = fmt.Sprintf("`%s` (%s)", name, doc.Resources[name].Type)
+	}
+	return fmt.Sprintf("- `%s`: %s", relPath, strings.Join(resources, ", "))
+}
+
+// summarizeKubernetes lists the kind and name of every object in a (multi-document)
+// manifest, with container images and ports, or returns "" if the file is not a manifest
+func summarizeKubernetes(relPath string, content []byte) string {
+	type container struct {
+		Image string `yaml:"image"`
+		Ports []struct {
+			ContainerPort int `yaml:"containerPort"`
+		} `yaml:"ports"`
+	}
+	type podSpec struct {
+		Containers []container `yaml:"containers"`
+	}
+	type manifest struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+		Metadata   struct {
+			Name string `yaml:"name"`
+		} `yaml:"metadata"`
+		Spec struct {
+			podSpec  `yaml:",inline"`
+			Template struct {
+				Spec podSpec `yaml:"spec"`
+			} `yaml:"template"`
+			Ports []struct {
+				Port       int `yaml:"port"`
+				TargetPort any `yaml:"targetPort"`
+			} `yaml:"ports"`
+		} `yaml:"spec"`
+	}
+
+	var objects []string
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var m manifest
+		err := decoder.Decode(&m)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			slog.Debug("Skipping unparsable YAML document", "file", relPath, "error", err)
+			break
+		}
+		if m.APIVersion == "" || m.Kind == "" {
+			continue
+		}
+
+		var facts []string
+		for _, c := range append(m.Spec.Containers, m.Spec.Template.Spec.Containers...) {
+			fact := "image " + c.Image
+			for _, p := range c.Ports {
+				fact += fmt.Sprintf(" port %d", p.ContainerPort)
+			}
+			facts = append(facts, fact)
+		}
+		for _, p := range m.Spec.Ports {
+			facts = append(facts, fmt.Sprintf("port %d -> %v", p.Port, p.TargetPort))
+		}
+		object := fmt.Sprintf("%s `%s`", m.Kind, m.Metadata.Name)
+		if len(facts) > 0 {
+			object += " (" + strings.Join(facts, "; ") + ")"
+		}
+		objects = append(objects, object)
+	}
+	if len(objects) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("- `%s`: %s", relPath, strings.Join(objects, ", "))
+}
+
+// Markdown renders the summary, omitting empty categories
+func (s *InfraSummary) Markdown() string {
+	var b strings.Builder
+	b.WriteString("# Schema and Infrastructure\n\n")
+	sections := []struct {
+		title   string
+		entries []string
+	}{
+		{"Database migrations and SQL", s.Migrations},
+		{"Terraform", s.Terraform},
+		{"CloudFormation", s.CloudFormation},
+		{"Dockerfiles", s.Dockerfiles},
+		{"Docker Compose", s.Compose},
+		{"Kubernetes manifests", s.Kubernetes},
+	}
+	empty := true
+	for _, section := range sections {
+		if len(section.entries) == 0 {
+			continue
+		}
+		empty = false
+		b.WriteString("## " + section.title + "\n\n")
+		b.WriteString(strings.Join(section.entries, "\n") + "\n\n")
+	}
+	if empty {
+		b.WriteString("No migrations, infrastructure-as-code or container definitions were found.\n")
+	}
+	return b.String()
+}
+
+// GenerateInfrastructureSummary writes the schema and infrastructure summary to outputFile
+func GenerateInfrastructureSummary(repoPath, outputFile string) error {
+	slog.Info("Generating infrastructure summary", "output", outputFile)
+
+	summary, err := AnalyzeInfrastructure(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to analyze infrastructure: %w", err)
+	}
+	return os.WriteFile(outputFile, []byte(summary.Markdown()), 0644)
+}
+
+// LoadInfrastructureContext returns the infrastructure summary when the issue mentions
+// schema or infrastructure concepts, truncated to maxTokens (0 means no limit)
+func LoadInfrastructureContext(infraFile, issueText string, maxTokens int) string {
+	return loadKeywordGatedDocument(infraFile, issueText, InfraKeywords, maxTokens)
+}
+
+// loadKeywordGatedDocument returns the content of a KB document if the issue text contains
+// one of keywords (singular or plural), truncated to maxTokens (0 means no limit)
+func loadKeywordGatedDocument(file, issueText string, keywords []string, maxTokens int) string {
+	relevant := false
+	for _, word := range issueWordRegex.FindAllString(strings.ToLower(issueText), -1) {
+		for _, kw := range keywords {
+			if word == kw || strings.TrimSuffix(word, "s") == kw {
+				relevant = true
+			}
+		}
+	}
+	if !relevant {
+		return ""
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	text := string(content)
+	if maxTokens > 0 && EstimateTokens(text) > maxTokens {
+		text = text[:maxTokens*4] + "\n... (truncated)\n"
+	}
+	return text
+}
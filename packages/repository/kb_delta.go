@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/store"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// snapshotFiles are the .devflow files a sync stamps with the synced commit; a cached delta
+// rewrites them for the merge commit instead of storing them
+var snapshotFiles = map[string]bool{pointerPath: true, snapshotMetaPath: true}
+
+// ComputeKBDelta syncs the knowledge base of a checkout to the state a pull request's branch
+// will merge, without touching the checkout: its HEAD plus the changed files in its working
+// tree are committed in a scratch worktree. headSHA is the PR head commit on GitHub, whose
+// parent must be the checkout's HEAD.
+func ComputeKBDelta(repoPath string, changed []string, headSHA, parentSHA string) (*store.KBDelta, error) {
+	local, err := git(repoPath, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(local) != parentSHA {
+		return nil, fmt.Errorf("pull request is based on %.7s, not the checkout's %.7s", parentSHA, strings.TrimSpace(local))
+	}
+	base, err := readPointerSHA(OSFS(repoPath))
+	if err != nil {
+		return nil, fmt.Errorf("knowledge base has no synced commit: %w", err)
+	}
+
+	dir, err := os.MkdirTemp(config.GetConfig().Repository.WorkspaceDir, "devflow_delta_")
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(dir) // git worktree add creates it
+	if _, err := git(repoPath, "worktree", "add", "--detach", dir, "HEAD"); err != nil {
+		return nil, err
+	}
+	defer func() { _, _ = git(repoPath, "worktree", "remove", "--force", dir) }()
+
+	for _, rel := range changed {
+		content, err := os.ReadFile(filepath.Join(repoPath, rel))
+		target := filepath.Join(dir, rel)
+		if os.IsNotExist(err) {
+			_ = os.Remove(target)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			return nil, err
+		}
+	}
+	bot := config.GetConfig().Bot
+	if _, err := git(dir, "add", "-A", "--", "."); err != nil {
+		return nil, err
+	}
+	if _, err := git(dir, "-c", "user.name="+bot.CommitName, "-c", "user.email="+bot.CommitEmail, "commit", "--allow-empty", "-m", "devflow: pull request state"); err != nil {
+		return nil, err
+	}
+	prState, err := git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := SyncKnowledgeBase(dir, strings.TrimSpace(prState))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := git(dir, "add", "-f", ".devflow"); err != nil {
+		return nil, err
+	}
+	out, err := git(dir, "diff", "--cached", "--name-only", "--diff-filter=AM", "--", ".devflow")
+	if err != nil {
+		return nil, err
+	}
+
+	delta := &store.KBDelta{ParentSHA: parentSHA, HeadSHA: headSHA, BaseSHA: base, Files: map[string]string{}}
+	for _, rel := range strings.Fields(out) {
+		if snapshotFiles[rel] {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, rel))
+		if err != nil {
+			return nil, err
+		}
+		delta.Files[rel] = string(content)
+	}
+	for _, c := range changes {
+		delta.ChangedFiles = append(delta.ChangedFiles, c.New)
+	}
+	if meta, err := readSnapshotMeta(OSFS(dir)); err == nil {
+		delta.Checksums = meta.Checksums
+	}
+	return delta, nil
+}
+
+// ApplyKBDelta commits a cached knowledge base delta for a merged pull request to main through
+// the API. It reports false, changing nothing, when the delta no longer describes the merge:
+// the PR gained commits, main moved before the merge, or the knowledge base was synced since.
+// Only repositories whose sync.publish policy is direct take commits on main; the others
+// report false too, so their sync is published through their policy.
+func ApplyKBDelta(ctx *probot.Context, repoName string, delta *store.KBDelta, prHeadSHA, mergeSHA string) (bool, error) {
+	if delta == nil || prHeadSHA != delta.HeadSHA || mergeSHA == "" {
+		return false, nil
+	}
+	if repoCfg, err := FetchRepoConfig(ctx, repoName); err != nil || repoCfg.Sync.Publish != config.SyncPublishDirect {
+		return false, err
+	}
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return false, err
+	}
+	lease, err := acquireWriterLock(repoName)
+	if err != nil {
+		return false, err
+	}
+	defer lease.Release()
+
+	apiCtx, cancel := config.StageContext(context.Background(), config.GetConfig().Timeouts.PushSeconds)
+	defer cancel()
+	client := NewGitHubClient(ctx)
+	merge, err := client.GetCommit(apiCtx, owner, repo, mergeSHA)
+	if err != nil {
+		return false, err
+	}
+	if len(merge.Parents) == 0 || merge.Parents[0] != delta.ParentSHA {
+		slog.InfoContext(logging.For(ctx), "Cached knowledge base delta is stale: main moved before the merge", "repo", repoName)
+		return false, nil
+	}
+	pointer, err := client.GetFileContent(apiCtx, owner, repo, pointerPath)
+	if err != nil || strings.TrimSpace(string(pointer)) != delta.BaseSHA {
+		slog.InfoContext(logging.For(ctx), "Cached knowledge base delta is stale: the knowledge base was synced since", "repo", repoName)
+		return false, nil
+	}
+
+	ref, err := client.GetRef(apiCtx, owner, repo, "heads/main")
+	if err != nil {
+		return false, err
+	}
+	tip, err := client.GetCommit(apiCtx, owner, repo, ref.SHA)
+	if err != nil {
+		return false, err
+	}
+	files := map[string]string{
+		pointerPath:      mergeSHA + "\n",
+		snapshotMetaPath: string(snapshotMetaJSON(mergeSHA, delta.ChangedFiles, delta.Checksums)),
+	}
+	for path, content := range delta.Files {
+		files[path] = content
+	}
+	var entries []githubapi.TreeEntry
+	for path, content := range files {
+		blob, err := client.CreateBlob(apiCtx, owner, repo, content)
+		if err != nil {
+			return false, err
+		}
+		entries = append(entries, githubapi.TreeEntry{Path: path, Mode: githubapi.ModeFile, Type: "blob", SHA: blob})
+	}
+	tree, err := client.CreateTree(apiCtx, owner, repo, tip.TreeSHA, entries)
+	if err != nil {
+		return false, err
+	}
+	commit, err := client.CreateCommit(apiCtx, owner, repo, fmt.Sprintf("chore(devflow): sync knowledge base for %.7s", mergeSHA), tree, []string{tip.SHA})
+	if err != nil {
+		return false, err
+	}
+	if err := lease.Check(); err != nil {
+		return false, err
+	}
+	if err := client.UpdateRef(apiCtx, owner, repo, ref.Ref, commit.SHA, false); err != nil {
+		return false, err
+	}
+	slog.InfoContext(logging.For(ctx), "Devflow Sync: applied cached delta", "repo", repoName, "sha", mergeSHA, "files", len(files))
+	archiveDelta(repoName, mergeSHA, delta.Files)
+	return true, nil
+}
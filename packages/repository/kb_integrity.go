@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"devflow-agent/packages/ai"
+	"devflow-agent/packages/config"
+)
+
+// kbArtifact is a knowledge base document checked against its checksum, with how to generate
+// it again on its own
+type kbArtifact struct {
+	Name       string // file name under .devflow
+	Regenerate func(ctx context.Context, repoPath, repoURL, repoName string) error
+}
+
+// kbArtifacts lists the checksummed documents in the order they are generated, so one built
+// from another is regenerated after it
+func kbArtifacts() []kbArtifact {
+	cfg := config.GetConfig()
+	path := func(repoPath, name string) string { return cfg.GetDevflowPath(repoPath, name) }
+	artifacts := []kbArtifact{
+		{cfg.Files.StructureFile, func(_ context.Context, repoPath, repoURL, _ string) error {
+			return AnalyzeRepo(nil, path(repoPath, cfg.Files.StructureFile), repoPath, repoURL)
+		}},
+		{cfg.Files.MetadataFile, func(ctx context.Context, repoPath, _, _ string) error {
+			return SaveFileMetadata(ctx, repoPath, path(repoPath, cfg.Files.MetadataFile))
+		}},
+		{cfg.Files.AnalysisFile, func(ctx context.Context, repoPath, repoURL, _ string) error {
+			return GenerateRepoAnalysisWithLLM(ctx, repoPath, repoURL, path(repoPath, cfg.Files.StructureFile), path(repoPath, cfg.Files.AnalysisFile))
+		}},
+		{cfg.Files.AnalysisIndexFile, func(_ context.Context, repoPath, _, _ string) error {
+			return ai.WriteAnalysisIndex(repoPath, path(repoPath, cfg.Files.AnalysisFile), path(repoPath, cfg.Files.AnalysisIndexFile))
+		}},
+		{cfg.Files.DependencyFile, func(_ context.Context, repoPath, _, _ string) error {
+			return GenerateDependencyGraph(repoPath, path(repoPath, cfg.Files.DependencyFile))
+		}},
+		{cfg.Files.InfrastructureFile, func(_ context.Context, repoPath, _, _ string) error {
+			return GenerateInfrastructureSummary(repoPath, path(repoPath, cfg.Files.InfrastructureFile))
+		}},
+		{cfg.Files.APISurfaceFile, func(_ context.Context, repoPath, _, _ string) error {
+			return GenerateAPISurface(repoPath, path(repoPath, cfg.Files.APISurfaceFile))
+		}},
+		{cfg.Files.ReadmeFile, func(_ context.Context, repoPath, _, repoName string) error {
+			return CreateDevflowReadme(path(repoPath, cfg.Files.ReadmeFile), repoName)
+		}},
+	}
+	if cfg.Files.CallGraphFile != "" {
+		artifacts = append(artifacts, kbArtifact{cfg.Files.CallGraphFile, func(ctx context.Context, repoPath, _, _ string) error {
+			return GenerateCallGraph(ctx, repoPath, path(repoPath, cfg.Files.CallGraphFile))
+		}})
+	}
+	return artifacts
+}
+
+// kbChecksums hashes the knowledge base documents present in a checkout
+func kbChecksums(repo FS) map[string]string {
+	sums := map[string]string{}
+	for _, a := range kbArtifacts() {
+		if data, err := repo.ReadFile(".devflow/" + a.Name); err == nil {
+			sums[a.Name] = checksum(data)
+		}
+	}
+	return sums
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// readSnapshotMeta reads the snapshot meta file of a checkout
+func readSnapshotMeta(repo FS) (snapshotMeta, error) {
+	var meta snapshotMeta
+	data, err := repo.ReadFile(snapshotMetaPath)
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("invalid %s: %w", snapshotMetaPath, err)
+	}
+	return meta, nil
+}
+
+// VerifyKnowledgeBase checks a checkout's knowledge base documents against the checksums its
+// last sync recorded in snapshot-meta.json. Documents edited by hand, corrupted or deleted
+// since are regenerated and their new checksums recorded, so the agent never reads them as
+// they were. It returns the documents it regenerated; a knowledge base synced before
+// checksums were recorded is not checked.
+func VerifyKnowledgeBase(ctx context.Context, repoPath, repoURL, repoName string) ([]string, error) {
+	if !config.GetConfig().KnowledgeBase.VerifyChecksums {
+		return nil, nil
+	}
+	repo := OSFS(repoPath)
+	meta, err := readSnapshotMeta(repo)
+	if err != nil || len(meta.Checksums) == 0 {
+		return nil, nil
+	}
+
+	var regenerated []string
+	for _, a := range kbArtifacts() {
+		want, ok := meta.Checksums[a.Name]
+		if !ok {
+			continue
+		}
+		data, err := repo.ReadFile(".devflow/" + a.Name)
+		if err == nil && checksum(data) == want {
+			continue
+		}
+		slog.WarnContext(ctx, "Knowledge base document drifted from its checksum, regenerating", "repo", repoName, "file", a.Name, "missing", err != nil)
+		stageCtx, cancel := config.StageContext(ctx, config.GetConfig().Timeouts.AnalysisSeconds)
+		err = a.Regenerate(stageCtx, repoPath, repoURL, repoName)
+		cancel()
+		if err != nil {
+			return regenerated, fmt.Errorf("failed to regenerate drifted %s: %w", a.Name, err)
+		}
+		regenerated = append(regenerated, a.Name)
+	}
+	if len(regenerated) == 0 {
+		return nil, nil
+	}
+
+	meta.Checksums = kbChecksums(repo)
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return regenerated, err
+	}
+	return regenerated, repo.WriteFile(snapshotMetaPath, data, 0o644)
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"time"
+
+	"devflow-agent/packages/config"
+)
+
+// kbMeta records the schema version of the knowledge base, when it was generated and a content
+// hash of each document. In deterministic mode it is the only knowledge base file that carries
+// a timestamp.
+type kbMeta struct {
+	SchemaVersion int               `json:"schema_version"`
+	GeneratedAt   string            `json:"generated_at"`
+	Files         map[string]string `json:"files"` // path under .devflow -> sha256 of its content
+}
+
+// generatedStamp is the generation time written into knowledge base documents. Deterministic
+// mode points at the meta file instead, so unchanged content yields unchanged documents.
+func generatedStamp() string {
+	cfg := config.GetConfig()
+	if cfg.KnowledgeBase.Deterministic {
+		return fmt.Sprintf("recorded in `%s`", cfg.Files.MetaFile)
+	}
+	return time.Now().Format("2006-01-02 15:04:05")
+}
+
+// WriteKnowledgeBaseMeta hashes the knowledge base files and records them in the meta file
+// with the generation time and the current schema version. The file is left untouched when
+// neither changed, so a rebuild of unchanged content produces no diff. It returns the meta file's path.
+func WriteKnowledgeBaseMeta(repoPath string, files []string) (string, error) {
+	cfg := config.GetConfig()
+	devflowDir := cfg.GetDevflowDir(repoPath)
+	rels := make([]string, 0, len(files))
+	for _, f := range files {
+		rel, err := filepath.Rel(devflowDir, f)
+		if err != nil {
+			rel = f
+		}
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	return cfg.GetDevflowPath(repoPath, cfg.Files.MetaFile), WriteKnowledgeBaseMetaFS(OSFS(devflowDir), rels)
+}
+
+// WriteKnowledgeBaseMetaFS is WriteKnowledgeBaseMeta for a knowledge base held in kb, with
+// files relative to it
+func WriteKnowledgeBaseMetaFS(kb WritableFS, files []string) error {
+	hashes := make(map[string]string, len(files))
+	for _, f := range files {
+		data, err := kb.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", f, err)
+		}
+		sum := sha256.Sum256(data)
+		hashes[f] = hex.EncodeToString(sum[:])
+	}
+
+	if previous, err := readKBMetaFS(kb); err == nil &&
+		previous.SchemaVersion == KnowledgeBaseSchemaVersion && maps.Equal(previous.Files, hashes) {
+		return nil
+	}
+	return writeKBMeta(kb, kbMeta{
+		SchemaVersion: KnowledgeBaseSchemaVersion,
+		GeneratedAt:   time.Now().UTC().Format(time.RFC3339),
+		Files:         hashes,
+	})
+}
+
+// readKBMeta reads the meta file of a checkout's knowledge base
+func readKBMeta(repoPath string) (kbMeta, error) {
+	return readKBMetaFS(OSFS(config.GetConfig().GetDevflowDir(repoPath)))
+}
+
+// readKBMetaFS reads the meta file of the knowledge base held in kb
+func readKBMetaFS(kb FS) (kbMeta, error) {
+	metaFile := config.GetConfig().Files.MetaFile
+	var meta kbMeta
+	data, err := kb.ReadFile(metaFile)
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("invalid %s: %w", metaFile, err)
+	}
+	return meta, nil
+}
+
+func writeKBMeta(kb WritableFS, meta kbMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return kb.WriteFile(config.GetConfig().Files.MetaFile, append(data, '\n'), 0644)
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"devflow-agent/packages/config"
+)
+
+// KnowledgeBaseSchemaVersion is the knowledge base format this agent writes and reads. Bump it
+// whenever a document's format changes, and register the migration from the previous version
+// in kbMigrations.
+const KnowledgeBaseSchemaVersion = 2
+
+// errKBRebuild is returned by a migration that cannot upgrade a knowledge base in place
+var errKBRebuild = errors.New("knowledge base needs a full rebuild")
+
+// kbMigration upgrades a knowledge base from schema version From to From+1
+type kbMigration struct {
+	From     int
+	Describe string
+	Migrate  func(repoPath, repoURL string) error
+}
+
+var kbMigrations = []kbMigration{
+	{From: 0, Describe: "stamp a knowledge base written before schema versioning", Migrate: migrateUnversioned},
+	{From: 1, Describe: "excerpt large files in the repository structure", Migrate: migrateLargeFileExcerpts},
+}
+
+// migrateUnversioned accepts a knowledge base from before schema versioning when it has every
+// document the current agent reads. Knowledge bases predating the infrastructure and API
+// surface documents are rebuilt.
+func migrateUnversioned(repoPath, _ string) error {
+	cfg := config.GetConfig()
+	for _, name := range []string{cfg.Files.MetadataFile, cfg.Files.AnalysisFile, cfg.Files.DependencyFile, cfg.Files.InfrastructureFile, cfg.Files.APISurfaceFile} {
+		if _, err := os.Stat(cfg.GetDevflowPath(repoPath, name)); err != nil {
+			return fmt.Errorf("%w: %s is missing", errKBRebuild, name)
+		}
+	}
+	return nil
+}
+
+// migrateLargeFileExcerpts regenerates the repository structure, which now holds excerpts of
+// large files instead of their whole content
+func migrateLargeFileExcerpts(repoPath, repoURL string) error {
+	cfg := config.GetConfig()
+	return AnalyzeRepo(nil, cfg.GetDevflowPath(repoPath, cfg.Files.StructureFile), repoPath, repoURL)
+}
+
+// KnowledgeBaseSchema returns the schema version of a checkout's knowledge base. Knowledge
+// bases written before versioning, without a meta file or its version, are version 0.
+func KnowledgeBaseSchema(repoPath string) (int, error) {
+	meta, err := readKBMeta(repoPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	return meta.SchemaVersion, err
+}
+
+// KnowledgeBaseOutdated reports whether a checkout has a knowledge base older than the schema
+// this agent reads
+func KnowledgeBaseOutdated(repoPath string) bool {
+	cfg := config.GetConfig()
+	if _, err := os.Stat(cfg.GetDevflowPath(repoPath, cfg.Files.StructureFile)); err != nil {
+		return false
+	}
+	version, err := KnowledgeBaseSchema(repoPath)
+	return err == nil && version < KnowledgeBaseSchemaVersion
+}
+
+// UpgradeKnowledgeBase brings a checkout's knowledge base to the current schema version by
+// running the registered migrations, or by rebuilding it when no migration can. repoURL and
+// repoName label a rebuilt knowledge base. It reports whether anything changed and commits
+// nothing. A knowledge base written by a newer agent is a *KBSchemaError; one that was never
+// initialized is left alone.
+func UpgradeKnowledgeBase(repoPath, repoURL, repoName string) (bool, error) {
+	cfg := config.GetConfig()
+	if _, err := os.Stat(cfg.GetDevflowPath(repoPath, cfg.Files.StructureFile)); os.IsNotExist(err) {
+		return false, nil
+	}
+	version, err := KnowledgeBaseSchema(repoPath)
+	if err != nil {
+		return false, err
+	}
+	if version > KnowledgeBaseSchemaVersion {
+		return false, &KBSchemaError{Found: version, Supported: KnowledgeBaseSchemaVersion}
+	}
+	if version == KnowledgeBaseSchemaVersion {
+		return false, nil
+	}
+
+	for version < KnowledgeBaseSchemaVersion {
+		err := errKBRebuild
+		for _, m := range kbMigrations {
+			if m.From == version {
+				slog.Info("Migrating knowledge base", "repo", repoName, "from", version, "to", version+1, "migration", m.Describe)
+				err = m.Migrate(repoPath, repoURL)
+				break
+			}
+		}
+		if errors.Is(err, errKBRebuild) {
+			slog.Info("Rebuilding knowledge base for the current schema", "repo", repoName, "from", version, "to", KnowledgeBaseSchemaVersion, "reason", err)
+			return true, rebuildKnowledgeBase(repoPath, repoURL, repoName)
+		}
+		if err != nil {
+			return false, fmt.Errorf("knowledge base migration from schema %d failed: %w", version, err)
+		}
+		version++
+	}
+
+	// Rewriting the meta file stamps the new version and rehashes the migrated documents
+	meta, err := readKBMeta(repoPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	var files []string
+	for rel := range meta.Files {
+		path := filepath.Join(cfg.GetDevflowDir(repoPath), filepath.FromSlash(rel))
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	_, err = WriteKnowledgeBaseMeta(repoPath, files)
+	return true, err
+}
+
+// rebuildKnowledgeBase regenerates every document of a knowledge base, which stamps it with
+// the current schema version
+func rebuildKnowledgeBase(repoPath, repoURL, repoName string) error {
+	files, err := BuildKnowledgeBase(context.Background(), repoPath, repoURL, repoName, nil)
+	if err != nil {
+		return fmt.Errorf("knowledge base rebuild failed: %w", err)
+	}
+	slog.Info("Knowledge base rebuilt", "repo", repoName, "files", len(files))
+	return nil
+}
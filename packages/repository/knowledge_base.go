@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/logging"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// Stages of a knowledge base build, as reported to the progress callback
+const (
+	KBStageStructure      = "Repository structure"
+	KBStageSummaries      = "File summaries"
+	KBStageAnalysis       = "Repository analysis"
+	KBStageDependencies   = "Dependency graph"
+	KBStageInfrastructure = "Infrastructure and API surface"
+	KBStageReadme         = "README and metadata"
+	KBStagePublish        = "Publishing"
+)
+
+// KBStages lists the stages of RebuildKnowledgeBase in order
+var KBStages = []string{KBStageStructure, KBStageSummaries, KBStageAnalysis, KBStageDependencies, KBStageInfrastructure, KBStageReadme, KBStagePublish}
+
+// BuildKnowledgeBase generates the .devflow knowledge base of a checked-out repository and
+// returns the files it wrote. repoURL and repoName only label the generated documents.
+// progress, if not nil, is called with the name of each stage as it starts; cancelling ctx
+// stops the build at the next stage.
+func BuildKnowledgeBase(ctx context.Context, repoPath, repoURL, repoName string, progress func(stage string)) ([]string, error) {
+	return buildKnowledgeBase(ctx, repoPath, repoURL, repoName, progress)
+}
+
+// RebuildKnowledgeBase regenerates a checkout's knowledge base from scratch, for when
+// incremental syncs have drifted: the old documents are deleted first, so nothing of them
+// survives. The result is published like a sync, under the repository's sync writer lock.
+// progress, if not nil, is called with the name of each stage as it starts.
+func RebuildKnowledgeBase(ctx *probot.Context, repoName, repoPath string, progress func(stage string)) error {
+	lease, err := acquireWriterLock(repoName)
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+
+	headSHA, err := GetOriginMainSHA(repoPath)
+	if err != nil {
+		return err
+	}
+	cfg := config.GetConfig()
+	if err := os.RemoveAll(cfg.GetDevflowDir(repoPath)); err != nil {
+		return fmt.Errorf("failed to remove the old knowledge base: %w", err)
+	}
+	if _, err := buildKnowledgeBase(logging.For(ctx), repoPath, CloneURL(repoName), repoName, progress); err != nil {
+		return err
+	}
+	if err := writePointerSHA(OSFS(repoPath), headSHA); err != nil {
+		return err
+	}
+	if err := writeSnapshotMeta(OSFS(repoPath), headSHA, nil); err != nil {
+		return err
+	}
+
+	if err := lease.Check(); err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(KBStagePublish)
+	}
+	if err := publishKnowledgeBase(ctx, repoName, repoPath, headSHA); err != nil {
+		return err
+	}
+	slog.InfoContext(logging.For(ctx), "Knowledge base rebuilt from scratch", "repo", repoName, "sha", headSHA)
+	return nil
+}
+
+func buildKnowledgeBase(ctx context.Context, repoPath, repoURL, repoName string, progress func(stage string)) ([]string, error) {
+	cfg := config.GetConfig()
+	var cancelled error
+	stage := func(name string) bool {
+		if cancelled = ctx.Err(); cancelled != nil {
+			return false
+		}
+		if progress != nil {
+			progress(name)
+		}
+		return true
+	}
+	if err := CreateDirectory(cfg.GetDevflowDir(repoPath)); err != nil {
+		slog.Error("Failed to create .devflow directory", "error", err)
+		return nil, err
+	}
+
+	// Step 1: Generate repo-structure.md using RepoAnalyzer (flattened structure)
+	if !stage(KBStageStructure) {
+		return nil, cancelled
+	}
+	structureFile := cfg.GetDevflowPath(repoPath, cfg.Files.StructureFile)
+	if err := AnalyzeRepo(nil, structureFile, repoPath, repoURL); err != nil {
+		slog.Error("Failed to generate repo structure", "error", err)
+		return nil, err
+	}
+
+	// Step 2: Save file metadata with per-file summaries, used for file selection
+	if !stage(KBStageSummaries) {
+		return nil, cancelled
+	}
+	metadataFile := cfg.GetDevflowPath(repoPath, cfg.Files.MetadataFile)
+	summaryCtx, cancelSummaries := config.StageContext(ctx, cfg.Timeouts.AnalysisSeconds)
+	err := SaveFileMetadata(summaryCtx, repoPath, metadataFile)
+	cancelSummaries()
+	if err != nil {
+		slog.Error("Failed to save file metadata", "error", err)
+		return nil, err
+	}
+
+	// Save debug files (only if debug mode is enabled)
+	var promptFile string
+	if cfg.Debug.CreateDebugFiles {
+		// Save analysis prompt (using repo structure content)
+		promptFile = cfg.GetDevflowPath(repoPath, cfg.Files.AnalysisPromptFile)
+		if err := SaveAnalysisPrompt(repoPath, repoURL, structureFile, promptFile); err != nil {
+			slog.Error("Failed to save analysis prompt", "error", err)
+			return nil, err
+		}
+		slog.Info("Debug files created", "prompt", promptFile)
+	}
+
+	// Step 3: Generate LLM analysis
+	if !stage(KBStageAnalysis) {
+		return nil, cancelled
+	}
+	analysisFile := cfg.GetDevflowPath(repoPath, cfg.Files.AnalysisFile)
+	analysisCtx, cancel := config.StageContext(ctx, cfg.Timeouts.AnalysisSeconds)
+	defer cancel()
+	if err := GenerateRepoAnalysisWithLLM(analysisCtx, repoPath, repoURL, structureFile, analysisFile); err != nil {
+		slog.Error("Failed to generate LLM analysis", "error", err)
+		return nil, err
+	}
+
+	// Step 4: Build dependency graph
+	if !stage(KBStageDependencies) {
+		return nil, cancelled
+	}
+	dependencyFile := cfg.GetDevflowPath(repoPath, cfg.Files.DependencyFile)
+	if err := GenerateDependencyGraph(repoPath, dependencyFile); err != nil {
+		slog.Error("Failed to generate dependency graph", "error", err)
+		return nil, err
+	}
+	// Function-level calls of Go and TypeScript sources, for impact analysis
+	callGraphFile := callGraphStage(repoPath)
+
+	// Summarize migrations, infrastructure-as-code and container definitions
+	if !stage(KBStageInfrastructure) {
+		return nil, cancelled
+	}
+	infraFile := cfg.GetDevflowPath(repoPath, cfg.Files.InfrastructureFile)
+	if err := GenerateInfrastructureSummary(repoPath, infraFile); err != nil {
+		slog.Error("Failed to generate infrastructure summary", "error", err)
+		return nil, err
+	}
+
+	// Condense OpenAPI, GraphQL and protobuf definitions into the API surface document
+	apiFile := cfg.GetDevflowPath(repoPath, cfg.Files.APISurfaceFile)
+	if err := GenerateAPISurface(repoPath, apiFile); err != nil {
+		slog.Error("Failed to generate API surface", "error", err)
+		return nil, err
+	}
+
+	// Documents of the organization's analyze plugins
+	pluginFiles := pluginStage(repoPath, repoName)
+
+	// Step 5: Create .devflow/README.md
+	if !stage(KBStageReadme) {
+		return nil, cancelled
+	}
+	readmeFile := cfg.GetDevflowPath(repoPath, cfg.Files.ReadmeFile)
+	if err := CreateDevflowReadme(readmeFile, repoName); err != nil {
+		slog.Error("Failed to create Devflow README", "error", err)
+		return nil, err
+	}
+
+	// Core files always, debug files when they were created
+	files := []string{
+		structureFile,
+		metadataFile,
+		analysisFile,
+		cfg.GetDevflowPath(repoPath, cfg.Files.AnalysisIndexFile),
+		dependencyFile,
+		infraFile,
+		apiFile,
+		readmeFile,
+	}
+	files = append(files, DependencyShardFiles(dependencyFile)...)
+	if callGraphFile != "" {
+		files = append(files, callGraphFile)
+	}
+	files = append(files, pluginFiles...)
+	if promptFile != "" {
+		files = append(files, promptFile)
+	}
+
+	// Generation time and content hashes, rewritten only when a document changed
+	metaFile, err := WriteKnowledgeBaseMeta(repoPath, files)
+	if err != nil {
+		slog.Error("Failed to write knowledge base meta file", "error", err)
+		return nil, err
+	}
+
+	// Keep this analysis for the admin API's history of the repository
+	head, _ := git(repoPath, "rev-parse", "HEAD")
+	ArchiveAnalysis(repoPath, repoName, strings.TrimSpace(head))
+	return append(files, metaFile), nil
+}
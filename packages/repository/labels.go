@@ -3,22 +3,24 @@ package repository
 import (
 	"context"
 	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	"errors"
 	"log/slog"
 
-	"github.com/google/go-github/github"
 	"github.com/swinton/go-probot/probot"
 )
 
 // getCustomLabels returns labels from configuration
-func getCustomLabels() []*github.Label {
+func getCustomLabels() []githubapi.Label {
 	cfg := config.GetConfig()
-	labels := make([]*github.Label, len(cfg.Labels))
+	labels := make([]githubapi.Label, len(cfg.Labels))
 
 	for i, labelConfig := range cfg.Labels {
-		labels[i] = &github.Label{
-			Name:        github.String(labelConfig.Name),
-			Color:       github.String(labelConfig.Color),
-			Description: github.String(labelConfig.Description),
+		labels[i] = githubapi.Label{
+			Name:        labelConfig.Name,
+			Color:       labelConfig.Color,
+			Description: labelConfig.Description,
 		}
 	}
 
@@ -26,22 +28,22 @@ func getCustomLabels() []*github.Label {
 }
 
 func AddCustomLabels(ctx *probot.Context, owner, repo string) error {
-	client := ctx.GitHub
+	client := NewGitHubClient(ctx)
 	customLabels := getCustomLabels()
 
 	for _, label := range customLabels {
 		// Check if label exists, create if it doesn't
-		_, _, err := client.Issues.GetLabel(context.Background(), owner, repo, label.GetName())
+		_, err := client.GetLabel(context.Background(), owner, repo, label.Name)
 		if err != nil {
 			// Label doesn't exist, create it
-			_, _, err := client.Issues.CreateLabel(context.Background(), owner, repo, label)
+			err := client.CreateLabel(context.Background(), owner, repo, label)
 			if err != nil {
-				slog.Error("Failed to create label", "label", label.GetName(), "error", err)
+				slog.ErrorContext(logging.For(ctx), "Failed to create label", "label", label.Name, "error", err)
 				continue
 			}
-			slog.Info("Created label", "label", label.GetName(), "repo", owner+"/"+repo)
+			slog.InfoContext(logging.For(ctx), "Created label", "label", label.Name, "repo", owner+"/"+repo)
 		} else {
-			slog.Info("Label already exists", "label", label.GetName(), "repo", owner+"/"+repo)
+			slog.InfoContext(logging.For(ctx), "Label already exists", "label", label.Name, "repo", owner+"/"+repo)
 		}
 	}
 
@@ -49,31 +51,31 @@ func AddCustomLabels(ctx *probot.Context, owner, repo string) error {
 }
 
 func RemoveCustomLabels(ctx *probot.Context, owner, repo string) error {
-	client := ctx.GitHub
+	client := NewGitHubClient(ctx)
 	customLabels := getCustomLabels()
 
 	for _, label := range customLabels {
-		labelName := label.GetName()
+		labelName := label.Name
 
 		// Check if label exists before trying to delete
-		_, resp, err := client.Issues.GetLabel(context.Background(), owner, repo, labelName)
+		_, err := client.GetLabel(context.Background(), owner, repo, labelName)
 		if err != nil {
-			if resp != nil && resp.StatusCode == 404 {
-				slog.Info("Label doesn't exist (already removed)", "label", labelName, "repo", owner+"/"+repo)
+			if errors.Is(err, githubapi.ErrNotFound) {
+				slog.InfoContext(logging.For(ctx), "Label doesn't exist (already removed)", "label", labelName, "repo", owner+"/"+repo)
 				continue
 			}
-			slog.Error("Error checking label", "label", labelName, "error", err)
+			slog.ErrorContext(logging.For(ctx), "Error checking label", "label", labelName, "error", err)
 			continue
 		}
 
 		// Delete the label
-		_, err = client.Issues.DeleteLabel(context.Background(), owner, repo, labelName)
+		err = client.DeleteLabel(context.Background(), owner, repo, labelName)
 		if err != nil {
-			slog.Error("Failed to delete label", "label", labelName, "repo", owner+"/"+repo, "error", err)
+			slog.ErrorContext(logging.For(ctx), "Failed to delete label", "label", labelName, "repo", owner+"/"+repo, "error", err)
 			continue
 		}
 
-		slog.Info("Deleted label", "label", labelName, "repo", owner+"/"+repo)
+		slog.InfoContext(logging.For(ctx), "Deleted label", "label", labelName, "repo", owner+"/"+repo)
 	}
 
 	return nil
@@ -0,0 +1,342 @@
+package repository
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// analyzeFileByLanguage fills functions, classes and imports for the languages the
+// knowledge base understands
+func analyzeFileByLanguage(content []byte, fileInfo *DevflowFileInfo) {
+	switch fileInfo.Language {
+	case "go":
+		analyzeGoFile(content, fileInfo)
+	case "javascript", "typescript":
+		analyzeJSFile(content, fileInfo)
+	case "python":
+		analyzePythonFile(content, fileInfo)
+	case "java":
+		analyzeJavaFile(content, fileInfo)
+	case "csharp":
+		analyzeCSharpFile(content, fileInfo)
+	case "rust":
+		analyzeRustFile(content, fileInfo)
+	case "ruby":
+		analyzeRubyFile(content, fileInfo)
+	case "php":
+		analyzePHPFile(content, fileInfo)
+	}
+}
+
+// extractDependenciesByLanguage fills the raw imports (and, for C#, declared namespaces as
+// exports) of a dependency graph node
+func extractDependenciesByLanguage(content []byte, node *DependencyNode) {
+	switch node.Language {
+	case "go":
+		extractGoDependencies(content, node)
+	case "javascript", "typescript":
+		extractJSDependencies(content, node)
+	case "python":
+		extractPythonDependencies(content, node)
+	case "java", "csharp", "rust", "ruby", "php":
+		fileInfo := DevflowFileInfo{Language: node.Language}
+		analyzeFileByLanguage(content, &fileInfo)
+		node.Imports = append(node.Imports, fileInfo.Imports...)
+		node.Exports = append(node.Exports, fileInfo.Exports...)
+	}
+}
+
+var (
+	javaImportRegex  = regexp.MustCompile(`^import\s+(?:static\s+)?([\w.]+(?:\.\*)?)\s*;`)
+	javaTypeRegex    = regexp.MustCompile(`^(?:(?:public|protected|private|abstract|final|static|sealed|non-sealed)\s+)*(class|interface|enum|record|@interface)\s+(\w+)`)
+	javaMethodRegex  = regexp.MustCompile(`^(?:(?:public|protected|private|abstract|final|static|synchronized|native|default)\s+)*(?:<[^>]+>\s+)?[\w<>\[\],.? ]+\s+(\w+)\s*\([^;]*$`)
+	csUsingRegex     = regexp.MustCompile(`^using\s+(?:static\s+)?(?:\w+\s*=\s*)?([\w.]+)\s*;`)
+	csNamespaceRegex = regexp.MustCompile(`^namespace\s+([\w.]+)`)
+	csTypeRegex      = regexp.MustCompile(`^(?:(?:public|internal|protected|private|abstract|sealed|static|partial|readonly|ref)\s+)*(class|interface|struct|enum|record)\s+(\w+)`)
+	csMethodRegex    = regexp.MustCompile(`^(?:(?:public|internal|protected|private|static|virtual|override|abstract|async|sealed|extern|new)\s+)+[\w<>\[\],.? ]+\s+(\w+)\s*\(`)
+	rustUseRegex     = regexp.MustCompile(`^(?:pub(?:\([\w:]+\))?\s+)?use\s+([\w:]+)`)
+	rustModRegex     = regexp.MustCompile(`^(?:pub(?:\([\w:]+\))?\s+)?mod\s+(\w+)\s*;`)
+	rustFnRegex      = regexp.MustCompile(`^(?:pub(?:\([\w:]+\))?\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?(?:extern\s+"\w+"\s+)?fn\s+(\w+)`)
+	rustTypeRegex    = regexp.MustCompile(`^(?:pub(?:\([\w:]+\))?\s+)?(struct|enum|trait|union)\s+(\w+)`)
+	rustImplRegex    = regexp.MustCompile(`^impl(?:<[^>]*>)?\s+(?:[\w:<>]+\s+for\s+)?(\w+)`)
+	rubyRequireRegex = regexp.MustCompile(`^(require|require_relative|load)\s*\(?\s*['"]([^'"]+)['"]`)
+	rubyDefRegex     = regexp.MustCompile(`^def\s+(?:self\.)?([\w?!=]+)`)
+	rubyClassRegex   = regexp.MustCompile(`^(class|module)\s+([\w:]+)`)
+	phpUseRegex      = regexp.MustCompile(`^use\s+(?:function\s+|const\s+)?([\w\\]+)(?:\s+as\s+\w+)?\s*;`)
+	phpIncludeRegex  = regexp.MustCompile(`^(?:require|require_once|include|include_once)\s*\(?\s*(?:__DIR__\s*\.\s*)?['"]([^'"]+)['"]`)
+	phpNamespaceRgx  = regexp.MustCompile(`^namespace\s+([\w\\]+)\s*;`)
+	phpTypeRegex     = regexp.MustCompile(`^(?:(?:abstract|final|readonly)\s+)*(class|interface|trait|enum)\s+(\w+)`)
+	phpFunctionRegex = regexp.MustCompile(`^(?:(?:public|protected|private|static|abstract|final)\s+)*function\s+&?(\w+)\s*\(`)
+)
+
+// javaKeywords are words the method regex can mistake for method names
+var javaKeywords = map[string]bool{"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true, "new": true, "else": true}
+
+func analyzeJavaFile(content []byte, fileInfo *DevflowFileInfo) {
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+
+		if m := javaImportRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Imports = append(fileInfo.Imports, m[1])
+			continue
+		}
+		if m := javaTypeRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Classes = append(fileInfo.Classes, ClassInfo{Name: m[2], LineNumber: i + 1})
+			if strings.Contains(line, "public ") {
+				fileInfo.Exports = append(fileInfo.Exports, m[2])
+			}
+			continue
+		}
+		if m := javaMethodRegex.FindStringSubmatch(line); m != nil && !javaKeywords[m[1]] {
+			fileInfo.Functions = append(fileInfo.Functions, FunctionInfo{Name: m[1], Signature: line, LineNumber: i + 1})
+		}
+	}
+}
+
+func analyzeCSharpFile(content []byte, fileInfo *DevflowFileInfo) {
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+
+		if m := csUsingRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Imports = append(fileInfo.Imports, m[1])
+			continue
+		}
+		if m := csNamespaceRegex.FindStringSubmatch(line); m != nil {
+			// Namespaces are what other files import, so they are the file's exports
+			fileInfo.Exports = append(fileInfo.Exports, m[1])
+			continue
+		}
+		if m := csTypeRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Classes = append(fileInfo.Classes, ClassInfo{Name: m[2], LineNumber: i + 1})
+			continue
+		}
+		if m := csMethodRegex.FindStringSubmatch(line); m != nil && !javaKeywords[m[1]] {
+			fileInfo.Functions = append(fileInfo.Functions, FunctionInfo{Name: m[1], Signature: line, LineNumber: i + 1})
+		}
+	}
+}
+
+func analyzeRustFile(content []byte, fileInfo *DevflowFileInfo) {
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+
+		if m := rustUseRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Imports = append(fileInfo.Imports, strings.TrimSuffix(m[1], "::"))
+			continue
+		}
+		if m := rustModRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Imports = append(fileInfo.Imports, "mod "+m[1])
+			continue
+		}
+		if m := rustFnRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Functions = append(fileInfo.Functions, FunctionInfo{Name: m[1], Signature: line, LineNumber: i + 1})
+			if strings.HasPrefix(line, "pub ") {
+				fileInfo.Exports = append(fileInfo.Exports, m[1])
+			}
+			continue
+		}
+		if m := rustTypeRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Classes = append(fileInfo.Classes, ClassInfo{Name: m[2], LineNumber: i + 1})
+			if strings.HasPrefix(line, "pub ") {
+				fileInfo.Exports = append(fileInfo.Exports, m[2])
+			}
+			continue
+		}
+		if m := rustImplRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Classes = append(fileInfo.Classes, ClassInfo{Name: "impl " + m[1], LineNumber: i + 1})
+		}
+	}
+}
+
+func analyzeRubyFile(content []byte, fileInfo *DevflowFileInfo) {
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+
+		if m := rubyRequireRegex.FindStringSubmatch(line); m != nil {
+			imp := m[2]
+			if m[1] == "require_relative" {
+				imp = "./" + strings.TrimPrefix(imp, "./")
+			}
+			fileInfo.Imports = append(fileInfo.Imports, imp)
+			continue
+		}
+		if m := rubyClassRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Classes = append(fileInfo.Classes, ClassInfo{Name: m[2], LineNumber: i + 1})
+			continue
+		}
+		if m := rubyDefRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Functions = append(fileInfo.Functions, FunctionInfo{Name: m[1], Signature: line, LineNumber: i + 1})
+		}
+	}
+}
+
+func analyzePHPFile(content []byte, fileInfo *DevflowFileInfo) {
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+
+		if m := phpUseRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Imports = append(fileInfo.Imports, m[1])
+			continue
+		}
+		if m := phpIncludeRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Imports = append(fileInfo.Imports, "./"+strings.TrimPrefix(m[1], "/"))
+			continue
+		}
+		if m := phpNamespaceRgx.FindStringSubmatch(line); m != nil {
+			fileInfo.Exports = append(fileInfo.Exports, m[1])
+			continue
+		}
+		if m := phpTypeRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Classes = append(fileInfo.Classes, ClassInfo{Name: m[2], LineNumber: i + 1})
+			continue
+		}
+		if m := phpFunctionRegex.FindStringSubmatch(line); m != nil {
+			fileInfo.Functions = append(fileInfo.Functions, FunctionInfo{Name: m[1], Signature: line, LineNumber: i + 1})
+		}
+	}
+}
+
+// resolveDependencies maps the raw imports of Java, C#, Rust, Ruby and PHP nodes to files
+// in the repository and records them as the node's Dependencies
+func resolveDependencies(nodes []DependencyNode) {
+	files := make(map[string]bool, len(nodes))
+	namespaces := make(map[string][]string)
+	for _, n := range nodes {
+		files[n.File] = true
+		if n.Language == "csharp" {
+			for _, ns := range n.Exports {
+				namespaces[ns] = append(namespaces[ns], n.File)
+			}
+		}
+	}
+
+	for i := range nodes {
+		node := &nodes[i]
+		seen := make(map[string]bool)
+		add := func(dep string) {
+			if dep != "" && dep != node.File && files[dep] && !seen[dep] {
+				seen[dep] = true
+				node.Dependencies = append(node.Dependencies, dep)
+			}
+		}
+
+		for _, imp := range node.Imports {
+			switch node.Language {
+			case "java":
+				// com.example.Foo -> any file ending in com/example/Foo.java
+				suffix := strings.ReplaceAll(strings.TrimSuffix(imp, ".*"), ".", "/")
+				if strings.HasSuffix(imp, ".*") {
+					var matches []string
+					for f := range files {
+						if path.Dir(f) == suffix || strings.HasSuffix(path.Dir(f), "/"+suffix) {
+							matches = append(matches, f)
+						}
+					}
+					sort.Strings(matches) // map order would reshuffle the graph on every build
+					for _, f := range matches {
+						add(f)
+					}
+				} else {
+					add(findBySuffix(files, suffix+".java"))
+				}
+			case "csharp":
+				for _, f := range namespaces[imp] {
+					add(f)
+				}
+			case "rust":
+				for _, candidate := range rustModuleCandidates(node.File, imp) {
+					if files[candidate] {
+						add(candidate)
+						break
+					}
+				}
+			case "ruby":
+				if strings.HasPrefix(imp, "./") {
+					add(path.Join(path.Dir(node.File), imp+".rb"))
+					add(path.Join(path.Dir(node.File), imp))
+				} else {
+					add(findBySuffix(files, "lib/"+imp+".rb"))
+					add(findBySuffix(files, imp+".rb"))
+				}
+			case "php":
+				if strings.HasPrefix(imp, "./") {
+					add(path.Join(path.Dir(node.File), imp))
+				} else {
+					// PSR-4: App\Models\User -> .../Models/User.php (the vendor prefix maps to a source dir)
+					parts := strings.Split(imp, "\\")
+					for j := 0; j < len(parts)-1 && j < 2; j++ {
+						if f := findBySuffix(files, strings.Join(parts[j:], "/")+".php"); f != "" {
+							add(f)
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// findBySuffix returns the shortest repository file equal to or ending in "/"+suffix
+func findBySuffix(files map[string]bool, suffix string) string {
+	if files[suffix] {
+		return suffix
+	}
+	best := ""
+	for f := range files {
+		if strings.HasSuffix(f, "/"+suffix) && (best == "" || len(f) < len(best) || (len(f) == len(best) && f < best)) {
+			best = f
+		}
+	}
+	return best
+}
+
+// rustModuleCandidates lists the files a `use` path or `mod` declaration may refer to
+func rustModuleCandidates(file, imp string) []string {
+	dir := path.Dir(file)
+	if name, ok := strings.CutPrefix(imp, "mod "); ok {
+		// mod foo; in src/lib.rs, main.rs or mod.rs lives next to it, otherwise under a
+		// directory named after the declaring file
+		base := dir
+		if stem := strings.TrimSuffix(path.Base(file), ".rs"); stem != "lib" && stem != "main" && stem != "mod" {
+			base = path.Join(dir, stem)
+		}
+		return []string{path.Join(base, name+".rs"), path.Join(base, name, "mod.rs")}
+	}
+
+	segments := strings.Split(imp, "::")
+	if len(segments) < 2 {
+		return nil
+	}
+	var root string
+	switch segments[0] {
+	case "crate":
+		root = crateRoot(file)
+	case "super":
+		root = path.Dir(dir)
+	case "self":
+		root = dir
+	default:
+		return nil
+	}
+
+	// The last segment may be an item rather than a module, so try both
+	var candidates []string
+	for n := len(segments) - 1; n >= 1; n-- {
+		modPath := path.Join(append([]string{root}, segments[1:n+1]...)...)
+		candidates = append(candidates, modPath+".rs", path.Join(modPath, "mod.rs"))
+	}
+	return candidates
+}
+
+// crateRoot returns the src directory that contains file, or its directory
+func crateRoot(file string) string {
+	dir := path.Dir(file)
+	for d := dir; d != "." && d != "/"; d = path.Dir(d) {
+		if path.Base(d) == "src" {
+			return d
+		}
+	}
+	return dir
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"devflow-agent/packages/config"
+)
+
+// maxOutlineEntries caps the outline of a large file; generated bundles can declare thousands
+const maxOutlineEntries = 200
+
+// isLargeFile reports whether a file goes into repo-structure.md as excerpts
+func isLargeFile(file FileInfo, kb config.KnowledgeBaseConfig) bool {
+	return kb.LargeFileBytes > 0 && len(file.Content) > kb.LargeFileBytes
+}
+
+// writeLargeFileExcerpt writes a large file as its first and last lines around a truncation
+// marker, followed by an outline of its declarations. Each excerpt is also capped at a quarter
+// of knowledge_base.large_file_bytes, so minified files with very long lines stay small.
+func writeLargeFileExcerpt(writer *bufio.Writer, file FileInfo, path string, kb config.KnowledgeBaseConfig) {
+	text := string(file.Content)
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	n := max(kb.ExcerptLines, 1)
+	if 2*n >= len(lines) {
+		n = len(lines) / 2
+	}
+	head := strings.Join(lines[:n], "\n")
+	tail := strings.Join(lines[len(lines)-n:], "\n")
+	if n == 0 {
+		// A single line is excerpted by bytes only
+		head, tail = text, text
+	}
+	limit := max(kb.LargeFileBytes/4, 1)
+	head = clipHead(head, limit)
+	tail = clipTail(tail, limit)
+	omitted := len(text) - len(head) - len(tail)
+
+	writer.WriteString(fmt.Sprintf("_Large file (%d lines, %d bytes): showing excerpts from its start and end, and an outline._\n\n", len(lines), len(text)))
+	writer.WriteString(fmt.Sprintf("````%s\n", file.Language))
+	writer.WriteString(head + "\n")
+	writer.WriteString(fmt.Sprintf("[... truncated by DevFlow: %d bytes omitted ...]\n", omitted))
+	writer.WriteString(tail + "\n")
+	writer.WriteString("````\n\n")
+
+	regions := findCodeRegions(path, file.Content, lines)
+	if len(regions) == 0 || len(regions) == 1 && regions[0].Name == "header" {
+		return
+	}
+	writer.WriteString("**Outline:**\n")
+	for i, r := range regions {
+		if i == maxOutlineEntries {
+			writer.WriteString(fmt.Sprintf("- ... and %d more\n", len(regions)-i))
+			break
+		}
+		writer.WriteString(fmt.Sprintf("- %s (lines %d-%d)\n", r.Name, r.StartLine, r.EndLine))
+	}
+	writer.WriteString("\n")
+}
+
+// clipHead returns at most limit bytes from the start of s, cut at a rune boundary
+func clipHead(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit]
+}
+
+// clipTail returns at most limit bytes from the end of s, cut at a rune boundary
+func clipTail(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	start := len(s) - limit
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return s[start:]
+}
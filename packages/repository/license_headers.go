@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"devflow-agent/packages/config"
+)
+
+// licenseHeaderSample is how many existing files of a type are read to detect their header
+const licenseHeaderSample = 50
+
+// headerCommentPrefixes are the line comment markers of the file types that get headers
+var headerCommentPrefixes = map[string]string{
+	".go": "//", ".js": "//", ".jsx": "//", ".mjs": "//", ".ts": "//", ".tsx": "//",
+	".java": "//", ".kt": "//", ".scala": "//", ".swift": "//", ".dart": "//", ".php": "//",
+	".c": "//", ".h": "//", ".cc": "//", ".cpp": "//", ".hpp": "//", ".cs": "//", ".rs": "//",
+	".py": "#", ".rb": "#", ".sh": "#", ".pl": "#", ".r": "#", ".tf": "#",
+	".sql": "--", ".lua": "--", ".hs": "--",
+}
+
+// copyrightYears matches a year or range of years in a header, e.g. 2019 or 2019-2024
+var copyrightYears = regexp.MustCompile(`\b(?:19|20)\d{2}(?:\s*[-–,]\s*(?:19|20)\d{2})?\b`)
+
+// LicenseHeaderError is returned when new files lack the license header the repository requires
+type LicenseHeaderError struct {
+	Files []string
+}
+
+func (e *LicenseHeaderError) Error() string {
+	return fmt.Sprintf("new files are missing the required license header: %s", strings.Join(e.Files, ", "))
+}
+
+// licenseHeaders finds the header each file type of a checkout takes, once per type
+type licenseHeaders struct {
+	repoPath string
+	policy   config.LicenseHeaderConfig
+	byExt    map[string]string // comment-wrapped header with {year}, "" when the type takes none
+}
+
+func newLicenseHeaders(repoPath string, policy config.LicenseHeaderConfig) *licenseHeaders {
+	return &licenseHeaders{repoPath: repoPath, policy: policy, byExt: map[string]string{}}
+}
+
+// forFile returns the header a new file takes, "" for none
+func (h *licenseHeaders) forFile(rel string) string {
+	ext := strings.ToLower(path.Ext(rel))
+	prefix, ok := headerCommentPrefixes[ext]
+	if !ok {
+		return ""
+	}
+	header, ok := h.byExt[ext]
+	if !ok {
+		if h.policy.Header != "" {
+			header = commentLines(h.policy.Header, prefix)
+		} else {
+			header = detectLicenseHeader(h.repoPath, ext, prefix)
+		}
+		h.byExt[ext] = header
+	}
+	return strings.ReplaceAll(header, "{year}", strconv.Itoa(time.Now().Year()))
+}
+
+// AddLicenseHeaders puts the repository's license header at the top of the new files among
+// the changed ones (repo-relative paths), below any shebang line. The header is the one the
+// repository's policy gives, or else the one most existing files of the same type start with.
+// Files that already start with a license or copyright comment are left alone. It returns
+// the files it changed.
+func AddLicenseHeaders(repoPath string, policy config.LicenseHeaderConfig, files []string) []string {
+	if policy.Enabled == nil || !*policy.Enabled || !hasHead(repoPath) {
+		return nil
+	}
+	headers := newLicenseHeaders(repoPath, policy)
+	var added []string
+	for _, rel := range files {
+		file := filepath.Join(repoPath, filepath.FromSlash(rel))
+		content, err := os.ReadFile(file)
+		if err != nil || existsAtHead(repoPath, rel) {
+			continue
+		}
+		header := headers.forFile(rel)
+		if header == "" || hasLicenseHeader(string(content), headerCommentPrefixes[strings.ToLower(path.Ext(rel))]) {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if err := os.WriteFile(file, []byte(prependHeader(string(content), header)), info.Mode().Perm()); err != nil {
+			slog.Warn("Failed to add license header", "file", rel, "error", err)
+			continue
+		}
+		added = append(added, rel)
+	}
+	if len(added) > 0 {
+		slog.Info("Added license headers to new files", "files", added)
+	}
+	return added
+}
+
+// MissingLicenseHeaders returns the new files among the changed ones that take a license
+// header but do not start with one
+func MissingLicenseHeaders(repoPath string, policy config.LicenseHeaderConfig, files []string) []string {
+	if !hasHead(repoPath) {
+		return nil // not a checkout: new files cannot be told apart
+	}
+	headers := newLicenseHeaders(repoPath, policy)
+	var missing []string
+	for _, rel := range files {
+		content, err := os.ReadFile(filepath.Join(repoPath, filepath.FromSlash(rel)))
+		if err != nil || existsAtHead(repoPath, rel) || headers.forFile(rel) == "" {
+			continue
+		}
+		if !hasLicenseHeader(string(content), headerCommentPrefixes[strings.ToLower(path.Ext(rel))]) {
+			missing = append(missing, rel)
+		}
+	}
+	return missing
+}
+
+func hasHead(repoPath string) bool {
+	_, err := git(repoPath, "rev-parse", "--verify", "HEAD")
+	return err == nil
+}
+
+// detectLicenseHeader returns the license header, with its years as {year}, that most of the
+// tracked files with extension ext start with; "" when there is no such convention
+func detectLicenseHeader(repoPath, ext, prefix string) string {
+	out, err := git(repoPath, "ls-files", "--", "*"+ext)
+	if err != nil {
+		return ""
+	}
+	files := strings.Split(strings.TrimSpace(out), "\n")
+	if len(files) > licenseHeaderSample {
+		files = files[:licenseHeaderSample]
+	}
+	counts := map[string]int{}
+	sampled := 0
+	for _, rel := range files {
+		content, err := os.ReadFile(filepath.Join(repoPath, filepath.FromSlash(rel)))
+		if err != nil {
+			continue
+		}
+		sampled++
+		if block := leadingComment(string(content), prefix); isLicenseComment(block) {
+			counts[copyrightYears.ReplaceAllString(block, "{year}")]++
+		}
+	}
+	best, bestCount := "", 0
+	for _, header := range slices.Sorted(maps.Keys(counts)) {
+		if counts[header] > bestCount {
+			best, bestCount = header, counts[header]
+		}
+	}
+	if bestCount*2 <= sampled {
+		return ""
+	}
+	return best
+}
+
+// hasLicenseHeader reports whether content starts with a license or copyright comment, or is
+// generated code, which carries no header
+func hasLicenseHeader(content, prefix string) bool {
+	block := leadingComment(content, prefix)
+	return isLicenseComment(block) || strings.Contains(block, "Code generated")
+}
+
+func isLicenseComment(block string) bool {
+	lower := strings.ToLower(block)
+	return strings.Contains(lower, "copyright") || strings.Contains(lower, "license") || strings.Contains(lower, "spdx-license-identifier")
+}
+
+// leadingComment returns the comment block a file starts with, below any shebang line: line
+// comments with prefix, or a /* */ block, up to the first blank or code line
+func leadingComment(content, prefix string) string {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "#!") {
+		lines = lines[1:]
+	}
+	var block []string
+	inBlock := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case inBlock:
+			block = append(block, line)
+			inBlock = !strings.Contains(trimmed, "*/")
+		case strings.HasPrefix(trimmed, "/*"):
+			block = append(block, line)
+			inBlock = !strings.Contains(trimmed[2:], "*/")
+		case strings.HasPrefix(trimmed, prefix):
+			block = append(block, line)
+		default:
+			return strings.Join(block, "\n")
+		}
+	}
+	return strings.Join(block, "\n")
+}
+
+// commentLines turns a plain-text header into line comments
+func commentLines(text, prefix string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		if line = strings.TrimRight(line, " \t\r"); line == "" {
+			lines[i] = prefix
+		} else {
+			lines[i] = prefix + " " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// prependHeader puts header and a blank line at the top of content, below any shebang line
+func prependHeader(content, header string) string {
+	if strings.HasPrefix(content, "#!") {
+		shebang, rest, _ := strings.Cut(content, "\n")
+		return shebang + "\n" + header + "\n\n" + rest
+	}
+	return header + "\n\n" + content
+}
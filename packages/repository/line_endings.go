@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Line endings, as git ls-files --eol names them
+const (
+	eolLF   = "lf"
+	eolCRLF = "crlf"
+)
+
+// NormalizeLineEndings rewrites the changed files of a checkout (repo-relative paths) to the
+// line endings the repository stores them with, so an agent that flipped CRLF and LF does not
+// turn a small change into a whole-file diff. A file git treats as text through .gitattributes
+// is stored with LF, except a text=auto file already committed with CRLF, which git leaves
+// alone; any other file keeps the line endings it was committed with, and a new one takes the
+// repository's dominant convention. Binary files and files committed with mixed endings are
+// left as they are. It returns the files it rewrote.
+func NormalizeLineEndings(repoPath string, files []string) []string {
+	if len(files) == 0 {
+		return nil
+	}
+	committed, dominant := committedLineEndings(repoPath)
+	attrs := gitTextAttributes(repoPath, files)
+
+	var rewritten []string
+	for _, rel := range files {
+		path := filepath.Join(repoPath, filepath.FromSlash(rel))
+		content, err := os.ReadFile(path)
+		if err != nil || bytes.IndexByte(content, 0) >= 0 {
+			continue // deleted, or binary
+		}
+		want := lineEndingFor(attrs[rel], committed[rel], dominant)
+		if want == "" {
+			continue
+		}
+		normalized := convertLineEndings(content, want)
+		if bytes.Equal(normalized, content) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if err := os.WriteFile(path, normalized, info.Mode().Perm()); err != nil {
+			slog.Warn("Failed to normalize line endings", "file", rel, "error", err)
+			continue
+		}
+		rewritten = append(rewritten, rel)
+	}
+	if len(rewritten) > 0 {
+		slog.Info("Normalized line endings of changed files", "files", rewritten)
+	}
+	return rewritten
+}
+
+// lineEndingFor picks the line ending to store a file with from its text and eol attributes,
+// the line ending of its committed version ("" for a new file) and the repository's dominant
+// one; "" leaves the file as it is
+func lineEndingFor(attr gitTextAttr, committed, dominant string) string {
+	switch {
+	case attr.text == "unset" || committed == "-text":
+		return ""
+	case attr.text == "auto":
+		if committed == eolCRLF {
+			return eolCRLF
+		}
+		return eolLF
+	case attr.text == "set" || (attr.eol != "" && attr.eol != "unspecified"):
+		return eolLF
+	case committed == eolLF || committed == eolCRLF:
+		return committed
+	case committed == "mixed":
+		return ""
+	}
+	return dominant
+}
+
+// convertLineEndings rewrites every line ending of content to want
+func convertLineEndings(content []byte, want string) []byte {
+	lf := bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	if want == eolCRLF {
+		return bytes.ReplaceAll(lf, []byte("\n"), []byte("\r\n"))
+	}
+	return lf
+}
+
+// committedLineEndings returns the line endings of each tracked file as committed, from git
+// ls-files --eol, and the repository's dominant one, "" when no file has line endings
+func committedLineEndings(repoPath string) (map[string]string, string) {
+	out, err := exec.Command("git", "-C", repoPath, "ls-files", "--eol", "-z").Output()
+	if err != nil {
+		return nil, ""
+	}
+	committed := map[string]string{}
+	counts := map[string]int{}
+	for _, entry := range strings.Split(string(out), "\x00") {
+		// i/lf    w/crlf  attr/text=auto eol=crlf	path
+		info, path, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(info)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "i/") {
+			continue
+		}
+		eol := strings.TrimPrefix(fields[0], "i/")
+		committed[path] = eol
+		counts[eol]++
+	}
+	switch {
+	case counts[eolCRLF] > counts[eolLF]:
+		return committed, eolCRLF
+	case counts[eolLF] > 0:
+		return committed, eolLF
+	}
+	return committed, ""
+}
+
+// gitTextAttr is a file's text and eol attributes: "set", "unset", "unspecified" or a value
+type gitTextAttr struct {
+	text, eol string
+}
+
+// gitTextAttributes returns the text and eol attributes .gitattributes gives each file
+func gitTextAttributes(repoPath string, files []string) map[string]gitTextAttr {
+	attrs := map[string]gitTextAttr{}
+	cmd := exec.Command("git", "-C", repoPath, "check-attr", "-z", "--stdin", "text", "eol")
+	cmd.Stdin = strings.NewReader(strings.Join(files, "\x00") + "\x00")
+	out, err := cmd.Output()
+	if err != nil {
+		return attrs
+	}
+	// <path> NUL <attribute> NUL <info> NUL, for each path and attribute
+	parts := strings.Split(string(out), "\x00")
+	for i := 0; i+2 < len(parts); i += 3 {
+		attr := attrs[parts[i]]
+		switch parts[i+1] {
+		case "text":
+			attr.text = parts[i+2]
+		case "eol":
+			attr.eol = parts[i+2]
+		}
+		attrs[parts[i]] = attr
+	}
+	return attrs
+}
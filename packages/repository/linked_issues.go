@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// issueRefPattern matches "#123" and "owner/repo#123" style references.
+var issueRefPattern = regexp.MustCompile(`(?:^|[^\w/])(?:([\w.-]+/[\w.-]+))?#(\d+)\b`)
+
+// checklistItemPattern matches an unchecked task list item, capturing its text
+var checklistItemPattern = regexp.MustCompile(`(?m)^[ \t]*(?:[-*+]|\d+[.)])[ \t]+\[ \][ \t]+(.*)$`)
+
+// issueURLPattern matches links to issues, e.g. https://github.com/owner/repo/issues/12
+var issueURLPattern = regexp.MustCompile(`https://github\.com/([\w.-]+/[\w.-]+)/issues/(\d+)\b`)
+
+// IssueReference is a single "#N" style reference found in issue text
+type IssueReference struct {
+	RepoName string
+	Number   int
+}
+
+// ExtractIssueReferences returns the unique issue/PR references in text, in order of appearance.
+// References without an explicit owner/repo are resolved against defaultRepo.
+func ExtractIssueReferences(text, defaultRepo string) []IssueReference {
+	seen := make(map[string]bool)
+	var refs []IssueReference
+	for _, m := range issueRefPattern.FindAllStringSubmatch(text, -1) {
+		number, err := strconv.Atoi(m[2])
+		if err != nil || number <= 0 {
+			continue
+		}
+		repoName := m[1]
+		if repoName == "" {
+			repoName = defaultRepo
+		}
+		key := fmt.Sprintf("%s#%d", strings.ToLower(repoName), number)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		refs = append(refs, IssueReference{RepoName: repoName, Number: number})
+	}
+	return refs
+}
+
+// SubIssueNumbers returns the open issues of repoName that an issue is split into: its open
+// sub-issues and the issues named in the unchecked items of its task lists, in that order.
+// Checked items are done, and sub-issues of other repositories cannot be closed from a pull
+// request here, so both are left out.
+func SubIssueNumbers(ctx *probot.Context, repoName string, issue *github.Issue) []int {
+	seen := map[int]bool{issue.GetNumber(): true}
+	var numbers []int
+	add := func(refRepo string, number int) {
+		if strings.EqualFold(refRepo, repoName) && !seen[number] {
+			seen[number] = true
+			numbers = append(numbers, number)
+		}
+	}
+
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return nil
+	}
+	subIssues, err := NewGitHubClient(ctx).ListSubIssues(context.Background(), owner, repo, issue.GetNumber())
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to list sub-issues", "issueNumber", issue.GetNumber(), "error", err)
+	}
+	for _, sub := range subIssues {
+		if sub.State == "open" {
+			add(sub.RepoName, sub.Number)
+		}
+	}
+
+	for _, item := range checklistItemPattern.FindAllStringSubmatch(issue.GetBody(), -1) {
+		for _, ref := range ExtractIssueReferences(item[1], repoName) {
+			add(ref.RepoName, ref.Number)
+		}
+		for _, m := range issueURLPattern.FindAllStringSubmatch(item[1], -1) {
+			if number, err := strconv.Atoi(m[2]); err == nil {
+				add(m[1], number)
+			}
+		}
+	}
+	return numbers
+}
+
+// BuildLinkedIssueContext fetches the issues and PRs referenced from the triggering issue
+// and renders a condensed markdown section for the agent prompt.
+func BuildLinkedIssueContext(ctx *probot.Context, repoName string, issue *github.Issue) string {
+	cfg := config.GetConfig()
+	lc := cfg.Issues.LinkedContext
+	if !lc.Enabled {
+		return ""
+	}
+
+	refs := ExtractIssueReferences(issue.GetTitle()+"\n"+issue.GetBody(), repoName)
+	var sections []string
+	for _, ref := range refs {
+		if ref.Number == issue.GetNumber() && strings.EqualFold(ref.RepoName, repoName) {
+			continue
+		}
+		if lc.MaxReferences > 0 && len(sections) >= lc.MaxReferences {
+			break
+		}
+
+		section, err := fetchReferenceSection(ctx, ref, lc)
+		if err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to fetch linked reference", "repo", ref.RepoName, "number", ref.Number, "error", err)
+			continue
+		}
+		sections = append(sections, section)
+	}
+
+	if len(sections) == 0 {
+		return ""
+	}
+
+	slog.InfoContext(logging.For(ctx), "Built linked issue context", "issueNumber", issue.GetNumber(), "references", len(sections))
+	return "# Referenced Issues and Pull Requests\n\n" + strings.Join(sections, "\n")
+}
+
+func fetchReferenceSection(ctx *probot.Context, ref IssueReference, lc config.LinkedContextConfig) (string, error) {
+	owner, repo, err := githubapi.SplitRepoName(ref.RepoName)
+	if err != nil {
+		return "", err
+	}
+	client := NewGitHubClient(ctx)
+
+	linked, err := client.GetIssue(context.Background(), owner, repo, ref.Number)
+	if err != nil {
+		return "", err
+	}
+
+	kind := "Issue"
+	if linked.IsPullRequest {
+		kind = "Pull Request"
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("## %s %s#%d: %s\n", kind, ref.RepoName, ref.Number, linked.Title))
+	b.WriteString(fmt.Sprintf("- **State:** %s\n\n", linked.State))
+	if body := strings.TrimSpace(linked.Body); body != "" {
+		b.WriteString(body + "\n\n")
+	}
+
+	comments, err := client.ListIssueComments(context.Background(), owner, repo, ref.Number)
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to list comments for linked reference", "number", ref.Number, "error", err)
+	}
+	if len(comments) > 0 {
+		// Keep the most recent comments; they usually hold the resolution
+		if lc.MaxComments > 0 && len(comments) > lc.MaxComments {
+			comments = comments[len(comments)-lc.MaxComments:]
+		}
+		b.WriteString("### Comments\n")
+		for _, c := range comments {
+			b.WriteString(fmt.Sprintf("- **%s:** %s\n", c.AuthorLogin, strings.TrimSpace(c.Body)))
+		}
+		b.WriteString("\n")
+	}
+
+	if linked.IsPullRequest {
+		files, err := client.ListPullRequestFiles(context.Background(), owner, repo, ref.Number)
+		if err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to list files for linked PR", "number", ref.Number, "error", err)
+		}
+		if len(files) > 0 {
+			b.WriteString("### Diff\n")
+			for _, f := range files {
+				b.WriteString(fmt.Sprintf("#### %s (%s)\n", f.Filename, f.Status))
+				if f.Patch != "" {
+					b.WriteString("```diff\n" + f.Patch + "\n```\n")
+				}
+			}
+		}
+	}
+
+	return truncateSection(b.String(), lc.MaxCharsPerEntry), nil
+}
+
+// truncateSection caps a section at maxChars bytes, cut at a rune boundary, marking where
+// content was cut.
+func truncateSection(s string, maxChars int) string {
+	if maxChars <= 0 || len(s) <= maxChars {
+		return s
+	}
+	return clipHead(s, maxChars) + "\n\n_[truncated]_\n"
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// mirrorLockStale is how old a mirror lock may get before it is assumed abandoned
+const mirrorLockStale = 10 * time.Minute
+
+// mirrorPath returns the location of the bare mirror for a repository inside the cache
+func mirrorPath(cacheDir, repoName string) string {
+	return filepath.Join(cacheDir, strings.Replace(repoName, "/", "_", -1)+".git")
+}
+
+// createWorktreeFromMirror creates (or refreshes) the cached bare mirror of repoName and checks
+// the default branch out into a new worktree at repoDir. Remote-tracking refs are kept under
+// origin/*, so the worktree behaves like a regular clone for the rest of the pipeline.
+func createWorktreeFromMirror(ctx context.Context, cacheDir, repoName, cloneURL, repoDir, defaultBranch string) error {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return fmt.Errorf("failed to create mirror cache: %w", err)
+	}
+	mirror := mirrorPath(cacheDir, repoName)
+
+	unlock, err := lockMirror(ctx, mirror)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(filepath.Join(mirror, "HEAD")); os.IsNotExist(err) {
+		slog.InfoContext(ctx, "Creating repository mirror", "repo", repoName, "mirror", mirror)
+		if out, err := exec.CommandContext(ctx, "git", "clone", "--bare", cloneURL, mirror).CombinedOutput(); err != nil {
+			_ = os.RemoveAll(mirror)
+			return fmt.Errorf("git clone --bare failed: %v: %s", err, out)
+		}
+		if _, err := git(mirror, "config", "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+			return err
+		}
+	}
+
+	// Drop worktrees whose directories were removed without cleanup
+	_, _ = git(mirror, "worktree", "prune")
+
+	fetch := exec.CommandContext(ctx, "git", "fetch", "--prune", "origin")
+	fetch.Dir = mirror
+	if out, err := fetch.CombinedOutput(); err != nil {
+		return fmt.Errorf("git fetch failed for mirror %s: %v: %s", mirror, err, out)
+	}
+
+	absDir, err := filepath.Abs(repoDir)
+	if err != nil {
+		return err
+	}
+	add := exec.CommandContext(ctx, "git", "worktree", "add", "--detach", absDir, "origin/"+defaultBranch)
+	add.Dir = mirror
+	if out, err := add.CombinedOutput(); err != nil {
+		return fmt.Errorf("git worktree add failed: %v: %s", err, out)
+	}
+
+	slog.InfoContext(ctx, "Created worktree from mirror", "repo", repoName, "worktree", repoDir)
+	return nil
+}
+
+// lockMirror serializes mirror updates across concurrent runs with a lock file.
+func lockMirror(ctx context.Context, mirror string) (func(), error) {
+	lockFile := mirror + ".lock"
+	for {
+		f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_ = f.Close()
+			return func() { _ = os.Remove(lockFile) }, nil
+		}
+		if info, statErr := os.Stat(lockFile); statErr == nil && time.Since(info.ModTime()) > mirrorLockStale {
+			slog.WarnContext(ctx, "Removing stale mirror lock", "lock", lockFile)
+			_ = os.Remove(lockFile)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for mirror lock %s: %w", lockFile, ctx.Err())
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// gitPath resolves a path inside the repository's git directory (e.g. "info/exclude"),
+// which for worktrees may live in the shared mirror rather than under repoPath/.git.
+func gitPath(repoPath, name string) string {
+	out, err := git(repoPath, "rev-parse", "--git-path", name)
+	if err != nil {
+		return filepath.Join(repoPath, ".git", filepath.FromSlash(name))
+	}
+	p := strings.TrimSpace(out)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(repoPath, p)
+	}
+	return p
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"devflow-agent/packages/config"
+)
+
+// maxRepoOverviewChars bounds the per-repository context given to the multi-repo planner
+const maxRepoOverviewChars = 6000
+
+var repoReferenceRegex = regexp.MustCompile(`(?:github\.com/)?([A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+)`)
+
+// ReferencedRepositories returns the repositories from accessible that the text mentions as
+// owner/name or by GitHub URL, in order of first mention
+func ReferencedRepositories(text string, accessible []string) []string {
+	known := make(map[string]string, len(accessible))
+	for _, r := range accessible {
+		known[strings.ToLower(r)] = r
+	}
+
+	seen := make(map[string]bool)
+	var repos []string
+	for _, m := range repoReferenceRegex.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimSuffix(strings.TrimSuffix(m[1], "."), ".git")
+		full, ok := known[strings.ToLower(name)]
+		if !ok || seen[full] {
+			continue
+		}
+		seen[full] = true
+		repos = append(repos, full)
+	}
+	return repos
+}
+
+// RepoOverview returns a bounded description of a cloned repository for planning: the
+// DevFlow analysis when the knowledge base exists, otherwise the README
+func RepoOverview(repoPath string) string {
+	cfg := config.GetConfig()
+	candidates := []string{
+		cfg.GetDevflowPath(repoPath, cfg.Files.AnalysisFile),
+		filepath.Join(repoPath, "README.md"),
+		filepath.Join(repoPath, "Readme.md"),
+		cfg.GetDevflowPath(repoPath, cfg.Files.StructureFile),
+	}
+	for _, c := range candidates {
+		content, err := os.ReadFile(c)
+		if err != nil || len(strings.TrimSpace(string(content))) == 0 {
+			continue
+		}
+		if len(content) > maxRepoOverviewChars {
+			return string(content[:maxRepoOverviewChars]) + "\n... (truncated)"
+		}
+		return string(content)
+	}
+	return "(no overview available)"
+}
@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"context"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// AuthorShare is the number of lines currently attributed to an author by git blame
+type AuthorShare struct {
+	Name  string
+	Email string
+	Lines int
+}
+
+// FileOwnership summarizes recent history and primary authors of a file
+type FileOwnership struct {
+	Path          string
+	RecentCommits []string
+	Authors       []AuthorShare
+}
+
+// CollectFileOwnership gathers recent commit summaries and blame-based author shares
+// for each file; files new in the checkout have no history and are skipped. The clone is
+// shallow, so history is deepened first (best-effort).
+func CollectFileOwnership(repoPath string, files []string) []FileOwnership {
+	cfg := config.GetConfig()
+	if !cfg.Ownership.Enabled || len(files) == 0 {
+		return nil
+	}
+
+	if cfg.Ownership.HistoryDepth > 0 {
+		if _, err := git(repoPath, "fetch", fmt.Sprintf("--deepen=%d", cfg.Ownership.HistoryDepth), "origin"); err != nil {
+			slog.Warn("Failed to deepen history for ownership context", "error", err)
+		}
+	}
+
+	var owners []FileOwnership
+	for _, file := range files {
+		if !existsAtHead(repoPath, file) {
+			continue
+		}
+		fo := FileOwnership{Path: file}
+
+		out, err := git(repoPath, "log", fmt.Sprintf("-n%d", cfg.Ownership.MaxCommitsPerFile), "--format=%h %as %an: %s", "--", file)
+		if err != nil {
+			slog.Warn("Failed to read git log for file", "file", file, "error", err)
+		} else {
+			for _, ln := range strings.Split(strings.TrimSpace(out), "\n") {
+				if ln != "" {
+					fo.RecentCommits = append(fo.RecentCommits, ln)
+				}
+			}
+		}
+
+		authors, err := blameAuthors(repoPath, file)
+		if err != nil {
+			slog.Warn("Failed to aggregate git blame for file", "file", file, "error", err)
+		}
+		if cfg.Ownership.MaxAuthorsPerFile > 0 && len(authors) > cfg.Ownership.MaxAuthorsPerFile {
+			authors = authors[:cfg.Ownership.MaxAuthorsPerFile]
+		}
+		fo.Authors = authors
+
+		owners = append(owners, fo)
+	}
+	return owners
+}
+
+// blameAuthors aggregates `git blame --line-porcelain` output into per-author line counts,
+// sorted by descending share.
+func blameAuthors(repoPath, file string) ([]AuthorShare, error) {
+	out, err := git(repoPath, "blame", "--line-porcelain", "HEAD", "--", file)
+	if err != nil {
+		return nil, err
+	}
+
+	byEmail := make(map[string]*AuthorShare)
+	var name string
+	for _, ln := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(ln, "author "):
+			name = strings.TrimPrefix(ln, "author ")
+		case strings.HasPrefix(ln, "author-mail "):
+			email := strings.Trim(strings.TrimPrefix(ln, "author-mail "), "<>")
+			share, ok := byEmail[email]
+			if !ok {
+				share = &AuthorShare{Name: name, Email: email}
+				byEmail[email] = share
+			}
+			share.Lines++
+		}
+	}
+
+	authors := make([]AuthorShare, 0, len(byEmail))
+	for _, share := range byEmail {
+		authors = append(authors, *share)
+	}
+	sort.Slice(authors, func(i, j int) bool {
+		if authors[i].Lines != authors[j].Lines {
+			return authors[i].Lines > authors[j].Lines
+		}
+		return authors[i].Email < authors[j].Email
+	})
+	return authors, nil
+}
+
+// RenderOwnershipContext renders ownership data as a markdown section for the agent prompt
+func RenderOwnershipContext(owners []FileOwnership) string {
+	if len(owners) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("# Recent History and Ownership\n\n")
+	for _, fo := range owners {
+		b.WriteString(fmt.Sprintf("## %s\n", fo.Path))
+		if len(fo.Authors) > 0 {
+			b.WriteString("- **Primary authors:** ")
+			names := make([]string, len(fo.Authors))
+			for i, a := range fo.Authors {
+				names[i] = fmt.Sprintf("%s (%d lines)", a.Name, a.Lines)
+			}
+			b.WriteString(strings.Join(names, ", ") + "\n")
+		}
+		if len(fo.RecentCommits) > 0 {
+			b.WriteString("- **Recent commits:**\n")
+			for _, c := range fo.RecentCommits {
+				b.WriteString("  - " + c + "\n")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// SuggestReviewers returns the GitHub logins of the primary authors of the given files, those
+// git blame credits with the most lines across them, excluding bots and the logins in exclude.
+// Authors are matched to logins through the files' recent commits on GitHub or their noreply
+// address; authors matching neither are left out.
+func SuggestReviewers(ctx *probot.Context, repoName string, owners []FileOwnership, exclude ...string) []string {
+	cfg := config.GetConfig()
+	if !cfg.Ownership.Enabled || len(owners) == 0 {
+		return nil
+	}
+
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		slog.ErrorContext(logging.For(ctx), "Invalid repository name format", "repoName", repoName)
+		return nil
+	}
+	client := NewGitHubClient(ctx)
+
+	skip := make(map[string]bool)
+	for _, login := range exclude {
+		skip[strings.ToLower(login)] = true
+	}
+
+	loginByEmail := make(map[string]string)
+	for _, fo := range owners {
+		commits, err := client.ListCommits(context.Background(), owner, repo, fo.Path, cfg.Ownership.MaxCommitsPerFile)
+		if err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to list commits for reviewer suggestion", "file", fo.Path, "error", err)
+			continue
+		}
+		for _, c := range commits {
+			if c.AuthorLogin != "" && c.AuthorEmail != "" {
+				loginByEmail[strings.ToLower(c.AuthorEmail)] = c.AuthorLogin
+			}
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, fo := range owners {
+		for _, a := range fo.Authors {
+			login := loginByEmail[strings.ToLower(a.Email)]
+			if login == "" {
+				login = noreplyLogin(a.Email)
+			}
+			if login == "" || strings.HasSuffix(login, "[bot]") || skip[strings.ToLower(login)] {
+				continue
+			}
+			counts[login] += a.Lines
+		}
+	}
+
+	logins := make([]string, 0, len(counts))
+	for login := range counts {
+		logins = append(logins, login)
+	}
+	sort.Slice(logins, func(i, j int) bool {
+		if counts[logins[i]] != counts[logins[j]] {
+			return counts[logins[i]] > counts[logins[j]]
+		}
+		return logins[i] < logins[j]
+	})
+	if cfg.Ownership.MaxReviewers > 0 && len(logins) > cfg.Ownership.MaxReviewers {
+		logins = logins[:cfg.Ownership.MaxReviewers]
+	}
+	return logins
+}
+
+// noreplyLogin returns the login of a GitHub noreply address, [ID+]login@users.noreply.github.com
+func noreplyLogin(email string) string {
+	local, ok := strings.CutSuffix(strings.ToLower(email), "@users.noreply.github.com")
+	if !ok {
+		return ""
+	}
+	if _, login, found := strings.Cut(local, "+"); found {
+		return login
+	}
+	return local
+}
+
+// TagReviewers appends a "likely domain experts" section to the PR body and, when
+// configured, requests reviews from those users.
+func TagReviewers(ctx *probot.Context, repoName string, pr *githubapi.PullRequest, reviewers []string) error {
+	if len(reviewers) == 0 {
+		return nil
+	}
+	cfg := config.GetConfig()
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
+	client := NewGitHubClient(ctx)
+
+	mentions := make([]string, len(reviewers))
+	for i, r := range reviewers {
+		mentions[i] = "@" + r
+	}
+	body := pr.Body + "\n\n---\n**Likely domain experts** (primary authors of the changed files, by git blame): " + strings.Join(mentions, ", ") + "\n"
+
+	if err := client.EditPullRequestBody(context.Background(), owner, repo, pr.Number, body); err != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to add reviewer suggestions to PR body", "error", err)
+		return err
+	}
+	pr.Body = body
+
+	if cfg.Ownership.RequestReviewers {
+		if err := client.RequestReviewers(context.Background(), owner, repo, pr.Number, reviewers); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to request reviewers", "reviewers", reviewers, "error", err)
+		}
+	}
+
+	slog.InfoContext(logging.For(ctx), "Tagged likely domain experts on PR", "prNumber", pr.Number, "reviewers", reviewers)
+	return nil
+}
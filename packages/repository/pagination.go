@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"devflow-agent/packages/config"
+
+	"github.com/google/go-github/github"
+)
+
+// cachedPage is a list page kept for conditional requests
+type cachedPage struct {
+	url  string
+	etag string
+	body []byte
+	next int // following page number; 0 on the last page
+}
+
+// pageCache holds the most recently fetched pages by URL, evicting the least recently used
+// once github.etag_cache_entries is reached
+var pageCache = struct {
+	sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}{entries: map[string]*list.Element{}, order: list.New()}
+
+// Paginate fetches every page of a GitHub REST list endpoint and decodes all items into out,
+// a pointer to a slice. path is relative to the API root and may carry a query; the endpoint
+// must return a JSON array. Pages fetched before are requested with If-None-Match, so a page
+// that has not changed is served from the cache and does not count against the rate limit.
+func Paginate(ctx context.Context, gh *github.Client, path string, out any) error {
+	var items []json.RawMessage
+	for page := 1; page != 0; {
+		u, err := pageURL(path, page)
+		if err != nil {
+			return err
+		}
+		body, next, err := fetchPage(ctx, gh, u)
+		if err != nil {
+			return err
+		}
+		var pageItems []json.RawMessage
+		if err := json.Unmarshal(body, &pageItems); err != nil {
+			return fmt.Errorf("failed to decode page %d of %s: %w", page, path, err)
+		}
+		items = append(items, pageItems...)
+		page = next
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// pageURL adds the page number and github.per_page to a list path
+func pageURL(path string, page int) (string, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid list path %q: %w", path, err)
+	}
+	q := u.Query()
+	if perPage := config.GetConfig().GitHub.PerPage; perPage > 0 {
+		q.Set("per_page", strconv.Itoa(perPage))
+	}
+	q.Set("page", strconv.Itoa(page))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// fetchPage requests one page, revalidating a cached copy with its ETag. It returns the page
+// body and the number of the next page.
+func fetchPage(ctx context.Context, gh *github.Client, path string) ([]byte, int, error) {
+	req, err := gh.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	key := req.URL.String()
+	cached := cachedPageFor(key)
+	if cached != nil {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	var body bytes.Buffer
+	resp, err := gh.Do(ctx, req, &body)
+	if cached != nil && resp != nil && resp.StatusCode == http.StatusNotModified {
+		return cached.body, cached.next, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		storePage(&cachedPage{url: key, etag: etag, body: body.Bytes(), next: resp.NextPage})
+	}
+	return body.Bytes(), resp.NextPage, nil
+}
+
+// cachedPageFor returns the cached page for a URL, or nil
+func cachedPageFor(key string) *cachedPage {
+	pageCache.Lock()
+	defer pageCache.Unlock()
+	el, ok := pageCache.entries[key]
+	if !ok {
+		return nil
+	}
+	pageCache.order.MoveToFront(el)
+	return el.Value.(*cachedPage)
+}
+
+// storePage caches a page, evicting the least recently used pages beyond the configured limit
+func storePage(page *cachedPage) {
+	limit := config.GetConfig().GitHub.ETagCacheEntries
+	if limit <= 0 {
+		return
+	}
+	pageCache.Lock()
+	defer pageCache.Unlock()
+	if el, ok := pageCache.entries[page.url]; ok {
+		el.Value = page
+		pageCache.order.MoveToFront(el)
+	} else {
+		pageCache.entries[page.url] = pageCache.order.PushFront(page)
+	}
+	for pageCache.order.Len() > limit {
+		oldest := pageCache.order.Back()
+		pageCache.order.Remove(oldest)
+		delete(pageCache.entries, oldest.Value.(*cachedPage).url)
+	}
+}
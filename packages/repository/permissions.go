@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"devflow-agent/packages/logging"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bradleyfalzon/ghinstallation"
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// WorkflowsDir is where GitHub Actions workflows live; writing there needs the `workflows` permission
+const WorkflowsDir = ".github/workflows/"
+
+// GetInstallationPermissions returns the permissions granted to an installation of this app
+// (e.g. "contents": "write"). It authenticates as the app itself, since an installation token
+// cannot read its own installation.
+func GetInstallationPermissions(ctx *probot.Context, installationID int64) (map[string]string, error) {
+	if ctx.App == nil {
+		return nil, fmt.Errorf("no GitHub App credentials available")
+	}
+
+	tr, err := ghinstallation.NewAppsTransport(http.DefaultTransport, ctx.App.ID, ctx.App.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create app transport: %w", err)
+	}
+	tr.BaseURL = ctx.App.BaseURL
+	client, err := github.NewEnterpriseClient(ctx.App.BaseURL, ctx.App.BaseURL, &http.Client{Transport: tr})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := client.NewRequest("GET", fmt.Sprintf("app/installations/%d", installationID), nil)
+	if err != nil {
+		return nil, err
+	}
+	var installation struct {
+		Permissions map[string]string `json:"permissions"`
+	}
+	if _, err := client.Do(context.Background(), req, &installation); err != nil {
+		return nil, fmt.Errorf("failed to fetch installation %d: %w", installationID, err)
+	}
+
+	slog.InfoContext(logging.For(ctx), "Fetched installation permissions", "installationID", installationID, "permissions", installation.Permissions)
+	return installation.Permissions, nil
+}
+
+// CanWriteWorkflows reports whether the permission set allows pushing workflow files
+func CanWriteWorkflows(perms map[string]string) bool {
+	return perms["workflows"] == "write"
+}
+
+// IsWorkflowPath reports whether a repo-relative path is a GitHub Actions workflow file
+func IsWorkflowPath(p string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(p, "./"), WorkflowsDir)
+}
+
+// SplitWorkflowChanges separates workflow files from the rest of the changed paths
+func SplitWorkflowChanges(paths []string) (others, workflows []string) {
+	for _, p := range paths {
+		if IsWorkflowPath(p) {
+			workflows = append(workflows, p)
+		} else {
+			others = append(others, p)
+		}
+	}
+	return others, workflows
+}
+
+// WorkflowPermissionNote explains why workflow changes were left out and how to grant access
+func WorkflowPermissionNote(workflows []string) string {
+	var b strings.Builder
+	b.WriteString("### Workflow changes need the `workflows` permission\n\n")
+	b.WriteString("The fix also touches GitHub Actions workflows, but this app is not allowed to push to `" + WorkflowsDir + "`. ")
+	b.WriteString("These files were left unchanged:\n\n")
+	for _, p := range workflows {
+		b.WriteString(fmt.Sprintf("- `%s`\n", p))
+	}
+	b.WriteString("\nTo let DevFlow update workflows, an owner can grant **Workflows: Read and write** in the app's installation settings, ")
+	b.WriteString("or apply the workflow changes manually.")
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/plugins"
+)
+
+// pluginsDir is the knowledge base directory analyze plugins write their documents to
+const pluginsDir = "plugins"
+
+// pluginStage runs the analyze plugins and writes their documents to .devflow/plugins/<plugin>/,
+// replacing those of earlier builds. It returns the files written; a failing plugin is logged
+// and skipped so it cannot fail the build.
+func pluginStage(repoPath, repoName string) []string {
+	cfg := config.GetConfig()
+	dir := cfg.GetDevflowPath(repoPath, pluginsDir)
+	if err := os.RemoveAll(dir); err != nil {
+		slog.Warn("Failed to clear plugin documents", "error", err)
+	}
+	var files []string
+	for _, p := range plugins.For(config.PluginHookAnalyze, repoName) {
+		ctx, cancel := config.StageContext(context.Background(), cfg.Timeouts.AnalysisSeconds)
+		resp, err := plugins.Run(ctx, p, plugins.Request{Hook: config.PluginHookAnalyze, Repo: repoName, RepoPath: repoPath})
+		cancel()
+		if err != nil {
+			slog.Warn("Analyze plugin failed, continuing without it", "plugin", p.Name, "error", err)
+			continue
+		}
+		for _, doc := range resp.Documents {
+			name := filepath.Base(filepath.Clean("/" + doc.Name))
+			if name == "/" || name == "." {
+				slog.Warn("Skipping plugin document without a name", "plugin", p.Name)
+				continue
+			}
+			if filepath.Ext(name) == "" {
+				name += ".md"
+			}
+			file := filepath.Join(dir, filepath.Base(filepath.Clean("/"+p.Name)), name)
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				slog.Warn("Failed to write plugin document", "plugin", p.Name, "error", err)
+				continue
+			}
+			if err := os.WriteFile(file, []byte(strings.TrimRight(doc.Content, "\n")+"\n"), 0644); err != nil {
+				slog.Warn("Failed to write plugin document", "plugin", p.Name, "error", err)
+				continue
+			}
+			files = append(files, file)
+		}
+		slog.Info("Analyze plugin finished", "plugin", p.Name, "documents", len(resp.Documents))
+	}
+	return files
+}
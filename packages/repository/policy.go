@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"devflow-agent/packages/config"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// PathViolation records a file the agent attempted to modify against the repo's path policy
+type PathViolation struct {
+	Path   string
+	Reason string
+}
+
+// PolicyViolationError is returned when a commit includes paths the policy forbids
+type PolicyViolationError struct {
+	Violations []PathViolation
+}
+
+func (e *PolicyViolationError) Error() string {
+	paths := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		paths[i] = v.Path
+	}
+	return fmt.Sprintf("path policy forbids modifying: %s", strings.Join(paths, ", "))
+}
+
+// CheckPathPolicy returns why repo-relative path p may not be modified, or "" if allowed.
+func CheckPathPolicy(policy config.PathPolicyConfig, p string) string {
+	p = strings.TrimPrefix(path.Clean(strings.ReplaceAll(p, "\\", "/")), "./")
+	for _, pattern := range policy.Deny {
+		if MatchPathPattern(pattern, p) {
+			return fmt.Sprintf("matches deny pattern `%s`", pattern)
+		}
+	}
+	if len(policy.Allow) == 0 {
+		return ""
+	}
+	for _, pattern := range policy.Allow {
+		if MatchPathPattern(pattern, p) {
+			return ""
+		}
+	}
+	return "not matched by any allow pattern"
+}
+
+// FilterByPathPolicy splits repo-relative paths into allowed paths and violations.
+func FilterByPathPolicy(policy config.PathPolicyConfig, paths []string) ([]string, []PathViolation) {
+	var allowed []string
+	var violations []PathViolation
+	for _, p := range paths {
+		if reason := CheckPathPolicy(policy, p); reason != "" {
+			violations = append(violations, PathViolation{Path: p, Reason: reason})
+			continue
+		}
+		allowed = append(allowed, p)
+	}
+	return allowed, violations
+}
+
+// RevertPaths discards local modifications to the given repo-relative paths,
+// removing them if they are untracked.
+func RevertPaths(repoPath string, paths []string) {
+	for _, p := range paths {
+		if _, err := git(repoPath, "checkout", "HEAD", "--", p); err != nil {
+			_, _ = git(repoPath, "clean", "-f", "--", p)
+		}
+	}
+}
+
+// FormatPathViolations renders violations as a markdown list
+func FormatPathViolations(violations []PathViolation) string {
+	var b strings.Builder
+	for _, v := range violations {
+		b.WriteString(fmt.Sprintf("- `%s` (%s)\n", v.Path, v.Reason))
+	}
+	return b.String()
+}
+
+// MatchPathPattern matches a slash-separated path against a glob where "**" spans
+// any number of directories and a trailing "/" matches everything beneath a directory.
+func MatchPathPattern(pattern, p string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		parts = parts[1:]
+	}
+	return len(parts) == 0
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"devflow-agent/packages/githubapi"
+
+	"github.com/google/go-github/github"
+	"github.com/swinton/go-probot/probot"
+)
+
+// PolledEvent is a webhook event rebuilt from the REST API, for setups that cannot receive
+// webhooks
+type PolledEvent struct {
+	ID      string // unique per event, e.g. "issue-event-123" or "comment-456"
+	Type    string // webhook event name: "issues" or "issue_comment"
+	Payload any    // *github.IssuesEvent or *github.IssueCommentEvent
+	Created time.Time
+}
+
+// PollRepositoryEvents returns, oldest first, the issue "labeled" events and new issue and
+// PR comments of repoName created at or after since. Only comments for which wantComment
+// returns true are returned, since each costs a request for its issue.
+func PollRepositoryEvents(runCtx context.Context, ctx *probot.Context, repoName string, since time.Time, wantComment func(body string) bool) ([]PolledEvent, error) {
+	owner, name, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return nil, err
+	}
+	repo, _, err := ctx.GitHub.Repositories.Get(runCtx, owner, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository %s: %w", repoName, err)
+	}
+
+	var events []PolledEvent
+	// Issue events come newest first; stop at the first page that reaches past since
+	opt := &github.ListOptions{PerPage: 100}
+	for done := false; !done; {
+		page, resp, err := ctx.GitHub.Issues.ListRepositoryEvents(runCtx, owner, name, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list issue events of %s: %w", repoName, err)
+		}
+		for _, ev := range page {
+			if ev.GetCreatedAt().Before(since) {
+				done = true
+				break
+			}
+			if ev.GetEvent() != "labeled" || ev.Issue == nil || ev.Issue.IsPullRequest() {
+				continue
+			}
+			events = append(events, PolledEvent{
+				ID:   "issue-event-" + strconv.FormatInt(ev.GetID(), 10),
+				Type: "issues",
+				Payload: &github.IssuesEvent{
+					Action: github.String("labeled"),
+					Issue:  ev.Issue,
+					Label:  ev.Label,
+					Repo:   repo,
+					Sender: ev.Actor,
+				},
+				Created: ev.GetCreatedAt(),
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	// since filters on updated_at; edited older comments are dropped below
+	copt := &github.IssueListCommentsOptions{Sort: "created", Direction: "asc", Since: since, ListOptions: github.ListOptions{PerPage: 100}}
+	issues := map[int]*github.Issue{}
+	for {
+		page, resp, err := ctx.GitHub.Issues.ListComments(runCtx, owner, name, 0, copt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list comments of %s: %w", repoName, err)
+		}
+		for _, c := range page {
+			if c.GetCreatedAt().Before(since) || !wantComment(c.GetBody()) {
+				continue
+			}
+			number, err := strconv.Atoi(path.Base(c.GetIssueURL()))
+			if err != nil {
+				continue
+			}
+			issue, ok := issues[number]
+			if !ok {
+				if issue, _, err = ctx.GitHub.Issues.Get(runCtx, owner, name, number); err != nil {
+					return nil, fmt.Errorf("failed to get issue %s#%d: %w", repoName, number, err)
+				}
+				issues[number] = issue
+			}
+			events = append(events, PolledEvent{
+				ID:   "comment-" + strconv.FormatInt(c.GetID(), 10),
+				Type: "issue_comment",
+				Payload: &github.IssueCommentEvent{
+					Action:  github.String("created"),
+					Issue:   issue,
+					Comment: c,
+					Repo:    repo,
+					Sender:  c.User,
+				},
+				Created: c.GetCreatedAt(),
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		copt.Page = resp.NextPage
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Created.Before(events[j].Created) })
+	return events, nil
+}
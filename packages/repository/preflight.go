@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// requiredPermissions are the installation permissions an issue run needs to push its branch,
+// open its pull request and report on the issue
+var requiredPermissions = []string{"contents", "pull_requests", "issues"}
+
+// branchNamePattern is the parameters of a "branch_name_pattern" rule
+type branchNamePattern struct {
+	Operator string `json:"operator"` // starts_with, ends_with, contains or regex
+	Pattern  string `json:"pattern"`
+	Negate   bool   `json:"negate"`
+}
+
+// PreflightProblems checks, before any work is done, that the run can push branch and open a
+// pull request on the repository: it is not archived, the app (or token) may write to it, and
+// no ruleset the app cannot bypass forbids creating or pushing the branch. It returns the
+// problems found, worded for the issue. Checks the host or credentials cannot answer are
+// skipped, so a run is only stopped for a problem that was actually seen. installationID is 0
+// outside of App mode.
+func PreflightProblems(ctx *probot.Context, repoName, branch string, installationID int64) []string {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	client := NewGitHubClient(ctx)
+	apiCtx := context.Background()
+	var problems []string
+
+	info, err := client.GetRepository(apiCtx, owner, repo)
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Pre-flight check could not read the repository", "repo", repoName, "error", err)
+	} else {
+		if info.Archived {
+			problems = append(problems, "The repository is archived, so nothing can be pushed to it.")
+		}
+		if info.CanPush != nil && !*info.CanPush {
+			problems = append(problems, "The token DevFlow runs with has no push access to the repository.")
+		}
+	}
+
+	if installationID != 0 && ctx.App != nil {
+		perms, err := GetInstallationPermissions(ctx, installationID)
+		if err != nil {
+			slog.WarnContext(logging.For(ctx), "Pre-flight check could not read the app's permissions", "repo", repoName, "error", err)
+		}
+		for _, name := range requiredPermissions {
+			if perms != nil && perms[name] != "write" && perms[name] != "admin" {
+				problems = append(problems, fmt.Sprintf("The app needs the **%s: Read and write** permission; it has %s.",
+					permissionTitle(name), permissionLevel(perms[name])))
+			}
+		}
+	}
+
+	rules, err := client.ListBranchRules(apiCtx, owner, repo, branch)
+	if err != nil && !errors.Is(err, githubapi.ErrNotFound) && !errors.Is(err, githubapi.ErrUnsupported) {
+		slog.WarnContext(logging.For(ctx), "Pre-flight check could not read branch rules", "repo", repoName, "branch", branch, "error", err)
+	}
+	// The rules-for-branch API does not say who may bypass a rule; its ruleset does
+	bypass := map[int64]bool{}
+	for _, rule := range rules {
+		var problem string
+		switch rule.Type {
+		case "creation":
+			problem = fmt.Sprintf("A ruleset restricts creating branches like `%s`; add the app to its bypass list or exclude `%s`.", branch, branchPattern(branch))
+		case "update":
+			problem = fmt.Sprintf("A ruleset restricts pushing to branches like `%s`; add the app to its bypass list or exclude `%s`.", branch, branchPattern(branch))
+		case "branch_name_pattern":
+			var p branchNamePattern
+			if json.Unmarshal(rule.Parameters, &p) == nil && !p.matches(branch) {
+				problem = fmt.Sprintf("A ruleset requires branch names to match `%s` (%s), which `%s` does not; change `issues.branch_prefix`.", p.Pattern, p.describe(), branch)
+			}
+		}
+		if problem == "" {
+			continue
+		}
+		canBypass, ok := bypass[rule.RulesetID]
+		if !ok {
+			canBypass = canBypassRuleset(ctx, client, owner, repo, rule.RulesetID)
+			bypass[rule.RulesetID] = canBypass
+		}
+		if !canBypass {
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
+
+// canBypassRuleset reports whether the app may bypass a ruleset, also when that cannot be
+// told, so only a rule seen to apply stops a run
+func canBypassRuleset(ctx *probot.Context, client githubapi.Client, owner, repo string, id int64) bool {
+	ruleset, err := client.GetRuleset(context.Background(), owner, repo, id)
+	if err != nil {
+		slog.WarnContext(logging.For(ctx), "Pre-flight check could not read a ruleset, not blocking on it", "repo", owner+"/"+repo, "ruleset", id, "error", err)
+		return true
+	}
+	if ruleset.CurrentUserCanBypass == "" {
+		slog.WarnContext(logging.For(ctx), "Pre-flight check cannot tell whether the app bypasses a ruleset, not blocking on it", "repo", owner+"/"+repo, "ruleset", ruleset.Name)
+		return true
+	}
+	// "pull_requests_only" bypasses merging pull requests, not pushing branches
+	return ruleset.CurrentUserCanBypass == "always"
+}
+
+// PreflightComment explains why a run was not started
+func PreflightComment(problems []string) string {
+	var b strings.Builder
+	b.WriteString("### DevFlow cannot work on this issue yet\n\n")
+	b.WriteString("Before starting, DevFlow checked that it can push a branch and open a pull request here, and found:\n\n")
+	for _, p := range problems {
+		b.WriteString("- " + p + "\n")
+	}
+	b.WriteString("\nOnce these are fixed, relabel the issue to try again.")
+	return b.String()
+}
+
+func (p branchNamePattern) matches(name string) bool {
+	var ok bool
+	switch p.Operator {
+	case "starts_with":
+		ok = strings.HasPrefix(name, p.Pattern)
+	case "ends_with":
+		ok = strings.HasSuffix(name, p.Pattern)
+	case "contains":
+		ok = strings.Contains(name, p.Pattern)
+	case "regex":
+		re, err := regexp.Compile(p.Pattern)
+		// A pattern Go cannot compile is given the benefit of the doubt
+		ok = err != nil || re.MatchString(name)
+	default:
+		ok = true
+	}
+	return ok != p.Negate
+}
+
+func (p branchNamePattern) describe() string {
+	op := strings.ReplaceAll(p.Operator, "_", " ")
+	if p.Negate {
+		return "must not " + op
+	}
+	return op
+}
+
+// branchPattern is the fnmatch pattern of the branches sharing branch's first path segment,
+// e.g. devflow/* for devflow/issue-12-title
+func branchPattern(branch string) string {
+	if prefix, _, ok := strings.Cut(branch, "/"); ok {
+		return prefix + "/*"
+	}
+	return branch
+}
+
+// permissionTitle is a permission as the app settings page names it
+func permissionTitle(name string) string {
+	switch name {
+	case "contents":
+		return "Contents"
+	case "pull_requests":
+		return "Pull requests"
+	case "issues":
+		return "Issues"
+	}
+	return name
+}
+
+func permissionLevel(level string) string {
+	if level == "" {
+		return "no access"
+	}
+	return level + " access"
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// Markers around the preview section of a pull request body, so a later URL replaces it
+const (
+	previewStart = "<!-- devflow:preview -->"
+	previewEnd   = "<!-- /devflow:preview -->"
+)
+
+// PreviewRequest tells a preview hook which pull request to deploy
+type PreviewRequest struct {
+	Repo        string `json:"repo"`
+	Branch      string `json:"branch"`
+	PRNumber    int    `json:"pr_number"`
+	PRURL       string `json:"pr_url"`
+	IssueNumber int    `json:"issue_number"`
+}
+
+// previewResponse is the optional answer of a preview hook
+type previewResponse struct {
+	URL string `json:"url"`
+}
+
+// RequestPreview asks the configured webhook, or else the configured command, to deploy a
+// preview of req's branch. It returns the preview URL the hook answered with, or "" when the
+// hook will post it to the admin API later.
+func RequestPreview(ctx context.Context, cfg config.PreviewsConfig, req PreviewRequest) (string, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	var answer []byte
+	switch {
+	case cfg.WebhookURL != "":
+		answer, err = callPreviewWebhook(ctx, cfg, payload)
+	case len(cfg.Command) > 0:
+		cmd := exec.CommandContext(ctx, cfg.Command[0], cfg.Command[1:]...)
+		cmd.Stdin = bytes.NewReader(payload)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if answer, err = cmd.Output(); err != nil {
+			err = fmt.Errorf("preview command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	default:
+		return "", fmt.Errorf("previews are enabled but neither webhook_url nor command is set")
+	}
+	if err != nil {
+		return "", err
+	}
+	return parsePreviewAnswer(answer)
+}
+
+func callPreviewWebhook(ctx context.Context, cfg config.PreviewsConfig, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.WebhookSecretEnv != "" {
+		if secret := os.Getenv(cfg.WebhookSecretEnv); secret != "" {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(payload)
+			req.Header.Set("X-DevFlow-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("preview webhook failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("preview webhook returned %s", resp.Status)
+	}
+	return body, nil
+}
+
+// parsePreviewAnswer reads {"url": ...} or, from a command, a URL on the first line
+func parsePreviewAnswer(answer []byte) (string, error) {
+	answer = bytes.TrimSpace(answer)
+	if len(answer) == 0 {
+		return "", nil
+	}
+	var resp previewResponse
+	if err := json.Unmarshal(answer, &resp); err != nil {
+		line, _, _ := bufio.NewReader(bytes.NewReader(answer)).ReadLine()
+		resp.URL = strings.TrimSpace(string(line))
+	}
+	if resp.URL == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(resp.URL, "https://") && !strings.HasPrefix(resp.URL, "http://") {
+		return "", fmt.Errorf("preview hook answered with %q, which is not an http(s) URL", resp.URL)
+	}
+	return resp.URL, nil
+}
+
+// SetPreviewURL adds the preview URL to an open pull request's body, replacing the one an
+// earlier preview added
+func SetPreviewURL(ctx *probot.Context, repoName string, prNumber int, url string) error {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
+	client := NewGitHubClient(ctx)
+	prs, err := client.ListPullRequests(context.Background(), owner, repo, "open", "")
+	if err != nil {
+		return err
+	}
+	for _, pr := range prs {
+		if pr.Number == prNumber {
+			return client.EditPullRequestBody(context.Background(), owner, repo, prNumber, withPreviewURL(pr.Body, url))
+		}
+	}
+	return fmt.Errorf("pull request %s#%d is not open", repoName, prNumber)
+}
+
+// withPreviewURL returns body with its preview section set to url
+func withPreviewURL(body, url string) string {
+	section := previewStart + "\n**Preview deployment:** " + url + "\n" + previewEnd
+	if start := strings.Index(body, previewStart); start >= 0 {
+		if end := strings.Index(body[start:], previewEnd); end >= 0 {
+			return body[:start] + section + body[start+end+len(previewEnd):]
+		}
+	}
+	return strings.TrimRight(body, "\n") + "\n\n" + section + "\n"
+}
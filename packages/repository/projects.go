@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// GetIssue fetches an issue
+func GetIssue(ctx *probot.Context, repoName string, issueNumber int) (*githubapi.Issue, error) {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return nil, err
+	}
+	return NewGitHubClient(ctx).GetIssue(context.Background(), owner, repo, issueNumber)
+}
+
+// SetMilestone puts an issue or pull request in a milestone
+func SetMilestone(ctx *probot.Context, repoName string, number, milestone int) error {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
+	if err := NewGitHubClient(ctx).SetIssueMilestone(context.Background(), owner, repo, number, milestone); err != nil {
+		return fmt.Errorf("failed to set milestone of #%d: %w", number, err)
+	}
+	return nil
+}
+
+// MoveOnBoard adds an issue or PR (by node ID) to the board if needed and sets its status
+func MoveOnBoard(ctx *probot.Context, board config.ProjectBoardConfig, contentNodeID, status string) error {
+	client := NewGitHubClient(ctx)
+	itemID, err := client.AddProjectItem(context.Background(), board.ProjectID, contentNodeID)
+	if err != nil {
+		return err
+	}
+	if status == "" {
+		return nil
+	}
+	return client.SetProjectItemOption(context.Background(), board.ProjectID, itemID, board.StatusField, status)
+}
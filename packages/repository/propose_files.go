@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// ProposeFiles commits files, keyed by their path in the repository, on top of the default
+// branch and opens a pull request for them from branch, or updates the one already open. The
+// branch only ever holds this proposal, so it is overwritten. No clone is needed.
+func ProposeFiles(ctx *probot.Context, repoName, branch, message, title, body string, files map[string][]byte) (*githubapi.PullRequest, error) {
+	cfg := config.GetConfig()
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return nil, err
+	}
+	client := NewGitHubClient(ctx)
+	apiCtx, cancel := config.StageContext(context.Background(), cfg.Timeouts.PushSeconds)
+	defer cancel()
+
+	base, err := client.GetRef(apiCtx, owner, repo, "refs/heads/"+cfg.Repository.DefaultBranch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the default branch: %w", err)
+	}
+	commit, err := client.GetCommit(apiCtx, owner, repo, base.SHA)
+	if err != nil {
+		return nil, err
+	}
+	var entries []githubapi.TreeEntry
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		blobSHA, err := client.CreateBlob(apiCtx, owner, repo, string(files[path]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create blob for %s: %w", path, err)
+		}
+		entries = append(entries, githubapi.TreeEntry{Path: path, Mode: githubapi.ModeFile, Type: "blob", SHA: blobSHA})
+	}
+	treeSHA, err := client.CreateTree(apiCtx, owner, repo, commit.TreeSHA, entries)
+	if err != nil {
+		return nil, err
+	}
+	created, err := client.CreateCommit(apiCtx, owner, repo, message, treeSHA, []string{commit.SHA})
+	if err != nil {
+		return nil, err
+	}
+
+	ref := "refs/heads/" + branch
+	if _, err = client.GetRef(apiCtx, owner, repo, ref); err == nil {
+		err = client.UpdateRef(apiCtx, owner, repo, ref, created.SHA, true)
+	} else if errors.Is(err, githubapi.ErrNotFound) {
+		err = client.CreateRef(apiCtx, owner, repo, ref, created.SHA)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update branch %s: %w", branch, err)
+	}
+
+	open, err := client.ListPullRequests(apiCtx, owner, repo, "open", owner+":"+branch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the pull request of %s: %w", branch, err)
+	}
+	if len(open) > 0 {
+		if err := client.EditPullRequestBody(apiCtx, owner, repo, open[0].Number, body); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to update pull request body", "prNumber", open[0].Number, "error", err)
+		}
+		slog.InfoContext(logging.For(ctx), "Updated proposed files", "repo", repoName, "branch", branch, "prNumber", open[0].Number)
+		return &open[0], nil
+	}
+	return CreatePullRequest(ctx, repoName, branch, title, body)
+}
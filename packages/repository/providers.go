@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// providerClients holds the client of each context built for an Azure DevOps or Bitbucket
+// event; NewGitHubClient returns it in place of a GitHub client
+var providerClients sync.Map // *probot.Context -> githubapi.Client
+
+// providerCloneURLs holds the clone URL of each repository seen on another host
+var providerCloneURLs sync.Map // repoName -> string
+
+// NewProviderContext returns a context whose API calls go to client, so an event from another
+// host runs through the GitHub handlers. The event's repository is cloned from cloneURL.
+// ReleaseProviderContext must be called once the event is handled.
+func NewProviderContext(client githubapi.Client, repoName, cloneURL string) *probot.Context {
+	ctx := &probot.Context{}
+	providerClients.Store(ctx, client)
+	providerCloneURLs.Store(repoName, cloneURL)
+	return ctx
+}
+
+// ReleaseProviderContext forgets the client of a context built by NewProviderContext
+func ReleaseProviderContext(ctx *probot.Context) {
+	providerClients.Delete(ctx)
+}
+
+// providerClient returns the client bound to ctx, if it was built for another host
+func providerClient(ctx *probot.Context) (githubapi.Client, bool) {
+	client, ok := providerClients.Load(ctx)
+	if !ok {
+		return nil, false
+	}
+	return client.(githubapi.Client), true
+}
+
+// providerCloneURL returns the clone URL of a repository on another host
+func providerCloneURL(repoName string) (string, bool) {
+	u, ok := providerCloneURLs.Load(repoName)
+	if !ok {
+		return "", false
+	}
+	return u.(string), true
+}
+
+// gitAuthMu serializes changes to the git configuration passed through the environment
+var gitAuthMu sync.Mutex
+
+// AddGitAuthHeader makes git send an Authorization header to every URL under urlPrefix, the
+// way actions/checkout does, so tokens never appear in clone URLs or logs
+func AddGitAuthHeader(urlPrefix, authorization string) {
+	gitAuthMu.Lock()
+	defer gitAuthMu.Unlock()
+	n, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	os.Setenv(fmt.Sprintf("GIT_CONFIG_KEY_%d", n), "http."+strings.TrimSuffix(urlPrefix, "/")+"/.extraheader")
+	os.Setenv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", n), "AUTHORIZATION: "+authorization)
+	os.Setenv("GIT_CONFIG_COUNT", strconv.Itoa(n+1))
+	os.Setenv("GIT_TERMINAL_PROMPT", "0")
+}
+
+// NewAzureDevOpsClient returns the client for the configured Azure DevOps organization and
+// lets git clone its repositories with the same token
+func NewAzureDevOpsClient() (githubapi.Client, error) {
+	cfg := config.GetConfig().Providers.AzureDevOps
+	token := os.Getenv(cfg.TokenEnv)
+	if cfg.Organization == "" || token == "" {
+		return nil, fmt.Errorf("providers.azure_devops needs an organization and a token in %s", cfg.TokenEnv)
+	}
+	AddGitAuthHeader(cfg.BaseURL, "basic "+base64.StdEncoding.EncodeToString([]byte(":"+token)))
+	return githubapi.NewAzureDevOps(cfg.BaseURL, cfg.Organization, token), nil
+}
+
+// NewBitbucketClient returns the client for Bitbucket Cloud and lets git clone its
+// repositories with the same token
+func NewBitbucketClient() (githubapi.Client, error) {
+	cfg := config.GetConfig().Providers.Bitbucket
+	token := os.Getenv(cfg.TokenEnv)
+	if token == "" {
+		return nil, fmt.Errorf("providers.bitbucket needs a token in %s", cfg.TokenEnv)
+	}
+	AddGitAuthHeader(cfg.WebURL, "basic "+base64.StdEncoding.EncodeToString([]byte("x-token-auth:"+token)))
+	return githubapi.NewBitbucket(cfg.APIURL, token), nil
+}
+
+// ProviderIssueEvent is an issue event from Azure DevOps or Bitbucket, reduced to what the
+// issues handler needs
+type ProviderIssueEvent struct {
+	DeliveryID  string
+	RepoName    string
+	CloneURL    string
+	Number      int
+	Title       string
+	Body        string
+	Labels      []string // all labels (tags or component) after the change
+	AddedLabels []string // labels the change added
+	Sender      string
+	UpdatedAt   time.Time
+}
+
+type azureDevOpsPayload struct {
+	ID        string `json:"id"`
+	EventType string `json:"eventType"`
+	Resource  struct {
+		ID         int            `json:"id"`
+		WorkItemID int            `json:"workItemId"` // workitem.updated only
+		Fields     map[string]any `json:"fields"`
+		Revision   struct {
+			Fields map[string]any `json:"fields"`
+		} `json:"revision"`
+		RevisedBy struct {
+			UniqueName string `json:"uniqueName"`
+		} `json:"revisedBy"`
+	} `json:"resource"`
+}
+
+// ParseAzureDevOpsEvent parses a workitem.created or workitem.updated service hook. On
+// updates, only tags added by that update count as added labels.
+func ParseAzureDevOpsEvent(payload []byte) (*ProviderIssueEvent, error) {
+	var p azureDevOpsPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("invalid service hook payload: %w", err)
+	}
+
+	fields := p.Resource.Fields
+	ev := &ProviderIssueEvent{DeliveryID: p.ID, Number: p.Resource.ID}
+	switch p.EventType {
+	case "workitem.created":
+		ev.Labels = githubapi.SplitAzureTags(fieldString(fields, "System.Tags"))
+		ev.AddedLabels = ev.Labels
+		ev.Sender = identityName(fields["System.CreatedBy"])
+	case "workitem.updated":
+		// Fields of an update hold the changed values; the revision holds the whole item
+		ev.Number = p.Resource.WorkItemID
+		if change, ok := fields["System.Tags"].(map[string]any); ok {
+			before := githubapi.SplitAzureTags(fmt.Sprint(change["oldValue"]))
+			for _, tag := range githubapi.SplitAzureTags(fmt.Sprint(change["newValue"])) {
+				if !containsFold(before, tag) {
+					ev.AddedLabels = append(ev.AddedLabels, tag)
+				}
+			}
+		}
+		fields = p.Resource.Revision.Fields
+		ev.Labels = githubapi.SplitAzureTags(fieldString(fields, "System.Tags"))
+		ev.Sender = p.Resource.RevisedBy.UniqueName
+	default:
+		return nil, fmt.Errorf("unsupported service hook event %q", p.EventType)
+	}
+
+	cfg := config.GetConfig().Providers.AzureDevOps
+	project := fieldString(fields, "System.TeamProject")
+	if project == "" || ev.Number == 0 {
+		return nil, fmt.Errorf("service hook payload has no work item or project")
+	}
+	repo := cfg.Repositories[project]
+	if repo == "" {
+		repo = project
+	}
+	ev.RepoName = project + "/" + repo
+	ev.CloneURL = fmt.Sprintf("%s/%s/%s/_git/%s", strings.TrimRight(cfg.BaseURL, "/"), url.PathEscape(cfg.Organization), url.PathEscape(project), url.PathEscape(repo))
+	ev.Title = fieldString(fields, "System.Title")
+	ev.Body = githubapi.HTMLToText(fieldString(fields, "System.Description"))
+	if ev.Body == "" {
+		ev.Body = githubapi.HTMLToText(fieldString(fields, "Microsoft.VSTS.TCM.ReproSteps"))
+	}
+	ev.UpdatedAt, _ = time.Parse(time.RFC3339, fieldString(fields, "System.ChangedDate"))
+	return ev, nil
+}
+
+// fieldString returns a work item field as a string
+func fieldString(fields map[string]any, name string) string {
+	if v, ok := fields[name].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// identityName returns the unique name of an identity field, which service hooks send either
+// as an object or as "Display Name <unique name>"
+func identityName(v any) string {
+	switch id := v.(type) {
+	case map[string]any:
+		return fmt.Sprint(id["uniqueName"])
+	case string:
+		if start := strings.LastIndex(id, "<"); start >= 0 && strings.HasSuffix(id, ">") {
+			return id[start+1 : len(id)-1]
+		}
+		return id
+	}
+	return ""
+}
+
+type bitbucketPayload struct {
+	Actor struct {
+		Nickname string `json:"nickname"`
+	} `json:"actor"`
+	Issue struct {
+		ID      int    `json:"id"`
+		Title   string `json:"title"`
+		Content struct {
+			Raw string `json:"raw"`
+		} `json:"content"`
+		Component *struct {
+			Name string `json:"name"`
+		} `json:"component"`
+		UpdatedOn time.Time `json:"updated_on"`
+	} `json:"issue"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Changes struct {
+		Component *struct {
+			New *struct {
+				Name string `json:"name"`
+			} `json:"new"`
+		} `json:"component"`
+	} `json:"changes"`
+}
+
+// ParseBitbucketEvent parses an issue:created or issue:updated webhook. The issue's component
+// is its label; it counts as added when the issue is created with it or changed to it.
+func ParseBitbucketEvent(eventKey, deliveryID string, payload []byte) (*ProviderIssueEvent, error) {
+	if eventKey != "issue:created" && eventKey != "issue:updated" {
+		return nil, fmt.Errorf("unsupported Bitbucket event %q", eventKey)
+	}
+	var p bitbucketPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("invalid Bitbucket payload: %w", err)
+	}
+	if p.Repository.FullName == "" || p.Issue.ID == 0 {
+		return nil, fmt.Errorf("Bitbucket payload has no issue or repository")
+	}
+
+	cfg := config.GetConfig().Providers.Bitbucket
+	ev := &ProviderIssueEvent{
+		DeliveryID: deliveryID,
+		RepoName:   p.Repository.FullName,
+		CloneURL:   fmt.Sprintf("%s/%s.git", strings.TrimRight(cfg.WebURL, "/"), p.Repository.FullName),
+		Number:     p.Issue.ID,
+		Title:      p.Issue.Title,
+		Body:       p.Issue.Content.Raw,
+		Sender:     p.Actor.Nickname,
+		UpdatedAt:  p.Issue.UpdatedOn,
+	}
+	if p.Issue.Component != nil {
+		ev.Labels = []string{p.Issue.Component.Name}
+	}
+	switch {
+	case eventKey == "issue:created":
+		ev.AddedLabels = ev.Labels
+	case p.Changes.Component != nil && p.Changes.Component.New != nil:
+		ev.AddedLabels = []string{p.Changes.Component.New.Name}
+	}
+	return ev, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	"log/slog"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// Reaction contents accepted by the GitHub reactions API
+const (
+	ReactionEyes     = "eyes"
+	ReactionRocket   = "rocket"
+	ReactionConfused = "confused"
+	ReactionPlusOne  = "+1"
+)
+
+// AddIssueReaction reacts to an issue (or pull request) body
+func AddIssueReaction(ctx *probot.Context, repoName string, issueNumber int, content string) error {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
+
+	if err := NewGitHubClient(ctx).CreateIssueReaction(context.Background(), owner, repo, issueNumber, content); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to add issue reaction", "issueNumber", issueNumber, "reaction", content, "error", err)
+		return err
+	}
+	return nil
+}
+
+// AddIssueCommentReaction reacts to a comment on an issue or pull request
+func AddIssueCommentReaction(ctx *probot.Context, repoName string, commentID int64, content string) error {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
+
+	if err := NewGitHubClient(ctx).CreateCommentReaction(context.Background(), owner, repo, commentID, content); err != nil {
+		slog.WarnContext(logging.For(ctx), "Failed to add comment reaction", "commentID", commentID, "reaction", content, "error", err)
+		return err
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/fs"
 	"log"
@@ -11,6 +13,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"devflow-agent/packages/config"
 )
 
 type FileInfo struct {
@@ -27,7 +31,11 @@ type RepoAnalyzer struct {
 	LocalPath         string
 	OutputFile        string
 	Files             []FileInfo
+	Submodules        []SubmoduleInfo
+	Symlinks          []SymlinkInfo
 	gitignorePatterns []string
+	declared          map[string]string // submodule path -> URL, from .gitmodules
+	depth             int               // submodule nesting level of this analyzer
 }
 
 func (r *RepoAnalyzer) Generate() error {
@@ -74,6 +82,7 @@ func (r *RepoAnalyzer) cloneRepo() error {
 
 func (r *RepoAnalyzer) analyzeFiles() error {
 	r.parseGitignore()
+	r.declared = parseGitmodules(r.LocalPath)
 
 	gitChanges, err := r.getGitChangeCounts()
 	if err != nil {
@@ -86,10 +95,20 @@ func (r *RepoAnalyzer) analyzeFiles() error {
 			return err
 		}
 
+		// Links are recorded, never followed: they can loop or point outside the repository
+		if d.Type()&fs.ModeSymlink != 0 {
+			r.recordSymlink(path)
+			return nil
+		}
+
 		if d.IsDir() {
 			if r.shouldIgnoreDirectory(path, d.Name()) {
 				return fs.SkipDir
 			}
+			if path != r.LocalPath && r.isNestedRepo(path) {
+				r.analyzeNestedRepo(path)
+				return fs.SkipDir
+			}
 			return nil
 		}
 
@@ -131,10 +150,17 @@ func (r *RepoAnalyzer) analyzeFiles() error {
 		return err
 	}
 
-	// Sort by Git change count (files with MORE changes at the BOTTOM - repomix behavior)
-	sort.Slice(r.Files, func(i, j int) bool {
-		return r.Files[i].GitChanges < r.Files[j].GitChanges
-	})
+	if config.GetConfig().KnowledgeBase.Deterministic {
+		// Change counts grow with every commit, so order by path for a stable document
+		sort.Slice(r.Files, func(i, j int) bool {
+			return r.Files[i].RelativePath < r.Files[j].RelativePath
+		})
+	} else {
+		// Sort by Git change count (files with MORE changes at the BOTTOM - repomix behavior)
+		sort.SliceStable(r.Files, func(i, j int) bool {
+			return r.Files[i].GitChanges < r.Files[j].GitChanges
+		})
+	}
 
 	fmt.Printf("Found %d files after filtering\n", len(r.Files))
 	return nil
@@ -163,6 +189,11 @@ func (r *RepoAnalyzer) shouldIgnoreDirectory(path, name string) bool {
 	// Normalize path separators
 	relPath = strings.ReplaceAll(relPath, "\\", "/")
 
+	// The knowledge base is output, not input: packing it would feed each build the last one
+	if relPath == config.GetConfig().Repository.DevflowDirectory {
+		return true
+	}
+
 	// Debug logging to see what's being checked
 	// fmt.Printf("DEBUG: Checking directory: %s (name: %s)\n", relPath, name)
 
@@ -339,6 +370,7 @@ func (r *RepoAnalyzer) generateMarkdown() error {
 
 	r.writeHeader(writer)
 	r.writeDirectoryStructure(writer)
+	r.writeLinks(writer)
 	r.writeFileContents(writer)
 
 	return nil
@@ -347,6 +379,13 @@ func (r *RepoAnalyzer) generateMarkdown() error {
 func (r *RepoAnalyzer) writeHeader(writer *bufio.Writer) {
 	repoName := filepath.Base(strings.TrimSuffix(r.RepoURL, ".git"))
 
+	ordering := "Files are sorted by Git change count (files with more changes are at the bottom)"
+	stamp := "**Generated:** " + time.Now().Format("2006-01-02 15:04:05")
+	if config.GetConfig().KnowledgeBase.Deterministic {
+		ordering = "Files are sorted by path"
+		stamp = "**Content hash:** " + r.contentHash()
+	}
+
 	header := fmt.Sprintf(`This file is a merged representation of the entire codebase, combined into a single document.
 The content has been processed for AI analysis and code review purposes.
 
@@ -365,7 +404,8 @@ The content is organized as follows:
 4. Repository files (if enabled)
 5. Multiple file entries, each consisting of:
   a. A header with the file path (## File: path/to/file)
-  b. The full contents of the file in a code block
+  b. The full contents of the file in a code block, or for large files excerpts from its
+     start and end around a truncation marker, followed by an outline of its declarations
 
 ## Usage Guidelines
 - This file should be treated as read-only. Any changes should be made to the
@@ -380,19 +420,42 @@ The content is organized as follows:
 - Binary files are not included in this packed representation. Please refer to the Repository Structure section for a complete list of file paths, including binary files
 - Files matching patterns in .gitignore are excluded
 - Files matching default ignore patterns are excluded
-- Files are sorted by Git change count (files with more changes are at the bottom)
+- Symbolic links are listed with their targets and not followed
+- Git submodules and nested repositories are listed; their files are included only when they are analyzed
+- %s
 
 # Repository Information
 - **Repository URL:** %s
 - **Repository Name:** %s
 - **Total Files Analyzed:** %d
-- **Generated:** %s
+- %s
 
-`, r.RepoURL, repoName, len(r.Files), time.Now().Format("2006-01-02 15:04:05"))
+`, ordering, r.RepoURL, repoName, len(r.Files), stamp)
 
 	writer.WriteString(header)
 }
 
+// contentHash is a sha256 over the analyzed files' paths and contents, which identifies the
+// document's content without a timestamp
+func (r *RepoAnalyzer) contentHash() string {
+	files := make([]FileInfo, len(r.Files))
+	copy(files, r.Files)
+	sort.Slice(files, func(i, j int) bool { return files[i].RelativePath < files[j].RelativePath })
+
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(f.RelativePath), len(f.Content))
+		h.Write(f.Content)
+	}
+	for _, s := range r.Submodules {
+		fmt.Fprintf(h, "submodule\x00%s\x00%s\x00%s\x00", s.Path, s.URL, s.Status)
+	}
+	for _, l := range r.Symlinks {
+		fmt.Fprintf(h, "symlink\x00%s\x00%s\x00", l.Path, l.Target)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func (r *RepoAnalyzer) writeDirectoryStructure(writer *bufio.Writer) {
 	writer.WriteString("# Directory Structure\n```\n")
 
@@ -438,6 +501,13 @@ func (r *RepoAnalyzer) writeDirectoryStructure(writer *bufio.Writer) {
 		if d.IsDir() && r.shouldIgnoreDirectory(path, d.Name()) {
 			return fs.SkipDir
 		}
+		// Nested repositories show the files analyzed in them, which are already listed
+		if d.IsDir() && r.isNestedRepo(path) {
+			if _, exists := allPaths[relPath]; !exists {
+				allPaths[relPath] = false
+			}
+			return fs.SkipDir
+		}
 
 		// Add to paths if not already present
 		if _, exists := allPaths[relPath]; !exists {
@@ -473,6 +543,12 @@ func (r *RepoAnalyzer) writeDirectoryStructure(writer *bufio.Writer) {
 
 func (r *RepoAnalyzer) writeFileContents(writer *bufio.Writer) {
 	writer.WriteString("# Files\n\n")
+	kb := config.GetConfig().KnowledgeBase
+	rels := make([]string, len(r.Files))
+	for i, file := range r.Files {
+		rels[i] = strings.ReplaceAll(file.RelativePath, "\\", "/")
+	}
+	generated := FindGeneratedFiles(r.LocalPath, rels)
 
 	for i, file := range r.Files {
 		fmt.Printf("File %d/%d: %s (changes: %d)\n", i+1, len(r.Files), file.RelativePath, file.GitChanges)
@@ -481,6 +557,14 @@ func (r *RepoAnalyzer) writeFileContents(writer *bufio.Writer) {
 		normalizedPath := strings.ReplaceAll(file.RelativePath, "\\", "/")
 
 		writer.WriteString(fmt.Sprintf("## File: %s\n", normalizedPath))
+		if g, ok := generated[normalizedPath]; ok {
+			writeGeneratedFileNote(writer, g)
+			continue
+		}
+		if isLargeFile(file, kb) {
+			writeLargeFileExcerpt(writer, file, normalizedPath, kb)
+			continue
+		}
 		writer.WriteString(fmt.Sprintf("````%s\n", file.Language))
 		writer.WriteString(string(file.Content))
 
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// FetchRepoConfig reads per-repo settings from the default branch on GitHub, for decisions
+// made before (or without) a clone. A missing file yields the defaults.
+func FetchRepoConfig(ctx *probot.Context, repoName string) (*config.RepoConfig, error) {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := NewGitHubClient(ctx).GetFileContent(context.Background(), owner, repo, config.RepoConfigFile)
+	if err != nil && !errors.Is(err, githubapi.ErrNotFound) {
+		return nil, err
+	}
+	return config.ParseRepoConfig(data)
+}
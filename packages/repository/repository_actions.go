@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -12,24 +14,45 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/go-github/github"
 	"github.com/swinton/go-probot/probot"
 )
 
-func CloneRepository(repoName string) (string, string, error) {
+func CloneRepository(runCtx context.Context, repoName string) (string, string, error) {
 	cfg := config.GetConfig()
-	cloneURL := fmt.Sprintf("https://github.com/%s.git", repoName)
-	repoDir := fmt.Sprintf("%s%s_%d", cfg.Repository.TempRepoPrefix, strings.Replace(repoName, "/", "_", -1), time.Now().Unix())
-
-	slog.Info("Cloning", "repo", repoName)
+	cloneCtx, cancel := config.StageContext(runCtx, cfg.Timeouts.CloneSeconds)
+	defer cancel()
+	cloneURL := CloneURL(repoName)
+	repoDir := filepath.Join(cfg.Repository.WorkspaceDir, fmt.Sprintf("%s%s_%d", cfg.Repository.TempRepoPrefix, strings.Replace(repoName, "/", "_", -1), time.Now().UnixNano()))
+
+	slog.InfoContext(runCtx, "Cloning", "repo", repoName)
+	if cfg.Repository.WorkspaceDir != "" {
+		if err := os.MkdirAll(cfg.Repository.WorkspaceDir, 0755); err != nil {
+			return "", "", &CloneError{RepoName: repoName, Err: fmt.Errorf("failed to create workspace: %w", err)}
+		}
+	}
 
-	cmd := exec.Command("git", "clone", fmt.Sprintf("--depth=%d", cfg.Repository.CloneDepth), cloneURL, repoDir)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		slog.Error("Clone Failed", "error", err, "stdout", string(out))
-		return "", "", err
+	// Prefer a cheap worktree off the cached mirror; fall back to a fresh shallow clone
+	cloned := false
+	if cfg.Repository.MirrorCacheDir != "" {
+		if err := createWorktreeFromMirror(cloneCtx, cfg.Repository.MirrorCacheDir, repoName, cloneURL, repoDir, cfg.Repository.DefaultBranch); err != nil {
+			slog.WarnContext(runCtx, "Mirror checkout failed, falling back to clone", "repo", repoName, "error", err)
+			_ = os.RemoveAll(repoDir)
+		} else {
+			cloned = true
+		}
+	}
+	if !cloned {
+		cmd := exec.CommandContext(cloneCtx, "git", "clone", fmt.Sprintf("--depth=%d", cfg.Repository.CloneDepth), cloneURL, repoDir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			slog.ErrorContext(runCtx, "Clone Failed", "error", err, "stdout", string(out))
+			if cloneCtx.Err() != nil {
+				return "", "", &CloneError{RepoName: repoName, Err: fmt.Errorf("clone timed out: %w", cloneCtx.Err())}
+			}
+			return "", "", &CloneError{RepoName: repoName, Err: fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))}
+		}
 	}
 
-	slog.Info("Repository cloned to", "repoDir", repoDir)
+	slog.InfoContext(runCtx, "Repository cloned to", "repoDir", repoDir)
 
 	// --- EOL normalization WITHOUT touching tracked files (.gitattributes) ---
 
@@ -37,7 +60,7 @@ func CloneRepository(repoName string) (string, string, error) {
 	_ = exec.Command("git", "-C", repoDir, "config", "--local", "core.autocrlf", "false").Run()
 
 	// 2) Install repo-local (UNTRACKED) attributes: .git/info/attributes
-	infoAttr := filepath.Join(repoDir, ".git", "info", "attributes")
+	infoAttr := gitPath(repoDir, "info/attributes")
 	if err := os.MkdirAll(filepath.Dir(infoAttr), 0755); err == nil {
 		attrContent := `* text=auto
 *.py text eol=lf
@@ -46,16 +69,16 @@ func CloneRepository(repoName string) (string, string, error) {
 *.cmd text eol=crlf
 `
 		if err := os.WriteFile(infoAttr, []byte(attrContent), 0644); err != nil {
-			slog.Warn("Failed to write .git/info/attributes", "error", err)
+			slog.WarnContext(runCtx, "Failed to write .git/info/attributes", "error", err)
 		} else {
-			slog.Info("[RepoSetup] Installed untracked attributes", "path", infoAttr)
+			slog.InfoContext(runCtx, "[RepoSetup] Installed untracked attributes", "path", infoAttr)
 		}
 	} else {
-		slog.Warn("Failed to create .git/info directory", "error", err)
+		slog.WarnContext(runCtx, "Failed to create .git/info directory", "error", err)
 	}
 
 	// 3) Ignore agent artifacts locally (no tracked changes in PRs)
-	excludePath := filepath.Join(repoDir, ".git", "info", "exclude")
+	excludePath := gitPath(repoDir, "info/exclude")
 	if err := os.MkdirAll(filepath.Dir(excludePath), 0755); err == nil {
 		_ = appendUniqueLines(excludePath, []string{
 			"/.devflow/",
@@ -67,9 +90,9 @@ func CloneRepository(repoName string) (string, string, error) {
 
 	// 4) Renormalize working tree per the (untracked) attributes — no commit needed
 	if out, err := exec.Command("git", "-C", repoDir, "add", "--renormalize", ".").CombinedOutput(); err != nil {
-		slog.Warn("Renormalize failed", "error", err, "stdout", string(out))
+		slog.WarnContext(runCtx, "Renormalize failed", "error", err, "stdout", string(out))
 	} else {
-		slog.Info("Renormalized line endings according to .git/info/attributes")
+		slog.InfoContext(runCtx, "Renormalized line endings according to .git/info/attributes")
 	}
 
 	return repoDir, cloneURL, nil
@@ -107,7 +130,7 @@ func AnalyzeRepo(ctx *probot.Context, outputFile, LocalPath, repoURL string) err
 	}
 
 	if err := analyzer.Generate(); err != nil {
-		slog.Error("Failed to generate analysis", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to generate analysis", "error", err)
 		return err
 	}
 
@@ -116,76 +139,115 @@ func AnalyzeRepo(ctx *probot.Context, outputFile, LocalPath, repoURL string) err
 }
 
 func CommitFile(ctx *probot.Context, repoName, branchName, commitMessage, filePath string) error {
-	parts := strings.Split(repoName, "/")
-	owner := parts[0]
-	repo := parts[1]
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
 
 	fileName := filepath.Base(filePath)
 
 	// Read the analysis file content
 	content, err := os.ReadFile(filePath)
 	if err != nil {
-		slog.Error("Failed to read the file", "File Path", filePath, "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to read the file", "File Path", filePath, "error", err)
 		return err
 	}
 
-	// Create file content for GitHub API
-	fileContent := &github.RepositoryContentFileOptions{
-		Message: github.String(commitMessage),
-		Content: content,
-		Branch:  github.String(branchName),
-	}
-
 	// Commit the file to the branch
-	_, _, err = ctx.GitHub.Repositories.CreateFile(
+	err = NewGitHubClient(ctx).CreateFile(
 		context.Background(),
 		owner,
 		repo,
 		fileName, // File path in repo
-		fileContent,
+		commitMessage,
+		branchName,
+		content,
 	)
 
 	if err != nil {
-		slog.Error("Failed to commit analysis file", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to commit analysis file", "error", err)
 		return err
 	}
 
-	slog.Info("Analysis file committed to branch", "branch", branchName, "file", fileName)
+	slog.InfoContext(logging.For(ctx), "Analysis file committed to branch", "branch", branchName, "file", fileName)
 	return nil
 }
 
 func CommitMultipleFiles(ctx *probot.Context, repoName, branchName, commitMessage string, filePaths []string, init bool, repoPath string) error {
-	parts := strings.Split(repoName, "/")
-	if len(parts) != 2 {
-		slog.Error("Invalid repository name format", "repoName", repoName)
-		return errors.New("invalid repository name format, expected 'owner/repo'")
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		slog.ErrorContext(logging.For(ctx), "Invalid repository name format", "repoName", repoName)
+		return err
 	}
-	owner := parts[0]
-	repo := parts[1]
+	client := NewGitHubClient(ctx)
+
+	slog.InfoContext(logging.For(ctx), "Committing multiple files to branch", "branch", branchName, "fileCount", len(filePaths))
 
-	slog.Info("Committing multiple files to branch", "branch", branchName, "fileCount", len(filePaths))
+	// The whole push (blobs, tree, commit, ref update) shares one stage deadline
+	apiCtx, cancel := config.StageContext(context.Background(), config.GetConfig().Timeouts.PushSeconds)
+	defer cancel()
+
+	// Enforce the repository's path policy on agent-authored changes
+	if !init && repoPath != "" {
+		repoCfg, err := config.LoadRepoConfig(repoPath)
+		if err != nil {
+			return err
+		}
+		var violations []PathViolation
+		for _, filePath := range filePaths {
+			rel, err := filepath.Rel(repoPath, filePath)
+			if err != nil {
+				return fmt.Errorf("failed to calculate relative path for %s using root %s: %w", filePath, repoPath, err)
+			}
+			if reason := CheckPathPolicy(repoCfg.Paths, filepath.ToSlash(rel)); reason != "" {
+				violations = append(violations, PathViolation{Path: filepath.ToSlash(rel), Reason: reason})
+			}
+		}
+		if len(violations) > 0 {
+			slog.ErrorContext(logging.For(ctx), "Refusing to commit files forbidden by path policy", "violations", len(violations))
+			return &PolicyViolationError{Violations: violations}
+		}
+		rels := make([]string, 0, len(filePaths))
+		for _, filePath := range filePaths {
+			if rel, err := filepath.Rel(repoPath, filePath); err == nil {
+				rels = append(rels, filepath.ToSlash(rel))
+			}
+		}
+		if repoCfg.LicenseHeaders.Required {
+			if missing := MissingLicenseHeaders(repoPath, repoCfg.LicenseHeaders, rels); len(missing) > 0 {
+				slog.ErrorContext(logging.For(ctx), "Refusing to commit new files without the required license header", "files", missing)
+				return &LicenseHeaderError{Files: missing}
+			}
+		}
+		if config.GetConfig().Repository.NormalizeLineEndings {
+			NormalizeLineEndings(repoPath, rels)
+		}
+	}
 
 	// ✅ Use "heads/<branch>" (NOT "refs/heads/<branch>")
-	ref, _, err := ctx.GitHub.Git.GetRef(context.Background(), owner, repo, "heads/"+branchName)
+	ref, err := client.GetRef(apiCtx, owner, repo, "heads/"+branchName)
 	if err != nil {
-		slog.Error("Failed to get branch reference", "error", err, "branch", branchName)
+		slog.ErrorContext(logging.For(ctx), "Failed to get branch reference", "error", err, "branch", branchName)
 		return err
 	}
 
 	// Get the tree SHA from the current commit
-	commit, _, err := ctx.GitHub.Git.GetCommit(context.Background(), owner, repo, ref.Object.GetSHA())
+	commit, err := client.GetCommit(apiCtx, owner, repo, ref.SHA)
 	if err != nil {
-		slog.Error("Failed to get commit", "error", err, "sha", ref.Object.GetSHA())
+		slog.ErrorContext(logging.For(ctx), "Failed to get commit", "error", err, "sha", ref.SHA)
 		return err
 	}
 
 	// Create tree entries for all files
-	var entries []*github.TreeEntry
+	var entries []githubapi.TreeEntry
 	for _, filePath := range filePaths {
-		// Read file content from the local repo checkout
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			slog.Error("Failed to read file locally", "file", filePath, "error", err)
+		// Read file content and mode from the local repo checkout; a file gone from it is
+		// deleted, which with its new path commits a rename
+		content, mode, err := ReadTreeFile(filePath)
+		if errors.Is(err, os.ErrNotExist) && !init {
+			mode = ""
+		} else if err != nil {
+			slog.ErrorContext(logging.For(ctx), "Failed to read file locally", "file", filePath, "error", err)
 			return err
 		}
 
@@ -210,99 +272,144 @@ func CommitMultipleFiles(ctx *probot.Context, repoName, branchName, commitMessag
 			return fmt.Errorf("refusing to commit path outside repo: %s", repoFilePath)
 		}
 
-		contentStr := string(content)
+		if mode == "" {
+			entries = append(entries, githubapi.TreeEntry{Path: repoFilePath, Delete: true})
+			continue
+		}
 
 		// Create blob
-		blob := &github.Blob{
-			Content:  &contentStr,
-			Encoding: github.String("utf-8"),
-		}
-		createdBlob, _, err := ctx.GitHub.Git.CreateBlob(context.Background(), owner, repo, blob)
+		blobSHA, err := client.CreateBlob(apiCtx, owner, repo, string(content))
 		if err != nil {
-			slog.Error("Failed to create blob for content", "repoPath", repoFilePath, "error", err)
+			slog.ErrorContext(logging.For(ctx), "Failed to create blob for content", "repoPath", repoFilePath, "error", err)
 			return err
 		}
 
 		// Create tree entry (path MUST be POSIX style)
-		entry := &github.TreeEntry{
-			Path: github.String(repoFilePath),
-			Mode: github.String("100644"),
-			Type: github.String("blob"),
-			SHA:  createdBlob.SHA,
-		}
-		entries = append(entries, entry)
+		entries = append(entries, githubapi.TreeEntry{
+			Path: repoFilePath,
+			Mode: mode,
+			Type: "blob",
+			SHA:  blobSHA,
+		})
 	}
 
 	// Create new tree against current base tree
-	treeEntries := make([]github.TreeEntry, len(entries))
-	for i, entry := range entries {
-		treeEntries[i] = *entry
-	}
-	newTree, _, err := ctx.GitHub.Git.CreateTree(context.Background(), owner, repo, commit.Tree.GetSHA(), treeEntries)
+	newTreeSHA, err := client.CreateTree(apiCtx, owner, repo, commit.TreeSHA, entries)
 	if err != nil {
-		slog.Error("Failed to create tree", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to create tree", "error", err)
 		return err
 	}
 
 	// Create new commit
-	newCommit := &github.Commit{
-		Message: github.String(commitMessage),
-		Tree:    newTree,
-		Parents: []github.Commit{*commit},
-	}
-	createdCommit, _, err := ctx.GitHub.Git.CreateCommit(context.Background(), owner, repo, newCommit)
+	createdCommit, err := client.CreateCommit(apiCtx, owner, repo, commitMessage, newTreeSHA, []string{commit.SHA})
 	if err != nil {
-		slog.Error("Failed to create commit", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to create commit", "error", err)
 		return err
 	}
 
 	// Move branch to the new commit
-	ref.Object.SHA = createdCommit.SHA
-	_, _, err = ctx.GitHub.Git.UpdateRef(context.Background(), owner, repo, ref, false)
+	err = client.UpdateRef(apiCtx, owner, repo, ref.Ref, createdCommit.SHA, false)
 	if err != nil {
-		slog.Error("Failed to update branch reference", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Failed to update branch reference", "error", err)
 		return err
 	}
 
-	slog.Info("Successfully committed multiple files",
-		"branch", branchName, "fileCount", len(filePaths), "commit", createdCommit.GetSHA())
+	slog.InfoContext(logging.For(ctx), "Successfully committed multiple files",
+		"branch", branchName, "fileCount", len(filePaths), "commit", createdCommit.SHA)
 	return nil
 }
 
-// CreatePullRequest creates a pull request from the specified branch to the default branch
-func CreatePullRequest(ctx *probot.Context, repoName, branchName, title, body string) (*github.PullRequest, error) {
-	cfg := config.GetConfig()
-	parts := strings.Split(repoName, "/")
-	owner := parts[0]
-	repo := parts[1]
+// ReadTreeFile reads a file of a checkout as a tree entry's blob and mode: a symlink is its
+// target and keeps the symlink mode, and an executable file keeps its executable bit
+func ReadTreeFile(path string) ([]byte, string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		return []byte(filepath.ToSlash(target)), githubapi.ModeSymlink, err
+	}
+	content, err := os.ReadFile(path)
+	if info.Mode().Perm()&0o111 != 0 {
+		return content, githubapi.ModeExecutable, err
+	}
+	return content, githubapi.ModeFile, err
+}
 
-	slog.Info("Creating pull request", "repo", repoName, "branch", branchName, "title", title)
+// PostIssueComment posts a comment on an issue or pull request
+func PostIssueComment(ctx *probot.Context, repoName string, issueNumber int, body string) error {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
 
-	// Create the pull request
-	newPR := &github.NewPullRequest{
-		Title:               github.String(title),
-		Head:                github.String(branchName),
-		Base:                github.String(cfg.Repository.DefaultBranch),
-		Body:                github.String(body),
-		MaintainerCanModify: github.Bool(true),
+	if _, err := NewGitHubClient(ctx).CreateIssueComment(context.Background(), owner, repo, issueNumber, body); err != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to post issue comment", "issueNumber", issueNumber, "error", err)
+		return err
+	}
+	return nil
+}
+
+// CreateIssueComment posts a comment like PostIssueComment and returns its ID, for comments
+// that are edited as the run progresses
+func CreateIssueComment(ctx *probot.Context, repoName string, issueNumber int, body string) (int64, error) {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return 0, err
 	}
+	comment, err := NewGitHubClient(ctx).CreateIssueComment(context.Background(), owner, repo, issueNumber, body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to post comment on issue #%d: %w", issueNumber, err)
+	}
+	return comment.ID, nil
+}
 
-	pr, _, err := ctx.GitHub.PullRequests.Create(context.Background(), owner, repo, newPR)
+// EditIssueComment replaces the body of a comment
+func EditIssueComment(ctx *probot.Context, repoName string, commentID int64, body string) error {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
+	if err := NewGitHubClient(ctx).EditIssueComment(context.Background(), owner, repo, commentID, body); err != nil {
+		return fmt.Errorf("failed to edit comment %d: %w", commentID, err)
+	}
+	return nil
+}
+
+// CreatePullRequest creates a pull request from the specified branch to the default branch
+func CreatePullRequest(ctx *probot.Context, repoName, branchName, title, body string) (*githubapi.PullRequest, error) {
+	cfg := config.GetConfig()
+	owner, repo, err := githubapi.SplitRepoName(repoName)
 	if err != nil {
-		slog.Error("Failed to create pull request", "error", err)
 		return nil, err
 	}
 
-	slog.Info("Pull request created successfully",
-		"prNumber", pr.GetNumber(),
-		"prURL", pr.GetHTMLURL(),
+	slog.InfoContext(logging.For(ctx), "Creating pull request", "repo", repoName, "branch", branchName, "title", title)
+
+	// Create the pull request
+	pr, err := NewGitHubClient(ctx).CreatePullRequest(context.Background(), owner, repo, githubapi.NewPullRequest{
+		Title:               title,
+		Head:                branchName,
+		Base:                cfg.Repository.DefaultBranch,
+		Body:                body,
+		MaintainerCanModify: true,
+	})
+	if err != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to create pull request", "error", err)
+		return nil, &PRError{Branch: branchName, Err: err}
+	}
+
+	slog.InfoContext(logging.For(ctx), "Pull request created successfully",
+		"prNumber", pr.Number,
+		"prURL", pr.HTMLURL,
 		"branch", branchName)
 
 	return pr, nil
 }
 
 // CreateInstallationPR creates a PR for the installation workflow
-func CreateInstallationPR(ctx *probot.Context, repoName, branchName string) (*github.PullRequest, error) {
+func CreateInstallationPR(ctx *probot.Context, repoName, branchName string) (*githubapi.PullRequest, error) {
 	cfg := config.GetConfig()
 
 	// Read title from file
@@ -322,8 +429,9 @@ func CreateInstallationPR(ctx *probot.Context, repoName, branchName string) (*gi
 	return CreatePullRequest(ctx, repoName, branchName, title, body)
 }
 
-// CreateIssueResolutionPR creates a PR for issue resolution workflow
-func CreateIssueResolutionPR(ctx *probot.Context, repoName, branchName string, issueNumber int, issueTitle, changesSummary, implementationDetails, testingNotes string) (*github.PullRequest, error) {
+// CreateIssueResolutionPR creates a PR for issue resolution workflow.
+// issueLinks ("Closes #N" or "Refs #N" lines) replaces {issue_links}.
+func CreateIssueResolutionPR(ctx *probot.Context, repoName, branchName string, issueNumber int, issueTitle, issueLinks, changesSummary, implementationDetails, testingNotes string) (*githubapi.PullRequest, error) {
 	cfg := config.GetConfig()
 
 	// Read title template from file
@@ -347,6 +455,7 @@ func CreateIssueResolutionPR(ctx *probot.Context, repoName, branchName string, i
 	// Replace template variables in body
 	body = strings.ReplaceAll(body, "{issue_number}", fmt.Sprintf("%d", issueNumber))
 	body = strings.ReplaceAll(body, "{issue_title}", issueTitle)
+	body = strings.ReplaceAll(body, "{issue_links}", issueLinks)
 	body = strings.ReplaceAll(body, "{changes_summary}", changesSummary)
 	body = strings.ReplaceAll(body, "{implementation_details}", implementationDetails)
 	body = strings.ReplaceAll(body, "{testing_notes}", testingNotes)
@@ -355,35 +464,48 @@ func CreateIssueResolutionPR(ctx *probot.Context, repoName, branchName string, i
 }
 
 // CreateIssueResolutionPRSimple creates a PR for issue resolution with minimal info (for current workflow)
-func CreateIssueResolutionPRSimple(ctx *probot.Context, repoName, branchName string, issueNumber int, issueTitle string) (*github.PullRequest, error) {
+func CreateIssueResolutionPRSimple(ctx *probot.Context, repoName, branchName string, issueNumber int, issueTitle string) (*githubapi.PullRequest, error) {
 	changesSummary := "Knowledge base initialization and analysis files"
 	implementationDetails := "Generated comprehensive repository analysis and knowledge base files"
 	testingNotes := "Auto-generated files - no manual testing required"
 
-	return CreateIssueResolutionPR(ctx, repoName, branchName, issueNumber, issueTitle, changesSummary, implementationDetails, testingNotes)
+	return CreateIssueResolutionPR(ctx, repoName, branchName, issueNumber, issueTitle, fmt.Sprintf("Closes #%d", issueNumber), changesSummary, implementationDetails, testingNotes)
 }
 
 func TestProbotAuth(ctx *probot.Context, repoName string) {
-	parts := strings.Split(repoName, "/")
-	owner := parts[0]
-	repo := parts[1]
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		slog.ErrorContext(logging.For(ctx), "Auth Test Failed", "error", err)
+		return
+	}
 
-	slog.Info("Testing probot authentication.")
+	slog.InfoContext(logging.For(ctx), "Testing probot authentication.")
 
 	// Try a simple API call
-	repository, _, err := ctx.GitHub.Repositories.Get(context.Background(), owner, repo)
+	repository, err := NewGitHubClient(ctx).GetRepository(context.Background(), owner, repo)
 	if err != nil {
-		slog.Error("Auth Test Failed", "error", err)
+		slog.ErrorContext(logging.For(ctx), "Auth Test Failed", "error", err)
 		return
 	}
 
-	slog.Info("Auth test passed! Repo: %s, Default branch: %s",
-		repository.GetFullName(), repository.GetDefaultBranch())
+	slog.InfoContext(logging.For(ctx), "Auth test passed! Repo: %s, Default branch: %s",
+		repository.FullName, repository.DefaultBranch)
 }
 
 func CleanupRepo(repoDir string) error {
+	// Worktrees of a cached mirror must also be unregistered from the mirror
+	commonDir := ""
+	if info, err := os.Lstat(filepath.Join(repoDir, ".git")); err == nil && !info.IsDir() {
+		if out, err := git(repoDir, "rev-parse", "--path-format=absolute", "--git-common-dir"); err == nil {
+			commonDir = strings.TrimSpace(out)
+		}
+	}
+
 	err := os.RemoveAll(repoDir)
 	if err == nil {
+		if commonDir != "" {
+			_, _ = git(commonDir, "worktree", "prune")
+		}
 		slog.Info("Cleaned up", "repoDir", repoDir)
 		return nil
 	}
@@ -419,3 +541,17 @@ func ensureCommitAvailable(repoPath, sha string) error {
 	}
 	return fmt.Errorf("commit %s not available locally after fetch/unshallow", sha)
 }
+
+// UpdatePullRequestBody replaces the description of a pull request
+func UpdatePullRequestBody(ctx *probot.Context, repoName string, pr *githubapi.PullRequest, body string) error {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
+	if err := NewGitHubClient(ctx).EditPullRequestBody(context.Background(), owner, repo, pr.Number, body); err != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to update pull request body", "repo", repoName, "prNumber", pr.Number, "error", err)
+		return err
+	}
+	pr.Body = body
+	return nil
+}
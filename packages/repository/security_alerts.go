@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SecurityAdvisory is the part of a vulnerability alert needed to remediate it
+type SecurityAdvisory struct {
+	GHSAID          string
+	CVEID           string
+	Summary         string
+	Description     string
+	Severity        string
+	Ecosystem       string // Dependabot ecosystem name ("npm", "pip", "go", ...); empty when unknown
+	Package         string
+	Manifest        string // repository-relative manifest path; empty when unknown
+	VulnerableRange string
+	PatchedVersion  string // first patched version; empty when no fix is released
+	URL             string
+}
+
+// SecurityAlert is a parsed alert webhook together with where it came from
+type SecurityAlert struct {
+	RepoName       string
+	InstallationID int64
+	Advisory       SecurityAdvisory
+}
+
+type dependabotAlertPayload struct {
+	Action string `json:"action"`
+	Alert  struct {
+		HTMLURL    string `json:"html_url"`
+		Dependency struct {
+			Package struct {
+				Ecosystem string `json:"ecosystem"`
+				Name      string `json:"name"`
+			} `json:"package"`
+			ManifestPath string `json:"manifest_path"`
+		} `json:"dependency"`
+		SecurityAdvisory struct {
+			GHSAID      string `json:"ghsa_id"`
+			CVEID       string `json:"cve_id"`
+			Summary     string `json:"summary"`
+			Description string `json:"description"`
+			Severity    string `json:"severity"`
+		} `json:"security_advisory"`
+		SecurityVulnerability struct {
+			Severity               string `json:"severity"`
+			VulnerableVersionRange string `json:"vulnerable_version_range"`
+			FirstPatchedVersion    *struct {
+				Identifier string `json:"identifier"`
+			} `json:"first_patched_version"`
+		} `json:"security_vulnerability"`
+	} `json:"alert"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Installation struct {
+		ID int64 `json:"id"`
+	} `json:"installation"`
+}
+
+type vulnerabilityAlertPayload struct {
+	Action string `json:"action"`
+	Alert  struct {
+		AffectedPackageName string `json:"affected_package_name"`
+		AffectedRange       string `json:"affected_range"`
+		FixedIn             string `json:"fixed_in"`
+		ExternalIdentifier  string `json:"external_identifier"`
+		ExternalReference   string `json:"external_reference"`
+		GHSAID              string `json:"ghsa_id"`
+		Severity            string `json:"severity"`
+	} `json:"alert"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Installation struct {
+		ID int64 `json:"id"`
+	} `json:"installation"`
+}
+
+// ParseSecurityAlert parses a dependabot_alert or repository_vulnerability_alert webhook.
+// It returns nil without error for actions that do not call for a fix (dismissed, fixed, ...).
+func ParseSecurityAlert(eventType string, payload []byte) (*SecurityAlert, error) {
+	switch eventType {
+	case "dependabot_alert":
+		var p dependabotAlertPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return nil, fmt.Errorf("failed to parse dependabot_alert payload: %w", err)
+		}
+		if p.Action != "created" && p.Action != "reopened" {
+			return nil, nil
+		}
+		a := p.Alert
+		adv := SecurityAdvisory{
+			GHSAID:          a.SecurityAdvisory.GHSAID,
+			CVEID:           a.SecurityAdvisory.CVEID,
+			Summary:         a.SecurityAdvisory.Summary,
+			Description:     a.SecurityAdvisory.Description,
+			Severity:        a.SecurityVulnerability.Severity,
+			Ecosystem:       a.Dependency.Package.Ecosystem,
+			Package:         a.Dependency.Package.Name,
+			Manifest:        a.Dependency.ManifestPath,
+			VulnerableRange: a.SecurityVulnerability.VulnerableVersionRange,
+			URL:             a.HTMLURL,
+		}
+		if adv.Severity == "" {
+			adv.Severity = a.SecurityAdvisory.Severity
+		}
+		if a.SecurityVulnerability.FirstPatchedVersion != nil {
+			adv.PatchedVersion = a.SecurityVulnerability.FirstPatchedVersion.Identifier
+		}
+		return &SecurityAlert{RepoName: p.Repository.FullName, InstallationID: p.Installation.ID, Advisory: adv}, nil
+
+	case "repository_vulnerability_alert":
+		var p vulnerabilityAlertPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return nil, fmt.Errorf("failed to parse repository_vulnerability_alert payload: %w", err)
+		}
+		if p.Action != "create" {
+			return nil, nil
+		}
+		a := p.Alert
+		adv := SecurityAdvisory{
+			GHSAID:          a.GHSAID,
+			Severity:        a.Severity,
+			Package:         a.AffectedPackageName,
+			VulnerableRange: a.AffectedRange,
+			PatchedVersion:  a.FixedIn,
+			URL:             a.ExternalReference,
+		}
+		if strings.HasPrefix(a.ExternalIdentifier, "CVE-") {
+			adv.CVEID = a.ExternalIdentifier
+		}
+		return &SecurityAlert{RepoName: p.Repository.FullName, InstallationID: p.Installation.ID, Advisory: adv}, nil
+	}
+	return nil, fmt.Errorf("unsupported security alert event %q", eventType)
+}
+
+// ID returns the most specific identifier of the advisory
+func (a SecurityAdvisory) ID() string {
+	switch {
+	case a.GHSAID != "":
+		return a.GHSAID
+	case a.CVEID != "":
+		return a.CVEID
+	}
+	return a.Package
+}
+
+// Markdown renders the advisory details for a PR body or agent prompt
+func (a SecurityAdvisory) Markdown() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("### Security advisory %s\n\n", a.ID()))
+	if a.Summary != "" {
+		b.WriteString(a.Summary + "\n\n")
+	}
+	b.WriteString(fmt.Sprintf("- **Severity:** %s\n", strings.ToUpper(orUnknown(a.Severity))))
+	b.WriteString(fmt.Sprintf("- **Package:** `%s`", a.Package))
+	if a.Ecosystem != "" {
+		b.WriteString(fmt.Sprintf(" (%s)", a.Ecosystem))
+	}
+	b.WriteString("\n")
+	if a.Manifest != "" {
+		b.WriteString(fmt.Sprintf("- **Manifest:** `%s`\n", a.Manifest))
+	}
+	b.WriteString(fmt.Sprintf("- **Vulnerable versions:** `%s`\n", orUnknown(a.VulnerableRange)))
+	b.WriteString(fmt.Sprintf("- **First patched version:** `%s`\n", orUnknown(a.PatchedVersion)))
+	if a.GHSAID != "" && a.CVEID != "" {
+		b.WriteString(fmt.Sprintf("- **CVE:** %s\n", a.CVEID))
+	}
+	if a.URL != "" {
+		b.WriteString(fmt.Sprintf("- **Alert:** %s\n", a.URL))
+	}
+	if a.Description != "" {
+		b.WriteString("\n<details><summary>Advisory description</summary>\n\n" + a.Description + "\n</details>\n")
+	}
+	return b.String()
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// SmallFix is an agent change small enough to offer as a suggestion instead of a pull
+// request: one hunk in one existing file. Lines are 1-based and refer to the file before
+// the change.
+type SmallFix struct {
+	File        string
+	StartLine   int
+	EndLine     int
+	Original    []string // lines StartLine..EndLine before the change
+	Replacement []string // what the change puts in their place
+	Patch       string   // unified diff with context, for display
+}
+
+// hunkHeaderPattern matches "@@ -start[,count] +start[,count] @@"
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// DetectSmallFix reports whether the uncommitted changes to files in the clone are a single
+// hunk of at most maxLines added plus removed lines in one tracked file
+func DetectSmallFix(repoPath string, files []string, maxLines int) (*SmallFix, bool) {
+	if len(files) != 1 || maxLines <= 0 {
+		return nil, false
+	}
+	file := files[0]
+	if _, err := git(repoPath, "ls-files", "--error-unmatch", "--", file); err != nil {
+		return nil, false // new files need a pull request
+	}
+	diff, err := git(repoPath, "diff", "-U0", "--", file)
+	if err != nil || diff == "" {
+		return nil, false
+	}
+
+	var (
+		hunks              int
+		oldStart, oldCount int
+		removed, added     []string
+	)
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		if m := hunkHeaderPattern.FindStringSubmatch(line); m != nil {
+			hunks++
+			oldStart, _ = strconv.Atoi(m[1])
+			oldCount = 1
+			if m[2] != "" {
+				oldCount, _ = strconv.Atoi(m[2])
+			}
+			continue
+		}
+		if hunks == 0 || strings.HasPrefix(line, "\\") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "-"):
+			removed = append(removed, line[1:])
+		case strings.HasPrefix(line, "+"):
+			added = append(added, line[1:])
+		}
+	}
+	if hunks != 1 || len(removed)+len(added) > maxLines {
+		return nil, false
+	}
+
+	fix := &SmallFix{File: file, StartLine: oldStart, EndLine: oldStart + oldCount - 1, Original: removed, Replacement: added}
+	if oldCount == 0 {
+		// A pure insertion after line oldStart: anchor the suggestion on that line
+		if oldStart == 0 {
+			return nil, false
+		}
+		anchor, err := git(repoPath, "show", "HEAD:"+file)
+		if err != nil {
+			return nil, false
+		}
+		lines := strings.Split(anchor, "\n")
+		if oldStart > len(lines) {
+			return nil, false
+		}
+		fix.EndLine = oldStart
+		fix.Original = []string{lines[oldStart-1]}
+		fix.Replacement = append([]string{lines[oldStart-1]}, added...)
+	}
+
+	patch, err := git(repoPath, "diff", "--", file)
+	if err != nil {
+		return nil, false
+	}
+	fix.Patch = patch
+	return fix, true
+}
+
+// SuggestOnPullRequest posts the fix as a suggested change on an open pull request of the
+// repository, returning the comment's URL. It fails when the pull request's version of the
+// file differs on those lines, or GitHub rejects lines outside the pull request's diff.
+func SuggestOnPullRequest(ctx *probot.Context, repoName, repoPath string, prNumber int, fix *SmallFix, body string) (string, error) {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return "", err
+	}
+	if _, err := git(repoPath, "fetch", "--depth=1", "origin", fmt.Sprintf("pull/%d/head", prNumber)); err != nil {
+		return "", err
+	}
+	headSHA, err := git(repoPath, "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return "", err
+	}
+	headSHA = strings.TrimSpace(headSHA)
+	content, err := git(repoPath, "show", headSHA+":"+fix.File)
+	if err != nil {
+		return "", fmt.Errorf("%s is not in #%d: %w", fix.File, prNumber, err)
+	}
+	lines := strings.Split(content, "\n")
+	if fix.EndLine > len(lines) || strings.Join(lines[fix.StartLine-1:fix.EndLine], "\n") != strings.Join(fix.Original, "\n") {
+		return "", fmt.Errorf("#%d changes lines %d-%d of %s", prNumber, fix.StartLine, fix.EndLine, fix.File)
+	}
+
+	comment := githubapi.ReviewComment{
+		Body:      body + "\n\n```suggestion\n" + strings.Join(fix.Replacement, "\n") + "\n```",
+		Path:      fix.File,
+		CommitID:  headSHA,
+		StartLine: fix.StartLine,
+		Line:      fix.EndLine,
+	}
+	url, err := NewGitHubClient(ctx).CreateReviewComment(context.Background(), owner, repo, prNumber, comment)
+	if err != nil {
+		return "", err
+	}
+	slog.InfoContext(logging.For(ctx), "Posted suggested change", "repo", repoName, "pr", prNumber, "file", fix.File, "lines", fmt.Sprintf("%d-%d", fix.StartLine, fix.EndLine))
+	return url, nil
+}
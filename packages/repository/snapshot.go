@@ -3,15 +3,19 @@ package repository
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
-	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"time"
 
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	"devflow-agent/packages/store"
+
 	"github.com/swinton/go-probot/probot"
 )
 
@@ -24,7 +28,9 @@ type Change struct {
 type snapshotMeta struct {
 	LastSyncedSHA string   `json:"last_synced_sha"`
 	ChangedFiles  []string `json:"changed_files"`
-	CreatedAt     string   `json:"created_at"`
+	CreatedAt     string   `json:"created_at,omitempty"` // empty in deterministic mode
+	// Checksums are the sha256 of each knowledge base document, by its path under .devflow
+	Checksums map[string]string `json:"checksums,omitempty"`
 }
 
 // ---------- tiny git helpers (local to this file) ----------
@@ -41,95 +47,73 @@ func git(repoPath string, args ...string) (string, error) {
 	return out.String(), nil
 }
 
-func temporarilyUnignoreDevflow(repoPath string) (restore func(), err error) {
-	excludePath := filepath.Join(repoPath, ".git", "info", "exclude")
-	data, _ := os.ReadFile(excludePath)
-	lines := strings.Split(string(data), "\n")
-
-	// Remove .devflow entries
-	filtered := []string{}
-	for _, ln := range lines {
-		if strings.Contains(ln, ".devflow") {
-			continue
-		}
-		filtered = append(filtered, ln)
-	}
-
-	// Write filtered back
-	if err := os.WriteFile(excludePath, []byte(strings.Join(filtered, "\n")), 0644); err != nil {
-		return nil, err
-	}
-
-	// Restore after commit
-	return func() {
-		_ = appendUniqueLines(excludePath, []string{"/.devflow/", ".devflow/", "/.devflow/*"})
-	}, nil
-}
-
-// ---------- lock (best-effort) ----------
-func acquireWriterLock(repoPath string) (func(), error) {
-	lockDir := filepath.Join(repoPath, ".devflow_locks")
-	if err := os.MkdirAll(lockDir, 0o755); err != nil {
+// ---------- lock ----------
+// acquireWriterLock serializes snapshot writers for a repository through the configured
+// store, so replicas without a shared disk coordinate too
+func acquireWriterLock(repoName string) (*store.Lease, error) {
+	locker, err := store.DefaultLocker()
+	if err != nil {
 		return nil, err
 	}
-	lockFile := filepath.Join(lockDir, "snapshot.write.lock")
-	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	lease, err := locker.TryLock("snapshot:"+repoName, store.LockTTL())
 	if err != nil {
 		return nil, fmt.Errorf("devflow writer lock busy: %w", err)
 	}
-	_ = f.Close()
-	return func() { _ = os.Remove(lockFile) }, nil
+	return lease, nil
 }
 
 // ---------- pointer & meta ----------
-func pointerPath(repoPath string) string {
-	return filepath.Join(repoPath, ".devflow", "devflow-commit.txt")
-}
+const (
+	pointerPath      = ".devflow/devflow-commit.txt"
+	snapshotMetaPath = ".devflow/snapshot-meta.json"
+)
 
-func readPointerSHA(repoPath string) (string, error) {
-	b, err := os.ReadFile(pointerPath(repoPath))
+func readPointerSHA(repo FS) (string, error) {
+	b, err := repo.ReadFile(pointerPath)
 	if err != nil {
 		return "", err
 	}
 	return strings.TrimSpace(string(b)), nil
 }
 
-func writePointerSHA(repoPath, sha string) error {
-	if err := os.MkdirAll(filepath.Join(repoPath, ".devflow"), 0o755); err != nil {
+func writePointerSHA(repo WritableFS, sha string) error {
+	if err := repo.MkdirAll(".devflow", 0o755); err != nil {
 		return err
 	}
-	return os.WriteFile(pointerPath(repoPath), []byte(sha+"\n"), 0o644)
+	return repo.WriteFile(pointerPath, []byte(sha+"\n"), 0o644)
 }
 
-func writeSnapshotMeta(repoPath, headSHA string, changes []Change) error {
+func writeSnapshotMeta(repo WritableFS, headSHA string, changes []Change) error {
 	seen := map[string]bool{}
-	meta := snapshotMeta{
-		LastSyncedSHA: headSHA,
-		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
-	}
+	var changed []string
 	for _, c := range changes {
-		switch c.Status {
-		case "A", "M", "D":
-			if c.New != "" && !seen[c.New] {
-				meta.ChangedFiles = append(meta.ChangedFiles, c.New)
-				seen[c.New] = true
-			}
-		case "R":
-			if c.Old != "" && !seen[c.Old] {
-				meta.ChangedFiles = append(meta.ChangedFiles, c.Old)
-				seen[c.Old] = true
-			}
-			if c.New != "" && !seen[c.New] {
-				meta.ChangedFiles = append(meta.ChangedFiles, c.New)
-				seen[c.New] = true
+		paths := []string{c.New}
+		if c.Status == "R" {
+			paths = []string{c.Old, c.New}
+		} else if c.Status != "A" && c.Status != "M" && c.Status != "D" {
+			continue
+		}
+		for _, p := range paths {
+			if p != "" && !seen[p] {
+				changed = append(changed, p)
+				seen[p] = true
 			}
 		}
 	}
-	b, _ := json.MarshalIndent(meta, "", "  ")
-	if err := os.MkdirAll(filepath.Join(repoPath, ".devflow"), 0o755); err != nil {
+	if err := repo.MkdirAll(".devflow", 0o755); err != nil {
 		return err
 	}
-	return os.WriteFile(filepath.Join(repoPath, ".devflow", "snapshot-meta.json"), b, 0o644)
+	return repo.WriteFile(snapshotMetaPath, snapshotMetaJSON(headSHA, changed, kbChecksums(repo)), 0o644)
+}
+
+// snapshotMetaJSON renders the snapshot meta file of a sync to headSHA
+func snapshotMetaJSON(headSHA string, changed []string, checksums map[string]string) []byte {
+	meta := snapshotMeta{LastSyncedSHA: headSHA, ChangedFiles: changed, Checksums: checksums}
+	if !config.GetConfig().KnowledgeBase.Deterministic {
+		meta.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	b, _ := json.MarshalIndent(meta, "", "  ")
+	return b
 }
 
 // ---------- origin/main helpers ----------
@@ -205,69 +189,157 @@ func BuildEmbeddingsIncremental(repoPath string, changes []Change) error {
 }
 
 // ---------- commit/publish ----------
-func CommitDevflowSync(ctx *probot.Context, repoName, repoPath, headSHA string) error {
+
+// publishKnowledgeBase hands a synced knowledge base to the repository the way its
+// sync.publish policy allows. Every sync publishes through here, so a repository's branch
+// protection is only bypassed when it opted into direct pushes.
+func publishKnowledgeBase(ctx *probot.Context, repoName, repoPath, headSHA string) error {
+	policy := config.SyncPublishPR
+	if repoCfg, err := config.LoadRepoConfig(repoPath); err != nil {
+		slog.WarnContext(logging.For(ctx), "Could not read repository settings, proposing the sync as a pull request", "repo", repoName, "error", err)
+	} else {
+		policy = repoCfg.Sync.Publish
+	}
+
+	switch policy {
+	case config.SyncPublishDirect:
+		return CommitDevflowSync(ctx, repoName, repoPath, headSHA)
+	case config.SyncPublishPR, config.SyncPublishAutoMerge:
+		return ProposeDevflowSync(ctx, repoName, repoPath, headSHA, policy == config.SyncPublishAutoMerge)
+	case config.SyncPublishExternal:
+		// ArchiveAnalysis keeps the documents in the store; the repository is left untouched
+		slog.InfoContext(logging.For(ctx), "Devflow Sync: kept in the store only", "repo", repoName, "sha", headSHA)
+		return nil
+	}
+	return fmt.Errorf("unknown sync.publish policy %q (expected %s, %s, %s or %s)", policy,
+		config.SyncPublishDirect, config.SyncPublishAutoMerge, config.SyncPublishPR, config.SyncPublishExternal)
+}
+
+// commitDevflowWork commits the checkout's .devflow directory on a _devflow_work branch
+// rebased on origin/main, returning the commit message; it is empty when nothing changed
+func commitDevflowWork(ctx *probot.Context, repoPath, headSHA string) (string, error) {
 	branch := "main"
 
 	// 1) Ensure we’re on a branch that tracks origin/main
 	if _, err := git(repoPath, "fetch", "origin", branch); err != nil {
-		return fmt.Errorf("fetch origin/%s: %w", branch, err)
+		return "", fmt.Errorf("fetch origin/%s: %w", branch, err)
 	}
 	if _, err := git(repoPath, "checkout", "-B", "_devflow_work", "origin/"+branch); err != nil {
-		return fmt.Errorf("checkout work branch: %w", err)
+		return "", fmt.Errorf("checkout work branch: %w", err)
 	}
 
 	// 2) Configure bot identity
-	_, _ = git(repoPath, "config", "user.email", "devflow-bot@local")
-	_, _ = git(repoPath, "config", "user.name", "DevFlow Bot")
+	bot := config.GetConfig().Bot
+	_, _ = git(repoPath, "config", "user.email", bot.CommitEmail)
+	_, _ = git(repoPath, "config", "user.name", bot.CommitName)
 
 	// 3) Force-add only .devflow
 	if _, err := git(repoPath, "add", "-f", ".devflow"); err != nil {
-		return fmt.Errorf("git add .devflow: %w", err)
+		return "", fmt.Errorf("git add .devflow: %w", err)
 	}
 
 	// 4) Commit (ignore “nothing to commit” quietly)
 	msg := fmt.Sprintf("chore(devflow): sync knowledge base for %.7s", headSHA)
 	if _, err := git(repoPath, "commit", "-m", msg); err != nil {
-		slog.Info("No .devflow changes to commit (direct mode)")
-		return nil
+		slog.InfoContext(logging.For(ctx), "No .devflow changes to commit")
+		return "", nil
 	}
 
 	// 5) Rebase fast-forward on latest origin/main
 	if _, err := git(repoPath, "fetch", "origin", branch); err != nil {
-		return fmt.Errorf("refetch origin/%s: %w", branch, err)
+		return "", fmt.Errorf("refetch origin/%s: %w", branch, err)
 	}
 	if _, err := git(repoPath, "rebase", "origin/"+branch); err != nil {
 		_, _ = git(repoPath, "rebase", "--abort")
-		return fmt.Errorf("rebase on origin/%s failed: %w", branch, err)
+		return "", fmt.Errorf("rebase on origin/%s failed: %w", branch, err)
 	}
+	return msg, nil
+}
 
-	// 6) Push directly to main
-	if _, err := git(repoPath, "push", "origin", "_devflow_work:"+branch); err != nil {
-		return fmt.Errorf("push to %s failed: %w", branch, err)
+// pushDevflowWork pushes the _devflow_work branch to ref, recording the push in the audit log
+func pushDevflowWork(ctx *probot.Context, repoName, repoPath, ref, msg string, force bool) error {
+	sha, _ := git(repoPath, "rev-parse", "HEAD")
+	args := []string{"push", "origin", "_devflow_work:" + ref}
+	if force {
+		args = []string{"push", "--force", "origin", "_devflow_work:" + ref}
+	}
+	_, err := git(repoPath, args...)
+	RecordAudit(ctx, repoName, "git_push", map[string]any{"ref": ref, "sha": strings.TrimSpace(sha), "message": msg, "force": force}, nil, err)
+	if err != nil {
+		return fmt.Errorf("push to %s failed: %w", ref, err)
 	}
+	return nil
+}
 
-	slog.Info("Directly updated main with .devflow changes", "sha", headSHA)
+// CommitDevflowSync commits the checkout's knowledge base and pushes it straight to main, the
+// sync.publish direct policy
+func CommitDevflowSync(ctx *probot.Context, repoName, repoPath, headSHA string) error {
+	msg, err := commitDevflowWork(ctx, repoPath, headSHA)
+	if err != nil || msg == "" {
+		return err
+	}
+	if err := pushDevflowWork(ctx, repoName, repoPath, "refs/heads/main", msg, false); err != nil {
+		return err
+	}
+	slog.InfoContext(logging.For(ctx), "Directly updated main with .devflow changes", "sha", headSHA)
 	return nil
 }
 
-// ---------- orchestrator ----------
-func RunIncrementalDevflowSync(ctx *probot.Context, repoName, repoPath, headSHA string) error {
-	release, err := acquireWriterLock(repoPath)
+// ProposeDevflowSync commits the checkout's knowledge base to knowledge_base.sync_branch and
+// opens a pull request for it, or updates the one already open. With autoMerge the pull
+// request merges itself once the repository's required reviews and checks pass.
+func ProposeDevflowSync(ctx *probot.Context, repoName, repoPath, headSHA string, autoMerge bool) error {
+	msg, err := commitDevflowWork(ctx, repoPath, headSHA)
+	if err != nil || msg == "" {
+		return err
+	}
+	branch := config.GetConfig().KnowledgeBase.SyncBranch
+	// The branch only ever holds DevFlow's latest sync, so it is overwritten
+	if err := pushDevflowWork(ctx, repoName, repoPath, "refs/heads/"+branch, msg, true); err != nil {
+		return err
+	}
+
+	owner, repo, err := githubapi.SplitRepoName(repoName)
 	if err != nil {
 		return err
 	}
-	defer release()
+	client := NewGitHubClient(ctx)
+	body := fmt.Sprintf("DevFlow synced the knowledge base in `.devflow/` to %s.\n\n"+
+		"This pull request only changes `.devflow/`. It is updated with every sync until it is merged.", headSHA)
+	open, err := client.ListPullRequests(context.Background(), owner, repo, "open", owner+":"+branch)
+	if err != nil {
+		return fmt.Errorf("failed to look up the knowledge base pull request: %w", err)
+	}
+	var pr *githubapi.PullRequest
+	if len(open) > 0 {
+		pr = &open[0]
+		if err := client.EditPullRequestBody(context.Background(), owner, repo, pr.Number, body); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to update knowledge base pull request", "prNumber", pr.Number, "error", err)
+		}
+	} else if pr, err = CreatePullRequest(ctx, repoName, branch, "chore(devflow): sync knowledge base", body); err != nil {
+		return err
+	}
+
+	if autoMerge {
+		if err := client.EnableAutoMerge(context.Background(), pr.NodeID, "SQUASH"); err != nil {
+			// e.g. auto-merge is not allowed in the repository; the pull request waits for review
+			slog.WarnContext(logging.For(ctx), "Could not enable auto-merge on knowledge base pull request", "prNumber", pr.Number, "error", err)
+		}
+	}
+	slog.InfoContext(logging.For(ctx), "Proposed .devflow changes as a pull request", "sha", headSHA, "prNumber", pr.Number, "autoMerge", autoMerge)
+	return nil
+}
 
+// SyncKnowledgeBase brings the .devflow knowledge base of a checkout up to headSHA, rebuilding
+// only what changed since the commit it was last synced to. It commits nothing.
+func SyncKnowledgeBase(repoPath, headSHA string) ([]Change, error) {
 	last := ""
-	if sha, err := readPointerSHA(repoPath); err == nil {
+	if sha, err := readPointerSHA(OSFS(repoPath)); err == nil {
 		last = sha
 	}
 
-	if _, err := git(repoPath, "fetch", "origin", "main"); err != nil {
-		return fmt.Errorf("git fetch origin main: %w", err)
-	}
 	if err := ensureCommitAvailable(repoPath, headSHA); err != nil {
-		return fmt.Errorf("head %s not available: %w", headSHA, err)
+		return nil, fmt.Errorf("head %s not available: %w", headSHA, err)
 	}
 	if last != "" {
 		if err := ensureCommitAvailable(repoPath, last); err != nil {
@@ -285,26 +357,52 @@ func RunIncrementalDevflowSync(ctx *probot.Context, repoName, repoPath, headSHA
 	slog.Info("Devflow Sync: diff", "base", last, "head", headSHA, "changes", len(changes))
 
 	if err := BuildRepoAnalysisIncremental(repoPath, changes); err != nil {
-		return err
+		return nil, err
 	}
 	if err := BuildDepGraphIncremental(repoPath, changes); err != nil {
-		return err
+		return nil, err
 	}
 	if err := BuildEmbeddingsIncremental(repoPath, changes); err != nil {
+		return nil, err
+	}
+
+	if err := writePointerSHA(OSFS(repoPath), headSHA); err != nil {
+		return nil, err
+	}
+	if err := writeSnapshotMeta(OSFS(repoPath), headSHA, changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// ---------- orchestrator ----------
+func RunIncrementalDevflowSync(ctx *probot.Context, repoName, repoPath, headSHA string) error {
+	lease, err := acquireWriterLock(repoName)
+	if err != nil {
 		return err
 	}
+	defer lease.Release()
 
-	if err := writePointerSHA(repoPath, headSHA); err != nil {
+	if _, err := git(repoPath, "fetch", "origin", "main"); err != nil {
+		return fmt.Errorf("git fetch origin main: %w", err)
+	}
+	// A knowledge base in an older format is migrated or rebuilt before it is synced
+	if _, err := UpgradeKnowledgeBase(repoPath, CloneURL(repoName), repoName); err != nil {
 		return err
 	}
-	if err := writeSnapshotMeta(repoPath, headSHA, changes); err != nil {
+	if _, err := SyncKnowledgeBase(repoPath, headSHA); err != nil {
 		return err
 	}
 
-	if err := CommitDevflowSync(ctx, repoName, repoPath, headSHA); err != nil {
+	// A writer that stalled past its lease must not push over the current holder's snapshot
+	if err := lease.Check(); err != nil {
+		return err
+	}
+	if err := publishKnowledgeBase(ctx, repoName, repoPath, headSHA); err != nil {
 		return err
 	}
 
-	slog.Info("Devflow Sync: published", "sha", headSHA)
+	slog.InfoContext(logging.For(ctx), "Devflow Sync: published", "sha", headSHA)
+	ArchiveAnalysis(repoPath, repoName, headSHA)
 	return nil
 }
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"devflow-agent/packages/config"
+	"log/slog"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// StackFrame is a single file/line location parsed from a stack trace
+type StackFrame struct {
+	File     string
+	Line     int
+	Function string
+}
+
+var (
+	// Go panics: "\t/home/app/pkg/handlers/issues.go:123 +0x1d"
+	goFramePattern = regexp.MustCompile(`(?m)^\s*(\S+\.go):(\d+)(?:\s+\+0x[0-9a-f]+)?\s*$`)
+	// Go function line preceding the file line: "main.handle(0x1, 0x2)"
+	goFuncPattern = regexp.MustCompile(`^\s*([\w./*()-]+)\(.*\)\s*$`)
+	// Python tracebacks: `File "/app/pkg/module.py", line 42, in handler`
+	pyFramePattern = regexp.MustCompile(`File "([^"]+)", line (\d+)(?:, in (\S+))?`)
+	// JS stacks: "at handler (/app/src/index.js:10:5)" or "at /app/src/index.js:10:5"
+	jsFramePattern = regexp.MustCompile(`at (?:([\w.$<>\[\] ]+?) \()?((?:[A-Za-z]:)?[^\s():]+\.(?:js|jsx|ts|tsx|mjs|cjs)):(\d+):\d+\)?`)
+)
+
+// ParseStackTraces extracts stack frames from Go panics, Python tracebacks and JS stacks in text.
+func ParseStackTraces(text string) []StackFrame {
+	var frames []StackFrame
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if m := goFramePattern.FindStringSubmatch(line); m != nil {
+			frame := StackFrame{File: m[1], Line: atoiOrZero(m[2])}
+			if i > 0 {
+				if fm := goFuncPattern.FindStringSubmatch(lines[i-1]); fm != nil {
+					frame.Function = fm[1]
+				}
+			}
+			frames = append(frames, frame)
+		}
+	}
+
+	for _, m := range pyFramePattern.FindAllStringSubmatch(text, -1) {
+		frames = append(frames, StackFrame{File: m[1], Line: atoiOrZero(m[2]), Function: m[3]})
+	}
+
+	for _, m := range jsFramePattern.FindAllStringSubmatch(text, -1) {
+		frames = append(frames, StackFrame{File: m[2], Line: atoiOrZero(m[3]), Function: strings.TrimSpace(m[1])})
+	}
+
+	return frames
+}
+
+// MapFramesToRepoFiles resolves stack frames to repository-relative paths from repoFiles.
+// Frames are matched by the longest path suffix, so absolute paths from the reporter's
+// machine (e.g. /home/user/project/pkg/x.go) still map to pkg/x.go. Order of first
+// appearance is preserved and frames outside the repository are dropped.
+func MapFramesToRepoFiles(frames []StackFrame, repoFiles []string) []string {
+	seen := make(map[string]bool)
+	var matched []string
+	for _, frame := range frames {
+		file := bestSuffixMatch(frame.File, repoFiles)
+		if file == "" || seen[file] {
+			continue
+		}
+		seen[file] = true
+		matched = append(matched, file)
+	}
+	return matched
+}
+
+func bestSuffixMatch(framePath string, repoFiles []string) string {
+	framePath = path.Clean(strings.ReplaceAll(framePath, "\\", "/"))
+	best := ""
+	for _, candidate := range repoFiles {
+		if framePath == candidate || strings.HasSuffix(framePath, "/"+candidate) {
+			if len(candidate) > len(best) {
+				best = candidate
+			}
+		}
+	}
+	return best
+}
+
+func atoiOrZero(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// StackTraceCandidateFiles maps stack traces found in the issue text onto files known
+// to the knowledge base's dependency graph.
+func StackTraceCandidateFiles(repoPath, issueText string) []string {
+	frames := ParseStackTraces(issueText)
+	if len(frames) == 0 {
+		return nil
+	}
+
+	cfg := config.GetConfig()
+	// Only the file list is needed, which the index of a sharded graph holds
+	graph, err := LoadRelevantDependencyGraph(cfg.GetDevflowPath(repoPath, cfg.Files.DependencyFile), "")
+	if err != nil {
+		slog.Warn("Stack trace found but dependency graph unavailable", "error", err)
+		return nil
+	}
+
+	files := MapFramesToRepoFiles(frames, graph.Files())
+	slog.Info("Mapped stack trace frames to repository files", "frames", len(frames), "files", files)
+	return files
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"devflow-agent/packages/config"
+	"devflow-agent/packages/githubapi"
+	"devflow-agent/packages/logging"
+	"log/slog"
+	"strings"
+
+	"github.com/swinton/go-probot/probot"
+)
+
+// StatusLabelNames returns the configured lifecycle labels (in-progress, pr-open, failed)
+func StatusLabelNames() []string {
+	sl := config.GetConfig().Issues.StatusLabels
+	var names []string
+	for _, name := range []string{sl.InProgress, sl.PROpen, sl.Failed} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// IsStatusLabel reports whether a label is one of the lifecycle labels managed by DevFlow
+func IsStatusLabel(name string) bool {
+	for _, status := range StatusLabelNames() {
+		if strings.EqualFold(status, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetIssueStatus replaces any lifecycle label on the issue with status. An empty status
+// just removes the lifecycle labels.
+func SetIssueStatus(ctx *probot.Context, repoName string, issueNumber int, status string) error {
+	owner, repo, err := githubapi.SplitRepoName(repoName)
+	if err != nil {
+		return err
+	}
+	client := NewGitHubClient(ctx)
+
+	current, err := client.ListIssueLabels(context.Background(), owner, repo, issueNumber)
+	if err != nil {
+		slog.ErrorContext(logging.For(ctx), "Failed to list issue labels", "issueNumber", issueNumber, "error", err)
+		return err
+	}
+
+	hasStatus := false
+	for _, name := range current {
+		if status != "" && strings.EqualFold(name, status) {
+			hasStatus = true
+			continue
+		}
+		if !IsStatusLabel(name) {
+			continue
+		}
+		if err := client.RemoveIssueLabel(context.Background(), owner, repo, issueNumber, name); err != nil {
+			slog.WarnContext(logging.For(ctx), "Failed to remove status label", "issueNumber", issueNumber, "label", name, "error", err)
+		}
+	}
+
+	if status != "" && !hasStatus {
+		if err := client.AddIssueLabels(context.Background(), owner, repo, issueNumber, []string{status}); err != nil {
+			slog.ErrorContext(logging.For(ctx), "Failed to add status label", "issueNumber", issueNumber, "label", status, "error", err)
+			return err
+		}
+	}
+
+	slog.InfoContext(logging.For(ctx), "Issue status updated", "repo", repoName, "issueNumber", issueNumber, "status", status)
+	return nil
+}
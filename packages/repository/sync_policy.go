@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"strings"
+
+	"devflow-agent/packages/config"
+)
+
+// SyncSkipReason explains why a push that changed paths needs no knowledge base sync: it only
+// touched the knowledge base itself (DevFlow's own sync commits) or paths the policy ignores.
+// It returns "" when the push must be synced, including when paths is empty because the
+// changes are unknown.
+func SyncSkipReason(policy config.SyncPolicyConfig, paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	devflowDir := config.GetConfig().Repository.DevflowDirectory + "/"
+	onlyDevflow := true
+	for _, p := range paths {
+		if strings.HasPrefix(p, devflowDir) {
+			continue
+		}
+		onlyDevflow = false
+		if !matchesAny(policy.Ignore, p) {
+			return ""
+		}
+	}
+	if onlyDevflow {
+		return "only the knowledge base changed"
+	}
+	return "only ignored paths changed"
+}
+
+// matchesAny reports whether p matches one of the glob patterns
+func matchesAny(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if MatchPathPattern(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
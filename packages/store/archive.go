@@ -0,0 +1,191 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ErrAnalysisNotFound is returned by GetAnalysis for unknown versions
+var ErrAnalysisNotFound = errors.New("analysis version not found")
+
+// AnalysisVersion is an archived copy of a repository's knowledge base documents
+type AnalysisVersion struct {
+	Repo      string            `json:"repo"`
+	Version   int64             `json:"version"` // increases with every archived copy of the repository
+	CommitSHA string            `json:"commit_sha"`
+	CreatedAt time.Time         `json:"created_at"`
+	Files     map[string]string `json:"files,omitempty"` // document name -> content
+}
+
+// AnalysisArchive keeps the most recent versions of each repository's analysis documents
+type AnalysisArchive interface {
+	// ArchiveAnalysis stores v under the next version number, then drops all but the newest keep
+	ArchiveAnalysis(v *AnalysisVersion, keep int) error
+	// ListAnalyses returns the archived versions of a repository, newest first
+	ListAnalyses(repo string) ([]*AnalysisVersion, error)
+	// GetAnalysis loads one archived version
+	GetAnalysis(repo string, version int64) (*AnalysisVersion, error)
+}
+
+func (s *FileStore) analysisDir(repo string) string {
+	return filepath.Join(s.dir, "analyses", unsafeIDChars.ReplaceAllString(repo, "_"))
+}
+
+// ArchiveAnalysis writes the version to analyses/<repo>/<version>.json and removes older files
+func (s *FileStore) ArchiveAnalysis(v *AnalysisVersion, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := s.analysisDir(v.Repo)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	versions := s.analysisVersions(dir)
+	v.Version = 1
+	if len(versions) > 0 {
+		v.Version = versions[len(versions)-1] + 1
+	}
+	if v.CreatedAt.IsZero() {
+		v.CreatedAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, strconv.FormatInt(v.Version, 10)+".json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to archive analysis of %s: %w", v.Repo, err)
+	}
+	versions = append(versions, v.Version)
+	for len(versions) > keep {
+		_ = os.Remove(filepath.Join(dir, strconv.FormatInt(versions[0], 10)+".json"))
+		versions = versions[1:]
+	}
+	return nil
+}
+
+// analysisVersions returns the version numbers archived in dir, oldest first
+func (s *FileStore) analysisVersions(dir string) []int64 {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	var versions []int64
+	for _, m := range matches {
+		n, err := strconv.ParseInt(filepath.Base(m[:len(m)-len(".json")]), 10, 64)
+		if err == nil {
+			versions = append(versions, n)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+// ListAnalyses reads every archived version of the repository
+func (s *FileStore) ListAnalyses(repo string) ([]*AnalysisVersion, error) {
+	s.mu.Lock()
+	versions := s.analysisVersions(s.analysisDir(repo))
+	s.mu.Unlock()
+
+	var out []*AnalysisVersion
+	for i := len(versions) - 1; i >= 0; i-- {
+		if v, err := s.GetAnalysis(repo, versions[i]); err == nil {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// GetAnalysis reads one version file
+func (s *FileStore) GetAnalysis(repo string, version int64) (*AnalysisVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(s.analysisDir(repo), strconv.FormatInt(version, 10)+".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrAnalysisNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var v AnalysisVersion
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("failed to parse analysis %d of %s: %w", version, repo, err)
+	}
+	return &v, nil
+}
+
+// ArchiveAnalysis numbers the version with INCR, stores it under analysis:<repo>:<version> and
+// indexes it in the repository's sorted set, trimming the set and keys past keep
+func (s *RedisStore) ArchiveAnalysis(v *AnalysisVersion, keep int) error {
+	n, err := s.client.do("INCR", s.prefix+"analysis-seq:"+v.Repo)
+	if err != nil {
+		return fmt.Errorf("failed to archive analysis of %s: %w", v.Repo, err)
+	}
+	v.Version = n.(int64)
+	if v.CreatedAt.IsZero() {
+		v.CreatedAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	version := strconv.FormatInt(v.Version, 10)
+	if _, err := s.client.do("SET", s.prefix+"analysis:"+v.Repo+":"+version, string(data)); err != nil {
+		return fmt.Errorf("failed to archive analysis of %s: %w", v.Repo, err)
+	}
+	index := s.prefix + "analyses:" + v.Repo
+	if _, err := s.client.do("ZADD", index, version, version); err != nil {
+		return err
+	}
+	// Everything but the newest keep members, lowest scores first
+	stale, err := s.client.do("ZRANGE", index, "0", strconv.Itoa(-keep-1))
+	if err != nil {
+		return err
+	}
+	for _, member := range stale.([]any) {
+		old := fmt.Sprint(member)
+		if _, err := s.client.do("DEL", s.prefix+"analysis:"+v.Repo+":"+old); err != nil {
+			return err
+		}
+		if _, err := s.client.do("ZREM", index, old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListAnalyses reads the versions indexed for the repository
+func (s *RedisStore) ListAnalyses(repo string) ([]*AnalysisVersion, error) {
+	reply, err := s.client.do("ZREVRANGE", s.prefix+"analyses:"+repo, "0", "-1")
+	if err != nil {
+		return nil, err
+	}
+	var out []*AnalysisVersion
+	for _, member := range reply.([]any) {
+		n, err := strconv.ParseInt(fmt.Sprint(member), 10, 64)
+		if err != nil {
+			continue
+		}
+		if v, err := s.GetAnalysis(repo, n); err == nil {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// GetAnalysis loads one version by key
+func (s *RedisStore) GetAnalysis(repo string, version int64) (*AnalysisVersion, error) {
+	reply, err := s.client.do("GET", s.prefix+"analysis:"+repo+":"+strconv.FormatInt(version, 10))
+	if errors.Is(err, errRedisNil) {
+		return nil, ErrAnalysisNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var v AnalysisVersion
+	if err := json.Unmarshal([]byte(reply.(string)), &v); err != nil {
+		return nil, fmt.Errorf("failed to parse analysis %d of %s: %w", version, repo, err)
+	}
+	return &v, nil
+}
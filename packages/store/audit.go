@@ -0,0 +1,177 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// AuditEntry records one change the bot made on a repository's host, with what it sent and
+// what came back
+type AuditEntry struct {
+	Seq      int64           `json:"seq"` // increases with every entry of the repository
+	Time     time.Time       `json:"time"`
+	Repo     string          `json:"repo"`
+	Action   string          `json:"action"` // e.g. "update_ref" or "git_push"
+	RunID    string          `json:"run_id,omitempty"`
+	Delivery string          `json:"delivery_id,omitempty"`
+	Event    string          `json:"event,omitempty"`
+	Input    json.RawMessage `json:"input,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// AuditQuery narrows ListAudit; empty fields match every entry
+type AuditQuery struct {
+	RunID  string
+	Action string
+	Since  time.Time
+	Limit  int // newest entries kept; 0 keeps all
+}
+
+func (q AuditQuery) matches(e *AuditEntry) bool {
+	return (q.RunID == "" || e.RunID == q.RunID) &&
+		(q.Action == "" || e.Action == q.Action) &&
+		(q.Since.IsZero() || !e.Time.Before(q.Since))
+}
+
+// AuditLog is an append-only record of the bot's changes, kept per repository
+type AuditLog interface {
+	// AppendAudit numbers e and adds it to its repository's log
+	AppendAudit(e *AuditEntry) error
+	// ListAudit returns the repository's entries matching q, newest first
+	ListAudit(repo string, q AuditQuery) ([]*AuditEntry, error)
+}
+
+func (s *FileStore) auditPath(repo string) string {
+	return filepath.Join(s.dir, "audit", unsafeIDChars.ReplaceAllString(repo, "_")+".jsonl")
+}
+
+// AppendAudit appends the entry as one line of audit/<repo>.jsonl. The file is only ever
+// appended to; its sequence continues from the last line, read once per process.
+func (s *FileStore) AppendAudit(e *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.auditPath(e.Repo)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if s.auditSeq == nil {
+		s.auditSeq = map[string]int64{}
+	}
+	last, ok := s.auditSeq[path]
+	if !ok {
+		entries, err := readAuditFile(path)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			last = entries[len(entries)-1].Seq
+		}
+	}
+	e.Seq = last + 1
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log of %s: %w", e.Repo, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to append to audit log of %s: %w", e.Repo, err)
+	}
+	s.auditSeq[path] = e.Seq
+	return nil
+}
+
+// ListAudit reads the repository's audit file
+func (s *FileStore) ListAudit(repo string, q AuditQuery) ([]*AuditEntry, error) {
+	s.mu.Lock()
+	entries, err := readAuditFile(s.auditPath(repo))
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return filterAudit(entries, q), nil
+}
+
+// readAuditFile parses an audit file, oldest entry first; a missing file has no entries
+func readAuditFile(path string) ([]*AuditEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, &e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// filterAudit returns the entries matching q, newest first; entries are oldest first
+func filterAudit(entries []*AuditEntry, q AuditQuery) []*AuditEntry {
+	var out []*AuditEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(out) >= q.Limit {
+			break
+		}
+		if q.matches(entries[i]) {
+			out = append(out, entries[i])
+		}
+	}
+	return out
+}
+
+// AppendAudit numbers the entry with INCR and RPUSHes it onto audit:<repo>
+func (s *RedisStore) AppendAudit(e *AuditEntry) error {
+	n, err := s.client.do("INCR", s.prefix+"audit-seq:"+e.Repo)
+	if err != nil {
+		return fmt.Errorf("failed to append to audit log of %s: %w", e.Repo, err)
+	}
+	e.Seq = n.(int64)
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.client.do("RPUSH", s.prefix+"audit:"+e.Repo, string(data)); err != nil {
+		return fmt.Errorf("failed to append to audit log of %s: %w", e.Repo, err)
+	}
+	return nil
+}
+
+// ListAudit reads the repository's audit list
+func (s *RedisStore) ListAudit(repo string, q AuditQuery) ([]*AuditEntry, error) {
+	reply, err := s.client.do("LRANGE", s.prefix+"audit:"+repo, "0", "-1")
+	if err != nil {
+		return nil, err
+	}
+	var entries []*AuditEntry
+	for _, item := range reply.([]any) {
+		var e AuditEntry
+		if json.Unmarshal([]byte(fmt.Sprint(item)), &e) == nil {
+			entries = append(entries, &e)
+		}
+	}
+	return filterAudit(entries, q), nil
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ErrDeadLetterNotFound is returned when an issue has no dead-lettered run
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a run that still failed after its retries, kept with its trigger so an
+// operator can inspect it and queue it again
+type DeadLetter struct {
+	RunID          string          `json:"run_id"`
+	Kind           string          `json:"kind"` // kind of the run, e.g. "issue" or "multi_repo"
+	Repo           string          `json:"repo"`
+	IssueNumber    int             `json:"issue_number"`
+	IssueTitle     string          `json:"issue_title,omitempty"`
+	Trigger        json.RawMessage `json:"trigger,omitempty"` // the issues event that started the run
+	InstallationID int64           `json:"installation_id"`   // app installation the run is requeued under
+	Attempts       int             `json:"attempts"`
+	Errors         []string        `json:"errors"` // error of every attempt, oldest first
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// DeadLetterStore keeps dead-lettered runs, one per issue
+type DeadLetterStore interface {
+	// SaveDeadLetter records d, replacing an earlier dead letter of the same issue
+	SaveDeadLetter(d *DeadLetter) error
+	GetDeadLetter(repo string, issueNumber int) (*DeadLetter, error)
+	// ListDeadLetters returns every dead letter, newest first
+	ListDeadLetters() ([]*DeadLetter, error)
+	// DeleteDeadLetter removes the issue's dead letter; a missing one is not an error
+	DeleteDeadLetter(repo string, issueNumber int) error
+}
+
+func deadLetterKey(repo string, issueNumber int) string {
+	return repo + "#" + strconv.Itoa(issueNumber)
+}
+
+func (s *FileStore) deadLetterPath(repo string, issueNumber int) string {
+	return filepath.Join(s.dir, "dead-letters", unsafeIDChars.ReplaceAllString(deadLetterKey(repo, issueNumber), "_")+".json")
+}
+
+// SaveDeadLetter writes dead-letters/<repo>#<issue>.json
+func (s *FileStore) SaveDeadLetter(d *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now().UTC()
+	}
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := s.deadLetterPath(d.Repo, d.IssueNumber)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write dead letter of %s: %w", deadLetterKey(d.Repo, d.IssueNumber), err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// GetDeadLetter loads the issue's dead letter
+func (s *FileStore) GetDeadLetter(repo string, issueNumber int) (*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return readDeadLetter(s.deadLetterPath(repo, issueNumber))
+}
+
+func readDeadLetter(path string) (*DeadLetter, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrDeadLetterNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var d DeadLetter
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("failed to parse dead letter %s: %w", filepath.Base(path), err)
+	}
+	return &d, nil
+}
+
+// ListDeadLetters reads every file under dead-letters/
+func (s *FileStore) ListDeadLetters() ([]*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matches, err := filepath.Glob(filepath.Join(s.dir, "dead-letters", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var letters []*DeadLetter
+	for _, m := range matches {
+		if d, err := readDeadLetter(m); err == nil {
+			letters = append(letters, d)
+		}
+	}
+	sortDeadLetters(letters)
+	return letters, nil
+}
+
+// DeleteDeadLetter removes the issue's file
+func (s *FileStore) DeleteDeadLetter(repo string, issueNumber int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.deadLetterPath(repo, issueNumber)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func sortDeadLetters(letters []*DeadLetter) {
+	sort.Slice(letters, func(i, j int) bool { return letters[i].CreatedAt.After(letters[j].CreatedAt) })
+}
+
+// SaveDeadLetter SETs dead-letter:<repo>#<issue> and indexes it in the dead-letters set
+func (s *RedisStore) SaveDeadLetter(d *DeadLetter) error {
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	key := deadLetterKey(d.Repo, d.IssueNumber)
+	if _, err := s.client.do("SET", s.prefix+"dead-letter:"+key, string(data)); err != nil {
+		return fmt.Errorf("failed to save dead letter of %s: %w", key, err)
+	}
+	_, err = s.client.do("SADD", s.prefix+"dead-letters", key)
+	return err
+}
+
+// GetDeadLetter loads the issue's dead letter
+func (s *RedisStore) GetDeadLetter(repo string, issueNumber int) (*DeadLetter, error) {
+	return s.getDeadLetter(deadLetterKey(repo, issueNumber))
+}
+
+func (s *RedisStore) getDeadLetter(key string) (*DeadLetter, error) {
+	reply, err := s.client.do("GET", s.prefix+"dead-letter:"+key)
+	if errors.Is(err, errRedisNil) {
+		return nil, ErrDeadLetterNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var d DeadLetter
+	if err := json.Unmarshal([]byte(reply.(string)), &d); err != nil {
+		return nil, fmt.Errorf("failed to parse dead letter %s: %w", key, err)
+	}
+	return &d, nil
+}
+
+// ListDeadLetters loads every member of the dead-letters set
+func (s *RedisStore) ListDeadLetters() ([]*DeadLetter, error) {
+	reply, err := s.client.do("SMEMBERS", s.prefix+"dead-letters")
+	if err != nil {
+		return nil, err
+	}
+	var letters []*DeadLetter
+	for _, key := range reply.([]any) {
+		if d, err := s.getDeadLetter(fmt.Sprint(key)); err == nil {
+			letters = append(letters, d)
+		}
+	}
+	sortDeadLetters(letters)
+	return letters, nil
+}
+
+// DeleteDeadLetter removes the issue's key and its index entry
+func (s *RedisStore) DeleteDeadLetter(repo string, issueNumber int) error {
+	key := deadLetterKey(repo, issueNumber)
+	if _, err := s.client.do("DEL", s.prefix+"dead-letter:"+key); err != nil {
+		return err
+	}
+	_, err := s.client.do("SREM", s.prefix+"dead-letters", key)
+	return err
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Claimer records idempotency keys so a unit of work runs once across webhook redeliveries
+// and replicas
+type Claimer interface {
+	// Claim records key and reports whether this caller is the first to claim it within ttl
+	Claim(key string, ttl time.Duration) (bool, error)
+	// Unclaim forgets key so the work can be attempted again
+	Unclaim(key string) error
+}
+
+func (s *FileStore) claimPath(key string) string {
+	return filepath.Join(s.dir, "idempotency", unsafeIDChars.ReplaceAllString(key, "_")+".claim")
+}
+
+// Claim creates the key's claim file, replacing one older than ttl
+func (s *FileStore) Claim(key string, ttl time.Duration) (bool, error) {
+	path := s.claimPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, _ = f.WriteString(time.Now().UTC().Format(time.RFC3339))
+			return true, f.Close()
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return false, fmt.Errorf("failed to claim %s: %w", key, err)
+		}
+		if breakStaleFile(path, ttl) {
+			continue
+		}
+		break
+	}
+	return false, nil
+}
+
+// Unclaim removes the key's claim file
+func (s *FileStore) Unclaim(key string) error {
+	if err := os.Remove(s.claimPath(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Claim sets the key with SET NX so exactly one replica wins it
+func (s *RedisStore) Claim(key string, ttl time.Duration) (bool, error) {
+	_, err := s.client.do("SET", s.prefix+"claim:"+key, time.Now().UTC().Format(time.RFC3339), "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	if errors.Is(err, errRedisNil) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to claim %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Unclaim deletes the key
+func (s *RedisStore) Unclaim(key string) error {
+	_, err := s.client.do("DEL", s.prefix+"claim:"+key)
+	return err
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLocked is returned when another holder owns the lock
+var ErrLocked = errors.New("lock is held")
+
+// ErrLeaseLost is returned by Lease.Check once the lease expired and another holder may own the lock
+var ErrLeaseLost = errors.New("lock lease lost")
+
+// Locker provides mutual exclusion across workers. TryLock fails with ErrLocked instead of
+// waiting. The returned lease expires after ttl unless renewed; it is renewed in the
+// background until released, so only a holder that stops running loses it.
+type Locker interface {
+	TryLock(key string, ttl time.Duration) (*Lease, error)
+}
+
+// Lease is a held lock. Token is a fencing token that grows with every acquisition of the
+// key, so a holder that stalled past its lease can be told apart from the current one.
+type Lease struct {
+	Key   string
+	Token int64
+
+	extend  func() error         // pushes the expiry back by the ttl
+	holds   func() (bool, error) // reports whether the lock still carries Token
+	release func()
+
+	mu   sync.Mutex
+	lost bool
+	stop chan struct{}
+	once sync.Once
+}
+
+func newLease(key string, token int64, ttl time.Duration, extend func() error, holds func() (bool, error), release func()) *Lease {
+	l := &Lease{Key: key, Token: token, extend: extend, holds: holds, release: release, stop: make(chan struct{})}
+	go l.keepAlive(ttl)
+	return l
+}
+
+func (l *Lease) keepAlive(ttl time.Duration) {
+	ticker := time.NewTicker(max(ttl/3, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.extend(); err != nil {
+				slog.Warn("Failed to renew lock lease", "key", l.Key, "token", l.Token, "error", err)
+				if errors.Is(err, ErrLeaseLost) {
+					l.mu.Lock()
+					l.lost = true
+					l.mu.Unlock()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Check returns ErrLeaseLost if the lock has passed to another holder. Call it right before
+// side effects that must not be repeated by two holders, such as pushes.
+func (l *Lease) Check() error {
+	l.mu.Lock()
+	lost := l.lost
+	l.mu.Unlock()
+	if !lost {
+		held, err := l.holds()
+		if err != nil {
+			return fmt.Errorf("failed to verify lock %s: %w", l.Key, err)
+		}
+		lost = !held
+	}
+	if lost {
+		return fmt.Errorf("%w: %s (token %d)", ErrLeaseLost, l.Key, l.Token)
+	}
+	return nil
+}
+
+// Release stops renewing the lease and frees the lock if this lease still holds it
+func (l *Lease) Release() {
+	l.once.Do(func() {
+		close(l.stop)
+		l.release()
+	})
+}
+
+// fileLocker locks with exclusive-create files, which only coordinates processes sharing a disk
+type fileLocker struct {
+	dir string
+}
+
+func (l *fileLocker) TryLock(key string, ttl time.Duration) (*Lease, error) {
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		return nil, err
+	}
+	base := filepath.Join(l.dir, unsafeIDChars.ReplaceAllString(key, "_"))
+	path := base + ".lock"
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			token, err := l.nextToken(base + ".fence")
+			if err == nil {
+				_, err = f.WriteString(strconv.FormatInt(token, 10))
+			}
+			_ = f.Close()
+			if err != nil {
+				_ = os.Remove(path)
+				return nil, err
+			}
+			holds := func() (bool, error) { return fileHoldsToken(path, token) }
+			return newLease(key, token, ttl,
+				func() error {
+					if ok, err := holds(); err != nil || !ok {
+						return ErrLeaseLost
+					}
+					now := time.Now()
+					return os.Chtimes(path, now, now)
+				},
+				holds,
+				func() {
+					if ok, _ := holds(); ok {
+						_ = os.Remove(path)
+					}
+				}), nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		// Break locks abandoned by a crashed holder
+		if breakStaleFile(path, ttl) {
+			continue
+		}
+		break
+	}
+	return nil, fmt.Errorf("%w: %s", ErrLocked, key)
+}
+
+// breakStaleFile removes path when it was not modified within ttl, reporting whether it did.
+// Contenders that all saw the file stale race to rename it aside, which only one wins, and the
+// winner removes it only if it is still that stale file: a fresh one another contender created
+// in between is linked back. While it is aside a third contender may create path; the fresh
+// file's holder then loses its lease at its next Check instead of both holding it.
+func breakStaleFile(path string, ttl time.Duration) bool {
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) <= ttl {
+		return false
+	}
+	aside := fmt.Sprintf("%s.stale-%d-%d", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(path, aside); err != nil {
+		return false
+	}
+	defer os.Remove(aside)
+	if moved, err := os.Stat(aside); err == nil && os.SameFile(info, moved) && time.Since(moved.ModTime()) > ttl {
+		return true
+	}
+	if err := os.Link(aside, path); err != nil {
+		slog.Warn("Failed to restore a lock file moved aside as stale", "path", path, "error", err)
+	}
+	return false
+}
+
+// nextToken increments the fencing counter stored next to the lock file; the caller holds the
+// lock, so no other holder updates the counter concurrently
+func (l *fileLocker) nextToken(path string) (int64, error) {
+	var token int64
+	if b, err := os.ReadFile(path); err == nil {
+		token, _ = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	}
+	token++
+	if err := os.WriteFile(path, []byte(strconv.FormatInt(token, 10)), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write fencing token: %w", err)
+	}
+	return token, nil
+}
+
+func fileHoldsToken(path string, token int64) (bool, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(b)) == strconv.FormatInt(token, 10), nil
+}
@@ -0,0 +1,304 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errRedisNil is the reply to a GET/SET NX that found nothing
+var errRedisNil = errors.New("redis: nil")
+
+// redisClient is a minimal RESP2 client holding one connection, enough for run state and locks
+type redisClient struct {
+	addr     string
+	password string
+	db       int
+	mu       sync.Mutex
+	conn     net.Conn
+	reader   *bufio.Reader
+}
+
+// newRedisClient parses redis://[:password@]host[:port][/db]
+func newRedisClient(rawURL string) (*redisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" {
+		return nil, fmt.Errorf("invalid redis URL %q", rawURL)
+	}
+	c := &redisClient{addr: u.Host}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+	return c, nil
+}
+
+func (c *redisClient) connect() error {
+	conn, err := net.DialTimeout("tcp", c.addr, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	c.conn, c.reader = conn, bufio.NewReader(conn)
+	if c.password != "" {
+		if _, err := c.roundTrip("AUTH", c.password); err != nil {
+			c.close()
+			return err
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.roundTrip("SELECT", strconv.Itoa(c.db)); err != nil {
+			c.close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *redisClient) close() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// redisReadOnly are the commands do may send again when their reply was lost: the server may
+// already have run the command, and running SET NX or INCR twice changes the result
+var redisReadOnly = map[string]bool{
+	"GET": true, "SMEMBERS": true, "LRANGE": true, "ZRANGE": true, "ZREVRANGE": true, "HGETALL": true,
+}
+
+// do runs one command, reconnecting once if the connection was dropped. A command is only sent
+// again when the server cannot have run it, because writing it failed, or when it is read-only.
+func (c *redisClient) do(args ...string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if c.conn == nil {
+			if err := c.connect(); err != nil {
+				return nil, err
+			}
+		}
+		if err := c.send(args...); err != nil {
+			c.close()
+			if attempt == 0 && isConnError(err) {
+				continue
+			}
+			return nil, err
+		}
+		reply, err := c.readReply()
+		if err != nil && isConnError(err) {
+			// A reply arriving later would be read as the next command's, so drop the connection
+			c.close()
+			if attempt == 0 && redisReadOnly[args[0]] {
+				continue
+			}
+		}
+		return reply, err
+	}
+}
+
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+func (c *redisClient) roundTrip(args ...string) (any, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisClient) send(args ...string) error {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, a := range args {
+		b.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(a), a))
+	}
+	_ = c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	_, err := io.WriteString(c.conn, b.String())
+	return err
+}
+
+func (c *redisClient) readReply() (any, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		items := make([]any, 0, max(n, 0))
+		for i := 0; i < n; i++ {
+			item, err := c.readReply()
+			if err != nil && !errors.Is(err, errRedisNil) {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// RedisStore keeps runs in Redis so any replica can read and update them
+type RedisStore struct {
+	client *redisClient
+	prefix string
+}
+
+// NewRedisStore connects lazily to the Redis server at redisURL
+func NewRedisStore(redisURL, prefix string) (*RedisStore, error) {
+	client, err := newRedisClient(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: client, prefix: prefix}, nil
+}
+
+// SaveRun writes the run, stamping UpdatedAt (and CreatedAt on first save)
+func (s *RedisStore) SaveRun(run *Run) error {
+	now := time.Now().UTC()
+	if run.CreatedAt.IsZero() {
+		run.CreatedAt = now
+	}
+	run.UpdatedAt = now
+
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	if _, err := s.client.do("SET", s.prefix+"run:"+run.ID, string(data)); err != nil {
+		return fmt.Errorf("failed to save run %s: %w", run.ID, err)
+	}
+	_, err = s.client.do("SADD", s.prefix+"runs", run.ID)
+	return err
+}
+
+// GetRun loads a run by ID
+func (s *RedisStore) GetRun(id string) (*Run, error) {
+	reply, err := s.client.do("GET", s.prefix+"run:"+id)
+	if errors.Is(err, errRedisNil) {
+		return nil, ErrRunNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var run Run
+	if err := json.Unmarshal([]byte(reply.(string)), &run); err != nil {
+		return nil, fmt.Errorf("failed to parse run %s: %w", id, err)
+	}
+	return &run, nil
+}
+
+// ListRuns returns every stored run, newest first
+func (s *RedisStore) ListRuns() ([]*Run, error) {
+	reply, err := s.client.do("SMEMBERS", s.prefix+"runs")
+	if err != nil {
+		return nil, err
+	}
+	var runs []*Run
+	for _, id := range reply.([]any) {
+		if run, err := s.GetRun(fmt.Sprint(id)); err == nil {
+			runs = append(runs, run)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].CreatedAt.After(runs[j].CreatedAt) })
+	return runs, nil
+}
+
+// redisLocker implements Locker with SET NX PX. The fencing token comes from a per-key
+// INCR counter and is stored as the lock value, so renewals and releases only touch the
+// lock while it still carries this holder's token.
+type redisLocker struct {
+	client *redisClient
+	prefix string
+}
+
+const (
+	redisUnlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+	redisExtendScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+)
+
+func (l *redisLocker) TryLock(key string, ttl time.Duration) (*Lease, error) {
+	lockKey := l.prefix + "lock:" + key
+	reply, err := l.client.do("INCR", l.prefix+"fence:"+key)
+	if err != nil {
+		return nil, err
+	}
+	token := reply.(int64)
+	value := strconv.FormatInt(token, 10)
+	ttlMillis := strconv.FormatInt(ttl.Milliseconds(), 10)
+
+	_, err = l.client.do("SET", lockKey, value, "NX", "PX", ttlMillis)
+	if errors.Is(err, errRedisNil) {
+		return nil, fmt.Errorf("%w: %s", ErrLocked, key)
+	} else if err != nil {
+		return nil, err
+	}
+	return newLease(key, token, ttl,
+		func() error {
+			reply, err := l.client.do("EVAL", redisExtendScript, "1", lockKey, value, ttlMillis)
+			if err != nil {
+				return err
+			}
+			if n, _ := reply.(int64); n == 0 {
+				return ErrLeaseLost
+			}
+			return nil
+		},
+		func() (bool, error) {
+			current, err := l.client.do("GET", lockKey)
+			if errors.Is(err, errRedisNil) {
+				return false, nil
+			} else if err != nil {
+				return false, err
+			}
+			return current == value, nil
+		},
+		func() {
+			_, _ = l.client.do("EVAL", redisUnlockScript, "1", lockKey, value)
+		}), nil
+}
@@ -0,0 +1,352 @@
+// Package store persists workflow runs that outlive a single webhook delivery, such as
+// multi-repository changes tracked as one run.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"devflow-agent/packages/config"
+)
+
+// ErrRunNotFound is returned when no run with the requested ID exists
+var ErrRunNotFound = errors.New("run not found")
+
+// Run statuses
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusPartial   = "partial"
+	StatusFailed    = "failed"
+	StatusHeld      = "held"      // trigger waiting for its repository's schedule
+	StatusReleased  = "released"  // held trigger handed back to its handler
+	StatusEscalated = "escalated" // left to a human as a plan because the agent was unsure
+	StatusCancelled = "cancelled" // held trigger dropped because its issue was closed
+	StatusSkipped   = "skipped"   // requested run that the issue workflow did not start
+)
+
+// RunPR is a pull request opened as part of a run
+type RunPR struct {
+	Repo   string `json:"repo"`
+	Branch string `json:"branch"`
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+}
+
+// Run is one tracked workflow execution
+type Run struct {
+	ID          string      `json:"id"`
+	Kind        string      `json:"kind"` // e.g. "multi_repo"
+	Repo        string      `json:"repo"` // repository of the triggering issue
+	IssueNumber int         `json:"issue_number"`
+	Status      string      `json:"status"`
+	Repos       []string    `json:"repos,omitempty"`
+	PRs         []RunPR     `json:"prs,omitempty"`
+	Errors      []string    `json:"errors,omitempty"`
+	Stage       string      `json:"stage,omitempty"` // stage a failed run stopped at
+	Checkpoint  *Checkpoint `json:"checkpoint,omitempty"`
+	// Variants maps each prompt experiment to the variant the run was assigned
+	Variants map[string]string `json:"variants,omitempty"`
+	// Trigger is the webhook payload of a held trigger, handled again on release
+	Trigger json.RawMessage `json:"trigger,omitempty"`
+	// KBDelta is the knowledge base update of the run's pull request, applied when it merges
+	KBDelta *KBDelta `json:"kb_delta,omitempty"`
+	// Confidence is how sure the agent was of the run, kept to calibrate the escalation threshold
+	Confidence *RunConfidence `json:"confidence,omitempty"`
+	// Candidates are the files the run's prompt pointed the agent at, ranked, with the reasons
+	Candidates []FileCandidate `json:"candidates,omitempty"`
+	// Answer is the reply of an analysis run requested through the runs API
+	Answer string `json:"answer,omitempty"`
+	// LinkedRun is the run a runs API request was handed to, e.g. the issue's held trigger
+	LinkedRun string    `json:"linked_run,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RunConfidence is the confidence a run was scored with and what it decided
+type RunConfidence struct {
+	Plan      *float64 `json:"plan,omitempty"`   // understanding of the issue and choice of files or repositories
+	Change    *float64 `json:"change,omitempty"` // that the changes resolve the issue
+	Score     float64  `json:"score"`            // the lowest reported confidence
+	Threshold float64  `json:"threshold"`        // escalation.min_confidence when the run was scored
+	Escalated bool     `json:"escalated"`
+}
+
+// FileCandidate is a file ranked as likely relevant to a run's issue, with a 0-1 score
+type FileCandidate struct {
+	File    string   `json:"file"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// Checkpoint holds the outputs of a run's completed stages so a failed run can resume without
+// re-cloning the repository or calling the model again
+type Checkpoint struct {
+	Branch        string            `json:"branch"`
+	CommitMessage string            `json:"commit_message"`
+	Files         map[string]string `json:"files,omitempty"` // repo-relative path -> content to commit
+	// Modes are the tree modes of the files that are not regular files: executables, and
+	// symlinks, whose Files entry is the link target
+	Modes         map[string]string `json:"modes,omitempty"`
+	Committed     bool              `json:"committed"`
+	Summary       string            `json:"summary"`
+	ChangedFiles  []string          `json:"changed_files"`
+	PRTitle       string            `json:"pr_title,omitempty"`
+	PRBody        string            `json:"pr_body,omitempty"`
+	PRNotes       []string          `json:"pr_notes,omitempty"`
+	UsePRTemplate bool              `json:"use_pr_template,omitempty"` // agent PR body was unreadable
+	IssueLinks    string            `json:"issue_links,omitempty"`     // "Closes #N"/"Refs #N" lines for the PR template
+	IssueAuthor   string            `json:"issue_author,omitempty"`
+	Reviewers     []string          `json:"reviewers,omitempty"` // primary authors of the changed files
+	Language      string            `json:"language,omitempty"`  // language of PR text and comments
+	// UpdatePR is the open pull request the run commits to instead of opening one
+	UpdatePR *RunPR `json:"update_pr,omitempty"`
+}
+
+// KBDelta is the knowledge base update a pull request makes, computed when the PR is opened so
+// its merge can be synced without a clone. It only applies while the PR and the knowledge base
+// are unchanged since.
+type KBDelta struct {
+	ParentSHA    string            `json:"parent_sha"`    // default branch commit the PR is based on
+	HeadSHA      string            `json:"head_sha"`      // PR head commit the delta describes
+	BaseSHA      string            `json:"base_sha"`      // commit the knowledge base was synced to
+	Files        map[string]string `json:"files"`         // changed .devflow files, repo-relative path -> content
+	ChangedFiles []string          `json:"changed_files"` // source files the sync covered
+	// Checksums of the synced knowledge base documents, recorded in its snapshot meta file
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+// RunStore saves and loads runs
+type RunStore interface {
+	SaveRun(run *Run) error
+	GetRun(id string) (*Run, error)
+	ListRuns() ([]*Run, error)
+}
+
+// FileStore keeps each run as a JSON file in a directory
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+	// auditSeq caches the last sequence number of each audit file
+	auditSeq map[string]int64
+}
+
+var unsafeIDChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// NewFileStore returns a store rooted at dir, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+var (
+	defaultMu          sync.Mutex
+	defaultStore       RunStore
+	defaultLocker      Locker
+	defaultClaimer     Claimer
+	defaultUsage       UsageStore
+	defaultArchive     AnalysisArchive
+	defaultAudit       AuditLog
+	defaultDeadLetters DeadLetterStore
+)
+
+// Default returns the run store selected by store.backend: "file" (store.dir on local disk)
+// or "redis" (store.redis_url, shared by every replica)
+func Default() (RunStore, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultStore == nil {
+		if err := initDefaults(config.GetConfig().Store); err != nil {
+			return nil, err
+		}
+	}
+	return defaultStore, nil
+}
+
+// DefaultLocker returns the locker matching the configured store backend
+func DefaultLocker() (Locker, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultLocker == nil {
+		if err := initDefaults(config.GetConfig().Store); err != nil {
+			return nil, err
+		}
+	}
+	return defaultLocker, nil
+}
+
+// DefaultClaimer returns the idempotency key store of the configured backend
+func DefaultClaimer() (Claimer, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultClaimer == nil {
+		if err := initDefaults(config.GetConfig().Store); err != nil {
+			return nil, err
+		}
+	}
+	return defaultClaimer, nil
+}
+
+func initDefaults(cfg config.StoreConfig) error {
+	switch cfg.Backend {
+	case "redis":
+		rs, err := NewRedisStore(cfg.RedisURL, cfg.KeyPrefix)
+		if err != nil {
+			return err
+		}
+		defaultStore, defaultClaimer, defaultUsage, defaultArchive, defaultAudit, defaultDeadLetters = rs, rs, rs, rs, rs, rs
+		defaultLocker = &redisLocker{client: rs.client, prefix: cfg.KeyPrefix}
+	case "", "file":
+		fs, err := NewFileStore(cfg.Dir)
+		if err != nil {
+			return err
+		}
+		defaultStore, defaultClaimer, defaultUsage, defaultArchive, defaultAudit, defaultDeadLetters = fs, fs, fs, fs, fs, fs
+		defaultLocker = &fileLocker{dir: filepath.Join(cfg.Dir, "locks")}
+	default:
+		return fmt.Errorf("unknown store backend %q (expected file or redis)", cfg.Backend)
+	}
+	return nil
+}
+
+// LockTTL is the lease duration for locks taken through DefaultLocker
+func LockTTL() time.Duration {
+	if secs := config.GetConfig().Store.LockTTLSeconds; secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return 5 * time.Minute
+}
+
+// DefaultUsage returns the usage counters of the configured backend
+func DefaultUsage() (UsageStore, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultUsage == nil {
+		if err := initDefaults(config.GetConfig().Store); err != nil {
+			return nil, err
+		}
+	}
+	return defaultUsage, nil
+}
+
+// DefaultArchive returns the analysis archive of the configured backend
+func DefaultArchive() (AnalysisArchive, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultArchive == nil {
+		if err := initDefaults(config.GetConfig().Store); err != nil {
+			return nil, err
+		}
+	}
+	return defaultArchive, nil
+}
+
+// DefaultAudit returns the audit log of the configured backend
+func DefaultAudit() (AuditLog, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultAudit == nil {
+		if err := initDefaults(config.GetConfig().Store); err != nil {
+			return nil, err
+		}
+	}
+	return defaultAudit, nil
+}
+
+// DefaultDeadLetters returns the dead-letter store of the configured backend
+func DefaultDeadLetters() (DeadLetterStore, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultDeadLetters == nil {
+		if err := initDefaults(config.GetConfig().Store); err != nil {
+			return nil, err
+		}
+	}
+	return defaultDeadLetters, nil
+}
+
+// IdempotencyTTL is how long a claimed idempotency key suppresses duplicates
+func IdempotencyTTL() time.Duration {
+	if hours := config.GetConfig().Store.IdempotencyTTLHours; hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// RunID builds the ID of the run triggered by an issue
+func RunID(kind, repoName string, issueNumber int) string {
+	return fmt.Sprintf("%s-%s-%d", kind, repoName, issueNumber)
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, unsafeIDChars.ReplaceAllString(id, "_")+".json")
+}
+
+// SaveRun writes the run, stamping UpdatedAt (and CreatedAt on first save)
+func (s *FileStore) SaveRun(run *Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	if run.CreatedAt.IsZero() {
+		run.CreatedAt = now
+	}
+	run.UpdatedAt = now
+
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write-then-rename so readers never see a partial file
+	tmp := s.path(run.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write run %s: %w", run.ID, err)
+	}
+	return os.Rename(tmp, s.path(run.ID))
+}
+
+// GetRun loads a run by ID
+func (s *FileStore) GetRun(id string) (*Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrRunNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to parse run %s: %w", id, err)
+	}
+	return &run, nil
+}
+
+// ListRuns returns every stored run, newest first
+func (s *FileStore) ListRuns() ([]*Run, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var runs []*Run
+	for _, m := range matches {
+		id := filepath.Base(m)
+		run, err := s.GetRun(id[:len(id)-len(".json")])
+		if err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].CreatedAt.After(runs[j].CreatedAt) })
+	return runs, nil
+}
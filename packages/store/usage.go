@@ -0,0 +1,187 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Usage counters, kept per repository and per prompt variant
+const (
+	UsageRuns               = "runs"
+	UsageRunsFailed         = "runs_failed"
+	UsagePRsOpened          = "prs_opened"
+	UsagePRsMerged          = "prs_merged"
+	UsagePRsClosedUnmerged  = "prs_closed_unmerged"
+	UsageReviewIterations   = "review_iterations"
+	UsageTimeToMergeSeconds = "time_to_merge_seconds" // summed over merged PRs
+)
+
+// Counter namespaces
+const (
+	UsageByRepo    = "usage"       // keyed by repository
+	UsageByVariant = "experiments" // keyed by "<experiment>/<variant>"
+	UsageByDay     = "daily"       // keyed by "<repository>/<YYYY-MM-DD>"
+)
+
+// Usage is a set of accumulated counters, e.g. of one repository
+type Usage struct {
+	Key      string           `json:"key"`
+	Counters map[string]int64 `json:"counters"`
+	Updated  time.Time        `json:"updated_at"`
+}
+
+// UsageStore accumulates usage counters, grouped in namespaces
+type UsageStore interface {
+	// IncrUsage adds deltas to the counters of key
+	IncrUsage(namespace, key string, deltas map[string]int64) error
+	// ListUsage returns the counters of every key in the namespace, sorted by key
+	ListUsage(namespace string) ([]*Usage, error)
+	// GetUsage returns the counters of key, all zero when nothing was recorded
+	GetUsage(namespace, key string) (*Usage, error)
+}
+
+func (s *FileStore) usagePath(namespace, key string) string {
+	return filepath.Join(s.dir, namespace, unsafeIDChars.ReplaceAllString(key, "_")+".json")
+}
+
+// IncrUsage updates the key's usage file
+func (s *FileStore) IncrUsage(namespace, key string, deltas map[string]int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.usagePath(namespace, key)
+	usage := &Usage{Key: key, Counters: map[string]int64{}}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, usage); err != nil {
+			return fmt.Errorf("failed to parse usage of %s: %w", key, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if usage.Counters == nil {
+		usage.Counters = map[string]int64{}
+	}
+	for k, v := range deltas {
+		usage.Counters[k] += v
+	}
+	usage.Updated = time.Now().UTC()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(usage, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write usage of %s: %w", key, err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// GetUsage reads the key's usage file
+func (s *FileStore) GetUsage(namespace, key string) (*Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := &Usage{Key: key, Counters: map[string]int64{}}
+	data, err := os.ReadFile(s.usagePath(namespace, key))
+	if os.IsNotExist(err) {
+		return usage, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, usage); err != nil {
+		return nil, fmt.Errorf("failed to parse usage of %s: %w", key, err)
+	}
+	if usage.Counters == nil {
+		usage.Counters = map[string]int64{}
+	}
+	return usage, nil
+}
+
+// ListUsage reads every usage file of the namespace
+func (s *FileStore) ListUsage(namespace string) ([]*Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matches, err := filepath.Glob(filepath.Join(s.dir, namespace, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var out []*Usage
+	for _, m := range matches {
+		data, err := os.ReadFile(m)
+		if err != nil {
+			continue
+		}
+		var usage Usage
+		if json.Unmarshal(data, &usage) == nil {
+			out = append(out, &usage)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// IncrUsage bumps the fields of the key's usage hash with HINCRBY
+func (s *RedisStore) IncrUsage(namespace, key string, deltas map[string]int64) error {
+	hash := s.prefix + namespace + ":" + key
+	for k, v := range deltas {
+		if _, err := s.client.do("HINCRBY", hash, k, strconv.FormatInt(v, 10)); err != nil {
+			return fmt.Errorf("failed to record usage of %s: %w", key, err)
+		}
+	}
+	if _, err := s.client.do("HSET", hash, "updated_at", strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
+		return err
+	}
+	_, err := s.client.do("SADD", s.prefix+namespace, key)
+	return err
+}
+
+// ListUsage reads the usage hash of every key recorded in the namespace
+func (s *RedisStore) ListUsage(namespace string) ([]*Usage, error) {
+	reply, err := s.client.do("SMEMBERS", s.prefix+namespace)
+	if err != nil {
+		return nil, err
+	}
+	var out []*Usage
+	for _, member := range reply.([]any) {
+		usage, err := s.GetUsage(namespace, fmt.Sprint(member))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, usage)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// GetUsage reads the key's usage hash
+func (s *RedisStore) GetUsage(namespace, key string) (*Usage, error) {
+	fields, err := s.client.do("HGETALL", s.prefix+namespace+":"+key)
+	if err != nil {
+		return nil, err
+	}
+	usage := &Usage{Key: key, Counters: map[string]int64{}}
+	items := fields.([]any)
+	for i := 0; i+1 < len(items); i += 2 {
+		name, value := fmt.Sprint(items[i]), fmt.Sprint(items[i+1])
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		if name == "updated_at" {
+			usage.Updated = time.Unix(n, 0).UTC()
+			continue
+		}
+		usage.Counters[name] = n
+	}
+	return usage, nil
+}
@@ -0,0 +1,286 @@
+// Package upgrades finds outdated dependencies in a checkout and applies version bumps to
+// their manifests and lockfiles.
+package upgrades
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Supported ecosystems
+const (
+	EcosystemGo     = "go"
+	EcosystemNPM    = "npm"
+	EcosystemPython = "pip"
+)
+
+// Upgrade is one dependency that can move to a newer version
+type Upgrade struct {
+	Ecosystem string
+	Manifest  string // repository-relative manifest path, e.g. "go.mod" or "web/package.json"
+	Name      string
+	Current   string
+	Latest    string
+}
+
+// String renders the upgrade as "name current -> latest (manifest)"
+func (u Upgrade) String() string {
+	return fmt.Sprintf("%s %s -> %s (%s)", u.Name, u.Current, u.Latest, u.Manifest)
+}
+
+// BranchSuffix returns a branch-name-safe identifier for the upgrade
+func (u Upgrade) BranchSuffix() string {
+	name := branchUnsafe.ReplaceAllString(strings.ToLower(u.Name), "-")
+	return strings.Trim(fmt.Sprintf("%s-%s-%s", u.Ecosystem, name, branchUnsafe.ReplaceAllString(u.Latest, "-")), "-")
+}
+
+var (
+	branchUnsafe       = regexp.MustCompile(`[^a-zA-Z0-9.]+`)
+	requirementPinned  = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)(\[[^\]]*\])?\s*==\s*([A-Za-z0-9.+!*-]+)`)
+	pypiBaseURL        = "https://pypi.org/pypi"
+	manifestSkipDirs   = map[string]bool{".git": true, "node_modules": true, "vendor": true, ".venv": true, "venv": true, ".devflow": true}
+	requirementsPrefix = "requirements"
+)
+
+// DetectOutdated lists the outdated direct dependencies of every manifest in the checkout
+// for the enabled ecosystems. Ecosystems whose tooling fails are logged and skipped.
+func DetectOutdated(ctx context.Context, repoPath string, ecosystems []string) ([]Upgrade, error) {
+	enabled := make(map[string]bool)
+	for _, e := range ecosystems {
+		enabled[e] = true
+	}
+
+	var upgrades []Upgrade
+	err := filepath.WalkDir(repoPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if manifestSkipDirs[d.Name()] {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(repoPath, path)
+		rel = filepath.ToSlash(rel)
+		dir := filepath.Dir(path)
+
+		var found []Upgrade
+		var detectErr error
+		switch {
+		case d.Name() == "go.mod" && enabled[EcosystemGo]:
+			found, detectErr = outdatedGo(ctx, dir, rel)
+		case d.Name() == "package.json" && enabled[EcosystemNPM]:
+			found, detectErr = outdatedNPM(ctx, dir, rel)
+		case strings.HasPrefix(d.Name(), requirementsPrefix) && strings.HasSuffix(d.Name(), ".txt") && enabled[EcosystemPython]:
+			found, detectErr = outdatedPip(ctx, path, rel)
+		default:
+			return nil
+		}
+		if detectErr != nil {
+			slog.Warn("Failed to check dependencies", "manifest", rel, "error", detectErr)
+			return nil
+		}
+		upgrades = append(upgrades, found...)
+		return nil
+	})
+	return upgrades, err
+}
+
+// Apply bumps the dependency in its manifest and lockfile
+func Apply(ctx context.Context, repoPath string, u Upgrade) error {
+	dir := filepath.Join(repoPath, filepath.Dir(filepath.FromSlash(u.Manifest)))
+	switch u.Ecosystem {
+	case EcosystemGo:
+		if err := run(ctx, dir, "go", "get", u.Name+"@"+u.Latest); err != nil {
+			return err
+		}
+		return run(ctx, dir, "go", "mod", "tidy")
+	case EcosystemNPM:
+		return run(ctx, dir, "npm", "install", u.Name+"@"+u.Latest, "--package-lock-only", "--ignore-scripts", "--no-audit", "--no-fund")
+	case EcosystemPython:
+		return bumpRequirement(filepath.Join(repoPath, filepath.FromSlash(u.Manifest)), u)
+	}
+	return fmt.Errorf("unsupported ecosystem %q", u.Ecosystem)
+}
+
+// outdatedGo uses `go list -m -u` to find direct module requirements with newer versions
+func outdatedGo(ctx context.Context, dir, manifest string) ([]Upgrade, error) {
+	cmd := exec.CommandContext(ctx, "go", "list", "-m", "-u", "-json", "all")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list failed: %w", err)
+	}
+
+	var upgrades []Upgrade
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var m struct {
+			Path     string
+			Version  string
+			Main     bool
+			Indirect bool
+			Update   *struct{ Version string }
+		}
+		if err := dec.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse go list output: %w", err)
+		}
+		if m.Main || m.Indirect || m.Update == nil {
+			continue
+		}
+		upgrades = append(upgrades, Upgrade{Ecosystem: EcosystemGo, Manifest: manifest, Name: m.Path, Current: m.Version, Latest: m.Update.Version})
+	}
+	return upgrades, nil
+}
+
+// outdatedNPM uses `npm outdated` to find dependencies with newer releases
+func outdatedNPM(ctx context.Context, dir, manifest string) ([]Upgrade, error) {
+	cmd := exec.CommandContext(ctx, "npm", "outdated", "--json")
+	cmd.Dir = dir
+	// npm exits with status 1 when something is outdated, so judge by the output instead
+	out, _ := cmd.Output()
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+
+	var outdated map[string]struct {
+		Current string `json:"current"`
+		Wanted  string `json:"wanted"`
+		Latest  string `json:"latest"`
+	}
+	if err := json.Unmarshal(out, &outdated); err != nil {
+		return nil, fmt.Errorf("failed to parse npm outdated output: %w", err)
+	}
+
+	var upgrades []Upgrade
+	for name, info := range outdated {
+		current := info.Current
+		if current == "" {
+			current = info.Wanted
+		}
+		if info.Latest == "" || info.Latest == current {
+			continue
+		}
+		upgrades = append(upgrades, Upgrade{Ecosystem: EcosystemNPM, Manifest: manifest, Name: name, Current: current, Latest: info.Latest})
+	}
+	return upgrades, nil
+}
+
+// outdatedPip checks pinned (==) requirements against the latest release on PyPI
+func outdatedPip(ctx context.Context, path, manifest string) ([]Upgrade, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var upgrades []Upgrade
+	for _, line := range strings.Split(string(content), "\n") {
+		m := requirementPinned.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		latest, err := latestPyPIVersion(ctx, m[1])
+		if err != nil {
+			slog.Warn("Failed to query PyPI", "package", m[1], "error", err)
+			continue
+		}
+		if latest != "" && latest != m[3] {
+			upgrades = append(upgrades, Upgrade{Ecosystem: EcosystemPython, Manifest: manifest, Name: m[1], Current: m[3], Latest: latest})
+		}
+	}
+	return upgrades, nil
+}
+
+func latestPyPIVersion(ctx context.Context, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/%s/json", pypiBaseURL, name), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("PyPI returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	return body.Info.Version, nil
+}
+
+// bumpRequirement rewrites the pinned version of one package, keeping extras and comments
+func bumpRequirement(path string, u Upgrade) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(content), "\n")
+	changed := false
+	for i, line := range lines {
+		m := requirementPinned.FindStringSubmatchIndex(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if !strings.EqualFold(trimmed[m[2]:m[3]], u.Name) {
+			continue
+		}
+		indent := line[:strings.Index(line, trimmed)]
+		lines[i] = indent + trimmed[:m[6]] + u.Latest + trimmed[m[7]:]
+		changed = true
+	}
+	if !changed {
+		return fmt.Errorf("%s is not pinned in %s", u.Name, u.Manifest)
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+}
+
+func run(ctx context.Context, dir, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s failed: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ChangedFiles lists the repository-relative paths git reports as modified or untracked
+func ChangedFiles(repoPath string) ([]string, error) {
+	cmd := exec.Command("git", "status", "--porcelain", "--untracked-files=all")
+	cmd.Dir = repoPath
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status failed: %w", err)
+	}
+
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		files = append(files, strings.TrimSpace(line[3:]))
+	}
+	return files, nil
+}
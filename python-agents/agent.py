@@ -15,6 +15,7 @@ from tools import (
     logged_file_read,
     load_repo_analysis,
     load_dependency_graph,
+    find_callers,
     list_files,
 
     # patch-based editing tools
@@ -24,6 +25,10 @@ from tools import (
     # precise tiny-edit tool (our own; no .bak files)
     logged_editor,
 
+    # removing and moving files
+    delete_file,
+    rename_file,
+
     # PR body generation
     generate_pr_body_tool,
 )
@@ -39,24 +44,31 @@ if not gemini_api_key and not anthropic_api_key:
     print("Error: No API keys found. Set GEMINI_API_KEY or ANTHROPIC_API_KEY")
     sys.exit(1)
 
+
+def build_model(temperature: float = 0.5, max_tokens: int = 8192):
+    """Create the agent's model; DevFlow passes a repository's generation settings per request."""
+    if use_anthropic and anthropic_api_key:
+        return AnthropicModel(
+            client_args={"api_key": anthropic_api_key},
+            max_tokens=max_tokens,
+            model_id="claude-haiku-4-5-20251001",
+            params={"temperature": min(temperature, 1.0)},
+        )
+    return GeminiModel(
+        client_args={"api_key": gemini_api_key},
+        model_id="gemini-2.5-flash",
+        params={"temperature": temperature, "max_output_tokens": max_tokens, "top_p": 0.9, "top_k": 40},
+    )
+
+
 if use_anthropic and anthropic_api_key:
     print("[Agent] Using Anthropic Claude Haiku 4.5")
-    model = AnthropicModel(
-        client_args={"api_key": anthropic_api_key},
-        max_tokens=8192,
-        model_id="claude-haiku-4-5-20251001",
-        params={"temperature": 0.5},
-    )
 elif gemini_api_key:
     print("[Agent] Using Google Gemini 2.5 Flash")
-    model = GeminiModel(
-        client_args={"api_key": gemini_api_key},
-        model_id="gemini-2.5-flash",
-        params={"temperature": 0.5, "max_output_tokens": 8092, "top_p": 0.9, "top_k": 40},
-    )
 else:
     print("Error: No valid API key configuration found")
     sys.exit(1)
+model = build_model()
 
 
 def create_suggestion_agent(repo_path: str) -> Agent:
@@ -73,6 +85,7 @@ def create_suggestion_agent(repo_path: str) -> Agent:
             logged_file_read,
             load_repo_analysis,
             load_dependency_graph,
+            find_callers,
             list_files,
             file_write
         ],
@@ -83,7 +96,7 @@ def create_suggestion_agent(repo_path: str) -> Agent:
     return agent
 
 
-def create_automation_agent(repo_path: str) -> Agent:
+def create_automation_agent(repo_path: str, generation=None) -> Agent:
     """
     Automation agent.
 
@@ -92,6 +105,8 @@ def create_automation_agent(repo_path: str) -> Agent:
     - Tiny ≤5-line substitutions: use logged_editor(path, old, new).
     - New files: prefer unified diff creation via apply_unified_patch.
     - Never create backup files (*.bak). Never rewrite entire files for small changes.
+
+    generation carries the repository's temperature and max_output_tokens; None keeps the defaults.
     """
     if not os.path.isabs(repo_path):
         repo_path = os.path.abspath(repo_path)
@@ -104,12 +119,15 @@ def create_automation_agent(repo_path: str) -> Agent:
         list_files,
         load_repo_analysis,
         load_dependency_graph,
+        find_callers,
         logged_file_read,
         read_file_with_lines,
 
         # Editing
         apply_unified_patch,
         logged_editor,  # <— our precise editor (no backups)
+        delete_file,
+        rename_file,
 
         # PR content
         generate_pr_body_tool,
@@ -121,9 +139,14 @@ def create_automation_agent(repo_path: str) -> Agent:
         tool_names = ["<unknown_tool>" for _ in tools]
     print("[Agent] Automation tools:", tool_names)
 
+    agent_model = model
+    if generation is not None:
+        print(f"[Agent] Generation settings: temperature={generation.temperature}, max_output_tokens={generation.max_output_tokens}")
+        agent_model = build_model(generation.temperature, generation.max_output_tokens)
+
     agent = Agent(
         name="DevFlowAutomationAgent",
-        model=model,
+        model=agent_model,
         tools=tools,
         system_prompt=system_prompt,
         structured_output_model=AutomationResult,
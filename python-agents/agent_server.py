@@ -12,9 +12,18 @@ import uvicorn
 import subprocess
 
 from agent import create_suggestion_agent, create_automation_agent
+from tools import FILE_OPERATIONS
 
 load_dotenv()
 
+# Trust the same CA bundle as the Go service when running behind a TLS-intercepting proxy.
+# HTTPS_PROXY / NO_PROXY are read from the environment by the HTTP libraries themselves.
+# Unlike the Go side, these variables replace the system roots, so the bundle must be complete.
+ca_bundle = os.getenv("DEVFLOW_CA_BUNDLE")
+if ca_bundle:
+    for var in ("SSL_CERT_FILE", "REQUESTS_CA_BUNDLE"):
+        os.environ.setdefault(var, ca_bundle)
+
 @contextmanager
 def pushd(new_dir: str):
     prev = os.getcwd()
@@ -69,16 +78,53 @@ def git_changed_files(repo_path: str) -> list[str]:
         print(f"[Server] git_changed_files error: {e}")
         return []
 
+def candidate_files_hint(issue: "IssueData") -> str:
+    """Render the pre-seeded candidate files as a prompt section."""
+    if issue.candidate_ranking:
+        return issue.candidate_ranking
+    if not issue.candidate_files:
+        return ""
+    listing = "\n".join(f"- {p}" for p in issue.candidate_files)
+    return f"Files referenced by stack traces in the issue (inspect these first):\n{listing}"
+
+DOCS_MODE_INSTRUCTIONS = """DOCUMENTATION MODE: this issue asks for documentation, not code changes.
+- Write or update documentation for the area the issue mentions: README sections, pages under docs/,
+  and doc comments (godoc, docstrings, JSDoc) next to the relevant code.
+- Do NOT change code behavior. Only documentation files and comments may be edited; any other
+  change will be discarded before the pull request is opened.
+- Match the tone, headings and formatting of the existing documentation."""
+
+def docs_mode_hint(request: "ProcessIssueRequest") -> str:
+    """Render the documentation-mode instructions when the request is a docs run."""
+    return DOCS_MODE_INSTRUCTIONS if request.mode == "docs" else ""
+
 # Request/Response Models
 class IssueData(BaseModel):
     title: str = Field(description="Issue title")
     body: str = Field(default="", description="Issue body/description")
     labels: List[str] = Field(default_factory=list, description="Issue labels")
+    linked_context: str = Field(default="", description="Condensed context from referenced issues/PRs")
+    candidate_files: List[str] = Field(default_factory=list, description="Files to inspect first (e.g. from stack traces)")
+    candidate_ranking: str = Field(default="", description="Candidate files ranked by relevance, with scores and reasons")
+    ownership_context: str = Field(default="", description="Recent git history and primary authors of candidate files")
+    code_context: str = Field(default="", description="Token-budgeted contents of candidate files (code-files.md)")
+    file_summaries: str = Field(default="", description="Per-file summaries from the knowledge base, most relevant first")
+    infra_context: str = Field(default="", description="Schema and infrastructure summary (migrations, IaC, containers)")
+    api_context: str = Field(default="", description="Condensed API surface (OpenAPI, GraphQL, protobuf); keep specs and handlers consistent")
+    impact_context: str = Field(default="", description="Callers elsewhere of the functions in the candidate files, from the call graph")
+    file_selection_instructions: str = Field(default="", description="Extra file selection guidance from the prompt variant under test")
+    code_generation_instructions: str = Field(default="", description="Extra code generation guidance from the prompt variant under test")
+
+class GenerationSettings(BaseModel):
+    temperature: float = Field(description="Sampling temperature for the agent's model")
+    max_output_tokens: int = Field(description="Output token limit of the agent's responses")
+    pr_body_max_tokens: int = Field(default=0, description="Output token budget of the PR body; 0 is unbounded")
 
 class ProcessIssueRequest(BaseModel):
     repo_path: str = Field(description="Absolute path to cloned repository")
     issue: IssueData = Field(description="GitHub issue data")
-    mode: str = Field(default="automate", description="Mode: 'suggestion' or 'automate'")
+    mode: str = Field(default="automate", description="Mode: 'suggestion', 'automate' or 'docs'")
+    generation: Optional[GenerationSettings] = Field(default=None, description="Repository overrides of the generation settings")
 
 class FileChange(BaseModel):
     file_path: str
@@ -110,6 +156,9 @@ class AutomationResponse(BaseModel):
     summary: str
     pr_body_file: Optional[str] = ""
     error_message: Optional[str] = ""
+    plan_confidence: Optional[float] = None
+    confidence: Optional[float] = None
+    file_operations: List[dict] = []  # {"op": "delete"|"rename", "path", "from"}
 
 # Health check endpoint
 @app.get("/health")
@@ -155,10 +204,26 @@ async def suggest_changes(request: ProcessIssueRequest):
         Body: {request.issue.body}
         Labels: {', '.join(request.issue.labels)}
 
+        {request.issue.linked_context}
+
+        {request.issue.file_summaries}
+
+        {request.issue.infra_context}
+
+        {request.issue.api_context}
+
+        {request.issue.impact_context}
+
+        {candidate_files_hint(request.issue)}
+
+        {request.issue.ownership_context}
+
+        {request.issue.code_context}
+
         IMPORTANT: You are working in the directory: {repo_path}
 
         1. Call list_files('{repo_path}') to list files
-        2. Call load_repo_analysis('{repo_path}') for repo context
+        2. Call load_repo_analysis('{repo_path}') for repo context (pass files='a.py,b.py' to load only the sections for those files)
         3. Use logged_file_read() for file content
         4. Do NOT modify any files
         """
@@ -221,7 +286,7 @@ async def automate_changes(request: ProcessIssueRequest):
         print(f"[Server] Labels: {request.issue.labels}")
         
         # Create automation agent
-        agent = create_automation_agent(repo_path)
+        agent = create_automation_agent(repo_path, request.generation)
         
         # Prepare comprehensive task with PR body instructions
         pr_body_output = os.path.join(repo_path, ".devflow-pr-body.md")
@@ -240,6 +305,18 @@ EDIT_STRATEGY: {
 }
 """
 
+        # Prompt variant under test, if any
+        file_selection_block = ""
+        if request.issue.file_selection_instructions:
+            file_selection_block = "   - " + request.issue.file_selection_instructions + "\n"
+        code_generation_block = ""
+        if request.issue.code_generation_instructions:
+            code_generation_block = "  - " + request.issue.code_generation_instructions + "\n"
+        pr_body_budget_block = ""
+        if request.generation and request.generation.pr_body_max_tokens > 0:
+            # About three quarters of a word per token
+            pr_body_budget_block = f"   - Keep the PR body under {request.generation.pr_body_max_tokens * 3 // 4} words in total.\n"
+
         task = f"""Process this GitHub issue and make the necessary code changes:
 
 Repository Path: {repo_path}
@@ -247,16 +324,35 @@ Title: {request.issue.title}
 Body: {request.issue.body}
 Labels: {', '.join(request.issue.labels)}
 
+{docs_mode_hint(request)}
+
+{request.issue.linked_context}
+
+{request.issue.file_summaries}
+
+{request.issue.infra_context}
+
+{request.issue.api_context}
+
+{request.issue.impact_context}
+
+{candidate_files_hint(request.issue)}
+
+{request.issue.ownership_context}
+
+{request.issue.code_context}
+
 IMPORTANT: You are working in the directory: {repo_path}
 
 WORKFLOW STEPS:
 1. First, understand the repository structure:
    - Call list_files('{repo_path}') to see what files exist
-   - Call load_repo_analysis('{repo_path}') for repo context (if available)
+   - Call load_repo_analysis('{repo_path}') for repo context (if available); once you know the
+     candidate files, pass files='path/a.py,path/b.py' to load only their analysis sections
    
 2. Read relevant files using logged_file_read() with relative paths
    - Example: logged_file_read('main.py') not logged_file_read('{repo_path}/main.py')
-
+{file_selection_block}
 3. Make necessary code changes:
   - For EXISTING files: generate a minimal unified diff and call apply_unified_patch(patch_text).
   - For NEW files: prefer unified diff creation (apply_unified_patch with /dev/null headers).
@@ -270,8 +366,10 @@ WORKFLOW STEPS:
     • If absolutely necessary, you MAY use logged_file_write ONLY for truly new files that do not exist.
 
   - NEVER rewrite an entire file if you’re only adding or changing a few lines.
+  - To remove an obsolete file call delete_file(path); to move one call rename_file(from_path, to_path),
+    then patch it at its new path. List deleted files and both paths of renamed files in changes_made.
   - Use POSIX (forward-slash) relative paths in patch headers.
-
+{code_generation_block}
 {edit_strategy_block}
 4. Generate PR body:
    - Call generate_pr_body_tool(
@@ -282,11 +380,13 @@ WORKFLOW STEPS:
        technical_details='How you implemented it',
        testing_instructions='How to test'
      )
-
+{pr_body_budget_block}
 5. Return AutomationResult with:
    - changes_made: List of relative file paths you modified
    - pr_body_file: '.devflow-pr-body.md'
    - summary: Brief description of changes
+   - plan_confidence: 0-1, how sure you are that you understood the issue and chose the right files
+   - confidence: 0-1, how sure you are that your changes resolve the issue
 
 CRITICAL RULES:
 - Use relative paths for all file operations
@@ -299,6 +399,7 @@ Return detailed information about all changes made.
         
         print(f"[Server] Executing agent...")
         # Execute agent
+        FILE_OPERATIONS.clear()
         with pushd(repo_path):
             result = agent(task)
         
@@ -314,6 +415,8 @@ Return detailed information about all changes made.
         completed = False
         success = False
         error_message = ""
+        plan_confidence = None
+        confidence = None
 
         if structured is not None:
             # Map FileChange[] -> list[str]
@@ -330,6 +433,8 @@ Return detailed information about all changes made.
             completed = bool(getattr(structured, "completed", False))
             success = bool(getattr(structured, "success", False))
             error_message = getattr(structured, "error_message", "") or ""
+            plan_confidence = getattr(structured, "plan_confidence", None)
+            confidence = getattr(structured, "confidence", None)
 
         # ✅ Fallback: if model didn't return structured or returned no changes,
         # compute changes by asking Git directly
@@ -352,6 +457,12 @@ Return detailed information about all changes made.
                 rel = p
             normalized_changes.append(rel.replace("\\", "/"))
 
+        # Deleted and renamed files must reach DevFlow even when the model left them out
+        for op in FILE_OPERATIONS:
+            for p in (op.get("from"), op["path"]):
+                if p and p not in normalized_changes:
+                    normalized_changes.append(p)
+
         changes_list = normalized_changes
 
 
@@ -385,6 +496,9 @@ Return detailed information about all changes made.
             summary=summary,
             pr_body_file=pr_file,
             error_message=error_message,
+            plan_confidence=plan_confidence,
+            confidence=confidence,
+            file_operations=list(FILE_OPERATIONS),
         )
 
 
@@ -408,6 +522,7 @@ async def process_issue(request: ProcessIssueRequest):
     Process an issue and automatically determine mode based on labels.
     - If 'devflow-suggestion' label present -> suggestion mode
     - If 'devflow-agent-automate' label present -> automate mode
+    - If mode is 'docs' or 'devflow:docs' label present -> documentation mode
     - Otherwise -> default to suggestion mode
     """
     print(f"[Server] Received process request: {request.issue.title}")
@@ -417,7 +532,12 @@ async def process_issue(request: ProcessIssueRequest):
     labels = request.issue.labels
     
     # --- New DevFlow Dual-Mode Label Routing ---
-    if 'devflow-agent-suggest-changes' in labels:
+    if request.mode == "docs" or 'devflow:docs' in labels:
+        print("[Server] Mode: DOCS")
+        request.mode = "docs"
+        return await automate_changes(request)
+
+    elif 'devflow-agent-suggest-changes' in labels:
         print("[Server] Mode: SUGGESTION")
         return await suggest_changes(request)
 
@@ -34,3 +34,5 @@ class AutomationResult(BaseModel):
     summary: str = Field(description="Summary of what was done")
     pr_body_file: Optional[str] = Field(default="", description="Path to generated PR body markdown file (relative to repo root)")
     error_message: Optional[str] = Field(default="", description="Any error messages")
+    plan_confidence: Optional[float] = Field(default=None, description="How sure you are, from 0 to 1, that you understood the issue and chose the right files")
+    confidence: Optional[float] = Field(default=None, description="How sure you are, from 0 to 1, that your changes resolve the issue")
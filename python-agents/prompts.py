@@ -31,11 +31,17 @@ EDITING RULES (STRICT):
 - Use POSIX-style paths (forward slashes) in patch headers.
 - For new files, include standard git headers in the patch: 'new file mode 100644', '--- /dev/null', '+++'.
 - After applying, list changed files as relative paths in 'changes_made'.
+- apply_unified_patch validates and applies each hunk separately. If it reports PARTIAL or ERROR,
+  the successful hunks are already applied: re-read the file and resend ONLY the failed hunks.
 
 For MODIFYING existing files:
   - Generate a minimal unified diff and call apply_unified_patch(patch_text).
   - Only when making a tiny, single-line substitution and a patch would be excessive, you MAY use logged_editor(path, old_str, new_str). Keep old_str minimal and precise.
 
+For REMOVING or MOVING files:
+  - Call delete_file(path) for a file the issue makes obsolete; never empty it instead.
+  - Call rename_file(from_path, to_path) to move a file, then patch it at its new path.
+
 For CREATING new files:
   - Prefer including the new file in a unified diff patch (apply_unified_patch).
   - Alternatively, you MAY use logged_file_write(path, content) **only** if the file does not exist.
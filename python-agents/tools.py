@@ -13,8 +13,30 @@ from strands import tool
 def normalize_path_for_display(path: str) -> str:
     return path.replace("\\", "/")
 
+def _load_analysis_sections(analysis_file: str, index_file: str, files: list[str]) -> str:
+    """Return the overview plus the sections of repo-analysis.md that mention any of files."""
+    with open(index_file, 'r', encoding='utf-8') as f:
+        index = json.load(f)
+    wanted = set()
+    for path in files:
+        wanted.update(index.get("files", {}).get(path.replace("\\", "/"), []))
+    sections = index.get("sections", [])
+    if not wanted or not sections:
+        return ""
+    wanted.add(0)
+    with open(analysis_file, 'rb') as f:
+        content = f.read()
+    parts = []
+    for i in sorted(wanted):
+        if i < len(sections):
+            s = sections[i]
+            parts.append(content[s["start"]:s["end"]].decode('utf-8', errors='replace'))
+    return "".join(parts)
+
 @tool
-def load_repo_analysis(repo_path: str) -> str:
+def load_repo_analysis(repo_path: str, files: str = "") -> str:
+    """Load .devflow/repo-analysis.md. Pass a comma-separated list of repository-relative
+    files to load only the analysis sections that mention them."""
     print(f"[Tool] load_repo_analysis: {normalize_path_for_display(repo_path)}")
     if not os.path.isabs(repo_path):
         repo_path = os.path.abspath(repo_path)
@@ -23,6 +45,16 @@ def load_repo_analysis(repo_path: str) -> str:
         msg = f"Repository analysis not found at {normalize_path_for_display(analysis_file)}"
         print(f"[Tool] {msg}")
         return msg
+    index_file = os.path.join(repo_path, ".devflow", "repo-analysis-index.json")
+    wanted = [p.strip() for p in files.split(",") if p.strip()]
+    if wanted and os.path.exists(index_file):
+        try:
+            content = _load_analysis_sections(analysis_file, index_file, wanted)
+            if content:
+                print(f"[Tool] Loaded analysis sections for {len(wanted)} files ({len(content)} chars)")
+                return content
+        except Exception as e:
+            print(f"[Tool] Analysis index unusable, loading full analysis: {str(e)}")
     try:
         with open(analysis_file, 'r', encoding='utf-8') as f:
             content = f.read()
@@ -54,6 +86,56 @@ def load_dependency_graph(repo_path: str) -> str:
         print(f"[Tool] {error_msg}")
         return error_msg
 
+@tool
+def find_callers(repo_path: str, function: str, depth: int = 1) -> str:
+    """List the functions that call a function, directly or through other calls (depth 1-3),
+    from the knowledge base's Go and TypeScript call graph. Use it before changing a function's
+    signature or behavior. function is a name such as ParseConfig or Client.Do, or a full ID."""
+    print(f"[Tool] find_callers: {function} (depth {depth})")
+    if not os.path.isabs(repo_path):
+        repo_path = os.path.abspath(repo_path)
+    graph_file = os.path.join(repo_path, ".devflow", "call-graph.json")
+    if not os.path.exists(graph_file):
+        return "No call graph in the knowledge base; search the code for callers instead"
+    try:
+        with open(graph_file, 'r', encoding='utf-8') as f:
+            functions = json.load(f).get("functions") or []
+    except Exception as e:
+        error_msg = f"Error reading call graph: {str(e)}"
+        print(f"[Tool] {error_msg}")
+        return error_msg
+
+    by_id = {fn["id"]: fn for fn in functions}
+    callers = {}
+    for fn in functions:
+        for callee in fn.get("calls") or []:
+            callers.setdefault(callee, []).append(fn["id"])
+    matches = [fn for fn in functions if fn["id"] == function or fn.get("name") == function
+               or fn["id"].endswith("." + function) or fn["id"].endswith("#" + function)]
+    if not matches:
+        return f"No function {function!r} in the call graph"
+
+    depth = min(max(int(depth), 1), 3)
+    lines = []
+    for fn in matches:
+        lines.append(f"{fn['id']} ({fn['file']}:{fn['line']}) {fn.get('signature', '')}")
+        seen, frontier, found = {fn["id"]}, [fn["id"]], False
+        for level in range(1, depth + 1):
+            nxt = []
+            for callee in frontier:
+                for caller in sorted(callers.get(callee, [])):
+                    if caller in seen:
+                        continue
+                    seen.add(caller)
+                    nxt.append(caller)
+                    c = by_id[caller]
+                    lines.append(f"  {'  ' * (level - 1)}{caller} ({c['file']}:{c['line']})")
+                    found = True
+            frontier = nxt
+        if not found:
+            lines.append("  no callers")
+    return "\n".join(lines)
+
 @tool
 def list_files(repo_path: str, max_files: int = 100) -> str:
     print(f"[Tool] list_files: {normalize_path_for_display(repo_path)}")
@@ -136,6 +218,49 @@ def logged_file_write(path: str, content: str) -> str:
         print(f"[Tool] {msg}")
         return msg
 
+# Deletions and renames made by delete_file / rename_file during the current request, as
+# {"op": "delete"|"rename", "path": ..., "from": ...} with repository-relative paths
+FILE_OPERATIONS: list[dict] = []
+
+def _repo_relative(path: str) -> str:
+    return os.path.relpath(os.path.abspath(path), os.getcwd()).replace("\\", "/")
+
+@tool
+def delete_file(path: str) -> str:
+    """Delete an obsolete file from the repository. Use it instead of emptying the file."""
+    if not os.path.isabs(path):
+        path = os.path.abspath(path)
+    display_path = normalize_path_for_display(path)
+    print(f"[Tool] delete_file: {display_path}")
+    if not os.path.isfile(path):
+        return f"Error: File does not exist: {display_path}"
+    try:
+        os.remove(path)
+    except Exception as e:
+        return f"Error deleting {display_path}: {e}"
+    FILE_OPERATIONS.append({"op": "delete", "path": _repo_relative(path)})
+    return f"Deleted {display_path}"
+
+@tool
+def rename_file(from_path: str, to_path: str) -> str:
+    """Move a file to a new path, creating its directory. Edit its content afterwards with
+    apply_unified_patch against the new path."""
+    src = from_path if os.path.isabs(from_path) else os.path.abspath(from_path)
+    dst = to_path if os.path.isabs(to_path) else os.path.abspath(to_path)
+    print(f"[Tool] rename_file: {normalize_path_for_display(src)} -> {normalize_path_for_display(dst)}")
+    if not os.path.isfile(src):
+        return f"Error: File does not exist: {normalize_path_for_display(src)}"
+    if os.path.exists(dst):
+        return f"Refusing to overwrite existing file: {normalize_path_for_display(dst)}"
+    try:
+        if os.path.dirname(dst):
+            os.makedirs(os.path.dirname(dst), exist_ok=True)
+        os.rename(src, dst)
+    except Exception as e:
+        return f"Error renaming {normalize_path_for_display(src)}: {e}"
+    FILE_OPERATIONS.append({"op": "rename", "path": _repo_relative(dst), "from": _repo_relative(src)})
+    return f"Renamed {normalize_path_for_display(src)} to {normalize_path_for_display(dst)}"
+
 @tool
 def logged_editor(path: str, old_str: str, new_str: str) -> str:
     """
@@ -212,6 +337,8 @@ def read_file_with_lines(path: str) -> str:
 def apply_unified_patch(patch_text: str, three_way: bool = True, allow_new_files: bool = False) -> str:
     """
     Apply unified diff with tolerant flags + diagnostics; avoids CRLF/LF churn.
+    Each hunk is validated (git apply --check) and applied on its own; hunks that
+    don't apply are rejected and returned so only they need to be regenerated.
     Rejects risky 'near-rewrite' patches on existing files unless explicitly allowed.
     To allow a true full rewrite, include the literal token [ALLOW_FULL_REWRITE] in the patch.
     """
@@ -294,12 +421,6 @@ def apply_unified_patch(patch_text: str, three_way: bool = True, allow_new_files
     if reject_msg:
         return reject_msg
 
-    # Write patch to temp file
-    tmpdir = tempfile.mkdtemp(prefix="devflow_patch_")
-    patch_path = os.path.join(tmpdir, "change.patch")
-    with open(patch_path, "w", encoding="utf-8", newline="\n") as f:
-        f.write(patch_text)
-
     def _run(cmd):
         p = subprocess.Popen(cmd, cwd=repo_cwd, stdout=subprocess.PIPE, stderr=subprocess.PIPE, text=True, shell=False)
         o, e = p.communicate()
@@ -311,21 +432,103 @@ def apply_unified_patch(patch_text: str, three_way: bool = True, allow_new_files
     except Exception:
         pass
 
-    cmd = ["git", "apply", "--index", "--recount", "--ignore-space-change", "--ignore-whitespace"]
+    tmpdir = tempfile.mkdtemp(prefix="devflow_patch_")
+    base_cmd = ["git", "apply", "--index", "--recount", "--ignore-space-change", "--ignore-whitespace"]
     if three_way:
-        cmd.append("--3way")
-    cmd.append(patch_path)
-
-    code, out_git, err_git = _run(cmd)
-    if code == 0:
-        return f"OK: patch applied\n{out_git}".rstrip()
-
-    return (
-        "ERROR applying patch\n"
-        f"\n--- sanitized patch path ---\n{patch_path}\n"
-        f"\n--- git stdout ---\n{out_git}"
-        f"\n--- git stderr ---\n{err_git}"
-    )
+        base_cmd.append("--3way")
+
+    # Apply hunk-by-hunk so one bad hunk doesn't discard the good ones, and so
+    # the model only has to resend the hunks that failed validation.
+    units = _split_patch_units(patch_text)
+    if not units:
+        return (
+            "ERROR: the patch contains no hunks or file changes, so nothing was applied.\n"
+            "Send a unified diff with '--- a/<path>' / '+++ b/<path>' headers and '@@' hunks, "
+            "or a git header with 'rename from'/'rename to' or 'old mode'/'new mode' lines."
+        )
+    applied, failed = 0, []
+    for i, unit in enumerate(units):
+        unit_path = os.path.join(tmpdir, f"hunk_{i}.patch")
+        with open(unit_path, "w", encoding="utf-8", newline="\n") as f:
+            f.write(unit["text"])
+
+        code, _, err_check = _run(base_cmd + ["--check", unit_path])
+        if code == 0:
+            code, _, err_check = _run(base_cmd + [unit_path])
+        if code == 0:
+            applied += 1
+        else:
+            failed.append((unit, err_check.strip()))
+
+    print(f"[PatchApply] applied {applied}/{len(units)} hunks, failed {len(failed)}")
+
+    if not failed:
+        return f"OK: patch applied ({applied} hunks)"
+
+    report = [
+        f"PARTIAL: applied {applied} of {len(units)} hunks." if applied else "ERROR applying patch: no hunks applied.",
+        "The following hunks did NOT apply. Re-read the affected files with read_file_with_lines and resend ONLY these hunks (corrected context lines) via apply_unified_patch:",
+    ]
+    for unit, err in failed:
+        report.append(f"\n--- failed hunk in {unit['target']} ---\n{unit['text']}\n--- git stderr ---\n{err}")
+    return "\n".join(report)
+
+
+def _split_patch_units(patch_text: str) -> list:
+    """
+    Split a unified diff into independently applicable units: one unit per hunk
+    for existing files (file headers repeated), one unit per new/deleted, renamed
+    or mode-changed file. A rename or mode change without hunks is a unit of its
+    header alone.
+    """
+    units = []
+    header, hunk, target, whole_file = [], [], None, False
+    # Extended git headers that are changes on their own and must be applied once
+    whole_file_headers = ("new file mode", "deleted file mode", "rename from", "rename to",
+                          "copy from", "copy to", "old mode", "new mode")
+
+    def _flush():
+        if hunk:
+            units.append({"target": target, "text": "\n".join(header + hunk) + "\n"})
+        elif any(l.startswith(whole_file_headers) for l in header):
+            units.append({"target": target, "text": "\n".join(header) + "\n"})
+
+    lines = patch_text.splitlines()
+    for i, ln in enumerate(lines):
+        next_ln = lines[i + 1] if i + 1 < len(lines) else ""
+        starts_file = ln.startswith("diff --git ") or (
+            ln.startswith("--- ") and next_ln.startswith("+++ ") and not (header and header[-1].startswith("diff --git"))
+            and not (header and not hunk)
+        )
+        if starts_file:
+            _flush()
+            header, hunk, target, whole_file = [ln], [], None, False
+            m = re.match(r"diff --git a/(\S+) b/(\S+)$", ln)
+            if m:
+                target = m.group(2)
+            if ln.startswith("--- "):
+                whole_file = ln.startswith("--- /dev/null")
+            continue
+        if ln.startswith("@@ "):
+            if not whole_file:
+                _flush()
+                hunk = []
+            hunk.append(ln)
+            continue
+        if hunk:
+            hunk.append(ln)
+            continue
+        header.append(ln)
+        if ln.startswith(whole_file_headers + ("--- /dev/null", "+++ /dev/null")):
+            whole_file = True
+        if ln.startswith(("rename to ", "copy to ")):
+            target = ln.split(" ", 2)[2].strip()
+        if ln.startswith("+++ ") or (ln.startswith("--- ") and target is None):
+            path = ln[4:].strip()
+            if path != "/dev/null":
+                target = path[2:] if path.startswith(("a/", "b/")) else path
+    _flush()
+    return units
 
 
 @tool
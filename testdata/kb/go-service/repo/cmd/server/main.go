@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"example.com/service/internal/store"
+)
+
+func main() {
+	s := store.NewMemory()
+	_ = s.Put(&store.User{ID: 1, Name: "ada"})
+	http.HandleFunc("/users", usersHandler(s))
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}
+
+func usersHandler(s store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "id must be a number", http.StatusBadRequest)
+			return
+		}
+		u, err := s.Get(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(u)
+	}
+}
@@ -0,0 +1,52 @@
+// Package store keeps users in memory.
+package store
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNotFound is returned for unknown users
+var ErrNotFound = errors.New("user not found")
+
+// User is a registered user
+type User struct {
+	ID   int
+	Name string
+}
+
+// Store is implemented by user stores
+type Store interface {
+	Get(id int) (*User, error)
+	Put(u *User) error
+}
+
+// Memory is a Store kept in memory
+type Memory struct {
+	mu    sync.Mutex
+	users map[int]*User
+}
+
+// NewMemory returns an empty Memory store
+func NewMemory() *Memory {
+	return &Memory{users: make(map[int]*User)}
+}
+
+// Get returns the user with the given ID
+func (m *Memory) Get(id int) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return u, nil
+}
+
+// Put adds or replaces a user
+func (m *Memory) Put(u *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users[u.ID] = u
+	return nil
+}
@@ -0,0 +1,9 @@
+from flask_sqlalchemy import SQLAlchemy
+
+db = SQLAlchemy()
+
+
+class Order(db.Model):
+    id = db.Column(db.Integer, primary_key=True)
+    item = db.Column(db.String(80), nullable=False)
+    quantity = db.Column(db.Integer, default=1)
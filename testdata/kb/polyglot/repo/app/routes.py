@@ -0,0 +1,18 @@
+from flask import Blueprint, jsonify, request
+
+from .models import Order, db
+
+bp = Blueprint("orders", __name__)
+
+
+@bp.get("/orders")
+def list_orders():
+    return jsonify([{"id": o.id, "item": o.item} for o in Order.query.all()])
+
+
+@bp.post("/orders")
+def create_order():
+    order = Order(item=request.json["item"], quantity=request.json.get("quantity", 1))
+    db.session.add(order)
+    db.session.commit()
+    return jsonify({"id": order.id}), 201
@@ -0,0 +1,5 @@
+CREATE TABLE orders (
+    id INTEGER PRIMARY KEY,
+    item VARCHAR(80) NOT NULL,
+    quantity INTEGER DEFAULT 1
+);
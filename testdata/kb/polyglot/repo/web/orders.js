@@ -0,0 +1,8 @@
+const { renderTable } = require("./table");
+
+async function loadOrders() {
+  const res = await fetch("/orders");
+  renderTable(await res.json());
+}
+
+module.exports = { loadOrders };
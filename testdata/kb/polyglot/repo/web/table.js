@@ -0,0 +1,6 @@
+function renderTable(rows) {
+  const body = rows.map((r) => `<tr><td>${r.id}</td><td>${r.item}</td></tr>`).join("");
+  document.getElementById("orders").innerHTML = body;
+}
+
+module.exports = { renderTable };
@@ -0,0 +1,23 @@
+export interface Todo {
+  id: number;
+  title: string;
+  done: boolean;
+}
+
+const baseURL = "/api";
+
+export async function fetchTodos(): Promise<Todo[]> {
+  const res = await fetch(`${baseURL}/todos`);
+  if (!res.ok) {
+    throw new Error(`failed to load todos: ${res.status}`);
+  }
+  return res.json();
+}
+
+export async function toggleTodo(todo: Todo): Promise<Todo> {
+  const res = await fetch(`${baseURL}/todos/${todo.id}`, {
+    method: "PATCH",
+    body: JSON.stringify({ done: !todo.done }),
+  });
+  return res.json();
+}
@@ -0,0 +1,26 @@
+import { useEffect, useState } from "react";
+import { fetchTodos, toggleTodo, Todo } from "../api/client";
+
+export function TodoList() {
+  const [todos, setTodos] = useState<Todo[]>([]);
+
+  useEffect(() => {
+    fetchTodos().then(setTodos);
+  }, []);
+
+  const onToggle = async (todo: Todo) => {
+    const updated = await toggleTodo(todo);
+    setTodos(todos.map((t) => (t.id === updated.id ? updated : t)));
+  };
+
+  return (
+    <ul>
+      {todos.map((t) => (
+        <li key={t.id} onClick={() => onToggle(t)}>
+          {t.done ? "✓ " : ""}
+          {t.title}
+        </li>
+      ))}
+    </ul>
+  );
+}
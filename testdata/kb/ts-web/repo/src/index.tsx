@@ -0,0 +1,4 @@
+import { createRoot } from "react-dom/client";
+import { TodoList } from "./components/TodoList";
+
+createRoot(document.getElementById("root")!).render(<TodoList />);